@@ -0,0 +1,10 @@
+// Package apis embeds the OpenAPI descriptions generated from the protobuf
+// definitions, so they can be served next to the HTTP gateway.
+package apis
+
+import "embed"
+
+// OpenAPI contains the generated `*.swagger.json` files.
+//
+//go:embed *.swagger.json
+var OpenAPI embed.FS
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/peterbourgon/ff/v3/ffcli"
+
+	"berty.tech/berty/v2/go/internal/accountutils"
+	"berty.tech/berty/v2/go/internal/messengerdb"
+)
+
+func dbMigrateCommand() *ffcli.Command {
+	var postgresDSN string
+
+	fsBuilder := func() (*flag.FlagSet, error) {
+		fs := flag.NewFlagSet("berty db-migrate", flag.ExitOnError)
+		fs.String("config", "", "config file (optional)")
+		manager.SetupLoggingFlags(fs)   // also available at root level
+		manager.SetupDatastoreFlags(fs) // location of the account to migrate
+		fs.StringVar(&postgresDSN, "db-migrate.postgres-dsn", "", `destination Postgres database, i.e. "host=localhost user=berty dbname=berty"`)
+		return fs, nil
+	}
+
+	return &ffcli.Command{
+		Name:       "db-migrate",
+		ShortUsage: "berty [global flags] db-migrate [flags]",
+		ShortHelp:  "copy the messenger database of an account into a Postgres database",
+		LongHelp: `The SQLite database is copied from a single snapshot and locked for writing
+until the copy is done. There is no read-only mode: an account node running
+during the migration keeps serving reads, but each of its writes waits for
+the busy timeout (5s) then fails with "database is locked", stop it first to
+avoid that. Every table is verified (row count and checksum) before the
+command succeeds, the destination tables must be empty. Once migrated, the
+node uses the copy when started with -node.postgres-dsn.`,
+		FlagSetBuilder: fsBuilder,
+		Options:        ffSubcommandOptions(),
+		UsageFunc:      usageFunc,
+		Exec: func(ctx context.Context, args []string) error {
+			if len(args) > 0 {
+				return flag.ErrHelp
+			}
+
+			if postgresDSN == "" {
+				return fmt.Errorf("no destination database specified")
+			}
+
+			logger, err := manager.GetLogger()
+			if err != nil {
+				return err
+			}
+
+			src, err := manager.GetMessengerDB()
+			if err != nil {
+				return err
+			}
+
+			dst, dstCleanup, err := accountutils.GetMessengerDBForPostgres(postgresDSN, logger)
+			if err != nil {
+				return err
+			}
+			defer dstCleanup()
+
+			tables, err := messengerdb.MigrateDB(ctx, src, dst, logger)
+			if err != nil {
+				return err
+			}
+
+			for _, table := range tables {
+				fmt.Printf("%-32s %8d rows  sha256:%s\n", table.Name, table.Rows, table.Checksum)
+			}
+
+			return nil
+		},
+	}
+}
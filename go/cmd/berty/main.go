@@ -76,6 +76,7 @@ func runMain(args []string) error {
 				replicationServerCommand(),
 				peersCommand(),
 				exportCommand(),
+				dbMigrateCommand(),
 				remoteLogsCommand(),
 				serviceKeyCommand(),
 				pushServerCommand(),
@@ -13,12 +13,11 @@ import (
 	"time"
 
 	"github.com/atotto/clipboard"
-	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
-	"github.com/golang/protobuf/proto"
 	"github.com/ipfs/go-cid"
 	"github.com/mdp/qrterminal/v3"
 	"moul.io/godev"
 
+	"berty.tech/berty/v2/go/internal/protoutil"
 	"berty.tech/berty/v2/go/pkg/bertylinks"
 	"berty.tech/berty/v2/go/pkg/bertyvcissuer"
 	"berty.tech/berty/v2/go/pkg/errcode"
@@ -937,7 +936,7 @@ func newMessageCommand(ctx context.Context, v *groupView, cmd string) error {
 		return nil
 	}
 
-	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{
+	payload, err := protoutil.Marshal(&messengertypes.AppMessage_UserMessage{
 		Body: cmd,
 	})
 	if err != nil {
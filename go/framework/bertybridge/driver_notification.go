@@ -36,9 +36,12 @@ func (a *notificationManagerAdapter) Notify(notif *notification.Notification) er
 	a.logger.Debug("notification triggered",
 		logutil.PrivateString("title", notif.Title), logutil.PrivateString("body", notif.Body))
 	return a.driver.Post(&LocalNotification{
-		Title:    notif.Title,
-		Body:     notif.Body,
-		Interval: 0.0,
+		Title:     notif.Title,
+		Body:      notif.Body,
+		Interval:  0.0,
+		GroupKey:  notif.GroupKey,
+		ThreadKey: notif.ThreadKey,
+		Category:  notif.Category,
 	})
 }
 
@@ -46,9 +49,12 @@ func (a *notificationManagerAdapter) Schedule(notif *notification.Notification,
 	a.logger.Debug("notification scheduled",
 		logutil.PrivateString("title", notif.Title), logutil.PrivateString("body", notif.Body))
 	return a.driver.Post(&LocalNotification{
-		Title:    notif.Title,
-		Body:     notif.Body,
-		Interval: interval.Seconds(),
+		Title:     notif.Title,
+		Body:      notif.Body,
+		Interval:  interval.Seconds(),
+		GroupKey:  notif.GroupKey,
+		ThreadKey: notif.ThreadKey,
+		Category:  notif.Category,
 	})
 }
 
@@ -56,4 +62,10 @@ type LocalNotification struct {
 	Title    string
 	Body     string
 	Interval float64
+
+	// GroupKey and ThreadKey are used to stack the notifications, see
+	// notification.Notification
+	GroupKey  string
+	ThreadKey string
+	Category  string
 }
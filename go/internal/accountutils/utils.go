@@ -18,11 +18,13 @@ import (
 	sync_ds "github.com/ipfs/go-datastore/sync"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/nacl/box"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"moul.io/zapgorm2"
 
 	"berty.tech/berty/v2/go/internal/cryptoutil"
 	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerdb"
 	"berty.tech/berty/v2/go/pkg/accounttypes"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	encrepo "berty.tech/go-ipfs-repo-encrypted"
@@ -268,11 +270,72 @@ func GetRootDatastoreForPath(dir string, key []byte, salt []byte, logger *zap.Lo
 }
 
 func GetMessengerDBForPath(dir string, key []byte, salt []byte, logger *zap.Logger) (*gorm.DB, func(), error) {
-	if dir != InMemoryDir {
-		dir = path.Join(dir, MessengerDatabaseFilename)
+	if dir == InMemoryDir {
+		return GetGormDBForPath(dir, key, salt, logger)
+	}
+
+	dbPath := path.Join(dir, MessengerDatabaseFilename)
+	db, cleanup, err := GetGormDBForPath(dbPath, key, salt, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = messengerdb.CheckDBIntegrity(db)
+	if err == nil {
+		return db, cleanup, nil
+	}
+
+	cleanup()
+
+	if !errcode.Is(err, errcode.ErrDBCorrupted) {
+		return nil, nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	// the messenger database only contains state that can be rebuilt from
+	// the protocol logs, move the damaged file aside and start from scratch,
+	// the messenger will replay the logs when initializing the empty db
+	quarantinePath, qErr := quarantineDBFile(dbPath)
+	if qErr != nil {
+		return nil, nil, errcode.ErrDBCorrupted.Wrap(fmt.Errorf("unable to quarantine damaged database: %w", qErr))
+	}
+
+	logger.Error("messenger database is corrupted, moved it aside and starting with a fresh one", zap.Error(err), logutil.PrivateString("quarantine-path", quarantinePath))
+
+	return GetGormDBForPath(dbPath, key, salt, logger)
+}
+
+// GetMessengerDBForPostgres opens a messenger database stored in Postgres, i.e.
+// one copied from the SQLite database of an account by the db-migrate command.
+// Its integrity is left to the server and full text search is not available.
+func GetMessengerDBForPostgres(dsn string, logger *zap.Logger) (*gorm.DB, func(), error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger:                                   zapgorm2.New(logger.Named("gorm")),
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	if err != nil {
+		return nil, nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	return db, func() {
+		sqlDB, _ := db.DB()
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+	}, nil
+}
+
+// quarantineDBFile renames a sqlite database file and its journal files so
+// they can be inspected later, it returns the new path of the database
+func quarantineDBFile(dbPath string) (string, error) {
+	quarantinePath := fmt.Sprintf("%s.corrupted-%d", dbPath, time.Now().Unix())
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(dbPath+suffix, quarantinePath+suffix); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
 	}
 
-	return GetGormDBForPath(dir, key, salt, logger)
+	return quarantinePath, nil
 }
 
 func GetReplicationDBForPath(dir string, logger *zap.Logger) (*gorm.DB, func(), error) {
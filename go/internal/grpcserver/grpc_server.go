@@ -2,6 +2,7 @@ package grpcserver
 
 import (
 	"context"
+	"io/fs"
 	"strings"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
@@ -30,6 +31,16 @@ type GRPCOpts struct {
 	AuthSecret    string
 	Listeners     string
 	ServiceID     string
+
+	// OpenAPIDocs, if set, is served by the gateway under `/openapi/`
+	OpenAPIDocs fs.FS
+}
+
+// GatewayMarshaler is the JSON marshaler used by the gRPC gateway, it emits
+// lowerCamelCase field names and default values so the replies always match
+// the generated OpenAPI descriptions
+func GatewayMarshaler() grpcgw.Marshaler {
+	return &grpcgw.JSONPb{OrigName: false, EmitDefaults: true}
 }
 
 func InitGRPCServer(workers *run.Group, opts *GRPCOpts) (*grpc.Server, *grpcgw.ServeMux, []grpcutil.Listener, error) {
@@ -69,7 +80,7 @@ func InitGRPCServer(workers *run.Group, opts *GRPCOpts) (*grpc.Server, *grpcgw.S
 
 		serviceID := opts.ServiceID
 		switch serviceID {
-		case authtypes.ServiceReplicationID:
+		case authtypes.ServiceReplicationID, authtypes.ServiceDirectoryID:
 			authFunc = man.GRPCAuthInterceptor(serviceID)
 		case "":
 			logger.Warn("GRPCAuth: Internal field ServiceID should not be empty", logutil.PrivateString("serviceID", serviceID))
@@ -93,7 +104,7 @@ func InitGRPCServer(workers *run.Group, opts *GRPCOpts) (*grpc.Server, *grpcgw.S
 	}
 
 	grpcServer := grpc.NewServer(grpcOpts...)
-	grpcGatewayMux := grpcgw.NewServeMux()
+	grpcGatewayMux := grpcgw.NewServeMux(grpcgw.WithMarshalerOption(grpcgw.MIMEWildcard, GatewayMarshaler()))
 
 	listeners := []grpcutil.Listener(nil)
 	if opts.Listeners != "" {
@@ -105,8 +116,9 @@ func InitGRPCServer(workers *run.Group, opts *GRPCOpts) (*grpc.Server, *grpcgw.S
 		listeners = make([]grpcutil.Listener, len(maddrs))
 
 		server := grpcutil.Server{
-			GRPCServer: grpcServer,
-			GatewayMux: grpcGatewayMux,
+			GRPCServer:  grpcServer,
+			GatewayMux:  grpcGatewayMux,
+			OpenAPIDocs: opts.OpenAPIDocs,
 		}
 
 		for idx, maddr := range maddrs {
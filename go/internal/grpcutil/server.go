@@ -3,6 +3,7 @@ package grpcutil
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"net"
 	"net/http"
 	"time"
@@ -106,9 +107,10 @@ func (l *listener) GRPCMultiaddr() ma.Multiaddr {
 }
 
 type Server struct {
-	GRPCServer *grpc.Server
-	GatewayMux *grpcgw.ServeMux
-	servers    []io.Closer
+	GRPCServer  *grpc.Server
+	GatewayMux  *grpcgw.ServeMux
+	OpenAPIDocs fs.FS
+	servers     []io.Closer
 }
 
 func (s *Server) Close() error {
@@ -148,7 +150,7 @@ func (s *Server) Serve(l Listener) error {
 				return false
 			}
 			gatewayServer := http.Server{
-				Handler:           s.GatewayMux,
+				Handler:           s.gatewayHandler(),
 				ReadHeaderTimeout: 5 * time.Second, // protect against Slowloris attack
 			}
 
@@ -173,6 +175,17 @@ func (s *Server) Serve(l Listener) error {
 	return serve(manet.NetListener(l))
 }
 
+func (s *Server) gatewayHandler() http.Handler {
+	if s.OpenAPIDocs == nil {
+		return s.GatewayMux
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/openapi/", http.StripPrefix("/openapi/", http.FileServer(http.FS(s.OpenAPIDocs))))
+	mux.Handle("/", s.GatewayMux)
+	return mux
+}
+
 //nolint:gochecknoinits
 func init() {
 	// register protos
@@ -163,16 +163,21 @@ type Manager struct {
 			rotationInterval  *rendezvous.RotationInterval
 		}
 		Messenger struct {
-			DisableGroupMonitor  bool   `json:"DisableGroupMonitor,omitempty"`
-			DisplayName          string `json:"DisplayName,omitempty"`
-			DisableNotifications bool   `json:"DisableNotifications,omitempty"`
-			RebuildSqlite        bool   `json:"RebuildSqlite,omitempty"`
-			MessengerSqliteOpts  string `json:"MessengerSqliteOpts,omitempty"`
-			ExportPathToRestore  string `json:"ExportPathToRestore,omitempty"`
+			DisableGroupMonitor  bool          `json:"DisableGroupMonitor,omitempty"`
+			DisplayName          string        `json:"DisplayName,omitempty"`
+			DisableNotifications bool          `json:"DisableNotifications,omitempty"`
+			RebuildSqlite        bool          `json:"RebuildSqlite,omitempty"`
+			MessengerSqliteOpts  string        `json:"MessengerSqliteOpts,omitempty"`
+			PostgresDSN          string        `json:"PostgresDSN,omitempty"`
+			ExportPathToRestore  string        `json:"ExportPathToRestore,omitempty"`
+			HandlerTimeout       time.Duration `json:"HandlerTimeout,omitempty"`
+			ExtraAccounts        string        `json:"ExtraAccounts,omitempty"`
 
 			// internal
 			protocolClient      bertyprotocol.Client
 			server              bertymessenger.Service
+			multiAccount        *bertymessenger.MultiAccountService
+			extraAccounts       []*Manager
 			lcmanager           *lifecycle.Manager
 			notificationManager notification.Manager
 			client              messengertypes.MessengerServiceClient
@@ -327,6 +332,7 @@ func (m *Manager) Close(prog *progress.Progress) error {
 	prog.AddStep("stop-buf-server")
 	prog.AddStep("close-buf-listener")
 	prog.AddStep("stop-grpc-server")
+	prog.AddStep("close-extra-accounts")
 	prog.AddStep("close-messenger-server")
 	prog.AddStep("close-messenger-protocol-client")
 	prog.AddStep("cleanup-messenger-db")
@@ -368,6 +374,11 @@ func (m *Manager) Close(prog *progress.Progress) error {
 		}
 	}
 
+	prog.Get("close-extra-accounts").SetAsCurrent()
+	for _, account := range m.Node.Messenger.extraAccounts {
+		account.Close(nil)
+	}
+
 	prog.Get("close-messenger-server").SetAsCurrent()
 	if m.Node.Messenger.server != nil {
 		m.Node.Messenger.server.Close()
@@ -19,6 +19,9 @@ import (
 	"moul.io/u"
 
 	"berty.tech/berty/v2/go/internal/initutil"
+	"berty.tech/berty/v2/go/pkg/bertymessenger"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/berty/v2/go/pkg/protocoltypes"
 )
 
@@ -262,6 +265,35 @@ func TestLocalProtocolServerAndClient(t *testing.T) {
 	require.NotNil(t, ret.AccountPK)
 }
 
+func TestLocalMessengerServerExtraAccounts(t *testing.T) {
+	ctx := context.Background()
+	manager, err := initutil.New(nil)
+	require.NoError(t, err)
+	require.NotNil(t, manager)
+	defer manager.Close(nil)
+
+	// configure flags
+	fs := flag.NewFlagSet("test", flag.ExitOnError)
+	manager.SetupLoggingFlags(fs)
+	manager.SetupLocalMessengerServerFlags(fs)
+	manager.SetupEmptyGRPCListenersFlags(fs)
+	err = fs.Parse([]string{"-node.listeners=", "-store.inmem", "-log.filters=", "-log.ring-filters=", "-node.extra-accounts=bob=" + t.TempDir()})
+	require.NoError(t, err)
+
+	client, err := manager.GetMessengerClient()
+	require.NoError(t, err)
+
+	// the calls without selector go to the local account
+	local, err := client.AccountGet(ctx, &messengertypes.AccountGet_Request{})
+	require.NoError(t, err)
+	bob, err := client.AccountGet(bertymessenger.ContextWithAccountID(ctx, "bob"), &messengertypes.AccountGet_Request{})
+	require.NoError(t, err)
+	require.NotEqual(t, local.Account.PublicKey, bob.Account.PublicKey)
+
+	_, err = client.AccountGet(bertymessenger.ContextWithAccountID(ctx, "eve"), &messengertypes.AccountGet_Request{})
+	require.True(t, errcode.Is(err, errcode.ErrMessengerUnknownAccount))
+}
+
 func TestLocalProtocolServerLeak(t *testing.T) {
 	defer verifyRunningLeakDetection(t)
 	manager, err := initutil.New(nil)
@@ -15,6 +15,7 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 	"gorm.io/gorm"
 
+	"berty.tech/berty/v2/docs/apis"
 	"berty.tech/berty/v2/go/internal/accountutils"
 	"berty.tech/berty/v2/go/internal/cryptoutil"
 	"berty.tech/berty/v2/go/internal/datastoreutil"
@@ -23,6 +24,7 @@ import (
 	"berty.tech/berty/v2/go/internal/ipfsutil"
 	"berty.tech/berty/v2/go/internal/lifecycle"
 	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerpayloads"
 	"berty.tech/berty/v2/go/pkg/bertymessenger"
 	"berty.tech/berty/v2/go/pkg/bertyprotocol"
 	"berty.tech/berty/v2/go/pkg/errcode"
@@ -102,8 +104,11 @@ func (m *Manager) SetupLocalMessengerServerFlags(fs *flag.FlagSet) {
 	m.SetupNotificationManagerFlags(fs)
 	fs.StringVar(&m.Node.Messenger.ExportPathToRestore, "node.restore-export-path", "", "inits node from a specified export path")
 	fs.BoolVar(&m.Node.Messenger.RebuildSqlite, "node.rebuild-db", false, "reconstruct messenger DB from OrbitDB logs")
+	fs.StringVar(&m.Node.Messenger.PostgresDSN, "node.postgres-dsn", "", `Postgres messenger DB used instead of the account SQLite file once copied with db-migrate, i.e. "host=localhost user=berty dbname=berty"`)
 	fs.BoolVar(&m.Node.Messenger.DisableGroupMonitor, "node.disable-group-monitor", false, "disable group monitoring")
 	fs.StringVar(&m.Node.Messenger.DisplayName, "node.display-name", safeDefaultDisplayName(), "display name")
+	fs.DurationVar(&m.Node.Messenger.HandlerTimeout, "node.handler-timeout", 0, "time given to the handling of a protocol event, 0 uses the default and a negative value disables it")
+	fs.StringVar(&m.Node.Messenger.ExtraAccounts, "node.extra-accounts", "", "comma-separated list of `id=store-dir` of other accounts served by the messenger service, selected with the berty-account-id gRPC metadata")
 	// node.db-opts // see https://github.com/mattn/go-sqlite3#connection-string
 }
 
@@ -285,7 +290,7 @@ func (m *Manager) getGRPCClientConn() (*grpc.ClientConn, error) {
 			protocoltypes.RegisterProtocolServiceServer(grpcServer, m.Node.Protocol.server)
 		}
 		if m.Node.Messenger.server != nil {
-			messengertypes.RegisterMessengerServiceServer(grpcServer, m.Node.Messenger.server)
+			messengertypes.RegisterMessengerServiceServer(grpcServer, m.registeredMessengerServer())
 		}
 
 		m.Node.GRPC.bufServerListener = bl
@@ -427,6 +432,7 @@ func (m *Manager) getGRPCServer() (*grpc.Server, *grpcgw.ServeMux, error) {
 		AuthSecret:    m.Node.Protocol.AuthSecret,
 		Listeners:     m.Node.GRPC.Listeners,
 		ServiceID:     m.Node.Protocol.ServiceID,
+		OpenAPIDocs:   apis.OpenAPI,
 	})
 	if err != nil {
 		return nil, nil, err
@@ -462,6 +468,15 @@ func (m *Manager) getMessengerDB() (*gorm.DB, error) {
 		return nil, errcode.TODO.Wrap(err)
 	}
 
+	if m.Node.Messenger.PostgresDSN != "" {
+		m.Node.Messenger.db, m.Node.Messenger.dbCleanup, err = accountutils.GetMessengerDBForPostgres(m.Node.Messenger.PostgresDSN, logger)
+		if err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+
+		return m.Node.Messenger.db, nil
+	}
+
 	dir, err := m.getSharedDataDir()
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
@@ -637,16 +652,39 @@ func (m *Manager) getLocalMessengerServer() (messengertypes.MessengerServiceServ
 		StateBackup:         m.Node.Messenger.localDBState,
 		Ring:                m.Logging.ring,
 		PlatformPushToken:   pushPlatformToken,
+		IPFSCoreAPI:         m.Node.Protocol.ipfsAPI,
+		GRPCInsecureMode:    m.Node.Protocol.ServiceInsecureMode,
 		LogFilePath:         currentLogfilePath,
+		HandlerTimeouts:     messengerpayloads.HandlerTimeouts{Default: m.Node.Messenger.HandlerTimeout},
 	}
+
+	// register metrics
+	if m.Metrics.Listener != "" {
+		registry, err := m.getMetricsRegistry()
+		if err != nil {
+			return nil, errcode.TODO.Wrap(fmt.Errorf("unable to init metrics registry: %w", err))
+		}
+		opts.MetricsRegistry = registry
+	}
+
 	messengerServer, err := bertymessenger.New(protocolClient, &opts)
 	if err != nil {
 		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to init messenger server: %w", err))
 	}
 
+	m.Node.Messenger.lcmanager = lcmanager
+	m.Node.Messenger.server = messengerServer
+
+	// serve the other accounts along with this one
+	if m.Node.Messenger.ExtraAccounts != "" {
+		if err := m.setupExtraAccounts(logger); err != nil {
+			return nil, errcode.TODO.Wrap(fmt.Errorf("unable to init extra accounts: %w", err))
+		}
+	}
+
 	// register grpc service
-	messengertypes.RegisterMessengerServiceServer(grpcServer, messengerServer)
-	if err := messengertypes.RegisterMessengerServiceHandlerServer(m.getContext(), gatewayMux, messengerServer); err != nil {
+	messengertypes.RegisterMessengerServiceServer(grpcServer, m.registeredMessengerServer())
+	if err := messengertypes.RegisterMessengerServiceHandlerServer(m.getContext(), gatewayMux, m.registeredMessengerServer()); err != nil {
 		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to register messenger service handler: %w", err))
 	}
 
@@ -659,12 +697,87 @@ func (m *Manager) getLocalMessengerServer() (messengertypes.MessengerServiceServ
 		}
 	}
 
-	m.Node.Messenger.lcmanager = lcmanager
-	m.Node.Messenger.server = messengerServer
 	m.initLogger.Debug("messenger server initialized and cached")
 	return m.Node.Messenger.server, nil
 }
 
+// registeredMessengerServer returns the messenger server registered on the
+// gRPC servers, it routes the calls to the extra accounts if any
+func (m *Manager) registeredMessengerServer() messengertypes.MessengerServiceServer {
+	if m.Node.Messenger.multiAccount != nil {
+		return m.Node.Messenger.multiAccount
+	}
+
+	return m.Node.Messenger.server
+}
+
+// setupExtraAccounts opens the accounts listed in Node.Messenger.ExtraAccounts,
+// each one with its own datastore, protocol node and messenger db, and serves
+// them along with the local account, which stays the default one.
+func (m *Manager) setupExtraAccounts(logger *zap.Logger) error {
+	multi := bertymessenger.NewMultiAccountService(logger)
+	if err := multi.AddAccount(m.accountID, m.Node.Messenger.server); err != nil {
+		return err
+	}
+
+	for _, entry := range strings.Split(m.Node.Messenger.ExtraAccounts, ",") {
+		accountID, dir, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || accountID == "" || dir == "" {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid extra account %q, expected id=store-dir", entry))
+		}
+
+		svc, err := m.openExtraAccount(logger, accountID, dir)
+		if err != nil {
+			return fmt.Errorf("unable to open account %s: %w", accountID, err)
+		}
+
+		if err := multi.AddAccount(accountID, svc); err != nil {
+			return err
+		}
+	}
+
+	m.Node.Messenger.multiAccount = multi
+	return nil
+}
+
+// openExtraAccount starts a messenger server for the account stored in dir on
+// a manager of its own, which is closed along with m. The gRPC, IPFS API and
+// WebUI listeners are left to m.
+func (m *Manager) openExtraAccount(logger *zap.Logger, accountID, dir string) (bertymessenger.Service, error) {
+	manager, err := New(&ManagerOpts{
+		DoNotSetDefaultDir: true,
+		NativeKeystore:     m.nativeKeystore,
+		AccountID:          accountID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.Node.Messenger.extraAccounts = append(m.Node.Messenger.extraAccounts, manager)
+
+	fs := flag.NewFlagSet("extra-account", flag.ContinueOnError)
+	manager.Session.Kind = m.Session.Kind
+	manager.SetupLocalMessengerServerFlags(fs)
+	manager.SetupEmptyGRPCListenersFlags(fs)
+	if err := fs.Parse([]string{
+		"-store.dir=" + dir,
+		"-p2p.ipfs-api-listeners=",
+		"-p2p.webui-listener=",
+		"-node.display-name=" + m.Node.Messenger.DisplayName,
+		fmt.Sprintf("-node.handler-timeout=%s", m.Node.Messenger.HandlerTimeout),
+	}); err != nil {
+		return nil, err
+	}
+
+	manager.SetLogger(logger.Named("account-" + accountID))
+	manager.SetNotificationManager(m.Node.Messenger.notificationManager)
+
+	if _, err := manager.GetLocalMessengerServer(); err != nil {
+		return nil, err
+	}
+
+	return manager.Node.Messenger.server, nil
+}
+
 func safeDefaultDisplayName() string {
 	var name string
 	current, err := user.Current()
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	ipfscid "github.com/ipfs/go-cid"
@@ -28,6 +30,13 @@ type DBWrapper struct {
 	ctx        context.Context
 	disableFTS bool
 	inTx       bool
+	notifCache *notificationCache
+	// txMutex serializes the transactions, sqlite has a single writer and a
+	// deferred transaction fails instead of waiting when another one committed
+	// since it started reading. The transactions must not wait for the
+	// protocol, every other transaction would wait with them.
+	txMutex   *sync.Mutex
+	txMetrics *transactionMetrics
 }
 
 func noopReplayer(_ *DBWrapper) error { return nil }
@@ -37,6 +46,11 @@ func (d *DBWrapper) logStep(text string, muts ...tyber.StepMutator) {
 }
 
 func isFTS5Enabled(db *gorm.DB) (bool, error) {
+	// full text search relies on sqlite fts5 virtual tables
+	if !isSQLite(db) {
+		return false, nil
+	}
+
 	var total int64
 
 	rawDB, err := db.DB()
@@ -85,12 +99,35 @@ func NewDBWrapper(db *gorm.DB, log *zap.Logger) *DBWrapper {
 		fts5Enabled = false
 	}
 
+	notifCache, err := notificationCacheFor(db)
+	if err != nil {
+		log.Warn("unable to register the notification cache", zap.Error(err))
+	}
+
 	return &DBWrapper{
 		db:         db.Debug(),
 		log:        log,
 		disableFTS: !fts5Enabled,
 		ctx:        context.TODO(),
 		inTx:       false,
+		notifCache: notifCache,
+		txMutex:    &sync.Mutex{},
+		txMetrics:  &transactionMetrics{},
+	}
+}
+
+// WithLogFields returns a copy of the wrapper adding fields to its logs, the
+// transactions started from it log them too
+func (d *DBWrapper) WithLogFields(fields ...zap.Field) *DBWrapper {
+	return &DBWrapper{
+		db:         d.db,
+		log:        d.log.With(fields...),
+		disableFTS: d.disableFTS,
+		ctx:        d.ctx,
+		inTx:       d.inTx,
+		notifCache: d.notifCache,
+		txMutex:    d.txMutex,
+		txMetrics:  d.txMetrics,
 	}
 }
 
@@ -101,6 +138,9 @@ func (d *DBWrapper) DisableFTS() *DBWrapper {
 		disableFTS: true,
 		ctx:        d.ctx,
 		inTx:       d.inTx,
+		notifCache: d.notifCache,
+		txMutex:    d.txMutex,
+		txMetrics:  d.txMetrics,
 	}
 }
 
@@ -116,6 +156,39 @@ func getDBModels() []interface{} {
 		&messengertypes.ConversationReplicationInfo{},
 		&messengertypes.MetadataEvent{},
 		&messengertypes.SharedPushToken{},
+		&messengertypes.OutboxEvent{},
+		&messengertypes.Media{},
+		&messengertypes.ProfileLink{},
+		&messengertypes.DirectoryServiceRecord{},
+		&messengertypes.Call{},
+		&messengertypes.BroadcastList{},
+		&messengertypes.BroadcastListRecipient{},
+		&messengertypes.Broadcast{},
+		&messengertypes.BroadcastDelivery{},
+		&messengertypes.InteractionTranslation{},
+		&messengertypes.QuoteSnapshot{},
+		&messengertypes.DeliveryReceipt{},
+		&messengertypes.QueuedMessage{},
+		&messengertypes.Bookmark{},
+		&messengertypes.InteractionEdit{},
+		&messengertypes.ReadMarker{},
+		&messengertypes.PinnedMessage{},
+		&messengertypes.ConversationSession{},
+		&messengertypes.PollVote{},
+		&messengertypes.MemberLocation{},
+		&messengertypes.ForwardedFrom{},
+		&messengertypes.MissingInteraction{},
+		&messengertypes.InteractionMention{},
+		&messengertypes.LinkPreview{},
+		&messengertypes.CalendarEventRSVP{},
+		&messengertypes.ConversationDraft{},
+		&messengertypes.ConversationDraftMediaRef{},
+		&messengertypes.FeatureFlag{},
+		&messengertypes.StagedMedia{},
+		&messengertypes.BacklogEntry{},
+		&messengertypes.GroupInvitationPreview{},
+		&messengertypes.ReplayCheckpoint{},
+		&messengertypes.DeviceKeyEvent{},
 	}
 }
 
@@ -124,12 +197,55 @@ func (d *DBWrapper) InitDB(replayer func(d *DBWrapper) error) error {
 		return err
 	}
 
+	return d.migrateLegacyBacklog(time.Now())
+}
+
+// Wipe deletes every row of the messenger tables, including the cached medias.
+// The schema is kept so the database can still be opened afterwards.
+func (d *DBWrapper) Wipe() error {
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		for _, model := range getDBModels() {
+			if err := tx.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// make sure the deleted rows don't linger in the freed pages
+	if isSQLite(d.db) {
+		if err := d.db.Exec("VACUUM;").Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	d.logStep("Wiped db")
 	return nil
 }
 
 func (d *DBWrapper) getUpdatedDB(models []interface{}, replayer func(db *DBWrapper) error, logger *zap.Logger) error {
-	if err := ensureSeamlessDBUpdate(d.db, models); err != nil {
-		logger.Info("couldn't update db sql schema automatically", zap.Error(err))
+	rebuild := false
+	if err := CheckDBIntegrity(d.db); errcode.Is(err, errcode.ErrDBCorrupted) {
+		// don't crash on a damaged database, the messenger state can be
+		// entirely rebuilt by replaying the protocol logs
+		logger.Error("database integrity check failed, rebuilding it from protocol logs", zap.Error(err))
+		d.logStep("Database integrity check failed, rebuilding from protocol logs", tyber.WithError(err), tyber.Status(tyber.Failed))
+		rebuild = true
+	} else if err != nil {
+		return err
+	}
+
+	if !rebuild {
+		if err := ensureSeamlessDBUpdate(d.db, models); err != nil {
+			logger.Info("couldn't update db sql schema automatically", zap.Error(err))
+			rebuild = true
+		}
+	}
+
+	if rebuild {
 
 		currentState := keepDatabaseLocalState(d.db, logger)
 
@@ -174,9 +290,23 @@ func isSQLiteError(err error, sqliteErr sqlite3.ErrNo) bool {
 	return e.Code == sqliteErr
 }
 
+// isConstraintError reports whether err is a constraint violation, the
+// Postgres errors report it with a SQLSTATE of class 23
+func isConstraintError(err error) bool {
+	if isSQLiteError(err, sqlite3.ErrConstraint) {
+		return true
+	}
+
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && strings.HasPrefix(pgErr.SQLState(), "23")
+}
+
 func (d *DBWrapper) TX(ctx context.Context, txFunc func(*DBWrapper) error) (err error) {
 	if !d.inTx {
-		tctx, _, endSection := tyber.Section(ctx, d.log, "Starting database transaction")
+		sctx, span := messengerutil.StartSpan(ctx, "messengerdb.transaction")
+		defer func() { messengerutil.EndSpan(span, err) }()
+
+		tctx, _, endSection := tyber.Section(sctx, d.log, "Starting database transaction")
 		ctx = tctx
 		defer func() {
 			if err == nil {
@@ -187,9 +317,39 @@ func (d *DBWrapper) TX(ctx context.Context, txFunc func(*DBWrapper) error) (err
 		}()
 	}
 
+	// the values cached during the transaction may have been rolled back or
+	// read by others before it was committed
+	if !d.inTx {
+		generation := d.notifCache.currentGeneration()
+		defer func() {
+			if d.notifCache.currentGeneration() != generation {
+				d.notifCache.invalidate()
+			}
+		}()
+	}
+
+	if !d.inTx {
+		d.txMutex.Lock()
+		defer d.txMutex.Unlock()
+
+		start := time.Now()
+		defer func() { d.txMetrics.observe(time.Since(start), err) }()
+	}
+
 	// Use this to propagate scope, ie. opened account
+	// the transaction is rolled back instead of committed if ctx expired
+	// while txFunc ran, the queries themselves are not bound to ctx as an
+	// interrupted sqlite connection is discarded, dropping in-memory databases
 	return d.db.Transaction(func(tx *gorm.DB) error {
-		return txFunc(&DBWrapper{ctx: ctx, db: tx, log: d.log, disableFTS: d.disableFTS, inTx: true})
+		if err := txFunc(&DBWrapper{ctx: ctx, db: tx, log: d.log, disableFTS: d.disableFTS, inTx: true, notifCache: d.notifCache, txMutex: d.txMutex, txMetrics: d.txMetrics}); err != nil {
+			return err
+		}
+
+		if err := ctx.Err(); err != nil {
+			return errcode.ErrDBWrite.Wrap(fmt.Errorf("transaction aborted: %w", err))
+		}
+
+		return nil
 	})
 }
 
@@ -219,7 +379,7 @@ func (d *DBWrapper) AddConversationForContact(groupPK, ownMemberPK, ownDevicePK,
 
 			if err := tx.db.
 				Model(&messengertypes.Conversation{}).
-				Where("(contact_public_key == ? AND public_key != ?) OR (contact_public_key != ? AND public_key == ?)", contactPK, groupPK, contactPK, groupPK).
+				Where("(contact_public_key = ? AND public_key != ?) OR (contact_public_key != ? AND public_key = ?)", contactPK, groupPK, contactPK, groupPK).
 				Count(&count).
 				Error; err != nil {
 				return err
@@ -268,7 +428,7 @@ func (d *DBWrapper) AddConversation(groupPK, ownMemberPK, ownDevicePK string) (*
 	}
 
 	if err := d.db.Create(&conversation).Error; err != nil {
-		if isSQLiteError(err, sqlite3.ErrConstraint) {
+		if isConstraintError(err) {
 			return nil, errcode.ErrDBEntryAlreadyExists.Wrap(err)
 		}
 
@@ -381,7 +541,7 @@ func (d *DBWrapper) FirstOrCreateAccount(pk, link string) error {
 			&messengertypes.Account{},
 			&messengertypes.Account{PublicKey: pk, Link: link},
 		).
-		Error; err != nil && !isSQLiteError(err, sqlite3.ErrConstraint) {
+		Error; err != nil && !isConstraintError(err) {
 		return err
 	}
 
@@ -425,6 +585,11 @@ func (d *DBWrapper) GetAccount() (*messengertypes.Account, error) {
 		return nil, errcode.ErrDBMultipleRecords
 	}
 
+	var err error
+	if accounts[0].Links, err = d.getProfileLinks(accounts[0].PublicKey, ""); err != nil {
+		return nil, err
+	}
+
 	return &accounts[0], nil
 }
 
@@ -454,6 +619,11 @@ func (d *DBWrapper) GetContactByPK(publicKey string) (*messengertypes.Contact, e
 		return nil, err
 	}
 
+	var err error
+	if contact.Links, err = d.getProfileLinks(contact.PublicKey, contact.ConversationPublicKey); err != nil {
+		return nil, err
+	}
+
 	return contact, nil
 }
 
@@ -466,6 +636,8 @@ func (d *DBWrapper) GetConversationByPK(publicKey string) (*messengertypes.Conve
 
 	if err := d.db.
 		Preload("ReplicationInfo").
+		Preload("ReadMarkers").
+		Scopes(preloadDraft).
 		First(
 			&conversation,
 			&messengertypes.Conversation{PublicKey: publicKey},
@@ -491,31 +663,57 @@ func (d *DBWrapper) GetMemberByPK(publicKey string, convPK string) (*messengerty
 		return nil, err
 	}
 
+	var err error
+	if member.Links, err = d.getProfileLinks(member.PublicKey, member.ConversationPublicKey); err != nil {
+		return nil, err
+	}
+
 	return member, nil
 }
 
 func (d *DBWrapper) GetAllConversations() ([]*messengertypes.Conversation, error) {
 	convs := []*messengertypes.Conversation(nil)
 
-	return convs, d.db.Preload("ReplicationInfo").Find(&convs).Error
+	return convs, d.db.Preload("ReplicationInfo").Preload("ReadMarkers").Scopes(preloadDraft).Find(&convs).Error
 }
 
 func (d *DBWrapper) GetAllMembers() ([]*messengertypes.Member, error) {
 	members := []*messengertypes.Member(nil)
 
-	return members, d.db.Find(&members).Error
+	if err := d.db.Find(&members).Error; err != nil {
+		return nil, err
+	}
+
+	links, err := d.getAllProfileLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, member := range members {
+		member.Links = links[profileLinksKey{member.PublicKey, member.ConversationPublicKey}]
+	}
+
+	return members, nil
 }
 
 func (d *DBWrapper) GetAllContacts() ([]*messengertypes.Contact, error) {
 	contacts := []*messengertypes.Contact(nil)
 
-	return contacts, d.db.Find(&contacts).Error
+	if err := d.db.Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	return contacts, d.fillContactsProfileLinks(contacts)
 }
 
 func (d *DBWrapper) GetContactsByState(state messengertypes.Contact_State) ([]*messengertypes.Contact, error) {
 	contacts := []*messengertypes.Contact(nil)
 
-	return contacts, d.db.Where(&messengertypes.Contact{State: state}).Find(&contacts).Error
+	if err := d.db.Where(&messengertypes.Contact{State: state}).Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+
+	return contacts, d.fillContactsProfileLinks(contacts)
 }
 
 func (d *DBWrapper) GetAllInteractions() ([]*messengertypes.Interaction, error) {
@@ -533,6 +731,10 @@ func (d *DBWrapper) GetPaginatedInteractions(opts *messengertypes.PaginatedInter
 		opts.Amount = 5
 	}
 
+	if opts.SentAfter != 0 && opts.SentBefore != 0 && opts.SentAfter >= opts.SentBefore {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the date range is empty"))
+	}
+
 	var conversationPks, cids []string
 	interactions := []*messengertypes.Interaction(nil)
 	previousInteraction := (*messengertypes.Interaction)(nil)
@@ -570,12 +772,28 @@ func (d *DBWrapper) GetPaginatedInteractions(opts *messengertypes.PaginatedInter
 
 		if previousInteraction != nil {
 			if opts.OldestToNewest {
-				query = query.Where("sent_date > ? OR (sent_date == ? AND cid > ?)", previousInteraction.SentDate, previousInteraction.SentDate, previousInteraction.CID)
+				query = query.Where("sent_date > ? OR (sent_date = ? AND cid > ?)", previousInteraction.SentDate, previousInteraction.SentDate, previousInteraction.CID)
 			} else {
-				query = query.Where("sent_date < ? OR (sent_date == ? AND cid < ?)", previousInteraction.SentDate, previousInteraction.SentDate, previousInteraction.CID)
+				query = query.Where("sent_date < ? OR (sent_date = ? AND cid < ?)", previousInteraction.SentDate, previousInteraction.SentDate, previousInteraction.CID)
 			}
 		}
 
+		if len(opts.Types) > 0 {
+			query = query.Where("type IN ?", opts.Types)
+		}
+
+		if opts.MemberPublicKey != "" {
+			query = query.Where("member_public_key = ?", opts.MemberPublicKey)
+		}
+
+		if opts.SentAfter != 0 {
+			query = query.Where("sent_date > ?", opts.SentAfter)
+		}
+
+		if opts.SentBefore != 0 {
+			query = query.Where("sent_date < ?", opts.SentBefore)
+		}
+
 		query = query.Limit(int(opts.Amount))
 
 		if err := query.
@@ -600,6 +818,26 @@ func (d *DBWrapper) GetPaginatedInteractions(opts *messengertypes.PaginatedInter
 		return nil, errcode.ErrDBRead.Wrap(fmt.Errorf("unable to fetch interactions: %w", err))
 	}
 
+	if err := d.fillReadBy(interactions...); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillDeliveryCounts(interactions...); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillPollResults(interactions...); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillLinkPreviews(interactions...); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillCalendarEventAttendance(interactions...); err != nil {
+		return nil, err
+	}
+
 	return interactions, nil
 }
 
@@ -612,16 +850,33 @@ func (d *DBWrapper) GetInteractionByCID(cid string) (*messengertypes.Interaction
 	return interaction, d.db.Preload(clause.Associations).First(&interaction, &messengertypes.Interaction{CID: cid}).Error
 }
 
+// IsInteractionSynced returns true if the interaction cid was stored from its
+// protocol event, the interactions only received through a push are not
+func (d *DBWrapper) IsInteractionSynced(cid string) (bool, error) {
+	if cid == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	count := int64(0)
+	if err := d.db.Model(&messengertypes.Interaction{}).Where("cid = ? AND out_of_store_message = ?", cid, false).Count(&count).Error; err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return count > 0, nil
+}
+
 func (d *DBWrapper) AddContactRequestOutgoingEnqueued(contactPK, displayName, convPK string) (*messengertypes.Contact, error) {
 	if contactPK == "" {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
 	}
 
 	ec, err := d.GetContactByPK(contactPK)
-	if err == nil {
+	if err == nil && ec.State != messengertypes.Contact_Removed {
 		return ec, errcode.ErrDBEntryAlreadyExists
 	} else if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, err
+	} else if err == nil {
+		return d.renewRemovedContact(contactPK, displayName, convPK, messengertypes.Contact_OutgoingRequestEnqueued)
 	}
 
 	contact := &messengertypes.Contact{
@@ -677,10 +932,12 @@ func (d *DBWrapper) AddContactRequestIncomingReceived(contactPK, displayName, gr
 	}
 
 	ec, err := d.GetContactByPK(contactPK)
-	if err == nil {
+	if err == nil && ec.State != messengertypes.Contact_Removed {
 		return ec, errcode.ErrDBEntryAlreadyExists
 	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, err
+	} else if err == nil {
+		return d.renewRemovedContact(contactPK, displayName, groupPk, messengertypes.Contact_IncomingRequest)
 	}
 
 	toCreate := &messengertypes.Contact{
@@ -833,6 +1090,99 @@ func (d *DBWrapper) GetDBInfo() (*messengertypes.SystemInfo_DB, error) {
 	infos.SharedPushTokens, err = d.dbModelRowsCount(messengertypes.SharedPushToken{})
 	errs = multierr.Append(errs, err)
 
+	infos.OutboxEvents, err = d.dbModelRowsCount(messengertypes.OutboxEvent{})
+	errs = multierr.Append(errs, err)
+
+	infos.Medias, err = d.dbModelRowsCount(messengertypes.Media{})
+	errs = multierr.Append(errs, err)
+
+	infos.ProfileLinks, err = d.dbModelRowsCount(messengertypes.ProfileLink{})
+	errs = multierr.Append(errs, err)
+
+	infos.DirectoryServiceRecords, err = d.dbModelRowsCount(messengertypes.DirectoryServiceRecord{})
+	errs = multierr.Append(errs, err)
+
+	infos.Calls, err = d.dbModelRowsCount(messengertypes.Call{})
+	errs = multierr.Append(errs, err)
+
+	infos.BroadcastLists, err = d.dbModelRowsCount(messengertypes.BroadcastList{})
+	errs = multierr.Append(errs, err)
+
+	infos.Broadcasts, err = d.dbModelRowsCount(messengertypes.Broadcast{})
+	errs = multierr.Append(errs, err)
+
+	infos.InteractionTranslations, err = d.dbModelRowsCount(messengertypes.InteractionTranslation{})
+	errs = multierr.Append(errs, err)
+
+	infos.QuoteSnapshots, err = d.dbModelRowsCount(messengertypes.QuoteSnapshot{})
+	errs = multierr.Append(errs, err)
+
+	infos.DeliveryReceipts, err = d.dbModelRowsCount(messengertypes.DeliveryReceipt{})
+	errs = multierr.Append(errs, err)
+
+	infos.QueuedMessages, err = d.dbModelRowsCount(messengertypes.QueuedMessage{})
+	errs = multierr.Append(errs, err)
+
+	infos.Bookmarks, err = d.dbModelRowsCount(messengertypes.Bookmark{})
+	errs = multierr.Append(errs, err)
+
+	infos.InteractionEdits, err = d.dbModelRowsCount(messengertypes.InteractionEdit{})
+	errs = multierr.Append(errs, err)
+
+	infos.ReadMarkers, err = d.dbModelRowsCount(messengertypes.ReadMarker{})
+	errs = multierr.Append(errs, err)
+
+	infos.PinnedMessages, err = d.dbModelRowsCount(messengertypes.PinnedMessage{})
+	errs = multierr.Append(errs, err)
+
+	infos.ConversationSessions, err = d.dbModelRowsCount(messengertypes.ConversationSession{})
+	errs = multierr.Append(errs, err)
+
+	infos.PollVotes, err = d.dbModelRowsCount(messengertypes.PollVote{})
+	errs = multierr.Append(errs, err)
+
+	infos.MemberLocations, err = d.dbModelRowsCount(messengertypes.MemberLocation{})
+	errs = multierr.Append(errs, err)
+
+	infos.ForwardedMessages, err = d.dbModelRowsCount(messengertypes.ForwardedFrom{})
+	errs = multierr.Append(errs, err)
+
+	infos.MissingInteractions, err = d.dbModelRowsCount(messengertypes.MissingInteraction{})
+	errs = multierr.Append(errs, err)
+
+	infos.Mentions, err = d.dbModelRowsCount(messengertypes.InteractionMention{})
+	errs = multierr.Append(errs, err)
+
+	infos.LinkPreviews, err = d.dbModelRowsCount(messengertypes.LinkPreview{})
+	errs = multierr.Append(errs, err)
+
+	infos.CalendarEventRSVPs, err = d.dbModelRowsCount(messengertypes.CalendarEventRSVP{})
+	errs = multierr.Append(errs, err)
+
+	infos.ConversationDrafts, err = d.dbModelRowsCount(messengertypes.ConversationDraft{})
+	errs = multierr.Append(errs, err)
+
+	infos.ConversationDraftMediaRefs, err = d.dbModelRowsCount(messengertypes.ConversationDraftMediaRef{})
+	errs = multierr.Append(errs, err)
+
+	infos.FeatureFlags, err = d.dbModelRowsCount(messengertypes.FeatureFlag{})
+	errs = multierr.Append(errs, err)
+
+	infos.StagedMedias, err = d.dbModelRowsCount(messengertypes.StagedMedia{})
+	errs = multierr.Append(errs, err)
+
+	infos.BacklogEntries, err = d.dbModelRowsCount(messengertypes.BacklogEntry{})
+	errs = multierr.Append(errs, err)
+
+	infos.GroupInvitationPreviews, err = d.dbModelRowsCount(messengertypes.GroupInvitationPreview{})
+	errs = multierr.Append(errs, err)
+
+	infos.ReplayCheckpoints, err = d.dbModelRowsCount(messengertypes.ReplayCheckpoint{})
+	errs = multierr.Append(errs, err)
+
+	infos.DeviceKeyEvents, err = d.dbModelRowsCount(messengertypes.DeviceKeyEvent{})
+	errs = multierr.Append(errs, err)
+
 	return infos, errs
 }
 
@@ -852,7 +1202,7 @@ func (d *DBWrapper) AddDevice(devicePK string, memberPK string) (*messengertypes
 
 			if err := tx.db.
 				Model(&messengertypes.Device{}).
-				Where("member_public_key != ? AND public_key == ?", memberPK, devicePK).
+				Where("member_public_key != ? AND public_key = ?", memberPK, devicePK).
 				Count(&count).
 				Error; err != nil {
 				return err
@@ -868,6 +1218,7 @@ func (d *DBWrapper) AddDevice(devicePK string, memberPK string) (*messengertypes
 			Create(&messengertypes.Device{
 				PublicKey:       devicePK,
 				MemberPublicKey: memberPK,
+				FirstSeenDate:   messengerutil.TimestampMs(time.Now()),
 			}).
 			Error
 	}); err != nil {
@@ -883,6 +1234,65 @@ func (d *DBWrapper) AddDevice(devicePK string, memberPK string) (*messengertypes
 	return finalDevice, nil
 }
 
+func (d *DBWrapper) SetDeviceSupportsCompactPayload(devicePK string, supported bool) error {
+	if devicePK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a device public key is required"))
+	}
+
+	if err := d.db.
+		Model(&messengertypes.Device{}).
+		Where(&messengertypes.Device{PublicKey: devicePK}).
+		Update("supports_compact_payload", supported).
+		Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// ConversationSupportsCompactPayload returns true if every known device of the
+// conversation announced AppMessage_CapabilityCompactPayload, the members whose
+// devices are not known yet, like the ones who just joined, haven't announced
+// it so they make it unsupported
+func (d *DBWrapper) ConversationSupportsCompactPayload(conversationPK string) (bool, error) {
+	if conversationPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	members := d.db.
+		Model(&messengertypes.Member{}).
+		Select("public_key").
+		Where(&messengertypes.Member{ConversationPublicKey: conversationPK})
+
+	total, unsupported, unannounced := int64(0), int64(0), int64(0)
+	if err := d.db.
+		Model(&messengertypes.Device{}).
+		Where("member_public_key IN (?)", members).
+		Count(&total).
+		Error; err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := d.db.
+		Model(&messengertypes.Device{}).
+		Where("member_public_key IN (?) AND supports_compact_payload = ?", members, false).
+		Count(&unsupported).
+		Error; err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := d.db.
+		Model(&messengertypes.Member{}).
+		Where(&messengertypes.Member{ConversationPublicKey: conversationPK}).
+		Where("public_key NOT IN (?)", d.db.Model(&messengertypes.Device{}).Select("member_public_key")).
+		Count(&unannounced).
+		Error; err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return total > 0 && unsupported == 0 && unannounced == 0, nil
+}
+
 func (d *DBWrapper) UpdateContact(pk string, contact messengertypes.Contact) error {
 	if pk == "" {
 		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no public key specified"))
@@ -911,6 +1321,14 @@ func (d *DBWrapper) AddInteraction(rawInte messengertypes.Interaction) (*messeng
 		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
 	}
 
+	if err := d.setInteractionExpiration(&rawInte); err != nil {
+		return nil, false, err
+	}
+
+	if err := d.setInteractionSlowModeViolation(&rawInte); err != nil {
+		return nil, false, err
+	}
+
 	existing, err := d.GetInteractionByCID(rawInte.CID)
 	isNew := false
 	if err == gorm.ErrRecordNotFound {
@@ -918,6 +1336,10 @@ func (d *DBWrapper) AddInteraction(rawInte messengertypes.Interaction) (*messeng
 			return nil, true, err
 		}
 		isNew = true
+
+		if err := d.deleteMissingInteraction(rawInte.CID); err != nil {
+			return nil, true, err
+		}
 	} else if err != nil {
 		d.log.Error("error while creating interaction: ", zap.Error(err), logutil.PrivateString("cid", rawInte.CID))
 		return nil, false, err
@@ -933,7 +1355,11 @@ func (d *DBWrapper) AddInteraction(rawInte messengertypes.Interaction) (*messeng
 			// push received after protocol sync, ignore interaction, return the existing one
 			return existing, false, nil
 		} else if existing.OutOfStoreMessage && !rawInte.OutOfStoreMessage {
-			// replace out-of-store interaction with synced one
+			// replace out-of-store interaction with synced one, the push was received first
+			if existing.GetReceivedDate() != 0 {
+				rawInte.ReceivedDate = existing.GetReceivedDate()
+			}
+
 			if err := d.db.Model(&messengertypes.Interaction{}).Delete(&messengertypes.Interaction{CID: rawInte.CID}).Error; err != nil {
 				return nil, false, errcode.ErrDBWrite.Wrap(err)
 			}
@@ -954,61 +1380,6 @@ func (d *DBWrapper) AddInteraction(rawInte messengertypes.Interaction) (*messeng
 	return i, isNew, nil
 }
 
-func (d *DBWrapper) AttributeBacklogInteractions(devicePK, groupPK, memberPK string) ([]*messengertypes.Interaction, error) {
-	if devicePK == "" {
-		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing device public key"))
-	}
-
-	if groupPK == "" {
-		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing conversation public key"))
-	}
-
-	if memberPK == "" {
-		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing member public key"))
-	}
-
-	var (
-		backlog []*messengertypes.Interaction
-		cids    []string
-	)
-
-	attributed := []string(nil)
-	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
-		res := tx.db.
-			Model(&messengertypes.Interaction{}).
-			Where("device_public_key = ? AND conversation_public_key = ? AND member_public_key = \"\"", devicePK, groupPK).
-			Order("sent_date asc")
-
-		if err := res.
-			Pluck("cid", &cids).
-			Error; err != nil {
-			return err
-		}
-
-		if len(cids) == 0 {
-			return nil
-		}
-		attributed = cids
-
-		if err := res.Update("member_public_key", memberPK).Error; err != nil {
-			return err
-		}
-
-		if err := tx.db.Preload(clause.Associations).Order("ROWID asc").Find(&backlog, cids).Error; err != nil {
-			return err
-		}
-
-		return nil
-	}); err != nil {
-		return nil, err
-	}
-
-	if len(attributed) > 0 {
-		d.logStep(fmt.Sprintf("Attributed %d interactions to member in db", len(attributed)), tyber.WithDetail("MemberPublicKey", memberPK), tyber.WithDetail("DevicePublicKey", devicePK), tyber.WithDetail("GroupPublicKey", groupPK), tyber.WithJSONDetail("AttributedCIDs", cids))
-	}
-	return backlog, nil
-}
-
 func (d *DBWrapper) AddMember(memberPK, groupPK, displayName, avatarCID string, isMe bool, isCreator bool) (*messengertypes.Member, error) {
 	if memberPK == "" {
 		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("member public key cannot be empty"))
@@ -1024,6 +1395,7 @@ func (d *DBWrapper) AddMember(memberPK, groupPK, displayName, avatarCID string,
 		IsCreator:             isCreator,
 		IsMe:                  isMe,
 		DisplayName:           displayName,
+		AvatarCID:             avatarCID,
 	}
 
 	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
@@ -1063,6 +1435,7 @@ func (d *DBWrapper) UpsertMember(memberPK, groupPK string, m messengertypes.Memb
 	}
 
 	if isNew {
+		m.PublicKey, m.ConversationPublicKey = memberPK, groupPK
 		err := d.db.Create(&m).Error
 		if err != nil {
 			return nil, isNew, errcode.ErrDBWrite.Wrap(err)
@@ -1102,9 +1475,12 @@ func (d *DBWrapper) SetConversationIsOpenStatus(conversationPK string, status bo
 		return conversation, false, nil
 	}
 
+	// everything received while the conversation was open has been read
 	conversation.IsOpen = status
+	conversation.LastReadDate = messengerutil.TimestampMs(time.Now())
 	values := map[string]interface{}{
-		"is_open": status,
+		"is_open":        status,
+		"last_read_date": conversation.LastReadDate,
 	}
 
 	if status {
@@ -1128,6 +1504,9 @@ func (d *DBWrapper) SetConversationIsOpenStatus(conversationPK string, status bo
 	return conversation, true, err
 }
 
+// IsConversationOpened returns whether a conversation is open, a conversation
+// whose sessions all expired is considered closed even before they are
+// removed
 func (d *DBWrapper) IsConversationOpened(conversationPK string) (bool, error) {
 	if conversationPK == "" {
 		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
@@ -1139,8 +1518,20 @@ func (d *DBWrapper) IsConversationOpened(conversationPK string) (bool, error) {
 		Model(&messengertypes.Conversation{}).
 		Where(&messengertypes.Conversation{PublicKey: conversationPK, IsOpen: true}).
 		Count(&ret).Error
+	if err != nil || ret != 1 {
+		return false, err
+	}
+
+	// the conversations opened before the sessions were tracked have none
+	sessions, live := int64(0), int64(0)
+	if err := d.db.Model(&messengertypes.ConversationSession{}).Where("conversation_public_key = ?", conversationPK).Count(&sessions).Error; err != nil {
+		return false, err
+	}
+	if err := liveSessions(d.db, time.Now()).Where("conversation_public_key = ?", conversationPK).Count(&live).Error; err != nil {
+		return false, err
+	}
 
-	return ret == 1, err
+	return sessions == 0 || live > 0, nil
 }
 
 type dbLogWrapper struct {
@@ -1313,7 +1704,7 @@ func (d *DBWrapper) InteractionsSearch(query string, options *SearchOptions) ([]
 
 	if options.AfterDate != 0 {
 		if options.RefCID != "" {
-			dbQuery = dbQuery.Where("interactions.sent_date > ? OR (interactions.sent_date == ? AND interactions.cid > ?)", options.AfterDate, options.AfterDate, options.RefCID)
+			dbQuery = dbQuery.Where("interactions.sent_date > ? OR (interactions.sent_date = ? AND interactions.cid > ?)", options.AfterDate, options.AfterDate, options.RefCID)
 		} else {
 			dbQuery = dbQuery.Where("interactions.sent_date > ?", options.AfterDate)
 		}
@@ -1321,7 +1712,7 @@ func (d *DBWrapper) InteractionsSearch(query string, options *SearchOptions) ([]
 
 	if options.BeforeDate != 0 {
 		if options.RefCID != "" {
-			dbQuery = dbQuery.Where("interactions.sent_date < ? OR (interactions.sent_date == ? AND interactions.cid < ?)", options.BeforeDate, options.BeforeDate, options.RefCID)
+			dbQuery = dbQuery.Where("interactions.sent_date < ? OR (interactions.sent_date = ? AND interactions.cid < ?)", options.BeforeDate, options.BeforeDate, options.RefCID)
 		} else {
 			dbQuery = dbQuery.Where("interactions.sent_date < ?", options.BeforeDate)
 		}
@@ -1373,9 +1764,51 @@ func (d *DBWrapper) GetAugmentedInteraction(cid string) (*messengertypes.Interac
 		return nil, errcode.ErrDBRead.Wrap(err)
 	}
 
+	if err := d.fillReadBy(inte); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillDeliveryCounts(inte); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillPollResults(inte); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillLinkPreviews(inte); err != nil {
+		return nil, err
+	}
+
+	if err := d.fillCalendarEventAttendance(inte); err != nil {
+		return nil, err
+	}
+
 	return inte, nil
 }
 
+// GetPreviousInteractionCID returns the cid of the interaction preceding i in
+// its conversation, ordered by sent date then cid, or an empty string if i is
+// the first one
+func (d *DBWrapper) GetPreviousInteractionCID(i *messengertypes.Interaction) (string, error) {
+	cids := []string(nil)
+	if err := d.db.
+		Model(&messengertypes.Interaction{}).
+		Where("conversation_public_key = ? AND (sent_date < ? OR (sent_date = ? AND cid < ?))", i.GetConversationPublicKey(), i.GetSentDate(), i.GetSentDate(), i.GetCID()).
+		Order("sent_date DESC, cid DESC").
+		Limit(1).
+		Pluck("cid", &cids).
+		Error; err != nil {
+		return "", errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(cids) == 0 {
+		return "", nil
+	}
+
+	return cids[0], nil
+}
+
 func (d *DBWrapper) wasMetadataEventHandled(id ipfscid.Cid) (bool, error) {
 	c := int64(0)
 
@@ -1553,6 +1986,29 @@ func (d *DBWrapper) MuteConversation(pk string, until int64) error {
 	return d.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: pk}).Update("muted_until", until).Error
 }
 
+// SetConversationFocus sets the date in ms until which a conversation is in
+// focus mode, 0 ends it. It returns the updated conversation.
+func (d *DBWrapper) SetConversationFocus(pk string, until int64) (*messengertypes.Conversation, error) {
+	if pk == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	res := d.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: pk}).Update("focused_until", until)
+	if res.Error != nil {
+		return nil, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation"))
+	}
+
+	conv, err := d.GetConversationByPK(pk)
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return conv, nil
+}
+
 func (d *DBWrapper) UpdateAccountFields(fields map[string]interface{}) error {
 	return d.db.Model(&messengertypes.Account{}).Where("1 = 1").Updates(fields).Error
 }
@@ -1576,3 +2032,43 @@ func (d *DBWrapper) GetMuteStatusForConversation(key string) (accountMuted bool,
 
 	return accountMuted, conversationMuted, nil
 }
+
+// AddOutboxEvent records a stream event in the outbox, traceParent is the
+// trace context of the handling which emitted it and can be empty
+func (d *DBWrapper) AddOutboxEvent(typ messengertypes.StreamEvent_Type, payload []byte, isNew bool, traceParent string) (*messengertypes.OutboxEvent, error) {
+	event := &messengertypes.OutboxEvent{
+		Type:        typ,
+		Payload:     payload,
+		IsNew:       isNew,
+		TraceParent: traceParent,
+	}
+
+	if err := d.db.Create(event).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return event, nil
+}
+
+// GetOutboxEvents returns the oldest pending outbox events, in insertion order
+func (d *DBWrapper) GetOutboxEvents(limit int) ([]*messengertypes.OutboxEvent, error) {
+	var events []*messengertypes.OutboxEvent
+
+	if err := d.db.Model(&messengertypes.OutboxEvent{}).Order("id ASC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return events, nil
+}
+
+func (d *DBWrapper) DeleteOutboxEvents(ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := d.db.Delete(&messengertypes.OutboxEvent{}, ids).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
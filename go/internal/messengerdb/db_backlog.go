@@ -0,0 +1,227 @@
+package messengerdb
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+const (
+	// BacklogMaxEntriesPerDevice is the number of interactions kept for a
+	// device which isn't known yet in a conversation, the oldest ones are
+	// dropped first
+	BacklogMaxEntriesPerDevice = 500
+
+	// BacklogTTL is how long an interaction waits for its device to be added
+	// to the group before being dropped
+	BacklogTTL = 30 * 24 * time.Hour
+)
+
+// BacklogManager keeps track of the interactions received from devices which
+// aren't known yet, their member is unknown until the device is added to the
+// group
+type BacklogManager struct {
+	db                  *DBWrapper
+	maxEntriesPerDevice int
+	ttl                 time.Duration
+}
+
+// Backlog returns the backlog manager using d, it can be a transaction
+func (d *DBWrapper) Backlog() *BacklogManager {
+	return &BacklogManager{db: d, maxEntriesPerDevice: BacklogMaxEntriesPerDevice, ttl: BacklogTTL}
+}
+
+// Add records an interaction stored without member in the backlog of its
+// device, nothing is done if it is attributed already. When the backlog of the
+// device is full the oldest interactions are removed, they are returned.
+func (m *BacklogManager) Add(i *messengertypes.Interaction, now time.Time) ([]*messengertypes.Interaction, error) {
+	if i.GetCID() == "" || i.GetConversationPublicKey() == "" || i.GetDevicePublicKey() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a cid, a conversation and a device public key are required"))
+	}
+
+	var evicted []*messengertypes.Interaction
+	if err := m.db.TX(m.db.ctx, func(tx *DBWrapper) error {
+		count := int64(0)
+		if err := tx.db.
+			Model(&messengertypes.Interaction{}).
+			Where("cid = ? AND member_public_key = \"\"", i.GetCID()).
+			Count(&count).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if count == 0 {
+			return nil
+		}
+
+		entry := &messengertypes.BacklogEntry{
+			InteractionCID:        i.GetCID(),
+			ConversationPublicKey: i.GetConversationPublicKey(),
+			DevicePublicKey:       i.GetDevicePublicKey(),
+			AddedDate:             messengerutil.TimestampMs(now),
+			ExpiryDate:            messengerutil.TimestampMs(now.Add(m.ttl)),
+		}
+		if err := tx.db.Clauses(clause.OnConflict{DoNothing: true}).Create(entry).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		deviceEntries := func() *gorm.DB {
+			return tx.db.
+				Model(&messengertypes.BacklogEntry{}).
+				Where("conversation_public_key = ? AND device_public_key = ?", i.GetConversationPublicKey(), i.GetDevicePublicKey())
+		}
+
+		if err := deviceEntries().Count(&count).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if count <= int64(m.maxEntriesPerDevice) {
+			return nil
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.Interaction{}).
+			Select("cid", "conversation_public_key").
+			Where("cid IN (?)", deviceEntries().Select("interaction_cid").Order("added_date ASC, interaction_cid ASC").Limit(int(count)-m.maxEntriesPerDevice)).
+			Find(&evicted).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return tx.deleteInteractions(evicted)
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(evicted) > 0 {
+		m.db.logStep(fmt.Sprintf("Dropped %d interactions from full backlog", len(evicted)), tyber.WithDetail("DevicePublicKey", i.GetDevicePublicKey()), tyber.WithDetail("ConversationPublicKey", i.GetConversationPublicKey()))
+	}
+
+	return evicted, nil
+}
+
+// Attribute sets the member of the interactions backlogged for a device which
+// was added to a group, they are removed from the backlog and returned in
+// insertion order
+func (m *BacklogManager) Attribute(devicePK, groupPK, memberPK string) ([]*messengertypes.Interaction, error) {
+	if devicePK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing device public key"))
+	}
+
+	if groupPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing conversation public key"))
+	}
+
+	if memberPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("missing member public key"))
+	}
+
+	var (
+		backlog []*messengertypes.Interaction
+		cids    []string
+	)
+
+	if err := m.db.TX(m.db.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.
+			Model(&messengertypes.BacklogEntry{}).
+			Where("conversation_public_key = ? AND device_public_key = ?", groupPK, devicePK).
+			Pluck("interaction_cid", &cids).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(cids) == 0 {
+			return nil
+		}
+
+		if err := tx.db.Where("interaction_cid IN ?", cids).Delete(&messengertypes.BacklogEntry{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.Interaction{}).
+			Where("cid IN ?", cids).
+			Update("member_public_key", memberPK).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Preload(clause.Associations).Order(insertionOrder(tx.db, "sent_date, cid")).Find(&backlog, cids).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(backlog) > 0 {
+		m.db.logStep(fmt.Sprintf("Attributed %d interactions to member in db", len(backlog)), tyber.WithDetail("MemberPublicKey", memberPK), tyber.WithDetail("DevicePublicKey", devicePK), tyber.WithDetail("GroupPublicKey", groupPK), tyber.WithJSONDetail("AttributedCIDs", cids))
+	}
+
+	return backlog, nil
+}
+
+// Prune removes the interactions which expired in the backlog, only their CID
+// and conversation are set
+func (m *BacklogManager) Prune(now time.Time) ([]*messengertypes.Interaction, error) {
+	var pruned []*messengertypes.Interaction
+	if err := m.db.TX(m.db.ctx, func(tx *DBWrapper) error {
+		expired := tx.db.Model(&messengertypes.BacklogEntry{}).Select("interaction_cid").Where("expiry_date < ?", messengerutil.TimestampMs(now))
+
+		if err := tx.db.
+			Model(&messengertypes.Interaction{}).
+			Select("cid", "conversation_public_key").
+			Where("cid IN (?)", expired).
+			Find(&pruned).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		// the entries of the interactions removed meanwhile are dropped too
+		if err := tx.db.Where("expiry_date < ?", messengerutil.TimestampMs(now)).Delete(&messengertypes.BacklogEntry{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if len(pruned) == 0 {
+			return nil
+		}
+
+		return tx.deleteInteractions(pruned)
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(pruned) > 0 {
+		m.db.logStep(fmt.Sprintf("Pruned %d expired interactions from backlog", len(pruned)))
+	}
+
+	return pruned, nil
+}
+
+// migrateLegacyBacklog records in the backlog the interactions stored without
+// member by the versions which had no backlog table
+func (d *DBWrapper) migrateLegacyBacklog(now time.Time) error {
+	res := d.db.Exec(
+		"INSERT INTO backlog_entries (interaction_cid, conversation_public_key, device_public_key, added_date, expiry_date) "+
+			"SELECT cid, conversation_public_key, device_public_key, ?, ? FROM interactions "+
+			"WHERE member_public_key = '' AND device_public_key != '' AND cid NOT IN (SELECT interaction_cid FROM backlog_entries)",
+		messengerutil.TimestampMs(now), messengerutil.TimestampMs(now.Add(BacklogTTL)),
+	)
+	if res.Error != nil {
+		return errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	if res.RowsAffected > 0 {
+		d.logStep("Migrated legacy backlog", tyber.WithDetail("Entries", fmt.Sprintf("%d", res.RowsAffected)))
+	}
+
+	return nil
+}
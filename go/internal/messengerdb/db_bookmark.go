@@ -0,0 +1,112 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetBookmark adds, updates or removes a bookmark unless a more recent update
+// is already known. It returns whether the bookmark state changed.
+func (d *DBWrapper) SetBookmark(b messengertypes.Bookmark) (bool, error) {
+	if b.GetInteractionCID() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing := &messengertypes.Bookmark{}
+		err := tx.db.First(existing, &messengertypes.Bookmark{InteractionCID: b.GetInteractionCID()}).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// a removal of an unknown bookmark is kept too, it can be older than the bookmark
+			changed = !b.GetRemoved()
+
+		case err != nil:
+			return errcode.ErrDBRead.Wrap(err)
+
+		case existing.GetUpdatedDate() > b.GetUpdatedDate():
+			return nil
+
+		default:
+			changed = existing.GetRemoved() != b.GetRemoved()
+			if b.GetConversationPublicKey() == "" {
+				b.ConversationPublicKey = existing.GetConversationPublicKey()
+			}
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&b).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if changed {
+		d.logStep("Updated bookmark in db", tyber.WithDetail("CID", b.GetInteractionCID()), tyber.WithDetail("Removed", fmt.Sprintf("%t", b.GetRemoved())))
+	}
+
+	return changed, nil
+}
+
+// GetBookmarks returns the bookmarks of a conversation, or of every
+// conversation if convPK is empty, the latest first. The bookmarked
+// interactions known by this device are returned in the same order.
+func (d *DBWrapper) GetBookmarks(convPK string) ([]*messengertypes.Bookmark, []*messengertypes.Interaction, error) {
+	query := d.db.Where("removed = ?", false)
+	if convPK != "" {
+		query = query.Where("conversation_public_key = ?", convPK)
+	}
+
+	bookmarks := []*messengertypes.Bookmark(nil)
+	if err := query.Order("updated_date DESC, interaction_cid").Find(&bookmarks).Error; err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(bookmarks) == 0 {
+		return nil, nil, nil
+	}
+
+	cids := make([]string, len(bookmarks))
+	for i, b := range bookmarks {
+		cids[i] = b.GetInteractionCID()
+	}
+
+	interactions, err := d.getInteractionsInOrder(cids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bookmarks, interactions, nil
+}
+
+// getInteractionsInOrder returns the interactions known by this device among
+// cids, in the order of cids
+func (d *DBWrapper) getInteractionsInOrder(cids []string) ([]*messengertypes.Interaction, error) {
+	found := []*messengertypes.Interaction(nil)
+	if err := d.db.Preload(clause.Associations).Where("cid IN ?", cids).Find(&found).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	byCID := make(map[string]*messengertypes.Interaction, len(found))
+	for _, inte := range found {
+		byCID[inte.GetCID()] = inte
+	}
+
+	interactions := make([]*messengertypes.Interaction, 0, len(found))
+	for _, cid := range cids {
+		if inte, ok := byCID[cid]; ok {
+			interactions = append(interactions, inte)
+		}
+	}
+
+	return interactions, nil
+}
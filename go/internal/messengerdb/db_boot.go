@@ -0,0 +1,78 @@
+package messengerdb
+
+import (
+	"errors"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetBootSnapshot returns the account, the conversationAmount latest updated
+// conversations with their last interaction, the unread counters and the
+// incoming contact requests
+func (d *DBWrapper) GetBootSnapshot(conversationAmount int32) (*messengertypes.GetBootSnapshot_Reply, error) {
+	if conversationAmount <= 0 {
+		conversationAmount = 20
+	}
+
+	snapshot := &messengertypes.GetBootSnapshot_Reply{}
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		var err error
+		if snapshot.Account, err = tx.GetAccount(); err != nil && !errors.Is(err, errcode.ErrNotFound) {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if err := tx.db.
+			Preload("ReplicationInfo").
+			Preload("ReadMarkers").
+			Scopes(preloadDraft).
+			Order("last_update DESC").
+			Limit(int(conversationAmount)).
+			Find(&snapshot.Conversations).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(snapshot.Conversations) > 0 {
+			pks := make([]string, len(snapshot.Conversations))
+			for i, conv := range snapshot.Conversations {
+				pks[i] = conv.GetPublicKey()
+			}
+
+			if err := tx.db.
+				Preload(clause.Associations).
+				Where("conversation_public_key IN ? AND cid = (SELECT latest.cid FROM interactions AS latest WHERE latest.conversation_public_key = interactions.conversation_public_key ORDER BY latest.sent_date DESC, latest.cid DESC LIMIT 1)", pks).
+				Order("sent_date DESC").
+				Find(&snapshot.LastInteractions).
+				Error; err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+		}
+
+		// the unread counts are kept up to date on each interaction, see RecomputeUnreadCounts
+		unread := struct {
+			UnreadConversations int64
+			UnreadCount         int64
+		}{}
+		if err := tx.db.
+			Model(&messengertypes.Conversation{}).
+			Select("COUNT(CASE WHEN unread_count > 0 THEN 1 END) AS unread_conversations, COALESCE(SUM(unread_count), 0) AS unread_count").
+			Scan(&unread).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+		snapshot.UnreadConversations, snapshot.UnreadCount = unread.UnreadConversations, unread.UnreadCount
+
+		if snapshot.ContactRequests, err = tx.GetContactsByState(messengertypes.Contact_IncomingRequest); err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return snapshot, nil
+}
@@ -0,0 +1,140 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SaveBroadcastList creates or replaces a broadcast list and its recipients
+func (d *DBWrapper) SaveBroadcastList(list *messengertypes.BroadcastList) (*messengertypes.BroadcastList, error) {
+	if list.GetID() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a broadcast list id is required"))
+	}
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.Delete(&messengertypes.BroadcastListRecipient{}, &messengertypes.BroadcastListRecipient{ListID: list.GetID()}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(list).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Saved broadcast list in db", tyber.WithDetail("ID", list.GetID()), tyber.WithDetail("Recipients", fmt.Sprintf("%d", len(list.GetRecipients()))))
+	return d.GetBroadcastList(list.GetID())
+}
+
+func (d *DBWrapper) GetBroadcastList(id string) (*messengertypes.BroadcastList, error) {
+	if id == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a broadcast list id is required"))
+	}
+
+	list := &messengertypes.BroadcastList{}
+	if err := d.db.Preload(clause.Associations).First(list, &messengertypes.BroadcastList{ID: id}).Error; err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (d *DBWrapper) GetAllBroadcastLists() ([]*messengertypes.BroadcastList, error) {
+	lists := []*messengertypes.BroadcastList(nil)
+	if err := d.db.Preload(clause.Associations).Order("created_date ASC").Find(&lists).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return lists, nil
+}
+
+// DeleteBroadcastList deletes a broadcast list and its recipients, the
+// broadcasts sent to it are kept
+func (d *DBWrapper) DeleteBroadcastList(id string) error {
+	if id == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a broadcast list id is required"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		res := tx.db.Delete(&messengertypes.BroadcastList{}, &messengertypes.BroadcastList{ID: id})
+		if res.Error != nil {
+			return errcode.ErrDBWrite.Wrap(res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if err := tx.db.Delete(&messengertypes.BroadcastListRecipient{}, &messengertypes.BroadcastListRecipient{ListID: id}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	})
+}
+
+// AddBroadcast persists a broadcast along with the delivery state of each of
+// its recipients
+func (d *DBWrapper) AddBroadcast(broadcast *messengertypes.Broadcast) error {
+	if broadcast.GetID() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a broadcast id is required"))
+	}
+
+	if err := d.db.Create(broadcast).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	d.logStep("Added broadcast to db", tyber.WithDetail("ID", broadcast.GetID()), tyber.WithDetail("ListID", broadcast.GetListID()))
+	return nil
+}
+
+// GetBroadcastReport returns a broadcast and the delivery state of each of its
+// recipients, sent messages that have been acknowledged are reported as such
+func (d *DBWrapper) GetBroadcastReport(id string) (*messengertypes.Broadcast, error) {
+	if id == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a broadcast id is required"))
+	}
+
+	broadcast := &messengertypes.Broadcast{}
+	if err := d.db.Preload(clause.Associations).First(broadcast, &messengertypes.Broadcast{ID: id}).Error; err != nil {
+		return nil, err
+	}
+
+	cids := []string(nil)
+	for _, delivery := range broadcast.GetDeliveries() {
+		if delivery.GetState() == messengertypes.BroadcastDelivery_Sent {
+			cids = append(cids, delivery.GetInteractionCID())
+		}
+	}
+
+	if len(cids) == 0 {
+		return broadcast, nil
+	}
+
+	acknowledged := []string(nil)
+	if err := d.db.Model(&messengertypes.Interaction{}).Where("cid IN ? AND acknowledged = ?", cids, true).Pluck("cid", &acknowledged).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	isAcknowledged := make(map[string]bool, len(acknowledged))
+	for _, cid := range acknowledged {
+		isAcknowledged[cid] = true
+	}
+
+	for _, delivery := range broadcast.GetDeliveries() {
+		if delivery.GetState() == messengertypes.BroadcastDelivery_Sent && isAcknowledged[delivery.GetInteractionCID()] {
+			delivery.State = messengertypes.BroadcastDelivery_Acknowledged
+		}
+	}
+
+	return broadcast, nil
+}
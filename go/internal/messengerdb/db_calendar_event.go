@@ -0,0 +1,91 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetCalendarEventRSVP replaces the response of a member to an event unless a
+// more recent one is already known, the responses sent at the same date are
+// ordered by value so that every member converges on the same attendance. It
+// returns whether the response changed.
+func (d *DBWrapper) SetCalendarEventRSVP(r messengertypes.CalendarEventRSVP) (bool, error) {
+	if r.GetEventCID() == "" || r.GetMemberPublicKey() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an event cid and a member public key are required"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing := &messengertypes.CalendarEventRSVP{}
+		err := tx.db.First(existing, &messengertypes.CalendarEventRSVP{EventCID: r.GetEventCID(), MemberPublicKey: r.GetMemberPublicKey()}).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return errcode.ErrDBRead.Wrap(err)
+		case existing.GetStateDate() > r.GetStateDate():
+			return nil
+		case existing.GetStateDate() == r.GetStateDate() && existing.GetResponse() >= r.GetResponse():
+			return nil
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&r).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		changed = true
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if changed {
+		d.logStep("Updated calendar event response in db", tyber.WithDetail("EventCID", r.GetEventCID()), tyber.WithDetail("MemberPublicKey", r.GetMemberPublicKey()))
+	}
+
+	return changed, nil
+}
+
+// GetCalendarEventRSVPs returns the latest response of each member to an event
+func (d *DBWrapper) GetCalendarEventRSVPs(eventCID string) ([]*messengertypes.CalendarEventRSVP, error) {
+	if eventCID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an event cid is required"))
+	}
+
+	rsvps := []*messengertypes.CalendarEventRSVP(nil)
+	if err := d.db.Where(&messengertypes.CalendarEventRSVP{EventCID: eventCID}).Order("member_public_key").Find(&rsvps).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return rsvps, nil
+}
+
+// fillCalendarEventAttendance sets the aggregated responses of each calendar event
+func (d *DBWrapper) fillCalendarEventAttendance(interactions ...*messengertypes.Interaction) error {
+	for _, inte := range interactions {
+		if inte.GetType() != messengertypes.AppMessage_TypeCalendarEvent {
+			continue
+		}
+
+		var event messengertypes.AppMessage_CalendarEvent
+		if err := proto.Unmarshal(inte.GetPayload(), &event); err != nil {
+			continue
+		}
+
+		rsvps, err := d.GetCalendarEventRSVPs(inte.GetCID())
+		if err != nil {
+			return err
+		}
+
+		inte.CalendarEventAttendance = event.Attendance(rsvps)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetCallLogInteraction returns the interaction summarizing a call
+func (d *DBWrapper) GetCallLogInteraction(convPK, callID string) (*messengertypes.Interaction, error) {
+	if convPK == "" || callID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("conversation public key and call id are required"))
+	}
+
+	call := &messengertypes.Call{}
+	if err := d.db.First(call, &messengertypes.Call{CallID: callID, ConversationPublicKey: convPK}).Error; err != nil {
+		return nil, err
+	}
+
+	return d.GetInteractionByCID(call.InteractionCID)
+}
+
+// AddCallLogInteraction persists the interaction summarizing a call and links
+// it to the call, it returns false if the interaction was already known
+func (d *DBWrapper) AddCallLogInteraction(callID string, rawInte messengertypes.Interaction) (*messengertypes.Interaction, bool, error) {
+	if callID == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a call id is required"))
+	}
+
+	i, isNew, err := d.AddInteraction(rawInte)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&messengertypes.Call{
+		CallID:                callID,
+		ConversationPublicKey: rawInte.ConversationPublicKey,
+		InteractionCID:        rawInte.CID,
+	}).Error; err != nil {
+		return nil, false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return i, isNew, nil
+}
+
+// UpdateInteractionPayload replaces the payload of a locally generated
+// interaction
+func (d *DBWrapper) UpdateInteractionPayload(cid string, payload []byte) (*messengertypes.Interaction, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	if err := d.db.Model(&messengertypes.Interaction{}).Where("cid = ?", cid).Update("payload", payload).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return d.GetInteractionByCID(cid)
+}
+
+// CountIncomingCallLogsSince returns the number of calls received in a
+// conversation since the given date
+func (d *DBWrapper) CountIncomingCallLogsSince(convPK string, since int64) (int64, error) {
+	var count int64
+	if err := d.db.Model(&messengertypes.Interaction{}).
+		Where("type = ? AND conversation_public_key = ? AND is_mine = ? AND sent_date >= ?", messengertypes.AppMessage_TypeCallLog, convPK, false, since).
+		Count(&count).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,90 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetContactIntroduction stores the message attached to the pending request of
+// a contact
+func (d *DBWrapper) SetContactIntroduction(contactPK string, text string) error {
+	if contactPK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	if err := d.db.Model(&messengertypes.Contact{}).Where(&messengertypes.Contact{PublicKey: contactPK}).Update("introduction", text).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// ConvertContactIntroduction turns the introduction of an accepted contact into
+// the first interaction of its conversation, dated from the request. isMine
+// tells whether the request was sent by the account. It returns nil if the
+// contact has no introduction.
+func (d *DBWrapper) ConvertContactIntroduction(contactPK string, isMine bool) (*messengertypes.Interaction, error) {
+	if contactPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	var inte *messengertypes.Interaction
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		contact, err := tx.GetContactByPK(contactPK)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown contact: %s", contactPK))
+		} else if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if contact.GetIntroduction() == "" {
+			return nil
+		}
+
+		if contact.GetState() != messengertypes.Contact_Accepted {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact request is not accepted: %s", contact.GetState()))
+		}
+
+		payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: contact.GetIntroduction()})
+		if err != nil {
+			return errcode.ErrSerialization.Wrap(err)
+		}
+
+		// the interaction is never shared, its cid only has to be unique in
+		// the conversation
+		cid, err := messengerutil.LocalMediaCID(append([]byte(contact.GetConversationPublicKey()), payload...))
+		if err != nil {
+			return err
+		}
+
+		if inte, _, err = tx.AddInteraction(messengertypes.Interaction{
+			CID:                   cid,
+			Type:                  messengertypes.AppMessage_TypeUserMessage,
+			ConversationPublicKey: contact.GetConversationPublicKey(),
+			IsMine:                isMine,
+			Payload:               payload,
+			SentDate:              contact.GetCreatedDate(),
+			Acknowledged:          isMine,
+		}); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return tx.SetContactIntroduction(contactPK, "")
+	}); err != nil {
+		return nil, err
+	}
+
+	if inte != nil {
+		d.logStep("Converted contact introduction to interaction", tyber.WithDetail("ContactPublicKey", contactPK), tyber.WithDetail("CID", inte.GetCID()))
+	}
+
+	return inte, nil
+}
@@ -0,0 +1,96 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetContactState moves a contact to state if its current state is one of
+// from, it returns the contact and whether it has been updated
+func (d *DBWrapper) SetContactState(contactPK string, state messengertypes.Contact_State, from ...messengertypes.Contact_State) (*messengertypes.Contact, bool, error) {
+	if contactPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	res := d.db.Model(&messengertypes.Contact{}).
+		Where("public_key = ? AND state IN ?", contactPK, from).
+		Update("state", state)
+	if res.Error != nil {
+		return nil, false, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	contact, err := d.GetContactByPK(contactPK)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if res.RowsAffected > 0 {
+		d.logStep("Updated contact state in db", tyber.WithDetail("ContactPublicKey", contactPK), tyber.WithDetail("State", state.String()))
+	}
+
+	return contact, res.RowsAffected > 0, nil
+}
+
+// BlockContact marks a contact as blocked, contacts unknown yet are added so
+// they are blocked when they send a request
+func (d *DBWrapper) BlockContact(contactPK string) (*messengertypes.Contact, bool, error) {
+	if contactPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	_, err := d.GetContactByPK(contactPK)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := d.db.Create(&messengertypes.Contact{
+			PublicKey:   contactPK,
+			State:       messengertypes.Contact_Blocked,
+			CreatedDate: messengerutil.TimestampMs(time.Now()),
+		}).Error; err != nil {
+			return nil, false, errcode.ErrDBWrite.Wrap(err)
+		}
+
+		contact, err := d.GetContactByPK(contactPK)
+		return contact, err == nil, err
+	} else if err != nil {
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return d.SetContactState(contactPK, messengertypes.Contact_Blocked,
+		messengertypes.Contact_Undefined,
+		messengertypes.Contact_IncomingRequest,
+		messengertypes.Contact_OutgoingRequestEnqueued,
+		messengertypes.Contact_OutgoingRequestSent,
+		messengertypes.Contact_Accepted,
+		messengertypes.Contact_Removed,
+	)
+}
+
+// renewRemovedContact starts a new contact request with a removed contact
+func (d *DBWrapper) renewRemovedContact(contactPK, displayName, convPK string, state messengertypes.Contact_State) (*messengertypes.Contact, error) {
+	fields := map[string]interface{}{
+		"state":        state,
+		"created_date": messengerutil.TimestampMs(time.Now()),
+		"sent_date":    0,
+		"introduction": "",
+	}
+	if displayName != "" {
+		fields["display_name"] = displayName
+	}
+	if convPK != "" {
+		fields["conversation_public_key"] = convPK
+	}
+
+	if err := d.db.Model(&messengertypes.Contact{}).Where("public_key = ?", contactPK).Updates(fields).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	d.logStep("Renewed removed contact in db", tyber.WithDetail("ContactPublicKey", contactPK), tyber.WithDetail("State", state.String()))
+	return d.GetContactByPK(contactPK)
+}
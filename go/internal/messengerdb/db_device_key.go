@@ -0,0 +1,162 @@
+package messengerdb
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// AddDeviceKeyEvent appends an entry to the audit log of the device keys, an
+// entry already recorded for the same event is not added again so replaying
+// the events doesn't duplicate the log
+func (d *DBWrapper) AddDeviceKeyEvent(event *messengertypes.DeviceKeyEvent) error {
+	if event.GetType() == messengertypes.DeviceKeyEvent_Undefined {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a device key event type is required"))
+	}
+
+	if event.GetDevicePublicKey() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a device public key is required"))
+	}
+
+	if event.GetMemberPublicKey() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a member public key is required"))
+	}
+
+	if event.GetEventCID() != "" {
+		count := int64(0)
+		if err := d.db.
+			Model(&messengertypes.DeviceKeyEvent{}).
+			Where("type = ? AND device_public_key = ? AND event_cid = ?", event.GetType(), event.GetDevicePublicKey(), event.GetEventCID()).
+			Count(&count).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if count > 0 {
+			return nil
+		}
+	}
+
+	entry := *event
+	entry.ID = 0
+	if entry.Date == 0 {
+		entry.Date = messengerutil.TimestampMs(time.Now())
+	}
+
+	if err := d.db.Create(&entry).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// GetContactKeyHistory reports the devices of a contact, or of every contact if
+// contactPK is empty, from the devices table and the audit log of the keys.
+// The devices seen first are pinned, the entries of the log about the others
+// and the conflicts are reported as changes.
+func (d *DBWrapper) GetContactKeyHistory(contactPK string) ([]*messengertypes.ContactKeyHistory_Contact, error) {
+	contacts := []*messengertypes.Contact(nil)
+
+	query := d.db.Order("public_key")
+	if contactPK != "" {
+		query = query.Where(&messengertypes.Contact{PublicKey: contactPK})
+	}
+
+	if err := query.Find(&contacts).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if contactPK != "" && len(contacts) == 0 {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown contact"))
+	}
+
+	history := make([]*messengertypes.ContactKeyHistory_Contact, len(contacts))
+	for i, contact := range contacts {
+		var err error
+		if history[i], err = d.contactKeyHistory(contact); err != nil {
+			return nil, err
+		}
+	}
+
+	return history, nil
+}
+
+func (d *DBWrapper) contactKeyHistory(contact *messengertypes.Contact) (*messengertypes.ContactKeyHistory_Contact, error) {
+	devices := []*messengertypes.Device(nil)
+	if err := d.db.
+		Where(&messengertypes.Device{MemberPublicKey: contact.GetPublicKey()}).
+		Find(&devices).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	// the conflicts are about a device claimed by the contact or a device of
+	// the contact claimed by someone else
+	events := []*messengertypes.DeviceKeyEvent(nil)
+	if err := d.db.
+		Where("member_public_key = ? OR device_public_key IN (?)", contact.GetPublicKey(), d.db.Model(&messengertypes.Device{}).Select("public_key").Where(&messengertypes.Device{MemberPublicKey: contact.GetPublicKey()})).
+		Order("date, id").
+		Find(&events).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	// the devices added before their date was recorded are dated from the log
+	// when possible
+	added := map[string]int64{}
+	for _, event := range events {
+		if _, ok := added[event.GetDevicePublicKey()]; !ok && event.GetType() == messengertypes.DeviceKeyEvent_Added {
+			added[event.GetDevicePublicKey()] = event.GetDate()
+		}
+	}
+
+	report := &messengertypes.ContactKeyHistory_Contact{
+		PublicKey:             contact.GetPublicKey(),
+		DisplayName:           contact.GetDisplayName(),
+		ConversationPublicKey: contact.GetConversationPublicKey(),
+		Keys:                  make([]*messengertypes.ContactKeyHistory_Key, len(devices)),
+	}
+
+	for i, device := range devices {
+		firstSeen := device.GetFirstSeenDate()
+		if date, ok := added[device.GetPublicKey()]; ok && (firstSeen == 0 || date < firstSeen) {
+			firstSeen = date
+		}
+
+		if i == 0 || firstSeen < report.PinnedDate {
+			report.PinnedDate = firstSeen
+		}
+
+		report.Keys[i] = &messengertypes.ContactKeyHistory_Key{
+			DevicePublicKey: device.GetPublicKey(),
+			MemberPublicKey: device.GetMemberPublicKey(),
+			FirstSeenDate:   firstSeen,
+		}
+	}
+
+	sort.Slice(report.Keys, func(i, j int) bool {
+		if report.Keys[i].FirstSeenDate != report.Keys[j].FirstSeenDate {
+			return report.Keys[i].FirstSeenDate < report.Keys[j].FirstSeenDate
+		}
+		return report.Keys[i].DevicePublicKey < report.Keys[j].DevicePublicKey
+	})
+
+	pinned := map[string]bool{}
+	for _, key := range report.Keys {
+		key.Pinned = key.FirstSeenDate == report.PinnedDate
+		pinned[key.DevicePublicKey] = key.Pinned
+	}
+
+	for _, event := range events {
+		if event.GetType() == messengertypes.DeviceKeyEvent_Added && pinned[event.GetDevicePublicKey()] {
+			continue
+		}
+		report.Changes = append(report.Changes, event)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,145 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetConversationMemberStates returns what is known locally of the other
+// members of a conversation: their devices and whether interactions were
+// exchanged with them. The contact of a contact conversation is its only
+// other member.
+func (d *DBWrapper) GetConversationMemberStates(convPK string) ([]*messengertypes.DiagnoseConversation_MemberState, error) {
+	conv, err := d.GetConversationByPK(convPK)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	members := []*messengertypes.Member(nil)
+	if err := d.db.
+		Where("conversation_public_key = ? AND is_me = ?", convPK, false).
+		Order("public_key").
+		Find(&members).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	states := []*messengertypes.DiagnoseConversation_MemberState(nil)
+	byPK := map[string]*messengertypes.DiagnoseConversation_MemberState{}
+	addState := func(memberPK, displayName string) {
+		if memberPK == "" || byPK[memberPK] != nil {
+			return
+		}
+		state := &messengertypes.DiagnoseConversation_MemberState{MemberPublicKey: memberPK, DisplayName: displayName}
+		byPK[memberPK] = state
+		states = append(states, state)
+	}
+
+	if conv.GetType() == messengertypes.Conversation_ContactType {
+		contact, err := d.GetContactByPK(conv.GetContactPublicKey())
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+		addState(conv.GetContactPublicKey(), contact.GetDisplayName())
+	}
+
+	for _, m := range members {
+		addState(m.GetPublicKey(), m.GetDisplayName())
+	}
+
+	if len(states) == 0 {
+		return nil, nil
+	}
+
+	memberPKs := make([]string, len(states))
+	for i, state := range states {
+		memberPKs[i] = state.GetMemberPublicKey()
+	}
+
+	devices := []struct {
+		MemberPublicKey string
+		Count           int32
+	}(nil)
+	if err := d.db.
+		Model(&messengertypes.Device{}).
+		Select("member_public_key, COUNT(*) AS count").
+		Where("member_public_key IN ?", memberPKs).
+		Group("member_public_key").
+		Find(&devices).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	for _, dev := range devices {
+		byPK[dev.MemberPublicKey].Devices = dev.Count
+	}
+
+	received := []string(nil)
+	if err := d.db.
+		Model(&messengertypes.Interaction{}).
+		Distinct("member_public_key").
+		Where("conversation_public_key = ? AND is_mine = ? AND member_public_key IN ?", convPK, false, memberPKs).
+		Pluck("member_public_key", &received).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	for _, pk := range received {
+		byPK[pk].ReceivedFrom = true
+	}
+
+	delivered := []string(nil)
+	if err := d.db.
+		Model(&messengertypes.DeliveryReceipt{}).
+		Distinct("delivery_receipts.member_public_key").
+		Joins("JOIN interactions ON interactions.cid = delivery_receipts.interaction_cid").
+		Where("interactions.conversation_public_key = ? AND interactions.is_mine = ?", convPK, true).
+		Where("delivery_receipts.member_public_key IN ?", memberPKs).
+		Where("delivery_receipts.delivered_date > 0 OR delivery_receipts.acknowledged_date > 0").
+		Pluck("delivery_receipts.member_public_key", &delivered).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	for _, pk := range delivered {
+		byPK[pk].DeliveredTo = true
+	}
+
+	// the acknowledgements of a contact don't always come with a receipt
+	if conv.GetType() == messengertypes.Conversation_ContactType && !byPK[conv.GetContactPublicKey()].GetDeliveredTo() {
+		count := int64(0)
+		if err := d.db.
+			Model(&messengertypes.Interaction{}).
+			Where("conversation_public_key = ? AND is_mine = ? AND acknowledged = ?", convPK, true, true).
+			Count(&count).
+			Error; err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+		byPK[conv.GetContactPublicKey()].DeliveredTo = count > 0
+	}
+
+	return states, nil
+}
+
+// CountQueuedMessages returns the number of messages of a conversation waiting
+// to be sent
+func (d *DBWrapper) CountQueuedMessages(convPK string) (int64, error) {
+	if convPK == "" {
+		return 0, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	count := int64(0)
+	if err := d.db.
+		Model(&messengertypes.QueuedMessage{}).
+		Where("conversation_public_key = ?", convPK).
+		Count(&count).
+		Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return count, nil
+}
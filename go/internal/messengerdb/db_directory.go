@@ -0,0 +1,53 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SaveDirectoryServiceRecord adds or replaces a record claimed on a directory service
+func (d *DBWrapper) SaveDirectoryServiceRecord(record *messengertypes.DirectoryServiceRecord) error {
+	if record.GetIdentifier() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a directory identifier is required"))
+	}
+
+	if err := d.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(record).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	d.logStep("Saved directory service record in db", tyber.WithDetail("Identifier", record.Identifier), tyber.WithDetail("TokenID", record.TokenID))
+	return nil
+}
+
+// GetDirectoryServiceRecord returns a record claimed on a directory service
+func (d *DBWrapper) GetDirectoryServiceRecord(identifier string) (*messengertypes.DirectoryServiceRecord, error) {
+	if identifier == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a directory identifier is required"))
+	}
+
+	record := &messengertypes.DirectoryServiceRecord{}
+	if err := d.db.First(record, &messengertypes.DirectoryServiceRecord{Identifier: identifier}).Error; err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// DeleteDirectoryServiceRecord removes a record claimed on a directory service
+func (d *DBWrapper) DeleteDirectoryServiceRecord(identifier string) error {
+	if identifier == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a directory identifier is required"))
+	}
+
+	if err := d.db.Delete(&messengertypes.DirectoryServiceRecord{}, &messengertypes.DirectoryServiceRecord{Identifier: identifier}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	d.logStep("Deleted directory service record from db", tyber.WithDetail("Identifier", identifier))
+	return nil
+}
@@ -0,0 +1,97 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// preloadDraft loads the draft of the conversations, its media references in
+// their order
+func preloadDraft(tx *gorm.DB) *gorm.DB {
+	return tx.
+		Preload("Draft").
+		Preload("Draft.MediaRefs", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") })
+}
+
+// SaveConversationDraft replaces the draft of a conversation, the draft is
+// removed if it has no body, target or media. It returns the stored draft, or
+// nil if it was removed.
+func (d *DBWrapper) SaveConversationDraft(draft *messengertypes.ConversationDraft) (*messengertypes.ConversationDraft, error) {
+	convPK := draft.GetConversationPublicKey()
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	isEmpty := draft.GetBody() == "" && draft.GetTargetCID() == "" && len(draft.GetMediaRefs()) == 0
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		count := int64(0)
+		if err := tx.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: convPK}).Count(&count).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		} else if count == 0 {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", convPK))
+		}
+
+		if err := tx.db.Where("conversation_public_key = ?", convPK).Delete(&messengertypes.ConversationDraftMediaRef{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if isEmpty {
+			if err := tx.db.Where("conversation_public_key = ?", convPK).Delete(&messengertypes.ConversationDraft{}).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+			return nil
+		}
+
+		refs := draft.GetMediaRefs()
+		for i, ref := range refs {
+			ref.ConversationPublicKey, ref.Position = convPK, int32(i)
+		}
+
+		if err := tx.db.Omit(clause.Associations).Clauses(clause.OnConflict{UpdateAll: true}).Create(draft).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if len(refs) > 0 {
+			if err := tx.db.Create(refs).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if isEmpty {
+		return nil, nil
+	}
+
+	return d.GetConversationDraft(convPK)
+}
+
+// GetConversationDraft returns the draft of a conversation, or nil if there is none
+func (d *DBWrapper) GetConversationDraft(convPK string) (*messengertypes.ConversationDraft, error) {
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	draft := &messengertypes.ConversationDraft{}
+	err := d.db.
+		Preload("MediaRefs", func(tx *gorm.DB) *gorm.DB { return tx.Order("position") }).
+		First(draft, &messengertypes.ConversationDraft{ConversationPublicKey: convPK}).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return draft, nil
+}
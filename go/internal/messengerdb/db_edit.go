@@ -0,0 +1,77 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// AddInteractionEdit stores an edit, it can be added before the interaction it
+// targets. It returns false if the edit was already known.
+func (d *DBWrapper) AddInteractionEdit(edit messengertypes.InteractionEdit) (bool, error) {
+	if edit.GetCID() == "" || edit.GetInteractionCID() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an edit cid and an interaction cid are required"))
+	}
+
+	res := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&edit)
+	if res.Error != nil {
+		return false, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return false, nil
+	}
+
+	d.logStep("Added interaction edit to db", tyber.WithDetail("CID", edit.GetCID()), tyber.WithDetail("InteractionCID", edit.GetInteractionCID()))
+	return true, nil
+}
+
+// GetInteractionEdits returns the edits of an interaction, the latest first
+func (d *DBWrapper) GetInteractionEdits(cid string) ([]*messengertypes.InteractionEdit, error) {
+	edits := []*messengertypes.InteractionEdit(nil)
+	if err := d.db.
+		Where(&messengertypes.InteractionEdit{InteractionCID: cid}).
+		Order("edited_date DESC, cid DESC").
+		Find(&edits).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return edits, nil
+}
+
+// DeleteInteractionEdits removes the edits with the given cids
+func (d *DBWrapper) DeleteInteractionEdits(cids []string) error {
+	if len(cids) == 0 {
+		return nil
+	}
+
+	if err := d.db.Where("cid IN ?", cids).Delete(&messengertypes.InteractionEdit{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// EditInteraction replaces the payload of an interaction with the one of an
+// edit
+func (d *DBWrapper) EditInteraction(cid string, payload []byte, editedDate int64) error {
+	res := d.db.
+		Model(&messengertypes.Interaction{}).
+		Where(&messengertypes.Interaction{CID: cid}).
+		Updates(map[string]interface{}{"payload": payload, "edited_date": editedDate})
+	if res.Error != nil {
+		return errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	if res.RowsAffected == 0 {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown interaction: %s", cid))
+	}
+
+	d.logStep("Edited interaction in db", tyber.WithDetail("CID", cid))
+	return nil
+}
@@ -0,0 +1,156 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetConversationEphemeralPolicy replaces the disappearing messages policy of
+// a conversation unless a more recent one is already known, the policies sent
+// at the same date are ordered by keeping the shortest ttl. It returns whether
+// the policy changed.
+func (d *DBWrapper) SetConversationEphemeralPolicy(convPK string, ttl int64, date int64) (bool, error) {
+	if convPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if ttl < 0 {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the message ttl can't be negative"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		conv := &messengertypes.Conversation{}
+		if err := tx.db.Select("message_ttl", "message_ttl_date").First(conv, &messengertypes.Conversation{PublicKey: convPK}).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		switch {
+		case conv.GetMessageTTLDate() > date:
+			return nil
+		case conv.GetMessageTTLDate() == date && !ephemeralTTLShorter(ttl, conv.GetMessageTTL()):
+			return nil
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.Conversation{}).
+			Where(&messengertypes.Conversation{PublicKey: convPK}).
+			Updates(map[string]interface{}{"message_ttl": ttl, "message_ttl_date": date}).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		changed = conv.GetMessageTTL() != ttl
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if changed {
+		d.logStep("Updated conversation ephemeral policy in db", tyber.WithDetail("ConversationPublicKey", convPK), tyber.WithDetail("MessageTTL", fmt.Sprintf("%d", ttl)))
+	}
+
+	return changed, nil
+}
+
+// ephemeralTTLShorter returns whether ttl keeps the messages for less time
+// than other, a ttl of 0 keeps them forever
+func ephemeralTTLShorter(ttl, other int64) bool {
+	switch {
+	case ttl == 0:
+		return false
+	case other == 0:
+		return true
+	default:
+		return ttl < other
+	}
+}
+
+// setInteractionExpiration sets when an interaction disappears according to
+// the policy of its conversation, only the interactions sent after the policy
+// are concerned
+func (d *DBWrapper) setInteractionExpiration(i *messengertypes.Interaction) error {
+	if i.GetExpiresDate() != 0 || i.GetSentDate() <= 0 || i.GetConversationPublicKey() == "" || i.GetType() == messengertypes.AppMessage_TypeSetEphemeralPolicy {
+		return nil
+	}
+
+	conv := &messengertypes.Conversation{}
+	err := d.db.Select("message_ttl", "message_ttl_date").First(conv, &messengertypes.Conversation{PublicKey: i.GetConversationPublicKey()}).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil
+	case err != nil:
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if conv.GetMessageTTL() > 0 && i.GetSentDate() >= conv.GetMessageTTLDate() {
+		i.ExpiresDate = i.GetSentDate() + conv.GetMessageTTL()*1000
+	}
+
+	return nil
+}
+
+// PurgeExpiredInteractions removes the interactions which disappeared at
+// date, along with everything referencing them. It returns the removed
+// interactions, only their CID and conversation are set.
+func (d *DBWrapper) PurgeExpiredInteractions(date int64) ([]*messengertypes.Interaction, error) {
+	expired := []*messengertypes.Interaction(nil)
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.
+			Model(&messengertypes.Interaction{}).
+			Select("cid", "conversation_public_key").
+			Where("expires_date > 0 AND expires_date <= ?", date).
+			Find(&expired).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(expired) == 0 {
+			return nil
+		}
+
+		cids := make([]string, len(expired))
+		for i, inte := range expired {
+			cids[i] = inte.GetCID()
+		}
+
+		// unlike the local retention, the disappearing messages don't
+		// survive as bookmarks, pins or shared positions
+		for _, cleanup := range []struct {
+			model  interface{}
+			column string
+		}{
+			{&messengertypes.Bookmark{}, "interaction_cid"},
+			{&messengertypes.PinnedMessage{}, "interaction_cid"},
+			{&messengertypes.PollVote{}, "poll_cid"},
+			{&messengertypes.CalendarEventRSVP{}, "event_cid"},
+			{&messengertypes.MemberLocation{}, "cid"},
+		} {
+			if err := tx.db.Where(cleanup.column+" IN ?", cids).Delete(cleanup.model).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		// the replies don't quote the disappeared messages anymore
+		if err := tx.db.Model(&messengertypes.QuoteSnapshot{}).Where("target_cid IN ?", cids).Update("excerpt", "").Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return tx.deleteInteractions(expired)
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(expired) > 0 {
+		d.logStep(fmt.Sprintf("Purged %d expired interactions from db", len(expired)), tyber.WithDetail("Date", fmt.Sprintf("%d", date)))
+	}
+
+	return expired, nil
+}
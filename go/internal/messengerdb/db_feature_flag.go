@@ -0,0 +1,74 @@
+package messengerdb
+
+import (
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// FeatureFlagDefaults are the values of the feature flags never set, the
+// experimental subsystems ship disabled
+var FeatureFlagDefaults = map[messengertypes.FeatureFlag_Name]bool{
+	messengertypes.FeatureFlag_FeatureMessageSearch:     true,
+	messengertypes.FeatureFlag_FeatureAckBatching:       false,
+	messengertypes.FeatureFlag_FeatureGroupEventWorkers: false,
+}
+
+// GetFeatureFlags returns every known feature flag, the ones never set have
+// their default value
+func (d *DBWrapper) GetFeatureFlags() ([]*messengertypes.FeatureFlag, error) {
+	stored := []*messengertypes.FeatureFlag(nil)
+	if err := d.db.Find(&stored).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	byName := make(map[messengertypes.FeatureFlag_Name]*messengertypes.FeatureFlag, len(stored))
+	for _, flag := range stored {
+		byName[flag.GetName()] = flag
+	}
+
+	flags := make([]*messengertypes.FeatureFlag, 0, len(FeatureFlagDefaults))
+	for name, enabled := range FeatureFlagDefaults {
+		if flag, ok := byName[name]; ok {
+			flags = append(flags, flag)
+		} else {
+			flags = append(flags, &messengertypes.FeatureFlag{Name: name, Enabled: enabled})
+		}
+	}
+
+	sort.Slice(flags, func(i, j int) bool { return flags[i].GetName() < flags[j].GetName() })
+
+	return flags, nil
+}
+
+// SetFeatureFlag stores the value of a feature flag
+func (d *DBWrapper) SetFeatureFlag(name messengertypes.FeatureFlag_Name, enabled bool, updatedDate int64) (*messengertypes.FeatureFlag, error) {
+	if _, ok := FeatureFlagDefaults[name]; !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown feature flag: %s", name))
+	}
+
+	flag := &messengertypes.FeatureFlag{Name: name, Enabled: enabled, UpdatedDate: updatedDate}
+	if err := d.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(flag).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return flag, nil
+}
+
+// ResetFeatureFlag restores the default value of a feature flag
+func (d *DBWrapper) ResetFeatureFlag(name messengertypes.FeatureFlag_Name) (*messengertypes.FeatureFlag, error) {
+	enabled, ok := FeatureFlagDefaults[name]
+	if !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown feature flag: %s", name))
+	}
+
+	if err := d.db.Delete(&messengertypes.FeatureFlag{}, "name = ?", name).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return &messengertypes.FeatureFlag{Name: name, Enabled: enabled}, nil
+}
@@ -0,0 +1,126 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetGroupInvitationMembership sets whether the account is a member of the
+// group of preview, and the number of members known by this device if it is
+func (d *DBWrapper) SetGroupInvitationMembership(preview *messengertypes.GroupInvitationPreview) error {
+	preview.Joined, preview.MemberCount = false, 0
+	if preview.GetGroupPublicKey() == "" {
+		return nil
+	}
+
+	conv, err := d.GetConversationByPK(preview.GetGroupPublicKey())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if conv.GetType() != messengertypes.Conversation_MultiMemberType || conv.GetLeftDate() > 0 {
+		return nil
+	}
+
+	count, err := d.countGroupMembers(conv.GetPublicKey())
+	if err != nil {
+		return err
+	}
+
+	preview.Joined, preview.MemberCount = true, count
+
+	return nil
+}
+
+// FirstGroupInvitationCID returns the cid of the first invitation received to
+// groupPK other than exceptCID, it is empty if there is none
+func (d *DBWrapper) FirstGroupInvitationCID(groupPK, exceptCID string) (string, error) {
+	if groupPK == "" {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	cids := []string(nil)
+	if err := d.db.
+		Model(&messengertypes.GroupInvitationPreview{}).
+		Joins("JOIN interactions ON interactions.cid = group_invitation_previews.interaction_cid").
+		Where("group_invitation_previews.group_public_key = ? AND group_invitation_previews.interaction_cid != ?", groupPK, exceptCID).
+		Order("interactions.sent_date ASC, interactions.cid ASC").
+		Limit(1).
+		Pluck("group_invitation_previews.interaction_cid", &cids).
+		Error; err != nil {
+		return "", errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(cids) == 0 {
+		return "", nil
+	}
+
+	return cids[0], nil
+}
+
+// SetGroupInvitationsJoined updates the membership of the invitations to
+// groupPK once the account joined or left the group, it returns the cids of
+// the invitations changed
+func (d *DBWrapper) SetGroupInvitationsJoined(groupPK string, joined bool) ([]string, error) {
+	if groupPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	cids := []string(nil)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.
+			Model(&messengertypes.GroupInvitationPreview{}).
+			Where("group_public_key = ? AND joined = ?", groupPK, !joined).
+			Pluck("interaction_cid", &cids).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(cids) == 0 {
+			return nil
+		}
+
+		count := int32(0)
+		if joined {
+			var err error
+			if count, err = tx.countGroupMembers(groupPK); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.GroupInvitationPreview{}).
+			Where("interaction_cid IN ?", cids).
+			Updates(map[string]interface{}{"joined": joined, "member_count": count}).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(cids) > 0 {
+		d.logStep("Updated group invitations membership", tyber.WithDetail("GroupPublicKey", groupPK), tyber.WithDetail("Joined", fmt.Sprintf("%t", joined)), tyber.WithJSONDetail("CIDs", cids))
+	}
+
+	return cids, nil
+}
+
+func (d *DBWrapper) countGroupMembers(groupPK string) (int32, error) {
+	count := int64(0)
+	if err := d.db.Model(&messengertypes.Member{}).Where("conversation_public_key = ?", groupPK).Count(&count).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return int32(count), nil
+}
@@ -0,0 +1,45 @@
+package messengerdb
+
+import (
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const latencySelect = "COUNT(*) AS count, CAST(AVG(interactions.received_date - interactions.sent_date) AS INTEGER) AS average_ms, MIN(interactions.received_date - interactions.sent_date) AS min_ms, MAX(interactions.received_date - interactions.sent_date) AS max_ms"
+
+// GetDeliveryLatencyStats aggregates the delay between the sent date and the
+// received date of the user messages received after since, per conversation
+// and per contact. The messages received with a sent date in the future, due
+// to clock skew, are ignored.
+func (d *DBWrapper) GetDeliveryLatencyStats(since int64) ([]*messengertypes.DeliveryLatencyStats_Latency, []*messengertypes.DeliveryLatencyStats_Latency, error) {
+	received := func() *gorm.DB {
+		return d.db.
+			Model(&messengertypes.Interaction{}).
+			Where("interactions.is_mine = false AND interactions.type = ? AND interactions.sent_date > 0 AND interactions.received_date >= interactions.sent_date AND interactions.received_date > ?", messengertypes.AppMessage_TypeUserMessage, since)
+	}
+
+	conversations := []*messengertypes.DeliveryLatencyStats_Latency(nil)
+	if err := received().
+		Select("interactions.conversation_public_key AS public_key, " + latencySelect).
+		Group("interactions.conversation_public_key").
+		Order("public_key").
+		Scan(&conversations).
+		Error; err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	contacts := []*messengertypes.DeliveryLatencyStats_Latency(nil)
+	if err := received().
+		Select("conversations.contact_public_key AS public_key, "+latencySelect).
+		Joins("JOIN conversations ON conversations.public_key = interactions.conversation_public_key AND conversations.type = ? AND conversations.contact_public_key != \"\"", messengertypes.Conversation_ContactType).
+		Group("conversations.contact_public_key").
+		Order("public_key").
+		Scan(&contacts).
+		Error; err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return conversations, contacts, nil
+}
@@ -0,0 +1,193 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// ArchiveLeftConversation marks a multi-member conversation as left at
+// leftDate, its content is kept as a read-only archive. The messages waiting to
+// be sent, the draft and the sessions of the conversation are removed.
+func (d *DBWrapper) ArchiveLeftConversation(convPK string, leftDate int64) (*messengertypes.Conversation, error) {
+	if leftDate <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a left date is required"))
+	}
+
+	archived := (*messengertypes.Conversation)(nil)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		conv, err := tx.getLeavableConversation(convPK)
+		if err != nil {
+			return err
+		}
+
+		if conv.GetLeftDate() > 0 {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the conversation was already left"))
+		}
+
+		queued := []*messengertypes.Interaction(nil)
+		if err := tx.db.
+			Select("cid").
+			Where("conversation_public_key = ? AND delivery_state = ?", convPK, messengertypes.Interaction_DeliveryStateQueued).
+			Find(&queued).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(queued) > 0 {
+			if err := tx.deleteInteractions(queued); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{
+			&messengertypes.QueuedMessage{},
+			&messengertypes.ConversationDraft{},
+			&messengertypes.ConversationDraftMediaRef{},
+			&messengertypes.ConversationSession{},
+			&messengertypes.MissingInteraction{},
+			&messengertypes.SharedPushToken{},
+		} {
+			if err := tx.db.Where("conversation_public_key = ?", convPK).Delete(model).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.Conversation{}).
+			Where("public_key = ?", convPK).
+			Updates(map[string]interface{}{"left_date": leftDate, "is_open": false, "focused_until": 0}).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if archived, err = tx.GetConversationByPK(convPK); err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Archived left conversation", tyber.WithDetail("PublicKey", convPK))
+	return archived, nil
+}
+
+// PurgeLeftConversation removes a multi-member conversation along with its
+// content, the devices of its members and the medias only it used. An archived
+// conversation can be purged.
+func (d *DBWrapper) PurgeLeftConversation(convPK string) error {
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		conv, err := tx.getLeavableConversation(convPK)
+		if err != nil {
+			return err
+		}
+
+		interactions := []*messengertypes.Interaction(nil)
+		if err := tx.db.Select("cid").Where("conversation_public_key = ?", convPK).Find(&interactions).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(interactions) > 0 {
+			if err := tx.deleteInteractions(interactions); err != nil {
+				return err
+			}
+		}
+
+		members := []*messengertypes.Member(nil)
+		if err := tx.db.Where("conversation_public_key = ?", convPK).Find(&members).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		medias := []string{conv.GetWallpaperCID(), conv.GetNotificationSoundCID()}
+		memberPKs := []string(nil)
+		for _, m := range members {
+			medias = append(medias, m.GetAvatarCID())
+			memberPKs = append(memberPKs, m.GetPublicKey())
+		}
+
+		// the member keys are specific to the group, so are their devices
+		if len(memberPKs) > 0 {
+			if err := tx.db.Where("member_public_key IN ?", memberPKs).Delete(&messengertypes.Device{}).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		for _, model := range []interface{}{
+			&messengertypes.Member{},
+			&messengertypes.ConversationReplicationInfo{},
+			&messengertypes.MetadataEvent{},
+			&messengertypes.SharedPushToken{},
+			&messengertypes.Bookmark{},
+			&messengertypes.PinnedMessage{},
+			&messengertypes.ProfileLink{},
+			&messengertypes.Call{},
+			&messengertypes.ReadMarker{},
+			&messengertypes.ConversationSession{},
+			&messengertypes.MemberLocation{},
+			&messengertypes.ConversationDraft{},
+			&messengertypes.ConversationDraftMediaRef{},
+			&messengertypes.MissingInteraction{},
+			&messengertypes.QueuedMessage{},
+		} {
+			if err := tx.db.Where("conversation_public_key = ?", convPK).Delete(model).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		if err := tx.DeleteReplayCheckpoints(convPK); err != nil {
+			return err
+		}
+
+		if err := tx.db.Where("public_key = ?", convPK).Delete(&messengertypes.Conversation{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return tx.deleteUnusedMedias(medias)
+	}); err != nil {
+		return err
+	}
+
+	d.logStep("Purged left conversation", tyber.WithDetail("PublicKey", convPK))
+	return nil
+}
+
+// MarkConversationRejoined makes a left conversation writable again, it
+// returns false if the conversation wasn't left
+func (d *DBWrapper) MarkConversationRejoined(convPK string) (bool, error) {
+	if convPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	res := d.db.Model(&messengertypes.Conversation{}).Where("public_key = ? AND left_date > 0", convPK).Update("left_date", 0)
+	if res.Error != nil {
+		return false, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+func (d *DBWrapper) getLeavableConversation(convPK string) (*messengertypes.Conversation, error) {
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	conv, err := d.GetConversationByPK(convPK)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", convPK))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if conv.GetType() != messengertypes.Conversation_MultiMemberType {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the multi-member conversations can be left"))
+	}
+
+	return conv, nil
+}
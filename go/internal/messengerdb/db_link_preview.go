@@ -0,0 +1,83 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// SaveLinkPreview stores the preview of a page, replacing the one previously
+// fetched
+func (d *DBWrapper) SaveLinkPreview(preview *messengertypes.LinkPreview) error {
+	if preview.GetURL() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an url is required"))
+	}
+
+	if err := d.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(preview).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// GetLinkPreviews returns the previews fetched for the given urls, including
+// the failed ones
+func (d *DBWrapper) GetLinkPreviews(urls []string) ([]*messengertypes.LinkPreview, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	previews := []*messengertypes.LinkPreview(nil)
+	if err := d.db.Where("url IN ?", urls).Find(&previews).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return previews, nil
+}
+
+// fillLinkPreviews sets the previews fetched for the links of each user message
+func (d *DBWrapper) fillLinkPreviews(interactions ...*messengertypes.Interaction) error {
+	links := map[*messengertypes.Interaction][]string{}
+	urls := []string(nil)
+	for _, inte := range interactions {
+		if inte.GetType() != messengertypes.AppMessage_TypeUserMessage {
+			continue
+		}
+
+		var msg messengertypes.AppMessage_UserMessage
+		if err := proto.Unmarshal(inte.GetPayload(), &msg); err != nil {
+			continue
+		}
+
+		if links[inte] = msg.Links(); len(links[inte]) > 0 {
+			urls = append(urls, links[inte]...)
+		}
+	}
+
+	previews, err := d.GetLinkPreviews(urls)
+	if err != nil || len(previews) == 0 {
+		return err
+	}
+
+	byURL := make(map[string]*messengertypes.LinkPreview, len(previews))
+	for _, preview := range previews {
+		if !preview.GetFailed() {
+			byURL[preview.GetURL()] = preview
+		}
+	}
+
+	for inte, urls := range links {
+		inte.LinkPreviews = nil
+		for _, url := range urls {
+			if preview, ok := byURL[url]; ok {
+				inte.LinkPreviews = append(inte.LinkPreviews, preview)
+			}
+		}
+	}
+
+	return nil
+}
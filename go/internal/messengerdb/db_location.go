@@ -0,0 +1,86 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetMemberLocation replaces the position of a member in a conversation unless
+// a more recent one is already known. A stop only applies to the live share
+// currently stored, it keeps its last coordinates, and a stopped share can't
+// be updated anymore. It returns the stored location and whether it changed.
+func (d *DBWrapper) SetMemberLocation(l messengertypes.MemberLocation) (*messengertypes.MemberLocation, bool, error) {
+	if l.GetConversationPublicKey() == "" || l.GetMemberPublicKey() == "" || l.GetCID() == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key, a member public key and a cid are required"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing := &messengertypes.MemberLocation{}
+		err := tx.db.First(existing, &messengertypes.MemberLocation{ConversationPublicKey: l.GetConversationPublicKey(), MemberPublicKey: l.GetMemberPublicKey()}).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// there is nothing to stop
+			if l.GetStopped() {
+				return nil
+			}
+
+		case err != nil:
+			return errcode.ErrDBRead.Wrap(err)
+
+		case l.GetStopped():
+			if !existing.GetLive() || existing.GetCID() != l.GetCID() || existing.GetStopped() {
+				return nil
+			}
+
+			// a stop is final even when it is received after a later update
+			l.Latitude, l.Longitude, l.Accuracy = existing.GetLatitude(), existing.GetLongitude(), existing.GetAccuracy()
+			if existing.GetStateDate() > l.GetStateDate() {
+				l.StateDate = existing.GetStateDate()
+			}
+
+		case existing.GetStateDate() >= l.GetStateDate():
+			return nil
+
+		case existing.GetStopped() && existing.GetCID() == l.GetCID():
+			return nil
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&l).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		changed = true
+		return nil
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if changed {
+		d.logStep("Updated member location in db", tyber.WithDetail("ConversationPublicKey", l.GetConversationPublicKey()), tyber.WithDetail("MemberPublicKey", l.GetMemberPublicKey()))
+	}
+
+	return &l, changed, nil
+}
+
+// GetMemberLocations returns the latest position of each member of a
+// conversation
+func (d *DBWrapper) GetMemberLocations(convPK string) ([]*messengertypes.MemberLocation, error) {
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	locations := []*messengertypes.MemberLocation(nil)
+	if err := d.db.Where(&messengertypes.MemberLocation{ConversationPublicKey: convPK}).Order("member_public_key").Find(&locations).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return locations, nil
+}
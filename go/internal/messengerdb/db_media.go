@@ -0,0 +1,212 @@
+package messengerdb
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// AddMedia caches a media locally, nothing is done if its CID is already known
+func (d *DBWrapper) AddMedia(media *messengertypes.Media) error {
+	if media.GetCID() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a media cid is required"))
+	}
+
+	media.DataSize = int64(len(media.Data))
+	media.LastUsedDate = messengerutil.TimestampMs(time.Now())
+
+	if err := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(media).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	d.logStep("Added media to db", tyber.WithDetail("CID", media.CID), tyber.WithDetail("Size", fmt.Sprintf("%d", media.DataSize)))
+	return nil
+}
+
+// GetMediaByCID returns a cached media and marks it as recently used
+func (d *DBWrapper) GetMediaByCID(cid string) (*messengertypes.Media, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a media cid is required"))
+	}
+
+	media := &messengertypes.Media{}
+	if err := d.db.First(media, &messengertypes.Media{CID: cid}).Error; err != nil {
+		return nil, err
+	}
+
+	media.LastUsedDate = messengerutil.TimestampMs(time.Now())
+	if err := d.db.Model(&messengertypes.Media{}).Where(&messengertypes.Media{CID: cid}).Update("last_used_date", media.LastUsedDate).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return media, nil
+}
+
+// PruneMedias removes the cached medias which aren't the avatar of the account,
+// a contact or a member, or the wallpaper or notification sound of a
+// conversation anymore, then the least recently used ones until the cache is
+// smaller than maxSize. The avatar of the account and the conversation medias
+// are never removed, they can't be fetched again.
+// It returns the number of removed medias.
+func (d *DBWrapper) PruneMedias(maxSize int64) (int64, error) {
+	avatarsOf := func(model interface{}) *gorm.DB {
+		return d.db.Model(model).Select("avatar_cid").Where("avatar_cid IS NOT NULL AND avatar_cid != ''")
+	}
+
+	removed := int64(0)
+	res := d.db.
+		Where("cid NOT IN (?) AND cid NOT IN (?) AND cid NOT IN (?)",
+			avatarsOf(&messengertypes.Account{}),
+			avatarsOf(&messengertypes.Contact{}),
+			avatarsOf(&messengertypes.Member{}),
+		).
+		Scopes(d.exceptConversationMedias).
+		Delete(&messengertypes.Media{})
+	if res.Error != nil {
+		return 0, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+	removed += res.RowsAffected
+
+	total := int64(0)
+	if err := d.db.Model(&messengertypes.Media{}).Select("COALESCE(SUM(data_size), 0)").Scan(&total).Error; err != nil {
+		return removed, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if total > maxSize {
+		medias := []*messengertypes.Media(nil)
+		if err := d.db.Model(&messengertypes.Media{}).
+			Select("cid", "data_size").
+			Where("cid NOT IN (?)", avatarsOf(&messengertypes.Account{})).
+			Scopes(d.exceptConversationMedias).
+			Order("last_used_date ASC").
+			Find(&medias).Error; err != nil {
+			return removed, errcode.ErrDBRead.Wrap(err)
+		}
+
+		cids := []string(nil)
+		for _, m := range medias {
+			if total <= maxSize {
+				break
+			}
+
+			cids = append(cids, m.CID)
+			total -= m.DataSize
+		}
+
+		if len(cids) > 0 {
+			res := d.db.Where("cid IN ?", cids).Delete(&messengertypes.Media{})
+			if res.Error != nil {
+				return removed, errcode.ErrDBWrite.Wrap(res.Error)
+			}
+			removed += res.RowsAffected
+		}
+	}
+
+	d.logStep("Pruned medias", tyber.WithDetail("Removed", fmt.Sprintf("%d", removed)), tyber.WithDetail("Size", fmt.Sprintf("%d", total)))
+	return removed, nil
+}
+
+// deleteUnusedMedias removes the medias among cids which are no longer the
+// avatar of the account, a contact or a member, nor a conversation media
+func (d *DBWrapper) deleteUnusedMedias(cids []string) error {
+	used := func(model interface{}) *gorm.DB {
+		return d.db.Model(model).Select("avatar_cid").Where("avatar_cid IS NOT NULL AND avatar_cid != ''")
+	}
+
+	if err := d.db.
+		Where("cid IN ? AND cid NOT IN (?) AND cid NOT IN (?) AND cid NOT IN (?)",
+			cids,
+			used(&messengertypes.Account{}),
+			used(&messengertypes.Contact{}),
+			used(&messengertypes.Member{}),
+		).
+		Scopes(d.exceptConversationMedias).
+		Delete(&messengertypes.Media{}).
+		Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// exceptConversationMedias excludes the wallpapers and the notification
+// sounds of the conversations, and the staged medias with their thumbnails,
+// from a media query
+func (d *DBWrapper) exceptConversationMedias(tx *gorm.DB) *gorm.DB {
+	mediasOf := func(model interface{}, column string) *gorm.DB {
+		return d.db.Model(model).Select(column).Where(column + " IS NOT NULL AND " + column + " != ''")
+	}
+
+	return tx.Where("cid NOT IN (?) AND cid NOT IN (?) AND cid NOT IN (?) AND cid NOT IN (?)",
+		mediasOf(&messengertypes.Conversation{}, "wallpaper_cid"),
+		mediasOf(&messengertypes.Conversation{}, "notification_sound_cid"),
+		mediasOf(&messengertypes.StagedMedia{}, "cid"),
+		mediasOf(&messengertypes.StagedMedia{}, "thumbnail_cid"),
+	)
+}
+
+// SetConversationWallpaper caches media and uses it as the wallpaper of a
+// conversation, the wallpaper is removed if media is nil
+func (d *DBWrapper) SetConversationWallpaper(convPK string, media *messengertypes.Media) error {
+	return d.setConversationMedia(convPK, "wallpaper_cid", media)
+}
+
+// SetConversationNotificationSound caches media and uses it as the
+// notification sound of a conversation, the sound is removed if media is nil
+func (d *DBWrapper) SetConversationNotificationSound(convPK string, media *messengertypes.Media) error {
+	return d.setConversationMedia(convPK, "notification_sound_cid", media)
+}
+
+func (d *DBWrapper) setConversationMedia(convPK string, column string, media *messengertypes.Media) error {
+	if convPK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		cid := ""
+		if media != nil {
+			if err := tx.AddMedia(media); err != nil {
+				return err
+			}
+			cid = media.GetCID()
+		}
+
+		res := tx.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: convPK}).Update(column, cid)
+		if res.Error != nil {
+			return errcode.ErrDBWrite.Wrap(res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", convPK))
+		}
+
+		tx.logStep("Updated conversation media in db", tyber.WithDetail("ConversationPublicKey", convPK), tyber.WithDetail("Column", column), tyber.WithDetail("CID", cid))
+		return nil
+	})
+}
+
+// GetAvatarUsers returns the contacts and the members using cid as avatar
+func (d *DBWrapper) GetAvatarUsers(cid string) ([]*messengertypes.Contact, []*messengertypes.Member, error) {
+	if cid == "" {
+		return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a media cid is required"))
+	}
+
+	contacts := []*messengertypes.Contact(nil)
+	if err := d.db.Where(&messengertypes.Contact{AvatarCID: cid}).Find(&contacts).Error; err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	members := []*messengertypes.Member(nil)
+	if err := d.db.Where(&messengertypes.Member{AvatarCID: cid}).Find(&members).Error; err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return contacts, members, nil
+}
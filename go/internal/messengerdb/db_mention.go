@@ -0,0 +1,44 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// UpdateMemberLastMessageDate sets the sent date of the last message of a
+// member, older dates are ignored
+func (d *DBWrapper) UpdateMemberLastMessageDate(memberPK, convPK string, sentDate int64) error {
+	if memberPK == "" || convPK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("member and conversation public keys are required"))
+	}
+
+	if err := d.db.Model(&messengertypes.Member{}).
+		Where("public_key = ? AND conversation_public_key = ? AND last_message_date < ?", memberPK, convPK, sentDate).
+		Update("last_message_date", sentDate).
+		Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// GetMentionCandidates returns the members of a conversation other than the
+// account, the most recent speakers first, their devices are not loaded
+func (d *DBWrapper) GetMentionCandidates(convPK string) ([]*messengertypes.Member, error) {
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	members := []*messengertypes.Member(nil)
+	if err := d.db.
+		Where("conversation_public_key = ? AND is_me = ?", convPK, false).
+		Order("last_message_date DESC, display_name, public_key").
+		Find(&members).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return members, nil
+}
@@ -0,0 +1,222 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// GetDuplicateConversations lists the contacts having more than one contact
+// conversation, it can happen when the contact request and the group events
+// race each other
+func (d *DBWrapper) GetDuplicateConversations() ([]*messengertypes.ConversationDuplicatesList_Duplicates, error) {
+	contactPKs := []string(nil)
+	if err := d.db.
+		Model(&messengertypes.Conversation{}).
+		Where("type = ? AND contact_public_key != \"\"", messengertypes.Conversation_ContactType).
+		Group("contact_public_key").
+		Having("COUNT(*) > 1").
+		Pluck("contact_public_key", &contactPKs).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	duplicates := make([]*messengertypes.ConversationDuplicatesList_Duplicates, len(contactPKs))
+	for i, contactPK := range contactPKs {
+		conversations := []*messengertypes.Conversation(nil)
+		if err := d.db.
+			Where(&messengertypes.Conversation{Type: messengertypes.Conversation_ContactType, ContactPublicKey: contactPK}).
+			Order("created_date asc").
+			Find(&conversations).
+			Error; err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		// keep the conversation the contact points to, or the oldest one
+		keep := conversations[0].GetPublicKey()
+		if contact, err := d.GetContactByPK(contactPK); err == nil {
+			for _, conv := range conversations {
+				if conv.GetPublicKey() == contact.GetConversationPublicKey() {
+					keep = conv.GetPublicKey()
+				}
+			}
+		}
+
+		duplicates[i] = &messengertypes.ConversationDuplicatesList_Duplicates{ContactPublicKey: contactPK, ConversationPublicKey: keep}
+		for _, conv := range conversations {
+			if conv.GetPublicKey() != keep {
+				duplicates[i].DuplicatePublicKeys = append(duplicates[i].DuplicatePublicKeys, conv.GetPublicKey())
+			}
+		}
+	}
+
+	return duplicates, nil
+}
+
+// MergeConversations moves everything referencing the duplicate conversation
+// to the kept one, merges their settings and deletes the duplicate. Rows
+// already existing in the kept conversation take precedence.
+func (d *DBWrapper) MergeConversations(keepPK, duplicatePK string) (*messengertypes.Conversation, error) {
+	if keepPK == "" || duplicatePK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("two conversation public keys are required"))
+	}
+
+	if keepPK == duplicatePK {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation can't be merged into itself"))
+	}
+
+	merged := (*messengertypes.Conversation)(nil)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		keep, err := tx.GetConversationByPK(keepPK)
+		if err != nil {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", keepPK))
+		}
+
+		duplicate, err := tx.GetConversationByPK(duplicatePK)
+		if err != nil {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", duplicatePK))
+		}
+
+		if keep.GetType() != messengertypes.Conversation_ContactType || duplicate.GetType() != messengertypes.Conversation_ContactType || keep.GetContactPublicKey() != duplicate.GetContactPublicKey() {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the conversations of a same contact can be merged"))
+		}
+
+		// rows without a key clash are moved
+		for _, model := range []interface{}{
+			&messengertypes.Interaction{},
+			&messengertypes.ConversationReplicationInfo{},
+			&messengertypes.MetadataEvent{},
+			&messengertypes.SharedPushToken{},
+			&messengertypes.BroadcastDelivery{},
+			&messengertypes.Bookmark{},
+			&messengertypes.PinnedMessage{},
+		} {
+			if err := tx.db.Model(model).Where("conversation_public_key = ?", duplicatePK).Update("conversation_public_key", keepPK).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		// rows with a composite key are moved unless they already exist in
+		// the kept conversation, the remaining ones are deleted
+		for _, rebind := range []struct {
+			model func() interface{}
+			key   string
+		}{
+			{func() interface{} { return &messengertypes.Member{} }, "public_key"},
+			{func() interface{} { return &messengertypes.ProfileLink{} }, "owner_public_key"},
+			{func() interface{} { return &messengertypes.Call{} }, "call_id"},
+			{func() interface{} { return &messengertypes.ReadMarker{} }, "member_public_key"},
+			{func() interface{} { return &messengertypes.ConversationSession{} }, "session_id"},
+			{func() interface{} { return &messengertypes.MemberLocation{} }, "member_public_key"},
+		} {
+			existing := []string(nil)
+			if err := tx.db.Model(rebind.model()).Where("conversation_public_key = ?", keepPK).Pluck(rebind.key, &existing).Error; err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+
+			query := tx.db.Model(rebind.model()).Where("conversation_public_key = ?", duplicatePK)
+			if len(existing) > 0 {
+				query = query.Where(rebind.key+" NOT IN ?", existing)
+			}
+			if err := query.Update("conversation_public_key", keepPK).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+
+			if err := tx.db.Where("conversation_public_key = ?", duplicatePK).Delete(rebind.model()).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		// the draft of the kept conversation wins
+		keptDrafts := int64(0)
+		if err := tx.db.Model(&messengertypes.ConversationDraft{}).Where("conversation_public_key = ?", keepPK).Count(&keptDrafts).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+		for _, model := range []interface{}{&messengertypes.ConversationDraft{}, &messengertypes.ConversationDraftMediaRef{}} {
+			query := tx.db.Where("conversation_public_key = ?", duplicatePK)
+			if keptDrafts > 0 {
+				err = query.Delete(model).Error
+			} else {
+				err = query.Model(model).Update("conversation_public_key", keepPK).Error
+			}
+			if err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		if err := tx.db.Model(&messengertypes.Contact{}).Where("conversation_public_key = ?", duplicatePK).Update("conversation_public_key", keepPK).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: keepPK}).Updates(mergedConversationValues(keep, duplicate)).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Delete(&messengertypes.Conversation{PublicKey: duplicatePK}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		merged, err = tx.GetConversationByPK(keepPK)
+		if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Merged conversations in db", tyber.WithDetail("ConversationPublicKey", keepPK), tyber.WithDetail("DuplicatePublicKey", duplicatePK))
+
+	return merged, nil
+}
+
+// mergedConversationValues returns the columns of keep to update with the
+// settings of duplicate
+func mergedConversationValues(keep, duplicate *messengertypes.Conversation) map[string]interface{} {
+	values := map[string]interface{}{
+		"unread_count": keep.GetUnreadCount() + duplicate.GetUnreadCount(),
+		"is_open":      keep.GetIsOpen() || duplicate.GetIsOpen(),
+	}
+
+	if duplicate.GetLastUpdate() > keep.GetLastUpdate() {
+		values["last_update"] = duplicate.GetLastUpdate()
+	}
+	if duplicate.GetLastReadDate() > keep.GetLastReadDate() {
+		values["last_read_date"] = duplicate.GetLastReadDate()
+	}
+	if duplicate.GetMutedUntil() > keep.GetMutedUntil() {
+		values["muted_until"] = duplicate.GetMutedUntil()
+	}
+	if duplicate.GetFocusedUntil() > keep.GetFocusedUntil() {
+		values["focused_until"] = duplicate.GetFocusedUntil()
+	}
+	// a language set manually wins over an inferred one
+	if duplicate.GetLanguageHintManual() && !keep.GetLanguageHintManual() {
+		values["language_hint"] = duplicate.GetLanguageHint()
+		values["language_hint_manual"] = true
+	}
+	if duplicate.GetCreatedDate() != 0 && (keep.GetCreatedDate() == 0 || duplicate.GetCreatedDate() < keep.GetCreatedDate()) {
+		values["created_date"] = duplicate.GetCreatedDate()
+	}
+
+	for column, fields := range map[string][2]string{
+		"display_name":                 {keep.GetDisplayName(), duplicate.GetDisplayName()},
+		"link":                         {keep.GetLink(), duplicate.GetLink()},
+		"account_member_public_key":    {keep.GetAccountMemberPublicKey(), duplicate.GetAccountMemberPublicKey()},
+		"local_device_public_key":      {keep.GetLocalDevicePublicKey(), duplicate.GetLocalDevicePublicKey()},
+		"local_member_public_key":      {keep.GetLocalMemberPublicKey(), duplicate.GetLocalMemberPublicKey()},
+		"shared_push_token_identifier": {keep.GetSharedPushTokenIdentifier(), duplicate.GetSharedPushTokenIdentifier()},
+		"auto_translate_language":      {keep.GetAutoTranslateLanguage(), duplicate.GetAutoTranslateLanguage()},
+		"language_hint":                {keep.GetLanguageHint(), duplicate.GetLanguageHint()},
+		"last_read_cid":                {keep.GetLastReadCID(), duplicate.GetLastReadCID()},
+	} {
+		if _, ok := values[column]; !ok && fields[0] == "" && fields[1] != "" {
+			values[column] = fields[1]
+		}
+	}
+
+	return values
+}
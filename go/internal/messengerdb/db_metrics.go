@@ -0,0 +1,76 @@
+package messengerdb
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// transactionMetrics is shared by the copies of a DBWrapper, the durations are
+// only observed once RegisterMetrics is called
+type transactionMetrics struct {
+	mutex     sync.RWMutex
+	durations *prometheus.HistogramVec
+}
+
+func (m *transactionMetrics) observe(elapsed time.Duration, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.durations == nil {
+		return
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	m.durations.WithLabelValues(outcome).Observe(elapsed.Seconds())
+}
+
+// RegisterMetrics measures the duration of the database transactions on reg,
+// the nested transactions are part of their parent
+func (d *DBWrapper) RegisterMetrics(reg prometheus.Registerer) error {
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    prometheus.BuildFQName("berty", "messenger", "db_transaction_duration_seconds"),
+		Help:    "time spent in the database transactions, once the database lock is held",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	}, []string{"outcome"})
+
+	if err := reg.Register(durations); err != nil {
+		return errcode.TODO.Wrap(fmt.Errorf("unable to register database metrics: %w", err))
+	}
+
+	d.txMetrics.mutex.Lock()
+	d.txMetrics.durations = durations
+	d.txMetrics.mutex.Unlock()
+
+	return nil
+}
+
+// CountOutboxEvents returns the number of stream events waiting to be
+// delivered to the dispatcher
+func (d *DBWrapper) CountOutboxEvents() (int64, error) {
+	count := int64(0)
+	if err := d.db.Model(&messengertypes.OutboxEvent{}).Count(&count).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return count, nil
+}
+
+// CountAllQueuedMessages returns the number of messages waiting to be sent in
+// all the conversations
+func (d *DBWrapper) CountAllQueuedMessages() (int64, error) {
+	count := int64(0)
+	if err := d.db.Model(&messengertypes.QueuedMessage{}).Count(&count).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,211 @@
+package messengerdb
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+const migrationBatchSize = 500
+
+type MigratedTable struct {
+	Name     string
+	Rows     int64
+	Checksum string
+}
+
+// MigrateDB copies every messenger table from src into dst, which can use
+// another SQL dialect than SQLite (i.e. Postgres).
+//
+// The source is only read, from a single transaction so the copy is a
+// consistent snapshot. A SQLite source is locked for writing until the copy
+// is done, nothing written meanwhile is left behind: a service using it is not
+// put in a read-only mode, it keeps serving reads but each of its writes fails
+// with "database is locked" once its busy timeout expired. Once copied, the
+// row count and a checksum of every table are computed on both sides and
+// compared, any difference is returned as an error before the destination is
+// used.
+func MigrateDB(ctx context.Context, src, dst *gorm.DB, logger *zap.Logger) ([]*MigratedTable, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	models := getDBModels()
+	if err := dst.AutoMigrate(models...); err != nil {
+		return nil, errcode.ErrDBMigrate.Wrap(err)
+	}
+
+	srcTx, release, err := beginMigrationSourceTx(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	tables := []*MigratedTable(nil)
+	for _, model := range models {
+		table, err := migrateTable(srcTx, dst.WithContext(ctx), model)
+		if err != nil {
+			return nil, err
+		}
+
+		tyber.LogStep(ctx, logger, fmt.Sprintf("Migrated table %s", table.Name), tyber.WithDetail("Rows", fmt.Sprintf("%d", table.Rows)), tyber.WithDetail("Checksum", table.Checksum))
+		tables = append(tables, table)
+	}
+
+	return tables, nil
+}
+
+// beginMigrationSourceTx opens the transaction src is read from, release ends
+// it. The SQLite transactions are deferred, they only lock the database on
+// their first write, so the one of a SQLite source is begun as immediate to
+// keep the other connections from writing until it ends.
+func beginMigrationSourceTx(ctx context.Context, src *gorm.DB) (*gorm.DB, func(), error) {
+	if !isSQLite(src) {
+		tx := src.WithContext(ctx).Begin()
+		if tx.Error != nil {
+			return nil, nil, errcode.ErrDBRead.Wrap(tx.Error)
+		}
+
+		return tx, func() { tx.Rollback() }, nil
+	}
+
+	rawDB, err := src.DB()
+	if err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	conn, err := rawDB.Conn(ctx)
+	if err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		_ = conn.Close()
+		return nil, nil, errcode.ErrDBRead.Wrap(fmt.Errorf("unable to lock the source database: %w", err))
+	}
+
+	tx := src.Session(&gorm.Session{Context: ctx, NewDB: true})
+	tx.Statement.ConnPool = conn
+
+	return tx, func() {
+		_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+		_ = conn.Close()
+	}, nil
+}
+
+func migrateTable(src, dst *gorm.DB, model interface{}) (*MigratedTable, error) {
+	stmt := &gorm.Statement{DB: src}
+	if err := stmt.Parse(model); err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	name := stmt.Schema.Table
+
+	var existing int64
+	if err := dst.Model(model).Count(&existing).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	if existing > 0 {
+		return nil, errcode.ErrDBEntryAlreadyExists.Wrap(fmt.Errorf("table %s is not empty in the destination database", name))
+	}
+
+	srcRows, srcSum := int64(0), rowsChecksum{}
+	if err := dst.Transaction(func(dstTx *gorm.DB) error {
+		return forEachRowsBatch(src, model, func(rows reflect.Value) error {
+			if err := srcSum.add(rows); err != nil {
+				return err
+			}
+			srcRows += int64(rows.Len())
+
+			if err := dstTx.Create(rows.Interface()).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	dstRows, dstSum := int64(0), rowsChecksum{}
+	if err := forEachRowsBatch(dst, model, func(rows reflect.Value) error {
+		dstRows += int64(rows.Len())
+		return dstSum.add(rows)
+	}); err != nil {
+		return nil, err
+	}
+
+	if srcRows != dstRows {
+		return nil, errcode.ErrDBMigrate.Wrap(fmt.Errorf("table %s: copied %d rows, found %d", name, srcRows, dstRows))
+	}
+
+	checksum := hex.EncodeToString(srcSum[:])
+	if dstChecksum := hex.EncodeToString(dstSum[:]); checksum != dstChecksum {
+		return nil, errcode.ErrDBMigrate.Wrap(fmt.Errorf("table %s: checksum mismatch, expected %s, got %s", name, checksum, dstChecksum))
+	}
+
+	return &MigratedTable{Name: name, Rows: srcRows, Checksum: checksum}, nil
+}
+
+// forEachRowsBatch calls fn with slices of rows of the model table, ordered by
+// primary key so the batches don't overlap, the order of the keys depends on
+// the collation of the database
+func forEachRowsBatch(db *gorm.DB, model interface{}, fn func(rows reflect.Value) error) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+	order := strings.Join(stmt.Schema.PrimaryFieldDBNames, ", ")
+
+	for offset := 0; ; offset += migrationBatchSize {
+		rows := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+		if err := db.Model(model).Order(order).Offset(offset).Limit(migrationBatchSize).Find(rows.Interface()).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if rows.Elem().Len() == 0 {
+			return nil
+		}
+
+		if err := fn(rows.Elem()); err != nil {
+			return err
+		}
+	}
+}
+
+// rowsChecksum is the sum, modulo 2^256, of the sha256 of the rows of a table.
+// The rows are summed in any order, as the databases don't sort the text keys
+// the same way.
+type rowsChecksum [sha256.Size]byte
+
+func (c *rowsChecksum) add(rows reflect.Value) error {
+	for i := 0; i < rows.Len(); i++ {
+		msg, ok := rows.Index(i).Interface().(proto.Message)
+		if !ok {
+			return errcode.ErrSerialization.Wrap(fmt.Errorf("unexpected model type %T", rows.Index(i).Interface()))
+		}
+
+		data, err := proto.Marshal(msg)
+		if err != nil {
+			return errcode.ErrSerialization.Wrap(err)
+		}
+
+		sum, carry := sha256.Sum256(data), uint16(0)
+		for j := len(c) - 1; j >= 0; j-- {
+			carry += uint16(c[j]) + uint16(sum[j])
+			c[j] = byte(carry)
+			carry >>= 8
+		}
+	}
+
+	return nil
+}
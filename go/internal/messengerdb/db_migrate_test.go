@@ -0,0 +1,162 @@
+package messengerdb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	sqlite "github.com/flyingtime/gorm-sqlcipher"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestMigrateDB(t *testing.T) {
+	src, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := src.AddConversation("conv1", "member1", "device1")
+	require.NoError(t, err)
+	for i := 0; i < migrationBatchSize+10; i++ {
+		_, _, err := src.AddInteraction(messengertypes.Interaction{CID: fmt.Sprintf("cid%04d", i), ConversationPublicKey: "conv1", Payload: []byte{byte(i)}, SentDate: int64(i)})
+		require.NoError(t, err)
+	}
+	_, err = src.AddMember("member1", "conv1", "name", "", true, true)
+	require.NoError(t, err)
+	_, err = src.AddMember("member2", "conv1", "name2", "", false, false)
+	require.NoError(t, err)
+
+	dst, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:memdb_migrate_%d?mode=memory&cache=shared", time.Now().UnixNano())), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	require.NoError(t, err)
+
+	tables, err := MigrateDB(context.Background(), src.db, dst, nil)
+	require.NoError(t, err)
+	require.Len(t, tables, len(getDBModels()))
+
+	rows := map[string]int64{}
+	for _, table := range tables {
+		rows[table.Name] = table.Rows
+		require.NotEmpty(t, table.Checksum)
+	}
+	require.Equal(t, int64(migrationBatchSize+10), rows["interactions"])
+	require.Equal(t, int64(2), rows["members"])
+	require.Equal(t, int64(1), rows["conversations"])
+
+	migrated := NewDBWrapper(dst, nil)
+	i, err := migrated.GetInteractionByCID("cid0042")
+	require.NoError(t, err)
+	require.Equal(t, []byte{42}, i.Payload)
+
+	// refuse to overwrite existing data
+	_, err = MigrateDB(context.Background(), src.db, dst, nil)
+	require.True(t, errcode.Is(err, errcode.ErrDBEntryAlreadyExists))
+}
+
+// otherDialector runs SQLite under another dialect name, so the paths used
+// for Postgres are taken on an actual database
+type otherDialector struct {
+	gorm.Dialector
+}
+
+func (otherDialector) Name() string { return "postgres" }
+
+func TestMigrateDB_InitDB(t *testing.T) {
+	src, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, src.FirstOrCreateAccount("account1", "link1"))
+	_, err := src.UpdateAccount("account1", "", "name")
+	require.NoError(t, err)
+	_, err = src.AddConversation("conv1", "member1", "device1")
+	require.NoError(t, err)
+	_, _, err = src.AddInteraction(messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1", Payload: []byte{1}, SentDate: 1})
+	require.NoError(t, err)
+
+	dst, err := gorm.Open(otherDialector{sqlite.Open(fmt.Sprintf("file:memdb_migrate_%d?mode=memory&cache=shared", time.Now().UnixNano()))}, &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	require.NoError(t, err)
+
+	_, err = MigrateDB(context.Background(), src.db, dst, nil)
+	require.NoError(t, err)
+
+	// the migrated database is opened as is, it is not rebuilt
+	migrated := NewDBWrapper(dst, nil)
+	require.NoError(t, migrated.InitDB(func(*DBWrapper) error {
+		return fmt.Errorf("unexpected rebuild of the migrated database")
+	}))
+
+	account, err := migrated.GetAccount()
+	require.NoError(t, err)
+	require.Equal(t, "name", account.DisplayName)
+	require.Equal(t, "name", keepDisplayName(dst, nil))
+
+	i, err := migrated.GetInteractionByCID("cid1")
+	require.NoError(t, err)
+	require.Equal(t, []byte{1}, i.Payload)
+
+	_, err = migrated.AddConversation("conv1", "member1", "device1")
+	require.True(t, errcode.Is(err, errcode.ErrDBEntryAlreadyExists))
+
+	// full text search needs sqlite
+	_, err = migrated.InteractionsSearch("query", nil)
+	require.Error(t, err)
+}
+
+func TestMigrateDB_SourceLocked(t *testing.T) {
+	src, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := src.AddConversation("conv1", "member1", "device1")
+	require.NoError(t, err)
+
+	dst, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:memdb_migrate_%d?mode=memory&cache=shared", time.Now().UnixNano())), &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+	})
+	require.NoError(t, err)
+
+	// the service tries to write, to a table not copied yet, while the first
+	// rows are copied
+	var writeErr error
+	once := sync.Once{}
+	require.NoError(t, dst.Callback().Create().Before("gorm:create").Register("test:write_source", func(*gorm.DB) {
+		once.Do(func() {
+			writeErr = src.SetReplayMessageCheckpoint("conv1", []byte("event"), 42)
+		})
+	}))
+
+	tables, err := MigrateDB(context.Background(), src.db, dst, nil)
+	require.NoError(t, err)
+	require.Error(t, writeErr)
+
+	for _, table := range tables {
+		if table.Name == "replay_checkpoints" {
+			require.Equal(t, int64(0), table.Rows)
+		}
+	}
+
+	// the source is writable again once migrated
+	require.NoError(t, src.SetReplayMessageCheckpoint("conv1", []byte("event"), 42))
+}
+
+func TestRowsChecksum(t *testing.T) {
+	rows := []*messengertypes.Conversation{{PublicKey: "a"}, {PublicKey: "B"}, {PublicKey: "_c"}}
+	reversed := []*messengertypes.Conversation{rows[2], rows[1], rows[0]}
+
+	sum, reversedSum := rowsChecksum{}, rowsChecksum{}
+	require.NoError(t, sum.add(reflect.ValueOf(rows)))
+	require.NoError(t, reversedSum.add(reflect.ValueOf(reversed[:1])))
+	require.NoError(t, reversedSum.add(reflect.ValueOf(reversed[1:])))
+	require.Equal(t, sum, reversedSum)
+
+	other := rowsChecksum{}
+	require.NoError(t, other.add(reflect.ValueOf(rows[:2])))
+	require.NotEqual(t, sum, other)
+}
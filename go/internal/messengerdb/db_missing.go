@@ -0,0 +1,68 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// AddMissingInteraction records an interaction referenced but not received, it
+// returns false if it was already recorded, the attempts made are kept
+func (d *DBWrapper) AddMissingInteraction(m *messengertypes.MissingInteraction) (bool, error) {
+	if m.GetCID() == "" || m.GetConversationPublicKey() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a conversation public key are required"))
+	}
+
+	res := d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(m)
+	if res.Error != nil {
+		return false, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// GetDueMissingInteractions returns up to limit missing interactions to look
+// up at date, the ones waiting the longest first
+func (d *DBWrapper) GetDueMissingInteractions(date int64, limit int) ([]*messengertypes.MissingInteraction, error) {
+	missing := []*messengertypes.MissingInteraction(nil)
+	if err := d.db.
+		Where("next_attempt_date > 0 AND next_attempt_date <= ?", date).
+		Order("next_attempt_date, cid").
+		Limit(limit).
+		Find(&missing).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return missing, nil
+}
+
+// SetMissingInteractionAttempt records a failed lookup of a missing
+// interaction, a nextAttemptDate of 0 gives it up
+func (d *DBWrapper) SetMissingInteractionAttempt(cid string, attempts int32, nextAttemptDate int64) error {
+	if cid == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	if err := d.db.
+		Model(&messengertypes.MissingInteraction{}).
+		Where(&messengertypes.MissingInteraction{CID: cid}).
+		Updates(map[string]interface{}{"attempts": attempts, "next_attempt_date": nextAttemptDate}).
+		Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// deleteMissingInteraction forgets a missing interaction once it is received
+func (d *DBWrapper) deleteMissingInteraction(cid string) error {
+	if err := d.db.Delete(&messengertypes.MissingInteraction{CID: cid}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
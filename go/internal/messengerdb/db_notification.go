@@ -0,0 +1,260 @@
+package messengerdb
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const notificationCachePluginName = "messenger:notification_cache"
+
+// sessionsForever is the expiry of the sessions of a conversation opened
+// without session id, or before the sessions were tracked
+const sessionsForever = int64(-1)
+
+// notificationCache keeps in memory the state the notifications of the
+// received interactions depend on, so deciding whether to notify doesn't read
+// the database. It is registered as a gorm plugin, every write to the tables
+// it caches drops it.
+type notificationCache struct {
+	mutex sync.Mutex
+	// generation is incremented on each invalidation, a value read from the
+	// database is only kept if no write happened meanwhile
+	generation uint64
+
+	snoozedUntil *int64
+	// sessionsExpiry is the date in ms at which the last session of a
+	// conversation expires, 0 if it has none
+	sessionsExpiry map[string]int64
+	contacts       map[string]*messengertypes.Contact
+}
+
+func newNotificationCache() *notificationCache {
+	return &notificationCache{
+		sessionsExpiry: make(map[string]int64),
+		contacts:       make(map[string]*messengertypes.Contact),
+	}
+}
+
+// notificationCacheFor returns the cache registered on db, it is shared by
+// every wrapper of the same database
+func notificationCacheFor(db *gorm.DB) (*notificationCache, error) {
+	if cache, ok := db.Config.Plugins[notificationCachePluginName].(*notificationCache); ok {
+		return cache, nil
+	}
+
+	cache := newNotificationCache()
+	if err := db.Use(cache); err != nil {
+		return nil, err
+	}
+
+	return cache, nil
+}
+
+func (c *notificationCache) Name() string {
+	return notificationCachePluginName
+}
+
+func (c *notificationCache) Initialize(db *gorm.DB) error {
+	invalidate := func(tx *gorm.DB) {
+		switch tx.Statement.Table {
+		case "accounts", "contacts", "conversation_sessions":
+			c.invalidate()
+		}
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Create().After("gorm:create").Register(notificationCachePluginName, invalidate); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register(notificationCachePluginName, invalidate); err != nil {
+		return err
+	}
+
+	return callbacks.Delete().After("gorm:delete").Register(notificationCachePluginName, invalidate)
+}
+
+func (c *notificationCache) invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	c.snoozedUntil = nil
+	c.sessionsExpiry = make(map[string]int64)
+	c.contacts = make(map[string]*messengertypes.Contact)
+}
+
+func (c *notificationCache) currentGeneration() uint64 {
+	if c == nil {
+		return 0
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.generation
+}
+
+// load returns the value cached by get, or reads it with fetch and caches it
+// with set if nothing was written to the cached tables meanwhile
+func (c *notificationCache) load(get func() bool, fetch func() error, set func()) error {
+	if c == nil {
+		return fetch()
+	}
+
+	c.mutex.Lock()
+	if get() {
+		c.mutex.Unlock()
+		return nil
+	}
+	generation := c.generation
+	c.mutex.Unlock()
+
+	if err := fetch(); err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	if c.generation == generation {
+		set()
+	}
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// NotificationState is what the notification of an interaction received in a
+// conversation depends on
+type NotificationState struct {
+	// Opened is true if the conversation is open in a live session
+	Opened bool
+	// Contact is the contact of a contact conversation, it is shared with the
+	// cache and must not be modified
+	Contact *messengertypes.Contact
+}
+
+// GetNotificationState returns the notification state of conv, conv is the
+// conversation of the interaction as read by the handler. The state is kept in
+// memory, the database is only read once after a change.
+func (d *DBWrapper) GetNotificationState(conv *messengertypes.Conversation, now time.Time) (*NotificationState, error) {
+	state := &NotificationState{}
+
+	if conv.GetIsOpen() {
+		expiry, err := d.conversationSessionsExpiry(conv.GetPublicKey())
+		if err != nil {
+			return nil, err
+		}
+		state.Opened = expiry == 0 || expiry == sessionsForever || messengerutil.TimestampMs(now) <= expiry
+	}
+
+	if conv.GetType() == messengertypes.Conversation_ContactType && conv.GetContactPublicKey() != "" {
+		contact, err := d.notificationContact(conv.GetContactPublicKey())
+		if err != nil {
+			return nil, err
+		}
+		state.Contact = contact
+	}
+
+	return state, nil
+}
+
+// NotificationsSnoozed returns whether the notifications are snoozed at now,
+// the snooze date is kept in memory
+func (d *DBWrapper) NotificationsSnoozed(now time.Time) (bool, error) {
+	c := d.notifCache
+	snoozedUntil := int64(0)
+
+	if err := c.load(
+		func() bool {
+			if c.snoozedUntil == nil {
+				return false
+			}
+			snoozedUntil = *c.snoozedUntil
+			return true
+		},
+		func() error {
+			acc, err := d.GetAccount()
+			if err != nil && !errcode.Is(err, errcode.ErrNotFound) {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+			snoozedUntil = acc.GetNotificationsSnoozedUntil()
+			return nil
+		},
+		func() { c.snoozedUntil = &snoozedUntil },
+	); err != nil {
+		return false, err
+	}
+
+	return (&messengertypes.Account{NotificationsSnoozedUntil: snoozedUntil}).NotificationsSnoozed(now), nil
+}
+
+func (d *DBWrapper) conversationSessionsExpiry(convPK string) (int64, error) {
+	c := d.notifCache
+	expiry := int64(0)
+
+	err := c.load(
+		func() bool {
+			cached, ok := c.sessionsExpiry[convPK]
+			expiry = cached
+			return ok
+		},
+		func() error {
+			sessions := []*messengertypes.ConversationSession(nil)
+			if err := d.db.Where("conversation_public_key = ?", convPK).Find(&sessions).Error; err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+
+			ttl := messengertypes.ConversationSessionTTL.Milliseconds()
+			for _, s := range sessions {
+				switch {
+				case s.GetSessionID() == "":
+					expiry = sessionsForever
+					return nil
+				case s.GetHeartbeatDate()+ttl > expiry:
+					expiry = s.GetHeartbeatDate() + ttl
+				}
+			}
+			return nil
+		},
+		func() { c.sessionsExpiry[convPK] = expiry },
+	)
+
+	return expiry, err
+}
+
+func (d *DBWrapper) notificationContact(contactPK string) (*messengertypes.Contact, error) {
+	c := d.notifCache
+	contact := (*messengertypes.Contact)(nil)
+
+	err := c.load(
+		func() bool {
+			cached, ok := c.contacts[contactPK]
+			contact = cached
+			return ok
+		},
+		func() error {
+			var err error
+			contact, err = d.GetContactByPK(contactPK)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				contact, err = nil, nil
+			}
+			if err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+			return nil
+		},
+		func() { c.contacts[contactPK] = contact },
+	)
+
+	return contact, err
+}
@@ -0,0 +1,106 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetPinnedMessage pins or unpins an interaction unless a more recent update
+// is already known. The updates sent at the same date are ordered by removal
+// then by member so that every member converges on the same pinned set. It
+// returns whether the pinned state changed.
+func (d *DBWrapper) SetPinnedMessage(p messengertypes.PinnedMessage) (bool, error) {
+	if p.GetInteractionCID() == "" || p.GetConversationPublicKey() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a conversation public key are required"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing := &messengertypes.PinnedMessage{}
+		err := tx.db.First(existing, &messengertypes.PinnedMessage{InteractionCID: p.GetInteractionCID()}).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// an unpin of an unknown pin is kept too, it can be older than the pin
+			changed = !p.GetRemoved()
+
+		case err != nil:
+			return errcode.ErrDBRead.Wrap(err)
+
+		case existing.GetConversationPublicKey() != p.GetConversationPublicKey():
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the interaction is pinned in another conversation"))
+
+		case !pinnedMessageSupersedes(&p, existing):
+			return nil
+
+		default:
+			changed = existing.GetRemoved() != p.GetRemoved()
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&p).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if changed {
+		d.logStep("Updated pinned message in db", tyber.WithDetail("CID", p.GetInteractionCID()), tyber.WithDetail("Removed", fmt.Sprintf("%t", p.GetRemoved())))
+	}
+
+	return changed, nil
+}
+
+// pinnedMessageSupersedes returns whether update must replace existing
+func pinnedMessageSupersedes(update, existing *messengertypes.PinnedMessage) bool {
+	switch {
+	case update.GetUpdatedDate() != existing.GetUpdatedDate():
+		return update.GetUpdatedDate() > existing.GetUpdatedDate()
+	case update.GetRemoved() != existing.GetRemoved():
+		return update.GetRemoved()
+	default:
+		return update.GetMemberPublicKey() < existing.GetMemberPublicKey()
+	}
+}
+
+// GetPinnedMessages returns the pinned messages of a conversation, the latest
+// pinned first. The pinned interactions known by this device are returned in
+// the same order.
+func (d *DBWrapper) GetPinnedMessages(convPK string) ([]*messengertypes.PinnedMessage, []*messengertypes.Interaction, error) {
+	if convPK == "" {
+		return nil, nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	pinned := []*messengertypes.PinnedMessage(nil)
+	if err := d.db.
+		Where("conversation_public_key = ? AND removed = ?", convPK, false).
+		Order("updated_date DESC, interaction_cid").
+		Find(&pinned).
+		Error; err != nil {
+		return nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(pinned) == 0 {
+		return nil, nil, nil
+	}
+
+	cids := make([]string, len(pinned))
+	for i, p := range pinned {
+		cids[i] = p.GetInteractionCID()
+	}
+
+	interactions, err := d.getInteractionsInOrder(cids)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pinned, interactions, nil
+}
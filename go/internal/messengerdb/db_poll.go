@@ -0,0 +1,92 @@
+package messengerdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetPollVote replaces the vote of a member in a poll unless a more recent
+// vote is already known, the votes sent at the same date are ordered by
+// payload so that every member converges on the same results. It returns
+// whether the vote changed.
+func (d *DBWrapper) SetPollVote(v messengertypes.PollVote) (bool, error) {
+	if v.GetPollCID() == "" || v.GetMemberPublicKey() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a poll cid and a member public key are required"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing := &messengertypes.PollVote{}
+		err := tx.db.First(existing, &messengertypes.PollVote{PollCID: v.GetPollCID(), MemberPublicKey: v.GetMemberPublicKey()}).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return errcode.ErrDBRead.Wrap(err)
+		case existing.GetStateDate() > v.GetStateDate():
+			return nil
+		case existing.GetStateDate() == v.GetStateDate() && bytes.Compare(existing.GetPayload(), v.GetPayload()) >= 0:
+			return nil
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&v).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		changed = true
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if changed {
+		d.logStep("Updated poll vote in db", tyber.WithDetail("PollCID", v.GetPollCID()), tyber.WithDetail("MemberPublicKey", v.GetMemberPublicKey()))
+	}
+
+	return changed, nil
+}
+
+// GetPollVotes returns the latest vote of each member in a poll
+func (d *DBWrapper) GetPollVotes(pollCID string) ([]*messengertypes.PollVote, error) {
+	if pollCID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a poll cid is required"))
+	}
+
+	votes := []*messengertypes.PollVote(nil)
+	if err := d.db.Where(&messengertypes.PollVote{PollCID: pollCID}).Order("member_public_key").Find(&votes).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return votes, nil
+}
+
+// fillPollResults sets the aggregated votes of each poll
+func (d *DBWrapper) fillPollResults(interactions ...*messengertypes.Interaction) error {
+	for _, inte := range interactions {
+		if inte.GetType() != messengertypes.AppMessage_TypePoll {
+			continue
+		}
+
+		var poll messengertypes.AppMessage_Poll
+		if err := proto.Unmarshal(inte.GetPayload(), &poll); err != nil {
+			continue
+		}
+
+		votes, err := d.GetPollVotes(inte.GetCID())
+		if err != nil {
+			return err
+		}
+
+		inte.PollResults = poll.Results(votes)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package messengerdb
+
+import (
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// GetPreferences returns the settings of the account and of the conversations
+// differing from the defaults
+func (d *DBWrapper) GetPreferences() (*messengertypes.Preferences, error) {
+	acc, err := d.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	convs := []*messengertypes.Conversation(nil)
+	if err := d.db.
+		Model(&messengertypes.Conversation{}).
+		Select("public_key", "muted_until", "auto_translate_language", "disable_read_receipts", "disable_typing_indicators").
+		Where("muted_until != 0 OR auto_translate_language != '' OR disable_read_receipts OR disable_typing_indicators").
+		Order("public_key").
+		Find(&convs).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	prefs := &messengertypes.Preferences{
+		MutedUntil:                      acc.GetMutedUntil(),
+		HideInAppNotifications:          acc.GetHideInAppNotifications(),
+		HidePushPreviews:                acc.GetHidePushPreviews(),
+		QuietHoursEnabled:               acc.GetQuietHoursEnabled(),
+		QuietHoursStart:                 acc.GetQuietHoursStart(),
+		QuietHoursEnd:                   acc.GetQuietHoursEnd(),
+		PresenceVisibility:              acc.GetPresenceVisibility(),
+		LocalRetentionDays:              acc.GetLocalRetentionDays(),
+		DisableReadReceipts:             acc.GetDisableReadReceipts(),
+		DisableTypingIndicators:         acc.GetDisableTypingIndicators(),
+		ReplicateNewGroupsAutomatically: acc.GetReplicateNewGroupsAutomatically(),
+		AutoSharePushTokenFlag:          acc.GetAutoSharePushTokenFlag(),
+	}
+
+	for _, conv := range convs {
+		prefs.Conversations = append(prefs.Conversations, &messengertypes.ConversationPreferences{
+			PublicKey:               conv.GetPublicKey(),
+			MutedUntil:              conv.GetMutedUntil(),
+			AutoTranslateLanguage:   conv.GetAutoTranslateLanguage(),
+			DisableReadReceipts:     conv.GetDisableReadReceipts(),
+			DisableTypingIndicators: conv.GetDisableTypingIndicators(),
+		})
+	}
+
+	return prefs, nil
+}
+
+// SetPreferences replaces the settings of the account and of the known
+// conversations, it returns the public keys of the unknown ones. The presence
+// visibility is left untouched, see SetPresenceVisibility.
+func (d *DBWrapper) SetPreferences(prefs *messengertypes.Preferences) ([]string, error) {
+	skipped := []string(nil)
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		skipped = nil
+
+		if err := tx.UpdateAccountFields(map[string]interface{}{
+			"muted_until":                        prefs.GetMutedUntil(),
+			"hide_in_app_notifications":          prefs.GetHideInAppNotifications(),
+			"hide_push_previews":                 prefs.GetHidePushPreviews(),
+			"quiet_hours_enabled":                prefs.GetQuietHoursEnabled(),
+			"quiet_hours_start":                  prefs.GetQuietHoursStart(),
+			"quiet_hours_end":                    prefs.GetQuietHoursEnd(),
+			"local_retention_days":               prefs.GetLocalRetentionDays(),
+			"disable_read_receipts":              prefs.GetDisableReadReceipts(),
+			"disable_typing_indicators":          prefs.GetDisableTypingIndicators(),
+			"replicate_new_groups_automatically": prefs.GetReplicateNewGroupsAutomatically(),
+			"auto_share_push_token_flag":         prefs.GetAutoSharePushTokenFlag(),
+		}); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		for _, conv := range prefs.GetConversations() {
+			// an empty key would match every conversation
+			if conv.GetPublicKey() == "" {
+				continue
+			}
+
+			res := tx.db.
+				Model(&messengertypes.Conversation{}).
+				Where(&messengertypes.Conversation{PublicKey: conv.GetPublicKey()}).
+				Updates(map[string]interface{}{
+					"muted_until":               conv.GetMutedUntil(),
+					"auto_translate_language":   conv.GetAutoTranslateLanguage(),
+					"disable_read_receipts":     conv.GetDisableReadReceipts(),
+					"disable_typing_indicators": conv.GetDisableTypingIndicators(),
+				})
+			if res.Error != nil {
+				return errcode.ErrDBWrite.Wrap(res.Error)
+			}
+
+			if res.RowsAffected == 0 {
+				skipped = append(skipped, conv.GetPublicKey())
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Imported preferences in db", tyber.WithJSONDetail("SkippedConversations", skipped))
+	return skipped, nil
+}
@@ -0,0 +1,90 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// UpdateContactLastSeen sets the last seen date of a contact, older dates are
+// ignored, it returns whether the contact has been updated
+func (d *DBWrapper) UpdateContactLastSeen(contactPK string, lastSeen int64) (bool, error) {
+	if contactPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	res := d.db.Model(&messengertypes.Contact{}).
+		Where("public_key = ? AND last_seen < ?", contactPK, lastSeen).
+		Update("last_seen", lastSeen)
+	if res.Error != nil {
+		return false, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// UpdateMemberLastSeen sets the last seen date of a member, older dates are
+// ignored, it returns whether the member has been updated
+func (d *DBWrapper) UpdateMemberLastSeen(memberPK, convPK string, lastSeen int64) (bool, error) {
+	if memberPK == "" || convPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("member and conversation public keys are required"))
+	}
+
+	res := d.db.Model(&messengertypes.Member{}).
+		Where("public_key = ? AND conversation_public_key = ? AND last_seen < ?", memberPK, convPK, lastSeen).
+		Update("last_seen", lastSeen)
+	if res.Error != nil {
+		return false, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	return res.RowsAffected > 0, nil
+}
+
+// SetPresenceVisibility sets the presence visibility of the account and forgets
+// the presence that isn't kept anymore, it returns the contacts and members
+// whose presence has been forgotten
+func (d *DBWrapper) SetPresenceVisibility(visibility messengertypes.Account_PresenceVisibility) ([]*messengertypes.Contact, []*messengertypes.Member, error) {
+	contacts := []*messengertypes.Contact(nil)
+	members := []*messengertypes.Member(nil)
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.UpdateAccountFields(map[string]interface{}{"presence_visibility": visibility}); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if !visibility.SharesPresenceIn(messengertypes.Conversation_ContactType) {
+			if err := tx.db.Where("last_seen > 0").Find(&contacts).Error; err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+
+			if err := tx.db.Model(&messengertypes.Contact{}).Where("last_seen > 0").Update("last_seen", 0).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		if !visibility.SharesPresenceIn(messengertypes.Conversation_MultiMemberType) {
+			if err := tx.db.Where("last_seen > 0").Find(&members).Error; err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+
+			if err := tx.db.Model(&messengertypes.Member{}).Where("last_seen > 0").Update("last_seen", 0).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	for _, c := range contacts {
+		c.LastSeen = 0
+	}
+
+	for _, m := range members {
+		m.LastSeen = 0
+	}
+
+	return contacts, members, nil
+}
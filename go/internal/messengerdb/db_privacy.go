@@ -0,0 +1,66 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetReceiptPrivacy disables read receipts and typing indicators for a
+// conversation, or for the account if convPK is empty
+func (d *DBWrapper) SetReceiptPrivacy(convPK string, disableReadReceipts, disableTypingIndicators bool) error {
+	values := map[string]interface{}{
+		"disable_read_receipts":     disableReadReceipts,
+		"disable_typing_indicators": disableTypingIndicators,
+	}
+
+	if convPK == "" {
+		if err := d.UpdateAccountFields(values); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	} else {
+		res := d.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: convPK}).Updates(values)
+		if res.Error != nil {
+			return errcode.ErrDBWrite.Wrap(res.Error)
+		}
+
+		if res.RowsAffected == 0 {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", convPK))
+		}
+	}
+
+	d.logStep("Updated receipt privacy in db", tyber.WithDetail("ConversationPublicKey", convPK))
+	return nil
+}
+
+// GetReceiptPrivacy returns whether read receipts and typing indicators are
+// disabled for a conversation, either by the account or by the conversation
+func (d *DBWrapper) GetReceiptPrivacy(convPK string) (disableReadReceipts bool, disableTypingIndicators bool, err error) {
+	acc := messengertypes.Account{}
+	if err := d.db.
+		Model(&messengertypes.Account{}).
+		Select("disable_read_receipts", "disable_typing_indicators").
+		First(&acc).
+		Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	conv := messengertypes.Conversation{}
+	if convPK != "" {
+		if err := d.db.
+			Model(&messengertypes.Conversation{}).
+			Select("disable_read_receipts", "disable_typing_indicators").
+			Where(&messengertypes.Conversation{PublicKey: convPK}).
+			First(&conv).
+			Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, false, errcode.ErrDBRead.Wrap(err)
+		}
+	}
+
+	return acc.GetDisableReadReceipts() || conv.GetDisableReadReceipts(), acc.GetDisableTypingIndicators() || conv.GetDisableTypingIndicators(), nil
+}
@@ -0,0 +1,146 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+type profileLinksKey struct {
+	ownerPK string
+	convPK  string
+}
+
+// getProfileLinks returns the links of a profile, in order
+func (d *DBWrapper) getProfileLinks(ownerPK, convPK string) ([]*messengertypes.ProfileLink, error) {
+	links := []*messengertypes.ProfileLink(nil)
+	if err := d.db.
+		Where(&messengertypes.ProfileLink{OwnerPublicKey: ownerPK, ConversationPublicKey: convPK}).
+		Order("position ASC").
+		Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+// getAllProfileLinks returns the links of every profile, in order
+func (d *DBWrapper) getAllProfileLinks() (map[profileLinksKey][]*messengertypes.ProfileLink, error) {
+	links := []*messengertypes.ProfileLink(nil)
+	if err := d.db.Order("position ASC").Find(&links).Error; err != nil {
+		return nil, err
+	}
+
+	byProfile := make(map[profileLinksKey][]*messengertypes.ProfileLink)
+	for _, link := range links {
+		key := profileLinksKey{link.OwnerPublicKey, link.ConversationPublicKey}
+		byProfile[key] = append(byProfile[key], link)
+	}
+
+	return byProfile, nil
+}
+
+func (d *DBWrapper) fillContactsProfileLinks(contacts []*messengertypes.Contact) error {
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	links, err := d.getAllProfileLinks()
+	if err != nil {
+		return err
+	}
+
+	for _, contact := range contacts {
+		contact.Links = links[profileLinksKey{contact.PublicKey, contact.ConversationPublicKey}]
+	}
+
+	return nil
+}
+
+// UpdateAccountProfile replaces the bio and the links of the account
+func (d *DBWrapper) UpdateAccountProfile(bio string, links []string) (*messengertypes.Account, error) {
+	var acc *messengertypes.Account
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		var err error
+		if acc, err = tx.GetAccount(); err != nil {
+			return err
+		}
+
+		if err := tx.db.Model(&messengertypes.Account{}).Where(&messengertypes.Account{PublicKey: acc.PublicKey}).Update("bio", bio).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.setProfileLinks(acc.PublicKey, "", links); err != nil {
+			return err
+		}
+
+		acc, err = tx.GetAccount()
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Updated account profile in db", tyber.WithJSONDetail("Account", acc))
+	return acc, nil
+}
+
+// UpdateContactProfile replaces the bio and the links of a contact
+func (d *DBWrapper) UpdateContactProfile(contactPK, convPK, bio string, links []string) error {
+	if contactPK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.Model(&messengertypes.Contact{}).Where(&messengertypes.Contact{PublicKey: contactPK}).Update("bio", bio).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return tx.setProfileLinks(contactPK, convPK, links)
+	})
+}
+
+// UpdateMemberProfile replaces the bio and the links of a member
+func (d *DBWrapper) UpdateMemberProfile(memberPK, convPK, bio string, links []string) error {
+	if memberPK == "" || convPK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("member and conversation public keys are required"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.Model(&messengertypes.Member{}).Where(&messengertypes.Member{PublicKey: memberPK, ConversationPublicKey: convPK}).Update("bio", bio).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return tx.setProfileLinks(memberPK, convPK, links)
+	})
+}
+
+func (d *DBWrapper) setProfileLinks(ownerPK, convPK string, links []string) error {
+	if err := d.db.
+		Where("owner_public_key = ? AND conversation_public_key = ?", ownerPK, convPK).
+		Delete(&messengertypes.ProfileLink{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if len(links) == 0 {
+		return nil
+	}
+
+	rows := make([]*messengertypes.ProfileLink, len(links))
+	for i, link := range links {
+		rows[i] = &messengertypes.ProfileLink{
+			OwnerPublicKey:        ownerPK,
+			ConversationPublicKey: convPK,
+			Position:              int32(i),
+			URL:                   link,
+		}
+	}
+
+	if err := d.db.Create(&rows).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// EnqueueInteraction stores an interaction which couldn't be sent along with
+// its marshaled app message, the interaction is marked as queued
+func (d *DBWrapper) EnqueueInteraction(i messengertypes.Interaction, payload []byte) (*messengertypes.Interaction, error) {
+	if i.GetCID() == "" || i.GetConversationPublicKey() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a cid and a conversation public key are required"))
+	}
+
+	if len(payload) == 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a payload is required"))
+	}
+
+	i.DeliveryState = messengertypes.Interaction_DeliveryStateQueued
+
+	queued := (*messengertypes.Interaction)(nil)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.Create(&messengertypes.QueuedMessage{
+			CID:                   i.GetCID(),
+			ConversationPublicKey: i.GetConversationPublicKey(),
+			Payload:               payload,
+			QueuedDate:            i.GetSentDate(),
+		}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		var err error
+		if queued, _, err = tx.AddInteraction(i); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Queued interaction in db", tyber.WithDetail("CID", i.GetCID()))
+	return queued, nil
+}
+
+// GetQueuedMessages returns the messages waiting to be sent, oldest first
+func (d *DBWrapper) GetQueuedMessages() ([]*messengertypes.QueuedMessage, error) {
+	queued := []*messengertypes.QueuedMessage(nil)
+	if err := d.db.Order("queued_date asc").Find(&queued).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return queued, nil
+}
+
+// DequeueInteraction removes a queued message and its interaction once it has
+// been sent
+func (d *DBWrapper) DequeueInteraction(cid string) error {
+	if cid == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a cid is required"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.Delete(&messengertypes.QueuedMessage{}, &messengertypes.QueuedMessage{CID: cid}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Where("cid = ? AND delivery_state = ?", cid, messengertypes.Interaction_DeliveryStateQueued).Delete(&messengertypes.Interaction{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,39 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// SaveQuoteSnapshot stores the snapshot of the message a reply targets,
+// replacing the previous one
+func (d *DBWrapper) SaveQuoteSnapshot(snapshot *messengertypes.QuoteSnapshot) error {
+	if snapshot.GetInteractionCID() == "" || snapshot.GetTargetCID() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a target cid are required"))
+	}
+
+	if err := d.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(snapshot).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// GetQuoteSnapshotsByTarget returns the snapshots of the replies to an
+// interaction
+func (d *DBWrapper) GetQuoteSnapshotsByTarget(targetCID string) ([]*messengertypes.QuoteSnapshot, error) {
+	if targetCID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a target cid is required"))
+	}
+
+	snapshots := []*messengertypes.QuoteSnapshot(nil)
+	if err := d.db.Where(&messengertypes.QuoteSnapshot{TargetCID: targetCID}).Find(&snapshots).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return snapshots, nil
+}
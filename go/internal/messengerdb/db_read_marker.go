@@ -0,0 +1,192 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetReadMarker moves the read marker of a member forward, nothing is done if
+// the known marker is already past it. It returns whether the marker moved.
+func (d *DBWrapper) SetReadMarker(m messengertypes.ReadMarker) (bool, error) {
+	if m.GetConversationPublicKey() == "" || m.GetMemberPublicKey() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation and a member public key are required"))
+	}
+
+	moved := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing := &messengertypes.ReadMarker{}
+		err := tx.db.First(existing, &messengertypes.ReadMarker{ConversationPublicKey: m.GetConversationPublicKey(), MemberPublicKey: m.GetMemberPublicKey()}).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return errcode.ErrDBRead.Wrap(err)
+		case existing.GetReadDate() >= m.GetReadDate():
+			return nil
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&m).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		moved = true
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if moved {
+		d.logStep("Updated read marker in db", tyber.WithDetail("ConversationPublicKey", m.GetConversationPublicKey()), tyber.WithDetail("MemberPublicKey", m.GetMemberPublicKey()))
+	}
+
+	return moved, nil
+}
+
+// SetConversationReadPosition moves the read position of a conversation
+// forward to one of its interactions, the read marker follows it so the
+// messages received before it are no longer unread. It returns whether the
+// position moved.
+func (d *DBWrapper) SetConversationReadPosition(convPK string, cid string) (*messengertypes.Conversation, bool, error) {
+	if convPK == "" || cid == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key and a cid are required"))
+	}
+
+	var conv *messengertypes.Conversation
+	moved := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		var err error
+		if conv, err = tx.GetConversationByPK(convPK); errors.Is(err, gorm.ErrRecordNotFound) {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", convPK))
+		} else if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		target, err := tx.GetInteractionByCID(cid)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown interaction: %s", cid))
+		} else if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+		if target.GetConversationPublicKey() != convPK {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("interaction %s is not part of the conversation", cid))
+		}
+
+		switch conv.GetLastReadCID() {
+		case cid:
+			return nil
+		case "":
+		default:
+			// the previous position may have been deleted since, it is then
+			// replaced by any interaction
+			previous, err := tx.GetInteractionByCID(conv.GetLastReadCID())
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+			case err != nil:
+				return errcode.ErrDBRead.Wrap(err)
+			case previous.GetSentDate() > target.GetSentDate():
+				return nil
+			}
+		}
+
+		values := map[string]interface{}{"last_read_cid": cid}
+		if target.GetSentDate() > conv.GetLastReadDate() {
+			values["last_read_date"] = target.GetSentDate()
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.Conversation{}).
+			Where(&messengertypes.Conversation{PublicKey: convPK}).
+			Updates(values).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if _, ok := values["last_read_date"]; ok {
+			if _, err := tx.RecomputeUnreadCounts(convPK); err != nil {
+				return err
+			}
+		}
+
+		if conv, err = tx.GetConversationByPK(convPK); err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		moved = true
+		return nil
+	}); err != nil {
+		return nil, false, err
+	}
+
+	if moved {
+		d.logStep("Updated conversation read position in db", tyber.WithDetail("ConversationPublicKey", convPK), tyber.WithDetail("CID", cid))
+	}
+
+	return conv, moved, nil
+}
+
+// GetReadMarkers returns the read markers of the members of a conversation
+func (d *DBWrapper) GetReadMarkers(convPK string) ([]*messengertypes.ReadMarker, error) {
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	markers := []*messengertypes.ReadMarker(nil)
+	if err := d.db.Where(&messengertypes.ReadMarker{ConversationPublicKey: convPK}).Order("member_public_key").Find(&markers).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return markers, nil
+}
+
+// GetLatestReceivedInteraction returns the most recent interaction of a
+// conversation which wasn't sent by the account
+func (d *DBWrapper) GetLatestReceivedInteraction(convPK string) (*messengertypes.Interaction, error) {
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	inte := &messengertypes.Interaction{}
+	if err := d.db.
+		Where("conversation_public_key = ? AND is_mine = false AND type = ?", convPK, messengertypes.AppMessage_TypeUserMessage).
+		Order("sent_date DESC").
+		First(inte).
+		Error; err != nil {
+		return nil, err
+	}
+
+	return inte, nil
+}
+
+// fillReadBy sets the members who read each interaction of the account
+func (d *DBWrapper) fillReadBy(interactions ...*messengertypes.Interaction) error {
+	markers := map[string][]*messengertypes.ReadMarker{}
+	for _, inte := range interactions {
+		if !inte.GetIsMine() {
+			continue
+		}
+
+		convPK := inte.GetConversationPublicKey()
+		if _, ok := markers[convPK]; !ok {
+			convMarkers, err := d.GetReadMarkers(convPK)
+			if err != nil {
+				return err
+			}
+			markers[convPK] = convMarkers
+		}
+
+		inte.ReadBy = nil
+		for _, m := range markers[convPK] {
+			if m.GetReadDate() >= inte.GetSentDate() {
+				inte.ReadBy = append(inte.ReadBy, m.GetMemberPublicKey())
+			}
+		}
+	}
+
+	return nil
+}
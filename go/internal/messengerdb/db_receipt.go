@@ -0,0 +1,267 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// AddDeliveryReceipt records the delivery or the acknowledge of an interaction
+// by a device, the interaction doesn't need to be known yet, the dates already
+// recorded for the device are kept, it returns false if nothing changed
+func (d *DBWrapper) AddDeliveryReceipt(receipt *messengertypes.DeliveryReceipt) (bool, error) {
+	if receipt.GetInteractionCID() == "" || receipt.GetDevicePublicKey() == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a device public key are required"))
+	}
+
+	existing := &messengertypes.DeliveryReceipt{}
+	err := d.db.First(existing, &messengertypes.DeliveryReceipt{InteractionCID: receipt.InteractionCID, DevicePublicKey: receipt.DevicePublicKey}).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err := d.db.Create(receipt).Error; err != nil {
+			return false, errcode.ErrDBWrite.Wrap(err)
+		}
+		return true, nil
+	} else if err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	fields := map[string]interface{}{}
+	if existing.DeliveredDate == 0 && receipt.DeliveredDate != 0 {
+		fields["delivered_date"] = receipt.DeliveredDate
+	}
+	if existing.AcknowledgedDate == 0 && receipt.AcknowledgedDate != 0 {
+		fields["acknowledged_date"] = receipt.AcknowledgedDate
+	}
+	if len(fields) == 0 {
+		return false, nil
+	}
+
+	if err := d.db.Model(existing).Updates(fields).Error; err != nil {
+		return false, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return true, nil
+}
+
+// GetMemberDeliveries aggregates the receipts of an interaction per member of
+// its conversation, the members without receipt are included
+func (d *DBWrapper) GetMemberDeliveries(cid string, convPK string) ([]*messengertypes.MessageDeliveryInfo_MemberDelivery, error) {
+	if cid == "" || convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a conversation public key are required"))
+	}
+
+	members := []*messengertypes.Member(nil)
+	if err := d.db.Where("conversation_public_key = ? AND is_me = ?", convPK, false).Find(&members).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	receipts := []*messengertypes.DeliveryReceipt(nil)
+	if err := d.db.Where(&messengertypes.DeliveryReceipt{InteractionCID: cid}).Find(&receipts).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	deliveries := make(map[string]*messengertypes.MessageDeliveryInfo_MemberDelivery, len(members))
+	for _, m := range members {
+		deliveries[m.PublicKey] = &messengertypes.MessageDeliveryInfo_MemberDelivery{Member: m}
+	}
+
+	earliest := func(current, date int64) int64 {
+		if date != 0 && (current == 0 || date < current) {
+			return date
+		}
+		return current
+	}
+
+	for _, r := range receipts {
+		delivery, ok := deliveries[r.MemberPublicKey]
+		if !ok {
+			// the info of the member may not have been received yet
+			delivery = &messengertypes.MessageDeliveryInfo_MemberDelivery{Member: &messengertypes.Member{PublicKey: r.MemberPublicKey, ConversationPublicKey: convPK}}
+			deliveries[r.MemberPublicKey] = delivery
+		}
+
+		if r.DeliveredDate != 0 {
+			delivery.DeliveredDevices++
+		}
+		delivery.DeliveredDate = earliest(delivery.DeliveredDate, r.DeliveredDate)
+		delivery.AcknowledgedDate = earliest(delivery.AcknowledgedDate, r.AcknowledgedDate)
+	}
+
+	ret := make([]*messengertypes.MessageDeliveryInfo_MemberDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		ret = append(ret, delivery)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Member.DisplayName != ret[j].Member.DisplayName {
+			return ret[i].Member.DisplayName < ret[j].Member.DisplayName
+		}
+		return ret[i].Member.PublicKey < ret[j].Member.PublicKey
+	})
+
+	return ret, nil
+}
+
+// fillDeliveryCounts sets the amount of members each own interaction of the
+// multi-member conversations was delivered to and read by, the read_by
+// members must already be set
+func (d *DBWrapper) fillDeliveryCounts(interactions ...*messengertypes.Interaction) error {
+	convPKs := []string(nil)
+	for _, inte := range interactions {
+		if inte.GetIsMine() {
+			convPKs = append(convPKs, inte.GetConversationPublicKey())
+		}
+	}
+
+	if len(convPKs) == 0 {
+		return nil
+	}
+
+	groupPKs := []string(nil)
+	if err := d.db.
+		Model(&messengertypes.Conversation{}).
+		Where("public_key IN ? AND type = ?", convPKs, messengertypes.Conversation_MultiMemberType).
+		Pluck("public_key", &groupPKs).
+		Error; err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	isGroup := make(map[string]bool, len(groupPKs))
+	for _, pk := range groupPKs {
+		isGroup[pk] = true
+	}
+
+	counted := map[string]*messengertypes.Interaction{}
+	cids := []string(nil)
+	for _, inte := range interactions {
+		if !inte.GetIsMine() || !isGroup[inte.GetConversationPublicKey()] {
+			continue
+		}
+
+		inte.DeliveredCount, inte.ReadCount = 0, int32(len(inte.GetReadBy()))
+		counted[inte.GetCID()] = inte
+		cids = append(cids, inte.GetCID())
+	}
+
+	if len(cids) == 0 {
+		return nil
+	}
+
+	// the receipts of the other devices of the account are not counted
+	deliveries := []struct {
+		InteractionCID  string `gorm:"column:interaction_cid"`
+		MemberPublicKey string
+	}(nil)
+	if err := d.db.
+		Model(&messengertypes.DeliveryReceipt{}).
+		Distinct("interaction_cid", "member_public_key").
+		Where("interaction_cid IN ? AND delivered_date > 0", cids).
+		Scan(&deliveries).
+		Error; err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	for _, delivery := range deliveries {
+		inte := counted[delivery.InteractionCID]
+		if delivery.MemberPublicKey != "" && delivery.MemberPublicKey != inte.GetMemberPublicKey() {
+			inte.DeliveredCount++
+		}
+	}
+
+	return nil
+}
+
+// IterateConversationAuditRecords calls fn with the delivery, acknowledge and
+// read records of a conversation. The receipts are read by batches of
+// batchSize following their primary key so the history is never fully loaded,
+// the read records come last.
+func (d *DBWrapper) IterateConversationAuditRecords(convPK string, batchSize int, fn func(records []*messengertypes.ConversationAuditExport_Record) error) error {
+	if convPK == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if batchSize <= 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the batch size must be positive"))
+	}
+
+	type receiptRow struct {
+		InteractionCID    string `gorm:"column:interaction_cid"`
+		MemberPublicKey   string
+		MemberDisplayName string
+		DevicePublicKey   string
+		DeliveredDate     int64
+		AcknowledgedDate  int64
+	}
+
+	afterCID, afterDevice := "", ""
+	for {
+		rows := []*receiptRow(nil)
+		if err := d.db.
+			Table("delivery_receipts").
+			Select("delivery_receipts.interaction_cid, delivery_receipts.member_public_key, COALESCE(members.display_name, '') AS member_display_name, delivery_receipts.device_public_key, delivery_receipts.delivered_date, delivery_receipts.acknowledged_date").
+			Joins("JOIN interactions ON interactions.cid = delivery_receipts.interaction_cid AND interactions.conversation_public_key = ?", convPK).
+			Joins("LEFT JOIN members ON members.public_key = delivery_receipts.member_public_key AND members.conversation_public_key = ?", convPK).
+			Where("delivery_receipts.interaction_cid > ? OR (delivery_receipts.interaction_cid = ? AND delivery_receipts.device_public_key > ?)", afterCID, afterCID, afterDevice).
+			Order("delivery_receipts.interaction_cid, delivery_receipts.device_public_key").
+			Limit(batchSize).
+			Scan(&rows).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		records := make([]*messengertypes.ConversationAuditExport_Record, 0, len(rows)*2)
+		for _, row := range rows {
+			record := func(kind messengertypes.ConversationAuditExport_Record_Kind, date int64) *messengertypes.ConversationAuditExport_Record {
+				return &messengertypes.ConversationAuditExport_Record{
+					Kind:              kind,
+					InteractionCID:    row.InteractionCID,
+					MemberPublicKey:   row.MemberPublicKey,
+					MemberDisplayName: row.MemberDisplayName,
+					DevicePublicKey:   row.DevicePublicKey,
+					Date:              date,
+				}
+			}
+
+			if row.DeliveredDate != 0 {
+				records = append(records, record(messengertypes.ConversationAuditExport_Record_KindDelivered, row.DeliveredDate))
+			}
+			if row.AcknowledgedDate != 0 {
+				records = append(records, record(messengertypes.ConversationAuditExport_Record_KindAcknowledged, row.AcknowledgedDate))
+			}
+		}
+
+		if len(records) > 0 {
+			if err := fn(records); err != nil {
+				return err
+			}
+		}
+
+		if len(rows) < batchSize {
+			break
+		}
+
+		afterCID, afterDevice = rows[len(rows)-1].InteractionCID, rows[len(rows)-1].DevicePublicKey
+	}
+
+	reads := []*messengertypes.ConversationAuditExport_Record(nil)
+	if err := d.db.
+		Table("read_markers").
+		Select("? AS kind, read_markers.interaction_cid, read_markers.member_public_key, COALESCE(members.display_name, '') AS member_display_name, read_markers.updated_date AS date", messengertypes.ConversationAuditExport_Record_KindRead).
+		Joins("LEFT JOIN members ON members.public_key = read_markers.member_public_key AND members.conversation_public_key = read_markers.conversation_public_key").
+		Where("read_markers.conversation_public_key = ?", convPK).
+		Order("read_markers.member_public_key").
+		Scan(&reads).
+		Error; err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(reads) == 0 {
+		return nil
+	}
+
+	return fn(reads)
+}
@@ -0,0 +1,77 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetReplayCheckpoint returns the checkpoint of a group, its event ids are
+// empty if no event of the group was handled yet
+func (d *DBWrapper) GetReplayCheckpoint(groupPK string) (*messengertypes.ReplayCheckpoint, error) {
+	if groupPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	checkpoint := &messengertypes.ReplayCheckpoint{}
+	err := d.db.Where("group_public_key = ?", groupPK).First(checkpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &messengertypes.ReplayCheckpoint{GroupPublicKey: groupPK}, nil
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return checkpoint, nil
+}
+
+// SetReplayMetadataCheckpoint records the last metadata event handled in a
+// group
+func (d *DBWrapper) SetReplayMetadataCheckpoint(groupPK string, eventID []byte, date int64) error {
+	return d.setReplayCheckpoint(&messengertypes.ReplayCheckpoint{GroupPublicKey: groupPK, MetadataEventID: eventID, UpdatedDate: date}, "metadata_event_id")
+}
+
+// SetReplayMessageCheckpoint records the last message event handled in a
+// group
+func (d *DBWrapper) SetReplayMessageCheckpoint(groupPK string, eventID []byte, date int64) error {
+	return d.setReplayCheckpoint(&messengertypes.ReplayCheckpoint{GroupPublicKey: groupPK, MessageEventID: eventID, UpdatedDate: date}, "message_event_id")
+}
+
+func (d *DBWrapper) setReplayCheckpoint(checkpoint *messengertypes.ReplayCheckpoint, column string) error {
+	if checkpoint.GetGroupPublicKey() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a group public key is required"))
+	}
+
+	if len(checkpoint.GetMetadataEventID()) == 0 && len(checkpoint.GetMessageEventID()) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an event id is required"))
+	}
+
+	if err := d.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_public_key"}},
+		DoUpdates: clause.AssignmentColumns([]string{column, "updated_date"}),
+	}).Create(checkpoint).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// DeleteReplayCheckpoints removes the checkpoint of a group, or every
+// checkpoint if groupPK is empty, their events are handled again on the next
+// replay
+func (d *DBWrapper) DeleteReplayCheckpoints(groupPK string) error {
+	query := d.db.Session(&gorm.Session{AllowGlobalUpdate: true})
+	if groupPK != "" {
+		query = query.Where("group_public_key = ?", groupPK)
+	}
+
+	if err := query.Delete(&messengertypes.ReplayCheckpoint{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetInteractionsSince returns the interactions of a conversation sent after
+// the one with the given cid, oldest first. When the cid is unknown or when
+// more than amount interactions are missing, only the latest amount
+// interactions are returned and truncated is set.
+func (d *DBWrapper) GetInteractionsSince(convPK, cid string, amount int32) (_ []*messengertypes.Interaction, truncated bool, err error) {
+	if convPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if amount <= 0 {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a positive amount is required"))
+	}
+
+	if cid != "" {
+		ref, err := d.GetInteractionByCID(cid)
+		switch {
+		case err == nil && ref.GetConversationPublicKey() == convPK:
+			interactions, err := d.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{
+				ConversationPK: convPK,
+				RefCID:         cid,
+				OldestToNewest: true,
+				Amount:         amount + 1,
+			})
+			if err != nil {
+				return nil, false, err
+			}
+
+			if len(interactions) <= int(amount) {
+				return interactions, false, nil
+			}
+
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, false, errcode.ErrDBRead.Wrap(err)
+		}
+	}
+
+	latest, err := d.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{
+		ConversationPK: convPK,
+		Amount:         amount,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i, j := 0, len(latest)-1; i < j; i, j = i+1, j-1 {
+		latest[i], latest[j] = latest[j], latest[i]
+	}
+
+	return latest, len(latest) == int(amount), nil
+}
@@ -0,0 +1,113 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetLocalRetentionDays sets how many days interactions are kept on this
+// device, 0 keeps them forever
+func (d *DBWrapper) SetLocalRetentionDays(days int32) error {
+	if days < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the retention can't be negative"))
+	}
+
+	if err := d.UpdateAccountFields(map[string]interface{}{"local_retention_days": days}); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// PruneInteractionsBefore removes the interactions sent before date along
+// with their translations, quotes, delivery receipts and edits. The
+// interactions waiting in the backlog for their member, the bookmarked and the
+// pinned ones are kept. It returns the removed interactions, only their CID and
+// conversation are set.
+func (d *DBWrapper) PruneInteractionsBefore(date int64) ([]*messengertypes.Interaction, error) {
+	pruned := []*messengertypes.Interaction(nil)
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.
+			Model(&messengertypes.Interaction{}).
+			Select("cid", "conversation_public_key").
+			Where("sent_date > 0 AND sent_date < ?", date).
+			Where("cid NOT IN (?)", tx.db.Model(&messengertypes.BacklogEntry{}).Select("interaction_cid")).
+			Where("cid NOT IN (?)", tx.db.Model(&messengertypes.Bookmark{}).Select("interaction_cid").Where("removed = ?", false)).
+			Where("cid NOT IN (?)", tx.db.Model(&messengertypes.PinnedMessage{}).Select("interaction_cid").Where("removed = ?", false)).
+			Find(&pruned).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(pruned) == 0 {
+			return nil
+		}
+
+		return tx.deleteInteractions(pruned)
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep(fmt.Sprintf("Pruned %d interactions from db", len(pruned)), tyber.WithDetail("Before", fmt.Sprintf("%d", date)))
+	return pruned, nil
+}
+
+// deleteInteractions removes interactions along with their translations,
+// quotes, delivery receipts, edits, forward origins and the votes and
+// responses to the polls and events among them
+func (d *DBWrapper) deleteInteractions(interactions []*messengertypes.Interaction) error {
+	cids := make([]string, len(interactions))
+	for i, inte := range interactions {
+		cids[i] = inte.GetCID()
+	}
+
+	for _, model := range []interface{}{
+		&messengertypes.InteractionTranslation{},
+		&messengertypes.QuoteSnapshot{},
+		&messengertypes.DeliveryReceipt{},
+		&messengertypes.InteractionEdit{},
+		&messengertypes.ForwardedFrom{},
+		&messengertypes.InteractionMention{},
+		&messengertypes.BacklogEntry{},
+		&messengertypes.GroupInvitationPreview{},
+	} {
+		if err := d.db.Where("interaction_cid IN ?", cids).Delete(model).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	if err := d.db.Where("poll_cid IN ?", cids).Delete(&messengertypes.PollVote{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := d.db.Where("event_cid IN ?", cids).Delete(&messengertypes.CalendarEventRSVP{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	if err := d.db.Where("cid IN ?", cids).Delete(&messengertypes.Interaction{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// PruneMediasUnusedSince removes the cached medias which weren't used since
+// date, they are fetched again if needed. The avatar of the account and the
+// conversation medias are never removed. It returns the number of removed
+// medias.
+func (d *DBWrapper) PruneMediasUnusedSince(date int64) (int64, error) {
+	res := d.db.
+		Where("last_used_date < ? AND cid NOT IN (?)", date, d.db.Model(&messengertypes.Account{}).Select("avatar_cid").Where("avatar_cid IS NOT NULL AND avatar_cid != ''")).
+		Scopes(d.exceptConversationMedias).
+		Delete(&messengertypes.Media{})
+	if res.Error != nil {
+		return 0, errcode.ErrDBWrite.Wrap(res.Error)
+	}
+
+	d.logStep("Pruned unused medias", tyber.WithDetail("Removed", fmt.Sprintf("%d", res.RowsAffected)))
+	return res.RowsAffected, nil
+}
@@ -0,0 +1,86 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// GetRetractionsForInteraction returns the retractions waiting in the backlog
+// for an interaction
+func (d *DBWrapper) GetRetractionsForInteraction(cid string) ([]*messengertypes.Interaction, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	retractions := []*messengertypes.Interaction(nil)
+	if err := d.db.
+		Preload("Conversation").
+		Where(&messengertypes.Interaction{Type: messengertypes.AppMessage_TypeMessageRetract, TargetCID: cid}).
+		Find(&retractions).
+		Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return retractions, nil
+}
+
+// RetractInteraction deletes an interaction along with its translations,
+// quote, delivery receipts, edits, bookmark, forward origin and shared location. The snapshots of the replies
+// quoting it are marked as retracted, it returns the CIDs of these replies.
+func (d *DBWrapper) RetractInteraction(cid string) ([]string, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	replies := []string(nil)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		for _, model := range []interface{}{
+			&messengertypes.InteractionTranslation{},
+			&messengertypes.QuoteSnapshot{},
+			&messengertypes.DeliveryReceipt{},
+			&messengertypes.InteractionEdit{},
+			&messengertypes.Bookmark{},
+			&messengertypes.ForwardedFrom{},
+			&messengertypes.InteractionMention{},
+			&messengertypes.GroupInvitationPreview{},
+		} {
+			if err := tx.db.Where("interaction_cid = ?", cid).Delete(model).Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+		}
+
+		if err := tx.db.Where("cid = ?", cid).Delete(&messengertypes.Interaction{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Where("cid = ?", cid).Delete(&messengertypes.MemberLocation{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		if err := tx.db.Model(&messengertypes.QuoteSnapshot{}).Where("target_cid = ?", cid).Pluck("interaction_cid", &replies).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(replies) == 0 {
+			return nil
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.QuoteSnapshot{}).
+			Where("target_cid = ?", cid).
+			Updates(map[string]interface{}{"excerpt": "", "target_missing": false, "target_retracted": true}).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	d.logStep("Retracted interaction in db", tyber.WithDetail("CID", cid))
+	return replies, nil
+}
@@ -0,0 +1,156 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// liveSessions restricts a query on the conversation sessions to the ones
+// which didn't expire at now, the session without id never expires
+func liveSessions(db *gorm.DB, now time.Time) *gorm.DB {
+	cutoff := messengerutil.TimestampMs(now.Add(-messengertypes.ConversationSessionTTL))
+	return db.Model(&messengertypes.ConversationSession{}).Where("session_id = \"\" OR heartbeat_date >= ?", cutoff)
+}
+
+// OpenConversationSession opens a session of a conversation or refreshes its
+// heartbeat, the conversation is opened along with its first session. It
+// returns the conversation and whether it was opened.
+func (d *DBWrapper) OpenConversationSession(convPK, sessionID string, now time.Time) (*messengertypes.Conversation, bool, error) {
+	if convPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	var (
+		conv   *messengertypes.Conversation
+		opened bool
+	)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		existing, err := tx.GetConversationByPK(convPK)
+		if err != nil {
+			return err
+		}
+
+		session := messengertypes.ConversationSession{
+			ConversationPublicKey: convPK,
+			SessionID:             sessionID,
+			DevicePublicKey:       existing.GetLocalDevicePublicKey(),
+			OpenedDate:            messengerutil.TimestampMs(now),
+			HeartbeatDate:         messengerutil.TimestampMs(now),
+		}
+
+		if err := tx.db.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "conversation_public_key"}, {Name: "session_id"}}, DoUpdates: clause.AssignmentColumns([]string{"heartbeat_date"})}).Create(&session).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		conv, opened, err = tx.SetConversationIsOpenStatus(convPK, true)
+		return err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	d.logStep("Opened conversation session in db", tyber.WithDetail("ConversationPublicKey", convPK), tyber.WithDetail("SessionID", sessionID))
+	return conv, opened, nil
+}
+
+// CloseConversationSession closes a session of a conversation, the
+// conversation is closed once none of its sessions is left. It returns the
+// conversation and whether it was closed.
+func (d *DBWrapper) CloseConversationSession(convPK, sessionID string, now time.Time) (*messengertypes.Conversation, bool, error) {
+	if convPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	var (
+		conv   *messengertypes.Conversation
+		closed bool
+	)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.Where("conversation_public_key = ? AND session_id = ?", convPK, sessionID).Delete(&messengertypes.ConversationSession{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		remaining := int64(0)
+		if err := liveSessions(tx.db, now).Where("conversation_public_key = ?", convPK).Count(&remaining).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		var err error
+		if remaining > 0 {
+			conv, err = tx.GetConversationByPK(convPK)
+			return err
+		}
+
+		conv, closed, err = tx.SetConversationIsOpenStatus(convPK, false)
+		return err
+	}); err != nil {
+		return nil, false, err
+	}
+
+	d.logStep("Closed conversation session in db", tyber.WithDetail("ConversationPublicKey", convPK), tyber.WithDetail("SessionID", sessionID))
+	return conv, closed, nil
+}
+
+// ExpireConversationSessions removes the sessions without heartbeat since
+// ConversationSessionTTL and closes the conversations left without session.
+// It returns the closed conversations.
+func (d *DBWrapper) ExpireConversationSessions(now time.Time) ([]*messengertypes.Conversation, error) {
+	closed := []*messengertypes.Conversation(nil)
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		cutoff := messengerutil.TimestampMs(now.Add(-messengertypes.ConversationSessionTTL))
+		convPKs := []string(nil)
+		if err := tx.db.
+			Model(&messengertypes.ConversationSession{}).
+			Where("session_id != \"\" AND heartbeat_date < ?", cutoff).
+			Distinct().
+			Pluck("conversation_public_key", &convPKs).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(convPKs) == 0 {
+			return nil
+		}
+
+		if err := tx.db.Where("session_id != \"\" AND heartbeat_date < ?", cutoff).Delete(&messengertypes.ConversationSession{}).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		for _, convPK := range convPKs {
+			remaining := int64(0)
+			if err := liveSessions(tx.db, now).Where("conversation_public_key = ?", convPK).Count(&remaining).Error; err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+
+			if remaining > 0 {
+				continue
+			}
+
+			conv, updated, err := tx.SetConversationIsOpenStatus(convPK, false)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			if updated {
+				closed = append(closed, conv)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return closed, nil
+}
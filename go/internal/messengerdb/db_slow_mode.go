@@ -0,0 +1,157 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// SetConversationSlowMode replaces the slow mode of a conversation unless a
+// more recent one is already known, the settings sent at the same date are
+// ordered by keeping the longest interval. It returns whether the slow mode
+// changed.
+func (d *DBWrapper) SetConversationSlowMode(convPK string, interval int64, date int64) (bool, error) {
+	if convPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	if interval < 0 {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the slow mode interval can't be negative"))
+	}
+
+	changed := false
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		conv := &messengertypes.Conversation{}
+		if err := tx.db.Select("slow_mode_interval", "slow_mode_date").First(conv, &messengertypes.Conversation{PublicKey: convPK}).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		switch {
+		case conv.GetSlowModeDate() > date:
+			return nil
+		case conv.GetSlowModeDate() == date && interval <= conv.GetSlowModeInterval():
+			return nil
+		}
+
+		if err := tx.db.
+			Model(&messengertypes.Conversation{}).
+			Where(&messengertypes.Conversation{PublicKey: convPK}).
+			Updates(map[string]interface{}{"slow_mode_interval": interval, "slow_mode_date": date}).
+			Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		changed = conv.GetSlowModeInterval() != interval
+		return nil
+	}); err != nil {
+		return false, err
+	}
+
+	if changed {
+		d.logStep("Updated conversation slow mode in db", tyber.WithDetail("ConversationPublicKey", convPK), tyber.WithDetail("Interval", fmt.Sprintf("%d", interval)))
+	}
+
+	return changed, nil
+}
+
+// IsConversationAdmin returns whether a member created a multi-member
+// conversation, the account is checked if isMe is set instead of memberPK
+func (d *DBWrapper) IsConversationAdmin(convPK string, memberPK string, isMe bool) (bool, error) {
+	if convPK == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	query := d.db.Model(&messengertypes.Member{}).Where("conversation_public_key = ? AND is_creator = ?", convPK, true)
+	switch {
+	case isMe:
+		query = query.Where("is_me = ?", true)
+	case memberPK != "":
+		query = query.Where("public_key = ?", memberPK)
+	default:
+		return false, nil
+	}
+
+	count := int64(0)
+	if err := query.Count(&count).Error; err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return count > 0, nil
+}
+
+// SlowModeWait returns how long, in ms, a member still has to wait at date
+// before sending a message in a conversation according to its slow mode, it
+// is 0 if the member can send it. The account is checked if isMe is set
+// instead of memberPK.
+func (d *DBWrapper) SlowModeWait(convPK string, memberPK string, isMe bool, date int64) (int64, error) {
+	conv := &messengertypes.Conversation{}
+	err := d.db.Select("type", "slow_mode_interval", "slow_mode_date").First(conv, &messengertypes.Conversation{PublicKey: convPK}).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if conv.GetType() != messengertypes.Conversation_MultiMemberType || conv.GetSlowModeInterval() == 0 || date < conv.GetSlowModeDate() {
+		return 0, nil
+	}
+
+	if admin, err := d.IsConversationAdmin(convPK, memberPK, isMe); err != nil || admin {
+		return 0, err
+	}
+
+	limited := []messengertypes.AppMessage_Type(nil)
+	for typ := range messengertypes.AppMessage_Type_name {
+		if messengerutil.IsSlowModeLimited(messengertypes.AppMessage_Type(typ)) {
+			limited = append(limited, messengertypes.AppMessage_Type(typ))
+		}
+	}
+
+	query := d.db.
+		Model(&messengertypes.Interaction{}).
+		Select("COALESCE(MAX(sent_date), 0)").
+		Where("conversation_public_key = ? AND type IN ? AND sent_date < ?", convPK, limited, date)
+	if isMe {
+		query = query.Where("is_mine = ?", true)
+	} else {
+		query = query.Where("member_public_key = ? AND is_mine = ?", memberPK, false)
+	}
+
+	last := int64(0)
+	if err := query.Scan(&last).Error; err != nil {
+		return 0, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if last == 0 {
+		return 0, nil
+	}
+
+	if wait := last + conv.GetSlowModeInterval()*1000 - date; wait > 0 {
+		return wait, nil
+	}
+
+	return 0, nil
+}
+
+// setInteractionSlowModeViolation flags the messages of other members sent
+// sooner than the slow mode of their conversation allows
+func (d *DBWrapper) setInteractionSlowModeViolation(i *messengertypes.Interaction) error {
+	if i.GetIsMine() || i.GetMemberPublicKey() == "" || i.GetSentDate() <= 0 || !messengerutil.IsSlowModeLimited(i.GetType()) {
+		return nil
+	}
+
+	wait, err := d.SlowModeWait(i.GetConversationPublicKey(), i.GetMemberPublicKey(), false, i.GetSentDate())
+	if err != nil {
+		return err
+	}
+
+	i.SlowModeViolation = wait > 0
+	return nil
+}
@@ -0,0 +1,135 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// ReuseStagedMedia renews a staged media, it returns gorm.ErrRecordNotFound if
+// cid isn't staged
+func (d *DBWrapper) ReuseStagedMedia(cid string, date int64) (*messengertypes.StagedMedia, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a media cid is required"))
+	}
+
+	staged := &messengertypes.StagedMedia{}
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.First(staged, &messengertypes.StagedMedia{CID: cid}).Error; err != nil {
+			return err
+		}
+
+		// the content may have been pruned from the cache meanwhile
+		if err := tx.db.First(&messengertypes.Media{}, &messengertypes.Media{CID: cid}).Error; err != nil {
+			return err
+		}
+
+		staged.StagedDate = date
+		if err := tx.db.Model(&messengertypes.StagedMedia{}).Where(&messengertypes.StagedMedia{CID: cid}).Update("staged_date", date).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return staged, nil
+}
+
+// AddStagedMedia stores the content and the thumbnail of a staged media,
+// thumbnail can be nil
+func (d *DBWrapper) AddStagedMedia(staged *messengertypes.StagedMedia, content *messengertypes.Media, thumbnail *messengertypes.Media) error {
+	if staged.GetCID() == "" || staged.GetCID() != content.GetCID() {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the staged media and its content must share their cid"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.AddMedia(content); err != nil {
+			return err
+		}
+
+		staged.ThumbnailCID = ""
+		if thumbnail != nil {
+			if err := tx.AddMedia(thumbnail); err != nil {
+				return err
+			}
+			staged.ThumbnailCID = thumbnail.GetCID()
+		}
+
+		if err := tx.db.Save(staged).Error; err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		tx.logStep("Staged media in db", tyber.WithDetail("CID", staged.GetCID()))
+		return nil
+	})
+}
+
+// DiscardStagedMedia removes a staged media along with its content and
+// thumbnail unless they are used elsewhere
+func (d *DBWrapper) DiscardStagedMedia(cid string) error {
+	if cid == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a media cid is required"))
+	}
+
+	return d.TX(d.ctx, func(tx *DBWrapper) error {
+		staged := &messengertypes.StagedMedia{}
+		err := tx.db.First(staged, &messengertypes.StagedMedia{CID: cid}).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown staged media: %s", cid))
+		} else if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return tx.deleteStagedMedias([]*messengertypes.StagedMedia{staged})
+	})
+}
+
+// PruneStagedMedias removes the medias staged before date which aren't
+// referenced by a draft, they were never sent. It returns the number of
+// removed medias.
+func (d *DBWrapper) PruneStagedMedias(date int64) (int64, error) {
+	staged := []*messengertypes.StagedMedia(nil)
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		if err := tx.db.
+			Where("staged_date < ? AND cid NOT IN (?)", date, tx.db.Model(&messengertypes.ConversationDraftMediaRef{}).Select("ref")).
+			Find(&staged).
+			Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if len(staged) == 0 {
+			return nil
+		}
+
+		return tx.deleteStagedMedias(staged)
+	}); err != nil {
+		return 0, err
+	}
+
+	d.logStep("Pruned staged medias", tyber.WithDetail("Removed", fmt.Sprintf("%d", len(staged))))
+	return int64(len(staged)), nil
+}
+
+func (d *DBWrapper) deleteStagedMedias(staged []*messengertypes.StagedMedia) error {
+	cids, medias := []string(nil), []string(nil)
+	for _, s := range staged {
+		cids = append(cids, s.GetCID())
+		medias = append(medias, s.GetCID())
+		if s.GetThumbnailCID() != "" {
+			medias = append(medias, s.GetThumbnailCID())
+		}
+	}
+
+	if err := d.db.Where("cid IN ?", cids).Delete(&messengertypes.StagedMedia{}).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return d.deleteUnusedMedias(medias)
+}
@@ -19,7 +19,7 @@ func keepAccountBoolField(db *gorm.DB, flagName string, defaultValue bool, logge
 	result := int64(0)
 	count := int64(0)
 
-	if err := db.Table("accounts").Count(&count).Order("ROWID").Limit(1).Pluck(flagName, &result).Error; err == nil {
+	if err := db.Table("accounts").Count(&count).Order(insertionOrder(db, "public_key")).Limit(1).Pluck(flagName, &result).Error; err == nil {
 		if count != 1 {
 			logger.Warn("expected one result", zap.Int64("count", count))
 		}
@@ -40,6 +40,21 @@ func keepAutoReplicateFlag(db *gorm.DB, logger *zap.Logger) bool {
 	return keepAccountBoolField(db, "replicate_new_groups_automatically", true, logger)
 }
 
+func keepPresenceVisibility(db *gorm.DB, logger *zap.Logger) messengertypes.Account_PresenceVisibility {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	result := int32(0)
+
+	if err := db.Table("accounts").Order(insertionOrder(db, "public_key")).Limit(1).Pluck("presence_visibility", &result).Error; err != nil {
+		logger.Warn("attempt at retrieving presence visibility failed", zap.Error(err))
+		return messengertypes.Account_PresenceVisibilityContacts
+	}
+
+	return messengertypes.Account_PresenceVisibility(result)
+}
+
 func keepConversationsLocalData(db *gorm.DB, logger *zap.Logger) []*messengertypes.LocalConversationState {
 	if logger == nil {
 		logger = zap.NewNop()
@@ -66,7 +81,7 @@ func keepAccountStringField(db *gorm.DB, field string, logger *zap.Logger) strin
 	result := ""
 	count := int64(0)
 
-	if err := db.Table("accounts").Count(&count).Order("ROWID").Limit(1).Pluck(field, &result).Error; err == nil {
+	if err := db.Table("accounts").Count(&count).Order(insertionOrder(db, "public_key")).Limit(1).Pluck(field, &result).Error; err == nil {
 		if count != 1 {
 			logger.Warn("expected one result", zap.Int64("count", count))
 		}
@@ -83,13 +98,44 @@ func keepAccountStringField(db *gorm.DB, field string, logger *zap.Logger) strin
 	return ""
 }
 
+func keepAccountProfileLinks(db *gorm.DB, accountPK string, logger *zap.Logger) []string {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if accountPK == "" {
+		return nil
+	}
+
+	result := []string(nil)
+
+	err := db.Table("profile_links").
+		Where("owner_public_key = ? AND conversation_public_key = ?", accountPK, "").
+		Order("position ASC").
+		Pluck("url", &result).Error
+
+	if err == nil {
+		return result
+	}
+
+	logger.Warn("attempt at retrieving profile links failed", zap.Error(err))
+
+	return nil
+}
+
 func keepDatabaseLocalState(db *gorm.DB, logger *zap.Logger) *messengertypes.LocalDatabaseState {
+	accountPK := keepAccountStringField(db, "public_key", logger)
+
 	return &messengertypes.LocalDatabaseState{
-		PublicKey:               keepAccountStringField(db, "public_key", logger),
+		PublicKey:               accountPK,
 		DisplayName:             keepDisplayName(db, logger),
 		ReplicateFlag:           keepAutoReplicateFlag(db, logger),
 		LocalConversationsState: keepConversationsLocalData(db, logger),
 		AccountLink:             keepAccountStringField(db, "link", logger),
 		AutoSharePushTokenFlag:  keepAccountBoolField(db, "auto_share_push_token_flag", true, logger),
+		AvatarCID:               keepAccountStringField(db, "avatar_cid", logger),
+		Bio:                     keepAccountStringField(db, "bio", logger),
+		Links:                   keepAccountProfileLinks(db, accountPK, logger),
+		PresenceVisibility:      keepPresenceVisibility(db, logger),
 	}
 }
@@ -0,0 +1,54 @@
+package messengerdb
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetAccountSummary returns the unread counters of the conversations which
+// aren't muted, the top of them most recently updated first, and the number
+// of incoming contact requests
+func (d *DBWrapper) GetAccountSummary(top int) (*messengertypes.AccountSummary, error) {
+	if top < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid number of conversations: %d", top))
+	}
+
+	// muted_until is compared the way GetMuteStatusForConversation does
+	now := time.Now()
+	unmuted := func() *gorm.DB {
+		return d.db.Model(&messengertypes.Conversation{}).Where("unread_count > 0 AND muted_until <= ?", now.UnixNano()/1000)
+	}
+
+	summary := &messengertypes.AccountSummary{GeneratedDate: messengerutil.TimestampMs(now)}
+	if err := unmuted().Select("COALESCE(SUM(unread_count), 0)").Scan(&summary.TotalUnread).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if top > 0 {
+		conversations := []*messengertypes.Conversation(nil)
+		if err := unmuted().Order("last_update DESC").Limit(top).Find(&conversations).Error; err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		for _, c := range conversations {
+			summary.TopUnreadConversations = append(summary.TopUnreadConversations, &messengertypes.AccountSummary_UnreadConversation{
+				PublicKey:   c.GetPublicKey(),
+				DisplayName: c.GetDisplayName(),
+				UnreadCount: c.GetUnreadCount(),
+				LastUpdate:  c.GetLastUpdate(),
+			})
+		}
+	}
+
+	if err := d.db.Model(&messengertypes.Contact{}).Where(&messengertypes.Contact{State: messengertypes.Contact_IncomingRequest}).Count(&summary.PendingContactRequests).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return summary, nil
+}
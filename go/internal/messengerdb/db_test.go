@@ -3,12 +3,17 @@ package messengerdb
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gogo/protobuf/proto"
 	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 	"golang.org/x/net/context"
 	"gorm.io/gorm"
 
@@ -493,7 +498,7 @@ func Test_dbWrapper_addMember(t *testing.T) {
 	require.True(t, member.IsMe)
 }
 
-func Test_dbWrapper_attributeBacklogInteractions(t *testing.T) {
+func Test_BacklogManager_Attribute(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
 
@@ -512,26 +517,33 @@ func Test_dbWrapper_attributeBacklogInteractions(t *testing.T) {
 	db.db.Create(&messengertypes.Interaction{CID: "Qm212", DevicePublicKey: "device1", ConversationPublicKey: "conv3"})
 	db.db.Create(&messengertypes.Interaction{CID: "Qm213", DevicePublicKey: "device2", ConversationPublicKey: "conv2"})
 
-	interactions, err := db.AttributeBacklogInteractions("", "conv3", "member1")
+	// the interactions were stored without member by a version without backlog
+	require.NoError(t, db.migrateLegacyBacklog(time.Now()))
+	require.NoError(t, db.migrateLegacyBacklog(time.Now()))
+	count, err := db.dbModelRowsCount(messengertypes.BacklogEntry{})
+	require.NoError(t, err)
+	require.Equal(t, int64(14), count)
+
+	interactions, err := db.Backlog().Attribute("", "conv3", "member1")
 	require.Error(t, err)
 	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
 	require.Empty(t, interactions)
 
-	interactions, err = db.AttributeBacklogInteractions("device3", "", "member1")
+	interactions, err = db.Backlog().Attribute("device3", "", "member1")
 	require.Error(t, err)
 	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
 	require.Empty(t, interactions)
 
-	interactions, err = db.AttributeBacklogInteractions("device3", "conv3", "")
+	interactions, err = db.Backlog().Attribute("device3", "conv3", "")
 	require.Error(t, err)
 	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
 	require.Empty(t, interactions)
 
-	interactions, err = db.AttributeBacklogInteractions("device3", "conv3", "member1")
+	interactions, err = db.Backlog().Attribute("device3", "conv3", "member1")
 	require.NoError(t, err)
 	require.Empty(t, interactions)
 
-	interactions, err = db.AttributeBacklogInteractions("device1", "conv1", "member1")
+	interactions, err = db.Backlog().Attribute("device1", "conv1", "member1")
 	require.NoError(t, err)
 	require.Len(t, interactions, 3)
 	require.Equal(t, "member1", interactions[0].MemberPublicKey)
@@ -541,9 +553,78 @@ func Test_dbWrapper_attributeBacklogInteractions(t *testing.T) {
 	require.Equal(t, "Qm104", interactions[1].CID)
 	require.Equal(t, "Qm108", interactions[2].CID)
 
-	interactions, err = db.AttributeBacklogInteractions("device1", "conv1", "member1")
+	interactions, err = db.Backlog().Attribute("device1", "conv1", "member1")
 	require.NoError(t, err)
 	require.Empty(t, interactions)
+
+	count, err = db.dbModelRowsCount(messengertypes.BacklogEntry{})
+	require.NoError(t, err)
+	require.Equal(t, int64(11), count)
+}
+
+func Test_BacklogManager_AddAndPrune(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	now := time.Now()
+	backlog := &BacklogManager{db: db, maxEntriesPerDevice: 2, ttl: time.Hour}
+
+	_, err := backlog.Add(&messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1"}, now)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	// only the interactions stored without member are backlogged
+	db.db.Create(&messengertypes.Interaction{CID: "attributed", DevicePublicKey: "device1", MemberPublicKey: "member1", ConversationPublicKey: "conv1"})
+	evicted, err := backlog.Add(&messengertypes.Interaction{CID: "attributed", DevicePublicKey: "device1", ConversationPublicKey: "conv1"}, now)
+	require.NoError(t, err)
+	require.Empty(t, evicted)
+	evicted, err = backlog.Add(&messengertypes.Interaction{CID: "unknown", DevicePublicKey: "device1", ConversationPublicKey: "conv1"}, now)
+	require.NoError(t, err)
+	require.Empty(t, evicted)
+
+	for i := 1; i <= 3; i++ {
+		inte := &messengertypes.Interaction{CID: fmt.Sprintf("cid%d", i), DevicePublicKey: "device1", ConversationPublicKey: "conv1"}
+		db.db.Create(inte)
+
+		evicted, err = backlog.Add(inte, now.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, err)
+
+		// adding it again changes nothing
+		again, err := backlog.Add(inte, now.Add(time.Duration(i)*time.Minute))
+		require.NoError(t, err)
+		require.Empty(t, again)
+	}
+
+	// the oldest interaction is dropped from the full backlog
+	require.Len(t, evicted, 1)
+	require.Equal(t, "cid1", evicted[0].GetCID())
+	require.Equal(t, "conv1", evicted[0].GetConversationPublicKey())
+	_, err = db.GetInteractionByCID("cid1")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// the backlogs are per device
+	db.db.Create(&messengertypes.Interaction{CID: "cid4", DevicePublicKey: "device2", ConversationPublicKey: "conv1"})
+	evicted, err = backlog.Add(&messengertypes.Interaction{CID: "cid4", DevicePublicKey: "device2", ConversationPublicKey: "conv1"}, now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, evicted)
+
+	// the backlogged interactions are kept by the local retention
+	pruned, err := db.PruneInteractionsBefore(messengerutil.TimestampMs(now.Add(24 * time.Hour)))
+	require.NoError(t, err)
+	require.Empty(t, pruned)
+
+	pruned, err = backlog.Prune(now.Add(90 * time.Minute))
+	require.NoError(t, err)
+	require.Len(t, pruned, 2)
+	require.ElementsMatch(t, []string{"cid2", "cid3"}, []string{pruned[0].GetCID(), pruned[1].GetCID()})
+
+	interactions, err := backlog.Attribute("device2", "conv1", "member2")
+	require.NoError(t, err)
+	require.Len(t, interactions, 1)
+	require.Equal(t, "member2", interactions[0].GetMemberPublicKey())
+
+	count, err := db.dbModelRowsCount(messengertypes.BacklogEntry{})
+	require.NoError(t, err)
+	require.Equal(t, int64(0), count)
 }
 
 func Test_dbWrapper_dbModelRowsCount(t *testing.T) {
@@ -1018,6 +1099,130 @@ func Test_dbWrapper_getDBInfo(t *testing.T) {
 		})
 	}
 
+	for i := 0; i < 12; i++ {
+		db.db.Create(&messengertypes.OutboxEvent{Type: messengertypes.StreamEvent_TypeConversationUpdated})
+	}
+
+	for i := 0; i < 13; i++ {
+		db.db.Create(&messengertypes.Media{CID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 14; i++ {
+		db.db.Create(&messengertypes.ProfileLink{OwnerPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 15; i++ {
+		db.db.Create(&messengertypes.DirectoryServiceRecord{Identifier: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 16; i++ {
+		db.db.Create(&messengertypes.Call{CallID: fmt.Sprintf("%d", i), ConversationPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 17; i++ {
+		db.db.Create(&messengertypes.BroadcastList{ID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 18; i++ {
+		db.db.Create(&messengertypes.Broadcast{ID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 19; i++ {
+		db.db.Create(&messengertypes.InteractionTranslation{InteractionCID: fmt.Sprintf("%d", i), Language: "fr"})
+	}
+
+	for i := 0; i < 20; i++ {
+		db.db.Create(&messengertypes.QuoteSnapshot{InteractionCID: fmt.Sprintf("%d", i), TargetCID: "target"})
+	}
+
+	for i := 0; i < 21; i++ {
+		db.db.Create(&messengertypes.DeliveryReceipt{InteractionCID: "cid", DevicePublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 22; i++ {
+		db.db.Create(&messengertypes.QueuedMessage{CID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 23; i++ {
+		db.db.Create(&messengertypes.Bookmark{InteractionCID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 24; i++ {
+		db.db.Create(&messengertypes.InteractionEdit{CID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 25; i++ {
+		db.db.Create(&messengertypes.ReadMarker{ConversationPublicKey: "conv", MemberPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 26; i++ {
+		db.db.Create(&messengertypes.PinnedMessage{InteractionCID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 27; i++ {
+		db.db.Create(&messengertypes.ConversationSession{ConversationPublicKey: "conv", SessionID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 28; i++ {
+		db.db.Create(&messengertypes.PollVote{PollCID: "poll", MemberPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 29; i++ {
+		db.db.Create(&messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 30; i++ {
+		db.db.Create(&messengertypes.ForwardedFrom{InteractionCID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 31; i++ {
+		db.db.Create(&messengertypes.MissingInteraction{CID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 32; i++ {
+		db.db.Create(&messengertypes.InteractionMention{InteractionCID: "cid", MemberPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 33; i++ {
+		db.db.Create(&messengertypes.LinkPreview{URL: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 34; i++ {
+		db.db.Create(&messengertypes.CalendarEventRSVP{EventCID: "event", MemberPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 35; i++ {
+		db.db.Create(&messengertypes.ConversationDraft{ConversationPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 36; i++ {
+		db.db.Create(&messengertypes.ConversationDraftMediaRef{ConversationPublicKey: "conv", Position: int32(i)})
+	}
+
+	for i := 0; i < 37; i++ {
+		db.db.Create(&messengertypes.FeatureFlag{Name: messengertypes.FeatureFlag_Name(i + 1)})
+	}
+
+	for i := 0; i < 38; i++ {
+		db.db.Create(&messengertypes.StagedMedia{CID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 39; i++ {
+		db.db.Create(&messengertypes.BacklogEntry{InteractionCID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 40; i++ {
+		db.db.Create(&messengertypes.GroupInvitationPreview{InteractionCID: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 41; i++ {
+		db.db.Create(&messengertypes.ReplayCheckpoint{GroupPublicKey: fmt.Sprintf("%d", i)})
+	}
+
+	for i := 0; i < 42; i++ {
+		db.db.Create(&messengertypes.DeviceKeyEvent{DevicePublicKey: fmt.Sprintf("%d", i)})
+	}
+
 	info, err = db.GetDBInfo()
 	require.NoError(t, err)
 	require.Equal(t, int64(1), info.Accounts)
@@ -1030,12 +1235,43 @@ func Test_dbWrapper_getDBInfo(t *testing.T) {
 	require.Equal(t, int64(8), info.ConversationReplicationInfo)
 	require.Equal(t, int64(10), info.MetadataEvents)
 	require.Equal(t, int64(11), info.SharedPushTokens)
+	require.Equal(t, int64(12), info.OutboxEvents)
+	require.Equal(t, int64(13), info.Medias)
+	require.Equal(t, int64(14), info.ProfileLinks)
+	require.Equal(t, int64(15), info.DirectoryServiceRecords)
+	require.Equal(t, int64(16), info.Calls)
+	require.Equal(t, int64(17), info.BroadcastLists)
+	require.Equal(t, int64(18), info.Broadcasts)
+	require.Equal(t, int64(19), info.InteractionTranslations)
+	require.Equal(t, int64(20), info.QuoteSnapshots)
+	require.Equal(t, int64(21), info.DeliveryReceipts)
+	require.Equal(t, int64(22), info.QueuedMessages)
+	require.Equal(t, int64(23), info.Bookmarks)
+	require.Equal(t, int64(24), info.InteractionEdits)
+	require.Equal(t, int64(25), info.ReadMarkers)
+	require.Equal(t, int64(26), info.PinnedMessages)
+	require.Equal(t, int64(27), info.ConversationSessions)
+	require.Equal(t, int64(28), info.PollVotes)
+	require.Equal(t, int64(29), info.MemberLocations)
+	require.Equal(t, int64(30), info.ForwardedMessages)
+	require.Equal(t, int64(31), info.MissingInteractions)
+	require.Equal(t, int64(32), info.Mentions)
+	require.Equal(t, int64(33), info.LinkPreviews)
+	require.Equal(t, int64(34), info.CalendarEventRSVPs)
+	require.Equal(t, int64(35), info.ConversationDrafts)
+	require.Equal(t, int64(36), info.ConversationDraftMediaRefs)
+	require.Equal(t, int64(37), info.FeatureFlags)
+	require.Equal(t, int64(38), info.StagedMedias)
+	require.Equal(t, int64(39), info.BacklogEntries)
+	require.Equal(t, int64(40), info.GroupInvitationPreviews)
+	require.Equal(t, int64(41), info.ReplayCheckpoints)
+	require.Equal(t, int64(42), info.DeviceKeyEvents)
 
 	// Ensure all tables are in the debug data
 	tables := []string(nil)
-	err = db.db.Raw("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE '%_fts%'").Scan(&tables).Error
+	err = db.db.Raw("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE '%\\_fts%' ESCAPE '\\'").Scan(&tables).Error
 	require.NoError(t, err)
-	expectedTablesCount := 10
+	expectedTablesCount := 43
 	require.Equal(t, expectedTablesCount, len(tables), fmt.Sprintf("expected %d tables in DB, got tables %s", expectedTablesCount, strings.Join(tables, ", ")))
 }
 
@@ -1138,7 +1374,7 @@ func Test_dbWrapper_setConversationIsOpenStatus(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, updated)
 
-	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Where(&messengertypes.Conversation{PublicKey: "conv1"}).First(&c)
+	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Preload("ReadMarkers").Where(&messengertypes.Conversation{PublicKey: "conv1"}).First(&c)
 	require.Equal(t, "conv1", c.PublicKey)
 	require.True(t, c.IsOpen)
 	require.Equal(t, int32(0), c.UnreadCount)
@@ -1148,14 +1384,14 @@ func Test_dbWrapper_setConversationIsOpenStatus(t *testing.T) {
 	require.True(t, updated)
 
 	c = &messengertypes.Conversation{}
-	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Where(&messengertypes.Conversation{PublicKey: "conv1"}).First(&c)
+	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Preload("ReadMarkers").Where(&messengertypes.Conversation{PublicKey: "conv1"}).First(&c)
 	require.Equal(t, "conv1", c.PublicKey)
 	require.False(t, c.IsOpen)
 	require.Equal(t, int32(0), c.UnreadCount)
 	require.Equal(t, c, conv)
 
 	c = &messengertypes.Conversation{}
-	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Where(&messengertypes.Conversation{PublicKey: "conv2"}).First(&c)
+	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Preload("ReadMarkers").Where(&messengertypes.Conversation{PublicKey: "conv2"}).First(&c)
 	require.Equal(t, "conv2", c.PublicKey)
 	require.False(t, c.IsOpen)
 	require.Equal(t, int32(1000), c.UnreadCount)
@@ -1165,13 +1401,280 @@ func Test_dbWrapper_setConversationIsOpenStatus(t *testing.T) {
 	require.True(t, updated)
 
 	c = &messengertypes.Conversation{}
-	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Where(&messengertypes.Conversation{PublicKey: "conv2"}).First(&c)
+	db.db.Model(&messengertypes.Conversation{}).Preload("ReplicationInfo").Preload("ReadMarkers").Where(&messengertypes.Conversation{PublicKey: "conv2"}).First(&c)
 	require.Equal(t, "conv2", c.PublicKey)
 	require.True(t, c.IsOpen)
 	require.Equal(t, int32(0), c.UnreadCount)
 	require.Equal(t, c, conv)
 }
 
+func Test_dbWrapper_RecomputeUnreadCounts(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.RecomputeUnreadCounts("conv_xxx")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv1", UnreadCount: 5, LastReadDate: 10})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv2", IsOpen: true, UnreadCount: 3})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv3", UnreadCount: 1})
+
+	db.db.Create(&messengertypes.Interaction{CID: "read", ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 5})
+	db.db.Create(&messengertypes.Interaction{CID: "unread", ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 15})
+	db.db.Create(&messengertypes.Interaction{CID: "mine", ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 15, IsMine: true})
+	db.db.Create(&messengertypes.Interaction{CID: "invisible", ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeSetUserInfo, SentDate: 15})
+	db.db.Create(&messengertypes.Interaction{CID: "open", ConversationPublicKey: "conv2", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 15})
+	db.db.Create(&messengertypes.Interaction{CID: "accurate", ConversationPublicKey: "conv3", Type: messengertypes.AppMessage_TypeGroupInvitation, SentDate: 15})
+
+	updated, err := db.RecomputeUnreadCounts("conv1")
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	require.Equal(t, "conv1", updated[0].PublicKey)
+	require.Equal(t, int32(1), updated[0].UnreadCount)
+
+	// conv1 is already repaired and conv3 is accurate
+	updated, err = db.RecomputeUnreadCounts("")
+	require.NoError(t, err)
+	require.Len(t, updated, 1)
+	require.Equal(t, "conv2", updated[0].PublicKey)
+	require.Equal(t, int32(0), updated[0].UnreadCount)
+}
+
+func Test_dbWrapper_MergeConversations(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	db.db.Create(&messengertypes.Contact{PublicKey: "contact1", ConversationPublicKey: "conv1"})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv1", Type: messengertypes.Conversation_ContactType, ContactPublicKey: "contact1", CreatedDate: 2, UnreadCount: 1})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv2", Type: messengertypes.Conversation_ContactType, ContactPublicKey: "contact1", CreatedDate: 1, UnreadCount: 2, AutoTranslateLanguage: "fr", FocusedUntil: 50, LanguageHint: "fr"})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv3", Type: messengertypes.Conversation_ContactType, ContactPublicKey: "contact2"})
+
+	db.db.Create(&messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1"})
+	db.db.Create(&messengertypes.Interaction{CID: "cid2", ConversationPublicKey: "conv2"})
+	db.db.Create(&messengertypes.Member{PublicKey: "member1", ConversationPublicKey: "conv1", DisplayName: "kept"})
+	db.db.Create(&messengertypes.Member{PublicKey: "member1", ConversationPublicKey: "conv2", DisplayName: "dropped"})
+	db.db.Create(&messengertypes.Member{PublicKey: "member2", ConversationPublicKey: "conv2"})
+	db.db.Create(&messengertypes.ConversationDraft{ConversationPublicKey: "conv2", Body: "draft"})
+	db.db.Create(&messengertypes.ConversationDraftMediaRef{ConversationPublicKey: "conv2", Ref: "media"})
+
+	duplicates, err := db.GetDuplicateConversations()
+	require.NoError(t, err)
+	require.Len(t, duplicates, 1)
+	require.Equal(t, "contact1", duplicates[0].ContactPublicKey)
+	require.Equal(t, "conv1", duplicates[0].ConversationPublicKey)
+	require.Equal(t, []string{"conv2"}, duplicates[0].DuplicatePublicKeys)
+
+	_, err = db.MergeConversations("conv1", "conv3")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	conv, err := db.MergeConversations("conv1", "conv2")
+	require.NoError(t, err)
+	require.Equal(t, int32(3), conv.UnreadCount)
+	require.Equal(t, int64(1), conv.CreatedDate)
+	require.Equal(t, "fr", conv.AutoTranslateLanguage)
+	require.Equal(t, int64(50), conv.FocusedUntil)
+	require.Equal(t, "fr", conv.LanguageHint)
+
+	// the duplicate draft is moved as the kept conversation has none
+	draft, err := db.GetConversationDraft("conv1")
+	require.NoError(t, err)
+	require.Equal(t, "draft", draft.Body)
+	require.Len(t, draft.MediaRefs, 1)
+
+	_, err = db.GetConversationByPK("conv2")
+	require.Error(t, err)
+
+	i, err := db.GetInteractionByCID("cid2")
+	require.NoError(t, err)
+	require.Equal(t, "conv1", i.ConversationPublicKey)
+
+	members, err := db.GetAllMembers()
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+
+	member, err := db.GetMemberByPK("member1", "conv1")
+	require.NoError(t, err)
+	require.Equal(t, "kept", member.DisplayName)
+
+	duplicates, err = db.GetDuplicateConversations()
+	require.NoError(t, err)
+	require.Empty(t, duplicates)
+}
+
+func Test_dbWrapper_GroupInvitations(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	db.db.Create(&messengertypes.Interaction{CID: "second", ConversationPublicKey: "conv1", SentDate: 2, GroupInvitationPreview: &messengertypes.GroupInvitationPreview{GroupPublicKey: "group1"}})
+	db.db.Create(&messengertypes.Interaction{CID: "first", ConversationPublicKey: "conv2", SentDate: 1, GroupInvitationPreview: &messengertypes.GroupInvitationPreview{GroupPublicKey: "group1"}})
+	db.db.Create(&messengertypes.Interaction{CID: "other", ConversationPublicKey: "conv1", SentDate: 3, GroupInvitationPreview: &messengertypes.GroupInvitationPreview{GroupPublicKey: "group2"}})
+
+	_, err := db.FirstGroupInvitationCID("", "")
+	require.Error(t, err)
+
+	cid, err := db.FirstGroupInvitationCID("group1", "second")
+	require.NoError(t, err)
+	require.Equal(t, "first", cid)
+
+	cid, err = db.FirstGroupInvitationCID("group1", "first")
+	require.NoError(t, err)
+	require.Equal(t, "second", cid)
+
+	cid, err = db.FirstGroupInvitationCID("group2", "other")
+	require.NoError(t, err)
+	require.Empty(t, cid)
+
+	_, err = db.SetGroupInvitationsJoined("", true)
+	require.Error(t, err)
+
+	db.db.Create(&messengertypes.Member{PublicKey: "member1", ConversationPublicKey: "group1"})
+	cids, err := db.SetGroupInvitationsJoined("group1", true)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"first", "second"}, cids)
+
+	inte, err := db.GetInteractionByCID("first")
+	require.NoError(t, err)
+	require.True(t, inte.GetGroupInvitationPreview().GetJoined())
+	require.Equal(t, int32(1), inte.GetGroupInvitationPreview().GetMemberCount())
+
+	// only the invitations changed are returned
+	cids, err = db.SetGroupInvitationsJoined("group1", true)
+	require.NoError(t, err)
+	require.Empty(t, cids)
+
+	cids, err = db.SetGroupInvitationsJoined("group1", false)
+	require.NoError(t, err)
+	require.Len(t, cids, 2)
+
+	inte, err = db.GetInteractionByCID("second")
+	require.NoError(t, err)
+	require.False(t, inte.GetGroupInvitationPreview().GetJoined())
+	require.Zero(t, inte.GetGroupInvitationPreview().GetMemberCount())
+
+	inte, err = db.GetInteractionByCID("other")
+	require.NoError(t, err)
+	require.False(t, inte.GetGroupInvitationPreview().GetJoined())
+}
+
+func Test_dbWrapper_ReplayCheckpoints(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetReplayCheckpoint("")
+	require.Error(t, err)
+
+	checkpoint, err := db.GetReplayCheckpoint("group1")
+	require.NoError(t, err)
+	require.Equal(t, "group1", checkpoint.GetGroupPublicKey())
+	require.Nil(t, checkpoint.GetMetadataEventID())
+	require.Nil(t, checkpoint.GetMessageEventID())
+
+	require.Error(t, db.SetReplayMetadataCheckpoint("", []byte("meta1"), 1))
+	require.Error(t, db.SetReplayMessageCheckpoint("group1", nil, 1))
+
+	// each stream moves its own cursor
+	require.NoError(t, db.SetReplayMetadataCheckpoint("group1", []byte("meta1"), 1))
+	require.NoError(t, db.SetReplayMessageCheckpoint("group1", []byte("msg1"), 2))
+	require.NoError(t, db.SetReplayMetadataCheckpoint("group1", []byte("meta2"), 3))
+	require.NoError(t, db.SetReplayMessageCheckpoint("group2", []byte("msg1"), 4))
+
+	checkpoint, err = db.GetReplayCheckpoint("group1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("meta2"), checkpoint.GetMetadataEventID())
+	require.Equal(t, []byte("msg1"), checkpoint.GetMessageEventID())
+	require.Equal(t, int64(3), checkpoint.GetUpdatedDate())
+
+	require.NoError(t, db.DeleteReplayCheckpoints("group1"))
+	checkpoint, err = db.GetReplayCheckpoint("group1")
+	require.NoError(t, err)
+	require.Nil(t, checkpoint.GetMetadataEventID())
+
+	checkpoint, err = db.GetReplayCheckpoint("group2")
+	require.NoError(t, err)
+	require.Equal(t, []byte("msg1"), checkpoint.GetMessageEventID())
+
+	require.NoError(t, db.DeleteReplayCheckpoints(""))
+	count, err := db.dbModelRowsCount(messengertypes.ReplayCheckpoint{})
+	require.NoError(t, err)
+	require.Zero(t, count)
+}
+
+func Test_dbWrapper_PruneInteractionsBefore(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	db.db.Create(&messengertypes.Interaction{CID: "old", ConversationPublicKey: "conv1", MemberPublicKey: "member1", SentDate: 5})
+	db.db.Create(&messengertypes.Interaction{CID: "recent", ConversationPublicKey: "conv1", MemberPublicKey: "member1", SentDate: 15})
+	db.db.Create(&messengertypes.Interaction{CID: "backlog", ConversationPublicKey: "conv1", SentDate: 5})
+	db.db.Create(&messengertypes.BacklogEntry{InteractionCID: "backlog", ConversationPublicKey: "conv1", DevicePublicKey: "device1"})
+	db.db.Create(&messengertypes.Interaction{CID: "bookmarked", ConversationPublicKey: "conv1", MemberPublicKey: "member1", SentDate: 5})
+	db.db.Create(&messengertypes.Bookmark{InteractionCID: "bookmarked", ConversationPublicKey: "conv1"})
+	db.db.Create(&messengertypes.Interaction{CID: "pinned", ConversationPublicKey: "conv1", MemberPublicKey: "member1", SentDate: 5})
+	db.db.Create(&messengertypes.PinnedMessage{InteractionCID: "pinned", ConversationPublicKey: "conv1"})
+	db.db.Create(&messengertypes.DeliveryReceipt{InteractionCID: "old", DevicePublicKey: "device1"})
+
+	pruned, err := db.PruneInteractionsBefore(10)
+	require.NoError(t, err)
+	require.Len(t, pruned, 1)
+	require.Equal(t, "old", pruned[0].CID)
+	require.Equal(t, "conv1", pruned[0].ConversationPublicKey)
+
+	_, err = db.GetInteractionByCID("old")
+	require.Error(t, err)
+	_, err = db.GetInteractionByCID("recent")
+	require.NoError(t, err)
+	_, err = db.GetInteractionByCID("backlog")
+	require.NoError(t, err)
+	_, err = db.GetInteractionByCID("bookmarked")
+	require.NoError(t, err)
+	_, err = db.GetInteractionByCID("pinned")
+	require.NoError(t, err)
+
+	count := int64(0)
+	require.NoError(t, db.db.Model(&messengertypes.DeliveryReceipt{}).Count(&count).Error)
+	require.Equal(t, int64(0), count)
+
+	require.NoError(t, db.FirstOrCreateAccount("account", ""))
+	require.NoError(t, db.UpdateAccountFields(map[string]interface{}{"avatar_cid": "avatar"}))
+	db.db.Create(&messengertypes.Media{CID: "avatar", LastUsedDate: 5})
+	db.db.Create(&messengertypes.Media{CID: "unused", LastUsedDate: 5})
+	db.db.Create(&messengertypes.Media{CID: "used", LastUsedDate: 15})
+
+	removed, err := db.PruneMediasUnusedSince(10)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+}
+
+func Test_dbWrapper_QueuedInteractions(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.EnqueueInteraction(messengertypes.Interaction{CID: "queued1", ConversationPublicKey: "conv1"}, nil)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	i, err := db.EnqueueInteraction(messengertypes.Interaction{CID: "queued2", ConversationPublicKey: "conv1", IsMine: true, SentDate: 2}, []byte("second"))
+	require.NoError(t, err)
+	require.Equal(t, messengertypes.Interaction_DeliveryStateQueued, i.DeliveryState)
+
+	_, err = db.EnqueueInteraction(messengertypes.Interaction{CID: "queued1", ConversationPublicKey: "conv1", IsMine: true, SentDate: 1}, []byte("first"))
+	require.NoError(t, err)
+
+	queued, err := db.GetQueuedMessages()
+	require.NoError(t, err)
+	require.Len(t, queued, 2)
+	require.Equal(t, "queued1", queued[0].CID)
+	require.Equal(t, []byte("first"), queued[0].Payload)
+
+	require.NoError(t, db.DequeueInteraction("queued1"))
+
+	queued, err = db.GetQueuedMessages()
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+
+	_, err = db.GetInteractionByCID("queued1")
+	require.Error(t, err)
+}
+
 func Test_dbWrapper_tx(t *testing.T) {
 	ctx := context.TODO()
 
@@ -1280,6 +1783,19 @@ func Test_isSQLiteError(t *testing.T) {
 	require.True(t, isSQLiteError(sqlite3.Error{Code: sqlite3.ErrConstraint}, sqlite3.ErrConstraint))
 }
 
+type sqlStateError string
+
+func (e sqlStateError) Error() string    { return "sqlstate " + string(e) }
+func (e sqlStateError) SQLState() string { return string(e) }
+
+func Test_isConstraintError(t *testing.T) {
+	require.False(t, isConstraintError(nil))
+	require.False(t, isConstraintError(fmt.Errorf("err")))
+	require.True(t, isConstraintError(sqlite3.Error{Code: sqlite3.ErrConstraint}))
+	require.True(t, isConstraintError(fmt.Errorf("err: %w", sqlStateError("23505"))))
+	require.False(t, isConstraintError(sqlStateError("40001")))
+}
+
 func Test_dbWrapper_isConversationOpened(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -1459,6 +1975,54 @@ func Test_dbWrapper_getLatestInteractionAndMediaPerConversation_sorting(t *testi
 	require.Equal(t, "c1_i99", interactions[2].CID)
 }
 
+func Test_dbWrapper_getPaginatedInteractions_filters(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "c1"}).Error)
+
+	for i := 0; i < 20; i++ {
+		typ, member := messengertypes.AppMessage_TypeUserMessage, "m1"
+		if i%2 == 1 {
+			typ = messengertypes.AppMessage_TypeGroupInvitation
+		}
+		if i%4 >= 2 {
+			member = "m2"
+		}
+
+		require.NoError(t, db.db.Create(&messengertypes.Interaction{
+			CID:                   fmt.Sprintf("c1_i%02d", i),
+			ConversationPublicKey: "c1",
+			Type:                  typ,
+			MemberPublicKey:       member,
+			SentDate:              int64(1000 + i),
+		}).Error)
+	}
+
+	cidsOf := func(interactions []*messengertypes.Interaction) []string {
+		cids := make([]string, len(interactions))
+		for i, inte := range interactions {
+			cids[i] = inte.CID
+		}
+		return cids
+	}
+
+	interactions, err := db.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{ConversationPK: "c1", Amount: 3, Types: []messengertypes.AppMessage_Type{messengertypes.AppMessage_TypeGroupInvitation}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c1_i19", "c1_i17", "c1_i15"}, cidsOf(interactions))
+
+	interactions, err = db.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{ConversationPK: "c1", Amount: 3, RefCID: "c1_i15", Types: []messengertypes.AppMessage_Type{messengertypes.AppMessage_TypeGroupInvitation}, MemberPublicKey: "m2"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c1_i11", "c1_i07", "c1_i03"}, cidsOf(interactions))
+
+	interactions, err = db.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{ConversationPK: "c1", Amount: 10, OldestToNewest: true, SentAfter: 1004, SentBefore: 1008})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c1_i05", "c1_i06", "c1_i07"}, cidsOf(interactions))
+
+	_, err = db.GetPaginatedInteractions(&messengertypes.PaginatedInteractionsOptions{ConversationPK: "c1", SentAfter: 1008, SentBefore: 1004})
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+}
+
 func Test_dbWrapper_interactionIndexText_interactionsSearch(t *testing.T) {
 	db, _, dispose := GetInMemoryTestDB(t)
 	defer dispose()
@@ -1777,3 +2341,1944 @@ func Test_dbWrapper_GetPushTokenSharedForConversation(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, tokens, 2)
 }
+
+func Test_dbWrapper_OutboxEvents(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	events, err := db.GetOutboxEvents(10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	err = db.TX(context.Background(), func(tx *DBWrapper) error {
+		for i := 0; i < 3; i++ {
+			if _, err := tx.AddOutboxEvent(messengertypes.StreamEvent_TypeConversationUpdated, []byte(fmt.Sprintf("payload_%d", i)), i == 0, ""); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	// rolled back transactions don't leave events behind
+	err = db.TX(context.Background(), func(tx *DBWrapper) error {
+		if _, err := tx.AddOutboxEvent(messengertypes.StreamEvent_TypeContactUpdated, []byte("rolled_back"), false, ""); err != nil {
+			return err
+		}
+
+		return errors.New("rollback")
+	})
+	require.Error(t, err)
+
+	events, err = db.GetOutboxEvents(2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, []byte("payload_0"), events[0].Payload)
+	require.True(t, events[0].IsNew)
+	require.Equal(t, []byte("payload_1"), events[1].Payload)
+	require.False(t, events[1].IsNew)
+
+	require.NoError(t, db.DeleteOutboxEvents([]int64{events[0].ID, events[1].ID}))
+
+	events, err = db.GetOutboxEvents(10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, []byte("payload_2"), events[0].Payload)
+	require.Equal(t, messengertypes.StreamEvent_TypeConversationUpdated, events[0].Type)
+}
+
+func Test_dbWrapper_ConversationSupportsCompactPayload(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member1", ConversationPublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member2", ConversationPublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: "Device11", MemberPublicKey: "Member1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: "Device21", MemberPublicKey: "Member2"}).Error)
+
+	_, err := db.ConversationSupportsCompactPayload("")
+	require.Error(t, err)
+
+	// no known device
+	supported, err := db.ConversationSupportsCompactPayload("Convo2")
+	require.NoError(t, err)
+	require.False(t, supported)
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.False(t, supported)
+
+	require.NoError(t, db.SetDeviceSupportsCompactPayload("Device11", true))
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.False(t, supported)
+
+	require.NoError(t, db.SetDeviceSupportsCompactPayload("Device21", true))
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.True(t, supported)
+
+	// a member who just joined has no known device yet
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member3", ConversationPublicKey: "Convo1"}).Error)
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.False(t, supported)
+
+	// its device is known before it announces the capability
+	_, err = db.AddDevice("Device31", "Member3")
+	require.NoError(t, err)
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.False(t, supported)
+
+	require.NoError(t, db.SetDeviceSupportsCompactPayload("Device31", true))
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.True(t, supported)
+
+	// a device announcing it lost the capability disables it again
+	require.NoError(t, db.SetDeviceSupportsCompactPayload("Device21", false))
+
+	supported, err = db.ConversationSupportsCompactPayload("Convo1")
+	require.NoError(t, err)
+	require.False(t, supported)
+}
+
+func Test_dbWrapper_Medias(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.Error(t, db.AddMedia(&messengertypes.Media{}))
+
+	_, err := db.GetMediaByCID("Media1")
+	require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	require.NoError(t, db.db.Create(&messengertypes.Account{PublicKey: "Account1", AvatarCID: "Media1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "Contact1", AvatarCID: "Media2"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member1", ConversationPublicKey: "Convo1", AvatarCID: "Media3"}).Error)
+
+	for _, cid := range []string{"Media1", "Media2", "Media3", "Media4"} {
+		require.NoError(t, db.AddMedia(&messengertypes.Media{CID: cid, MimeType: "image/jpeg", Data: []byte("0123456789")}))
+	}
+
+	// adding a known media again is a noop
+	require.NoError(t, db.AddMedia(&messengertypes.Media{CID: "Media1", Data: []byte("01234")}))
+
+	media, err := db.GetMediaByCID("Media1")
+	require.NoError(t, err)
+	require.Equal(t, int64(10), media.DataSize)
+	require.Equal(t, "image/jpeg", media.MimeType)
+
+	// only the unreferenced media is removed
+	removed, err := db.PruneMedias(1000)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+
+	_, err = db.GetMediaByCID("Media4")
+	require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// mark Media2 as the least recently used one
+	require.NoError(t, db.db.Model(&messengertypes.Media{}).Where("cid = ?", "Media2").Update("last_used_date", 1).Error)
+
+	removed, err = db.PruneMedias(20)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+
+	_, err = db.GetMediaByCID("Media2")
+	require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	// the account avatar is always kept
+	removed, err = db.PruneMedias(0)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+
+	_, err = db.GetMediaByCID("Media1")
+	require.NoError(t, err)
+
+	contacts, members, err := db.GetAvatarUsers("Media3")
+	require.NoError(t, err)
+	require.Empty(t, contacts)
+	require.Len(t, members, 1)
+	require.Equal(t, "Member1", members[0].PublicKey)
+}
+
+func Test_dbWrapper_ConversationMedias(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.Error(t, db.SetConversationWallpaper("", nil))
+	require.True(t, errcode.Is(db.SetConversationWallpaper("Convo1", nil), errcode.ErrNotFound))
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo1"}).Error)
+
+	require.NoError(t, db.SetConversationWallpaper("Convo1", &messengertypes.Media{CID: "Wallpaper1", MimeType: "image/png", Data: []byte("0123456789")}))
+	require.NoError(t, db.SetConversationNotificationSound("Convo1", &messengertypes.Media{CID: "Sound1", MimeType: "audio/mpeg", Data: []byte("0123456789")}))
+
+	conv, err := db.GetConversationByPK("Convo1")
+	require.NoError(t, err)
+	require.Equal(t, "Wallpaper1", conv.WallpaperCID)
+	require.Equal(t, "Sound1", conv.NotificationSoundCID)
+
+	// the conversation medias can't be fetched again, they are always kept
+	removed, err := db.PruneMedias(0)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	removed, err = db.PruneMediasUnusedSince(math.MaxInt64)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	// the replaced wallpaper is removed once unused
+	require.NoError(t, db.SetConversationWallpaper("Convo1", &messengertypes.Media{CID: "Wallpaper2", MimeType: "image/png", Data: []byte("01234")}))
+	require.NoError(t, db.SetConversationNotificationSound("Convo1", nil))
+
+	conv, err = db.GetConversationByPK("Convo1")
+	require.NoError(t, err)
+	require.Equal(t, "Wallpaper2", conv.WallpaperCID)
+	require.Empty(t, conv.NotificationSoundCID)
+
+	removed, err = db.PruneMedias(1000)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), removed)
+
+	_, err = db.GetMediaByCID("Wallpaper2")
+	require.NoError(t, err)
+}
+
+func Test_dbWrapper_StagedMedias(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.ReuseStagedMedia("Staged1", 10)
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.Error(t, db.AddStagedMedia(&messengertypes.StagedMedia{CID: "Staged1"}, &messengertypes.Media{CID: "Other"}, nil))
+
+	for _, cid := range []string{"Staged1", "Staged2"} {
+		require.NoError(t, db.AddStagedMedia(
+			&messengertypes.StagedMedia{CID: cid, MimeType: "image/png", StagedDate: 10},
+			&messengertypes.Media{CID: cid, MimeType: "image/png", Data: []byte("0123456789")},
+			&messengertypes.Media{CID: cid + "Thumbnail", MimeType: "image/jpeg", Data: []byte("01234")},
+		))
+	}
+
+	// staging the same content again renews it
+	staged, err := db.ReuseStagedMedia("Staged1", 20)
+	require.NoError(t, err)
+	require.Equal(t, "Staged1Thumbnail", staged.ThumbnailCID)
+	require.Equal(t, int64(20), staged.StagedDate)
+
+	// the staged medias aren't part of the cache
+	removed, err := db.PruneMedias(0)
+	require.NoError(t, err)
+	require.Zero(t, removed)
+
+	// the medias referenced by a draft are kept
+	require.NoError(t, db.db.Create(&messengertypes.ConversationDraftMediaRef{ConversationPublicKey: "Convo1", Ref: "Staged2"}).Error)
+	removed, err = db.PruneStagedMedias(30)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), removed)
+
+	_, err = db.GetMediaByCID("Staged1")
+	require.Error(t, err)
+	_, err = db.GetMediaByCID("Staged1Thumbnail")
+	require.Error(t, err)
+	_, err = db.GetMediaByCID("Staged2Thumbnail")
+	require.NoError(t, err)
+
+	require.NoError(t, db.DiscardStagedMedia("Staged2"))
+	require.True(t, errcode.Is(db.DiscardStagedMedia("Staged2"), errcode.ErrNotFound))
+	_, err = db.GetMediaByCID("Staged2")
+	require.Error(t, err)
+}
+
+func Test_dbWrapper_GetAccountSummary(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetAccountSummary(-1)
+	require.Error(t, err)
+
+	summary, err := db.GetAccountSummary(3)
+	require.NoError(t, err)
+	require.Zero(t, summary.TotalUnread)
+	require.Empty(t, summary.TopUnreadConversations)
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo1", DisplayName: "one", UnreadCount: 2, LastUpdate: 10}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo2", UnreadCount: 3, LastUpdate: 30}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo3", UnreadCount: 1, LastUpdate: 20}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo4", LastUpdate: 40}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Muted", UnreadCount: 5, LastUpdate: 50, MutedUntil: math.MaxInt64}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "Contact1", State: messengertypes.Contact_IncomingRequest}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "Contact2", State: messengertypes.Contact_Accepted}).Error)
+
+	summary, err = db.GetAccountSummary(2)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), summary.TotalUnread)
+	require.Equal(t, int64(1), summary.PendingContactRequests)
+	require.Len(t, summary.TopUnreadConversations, 2)
+	require.Equal(t, "Convo2", summary.TopUnreadConversations[0].PublicKey)
+	require.Equal(t, "Convo3", summary.TopUnreadConversations[1].PublicKey)
+	require.NotZero(t, summary.GeneratedDate)
+}
+
+func Test_dbWrapper_Preferences(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Account{PublicKey: "Account1", HidePushPreviews: true, LocalRetentionDays: 30}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo1", MutedUntil: 42}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo2"}).Error)
+
+	// only the conversations with settings are exported
+	prefs, err := db.GetPreferences()
+	require.NoError(t, err)
+	require.True(t, prefs.HidePushPreviews)
+	require.Equal(t, int32(30), prefs.LocalRetentionDays)
+	require.Equal(t, []*messengertypes.ConversationPreferences{{PublicKey: "Convo1", MutedUntil: 42}}, prefs.Conversations)
+
+	skipped, err := db.SetPreferences(&messengertypes.Preferences{
+		QuietHoursEnabled: true,
+		QuietHoursStart:   60,
+		QuietHoursEnd:     120,
+		Conversations: []*messengertypes.ConversationPreferences{
+			{PublicKey: "Convo2", AutoTranslateLanguage: "fr", DisableReadReceipts: true},
+			{PublicKey: "Convo3", MutedUntil: 1},
+			{MutedUntil: 1},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Convo3"}, skipped)
+
+	acc, err := db.GetAccount()
+	require.NoError(t, err)
+	require.False(t, acc.HidePushPreviews)
+	require.Zero(t, acc.LocalRetentionDays)
+	require.True(t, acc.QuietHoursEnabled)
+	require.Equal(t, int32(120), acc.QuietHoursEnd)
+
+	// the conversations missing from the document are kept as is
+	conv, err := db.GetConversationByPK("Convo1")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), conv.MutedUntil)
+
+	conv, err = db.GetConversationByPK("Convo2")
+	require.NoError(t, err)
+	require.Equal(t, "fr", conv.AutoTranslateLanguage)
+	require.True(t, conv.DisableReadReceipts)
+	require.Zero(t, conv.MutedUntil)
+}
+
+func Test_dbWrapper_Profiles(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.FirstOrCreateAccount("Account1", "http://berty.tech/id#Account1"))
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "Contact1", ConversationPublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member1", ConversationPublicKey: "Convo2"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member1", ConversationPublicKey: "Convo3"}).Error)
+
+	acc, err := db.UpdateAccountProfile("my bio", []string{"https://a.example", "https://b.example"})
+	require.NoError(t, err)
+	require.Equal(t, "my bio", acc.Bio)
+	require.Len(t, acc.Links, 2)
+	require.Equal(t, "https://a.example", acc.Links[0].URL)
+	require.Equal(t, "https://b.example", acc.Links[1].URL)
+
+	require.NoError(t, db.UpdateContactProfile("Contact1", "Convo1", "contact bio", []string{"https://c.example"}))
+	require.NoError(t, db.UpdateMemberProfile("Member1", "Convo2", "member bio", []string{"https://d.example", "https://e.example"}))
+
+	contact, err := db.GetContactByPK("Contact1")
+	require.NoError(t, err)
+	require.Equal(t, "contact bio", contact.Bio)
+	require.Len(t, contact.Links, 1)
+	require.Equal(t, "https://c.example", contact.Links[0].URL)
+
+	// profiles are per conversation for members
+	member, err := db.GetMemberByPK("Member1", "Convo2")
+	require.NoError(t, err)
+	require.Equal(t, "member bio", member.Bio)
+	require.Len(t, member.Links, 2)
+
+	member, err = db.GetMemberByPK("Member1", "Convo3")
+	require.NoError(t, err)
+	require.Empty(t, member.Bio)
+	require.Empty(t, member.Links)
+
+	// links are replaced and can be cleared
+	require.NoError(t, db.UpdateMemberProfile("Member1", "Convo2", "", []string{"https://f.example"}))
+	member, err = db.GetMemberByPK("Member1", "Convo2")
+	require.NoError(t, err)
+	require.Empty(t, member.Bio)
+	require.Len(t, member.Links, 1)
+	require.Equal(t, "https://f.example", member.Links[0].URL)
+
+	acc, err = db.UpdateAccountProfile("", nil)
+	require.NoError(t, err)
+	require.Empty(t, acc.Bio)
+	require.Empty(t, acc.Links)
+
+	// the other profiles are untouched
+	contact, err = db.GetContactByPK("Contact1")
+	require.NoError(t, err)
+	require.Len(t, contact.Links, 1)
+}
+
+func Test_dbWrapper_Wipe(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.FirstOrCreateAccount("Account1", "http://berty.tech/id#Account1"))
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "Contact1", ConversationPublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "Qm0001", ConversationPublicKey: "Convo1"}).Error)
+	require.NoError(t, db.AddMedia(&messengertypes.Media{CID: "Media1", Data: []byte("data")}))
+	_, err := db.UpdateAccountProfile("bio", []string{"https://berty.tech"})
+	require.NoError(t, err)
+
+	require.NoError(t, db.Wipe())
+
+	info, err := db.GetDBInfo()
+	require.NoError(t, err)
+	require.Equal(t, &messengertypes.SystemInfo_DB{}, info)
+
+	// the db is still usable
+	require.NoError(t, db.FirstOrCreateAccount("Account2", "http://berty.tech/id#Account2"))
+	acc, err := db.GetAccount()
+	require.NoError(t, err)
+	require.Equal(t, "Account2", acc.PublicKey)
+}
+
+func Test_dbWrapper_DirectoryServiceRecords(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetDirectoryServiceRecord("@alice")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, db.SaveDirectoryServiceRecord(&messengertypes.DirectoryServiceRecord{Identifier: "@alice", TokenID: "token1", DirectoryRecordToken: "record1", UnlockKey: []byte("key1")}))
+	require.Error(t, db.SaveDirectoryServiceRecord(&messengertypes.DirectoryServiceRecord{TokenID: "token1"}))
+
+	record, err := db.GetDirectoryServiceRecord("@alice")
+	require.NoError(t, err)
+	require.Equal(t, "record1", record.DirectoryRecordToken)
+	require.Equal(t, []byte("key1"), record.UnlockKey)
+
+	// renewing a record replaces it
+	require.NoError(t, db.SaveDirectoryServiceRecord(&messengertypes.DirectoryServiceRecord{Identifier: "@alice", TokenID: "token1", DirectoryRecordToken: "record1", ExpirationDate: 42, UnlockKey: []byte("key1")}))
+	record, err = db.GetDirectoryServiceRecord("@alice")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), record.ExpirationDate)
+
+	require.NoError(t, db.DeleteDirectoryServiceRecord("@alice"))
+	_, err = db.GetDirectoryServiceRecord("@alice")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func Test_dbWrapper_Presence(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.FirstOrCreateAccount("Account1", "http://berty.tech/id#Account1"))
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "Contact1", ConversationPublicKey: "Convo1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "Member1", ConversationPublicKey: "Convo2"}).Error)
+
+	updated, err := db.UpdateContactLastSeen("Contact1", 2000)
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	// older beacons are ignored
+	updated, err = db.UpdateContactLastSeen("Contact1", 1000)
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	updated, err = db.UpdateContactLastSeen("Contact2", 3000)
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	contact, err := db.GetContactByPK("Contact1")
+	require.NoError(t, err)
+	require.Equal(t, int64(2000), contact.LastSeen)
+
+	updated, err = db.UpdateMemberLastSeen("Member1", "Convo2", 2000)
+	require.NoError(t, err)
+	require.True(t, updated)
+
+	updated, err = db.UpdateMemberLastSeen("Member1", "Convo3", 2000)
+	require.NoError(t, err)
+	require.False(t, updated)
+
+	// the presence of the members is forgotten when restricted to contacts
+	contacts, members, err := db.SetPresenceVisibility(messengertypes.Account_PresenceVisibilityContacts)
+	require.NoError(t, err)
+	require.Empty(t, contacts)
+	require.Len(t, members, 1)
+	require.Equal(t, int64(0), members[0].LastSeen)
+
+	member, err := db.GetMemberByPK("Member1", "Convo2")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), member.LastSeen)
+
+	contacts, _, err = db.SetPresenceVisibility(messengertypes.Account_PresenceVisibilityNobody)
+	require.NoError(t, err)
+	require.Len(t, contacts, 1)
+
+	acc, err := db.GetAccount()
+	require.NoError(t, err)
+	require.Equal(t, messengertypes.Account_PresenceVisibilityNobody, acc.PresenceVisibility)
+
+	contact, err = db.GetContactByPK("Contact1")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), contact.LastSeen)
+}
+
+func Test_dbWrapper_Broadcasts(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	list, err := db.SaveBroadcastList(&messengertypes.BroadcastList{ID: "list1", Name: "friends", Recipients: []*messengertypes.BroadcastListRecipient{
+		{ListID: "list1", ContactPublicKey: "Contact1"},
+		{ListID: "list1", ContactPublicKey: "Contact2"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, list.Recipients, 2)
+
+	// saving a list replaces its recipients
+	list, err = db.SaveBroadcastList(&messengertypes.BroadcastList{ID: "list1", Name: "best friends", Recipients: []*messengertypes.BroadcastListRecipient{
+		{ListID: "list1", ContactPublicKey: "Contact2"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "best friends", list.Name)
+	require.Len(t, list.Recipients, 1)
+
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "Qm0001", Acknowledged: true}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "Qm0002"}).Error)
+	require.NoError(t, db.AddBroadcast(&messengertypes.Broadcast{ID: "broadcast1", ListID: "list1", Body: "hello", Deliveries: []*messengertypes.BroadcastDelivery{
+		{BroadcastID: "broadcast1", ContactPublicKey: "Contact1", InteractionCID: "Qm0001", State: messengertypes.BroadcastDelivery_Sent},
+		{BroadcastID: "broadcast1", ContactPublicKey: "Contact2", InteractionCID: "Qm0002", State: messengertypes.BroadcastDelivery_Sent},
+		{BroadcastID: "broadcast1", ContactPublicKey: "Contact3", State: messengertypes.BroadcastDelivery_Failed, Error: "unknown contact"},
+	}}))
+
+	require.NoError(t, db.DeleteBroadcastList("list1"))
+	require.ErrorIs(t, db.DeleteBroadcastList("list1"), gorm.ErrRecordNotFound)
+	lists, err := db.GetAllBroadcastLists()
+	require.NoError(t, err)
+	require.Empty(t, lists)
+
+	// the report outlives the list
+	report, err := db.GetBroadcastReport("broadcast1")
+	require.NoError(t, err)
+	states := map[string]messengertypes.BroadcastDelivery_State{}
+	for _, delivery := range report.Deliveries {
+		states[delivery.ContactPublicKey] = delivery.State
+	}
+	require.Equal(t, map[string]messengertypes.BroadcastDelivery_State{
+		"Contact1": messengertypes.BroadcastDelivery_Acknowledged,
+		"Contact2": messengertypes.BroadcastDelivery_Sent,
+		"Contact3": messengertypes.BroadcastDelivery_Failed,
+	}, states)
+}
+
+func Test_dbWrapper_InteractionTranslations(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv1"}).Error)
+	require.NoError(t, db.SetConversationAutoTranslateLanguage("conv1", "fr"))
+	conv, err := db.GetConversationByPK("conv1")
+	require.NoError(t, err)
+	require.Equal(t, "fr", conv.AutoTranslateLanguage)
+	require.Error(t, db.SetConversationAutoTranslateLanguage("conv2", "fr"))
+
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "Qm0001", ConversationPublicKey: "conv1"}).Error)
+	_, err = db.GetInteractionTranslation("Qm0001", "fr")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	require.NoError(t, db.SaveInteractionTranslation(&messengertypes.InteractionTranslation{InteractionCID: "Qm0001", Language: "fr", Body: "bonjour", Provider: "test"}))
+	require.NoError(t, db.SaveInteractionTranslation(&messengertypes.InteractionTranslation{InteractionCID: "Qm0001", Language: "fr", Body: "salut", Provider: "test"}))
+	require.Error(t, db.SaveInteractionTranslation(&messengertypes.InteractionTranslation{InteractionCID: "Qm0001"}))
+
+	translation, err := db.GetInteractionTranslation("Qm0001", "fr")
+	require.NoError(t, err)
+	require.Equal(t, "salut", translation.Body)
+
+	// translations are loaded with the interaction
+	inte, err := db.GetInteractionByCID("Qm0001")
+	require.NoError(t, err)
+	require.Len(t, inte.Translations, 1)
+	require.Equal(t, "salut", inte.Translations[0].Body)
+}
+
+func Test_dbWrapper_FeatureFlags(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	flags, err := db.GetFeatureFlags()
+	require.NoError(t, err)
+	require.Equal(t, []*messengertypes.FeatureFlag{
+		{Name: messengertypes.FeatureFlag_FeatureMessageSearch, Enabled: true},
+		{Name: messengertypes.FeatureFlag_FeatureAckBatching},
+		{Name: messengertypes.FeatureFlag_FeatureGroupEventWorkers},
+	}, flags)
+
+	flag, err := db.SetFeatureFlag(messengertypes.FeatureFlag_FeatureAckBatching, true, 10)
+	require.NoError(t, err)
+	require.True(t, flag.Enabled)
+	_, err = db.SetFeatureFlag(messengertypes.FeatureFlag_FeatureMessageSearch, false, 20)
+	require.NoError(t, err)
+	_, err = db.SetFeatureFlag(messengertypes.FeatureFlag_FeatureUndefined, true, 30)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	flags, err = db.GetFeatureFlags()
+	require.NoError(t, err)
+	require.Equal(t, []*messengertypes.FeatureFlag{
+		{Name: messengertypes.FeatureFlag_FeatureMessageSearch, UpdatedDate: 20},
+		{Name: messengertypes.FeatureFlag_FeatureAckBatching, Enabled: true, UpdatedDate: 10},
+		{Name: messengertypes.FeatureFlag_FeatureGroupEventWorkers},
+	}, flags)
+
+	flag, err = db.ResetFeatureFlag(messengertypes.FeatureFlag_FeatureMessageSearch)
+	require.NoError(t, err)
+	require.True(t, flag.Enabled)
+
+	flags, err = db.GetFeatureFlags()
+	require.NoError(t, err)
+	require.Equal(t, &messengertypes.FeatureFlag{Name: messengertypes.FeatureFlag_FeatureMessageSearch, Enabled: true}, flags[0])
+}
+
+func Test_dbWrapper_concurrentTX(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv1"}).Error)
+
+	// the transactions reading then writing the same row don't fail nor lose
+	// an update when run together
+	const count = 10
+	errs := make(chan error, count)
+	for i := 0; i < count; i++ {
+		go func() {
+			errs <- db.TX(context.Background(), func(tx *DBWrapper) error {
+				conv, err := tx.GetConversationByPK("conv1")
+				if err != nil {
+					return err
+				}
+				return tx.db.Model(conv).Update("unread_count", conv.UnreadCount+1).Error
+			})
+		}()
+	}
+	for i := 0; i < count; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	conv, err := db.GetConversationByPK("conv1")
+	require.NoError(t, err)
+	require.Equal(t, int32(count), conv.UnreadCount)
+}
+
+func Test_dbWrapper_ConversationLanguageHint(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv1"}).Error)
+	addMessage := func(cid string, body string, sentDate int64) {
+		payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: body})
+		require.NoError(t, err)
+		require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: cid, ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, Payload: payload, SentDate: sentDate}).Error)
+	}
+
+	// nothing to infer the language from
+	_, changed, err := db.InferConversationLanguageHint("conv1")
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	addMessage("Qm0001", "Salut, je suis en route", 1)
+	addMessage("Qm0002", "merci pour le message", 2)
+	conv, changed, err := db.InferConversationLanguageHint("conv1")
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, "fr", conv.LanguageHint)
+
+	_, changed, err = db.InferConversationLanguageHint("conv1")
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// a language set manually isn't inferred anymore
+	conv, err = db.SetConversationLanguageHint("conv1", "de")
+	require.NoError(t, err)
+	require.Equal(t, "de", conv.LanguageHint)
+	require.True(t, conv.LanguageHintManual)
+	_, changed, err = db.InferConversationLanguageHint("conv1")
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// clearing it infers it again
+	conv, err = db.SetConversationLanguageHint("conv1", "")
+	require.NoError(t, err)
+	require.Equal(t, "fr", conv.LanguageHint)
+	require.False(t, conv.LanguageHintManual)
+
+	_, err = db.SetConversationLanguageHint("conv2", "fr")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	_, _, err = db.InferConversationLanguageHint("conv2")
+	require.Error(t, err)
+}
+
+func Test_dbWrapper_SetConversationReadPosition(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, _, err := db.SetConversationReadPosition("", "cid1")
+	require.Error(t, err)
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv1", UnreadCount: 3, LastReadDate: 5}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv2"}).Error)
+	for i, sentDate := range []int64{10, 20, 30} {
+		require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: fmt.Sprintf("cid%d", i+1), ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: sentDate}).Error)
+	}
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "cid_other", ConversationPublicKey: "conv2", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 40}).Error)
+
+	_, _, err = db.SetConversationReadPosition("conv1", "cid_xxx")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	_, _, err = db.SetConversationReadPosition("conv1", "cid_other")
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	conv, moved, err := db.SetConversationReadPosition("conv1", "cid2")
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.Equal(t, "cid2", conv.LastReadCID)
+	require.Equal(t, int64(20), conv.LastReadDate)
+	require.Equal(t, int32(1), conv.UnreadCount)
+
+	// the position only moves forward
+	conv, moved, err = db.SetConversationReadPosition("conv1", "cid1")
+	require.NoError(t, err)
+	require.False(t, moved)
+	require.Equal(t, "cid2", conv.LastReadCID)
+
+	_, moved, err = db.SetConversationReadPosition("conv1", "cid2")
+	require.NoError(t, err)
+	require.False(t, moved)
+
+	conv, moved, err = db.SetConversationReadPosition("conv1", "cid3")
+	require.NoError(t, err)
+	require.True(t, moved)
+	require.Equal(t, "cid3", conv.LastReadCID)
+	require.Equal(t, int32(0), conv.UnreadCount)
+}
+
+func Test_dbWrapper_GetMentionCandidates(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetMentionCandidates("")
+	require.Error(t, err)
+
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "me", ConversationPublicKey: "conv1", IsMe: true, LastMessageDate: 50}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "alice", ConversationPublicKey: "conv1", DisplayName: "alice"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "bob", ConversationPublicKey: "conv1", DisplayName: "bob"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "carol", ConversationPublicKey: "conv1", DisplayName: "carol"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "dave", ConversationPublicKey: "conv2", DisplayName: "dave"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: "carol-device1", MemberPublicKey: "carol"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: "carol-device2", MemberPublicKey: "carol"}).Error)
+
+	require.NoError(t, db.UpdateMemberLastMessageDate("carol", "conv1", 20))
+	require.NoError(t, db.UpdateMemberLastMessageDate("bob", "conv1", 30))
+	// older dates are ignored
+	require.NoError(t, db.UpdateMemberLastMessageDate("bob", "conv1", 10))
+
+	members, err := db.GetMentionCandidates("conv1")
+	require.NoError(t, err)
+
+	pks := []string(nil)
+	for _, m := range members {
+		pks = append(pks, m.PublicKey)
+	}
+	require.Equal(t, []string{"bob", "carol", "alice"}, pks)
+	require.Equal(t, int64(30), members[0].LastMessageDate)
+}
+
+func Test_dbWrapper_GetMemberDeliveries(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "me", ConversationPublicKey: "conv1", IsMe: true}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "alice", ConversationPublicKey: "conv1", DisplayName: "alice"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "bob", ConversationPublicKey: "conv1", DisplayName: "bob"}).Error)
+
+	isNew, err := db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: "cid1", DevicePublicKey: "alice1", MemberPublicKey: "alice", DeliveredDate: 20})
+	require.NoError(t, err)
+	require.True(t, isNew)
+	_, err = db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: "cid1", DevicePublicKey: "alice2", MemberPublicKey: "alice", DeliveredDate: 10})
+	require.NoError(t, err)
+
+	// the acknowledge completes the receipt of the device, known dates are kept
+	isNew, err = db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: "cid1", DevicePublicKey: "alice1", MemberPublicKey: "alice", AcknowledgedDate: 30})
+	require.NoError(t, err)
+	require.True(t, isNew)
+	isNew, err = db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: "cid1", DevicePublicKey: "alice1", MemberPublicKey: "alice", DeliveredDate: 40, AcknowledgedDate: 40})
+	require.NoError(t, err)
+	require.False(t, isNew)
+
+	_, err = db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: "cid1", DevicePublicKey: "carol1", MemberPublicKey: "carol", AcknowledgedDate: 50})
+	require.NoError(t, err)
+
+	deliveries, err := db.GetMemberDeliveries("cid1", "conv1")
+	require.NoError(t, err)
+	require.Len(t, deliveries, 3)
+
+	require.Equal(t, "carol", deliveries[0].Member.PublicKey)
+	require.Equal(t, int32(0), deliveries[0].DeliveredDevices)
+	require.Equal(t, int64(50), deliveries[0].AcknowledgedDate)
+
+	require.Equal(t, "alice", deliveries[1].Member.PublicKey)
+	require.Equal(t, int32(2), deliveries[1].DeliveredDevices)
+	require.Equal(t, int64(10), deliveries[1].DeliveredDate)
+	require.Equal(t, int64(30), deliveries[1].AcknowledgedDate)
+
+	require.Equal(t, "bob", deliveries[2].Member.PublicKey)
+	require.Equal(t, int64(0), deliveries[2].DeliveredDate)
+}
+
+func Test_dbWrapper_DeliveryCounts(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "group", Type: messengertypes.Conversation_MultiMemberType}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "contact", Type: messengertypes.Conversation_ContactType}).Error)
+	for _, i := range []messengertypes.Interaction{
+		{CID: "cid_mine", ConversationPublicKey: "group", MemberPublicKey: "me", IsMine: true, SentDate: 10},
+		{CID: "cid_other", ConversationPublicKey: "group", MemberPublicKey: "alice", SentDate: 20},
+		{CID: "cid_contact", ConversationPublicKey: "contact", IsMine: true, SentDate: 30},
+	} {
+		_, _, err := db.AddInteraction(i)
+		require.NoError(t, err)
+	}
+
+	for _, r := range []*messengertypes.DeliveryReceipt{
+		{InteractionCID: "cid_mine", DevicePublicKey: "alice1", MemberPublicKey: "alice", DeliveredDate: 11},
+		{InteractionCID: "cid_mine", DevicePublicKey: "alice2", MemberPublicKey: "alice", DeliveredDate: 12},
+		// acknowledged only, by an own device, and the other conversations
+		{InteractionCID: "cid_mine", DevicePublicKey: "bob1", MemberPublicKey: "bob", AcknowledgedDate: 13},
+		{InteractionCID: "cid_mine", DevicePublicKey: "me2", MemberPublicKey: "me", DeliveredDate: 14},
+		{InteractionCID: "cid_contact", DevicePublicKey: "carol1", MemberPublicKey: "carol", DeliveredDate: 31},
+	} {
+		_, err := db.AddDeliveryReceipt(r)
+		require.NoError(t, err)
+	}
+
+	_, err := db.SetReadMarker(messengertypes.ReadMarker{ConversationPublicKey: "group", MemberPublicKey: "alice", InteractionCID: "cid_mine", ReadDate: 10, UpdatedDate: 15})
+	require.NoError(t, err)
+
+	inte, err := db.GetAugmentedInteraction("cid_mine")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), inte.DeliveredCount)
+	require.Equal(t, int32(1), inte.ReadCount)
+
+	for _, cid := range []string{"cid_other", "cid_contact"} {
+		inte, err := db.GetAugmentedInteraction(cid)
+		require.NoError(t, err)
+		require.Zero(t, inte.DeliveredCount)
+		require.Zero(t, inte.ReadCount)
+	}
+}
+
+func Test_dbWrapper_GetConversationMemberStates(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetConversationMemberStates("unknown")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "group", Type: messengertypes.Conversation_MultiMemberType}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "contact", Type: messengertypes.Conversation_ContactType, ContactPublicKey: "carol"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "carol", DisplayName: "Carol", ConversationPublicKey: "contact"}).Error)
+	for _, m := range []*messengertypes.Member{
+		{PublicKey: "me", ConversationPublicKey: "group", IsMe: true},
+		{PublicKey: "alice", ConversationPublicKey: "group", DisplayName: "Alice"},
+		{PublicKey: "bob", ConversationPublicKey: "group", DisplayName: "Bob"},
+	} {
+		require.NoError(t, db.db.Create(m).Error)
+	}
+	for _, dev := range [][2]string{{"alice1", "alice"}, {"alice2", "alice"}, {"carol1", "carol"}} {
+		_, err := db.AddDevice(dev[0], dev[1])
+		require.NoError(t, err)
+	}
+
+	for _, i := range []messengertypes.Interaction{
+		{CID: "cid_mine", ConversationPublicKey: "group", MemberPublicKey: "me", IsMine: true, SentDate: 10},
+		{CID: "cid_alice", ConversationPublicKey: "group", MemberPublicKey: "alice", SentDate: 20},
+		{CID: "cid_contact", ConversationPublicKey: "contact", IsMine: true, Acknowledged: true, SentDate: 30},
+	} {
+		_, _, err := db.AddInteraction(i)
+		require.NoError(t, err)
+	}
+	_, err = db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: "cid_mine", DevicePublicKey: "bob1", MemberPublicKey: "bob", AcknowledgedDate: 11})
+	require.NoError(t, err)
+
+	states, err := db.GetConversationMemberStates("group")
+	require.NoError(t, err)
+	require.Equal(t, []*messengertypes.DiagnoseConversation_MemberState{
+		{MemberPublicKey: "alice", DisplayName: "Alice", Devices: 2, ReceivedFrom: true},
+		{MemberPublicKey: "bob", DisplayName: "Bob", DeliveredTo: true},
+	}, states)
+
+	// the acknowledged interactions count as delivered to the contact
+	states, err = db.GetConversationMemberStates("contact")
+	require.NoError(t, err)
+	require.Equal(t, []*messengertypes.DiagnoseConversation_MemberState{
+		{MemberPublicKey: "carol", DisplayName: "Carol", Devices: 1, DeliveredTo: true},
+	}, states)
+
+	count, err := db.CountQueuedMessages("group")
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	_, err = db.EnqueueInteraction(messengertypes.Interaction{CID: "cid_queued", ConversationPublicKey: "group", IsMine: true, SentDate: 40}, []byte("payload"))
+	require.NoError(t, err)
+	count, err = db.CountQueuedMessages("group")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+}
+
+func Test_dbWrapper_GetNotificationState(t *testing.T) {
+	db, gormDB, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	queries := 0
+	require.NoError(t, gormDB.Callback().Query().Before("gorm:query").Register("test:count_queries", func(*gorm.DB) { queries++ }))
+
+	require.NoError(t, db.FirstOrCreateAccount("pk_account", "http://url1/"))
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "contact", Type: messengertypes.Conversation_ContactType, ContactPublicKey: "carol"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "carol", DisplayName: "Carol", ConversationPublicKey: "contact"}).Error)
+
+	now := time.Now()
+	conv, err := db.GetConversationByPK("contact")
+	require.NoError(t, err)
+
+	state, err := db.GetNotificationState(conv, now)
+	require.NoError(t, err)
+	require.False(t, state.Opened)
+	require.Equal(t, "Carol", state.Contact.GetDisplayName())
+	snoozed, err := db.NotificationsSnoozed(now)
+	require.NoError(t, err)
+	require.False(t, snoozed)
+
+	// the state is read from the memory once cached
+	queries = 0
+	for n := 0; n < 3; n++ {
+		_, err := db.GetNotificationState(conv, now)
+		require.NoError(t, err)
+		_, err = db.NotificationsSnoozed(now)
+		require.NoError(t, err)
+	}
+	require.Zero(t, queries)
+
+	// the writes to the cached tables are seen
+	require.NoError(t, db.db.Model(&messengertypes.Contact{}).Where("public_key = ?", "carol").Update("display_name", "Caroline").Error)
+	require.NoError(t, db.UpdateAccountFields(map[string]interface{}{"notifications_snoozed_until": messengerutil.TimestampMs(now.Add(time.Hour))}))
+	conv, _, err = db.OpenConversationSession("contact", "session1", now)
+	require.NoError(t, err)
+
+	state, err = db.GetNotificationState(conv, now)
+	require.NoError(t, err)
+	require.True(t, state.Opened)
+	require.Equal(t, "Caroline", state.Contact.GetDisplayName())
+	snoozed, err = db.NotificationsSnoozed(now)
+	require.NoError(t, err)
+	require.True(t, snoozed)
+
+	// the session expires without a write
+	state, err = db.GetNotificationState(conv, now.Add(messengertypes.ConversationSessionTTL+time.Second))
+	require.NoError(t, err)
+	require.False(t, state.Opened)
+
+	// the values cached in a rolled back transaction are dropped
+	require.Error(t, db.TX(context.Background(), func(tx *DBWrapper) error {
+		require.NoError(t, tx.db.Model(&messengertypes.Contact{}).Where("public_key = ?", "carol").Update("display_name", "Rolled back").Error)
+		state, err := tx.GetNotificationState(conv, now)
+		require.NoError(t, err)
+		require.Equal(t, "Rolled back", state.Contact.GetDisplayName())
+		return fmt.Errorf("rollback")
+	}))
+
+	state, err = db.GetNotificationState(conv, now)
+	require.NoError(t, err)
+	require.Equal(t, "Caroline", state.Contact.GetDisplayName())
+}
+
+func Test_dbWrapper_SetConversationFocus(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv1"}).Error)
+
+	_, err := db.SetConversationFocus("", 42)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, err = db.SetConversationFocus("unknown", 42)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	conv, err := db.SetConversationFocus("conv1", 42)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), conv.FocusedUntil)
+
+	conv, err = db.SetConversationFocus("conv1", 0)
+	require.NoError(t, err)
+	require.Zero(t, conv.FocusedUntil)
+}
+
+func Test_dbWrapper_LeaveConversation(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	setup := func(convPK string) {
+		require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: convPK, Type: messengertypes.Conversation_MultiMemberType, WallpaperCID: convPK + "_wallpaper", IsOpen: true}).Error)
+		require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: convPK + "_alice", ConversationPublicKey: convPK, AvatarCID: "alice_avatar"}).Error)
+		require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: convPK + "_bob", ConversationPublicKey: convPK, AvatarCID: convPK + "_bob_avatar"}).Error)
+		require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: convPK + "_alice_device", MemberPublicKey: convPK + "_alice"}).Error)
+		for _, cid := range []string{convPK + "_wallpaper", convPK + "_bob_avatar"} {
+			require.NoError(t, db.db.Create(&messengertypes.Media{CID: cid}).Error)
+		}
+
+		_, _, err := db.AddInteraction(messengertypes.Interaction{CID: convPK + "_poll", ConversationPublicKey: convPK, Type: messengertypes.AppMessage_TypePoll})
+		require.NoError(t, err)
+		require.NoError(t, db.db.Create(&messengertypes.PollVote{PollCID: convPK + "_poll", MemberPublicKey: convPK + "_alice"}).Error)
+		_, err = db.AddDeliveryReceipt(&messengertypes.DeliveryReceipt{InteractionCID: convPK + "_poll", DevicePublicKey: convPK + "_alice_device", MemberPublicKey: convPK + "_alice", DeliveredDate: 10})
+		require.NoError(t, err)
+		_, err = db.EnqueueInteraction(messengertypes.Interaction{CID: convPK + "_queued", ConversationPublicKey: convPK, Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true}, []byte("payload"))
+		require.NoError(t, err)
+		_, err = db.SaveConversationDraft(&messengertypes.ConversationDraft{ConversationPublicKey: convPK, Body: "draft"})
+		require.NoError(t, err)
+		require.NoError(t, db.db.Create(&messengertypes.ConversationSession{ConversationPublicKey: convPK, SessionID: "session"}).Error)
+	}
+	count := func(model interface{}, query string, args ...interface{}) int64 {
+		c := int64(0)
+		require.NoError(t, db.db.Model(model).Where(query, args...).Count(&c).Error)
+		return c
+	}
+
+	// alice's avatar is also the one of a contact
+	require.NoError(t, db.db.Create(&messengertypes.Media{CID: "alice_avatar"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "alice", AvatarCID: "alice_avatar"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "contact_conv", Type: messengertypes.Conversation_ContactType}).Error)
+	setup("archived")
+	setup("purged")
+
+	_, err := db.ArchiveLeftConversation("", 42)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, err = db.ArchiveLeftConversation("archived", 0)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	_, err = db.ArchiveLeftConversation("unknown", 42)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+	_, err = db.ArchiveLeftConversation("contact_conv", 42)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+	require.True(t, errcode.Is(db.PurgeLeftConversation("contact_conv"), errcode.ErrInvalidInput))
+
+	// the archive keeps the content but nothing waiting to be sent
+	conv, err := db.ArchiveLeftConversation("archived", 42)
+	require.NoError(t, err)
+	require.Equal(t, int64(42), conv.GetLeftDate())
+	require.False(t, conv.GetIsOpen())
+	require.Nil(t, conv.GetDraft())
+	require.Equal(t, int64(1), count(&messengertypes.Interaction{}, "conversation_public_key = ?", "archived"))
+	require.Equal(t, int64(1), count(&messengertypes.PollVote{}, "poll_cid = ?", "archived_poll"))
+	require.Equal(t, int64(2), count(&messengertypes.Member{}, "conversation_public_key = ?", "archived"))
+	require.Zero(t, count(&messengertypes.QueuedMessage{}, "conversation_public_key = ?", "archived"))
+	require.Zero(t, count(&messengertypes.ConversationSession{}, "conversation_public_key = ?", "archived"))
+	require.Equal(t, int64(2), count(&messengertypes.Media{}, "cid IN ?", []string{"archived_wallpaper", "archived_bob_avatar"}))
+
+	_, err = db.ArchiveLeftConversation("archived", 43)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	// joining the group again makes it writable
+	rejoined, err := db.MarkConversationRejoined("archived")
+	require.NoError(t, err)
+	require.True(t, rejoined)
+	rejoined, err = db.MarkConversationRejoined("archived")
+	require.NoError(t, err)
+	require.False(t, rejoined)
+	_, err = db.ArchiveLeftConversation("archived", 44)
+	require.NoError(t, err)
+
+	// the purge removes everything but the medias used elsewhere
+	require.NoError(t, db.PurgeLeftConversation("purged"))
+	_, err = db.GetConversationByPK("purged")
+	require.Error(t, err)
+	for _, model := range []interface{}{&messengertypes.Interaction{}, &messengertypes.Member{}, &messengertypes.QueuedMessage{}, &messengertypes.ConversationDraft{}, &messengertypes.ConversationSession{}} {
+		require.Zero(t, count(model, "conversation_public_key = ?", "purged"))
+	}
+	require.Zero(t, count(&messengertypes.PollVote{}, "poll_cid = ?", "purged_poll"))
+	require.Zero(t, count(&messengertypes.DeliveryReceipt{}, "interaction_cid = ?", "purged_poll"))
+	require.Zero(t, count(&messengertypes.Device{}, "member_public_key = ?", "purged_alice"))
+	require.Zero(t, count(&messengertypes.Media{}, "cid IN ?", []string{"purged_wallpaper", "purged_bob_avatar"}))
+	require.Equal(t, int64(1), count(&messengertypes.Media{}, "cid = ?", "alice_avatar"))
+	require.Equal(t, int64(1), count(&messengertypes.Device{}, "member_public_key = ?", "archived_alice"))
+	require.True(t, errcode.Is(db.PurgeLeftConversation("purged"), errcode.ErrNotFound))
+
+	// an archive can be purged later
+	require.NoError(t, db.PurgeLeftConversation("archived"))
+	require.Zero(t, count(&messengertypes.Interaction{}, "conversation_public_key = ?", "archived"))
+	require.Equal(t, int64(1), count(&messengertypes.Media{}, "cid = ?", "alice_avatar"))
+}
+
+func Test_dbWrapper_IterateConversationAuditRecords(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "alice", ConversationPublicKey: "conv1", DisplayName: "alice"}).Error)
+	for _, cid := range []string{"cid1", "cid2", "cid3"} {
+		_, _, err := db.AddInteraction(messengertypes.Interaction{CID: cid, ConversationPublicKey: "conv1", IsMine: true})
+		require.NoError(t, err)
+	}
+	_, _, err := db.AddInteraction(messengertypes.Interaction{CID: "cid_other", ConversationPublicKey: "conv2", IsMine: true})
+	require.NoError(t, err)
+
+	for _, r := range []*messengertypes.DeliveryReceipt{
+		{InteractionCID: "cid1", DevicePublicKey: "alice1", MemberPublicKey: "alice", DeliveredDate: 10, AcknowledgedDate: 15},
+		{InteractionCID: "cid1", DevicePublicKey: "bob1", MemberPublicKey: "bob", DeliveredDate: 20},
+		{InteractionCID: "cid2", DevicePublicKey: "alice1", MemberPublicKey: "alice", AcknowledgedDate: 30},
+		{InteractionCID: "cid3", DevicePublicKey: "alice1", MemberPublicKey: "alice", DeliveredDate: 40},
+		{InteractionCID: "cid_other", DevicePublicKey: "alice1", MemberPublicKey: "alice", DeliveredDate: 50},
+	} {
+		_, err := db.AddDeliveryReceipt(r)
+		require.NoError(t, err)
+	}
+
+	_, err = db.SetReadMarker(messengertypes.ReadMarker{ConversationPublicKey: "conv1", MemberPublicKey: "alice", InteractionCID: "cid3", ReadDate: 40, UpdatedDate: 60})
+	require.NoError(t, err)
+
+	batches := 0
+	records := []*messengertypes.ConversationAuditExport_Record(nil)
+	require.NoError(t, db.IterateConversationAuditRecords("conv1", 2, func(batch []*messengertypes.ConversationAuditExport_Record) error {
+		batches++
+		records = append(records, batch...)
+		return nil
+	}))
+
+	// two batches of receipts and the read markers
+	require.Equal(t, 3, batches)
+	require.Equal(t, []*messengertypes.ConversationAuditExport_Record{
+		{Kind: messengertypes.ConversationAuditExport_Record_KindDelivered, InteractionCID: "cid1", MemberPublicKey: "alice", MemberDisplayName: "alice", DevicePublicKey: "alice1", Date: 10},
+		{Kind: messengertypes.ConversationAuditExport_Record_KindAcknowledged, InteractionCID: "cid1", MemberPublicKey: "alice", MemberDisplayName: "alice", DevicePublicKey: "alice1", Date: 15},
+		{Kind: messengertypes.ConversationAuditExport_Record_KindDelivered, InteractionCID: "cid1", MemberPublicKey: "bob", DevicePublicKey: "bob1", Date: 20},
+		{Kind: messengertypes.ConversationAuditExport_Record_KindAcknowledged, InteractionCID: "cid2", MemberPublicKey: "alice", MemberDisplayName: "alice", DevicePublicKey: "alice1", Date: 30},
+		{Kind: messengertypes.ConversationAuditExport_Record_KindDelivered, InteractionCID: "cid3", MemberPublicKey: "alice", MemberDisplayName: "alice", DevicePublicKey: "alice1", Date: 40},
+		{Kind: messengertypes.ConversationAuditExport_Record_KindRead, InteractionCID: "cid3", MemberPublicKey: "alice", MemberDisplayName: "alice", Date: 60},
+	}, records)
+
+	require.Error(t, db.IterateConversationAuditRecords("", 2, func([]*messengertypes.ConversationAuditExport_Record) error { return nil }))
+}
+
+func Test_dbWrapper_ReceiptPrivacy(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	readReceipts, typing, err := db.GetReceiptPrivacy("conv1")
+	require.NoError(t, err)
+	require.False(t, readReceipts)
+	require.False(t, typing)
+
+	require.True(t, errcode.Is(db.SetReceiptPrivacy("conv1", true, false), errcode.ErrNotFound))
+
+	require.NoError(t, db.FirstOrCreateAccount("account", ""))
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv1"})
+	db.db.Create(&messengertypes.Conversation{PublicKey: "conv2"})
+
+	require.NoError(t, db.SetReceiptPrivacy("conv1", true, false))
+	readReceipts, typing, err = db.GetReceiptPrivacy("conv1")
+	require.NoError(t, err)
+	require.True(t, readReceipts)
+	require.False(t, typing)
+
+	// the account settings apply to every conversation
+	require.NoError(t, db.SetReceiptPrivacy("", false, true))
+	for _, convPK := range []string{"conv1", "conv2"} {
+		readReceipts, typing, err = db.GetReceiptPrivacy(convPK)
+		require.NoError(t, err)
+		require.Equal(t, convPK == "conv1", readReceipts)
+		require.True(t, typing)
+	}
+}
+
+func Test_dbWrapper_GetInteractionsSince(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "c1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "c2"}).Error)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: fmt.Sprintf("c1_i%02d", i), ConversationPublicKey: "c1", SentDate: int64(1000 + i)}).Error)
+	}
+	require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: "c2_i00", ConversationPublicKey: "c2", SentDate: 1000}).Error)
+
+	cidsOf := func(interactions []*messengertypes.Interaction) []string {
+		cids := []string(nil)
+		for _, inte := range interactions {
+			cids = append(cids, inte.CID)
+		}
+		return cids
+	}
+
+	// the gap is filled
+	interactions, truncated, err := db.GetInteractionsSince("c1", "c1_i06", 5)
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Equal(t, []string{"c1_i07", "c1_i08", "c1_i09"}, cidsOf(interactions))
+
+	// up to date
+	interactions, truncated, err = db.GetInteractionsSince("c1", "c1_i09", 5)
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Empty(t, interactions)
+
+	// the gap is too large, an unknown cid or one of another conversation is a gap too
+	for _, cid := range []string{"c1_i02", "unknown", "c2_i00"} {
+		interactions, truncated, err = db.GetInteractionsSince("c1", cid, 3)
+		require.NoError(t, err)
+		require.True(t, truncated)
+		require.Equal(t, []string{"c1_i07", "c1_i08", "c1_i09"}, cidsOf(interactions))
+	}
+
+	// the whole history fits
+	interactions, truncated, err = db.GetInteractionsSince("c2", "", 3)
+	require.NoError(t, err)
+	require.False(t, truncated)
+	require.Equal(t, []string{"c2_i00"}, cidsOf(interactions))
+}
+
+func Test_dbWrapper_GetBootSnapshot(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	snapshot, err := db.GetBootSnapshot(0)
+	require.NoError(t, err)
+	require.Nil(t, snapshot.Account)
+	require.Empty(t, snapshot.Conversations)
+
+	require.NoError(t, db.FirstOrCreateAccount("account", ""))
+	for i := 0; i < 3; i++ {
+		pk := fmt.Sprintf("c%d", i)
+		require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: pk, LastUpdate: int64(i), UnreadCount: int32(i)}).Error)
+		for j := 0; j < 2; j++ {
+			require.NoError(t, db.db.Create(&messengertypes.Interaction{CID: fmt.Sprintf("%s_i%d", pk, j), ConversationPublicKey: pk, SentDate: int64(10*i + j)}).Error)
+		}
+	}
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "contact1", State: messengertypes.Contact_IncomingRequest}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "contact2", State: messengertypes.Contact_Accepted}).Error)
+
+	snapshot, err = db.GetBootSnapshot(2)
+	require.NoError(t, err)
+	require.Equal(t, "account", snapshot.Account.PublicKey)
+
+	require.Len(t, snapshot.Conversations, 2)
+	require.Equal(t, "c2", snapshot.Conversations[0].PublicKey)
+	require.Equal(t, "c1", snapshot.Conversations[1].PublicKey)
+
+	require.Len(t, snapshot.LastInteractions, 2)
+	require.Equal(t, "c2_i1", snapshot.LastInteractions[0].CID)
+	require.Equal(t, "c1_i1", snapshot.LastInteractions[1].CID)
+
+	require.Equal(t, int64(2), snapshot.UnreadConversations)
+	require.Equal(t, int64(3), snapshot.UnreadCount)
+
+	require.Len(t, snapshot.ContactRequests, 1)
+	require.Equal(t, "contact1", snapshot.ContactRequests[0].PublicKey)
+}
+
+func Test_dbWrapper_Bookmarks(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	db.db.Create(&messengertypes.Interaction{CID: "i1", ConversationPublicKey: "conv1"})
+	db.db.Create(&messengertypes.Interaction{CID: "i2", ConversationPublicKey: "conv2"})
+
+	changed, err := db.SetBookmark(messengertypes.Bookmark{InteractionCID: "i1", ConversationPublicKey: "conv1", UpdatedDate: 10})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// the same update received from another device
+	changed, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "i1", ConversationPublicKey: "conv1", UpdatedDate: 10})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// not yet received by this device
+	changed, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "unknown", ConversationPublicKey: "conv2", UpdatedDate: 20})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	changed, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "i2", ConversationPublicKey: "conv2", UpdatedDate: 30})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	bookmarks, interactions, err := db.GetBookmarks("")
+	require.NoError(t, err)
+	require.Len(t, bookmarks, 3)
+	require.Equal(t, "i2", bookmarks[0].InteractionCID)
+	require.Len(t, interactions, 2)
+	require.Equal(t, "i2", interactions[0].CID)
+	require.Equal(t, "i1", interactions[1].CID)
+
+	// an older removal doesn't apply
+	changed, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "i2", UpdatedDate: 25, Removed: true})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	changed, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "i2", UpdatedDate: 35, Removed: true})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// the removal is kept so that the older bookmark isn't restored
+	changed, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "i2", ConversationPublicKey: "conv2", UpdatedDate: 30})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	bookmarks, interactions, err = db.GetBookmarks("conv2")
+	require.NoError(t, err)
+	require.Len(t, bookmarks, 1)
+	require.Equal(t, "unknown", bookmarks[0].InteractionCID)
+	require.Empty(t, interactions)
+}
+
+func Test_dbWrapper_GetDeliveryLatencyStats(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo1", Type: messengertypes.Conversation_ContactType, ContactPublicKey: "Contact1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "Convo2", Type: messengertypes.Conversation_MultiMemberType}).Error)
+
+	for _, i := range []*messengertypes.Interaction{
+		{CID: "Cid1", ConversationPublicKey: "Convo1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 1000, ReceivedDate: 1100},
+		{CID: "Cid2", ConversationPublicKey: "Convo1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 2000, ReceivedDate: 2300},
+		{CID: "Cid3", ConversationPublicKey: "Convo2", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 3000, ReceivedDate: 3050},
+		// not received live, sent by the account, skewed clock or not a user message
+		{CID: "Cid4", ConversationPublicKey: "Convo2", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 3000},
+		{CID: "Cid5", ConversationPublicKey: "Convo2", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 3000, ReceivedDate: 9000, IsMine: true},
+		{CID: "Cid6", ConversationPublicKey: "Convo2", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 5000, ReceivedDate: 4000},
+		{CID: "Cid7", ConversationPublicKey: "Convo2", Type: messengertypes.AppMessage_TypeAcknowledge, SentDate: 3000, ReceivedDate: 9000},
+	} {
+		require.NoError(t, db.db.Create(i).Error)
+	}
+
+	conversations, contacts, err := db.GetDeliveryLatencyStats(0)
+	require.NoError(t, err)
+	require.Equal(t, []*messengertypes.DeliveryLatencyStats_Latency{
+		{PublicKey: "Convo1", Count: 2, AverageMs: 200, MinMs: 100, MaxMs: 300},
+		{PublicKey: "Convo2", Count: 1, AverageMs: 50, MinMs: 50, MaxMs: 50},
+	}, conversations)
+	require.Equal(t, []*messengertypes.DeliveryLatencyStats_Latency{
+		{PublicKey: "Contact1", Count: 2, AverageMs: 200, MinMs: 100, MaxMs: 300},
+	}, contacts)
+
+	conversations, contacts, err = db.GetDeliveryLatencyStats(2000)
+	require.NoError(t, err)
+	require.Len(t, conversations, 2)
+	require.Equal(t, int64(1), conversations[0].Count)
+	require.Equal(t, int64(300), contacts[0].AverageMs)
+}
+
+func Test_dbWrapper_PinnedMessages(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	db.db.Create(&messengertypes.Interaction{CID: "i1", ConversationPublicKey: "conv1"})
+	db.db.Create(&messengertypes.Interaction{CID: "i2", ConversationPublicKey: "conv1"})
+
+	changed, err := db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i1", ConversationPublicKey: "conv1", MemberPublicKey: "member1", UpdatedDate: 10})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	changed, err = db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i2", ConversationPublicKey: "conv1", MemberPublicKey: "member2", UpdatedDate: 20})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// a pin can't move to another conversation
+	_, err = db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i2", ConversationPublicKey: "conv2", MemberPublicKey: "member2", UpdatedDate: 30})
+	require.Error(t, err)
+
+	pinned, interactions, err := db.GetPinnedMessages("conv1")
+	require.NoError(t, err)
+	require.Len(t, pinned, 2)
+	require.Equal(t, "i2", pinned[0].InteractionCID)
+	require.Equal(t, []string{"i2", "i1"}, []string{interactions[0].CID, interactions[1].CID})
+
+	// a concurrent unpin wins over a pin, whatever the order they are received in
+	changed, err = db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i1", ConversationPublicKey: "conv1", MemberPublicKey: "member2", UpdatedDate: 10, Removed: true})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	changed, err = db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i1", ConversationPublicKey: "conv1", MemberPublicKey: "member1", UpdatedDate: 10})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// the unpin is kept so that the older pin isn't restored
+	changed, err = db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i2", ConversationPublicKey: "conv1", MemberPublicKey: "member1", UpdatedDate: 40, Removed: true})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	changed, err = db.SetPinnedMessage(messengertypes.PinnedMessage{InteractionCID: "i2", ConversationPublicKey: "conv1", MemberPublicKey: "member2", UpdatedDate: 20})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	pinned, interactions, err = db.GetPinnedMessages("conv1")
+	require.NoError(t, err)
+	require.Empty(t, pinned)
+	require.Empty(t, interactions)
+
+	_, _, err = db.GetPinnedMessages("")
+	require.Error(t, err)
+}
+
+func Test_dbWrapper_ConversationSessions(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	now := time.Now()
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "convo_a", LocalDevicePublicKey: "device_a", UnreadCount: 3}).Error)
+
+	_, _, err := db.OpenConversationSession("unknown", "session_1", now)
+	require.Error(t, err)
+
+	conv, opened, err := db.OpenConversationSession("convo_a", "session_1", now)
+	require.NoError(t, err)
+	require.True(t, opened)
+	require.True(t, conv.IsOpen)
+	require.Zero(t, conv.UnreadCount)
+
+	// a heartbeat doesn't reopen the conversation
+	_, opened, err = db.OpenConversationSession("convo_a", "session_1", now.Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, opened)
+
+	session := &messengertypes.ConversationSession{}
+	require.NoError(t, db.db.First(session, &messengertypes.ConversationSession{ConversationPublicKey: "convo_a", SessionID: "session_1"}).Error)
+	require.Equal(t, "device_a", session.DevicePublicKey)
+	require.Equal(t, messengerutil.TimestampMs(now), session.OpenedDate)
+	require.Equal(t, messengerutil.TimestampMs(now.Add(time.Minute)), session.HeartbeatDate)
+
+	// the conversation stays open while another session is
+	_, _, err = db.OpenConversationSession("convo_a", "session_2", now.Add(time.Minute))
+	require.NoError(t, err)
+	_, closed, err := db.CloseConversationSession("convo_a", "session_2", now.Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, closed)
+
+	opened, err = db.IsConversationOpened("convo_a")
+	require.NoError(t, err)
+	require.True(t, opened)
+
+	// a session without heartbeat is considered closed before being expired
+	later := now.Add(time.Minute + messengertypes.ConversationSessionTTL + time.Second)
+	closedConvs, err := db.ExpireConversationSessions(now)
+	require.NoError(t, err)
+	require.Empty(t, closedConvs)
+
+	count := int64(0)
+	require.NoError(t, liveSessions(db.db, later).Count(&count).Error)
+	require.Zero(t, count)
+
+	closedConvs, err = db.ExpireConversationSessions(later)
+	require.NoError(t, err)
+	require.Len(t, closedConvs, 1)
+	require.False(t, closedConvs[0].IsOpen)
+
+	// the session without id never expires
+	_, opened, err = db.OpenConversationSession("convo_a", "", now)
+	require.NoError(t, err)
+	require.True(t, opened)
+
+	closedConvs, err = db.ExpireConversationSessions(later.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, closedConvs)
+
+	_, closed, err = db.CloseConversationSession("convo_a", "", later)
+	require.NoError(t, err)
+	require.True(t, closed)
+}
+
+func Test_dbWrapper_SetMemberLocation(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, _, err := db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv"})
+	require.Error(t, err)
+
+	// a stop without a share is ignored
+	_, changed, err := db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "member", CID: "share", Live: true, Stopped: true, StateDate: 1})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, changed, err = db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "member", CID: "share", Live: true, Latitude: 1, Longitude: 2, StateDate: 10})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// an older position is ignored
+	_, changed, err = db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "member", CID: "once", Latitude: 5, Longitude: 5, StateDate: 5})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, changed, err = db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "member", CID: "share", Live: true, Latitude: 3, Longitude: 4, StateDate: 20})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// a stop received late still ends the share and keeps its last coordinates
+	stopped, changed, err := db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "member", CID: "share", Live: true, Stopped: true, StateDate: 15})
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, float64(3), stopped.GetLatitude())
+	require.Equal(t, int64(20), stopped.GetStateDate())
+
+	// the stopped share can't be updated anymore
+	_, changed, err = db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "member", CID: "share", Live: true, Latitude: 7, Longitude: 8, StateDate: 30})
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	_, changed, err = db.SetMemberLocation(messengertypes.MemberLocation{ConversationPublicKey: "conv", MemberPublicKey: "other", CID: "other-once", Latitude: -1, Longitude: -2, StateDate: 30})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	locations, err := db.GetMemberLocations("conv")
+	require.NoError(t, err)
+	require.Len(t, locations, 2)
+	require.Equal(t, "member", locations[0].GetMemberPublicKey())
+	require.True(t, locations[0].GetStopped())
+	require.Equal(t, float64(4), locations[0].GetLongitude())
+	require.Equal(t, "other", locations[1].GetMemberPublicKey())
+
+	// a retracted position is forgotten
+	_, err = db.RetractInteraction("other-once")
+	require.NoError(t, err)
+
+	locations, err = db.GetMemberLocations("conv")
+	require.NoError(t, err)
+	require.Len(t, locations, 1)
+}
+
+func Test_dbWrapper_PurgeExpiredInteractions(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.UpdateConversation(messengertypes.Conversation{PublicKey: "conv"})
+	require.NoError(t, err)
+
+	changed, err := db.SetConversationEphemeralPolicy("conv", 60, 1000)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// an older policy is ignored, a concurrent one keeps the shortest ttl
+	changed, err = db.SetConversationEphemeralPolicy("conv", 0, 500)
+	require.NoError(t, err)
+	require.False(t, changed)
+	changed, err = db.SetConversationEphemeralPolicy("conv", 120, 1000)
+	require.NoError(t, err)
+	require.False(t, changed)
+	changed, err = db.SetConversationEphemeralPolicy("conv", 30, 1000)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// only the messages sent after the policy disappear
+	before, _, err := db.AddInteraction(messengertypes.Interaction{CID: "before", ConversationPublicKey: "conv", SentDate: 900, Type: messengertypes.AppMessage_TypeUserMessage})
+	require.NoError(t, err)
+	require.Zero(t, before.GetExpiresDate())
+
+	after, _, err := db.AddInteraction(messengertypes.Interaction{CID: "after", ConversationPublicKey: "conv", SentDate: 2000, Type: messengertypes.AppMessage_TypeUserMessage})
+	require.NoError(t, err)
+	require.Equal(t, int64(32000), after.GetExpiresDate())
+
+	_, err = db.SetBookmark(messengertypes.Bookmark{InteractionCID: "after", ConversationPublicKey: "conv", UpdatedDate: 1})
+	require.NoError(t, err)
+
+	expired, err := db.PurgeExpiredInteractions(31999)
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	expired, err = db.PurgeExpiredInteractions(32000)
+	require.NoError(t, err)
+	require.Len(t, expired, 1)
+	require.Equal(t, "after", expired[0].GetCID())
+	require.Equal(t, "conv", expired[0].GetConversationPublicKey())
+
+	_, err = db.GetInteractionByCID("after")
+	require.Error(t, err)
+	_, err = db.GetInteractionByCID("before")
+	require.NoError(t, err)
+
+	bookmarks, _, err := db.GetBookmarks("conv")
+	require.NoError(t, err)
+	require.Empty(t, bookmarks)
+}
+
+func Test_dbWrapper_MissingInteractions(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	added, err := db.AddMissingInteraction(&messengertypes.MissingInteraction{CID: "cid1", ConversationPublicKey: "conv1", ReferencedByCID: "reply1", NextAttemptDate: 10})
+	require.NoError(t, err)
+	require.True(t, added)
+
+	// the first reference is kept
+	added, err = db.AddMissingInteraction(&messengertypes.MissingInteraction{CID: "cid1", ConversationPublicKey: "conv1", ReferencedByCID: "reply2", NextAttemptDate: 5})
+	require.NoError(t, err)
+	require.False(t, added)
+
+	_, err = db.AddMissingInteraction(&messengertypes.MissingInteraction{CID: "cid2", ConversationPublicKey: "conv1", NextAttemptDate: 20})
+	require.NoError(t, err)
+
+	due, err := db.GetDueMissingInteractions(15, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "reply1", due[0].ReferencedByCID)
+
+	// a given up interaction is never due again
+	require.NoError(t, db.SetMissingInteractionAttempt("cid1", 5, 0))
+	due, err = db.GetDueMissingInteractions(100, 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "cid2", due[0].CID)
+
+	// receiving the interaction resolves it
+	_, _, err = db.AddInteraction(messengertypes.Interaction{CID: "cid2", ConversationPublicKey: "conv1"})
+	require.NoError(t, err)
+	due, err = db.GetDueMissingInteractions(100, 10)
+	require.NoError(t, err)
+	require.Empty(t, due)
+}
+
+func Test_dbWrapper_LinkPreviews(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.Error(t, db.SaveLinkPreview(&messengertypes.LinkPreview{}))
+
+	payload, err := proto.Marshal(&messengertypes.AppMessage_UserMessage{Body: "https://example.com/a https://example.com/b https://example.com/c"})
+	require.NoError(t, err)
+	_, _, err = db.AddInteraction(messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, Payload: payload})
+	require.NoError(t, err)
+
+	i, err := db.GetAugmentedInteraction("cid1")
+	require.NoError(t, err)
+	require.Empty(t, i.LinkPreviews)
+
+	require.NoError(t, db.SaveLinkPreview(&messengertypes.LinkPreview{URL: "https://example.com/c", Title: "c"}))
+	require.NoError(t, db.SaveLinkPreview(&messengertypes.LinkPreview{URL: "https://example.com/b", Failed: true}))
+	require.NoError(t, db.SaveLinkPreview(&messengertypes.LinkPreview{URL: "https://example.com/a", Title: "old"}))
+	require.NoError(t, db.SaveLinkPreview(&messengertypes.LinkPreview{URL: "https://example.com/a", Title: "a"}))
+
+	previews, err := db.GetLinkPreviews([]string{"https://example.com/a", "https://example.com/b"})
+	require.NoError(t, err)
+	require.Len(t, previews, 2)
+
+	// the failed previews are omitted, the others follow the links order
+	i, err = db.GetAugmentedInteraction("cid1")
+	require.NoError(t, err)
+	require.Len(t, i.LinkPreviews, 2)
+	require.Equal(t, "a", i.LinkPreviews[0].Title)
+	require.Equal(t, "c", i.LinkPreviews[1].Title)
+}
+
+func Test_dbWrapper_ConversationDraft(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.SaveConversationDraft(&messengertypes.ConversationDraft{ConversationPublicKey: "conv", Body: "hello"})
+	require.Equal(t, errcode.ErrNotFound, errcode.Code(err))
+
+	_, err = db.UpdateConversation(messengertypes.Conversation{PublicKey: "conv"})
+	require.NoError(t, err)
+
+	draft, err := db.GetConversationDraft("conv")
+	require.NoError(t, err)
+	require.Nil(t, draft)
+
+	refs := func(refs ...string) []*messengertypes.ConversationDraftMediaRef {
+		ret := make([]*messengertypes.ConversationDraftMediaRef, len(refs))
+		for i, ref := range refs {
+			ret[i] = &messengertypes.ConversationDraftMediaRef{Ref: ref}
+		}
+		return ret
+	}
+
+	draft, err = db.SaveConversationDraft(&messengertypes.ConversationDraft{ConversationPublicKey: "conv", Body: "hello", TargetCID: "cid1", MediaRefs: refs("b", "a", "c"), UpdatedDate: 10})
+	require.NoError(t, err)
+	require.Equal(t, "hello", draft.Body)
+	require.Len(t, draft.MediaRefs, 3)
+
+	// the draft is replaced, the references are kept in their order
+	_, err = db.SaveConversationDraft(&messengertypes.ConversationDraft{ConversationPublicKey: "conv", Body: "hello again", MediaRefs: refs("c", "b"), UpdatedDate: 20})
+	require.NoError(t, err)
+
+	conv, err := db.GetConversationByPK("conv")
+	require.NoError(t, err)
+	require.Equal(t, "hello again", conv.Draft.Body)
+	require.Empty(t, conv.Draft.TargetCID)
+	require.Equal(t, int64(20), conv.Draft.UpdatedDate)
+	require.Len(t, conv.Draft.MediaRefs, 2)
+	require.Equal(t, "c", conv.Draft.MediaRefs[0].Ref)
+	require.Equal(t, "b", conv.Draft.MediaRefs[1].Ref)
+
+	// an empty draft removes it
+	draft, err = db.SaveConversationDraft(&messengertypes.ConversationDraft{ConversationPublicKey: "conv", UpdatedDate: 30})
+	require.NoError(t, err)
+	require.Nil(t, draft)
+
+	conv, err = db.GetConversationByPK("conv")
+	require.NoError(t, err)
+	require.Nil(t, conv.Draft)
+
+	count := int64(0)
+	require.NoError(t, db.db.Model(&messengertypes.ConversationDraftMediaRef{}).Count(&count).Error)
+	require.Zero(t, count)
+}
+
+func Test_dbWrapper_ConvertContactIntroduction(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	// nothing is done without an introduction
+	_, err := db.AddContactRequestIncomingReceived("contact1", "alice", "conv1")
+	require.NoError(t, err)
+	_, err = db.AddContactRequestIncomingAccepted("contact1", "conv1")
+	require.NoError(t, err)
+	inte, err := db.ConvertContactIntroduction("contact1", false)
+	require.NoError(t, err)
+	require.Nil(t, inte)
+
+	contact, err := db.AddContactRequestIncomingReceived("contact2", "bob", "conv2")
+	require.NoError(t, err)
+	require.NoError(t, db.SetContactIntroduction("contact2", "hi, it's bob"))
+
+	// the request must be accepted first
+	_, err = db.ConvertContactIntroduction("contact2", false)
+	require.True(t, errcode.Is(err, errcode.ErrInvalidInput))
+
+	_, err = db.AddContactRequestIncomingAccepted("contact2", "conv2")
+	require.NoError(t, err)
+	inte, err = db.ConvertContactIntroduction("contact2", false)
+	require.NoError(t, err)
+	require.NotNil(t, inte)
+	require.Equal(t, "conv2", inte.GetConversationPublicKey())
+	require.Equal(t, messengertypes.AppMessage_TypeUserMessage, inte.GetType())
+	require.Equal(t, contact.GetCreatedDate(), inte.GetSentDate())
+	require.False(t, inte.GetIsMine())
+
+	payload := &messengertypes.AppMessage_UserMessage{}
+	require.NoError(t, proto.Unmarshal(inte.GetPayload(), payload))
+	require.Equal(t, "hi, it's bob", payload.GetBody())
+
+	// the introduction is only converted once
+	contact, err = db.GetContactByPK("contact2")
+	require.NoError(t, err)
+	require.Empty(t, contact.GetIntroduction())
+	inte, err = db.ConvertContactIntroduction("contact2", false)
+	require.NoError(t, err)
+	require.Nil(t, inte)
+
+	_, err = db.ConvertContactIntroduction("unknown", false)
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
+
+func Test_dbWrapper_RegisterMetrics(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	// the transactions made before the registration aren't observed
+	require.NoError(t, db.TX(db.ctx, func(*DBWrapper) error { return nil }))
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, db.RegisterMetrics(reg))
+	require.Error(t, db.RegisterMetrics(reg))
+
+	require.NoError(t, db.TX(db.ctx, func(tx *DBWrapper) error {
+		_, err := tx.AddOutboxEvent(messengertypes.StreamEvent_TypeConversationUpdated, []byte("payload"), false, "")
+		if err != nil {
+			return err
+		}
+
+		// the nested transactions are part of their parent
+		return tx.TX(tx.ctx, func(*DBWrapper) error { return nil })
+	}))
+	require.Error(t, db.DisableFTS().TX(db.ctx, func(*DBWrapper) error { return errcode.ErrInternal }))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	outcomes := map[string]uint64{}
+	for _, m := range families[0].GetMetric() {
+		outcomes[m.GetLabel()[0].GetValue()] = m.GetHistogram().GetSampleCount()
+	}
+	require.Equal(t, map[string]uint64{"success": 1, "error": 1}, outcomes)
+
+	count, err := db.CountOutboxEvents()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), count)
+
+	_, err = db.EnqueueInteraction(messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1"}, []byte("payload"))
+	require.NoError(t, err)
+	_, err = db.EnqueueInteraction(messengertypes.Interaction{CID: "cid2", ConversationPublicKey: "conv2"}, []byte("payload"))
+	require.NoError(t, err)
+	count, err = db.CountAllQueuedMessages()
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+}
+
+func Test_dbWrapper_ContactKeyHistory(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	_, err := db.GetContactKeyHistory("unknown")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "contact1", DisplayName: "Alice", ConversationPublicKey: "conv1"}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Contact{PublicKey: "contact2", ConversationPublicKey: "conv2"}).Error)
+
+	// a device known before the devices were dated, and dated from the log
+	require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: "device1", MemberPublicKey: "contact1"}).Error)
+	require.NoError(t, db.AddDeviceKeyEvent(&messengertypes.DeviceKeyEvent{Type: messengertypes.DeviceKeyEvent_Added, DevicePublicKey: "device1", MemberPublicKey: "contact1", EventCID: "event1", Date: 10}))
+
+	// a device added later
+	require.NoError(t, db.db.Create(&messengertypes.Device{PublicKey: "device2", MemberPublicKey: "contact1", FirstSeenDate: 20}).Error)
+	require.NoError(t, db.AddDeviceKeyEvent(&messengertypes.DeviceKeyEvent{Type: messengertypes.DeviceKeyEvent_Added, DevicePublicKey: "device2", MemberPublicKey: "contact1", EventCID: "event2", Date: 20}))
+
+	// another member claiming a device of the contact, replayed
+	conflict := &messengertypes.DeviceKeyEvent{Type: messengertypes.DeviceKeyEvent_Conflict, DevicePublicKey: "device1", MemberPublicKey: "member3", EventCID: "event3", Date: 30}
+	require.NoError(t, db.AddDeviceKeyEvent(conflict))
+	require.NoError(t, db.AddDeviceKeyEvent(conflict))
+
+	require.Error(t, db.AddDeviceKeyEvent(&messengertypes.DeviceKeyEvent{DevicePublicKey: "device1", MemberPublicKey: "contact1"}))
+	require.Error(t, db.AddDeviceKeyEvent(&messengertypes.DeviceKeyEvent{Type: messengertypes.DeviceKeyEvent_Added, MemberPublicKey: "contact1"}))
+
+	history, err := db.GetContactKeyHistory("")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	require.Equal(t, "contact1", history[0].PublicKey)
+	require.Equal(t, "Alice", history[0].DisplayName)
+	require.Equal(t, "conv1", history[0].ConversationPublicKey)
+	require.Equal(t, int64(10), history[0].PinnedDate)
+	require.Len(t, history[0].Keys, 2)
+	require.Equal(t, "device1", history[0].Keys[0].DevicePublicKey)
+	require.Equal(t, int64(10), history[0].Keys[0].FirstSeenDate)
+	require.True(t, history[0].Keys[0].Pinned)
+	require.Equal(t, "device2", history[0].Keys[1].DevicePublicKey)
+	require.False(t, history[0].Keys[1].Pinned)
+
+	require.Len(t, history[0].Changes, 2)
+	require.Equal(t, messengertypes.DeviceKeyEvent_Added, history[0].Changes[0].Type)
+	require.Equal(t, "device2", history[0].Changes[0].DevicePublicKey)
+	require.Equal(t, messengertypes.DeviceKeyEvent_Conflict, history[0].Changes[1].Type)
+	require.Equal(t, "member3", history[0].Changes[1].MemberPublicKey)
+
+	require.Equal(t, "contact2", history[1].PublicKey)
+	require.Empty(t, history[1].Keys)
+	require.Empty(t, history[1].Changes)
+
+	history, err = db.GetContactKeyHistory("contact2")
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+}
+
+func Test_dbWrapper_SlowMode(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.db.Create(&messengertypes.Conversation{PublicKey: "conv1", Type: messengertypes.Conversation_MultiMemberType}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "admin", ConversationPublicKey: "conv1", IsCreator: true}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "me", ConversationPublicKey: "conv1", IsMe: true}).Error)
+	require.NoError(t, db.db.Create(&messengertypes.Member{PublicKey: "member1", ConversationPublicKey: "conv1"}).Error)
+
+	admin, err := db.IsConversationAdmin("conv1", "admin", false)
+	require.NoError(t, err)
+	require.True(t, admin)
+	admin, err = db.IsConversationAdmin("conv1", "", true)
+	require.NoError(t, err)
+	require.False(t, admin)
+
+	// the most recent setting wins, the longest interval at the same date
+	changed, err := db.SetConversationSlowMode("conv1", 10, 1000)
+	require.NoError(t, err)
+	require.True(t, changed)
+	changed, err = db.SetConversationSlowMode("conv1", 60, 500)
+	require.NoError(t, err)
+	require.False(t, changed)
+	changed, err = db.SetConversationSlowMode("conv1", 5, 1000)
+	require.NoError(t, err)
+	require.False(t, changed)
+	changed, err = db.SetConversationSlowMode("conv1", 30, 1000)
+	require.NoError(t, err)
+	require.True(t, changed)
+	_, err = db.SetConversationSlowMode("conv1", -1, 2000)
+	require.Error(t, err)
+
+	conv, err := db.GetConversationByPK("conv1")
+	require.NoError(t, err)
+	require.Equal(t, int64(30), conv.SlowModeInterval)
+	require.Equal(t, int64(1000), conv.SlowModeDate)
+
+	_, _, err = db.AddInteraction(messengertypes.Interaction{CID: "mine1", ConversationPublicKey: "conv1", Type: messengertypes.AppMessage_TypeUserMessage, IsMine: true, SentDate: 2000})
+	require.NoError(t, err)
+
+	wait, err := db.SlowModeWait("conv1", "", true, 12000)
+	require.NoError(t, err)
+	require.Equal(t, int64(20000), wait)
+	wait, err = db.SlowModeWait("conv1", "", true, 32000)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// the messages of others sent too soon are flagged, the other types and
+	// the admins are not concerned
+	i, _, err := db.AddInteraction(messengertypes.Interaction{CID: "other1", ConversationPublicKey: "conv1", MemberPublicKey: "member1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 2000})
+	require.NoError(t, err)
+	require.False(t, i.SlowModeViolation)
+	i, _, err = db.AddInteraction(messengertypes.Interaction{CID: "other2", ConversationPublicKey: "conv1", MemberPublicKey: "member1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 3000})
+	require.NoError(t, err)
+	require.True(t, i.SlowModeViolation)
+	i, _, err = db.AddInteraction(messengertypes.Interaction{CID: "other3", ConversationPublicKey: "conv1", MemberPublicKey: "member1", Type: messengertypes.AppMessage_TypePollVote, SentDate: 4000})
+	require.NoError(t, err)
+	require.False(t, i.SlowModeViolation)
+	i, _, err = db.AddInteraction(messengertypes.Interaction{CID: "other4", ConversationPublicKey: "conv1", MemberPublicKey: "member1", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 40000})
+	require.NoError(t, err)
+	require.False(t, i.SlowModeViolation)
+
+	_, _, err = db.AddInteraction(messengertypes.Interaction{CID: "admin1", ConversationPublicKey: "conv1", MemberPublicKey: "admin", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 2000})
+	require.NoError(t, err)
+	i, _, err = db.AddInteraction(messengertypes.Interaction{CID: "admin2", ConversationPublicKey: "conv1", MemberPublicKey: "admin", Type: messengertypes.AppMessage_TypeUserMessage, SentDate: 3000})
+	require.NoError(t, err)
+	require.False(t, i.SlowModeViolation)
+
+	// disabled
+	changed, err = db.SetConversationSlowMode("conv1", 0, 5000)
+	require.NoError(t, err)
+	require.True(t, changed)
+	wait, err = db.SlowModeWait("conv1", "", true, 12000)
+	require.NoError(t, err)
+	require.Zero(t, wait)
+}
+
+func Test_dbWrapper_WithLogFields(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	core, logs := observer.New(zap.DebugLevel)
+	db.log = zap.New(core)
+
+	// the fields are kept in the transactions
+	require.NoError(t, db.WithLogFields(zap.String("event", "event_cid")).TX(context.Background(), func(tx *DBWrapper) error {
+		tx.log.Info("in transaction")
+		return nil
+	}))
+	db.log.Info("without fields")
+
+	entries := logs.FilterMessage("in transaction").All()
+	require.Len(t, entries, 1)
+	require.Equal(t, "event_cid", entries[0].ContextMap()["event"])
+
+	entries = logs.FilterMessage("without fields").All()
+	require.Len(t, entries, 1)
+	require.NotContains(t, entries[0].ContextMap(), "event")
+}
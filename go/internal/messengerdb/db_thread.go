@@ -0,0 +1,105 @@
+package messengerdb
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GetThreadRootCID returns the root of the thread a reply to targetCID joins,
+// the target is the root if it isn't a reply itself or isn't known yet
+func (d *DBWrapper) GetThreadRootCID(targetCID string) (string, error) {
+	if targetCID == "" {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("a target cid is required"))
+	}
+
+	target := &messengertypes.Interaction{}
+	err := d.db.Select("cid", "thread_root_cid").First(target, &messengertypes.Interaction{CID: targetCID}).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return targetCID, nil
+	} else if err != nil {
+		return "", errcode.ErrDBRead.Wrap(err)
+	}
+
+	if target.ThreadRootCID != "" {
+		return target.ThreadRootCID, nil
+	}
+
+	return targetCID, nil
+}
+
+// MoveThreadReplies attaches the replies rooted on fromCID to the thread of
+// toCID, for a reply received after the replies to it. It returns the cids of
+// the moved replies.
+func (d *DBWrapper) MoveThreadReplies(fromCID, toCID string) ([]string, error) {
+	if fromCID == "" || toCID == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the cids of both threads are required"))
+	}
+
+	if fromCID == toCID {
+		return nil, nil
+	}
+
+	cids := []string(nil)
+	if err := d.db.Model(&messengertypes.Interaction{}).Where("thread_root_cid = ?", fromCID).Pluck("cid", &cids).Error; err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(cids) == 0 {
+		return nil, nil
+	}
+
+	if err := d.db.Model(&messengertypes.Interaction{}).Where("cid IN ?", cids).Update("thread_root_cid", toCID).Error; err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return cids, nil
+}
+
+// GetThread returns the thread cid belongs to: the cid of its root, the root
+// itself if it is known and the replies ordered by sent date. The direct
+// replies stored before the threads were tracked are included.
+func (d *DBWrapper) GetThread(cid string) (string, *messengertypes.Interaction, []*messengertypes.Interaction, error) {
+	i, err := d.GetInteractionByCID(cid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil, nil, errcode.ErrNotFound.Wrap(err)
+		}
+		return "", nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	rootCID := i.GetCID()
+	switch {
+	case i.GetThreadRootCID() != "":
+		rootCID = i.GetThreadRootCID()
+	case i.GetTargetCID() != "" && i.GetType() == messengertypes.AppMessage_TypeUserMessage:
+		rootCID = i.GetTargetCID()
+	}
+
+	root := i
+	if rootCID != i.GetCID() {
+		root, err = d.GetInteractionByCID(rootCID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			root = nil
+		} else if err != nil {
+			return "", nil, nil, errcode.ErrDBRead.Wrap(err)
+		}
+	}
+
+	replies := []*messengertypes.Interaction(nil)
+	if err := d.db.
+		Preload(clause.Associations).
+		Where("type = ? AND (thread_root_cid = ? OR target_cid = ?)", messengertypes.AppMessage_TypeUserMessage, rootCID, rootCID).
+		Order("sent_date, cid").
+		Find(&replies).
+		Error; err != nil {
+		return "", nil, nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return rootCID, root, replies, nil
+}
@@ -0,0 +1,129 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"gorm.io/gorm/clause"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// SetConversationAutoTranslateLanguage sets the language incoming messages of
+// a conversation are translated to, an empty language disables it
+func (d *DBWrapper) SetConversationAutoTranslateLanguage(pk string, language string) error {
+	if pk == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	db := d.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: pk}).Update("auto_translate_language", language)
+	if db.Error != nil {
+		return errcode.ErrDBWrite.Wrap(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", pk))
+	}
+
+	return nil
+}
+
+// GetInteractionTranslation returns the stored translation of an interaction
+// in the given language
+func (d *DBWrapper) GetInteractionTranslation(cid string, language string) (*messengertypes.InteractionTranslation, error) {
+	if cid == "" || language == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a language are required"))
+	}
+
+	translation := &messengertypes.InteractionTranslation{}
+	return translation, d.db.First(translation, &messengertypes.InteractionTranslation{InteractionCID: cid, Language: language}).Error
+}
+
+// SaveInteractionTranslation stores a translation alongside its interaction,
+// replacing a previous translation in the same language
+func (d *DBWrapper) SaveInteractionTranslation(translation *messengertypes.InteractionTranslation) error {
+	if translation.GetInteractionCID() == "" || translation.GetLanguage() == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid and a language are required"))
+	}
+
+	if err := d.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(translation).Error; err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+// languageHintSampleSize is the number of recent messages the language hint of
+// a conversation is inferred from
+const languageHintSampleSize = 20
+
+// SetConversationLanguageHint sets the language a conversation is written in,
+// an empty language lets it be inferred from the recent messages again
+func (d *DBWrapper) SetConversationLanguageHint(pk string, language string) (*messengertypes.Conversation, error) {
+	if pk == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	db := d.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: pk}).Updates(map[string]interface{}{
+		"language_hint":        language,
+		"language_hint_manual": language != "",
+	})
+	if db.Error != nil {
+		return nil, errcode.ErrDBWrite.Wrap(db.Error)
+	}
+	if db.RowsAffected == 0 {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", pk))
+	}
+
+	if language == "" {
+		conv, _, err := d.InferConversationLanguageHint(pk)
+		return conv, err
+	}
+
+	return d.GetConversationByPK(pk)
+}
+
+// InferConversationLanguageHint updates the language hint of a conversation
+// from its recent messages, unless it was set manually. It returns true if the
+// hint changed.
+func (d *DBWrapper) InferConversationLanguageHint(pk string) (*messengertypes.Conversation, bool, error) {
+	conv, err := d.GetConversationByPK(pk)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if conv.GetLanguageHintManual() {
+		return conv, false, nil
+	}
+
+	payloads := [][]byte(nil)
+	if err := d.db.Model(&messengertypes.Interaction{}).
+		Where("conversation_public_key = ? AND type = ?", pk, messengertypes.AppMessage_TypeUserMessage).
+		Order("sent_date DESC").
+		Limit(languageHintSampleSize).
+		Pluck("payload", &payloads).Error; err != nil {
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	texts := make([]string, 0, len(payloads))
+	for _, payload := range payloads {
+		var msg messengertypes.AppMessage_UserMessage
+		if err := proto.Unmarshal(payload, &msg); err != nil {
+			continue
+		}
+		texts = append(texts, msg.GetBody())
+	}
+
+	language := messengerutil.InferLanguage(texts...)
+	if language == "" || language == conv.GetLanguageHint() {
+		return conv, false, nil
+	}
+
+	if err := d.db.Model(&messengertypes.Conversation{}).Where(&messengertypes.Conversation{PublicKey: pk}).Update("language_hint", language).Error; err != nil {
+		return nil, false, errcode.ErrDBWrite.Wrap(err)
+	}
+	conv.LanguageHint = language
+
+	return conv, true, nil
+}
@@ -0,0 +1,80 @@
+package messengerdb
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// unreadInteractionTypes are the interaction types incrementing the unread
+// counter of a conversation, they match the visible events of the event handler
+var unreadInteractionTypes = []messengertypes.AppMessage_Type{
+	messengertypes.AppMessage_TypeUserMessage,
+	messengertypes.AppMessage_TypeGroupInvitation,
+	messengertypes.AppMessage_TypeContactShare,
+	messengertypes.AppMessage_TypeAccountDeleted,
+	messengertypes.AppMessage_TypeCallOffer,
+}
+
+// RecomputeUnreadCounts rebuilds the unread counter of a conversation, or of
+// every conversation if pk is empty, from the incoming interactions received
+// after its read marker. It returns the conversations whose counter changed.
+func (d *DBWrapper) RecomputeUnreadCounts(pk string) ([]*messengertypes.Conversation, error) {
+	updated := []*messengertypes.Conversation(nil)
+
+	if err := d.TX(d.ctx, func(tx *DBWrapper) error {
+		conversations := []*messengertypes.Conversation(nil)
+
+		query := tx.db.Model(&messengertypes.Conversation{})
+		if pk != "" {
+			query = query.Where(&messengertypes.Conversation{PublicKey: pk})
+		}
+		if err := query.Find(&conversations).Error; err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if pk != "" && len(conversations) == 0 {
+			return errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", pk))
+		}
+
+		for _, conv := range conversations {
+			count := int64(0)
+
+			// an open conversation is being read
+			if !conv.IsOpen {
+				if err := tx.db.
+					Model(&messengertypes.Interaction{}).
+					Where("conversation_public_key = ? AND is_mine = false AND type IN ? AND sent_date > ?", conv.PublicKey, unreadInteractionTypes, conv.LastReadDate).
+					Count(&count).
+					Error; err != nil {
+					return errcode.ErrDBRead.Wrap(err)
+				}
+			}
+
+			if int64(conv.UnreadCount) == count {
+				continue
+			}
+
+			if err := tx.db.
+				Model(&messengertypes.Conversation{}).
+				Where(&messengertypes.Conversation{PublicKey: conv.PublicKey}).
+				Update("unread_count", count).
+				Error; err != nil {
+				return errcode.ErrDBWrite.Wrap(err)
+			}
+
+			conv, err := tx.GetConversationByPK(conv.PublicKey)
+			if err != nil {
+				return errcode.ErrDBRead.Wrap(err)
+			}
+			updated = append(updated, conv)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
@@ -1,10 +1,12 @@
 package messengerdb
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
 	sqlite "github.com/flyingtime/gorm-sqlcipher"
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
 	"go.uber.org/multierr"
 	"gorm.io/gorm"
 
@@ -21,11 +23,33 @@ type ColumnInfo struct {
 	PK        string
 }
 
+// isSQLite reports whether db uses the SQLite dialect, the other ones (i.e.
+// Postgres) have no rowid, pragmas, sqlite_master nor fts5 tables
+func isSQLite(db *gorm.DB) bool {
+	return db.Dialector.Name() == "sqlite"
+}
+
+// insertionOrder returns the clause ordering rows by insertion, using the
+// rowid on SQLite and fallback on the other dialects
+func insertionOrder(db *gorm.DB, fallback string) string {
+	if isSQLite(db) {
+		return "ROWID"
+	}
+
+	return fallback
+}
+
 func ensureSeamlessDBUpdate(db *gorm.DB, models []interface{}) error {
 	if err := db.AutoMigrate(models...); err != nil {
 		return err
 	}
 
+	// the schemas are compared with the ones of SQLite, the other dialects
+	// rely on the automatic migration only
+	if !isSQLite(db) {
+		return nil
+	}
+
 	schemasDisk, err := getDBTablesSchemas(db)
 	if err != nil {
 		return err
@@ -39,7 +63,50 @@ func ensureSeamlessDBUpdate(db *gorm.DB, models []interface{}) error {
 	return compareDBSchema(schemasDisk, schemasExpected)
 }
 
+// CheckDBIntegrity runs a quick integrity check on the database, any
+// reported problem or SQLITE_CORRUPT failure is returned as ErrDBCorrupted.
+// The other dialects are checked by their server and always pass.
+func CheckDBIntegrity(db *gorm.DB) error {
+	if !isSQLite(db) {
+		return nil
+	}
+
+	results := []string(nil)
+	if err := db.Raw("PRAGMA quick_check;").Scan(&results).Error; err != nil {
+		if isSQLiteError(err, sqlite3.ErrCorrupt) {
+			return errcode.ErrDBCorrupted.Wrap(err)
+		}
+
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if len(results) == 1 && results[0] == "ok" {
+		return nil
+	}
+
+	var errs error
+	for _, res := range results {
+		errs = multierr.Append(errs, errors.New(res))
+	}
+
+	if errs == nil {
+		errs = fmt.Errorf("integrity check returned no result")
+	}
+
+	return errcode.ErrDBCorrupted.Wrap(errs)
+}
+
 func dropAllTables(db *gorm.DB) error {
+	// the tables of the other dialects can't be listed portably, only the
+	// messenger ones are dropped
+	if !isSQLite(db) {
+		if err := db.Migrator().DropTable(getDBModels()...); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		return nil
+	}
+
 	tables := []string(nil)
 	if err := db.Raw("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'").Scan(&tables).Error; err != nil {
 		return errcode.ErrDBRead.Wrap(err)
@@ -109,20 +176,37 @@ func restoreDatabaseLocalState(db *DBWrapper, state *messengertypes.LocalDatabas
 		return nil
 	}
 
+	accountFields := map[string]interface{}{
+		"display_name":                       state.DisplayName,
+		"link":                               state.AccountLink,
+		"replicate_new_groups_automatically": state.ReplicateFlag,
+		"auto_share_push_token_flag":         state.AutoSharePushTokenFlag,
+	}
+	if state.AvatarCID != "" {
+		accountFields["avatar_cid"] = state.AvatarCID
+	}
+	if state.Bio != "" {
+		accountFields["bio"] = state.Bio
+	}
+	if state.PresenceVisibility != messengertypes.Account_PresenceVisibilityContacts {
+		accountFields["presence_visibility"] = state.PresenceVisibility
+	}
+
 	if res := db.db.
 		Table("accounts").
 		Where("public_key", state.PublicKey).
-		Updates(map[string]interface{}{
-			"display_name":                       state.DisplayName,
-			"link":                               state.AccountLink,
-			"replicate_new_groups_automatically": state.ReplicateFlag,
-			"auto_share_push_token_flag":         state.AutoSharePushTokenFlag,
-		}); res.Error != nil {
+		Updates(accountFields); res.Error != nil {
 		return errcode.ErrInternal.Wrap(fmt.Errorf("unable to update account: %w", res.Error))
 	} else if res.RowsAffected == 0 {
 		return errcode.ErrInternal.Wrap(fmt.Errorf("unable to update account: account not found"))
 	}
 
+	if len(state.Links) > 0 {
+		if err := db.setProfileLinks(state.PublicKey, "", state.Links); err != nil {
+			return errcode.ErrInternal.Wrap(fmt.Errorf("unable to restore profile links: %w", err))
+		}
+	}
+
 	for _, c := range state.LocalConversationsState {
 		if res := db.db.
 			Table("conversations").
@@ -149,7 +233,7 @@ func getDBTablesSchemas(db *gorm.DB) (map[string][]*ColumnInfo, error) {
 	schemas := map[string][]*ColumnInfo{}
 	tableNamesAndSQL := []NameSQL{}
 
-	err := db.Raw("SELECT name, sql FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE '%_fts%';").Scan(&tableNamesAndSQL).Error
+	err := db.Raw("SELECT name, sql FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' AND name NOT LIKE '%\\_fts%' ESCAPE '\\';").Scan(&tableNamesAndSQL).Error
 	if err != nil {
 		return nil, err
 	}
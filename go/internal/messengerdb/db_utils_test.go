@@ -1,13 +1,19 @@
 package messengerdb
 
 import (
+	"bytes"
 	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 
+	sqlite "github.com/flyingtime/gorm-sqlcipher"
 	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 
 	"berty.tech/berty/v2/go/internal/testutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
 )
 
 type modelAccountV1 struct {
@@ -157,3 +163,45 @@ func Test_ensureSeamlessDBUpdate(t *testing.T) {
 	require.NoError(t, db.getUpdatedDB([]interface{}{&modelAccountV6{}, &modelConversationV6{}}, replayer, log))
 	hasExpectedValues(db.db)
 }
+
+func Test_CheckDBIntegrity(t *testing.T) {
+	db, _, dispose := GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, CheckDBIntegrity(db.db))
+
+	dbPath := filepath.Join(t.TempDir(), "messenger.sqlite")
+
+	fileDB, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	require.NoError(t, err)
+
+	require.NoError(t, fileDB.AutoMigrate(&modelConversationV1{}))
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, fileDB.Create(&modelConversationV1{
+			PublicKey:   fmt.Sprintf("pk_conversation_%d", i),
+			DisplayName: fmt.Sprintf("conversation_display_name_%d", i),
+		}).Error)
+	}
+	require.NoError(t, CheckDBIntegrity(fileDB))
+
+	sqlDB, err := fileDB.DB()
+	require.NoError(t, err)
+	require.NoError(t, sqlDB.Close())
+
+	// overwrite a few pages in the middle of the file
+	f, err := os.OpenFile(dbPath, os.O_RDWR, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteAt(bytes.Repeat([]byte{0xff}, 4096*4), 4096*2)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fileDB, err = gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	require.NoError(t, err)
+
+	defer func() {
+		sqlDB, _ := fileDB.DB()
+		_ = sqlDB.Close()
+	}()
+
+	require.True(t, errcode.Is(CheckDBIntegrity(fileDB), errcode.ErrDBCorrupted))
+}
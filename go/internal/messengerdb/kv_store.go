@@ -0,0 +1,454 @@
+package messengerdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	datastore "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dsbadger "github.com/ipfs/go-ds-badger"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+const (
+	kvNamespaceInteractions = "/interactions"
+	kvNamespaceContacts     = "/contacts"
+	kvNamespaceMembers      = "/members"
+)
+
+// KVStore implements the interaction, contact and member stores on top of a
+// key-value datastore, for platforms where SQLite performs poorly or is not
+// available.
+//
+// Entries are stored as protobuf without their relations (conversation,
+// member, devices), which are not resolved when reading them back.
+type KVStore struct {
+	ds    datastore.Batching
+	log   *zap.Logger
+	ctx   context.Context
+	mutex sync.Mutex // serializes read-modify-write operations
+}
+
+var (
+	_ InteractionStore = (*KVStore)(nil)
+	_ ContactStore     = (*KVStore)(nil)
+	_ MemberStore      = (*KVStore)(nil)
+)
+
+func NewKVStore(ds datastore.Batching, log *zap.Logger) *KVStore {
+	if log == nil {
+		log = zap.NewNop()
+	}
+
+	return &KVStore{
+		ds:  ds,
+		log: log,
+		ctx: context.Background(),
+	}
+}
+
+// OpenBadgerKVStore opens a KVStore persisted in a Badger database located in
+// dir, the returned cleanup function closes it
+func OpenBadgerKVStore(dir string, log *zap.Logger) (*KVStore, func(), error) {
+	ds, err := dsbadger.NewDatastore(dir, &dsbadger.DefaultOptions)
+	if err != nil {
+		return nil, nil, errcode.ErrDBOpen.Wrap(err)
+	}
+
+	cleanup := func() {
+		if err := ds.Close(); err != nil {
+			log.Warn("unable to close badger datastore", zap.Error(err))
+		}
+	}
+
+	return NewKVStore(ds, log), cleanup, nil
+}
+
+func (s *KVStore) logStep(text string, muts ...tyber.StepMutator) {
+	tyber.LogStep(s.ctx, s.log, text, muts...)
+}
+
+func kvInteractionKey(cid string) datastore.Key {
+	return datastore.NewKey(kvNamespaceInteractions).ChildString(cid)
+}
+
+func kvContactKey(pk string) datastore.Key {
+	return datastore.NewKey(kvNamespaceContacts).ChildString(pk)
+}
+
+func kvMemberKey(pk, convPK string) datastore.Key {
+	return datastore.NewKey(kvNamespaceMembers).ChildString(convPK).ChildString(pk)
+}
+
+func (s *KVStore) get(key datastore.Key, msg proto.Message) error {
+	data, err := s.ds.Get(s.ctx, key)
+	if err == datastore.ErrNotFound {
+		return gorm.ErrRecordNotFound
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *KVStore) put(key datastore.Key, msg proto.Message) error {
+	data, err := proto.Marshal(msg)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := s.ds.Put(s.ctx, key, data); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
+
+func (s *KVStore) has(key datastore.Key) (bool, error) {
+	ok, err := s.ds.Has(s.ctx, key)
+	if err != nil {
+		return false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	return ok, nil
+}
+
+// list calls fn with the raw value of every entry under prefix, in key order
+func (s *KVStore) list(prefix string, fn func(data []byte) error) error {
+	res, err := s.ds.Query(s.ctx, query.Query{Prefix: prefix, Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+	defer res.Close()
+
+	for entry := range res.Next() {
+		if entry.Error != nil {
+			return errcode.ErrDBRead.Wrap(entry.Error)
+		}
+
+		if err := fn(entry.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *KVStore) AddInteraction(rawInte messengertypes.Interaction) (*messengertypes.Interaction, bool, error) {
+	if rawInte.CID == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rawInte.Conversation, rawInte.Member = nil, nil
+
+	existing := &messengertypes.Interaction{}
+	err := s.get(kvInteractionKey(rawInte.CID), existing)
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		// new interaction
+
+	case err != nil:
+		return nil, false, err
+
+	case existing.OutOfStoreMessage && !rawInte.OutOfStoreMessage:
+		// replace out-of-store interaction with synced one, the push was received first
+		if existing.GetReceivedDate() != 0 {
+			rawInte.ReceivedDate = existing.GetReceivedDate()
+		}
+
+	default:
+		// we persist the first entry seen with a given CID
+		return existing, false, nil
+	}
+
+	if err := s.put(kvInteractionKey(rawInte.CID), &rawInte); err != nil {
+		return nil, false, err
+	}
+
+	s.logStep("Added interaction to kv store", tyber.WithJSONDetail("FinalInteraction", &rawInte))
+	return &rawInte, true, nil
+}
+
+func (s *KVStore) GetInteractionByCID(cid string) (*messengertypes.Interaction, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	interaction := &messengertypes.Interaction{}
+	if err := s.get(kvInteractionKey(cid), interaction); err != nil {
+		return nil, err
+	}
+
+	return interaction, nil
+}
+
+func (s *KVStore) GetAllInteractions() ([]*messengertypes.Interaction, error) {
+	interactions := []*messengertypes.Interaction(nil)
+
+	return interactions, s.list(kvNamespaceInteractions, func(data []byte) error {
+		interaction := &messengertypes.Interaction{}
+		if err := proto.Unmarshal(data, interaction); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		interactions = append(interactions, interaction)
+		return nil
+	})
+}
+
+func (s *KVStore) DeleteInteractions(cids []string) error {
+	if len(cids) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a list of cids is required"))
+	}
+
+	batch, err := s.ds.Batch(s.ctx)
+	if err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	for _, cid := range cids {
+		if err := batch.Delete(s.ctx, kvInteractionKey(cid)); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+	}
+
+	if err := batch.Commit(s.ctx); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	s.logStep(fmt.Sprintf("Removed %d interactions from kv store", len(cids)), tyber.WithJSONDetail("CIDs", cids))
+	return nil
+}
+
+func (s *KVStore) AddContactRequestOutgoingEnqueued(contactPK, displayName, convPK string) (*messengertypes.Contact, error) {
+	if contactPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if ec, err := s.GetContactByPK(contactPK); err == nil {
+		return ec, errcode.ErrDBEntryAlreadyExists
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	contact := &messengertypes.Contact{
+		PublicKey:             contactPK,
+		DisplayName:           displayName,
+		State:                 messengertypes.Contact_OutgoingRequestEnqueued,
+		CreatedDate:           messengerutil.TimestampMs(time.Now()),
+		ConversationPublicKey: convPK,
+	}
+
+	if err := s.put(kvContactKey(contactPK), contact); err != nil {
+		return nil, err
+	}
+
+	s.logStep("Added contact to kv store", tyber.WithJSONDetail("FinalContact", contact))
+	return contact, nil
+}
+
+func (s *KVStore) AddContactRequestOutgoingSent(contactPK string) (*messengertypes.Contact, error) {
+	if contactPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	contact, err := s.GetContactByPK(contactPK)
+	if err == gorm.ErrRecordNotFound || (err == nil && contact.State != messengertypes.Contact_OutgoingRequestEnqueued) {
+		return nil, errcode.ErrDBAddContactRequestOutgoingSent.Wrap(fmt.Errorf("nothing found"))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	contact.SentDate = messengerutil.TimestampMs(time.Now())
+	contact.State = messengertypes.Contact_OutgoingRequestSent
+
+	if err := s.put(kvContactKey(contactPK), contact); err != nil {
+		return nil, err
+	}
+
+	s.logStep("Contact request state set to sent in kv store", tyber.WithJSONDetail("FinalContact", contact))
+	return contact, nil
+}
+
+func (s *KVStore) GetContactByPK(publicKey string) (*messengertypes.Contact, error) {
+	if publicKey == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a contact public key is required"))
+	}
+
+	contact := &messengertypes.Contact{}
+	if err := s.get(kvContactKey(publicKey), contact); err != nil {
+		return nil, err
+	}
+
+	return contact, nil
+}
+
+func (s *KVStore) GetAllContacts() ([]*messengertypes.Contact, error) {
+	return s.listContacts(func(*messengertypes.Contact) bool { return true })
+}
+
+func (s *KVStore) GetContactsByState(state messengertypes.Contact_State) ([]*messengertypes.Contact, error) {
+	return s.listContacts(func(c *messengertypes.Contact) bool { return c.State == state })
+}
+
+func (s *KVStore) listContacts(filter func(*messengertypes.Contact) bool) ([]*messengertypes.Contact, error) {
+	contacts := []*messengertypes.Contact(nil)
+
+	return contacts, s.list(kvNamespaceContacts, func(data []byte) error {
+		contact := &messengertypes.Contact{}
+		if err := proto.Unmarshal(data, contact); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if filter(contact) {
+			contacts = append(contacts, contact)
+		}
+		return nil
+	})
+}
+
+func (s *KVStore) UpdateContact(pk string, contact messengertypes.Contact) error {
+	if pk == "" {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no public key specified"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	existing, err := s.GetContactByPK(pk)
+	if err == gorm.ErrRecordNotFound {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact not found"))
+	} else if err != nil {
+		return err
+	}
+
+	// like gorm Updates, only non-zero fields are applied
+	contact.PublicKey, contact.Conversation, contact.Devices = "", nil, nil
+	proto.Merge(existing, &contact)
+
+	if err := s.put(kvContactKey(pk), existing); err != nil {
+		return err
+	}
+
+	s.logStep("Updated contact in kv store", tyber.WithJSONDetail("Contact", existing))
+	return nil
+}
+
+func (s *KVStore) AddMember(memberPK, groupPK, displayName, avatarCID string, isMe bool, isCreator bool) (*messengertypes.Member, error) {
+	if memberPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("member public key cannot be empty"))
+	}
+
+	if groupPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("conversation public key cannot be empty"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if m, err := s.GetMemberByPK(memberPK, groupPK); err == nil {
+		return m, errcode.ErrDBEntryAlreadyExists
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	member := &messengertypes.Member{
+		PublicKey:             memberPK,
+		ConversationPublicKey: groupPK,
+		IsCreator:             isCreator,
+		IsMe:                  isMe,
+		DisplayName:           displayName,
+		AvatarCID:             avatarCID,
+	}
+
+	if err := s.put(kvMemberKey(memberPK, groupPK), member); err != nil {
+		return nil, err
+	}
+
+	s.logStep("Added member to kv store", tyber.WithJSONDetail("Member", member))
+	return member, nil
+}
+
+func (s *KVStore) UpsertMember(memberPK, groupPK string, m messengertypes.Member) (*messengertypes.Member, bool, error) {
+	if memberPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("member public key cannot be empty"))
+	}
+	if groupPK == "" {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("conversation public key cannot be empty"))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	isNew := false
+	member, err := s.GetMemberByPK(memberPK, groupPK)
+	if err == gorm.ErrRecordNotFound {
+		isNew = true
+		member = &messengertypes.Member{}
+	} else if err != nil {
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	m.Conversation, m.Devices = nil, nil
+	proto.Merge(member, &m)
+	member.PublicKey, member.ConversationPublicKey = memberPK, groupPK
+
+	if err := s.put(kvMemberKey(memberPK, groupPK), member); err != nil {
+		return nil, false, err
+	}
+
+	s.logStep("Upserted member in kv store", tyber.WithJSONDetail("FinalMember", member))
+	return member, isNew, nil
+}
+
+func (s *KVStore) GetMemberByPK(publicKey string, convPK string) (*messengertypes.Member, error) {
+	if publicKey == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("member public key cannot be empty"))
+	}
+	if convPK == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("conversation public key cannot be empty"))
+	}
+
+	member := &messengertypes.Member{}
+	if err := s.get(kvMemberKey(publicKey, convPK), member); err != nil {
+		return nil, err
+	}
+
+	return member, nil
+}
+
+func (s *KVStore) GetAllMembers() ([]*messengertypes.Member, error) {
+	members := []*messengertypes.Member(nil)
+
+	return members, s.list(kvNamespaceMembers, func(data []byte) error {
+		member := &messengertypes.Member{}
+		if err := proto.Unmarshal(data, member); err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		members = append(members, member)
+		return nil
+	})
+}
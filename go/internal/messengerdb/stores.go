@@ -0,0 +1,44 @@
+package messengerdb
+
+import (
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// The stores below are the subset of the messenger storage that can be served
+// by another backend than the GORM one, see KVStore.
+//
+// Missing entries are reported with gorm.ErrRecordNotFound by every
+// implementation, so callers can keep checking errors the same way.
+
+type InteractionStore interface {
+	// AddInteraction persists an interaction, it returns true if the
+	// interaction was not known or replaced an out-of-store copy
+	AddInteraction(rawInte messengertypes.Interaction) (*messengertypes.Interaction, bool, error)
+	GetInteractionByCID(cid string) (*messengertypes.Interaction, error)
+	GetAllInteractions() ([]*messengertypes.Interaction, error)
+	DeleteInteractions(cids []string) error
+}
+
+type ContactStore interface {
+	AddContactRequestOutgoingEnqueued(contactPK, displayName, convPK string) (*messengertypes.Contact, error)
+	AddContactRequestOutgoingSent(contactPK string) (*messengertypes.Contact, error)
+	GetContactByPK(publicKey string) (*messengertypes.Contact, error)
+	GetAllContacts() ([]*messengertypes.Contact, error)
+	GetContactsByState(state messengertypes.Contact_State) ([]*messengertypes.Contact, error)
+	// UpdateContact only updates the non-zero fields of contact
+	UpdateContact(pk string, contact messengertypes.Contact) error
+}
+
+type MemberStore interface {
+	AddMember(memberPK, groupPK, displayName, avatarCID string, isMe bool, isCreator bool) (*messengertypes.Member, error)
+	// UpsertMember only updates the non-zero fields of m for existing members
+	UpsertMember(memberPK, groupPK string, m messengertypes.Member) (*messengertypes.Member, bool, error)
+	GetMemberByPK(publicKey string, convPK string) (*messengertypes.Member, error)
+	GetAllMembers() ([]*messengertypes.Member, error)
+}
+
+var (
+	_ InteractionStore = (*DBWrapper)(nil)
+	_ ContactStore     = (*DBWrapper)(nil)
+	_ MemberStore      = (*DBWrapper)(nil)
+)
@@ -0,0 +1,212 @@
+package messengerdb
+
+import (
+	"errors"
+	"testing"
+
+	datastore "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+type testStore interface {
+	InteractionStore
+	ContactStore
+	MemberStore
+}
+
+// storeBackends returns a constructor for each implementation of the stores,
+// every store test is run against all of them
+func storeBackends() map[string]func(t *testing.T) (testStore, func()) {
+	return map[string]func(t *testing.T) (testStore, func()){
+		"gorm": func(t *testing.T) (testStore, func()) {
+			db, _, dispose := GetInMemoryTestDB(t)
+			return db, dispose
+		},
+		"kv-memory": func(t *testing.T) (testStore, func()) {
+			return NewKVStore(dssync.MutexWrap(datastore.NewMapDatastore()), nil), func() {}
+		},
+		"kv-badger": func(t *testing.T) (testStore, func()) {
+			store, cleanup, err := OpenBadgerKVStore(t.TempDir(), nil)
+			require.NoError(t, err)
+			return store, cleanup
+		},
+	}
+}
+
+func runStoreTest(t *testing.T, test func(t *testing.T, store testStore)) {
+	for name, newStore := range storeBackends() {
+		newStore := newStore
+		t.Run(name, func(t *testing.T) {
+			store, dispose := newStore(t)
+			defer dispose()
+
+			test(t, store)
+		})
+	}
+}
+
+func Test_stores_Interactions(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store testStore) {
+		_, _, err := store.AddInteraction(messengertypes.Interaction{})
+		require.Error(t, err)
+
+		_, err = store.GetInteractionByCID("")
+		require.Error(t, err)
+
+		_, err = store.GetInteractionByCID("cid1")
+		require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		i, isNew, err := store.AddInteraction(messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1", Payload: []byte("payload1")})
+		require.NoError(t, err)
+		require.True(t, isNew)
+		require.Equal(t, "cid1", i.CID)
+
+		// the first entry seen with a given CID is kept
+		i, isNew, err = store.AddInteraction(messengertypes.Interaction{CID: "cid1", ConversationPublicKey: "conv1", Payload: []byte("payload2")})
+		require.NoError(t, err)
+		require.False(t, isNew)
+		require.Equal(t, []byte("payload1"), i.Payload)
+
+		// out-of-store interactions are replaced by the synced ones
+		_, isNew, err = store.AddInteraction(messengertypes.Interaction{CID: "cid2", Payload: []byte("push"), OutOfStoreMessage: true})
+		require.NoError(t, err)
+		require.True(t, isNew)
+
+		i, isNew, err = store.AddInteraction(messengertypes.Interaction{CID: "cid2", Payload: []byte("synced")})
+		require.NoError(t, err)
+		require.True(t, isNew)
+		require.Equal(t, []byte("synced"), i.Payload)
+		require.False(t, i.OutOfStoreMessage)
+
+		// but not the other way around
+		i, isNew, err = store.AddInteraction(messengertypes.Interaction{CID: "cid2", Payload: []byte("push"), OutOfStoreMessage: true})
+		require.NoError(t, err)
+		require.False(t, isNew)
+		require.Equal(t, []byte("synced"), i.Payload)
+
+		i, err = store.GetInteractionByCID("cid1")
+		require.NoError(t, err)
+		require.Equal(t, "conv1", i.ConversationPublicKey)
+
+		interactions, err := store.GetAllInteractions()
+		require.NoError(t, err)
+		require.Len(t, interactions, 2)
+
+		require.Error(t, store.DeleteInteractions(nil))
+		require.NoError(t, store.DeleteInteractions([]string{"cid1"}))
+
+		_, err = store.GetInteractionByCID("cid1")
+		require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		interactions, err = store.GetAllInteractions()
+		require.NoError(t, err)
+		require.Len(t, interactions, 1)
+		require.Equal(t, "cid2", interactions[0].CID)
+	})
+}
+
+func Test_stores_Contacts(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store testStore) {
+		_, err := store.AddContactRequestOutgoingEnqueued("", "name", "conv1")
+		require.Error(t, err)
+
+		_, err = store.GetContactByPK("contact1")
+		require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		c, err := store.AddContactRequestOutgoingEnqueued("contact1", "name1", "conv1")
+		require.NoError(t, err)
+		require.Equal(t, messengertypes.Contact_OutgoingRequestEnqueued, c.State)
+		require.NotZero(t, c.CreatedDate)
+
+		_, err = store.AddContactRequestOutgoingEnqueued("contact1", "name1", "conv1")
+		require.True(t, errcode.Is(err, errcode.ErrDBEntryAlreadyExists))
+
+		_, err = store.AddContactRequestOutgoingEnqueued("contact2", "name2", "conv2")
+		require.NoError(t, err)
+
+		_, err = store.AddContactRequestOutgoingSent("unknown")
+		require.Error(t, err)
+
+		c, err = store.AddContactRequestOutgoingSent("contact1")
+		require.NoError(t, err)
+		require.Equal(t, messengertypes.Contact_OutgoingRequestSent, c.State)
+		require.NotZero(t, c.SentDate)
+
+		// only enqueued requests can be marked as sent
+		_, err = store.AddContactRequestOutgoingSent("contact1")
+		require.Error(t, err)
+
+		contacts, err := store.GetAllContacts()
+		require.NoError(t, err)
+		require.Len(t, contacts, 2)
+
+		contacts, err = store.GetContactsByState(messengertypes.Contact_OutgoingRequestSent)
+		require.NoError(t, err)
+		require.Len(t, contacts, 1)
+		require.Equal(t, "contact1", contacts[0].PublicKey)
+
+		require.Error(t, store.UpdateContact("", messengertypes.Contact{}))
+		require.Error(t, store.UpdateContact("unknown", messengertypes.Contact{DisplayName: "name"}))
+
+		// zero fields are left untouched
+		require.NoError(t, store.UpdateContact("contact1", messengertypes.Contact{DisplayName: "new name", InfoDate: 42}))
+
+		c, err = store.GetContactByPK("contact1")
+		require.NoError(t, err)
+		require.Equal(t, "new name", c.DisplayName)
+		require.Equal(t, int64(42), c.InfoDate)
+		require.Equal(t, "conv1", c.ConversationPublicKey)
+		require.Equal(t, messengertypes.Contact_OutgoingRequestSent, c.State)
+	})
+}
+
+func Test_stores_Members(t *testing.T) {
+	runStoreTest(t, func(t *testing.T, store testStore) {
+		_, err := store.AddMember("", "conv1", "name", "", false, false)
+		require.Error(t, err)
+
+		_, err = store.AddMember("member1", "", "name", "", false, false)
+		require.Error(t, err)
+
+		_, err = store.GetMemberByPK("member1", "conv1")
+		require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+		m, err := store.AddMember("member1", "conv1", "name1", "", true, true)
+		require.NoError(t, err)
+		require.True(t, m.IsMe)
+		require.True(t, m.IsCreator)
+
+		_, err = store.AddMember("member1", "conv1", "name1", "", true, true)
+		require.True(t, errcode.Is(err, errcode.ErrDBEntryAlreadyExists))
+
+		// the same member can be in another conversation
+		_, err = store.AddMember("member1", "conv2", "name1", "", false, false)
+		require.NoError(t, err)
+
+		m, isNew, err := store.UpsertMember("member2", "conv1", messengertypes.Member{DisplayName: "name2", InfoDate: 1})
+		require.NoError(t, err)
+		require.True(t, isNew)
+		require.Equal(t, "member2", m.PublicKey)
+		require.Equal(t, "conv1", m.ConversationPublicKey)
+
+		m, isNew, err = store.UpsertMember("member1", "conv1", messengertypes.Member{DisplayName: "new name", InfoDate: 2})
+		require.NoError(t, err)
+		require.False(t, isNew)
+		require.Equal(t, "new name", m.DisplayName)
+		require.Equal(t, int64(2), m.InfoDate)
+		require.True(t, m.IsMe)
+
+		m, err = store.GetMemberByPK("member1", "conv2")
+		require.NoError(t, err)
+		require.Equal(t, "name1", m.DisplayName)
+
+		members, err := store.GetAllMembers()
+		require.NoError(t, err)
+		require.Len(t, members, 3)
+	})
+}
@@ -0,0 +1,75 @@
+package messengerpayloads
+
+import (
+	"sync"
+	"time"
+)
+
+type activityKey struct {
+	conversationPK string
+	memberPK       string
+}
+
+// activityTracker expires the activities of the members, it is kept in memory
+// only and shared between an EventHandler and the copies made with WithContext
+type activityTracker struct {
+	mutex  sync.Mutex
+	timers map[activityKey]*time.Timer
+}
+
+func newActivityTracker() *activityTracker {
+	return &activityTracker{timers: make(map[activityKey]*time.Timer)}
+}
+
+// set replaces the pending expiry of an activity, onExpire is called at
+// expiresAt unless the activity is set or cleared again before
+func (t *activityTracker) set(key activityKey, expiresAt time.Time, onExpire func()) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if timer, ok := t.timers[key]; ok {
+		timer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(expiresAt), func() {
+		t.mutex.Lock()
+		current := t.timers[key] == timer
+		if current {
+			delete(t.timers, key)
+		}
+		t.mutex.Unlock()
+
+		if current {
+			onExpire()
+		}
+	})
+	t.timers[key] = timer
+}
+
+// clear cancels the pending expiry of an activity, it returns whether there
+// was one
+func (t *activityTracker) clear(key activityKey) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	timer, ok := t.timers[key]
+	if !ok {
+		return false
+	}
+
+	timer.Stop()
+	delete(t.timers, key)
+	return true
+}
+
+// clearAll cancels every pending expiry
+func (t *activityTracker) clearAll() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for key, timer := range t.timers {
+		timer.Stop()
+		delete(t.timers, key)
+	}
+}
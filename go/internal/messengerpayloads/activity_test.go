@@ -0,0 +1,79 @@
+package messengerpayloads
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestEventHandler_handleAppMessageActivity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+	defer func() { _ = h.Close(ctx) }()
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	activity := func(sentAt time.Time, kinds ...mt.AppMessage_ActivityKind) {
+		i := &mt.Interaction{Type: mt.AppMessage_TypeActivity, ConversationPublicKey: conv.PublicKey, Conversation: conv, SentDate: messengerutil.TimestampMs(sentAt)}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			ret, isNew, err := h.handleAppMessageActivity(tx, i, &mt.AppMessage_Activity{Kinds: kinds})
+			require.NotNil(t, ret)
+			require.False(t, isNew)
+			return err
+		}))
+	}
+	lastActivity := func() *mt.StreamEvent_ActivityUpdated {
+		events := dispatcher.snapshot()
+		require.NotEmpty(t, events)
+		require.Equal(t, mt.StreamEvent_TypeActivityUpdated, events[len(events)-1].Type)
+
+		payload, err := events[len(events)-1].UnmarshalPayload()
+		require.NoError(t, err)
+		return payload.(*mt.StreamEvent_ActivityUpdated)
+	}
+
+	// stale activities are dropped
+	activity(time.Now().Add(-mt.ActivityTimeout), mt.AppMessage_ActivityTyping)
+	require.Empty(t, dispatcher.snapshot())
+
+	activity(time.Now(), mt.AppMessage_ActivityTyping, mt.AppMessage_ActivityUploadingFile)
+	updated := lastActivity()
+	require.Equal(t, "contact_pk", updated.MemberPublicKey)
+	require.Equal(t, []mt.AppMessage_ActivityKind{mt.AppMessage_ActivityTyping, mt.AppMessage_ActivityUploadingFile}, updated.Kinds)
+	require.NotZero(t, updated.ExpiresAt)
+
+	// cleared explicitly, only once
+	activity(time.Now())
+	require.Empty(t, lastActivity().Kinds)
+	activity(time.Now())
+	require.Len(t, dispatcher.snapshot(), 2)
+
+	// cleared automatically once expired
+	activity(time.Now().Add(-mt.ActivityTimeout+50*time.Millisecond), mt.AppMessage_ActivityRecordingAudio)
+	require.Len(t, dispatcher.snapshot(), 3)
+	require.Eventually(t, func() bool { return len(dispatcher.snapshot()) == 4 }, time.Second, 10*time.Millisecond)
+	require.Empty(t, lastActivity().Kinds)
+
+	// hidden when the typing indicators are disabled
+	require.NoError(t, db.FirstOrCreateAccount("account_pk", ""))
+	require.NoError(t, db.SetReceiptPrivacy("", false, true))
+	activity(time.Now(), mt.AppMessage_ActivityTyping)
+	require.Len(t, dispatcher.snapshot(), 4)
+
+	// nothing has been persisted
+	info, err := db.GetDBInfo()
+	require.NoError(t, err)
+	require.Zero(t, info.GetInteractions())
+	require.Zero(t, info.GetOutboxEvents())
+}
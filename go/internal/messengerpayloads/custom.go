@@ -0,0 +1,91 @@
+package messengerpayloads
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// customHandlers are the handlers registered for the custom AppMessage types,
+// they are shared between an EventHandler and the copies made with WithContext
+type customHandlers struct {
+	mutex    sync.RWMutex
+	handlers map[mt.AppMessage_Type]customHandler
+}
+
+type customHandler struct {
+	handler mt.CustomAppMessageHandler
+	visible bool
+}
+
+func newCustomHandlers() *customHandlers {
+	return &customHandlers{handlers: make(map[mt.AppMessage_Type]customHandler)}
+}
+
+func (c *customHandlers) get(typ mt.AppMessage_Type) (customHandler, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	handler, ok := c.handlers[typ]
+	return handler, ok
+}
+
+// RegisterAppMessageHandler sets the handler of a custom AppMessage type, see
+// mt.NewCustomAppMessageType. A type can only be registered once, the
+// messages of the custom types without a handler are ignored. The interactions
+// stored for a visible type notify and count as unread like the user messages.
+func (h *EventHandler) RegisterAppMessageHandler(typ mt.AppMessage_Type, handler mt.CustomAppMessageHandler, visible bool) error {
+	if !typ.IsCustom() {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("custom AppMessage types start at %d, got %d", mt.AppMessageCustomTypeMin, typ))
+	}
+
+	if handler == nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no handler given for AppMessage type %d", typ))
+	}
+
+	h.customHandlers.mutex.Lock()
+	defer h.customHandlers.mutex.Unlock()
+
+	if _, ok := h.customHandlers.handlers[typ]; ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("AppMessage type %d (namespace %d) already has a handler", typ, typ.CustomNamespace()))
+	}
+
+	h.customHandlers.handlers[typ] = customHandler{handler: handler, visible: visible}
+
+	return nil
+}
+
+func (h *EventHandler) handleCustomAppMessage(custom mt.CustomAppMessageHandler) func(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	return func(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+		payload, ok := amPayload.(*mt.CustomPayload)
+		if !ok {
+			return nil, false, errcode.ErrInvalidInput
+		}
+
+		store, err := custom.HandleAppMessage(h.ctx, i, payload.GetData())
+		if err != nil {
+			return nil, false, err
+		}
+
+		if !store {
+			return i, false, nil
+		}
+
+		i, isNew, err := tx.AddInteraction(*i)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.CID, isNew); err != nil {
+			return nil, false, err
+		}
+
+		return i, isNew, nil
+	}
+}
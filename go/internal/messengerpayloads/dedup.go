@@ -0,0 +1,110 @@
+package messengerpayloads
+
+import (
+	"sync"
+
+	ipfscid "github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+// handledEventsCacheSize is the number of app messages remembered as handled,
+// older ones are looked up in the database
+const handledEventsCacheSize = 4096
+
+// handledEvents remembers the cids of the app messages handled recently, it is
+// shared between an EventHandler and the copies made with WithContext
+type handledEvents struct {
+	mutex sync.Mutex
+	cids  map[string]struct{}
+	// ring holds the cids in the order they were added, the oldest one is
+	// forgotten when it is full
+	ring       []string
+	next       int
+	suppressed uint64
+}
+
+func newHandledEvents(size int) *handledEvents {
+	return &handledEvents{
+		cids: make(map[string]struct{}, size),
+		ring: make([]string, size),
+	}
+}
+
+func (e *handledEvents) contains(cid string) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	_, ok := e.cids[cid]
+	return ok
+}
+
+func (e *handledEvents) add(cid string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if _, ok := e.cids[cid]; ok {
+		return
+	}
+
+	if oldest := e.ring[e.next]; oldest != "" {
+		delete(e.cids, oldest)
+	}
+	e.ring[e.next] = cid
+	e.next = (e.next + 1) % len(e.ring)
+	e.cids[cid] = struct{}{}
+}
+
+func (e *handledEvents) suppress() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.suppressed++
+}
+
+// SuppressedDuplicates returns the number of app messages delivered again and
+// ignored because they were already handled
+func (h *EventHandler) SuppressedDuplicates() uint64 {
+	h.handled.mutex.Lock()
+	defer h.handled.mutex.Unlock()
+
+	return h.handled.suppressed
+}
+
+// eventCID returns the cid of an app message event, it is empty if the event
+// has none
+func eventCID(gme *protocoltypes.GroupMessageEvent) string {
+	cid, err := ipfscid.Cast(gme.GetEventContext().GetID())
+	if err != nil {
+		return ""
+	}
+
+	return cid.String()
+}
+
+// isDuplicateEvent returns true if the app message cid was already handled,
+// either recently or when it was synced into the database. The interactions
+// received through a push are handled again once synced.
+func (h *EventHandler) isDuplicateEvent(cid string) bool {
+	if cid == "" {
+		return false
+	}
+
+	if h.handled.contains(cid) {
+		return true
+	}
+
+	synced, err := h.db.IsInteractionSynced(cid)
+	if err != nil {
+		h.logger.Warn("unable to check if the event was already handled", logutil.PrivateString("cid", cid), zap.Error(err))
+		return false
+	}
+
+	if synced {
+		h.handled.add(cid)
+	}
+
+	return synced
+}
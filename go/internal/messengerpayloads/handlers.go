@@ -8,9 +8,9 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
-	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 	"github.com/gogo/protobuf/proto"
 	ipfscid "github.com/ipfs/go-cid"
 	"go.uber.org/zap"
@@ -41,6 +41,12 @@ type EventHandler struct {
 	postHandlerActions mt.EventHandlerPostActions
 	metadataHandlers   map[protocoltypes.EventType]func(gme *protocoltypes.GroupMetadataEvent) error
 	replay             bool
+	outboxMutex        *sync.Mutex
+	gate               *handlerGate
+	activities         *activityTracker
+	customHandlers     *customHandlers
+	handled            *handledEvents
+	middlewares        []HandlerMiddleware
 	appMessageHandlers map[mt.AppMessage_Type]struct {
 		handler        func(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error)
 		isVisibleEvent bool
@@ -55,7 +61,33 @@ func (h *EventHandler) Logger() *zap.Logger {
 	return h.logger
 }
 
-func NewEventHandler(ctx context.Context, db *messengerdb.DBWrapper, metaFetcher MetaFetcher, postHandlerActions mt.EventHandlerPostActions, logger *zap.Logger, dispatcher messengerutil.Dispatcher, replay bool) *EventHandler {
+// handlerGate keeps track of the protocol events being handled, it is shared
+// between an EventHandler and the copies made with WithContext
+type handlerGate struct {
+	mutex    sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+}
+
+func (g *handlerGate) enter() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.closed {
+		return errcode.ErrMessengerHandlerClosed
+	}
+
+	g.inflight.Add(1)
+	return nil
+}
+
+func (g *handlerGate) leave() {
+	g.inflight.Done()
+}
+
+// NewEventHandler returns a handler for the protocol events, middlewares wrap
+// the handling of every metadata event and app message, see HandlerMiddleware
+func NewEventHandler(ctx context.Context, db *messengerdb.DBWrapper, metaFetcher MetaFetcher, postHandlerActions mt.EventHandlerPostActions, logger *zap.Logger, dispatcher messengerutil.Dispatcher, replay bool, middlewares ...HandlerMiddleware) *EventHandler {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
@@ -65,6 +97,10 @@ func NewEventHandler(ctx context.Context, db *messengerdb.DBWrapper, metaFetcher
 		dispatcher = &messengerutil.NoopDispatcher{}
 	}
 
+	if metaFetcher != nil {
+		metaFetcher = &tracedMetaFetcher{MetaFetcher: metaFetcher}
+	}
+
 	h := &EventHandler{
 		ctx:                ctx,
 		db:                 db,
@@ -73,6 +109,12 @@ func NewEventHandler(ctx context.Context, db *messengerdb.DBWrapper, metaFetcher
 		dispatcher:         dispatcher,
 		logger:             logger,
 		replay:             replay,
+		outboxMutex:        &sync.Mutex{},
+		gate:               &handlerGate{},
+		activities:         newActivityTracker(),
+		customHandlers:     newCustomHandlers(),
+		handled:            newHandledEvents(handledEventsCacheSize),
+		middlewares:        middlewares,
 	}
 
 	h.bindHandlers()
@@ -87,6 +129,9 @@ func (h *EventHandler) bindHandlers() {
 		protocoltypes.EventTypeAccountContactRequestOutgoingSent:      h.accountContactRequestOutgoingSent,
 		protocoltypes.EventTypeAccountContactRequestIncomingReceived:  h.accountContactRequestIncomingReceived,
 		protocoltypes.EventTypeAccountContactRequestIncomingAccepted:  h.accountContactRequestIncomingAccepted,
+		protocoltypes.EventTypeAccountContactRequestIncomingDiscarded: h.accountContactRequestIncomingDiscarded,
+		protocoltypes.EventTypeAccountContactBlocked:                  h.accountContactBlocked,
+		protocoltypes.EventTypeAccountContactUnblocked:                h.accountContactUnblocked,
 		protocoltypes.EventTypeGroupMemberDeviceAdded:                 h.groupMemberDeviceAdded,
 		protocoltypes.EventTypeGroupMetadataPayloadSent:               h.groupMetadataPayloadSent,
 		protocoltypes.EventTypeAccountServiceTokenAdded:               h.accountServiceTokenAdded,
@@ -100,11 +145,33 @@ func (h *EventHandler) bindHandlers() {
 		handler        func(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error)
 		isVisibleEvent bool
 	}{
-		mt.AppMessage_TypeAcknowledge:     {h.handleAppMessageAcknowledge, false},
-		mt.AppMessage_TypeGroupInvitation: {h.handleAppMessageGroupInvitation, true},
-		mt.AppMessage_TypeUserMessage:     {h.handleAppMessageUserMessage, true},
-		mt.AppMessage_TypeSetUserInfo:     {h.handleAppMessageSetUserInfo, false},
-		mt.AppMessage_TypeSetGroupInfo:    {h.handleAppMessageSetGroupInfo, false},
+		mt.AppMessage_TypeAcknowledge:        {h.handleAppMessageAcknowledge, false},
+		mt.AppMessage_TypeGroupInvitation:    {h.handleAppMessageGroupInvitation, true},
+		mt.AppMessage_TypeUserMessage:        {h.handleAppMessageUserMessage, true},
+		mt.AppMessage_TypeUserMessageEdit:    {h.handleAppMessageUserMessageEdit, false},
+		mt.AppMessage_TypeMessageRetract:     {h.handleAppMessageMessageRetract, false},
+		mt.AppMessage_TypeSetUserInfo:        {h.handleAppMessageSetUserInfo, false},
+		mt.AppMessage_TypeSetGroupInfo:       {h.handleAppMessageSetGroupInfo, false},
+		mt.AppMessage_TypeAccountDeleted:     {h.handleAppMessageAccountDeleted, true},
+		mt.AppMessage_TypePresence:           {h.handleAppMessagePresence, false},
+		mt.AppMessage_TypeActivity:           {h.handleAppMessageActivity, false},
+		mt.AppMessage_TypeCallOffer:          {h.handleAppMessageCallSignaling, true},
+		mt.AppMessage_TypeCallAnswer:         {h.handleAppMessageCallSignaling, false},
+		mt.AppMessage_TypeCallICECandidate:   {h.handleAppMessageCallSignaling, false},
+		mt.AppMessage_TypeCallHangUp:         {h.handleAppMessageCallSignaling, false},
+		mt.AppMessage_TypeDeliveryReceipt:    {h.handleAppMessageDeliveryReceipt, false},
+		mt.AppMessage_TypeReadReceipt:        {h.handleAppMessageReadReceipt, false},
+		mt.AppMessage_TypeBookmark:           {h.handleAppMessageBookmark, false},
+		mt.AppMessage_TypePinMessage:         {h.handleAppMessagePinMessage, false},
+		mt.AppMessage_TypePoll:               {h.handleAppMessagePoll, true},
+		mt.AppMessage_TypePollVote:           {h.handleAppMessagePollVote, false},
+		mt.AppMessage_TypeLocation:           {h.handleAppMessageLocation, true},
+		mt.AppMessage_TypeLiveLocation:       {h.handleAppMessageLiveLocation, true},
+		mt.AppMessage_TypeSetEphemeralPolicy: {h.handleAppMessageSetEphemeralPolicy, false},
+		mt.AppMessage_TypeContactShare:       {h.handleAppMessageContactShare, true},
+		mt.AppMessage_TypeCalendarEvent:      {h.handleAppMessageCalendarEvent, true},
+		mt.AppMessage_TypeCalendarEventRSVP:  {h.handleAppMessageCalendarEventRSVP, false},
+		mt.AppMessage_TypeSetSlowMode:        {h.handleAppMessageSetSlowMode, false},
 	}
 }
 
@@ -117,37 +184,122 @@ func (h *EventHandler) WithContext(ctx context.Context) *EventHandler {
 		dispatcher:         h.dispatcher,
 		replay:             h.replay,
 		postHandlerActions: h.postHandlerActions,
+		outboxMutex:        h.outboxMutex,
+		gate:               h.gate,
+		activities:         h.activities,
+		customHandlers:     h.customHandlers,
+		handled:            h.handled,
+		middlewares:        h.middlewares,
 	}
 	nh.bindHandlers()
 	return &nh
 }
 
+// WithReplay returns a copy of the handler handling the events as replayed,
+// they are indexed without notifying
+func (h *EventHandler) WithReplay() *EventHandler {
+	nh := h.WithContext(h.ctx)
+	nh.replay = true
+	return nh
+}
+
+// Close stops accepting new protocol events, waits for the events being
+// handled to be committed and flushes the outbox. If ctx expires before the
+// in-flight events are done, the outbox is not flushed and the ctx error is
+// returned, the remaining events will be delivered on the next start.
+func (h *EventHandler) Close(ctx context.Context) error {
+	h.gate.mutex.Lock()
+	h.gate.closed = true
+	h.gate.mutex.Unlock()
+
+	h.activities.clearAll()
+
+	drained := make(chan struct{})
+	go func() {
+		h.gate.inflight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		h.logger.Warn("event handler closed before in-flight events were drained", zap.Error(ctx.Err()))
+		return ctx.Err()
+	}
+
+	return h.FlushOutbox()
+}
+
 func (h *EventHandler) HandleMetadataEvent(gme *protocoltypes.GroupMetadataEvent) error {
+	if err := h.gate.enter(); err != nil {
+		return err
+	}
+	defer h.gate.leave()
+
 	et := gme.GetMetadata().GetEventType()
 	// FIXME(@n0izn0iz): tyber will crash on my machine if I remove the next line (blank screen in traces list in all sessions)
 	h.logger.Info("Received protocol event in MessengerService", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{{Name: "Type", Description: et.String()}}, tyber.ForceReopen)...)
 
-	handler, ok := h.metadataHandlers[et]
-	if !ok {
+	if _, ok := h.metadataHandlers[et]; !ok {
 		tyber.LogStep(h.ctx, h.logger, "Event ignored", tyber.WithDetail("Type", et.String()), tyber.ForceReopen)
 		return nil
 	}
 
-	if err := handler(gme); err != nil {
-		return err
+	info := HandlerInfo{
+		GroupPK:      messengerutil.B64EncodeBytes(gme.GetEventContext().GetGroupPK()),
+		MetadataType: et,
+	}
+	if cid, err := ipfscid.Cast(gme.GetEventContext().GetID()); err == nil {
+		info.EventID = cid.String()
 	}
 
-	return nil
+	return h.handleWithMiddlewares(info, func(h *EventHandler) error {
+		return h.metadataHandlers[et](gme)
+	})
 }
 
-func (h *EventHandler) HandleAppMessage(gpk string, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) (err error) {
-	// TODO: override logger with fields
+func (h *EventHandler) HandleAppMessage(gpk string, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) error {
+	if err := h.gate.enter(); err != nil {
+		return err
+	}
+	defer h.gate.leave()
+
+	info := HandlerInfo{
+		GroupPK:        gpk,
+		EventID:        eventCID(gme),
+		DevicePK:       messengerutil.B64EncodeBytes(gme.GetHeaders().GetDevicePK()),
+		IsAppMessage:   true,
+		AppMessageType: am.GetType(),
+	}
+
+	return h.handleWithMiddlewares(info, func(h *EventHandler) error {
+		return h.handleAppMessage(gpk, gme, am)
+	})
+}
 
+func (h *EventHandler) handleAppMessage(gpk string, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) (err error) {
 	stepTitle := fmt.Sprintf("Received from group %s", gpk)
 	h.logger.Debug(stepTitle, tyber.FormatStepLogFields(h.ctx, []tyber.Detail{}, tyber.ForceReopen, tyber.UpdateTraceName(stepTitle))...)
 
+	// the events delivered again, after a reconnection or by a replication
+	// service, are ignored before any transaction
+	eventID := eventCID(gme)
+	if h.isDuplicateEvent(eventID) {
+		h.handled.suppress()
+		tyber.LogStep(h.ctx, h.logger, "Duplicate event ignored", tyber.WithDetail("CID", eventID), tyber.ForceReopen)
+		return nil
+	}
+
 	// get handler
 	handler, ok := h.appMessageHandlers[am.Type]
+	if !ok && am.Type.IsCustom() {
+		custom, registered := h.customHandlers.get(am.Type)
+		if !registered {
+			h.logger.Debug("No handler registered for custom AppMessage type", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{{Name: "Type", Description: am.GetType().String()}})...)
+			return nil
+		}
+		handler.handler, handler.isVisibleEvent, ok = h.handleCustomAppMessage(custom.handler), custom.visible, true
+	}
 	if !ok {
 		h.logger.Warn("Unsupported AppMessage_Type in messenger", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{{Name: "Type", Description: am.GetType().String()}})...)
 		return nil
@@ -175,6 +327,10 @@ func (h *EventHandler) HandleAppMessage(gpk string, gme *protocoltypes.GroupMess
 		tyber.WithDetail("LocalMemberPK", messengerutil.B64EncodeBytes(memPK)),
 		tyber.WithDetail("LocalDevicePK", messengerutil.B64EncodeBytes(devPK)),
 	}
+	if err := am.DecodePayload(); err != nil {
+		muts = append(muts, tyber.WithDetail("PayloadEncoding", am.GetPayloadEncoding().String()))
+		return logError("Failed to decode payload", err, muts...)
+	}
 	amPayload, err := am.UnmarshalPayload()
 	if err != nil {
 		muts = append(muts, tyber.WithDetail("RawPayload", string(am.Payload)))
@@ -202,7 +358,11 @@ func (h *EventHandler) HandleAppMessage(gpk string, gme *protocoltypes.GroupMess
 			return logError("Failed to handle AppMessage", err)
 		}
 
-		if err := interactionConsumeAck(tx, i, h.dispatcher, h.logger); err != nil {
+		if err := h.trackMissingTarget(tx, gpk, am, i.GetCID()); err != nil {
+			return logError("Failed to track missing target", err)
+		}
+
+		if err := interactionConsumeAck(tx, i, h.outboxFor(tx), h.logger); err != nil {
 			return logError("Failed to consume acknowledge", err)
 		}
 
@@ -211,8 +371,26 @@ func (h *EventHandler) HandleAppMessage(gpk string, gme *protocoltypes.GroupMess
 			return nil
 		}
 
-		if err := indexMessage(tx, i.CID, am); err != nil {
-			return logError("Failed to index AppMessage", err)
+		if retracted, err := h.interactionConsumeRetractions(tx, i); err != nil {
+			return logError("Failed to consume retraction", err)
+		} else if retracted {
+			isNew = false
+			return nil
+		}
+
+		// the member of an unknown device is found once it is added to the
+		// group, see groupMemberDeviceAdded
+		if i.GetMemberPublicKey() == "" && i.GetDevicePublicKey() != "" {
+			if err := h.backlogInteraction(tx, i); err != nil {
+				return logError("Failed to backlog interaction", err)
+			}
+		}
+
+		// the edited messages are indexed with their latest version by applyEdits
+		if i.GetEditedDate() == 0 {
+			if err := indexMessage(tx, i.CID, am); err != nil {
+				return logError("Failed to index AppMessage", err)
+			}
 		}
 
 		return nil
@@ -220,6 +398,12 @@ func (h *EventHandler) HandleAppMessage(gpk string, gme *protocoltypes.GroupMess
 		return err
 	}
 
+	if eventID != "" {
+		h.handled.add(eventID)
+	}
+
+	h.flushOutbox()
+
 	if handler.isVisibleEvent && isNew {
 		if err := h.dispatchVisibleInteraction(i); err != nil {
 			h.logger.Error("Unable to dispatch notification for interaction", tyber.FormatStepLogFields(h.ctx, tyber.ZapFieldsToDetails(logutil.PrivateString("cid", i.CID), zap.Error(err)))...)
@@ -235,20 +419,28 @@ func (h *EventHandler) accountServiceTokenAdded(gme *protocoltypes.GroupMetadata
 		return errcode.ErrDeserialization.Wrap(err)
 	}
 
-	if err := h.db.AddServiceToken(ev.ServiceToken); err != nil {
-		return errcode.ErrDBWrite.Wrap(err)
-	}
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		if err := tx.AddServiceToken(ev.ServiceToken); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
 
-	// dispatch event
-	acc, err := h.db.GetAccount()
-	if err != nil {
-		return errcode.ErrDBRead.Wrap(err)
-	}
+		// dispatch event
+		acc, err := tx.GetAccount()
+		if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
 
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false); err != nil {
-		return errcode.TODO.Wrap(err)
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false); err != nil {
+			return errcode.TODO.Wrap(err)
+		}
+
+		return nil
+	}); err != nil {
+		return err
 	}
 
+	h.flushOutbox()
+
 	return nil
 }
 
@@ -265,21 +457,29 @@ func (h *EventHandler) groupReplicating(gme *protocoltypes.GroupMetadataEvent) e
 
 	convPK := messengerutil.B64EncodeBytes(gme.EventContext.GroupPK)
 
-	if err := h.db.SaveConversationReplicationInfo(mt.ConversationReplicationInfo{
-		CID:                   cid.String(),
-		ConversationPublicKey: convPK,
-		MemberPublicKey:       "", // TODO
-		AuthenticationURL:     ev.AuthenticationURL,
-		ReplicationServer:     ev.ReplicationServer,
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		if err := tx.SaveConversationReplicationInfo(mt.ConversationReplicationInfo{
+			CID:                   cid.String(),
+			ConversationPublicKey: convPK,
+			MemberPublicKey:       "", // TODO
+			AuthenticationURL:     ev.AuthenticationURL,
+			ReplicationServer:     ev.ReplicationServer,
+		}); err != nil {
+			return err
+		}
+
+		conv, err := tx.GetConversationByPK(convPK)
+		if err != nil {
+			h.logger.Warn("unknown conversation", logutil.PrivateString("conversation-pk", convPK))
+			return nil
+		}
+
+		return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false)
 	}); err != nil {
 		return err
 	}
 
-	if conv, err := h.db.GetConversationByPK(convPK); err != nil {
-		h.logger.Warn("unknown conversation", logutil.PrivateString("conversation-pk", convPK))
-	} else if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
-		return err
-	}
+	h.flushOutbox()
 
 	return nil
 }
@@ -303,7 +503,7 @@ func (h *EventHandler) groupMetadataPayloadSent(gme *protocoltypes.GroupMetadata
 
 	groupPK := messengerutil.B64EncodeBytes(gme.GetEventContext().GetGroupPK())
 
-	return h.HandleAppMessage(groupPK, &groupMessageEvent, &appMessage)
+	return h.handleAppMessage(groupPK, &groupMessageEvent, &appMessage)
 }
 
 func (h *EventHandler) accountGroupJoined(gme *protocoltypes.GroupMetadataEvent) error {
@@ -320,21 +520,43 @@ func (h *EventHandler) accountGroupJoined(gme *protocoltypes.GroupMetadataEvent)
 		return err
 	}
 
-	conversation, err := h.db.AddConversation(groupPK, messengerutil.B64EncodeBytes(memPK), messengerutil.B64EncodeBytes(devPK))
-	switch {
-	case errcode.Is(err, errcode.ErrDBEntryAlreadyExists):
-		h.logger.Info("conversation already in db")
-	case err != nil:
-		return errcode.ErrDBAddConversation.Wrap(err)
-	default:
-		h.logger.Info("saved conversation in db")
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		dispatcher := h.outboxFor(tx)
+
+		conversation, err := tx.AddConversation(groupPK, messengerutil.B64EncodeBytes(memPK), messengerutil.B64EncodeBytes(devPK))
+		switch {
+		case errcode.Is(err, errcode.ErrDBEntryAlreadyExists):
+			h.logger.Info("conversation already in db")
+		case err != nil:
+			return errcode.ErrDBAddConversation.Wrap(err)
+		default:
+			h.logger.Info("saved conversation in db")
+
+			if err := dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, true); err != nil {
+				return err
+			}
+		}
 
-		if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, true); err != nil {
+		// the invitations to the group are shown as joined
+		cids, err := tx.SetGroupInvitationsJoined(groupPK, true)
+		if err != nil {
 			return err
 		}
+
+		for _, cid := range cids {
+			if err := messengerutil.StreamInteraction(dispatcher, tx, cid, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
 	}
 
-	conversation, err = h.db.GetConversationByPK(groupPK)
+	h.flushOutbox()
+
+	conversation, err := h.db.GetConversationByPK(groupPK)
 	if err != nil {
 		return errcode.ErrInternal.Wrap(err)
 	}
@@ -370,6 +592,12 @@ func (h *EventHandler) accountContactRequestOutgoingEnqueued(gme *protocoltypes.
 		}, tyber.Status(tyber.Failed))...)
 	}
 
+	// the introduction is read back from the metadata shared with the contact
+	var om mt.ContactMetadata
+	if err := proto.Unmarshal(ev.GetOwnMetadata(), &om); err != nil {
+		h.logger.Warn("Failed to unmarshal own ContactMetadata", zap.Error(err))
+	}
+
 	gpkB, err := h.metaFetcher.GroupPKForContact(h.ctx, contactPKBytes)
 	if err != nil {
 		return errcode.ErrInternal.Wrap(fmt.Errorf("unable to get group pk for contact: %w", err))
@@ -399,6 +627,13 @@ func (h *EventHandler) accountContactRequestOutgoingEnqueued(gme *protocoltypes.
 			return errcode.ErrDBAddContactRequestOutgoingEnqueud.Wrap(err)
 		}
 
+		if om.GetIntroduction() != "" {
+			if err := tx.SetContactIntroduction(contactPK, om.GetIntroduction()); err != nil {
+				return err
+			}
+			contact.Introduction = om.GetIntroduction()
+		}
+
 		// create new conversation
 		if conversation, err = tx.AddConversationForContact(gpk, messengerutil.B64EncodeBytes(memPK), messengerutil.B64EncodeBytes(devPK), contact.PublicKey); err != nil {
 			return errcode.ErrDBAddConversation.Wrap(err)
@@ -407,18 +642,21 @@ func (h *EventHandler) accountContactRequestOutgoingEnqueued(gme *protocoltypes.
 		contact.Conversation = conversation
 		contact.ConversationPublicKey = gpk
 
+		dispatcher := h.outboxFor(tx)
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, true); err != nil {
+			return errcode.ErrMessengerStreamEvent.Wrap(err)
+		}
+
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, true); err != nil {
+			return errcode.ErrMessengerStreamEvent.Wrap(err)
+		}
+
 		return nil
 	}); err != nil {
 		return err
 	}
 
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, true); err != nil {
-		return errcode.ErrMessengerStreamEvent.Wrap(err)
-	}
-
-	if err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, true); err != nil {
-		return errcode.ErrMessengerStreamEvent.Wrap(err)
-	}
+	h.flushOutbox()
 
 	return nil
 }
@@ -454,31 +692,35 @@ func (h *EventHandler) accountContactRequestOutgoingSent(gme *protocoltypes.Grou
 			return errcode.ErrDBAddContactRequestOutgoingSent.Wrap(err)
 		}
 
+		h.logger.Debug("Got contact from db", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{
+			{Name: "Contact", Description: fmt.Sprint(contact)},
+		})...)
+
+		// dispatch event and subscribe to group metadata
+		dispatcher := h.outboxFor(tx)
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+			return err
+		}
+
+		err = dispatcher.Notify(
+			mt.StreamEvent_Notified_TypeContactRequestSent,
+			"Contact request sent",
+			"To: "+contact.GetDisplayName(),
+			&mt.StreamEvent_Notified_ContactRequestSent{Contact: contact},
+			&mt.StreamEvent_Notified_Group{ConversationPublicKey: contact.GetConversationPublicKey(), Category: mt.StreamEvent_Notified_Group_CategoryContactRequest},
+		)
+		if err != nil {
+			h.logger.Warn("Failed to notify", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{
+				{Name: "Error", Description: err.Error()},
+			})...)
+		}
+
 		return nil
 	}); err != nil {
 		return errcode.ErrDBWrite.Wrap(err)
 	}
 
-	h.logger.Debug("Got contact from db", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{
-		{Name: "Contact", Description: fmt.Sprint(contact)},
-	})...)
-
-	// dispatch event and subscribe to group metadata
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
-		return err
-	}
-
-	err = h.dispatcher.Notify(
-		mt.StreamEvent_Notified_TypeContactRequestSent,
-		"Contact request sent",
-		"To: "+contact.GetDisplayName(),
-		&mt.StreamEvent_Notified_ContactRequestSent{Contact: contact},
-	)
-	if err != nil {
-		h.logger.Warn("Failed to notify", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{
-			{Name: "Error", Description: err.Error()},
-		})...)
-	}
+	h.flushOutbox()
 
 	if err := h.postHandlerActions.ContactConversationJoined(contact); err != nil {
 		return err
@@ -532,6 +774,13 @@ func (h *EventHandler) accountContactRequestIncomingReceived(gme *protocoltypes.
 			return errcode.ErrDBAddContactRequestIncomingReceived.Wrap(err)
 		}
 
+		if m.GetIntroduction() != "" {
+			if err := tx.SetContactIntroduction(contactPK, m.GetIntroduction()); err != nil {
+				return err
+			}
+			contact.Introduction = m.GetIntroduction()
+		}
+
 		// create new conversation
 		if conversation, err = tx.AddConversationForContact(groupPKBytes, messengerutil.B64EncodeBytes(ownMemberPK), messengerutil.B64EncodeBytes(ownDevicePK), contactPK); err != nil {
 			return err
@@ -541,28 +790,37 @@ func (h *EventHandler) accountContactRequestIncomingReceived(gme *protocoltypes.
 			return errcode.ErrDBWrite.Wrap(err)
 		}
 
-		return nil
-	}); err != nil {
-		return err
-	}
+		dispatcher := h.outboxFor(tx)
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, true); err != nil {
+			return err
+		}
 
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, true); err != nil {
-		return err
-	}
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, true); err != nil {
+			return err
+		}
+
+		body := "From: " + contact.GetDisplayName()
+		if contact.GetIntroduction() != "" {
+			body += "\n" + contact.GetIntroduction()
+		}
 
-	if err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, true); err != nil {
+		err = dispatcher.Notify(
+			mt.StreamEvent_Notified_TypeContactRequestReceived,
+			"Contact request received",
+			body,
+			&mt.StreamEvent_Notified_ContactRequestReceived{Contact: contact},
+			&mt.StreamEvent_Notified_Group{ConversationPublicKey: contact.GetConversationPublicKey(), Category: mt.StreamEvent_Notified_Group_CategoryContactRequest},
+		)
+		if err != nil {
+			h.logger.Warn("failed to notify", zap.Error(err))
+		}
+
+		return nil
+	}); err != nil {
 		return err
 	}
 
-	err = h.dispatcher.Notify(
-		mt.StreamEvent_Notified_TypeContactRequestReceived,
-		"Contact request received",
-		"From: "+contact.GetDisplayName(),
-		&mt.StreamEvent_Notified_ContactRequestReceived{Contact: contact},
-	)
-	if err != nil {
-		h.logger.Warn("failed to notify", zap.Error(err))
-	}
+	h.flushOutbox()
 
 	return nil
 }
@@ -582,16 +840,38 @@ func (h *EventHandler) accountContactRequestIncomingAccepted(gme *protocoltypes.
 		return err
 	}
 
-	contact, err := h.db.AddContactRequestIncomingAccepted(contactPK, messengerutil.B64EncodeBytes(groupPK))
-	if err != nil {
-		return errcode.ErrDBAddContactRequestIncomingAccepted.Wrap(err)
-	}
+	var contact *mt.Contact
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		var err error
+
+		contact, err = tx.AddContactRequestIncomingAccepted(contactPK, messengerutil.B64EncodeBytes(groupPK))
+		if err != nil {
+			return errcode.ErrDBAddContactRequestIncomingAccepted.Wrap(err)
+		}
 
-	// dispatch event to subscribers
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+		introduction, err := tx.ConvertContactIntroduction(contactPK, false)
+		if err != nil {
+			return err
+		}
+		contact.Introduction = ""
+
+		// dispatch event to subscribers
+		dispatcher := h.outboxFor(tx)
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+			return err
+		}
+
+		if introduction == nil {
+			return nil
+		}
+
+		return messengerutil.StreamInteraction(dispatcher, tx, introduction.GetCID(), true)
+	}); err != nil {
 		return err
 	}
 
+	h.flushOutbox()
+
 	if err := h.postHandlerActions.ContactConversationJoined(contact); err != nil {
 		return err
 	}
@@ -599,46 +879,108 @@ func (h *EventHandler) accountContactRequestIncomingAccepted(gme *protocoltypes.
 	return nil
 }
 
-func (h *EventHandler) contactRequestAccepted(contact *mt.Contact, memberPK []byte) error {
-	// someone you invited just accepted the invitation
-	// update contact
+func (h *EventHandler) accountContactRequestIncomingDiscarded(gme *protocoltypes.GroupMetadataEvent) error {
+	var ev protocoltypes.AccountContactRequestDiscarded
+	if err := proto.Unmarshal(gme.GetEvent(), &ev); err != nil {
+		return err
+	}
+	if len(ev.GetContactPK()) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact pk is empty"))
+	}
 
-	{
-		groupPK, err := h.metaFetcher.GroupPKForContact(h.ctx, memberPK)
-		if err != nil {
-			return errcode.ErrInternal.Wrap(fmt.Errorf("can't get group public key for contact %w", err))
-		}
+	return h.setContactState(messengerutil.B64EncodeBytes(ev.GetContactPK()), mt.Contact_Removed, mt.Contact_IncomingRequest)
+}
 
-		contact.State = mt.Contact_Accepted
-		contact.ConversationPublicKey = messengerutil.B64EncodeBytes(groupPK)
+func (h *EventHandler) accountContactBlocked(gme *protocoltypes.GroupMetadataEvent) error {
+	var ev protocoltypes.AccountContactBlocked
+	if err := proto.Unmarshal(gme.GetEvent(), &ev); err != nil {
+		return err
+	}
+	if len(ev.GetContactPK()) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact pk is empty"))
 	}
 
-	// update db
 	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
-		var err error
-
-		// update existing contact
-		if err = tx.UpdateContact(contact.GetPublicKey(), *contact); err != nil {
+		contact, updated, err := tx.BlockContact(messengerutil.B64EncodeBytes(ev.GetContactPK()))
+		if err != nil || !updated {
 			return err
 		}
 
-		return nil
+		return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false)
 	}); err != nil {
 		return err
 	}
 
-	// dispatch events
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+	h.flushOutbox()
+
+	return nil
+}
+
+// accountContactUnblocked removes the contact, as for the protocol a new
+// contact request is needed after a contact has been unblocked
+func (h *EventHandler) accountContactUnblocked(gme *protocoltypes.GroupMetadataEvent) error {
+	var ev protocoltypes.AccountContactUnblocked
+	if err := proto.Unmarshal(gme.GetEvent(), &ev); err != nil {
 		return err
 	}
+	if len(ev.GetContactPK()) == 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact pk is empty"))
+	}
 
-	if err := h.postHandlerActions.ContactConversationJoined(contact); err != nil {
+	return h.setContactState(messengerutil.B64EncodeBytes(ev.GetContactPK()), mt.Contact_Removed, mt.Contact_Blocked)
+}
+
+// setContactState moves a contact to state if its current state is one of
+// from, the contact is streamed if it has been updated
+func (h *EventHandler) setContactState(contactPK string, state mt.Contact_State, from ...mt.Contact_State) error {
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		contact, updated, err := tx.SetContactState(contactPK, state, from...)
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && !updated) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false)
+	}); err != nil {
 		return err
 	}
 
+	h.flushOutbox()
+
 	return nil
 }
 
+func (h *EventHandler) contactRequestAccepted(tx *messengerdb.DBWrapper, contact *mt.Contact, groupPK []byte) error {
+	// someone you invited just accepted the invitation
+	// update contact
+	contact.State = mt.Contact_Accepted
+	contact.ConversationPublicKey = messengerutil.B64EncodeBytes(groupPK)
+
+	// update existing contact
+	if err := tx.UpdateContact(contact.GetPublicKey(), *contact); err != nil {
+		return err
+	}
+
+	introduction, err := tx.ConvertContactIntroduction(contact.GetPublicKey(), true)
+	if err != nil {
+		return err
+	}
+	contact.Introduction = ""
+
+	// dispatch events
+	dispatcher := h.outboxFor(tx)
+	if err := dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+		return err
+	}
+
+	if introduction == nil {
+		return nil
+	}
+
+	return messengerutil.StreamInteraction(dispatcher, tx, introduction.GetCID(), true)
+}
+
 func (h *EventHandler) multiMemberGroupInitialMemberAnnounced(gme *protocoltypes.GroupMetadataEvent) error {
 	var ev protocoltypes.MultiMemberInitialMember
 	if err := proto.Unmarshal(gme.GetEvent(), &ev); err != nil {
@@ -650,49 +992,47 @@ func (h *EventHandler) multiMemberGroupInitialMemberAnnounced(gme *protocoltypes
 	gpkb := gme.GetEventContext().GetGroupPK()
 	gpk := messengerutil.B64EncodeBytes(gpkb)
 
+	// the protocol isn't called while the transaction is running, it would
+	// hold the other transactions
+	ownMemberPK, _, err := h.metaFetcher.OwnMemberAndDevicePKForConversation(h.ctx, gpkb)
+	if err != nil {
+		return errcode.ErrGroupInfo.Wrap(err)
+	}
+
+	isMe := bytes.Equal(ownMemberPK, mpkb)
+
+	var member *mt.Member
 	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
 		// create or update member
 
-		member, err := tx.GetMemberByPK(mpk, gpk)
+		existing, err := tx.GetMemberByPK(mpk, gpk)
 		if err != gorm.ErrRecordNotFound && err != nil {
 			return errcode.ErrDBRead.Wrap(err)
 		}
 
 		if err == gorm.ErrRecordNotFound {
-			ownMemberPK, _, err := h.metaFetcher.OwnMemberAndDevicePKForConversation(h.ctx, gpkb)
-			if err != nil {
-				return errcode.ErrGroupInfo.Wrap(err)
-			}
-
-			isMe := bytes.Equal(ownMemberPK, mpkb)
-
 			if _, err := tx.AddMember(mpk, gpk, "", "", isMe, true); err != nil {
 				return errcode.ErrDBWrite.Wrap(err)
 			}
-		} else if err := tx.MarkMemberAsConversationCreator(member.PublicKey, gpk); err != nil {
+		} else if err := tx.MarkMemberAsConversationCreator(existing.PublicKey, gpk); err != nil {
 			return errcode.ErrDBWrite.Wrap(err)
 		}
 
-		return nil
-	}); err != nil {
-		return errcode.ErrDBWrite.Wrap(err)
-	}
-
-	// dispatch update
-	{
-		member, err := h.db.GetMemberByPK(mpk, gpk)
+		// dispatch update
+		member, err = tx.GetMemberByPK(mpk, gpk)
 		if err != nil {
 			return errcode.ErrDBRead.Wrap(err)
 		}
 
-		err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, true)
-		if err != nil {
-			return err
-		}
-
-		h.logger.Info("dispatched member update", zap.Any("member", member), zap.Bool("isNew", true))
+		return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, true)
+	}); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
 	}
 
+	h.flushOutbox()
+
+	h.logger.Info("dispatched member update", zap.Any("member", member), zap.Bool("isNew", true))
+
 	return nil
 }
 
@@ -726,296 +1066,1976 @@ func (h *EventHandler) groupMemberDeviceAdded(gme *protocoltypes.GroupMetadataEv
 
 	isMe := bytes.Equal(ownMemberPK, mpkb)
 
-	// Register device if not already known
-	if _, err := h.db.GetDeviceByPK(dpk); errors.Is(err, errcode.ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
-		device, err := h.db.AddDevice(dpk, mpk)
-		if err != nil {
+	keyEvent := &mt.DeviceKeyEvent{DevicePublicKey: dpk, MemberPublicKey: mpk, ConversationPublicKey: gpk}
+	if cid, err := ipfscid.Cast(gme.GetEventContext().GetID()); err == nil {
+		keyEvent.EventCID = cid.String()
+	}
+
+	// Check whether a contact request has been accepted (a device from the
+	// contact has been added to the group), the contact group is fetched
+	// before the transaction starts
+	var contactGroupPK []byte
+	if contact, err := h.db.GetContactByPK(mpk); err == nil && contact.GetState() == mt.Contact_OutgoingRequestSent {
+		if contactGroupPK, err = h.metaFetcher.GroupPKForContact(h.ctx, mpkb); err != nil {
+			return errcode.ErrInternal.Wrap(fmt.Errorf("can't get group public key for contact %w", err))
+		}
+	}
+
+	var (
+		acceptedContact *mt.Contact
+		member          *mt.Member
+		isNew           bool
+	)
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		dispatcher := h.outboxFor(tx)
+
+		// Register device if not already known, the keys are pinned to the
+		// first member announcing them
+		if known, err := tx.GetDeviceByPK(dpk); errors.Is(err, errcode.ErrNotFound) || errors.Is(err, gorm.ErrRecordNotFound) {
+			device, err := tx.AddDevice(dpk, mpk)
+			if err != nil {
+				return err
+			}
+
+			keyEvent.Type = mt.DeviceKeyEvent_Added
+			if err := tx.AddDeviceKeyEvent(keyEvent); err != nil {
+				return err
+			}
+
+			err = dispatcher.StreamEvent(mt.StreamEvent_TypeDeviceUpdated, &mt.StreamEvent_DeviceUpdated{Device: device}, true)
+			if err != nil {
+				h.logger.Error("error dispatching device updated", zap.Error(err))
+			}
+		} else if err == nil && known.GetMemberPublicKey() != mpk {
+			h.logger.Warn("device announced by another member", logutil.PrivateString("device-pk", dpk), logutil.PrivateString("member-pk", mpk), logutil.PrivateString("pinned-member-pk", known.GetMemberPublicKey()))
+
+			keyEvent.Type = mt.DeviceKeyEvent_Conflict
+			if err := tx.AddDeviceKeyEvent(keyEvent); err != nil {
+				return err
+			}
+		}
+
+		if contactGroupPK != nil {
+			if contact, err := tx.GetContactByPK(mpk); err == nil && contact.GetState() == mt.Contact_OutgoingRequestSent {
+				if err := h.contactRequestAccepted(tx, contact, contactGroupPK); err != nil {
+					return err
+				}
+				acceptedContact = contact
+			}
+		}
+
+		// check backlogs, identity information is applied first and the other
+		// interactions are streamed once the member is updated so clients never
+		// render them without an author name
+		userInfo := (*mt.AppMessage_SetUserInfo)(nil)
+		accountDeletedDate := int64(0)
+		deferred := []string(nil)
+		{
+			backlog, err := tx.Backlog().Attribute(dpk, gpk, mpk)
+			if err != nil {
+				return err
+			}
+
+			for _, elem := range backlog {
+				h.logger.Info("found elem in backlog", zap.String("type", elem.GetType().String()), logutil.PrivateString("device-pk", elem.GetDevicePublicKey()), logutil.PrivateString("conv", elem.GetConversationPublicKey()))
+
+				elem.MemberPublicKey = mpk
+
+				switch elem.GetType() {
+				case mt.AppMessage_TypeSetUserInfo:
+					var payload mt.AppMessage_SetUserInfo
+
+					if err := proto.Unmarshal(elem.GetPayload(), &payload); err != nil {
+						return err
+					}
+
+					userInfo = &payload
+
+					if err := tx.DeleteInteractions([]string{elem.CID}); err != nil {
+						return err
+					}
+
+					if err := dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: elem.GetCID(), ConversationPublicKey: gpk}, false); err != nil {
+						return err
+					}
+
+				case mt.AppMessage_TypeAccountDeleted:
+					accountDeletedDate = elem.GetSentDate()
+					deferred = append(deferred, elem.CID)
+
+				default:
+					deferred = append(deferred, elem.CID)
+				}
+			}
+		}
+
+		member = &mt.Member{
+			PublicKey:             mpk,
+			ConversationPublicKey: gpk,
+			IsMe:                  isMe,
+		}
+		if userInfo != nil {
+			member.DisplayName = userInfo.GetDisplayName()
+			member.AvatarCID = userInfo.GetAvatarCID()
+		}
+		member.AccountDeletedDate = accountDeletedDate
+
+		var err error
+		member, isNew, err = tx.UpsertMember(mpk, gpk, *member)
+		if err != nil {
+			return err
+		}
+
+		if userInfo != nil {
+			bio, links := messengerutil.SanitizeProfile(userInfo.GetBio(), userInfo.GetLinks())
+			if err := tx.UpdateMemberProfile(mpk, gpk, bio, links); err != nil {
+				return err
+			}
+
+			if member, err = tx.GetMemberByPK(mpk, gpk); err != nil {
+				return err
+			}
+		}
+
+		if err := dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, isNew); err != nil {
+			return err
+		}
+
+		for _, cid := range deferred {
+			if err := messengerutil.StreamInteraction(dispatcher, tx, cid, false); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	h.flushOutbox()
+
+	h.logger.Info("dispatched member update", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{
+		{Name: "GroupPK", Description: gpk},
+		{Name: "MemberPK", Description: mpk},
+		{Name: "DevicePK", Description: dpk},
+		{Name: "IsMe", Description: strconv.FormatBool(isMe)},
+		{Name: "IsNew", Description: strconv.FormatBool(isNew)},
+	})...)
+
+	if acceptedContact != nil {
+		if err := h.postHandlerActions.ContactConversationJoined(acceptedContact); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// backlogInteraction waits for the device of i to be added to the group, the
+// interactions dropped from the full backlog of the device are deleted
+func (h *EventHandler) backlogInteraction(tx *messengerdb.DBWrapper, i *mt.Interaction) error {
+	evicted, err := tx.Backlog().Add(i, time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, e := range evicted {
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: e.GetCID(), ConversationPublicKey: e.GetConversationPublicKey()}, false); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+func (h *EventHandler) handleAppMessageAcknowledge(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	// the acknowledges of the others are hidden when we don't send ours
+	if !i.GetIsMine() {
+		if disabled, _, err := tx.GetReceiptPrivacy(i.GetConversationPublicKey()); err != nil {
+			return nil, false, err
+		} else if disabled {
+			return i, false, nil
+		}
+	}
+
+	found, err := h.acknowledgeTarget(tx, i, i.GetTargetCID())
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !found {
+		h.logger.Debug("added ack in backlog", logutil.PrivateString("target", i.TargetCID), logutil.PrivateString("cid", i.GetCID()))
+		if i, _, err = tx.AddInteraction(*i); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// the other messages acknowledged in the same batch are kept in the
+	// backlog the same way, under a local cid of their own
+	payload, _ := amPayload.(*mt.AppMessage_Acknowledge)
+	for _, target := range payload.GetTargetCIDs() {
+		if target == "" || target == i.GetTargetCID() {
+			continue
+		}
+
+		if found, err := h.acknowledgeTarget(tx, i, target); err != nil {
+			return nil, false, err
+		} else if found {
+			continue
+		}
+
+		h.logger.Debug("added batched ack in backlog", logutil.PrivateString("target", target), logutil.PrivateString("cid", i.GetCID()))
+		backlogged := *i
+		backlogged.CID, backlogged.TargetCID = batchedAckCID(i.GetCID(), target), target
+		if _, _, err := tx.AddInteraction(backlogged); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return i, false, nil
+}
+
+// acknowledgeTarget records the acknowledge i of target, it returns false if
+// target wasn't received yet
+func (h *EventHandler) acknowledgeTarget(tx *messengerdb.DBWrapper, i *mt.Interaction, target string) (bool, error) {
+	if !i.GetIsMine() && target != "" && i.GetDevicePublicKey() != "" {
+		// older devices don't date their acknowledges
+		ackDate := i.GetSentDate()
+		if ackDate == 0 {
+			ackDate = messengerutil.TimestampMs(time.Now())
+		}
+
+		if _, err := tx.AddDeliveryReceipt(&mt.DeliveryReceipt{
+			InteractionCID:   target,
+			DevicePublicKey:  i.GetDevicePublicKey(),
+			MemberPublicKey:  senderMemberPK(i),
+			AcknowledgedDate: ackDate,
+		}); err != nil {
+			return false, err
+		}
+	}
+
+	acked, err := tx.MarkInteractionAsAcknowledged(target)
+	switch {
+	case err == gorm.ErrRecordNotFound:
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+
+	h.logger.Debug(messengerutil.TyberEventAcknowledgeReceived, tyber.FormatEventLogFields(h.ctx, []tyber.Detail{{Name: "TargetCID", Description: target}})...)
+
+	if acked != nil {
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, acked.CID, false); err != nil {
+			h.logger.Error("error while sending stream event", logutil.PrivateString("public-key", i.ConversationPublicKey), logutil.PrivateString("cid", i.CID), zap.Error(err))
+		}
+	}
+
+	return true, nil
+}
+
+// batchedAckCID is the local cid of the backlogged acknowledge of target sent
+// in the batch ackCID, the backlog is consumed by target like any acknowledge
+func batchedAckCID(ackCID, target string) string {
+	return ackCID + "/" + target
+}
+
+// handleAppMessageDeliveryReceipt records the device a message was delivered
+// to, receipts for messages not received yet are kept until they are
+func (h *EventHandler) handleAppMessageDeliveryReceipt(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
+	// the messages of the account are stored by each of its devices on their own
+	if i.GetIsMine() {
+		return i, false, nil
+	}
+
+	if i.GetTargetCID() == "" || i.GetDevicePublicKey() == "" {
+		h.logger.Warn("dropping delivery receipt without target or device", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	isNew, err := tx.AddDeliveryReceipt(&mt.DeliveryReceipt{
+		InteractionCID:  i.GetTargetCID(),
+		DevicePublicKey: i.GetDevicePublicKey(),
+		MemberPublicKey: senderMemberPK(i),
+		DeliveredDate:   i.GetSentDate(),
+	})
+	if err != nil || !isNew {
+		return i, false, err
+	}
+
+	target, err := tx.GetInteractionByCID(i.GetTargetCID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return i, false, nil
+	} else if err != nil {
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if target.GetIsMine() {
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, target.GetCID(), false); err != nil {
+			return nil, false, err
+		}
+	}
+
+	return i, false, nil
+}
+
+// handleAppMessageReadReceipt moves the read marker of the sender, read
+// receipts aren't stored as interactions
+func (h *EventHandler) handleAppMessageReadReceipt(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_ReadReceipt)
+
+	// the receipts of the account carry its read position to its other devices
+	if i.GetIsMine() {
+		if i.GetTargetCID() == "" {
+			return i, false, nil
+		}
+
+		conv, moved, err := tx.SetConversationReadPosition(i.GetConversationPublicKey(), i.GetTargetCID())
+		switch {
+		case errcode.Is(err, errcode.ErrNotFound), errcode.Is(err, errcode.ErrInvalidInput):
+			h.logger.Debug("dropping invalid read position", logutil.PrivateString("cid", i.GetTargetCID()))
+			return i, false, nil
+		case err != nil || !moved:
+			return i, false, err
+		}
+
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+			return nil, false, err
+		}
+
+		return i, false, nil
+	}
+
+	// the read receipts of the others are hidden when we don't send ours
+	if disabled, _, err := tx.GetReceiptPrivacy(i.GetConversationPublicKey()); err != nil {
+		return nil, false, err
+	} else if disabled {
+		return i, false, nil
+	}
+
+	memberPK := senderMemberPK(i)
+	if memberPK == "" {
+		return i, false, nil
+	}
+
+	readDate := payload.GetReadUpToDate()
+	if readDate == 0 && i.GetTargetCID() != "" {
+		target, err := tx.GetInteractionByCID(i.GetTargetCID())
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return nil, false, errcode.ErrDBRead.Wrap(err)
+		default:
+			readDate = target.GetSentDate()
+		}
+	}
+
+	if readDate == 0 {
+		h.logger.Debug("dropping read receipt without date", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	marker := mt.ReadMarker{
+		ConversationPublicKey: i.GetConversationPublicKey(),
+		MemberPublicKey:       memberPK,
+		InteractionCID:        i.GetTargetCID(),
+		ReadDate:              readDate,
+		UpdatedDate:           i.GetSentDate(),
+	}
+
+	moved, err := tx.SetReadMarker(marker)
+	if err != nil || !moved {
+		return i, false, err
+	}
+
+	if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeReadReceiptUpdated, &mt.StreamEvent_ReadReceiptUpdated{ReadMarker: &marker}, false); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+// handleAppMessageBookmark applies the bookmarks synced by the devices of the
+// account, including the ones sent by this device
+func (h *EventHandler) handleAppMessageBookmark(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_Bookmark)
+
+	if !i.GetIsMine() || i.GetTargetCID() == "" {
+		return i, false, nil
+	}
+
+	// bookmarks are only synced on the account group
+	acc, err := tx.GetAccount()
+	if err != nil {
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	}
+	if acc.GetPublicKey() != i.GetConversationPublicKey() {
+		h.logger.Warn("dropping bookmark sent outside of the account group", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	bookmark := &mt.Bookmark{
+		InteractionCID:        i.GetTargetCID(),
+		ConversationPublicKey: payload.GetConversationPublicKey(),
+		UpdatedDate:           i.GetSentDate(),
+		Removed:               payload.GetRemoved(),
+	}
+
+	changed, err := tx.SetBookmark(*bookmark)
+	if err != nil || !changed {
+		return i, false, err
+	}
+
+	if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeBookmarkUpdated, &mt.StreamEvent_BookmarkUpdated{Bookmark: bookmark}, false); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+// handleAppMessagePinMessage applies the pins and unpins of the members of a
+// conversation, including the ones sent by this device
+func (h *EventHandler) handleAppMessagePinMessage(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_PinMessage)
+
+	if i.GetTargetCID() == "" {
+		return i, false, nil
+	}
+
+	// the pinned interaction can be unknown to this device, it is checked once received
+	target, err := tx.GetInteractionByCID(i.GetTargetCID())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	case target.GetConversationPublicKey() != i.GetConversationPublicKey():
+		h.logger.Warn("dropping pin of an interaction of another conversation", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	memberPK := senderMemberPK(i)
+	if memberPK == "" && i.GetIsMine() {
+		memberPK = i.GetConversation().GetAccountMemberPublicKey()
+	}
+
+	pinned := &mt.PinnedMessage{
+		InteractionCID:        i.GetTargetCID(),
+		ConversationPublicKey: i.GetConversationPublicKey(),
+		MemberPublicKey:       memberPK,
+		UpdatedDate:           i.GetSentDate(),
+		Removed:               payload.GetRemoved(),
+	}
+
+	changed, err := tx.SetPinnedMessage(*pinned)
+	if err != nil || !changed {
+		return i, false, err
+	}
+
+	if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypePinnedMessageUpdated, &mt.StreamEvent_PinnedMessageUpdated{PinnedMessage: pinned}, false); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+func (h *EventHandler) handleAppMessagePoll(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	if err := amPayload.(*mt.AppMessage_Poll).Validate(); err != nil {
+		h.logger.Warn("dropping invalid poll", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if isNew && i.GetMemberPublicKey() != "" {
+		if err := tx.UpdateMemberLastMessageDate(i.GetMemberPublicKey(), i.GetConversationPublicKey(), i.GetSentDate()); err != nil {
+			return nil, isNew, err
+		}
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.GetCID(), isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+// handleAppMessagePollVote keeps the latest vote of each member, the votes
+// received before their poll are checked once it is received
+func (h *EventHandler) handleAppMessagePollVote(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_PollVote)
+
+	if i.GetTargetCID() == "" {
+		h.logger.Warn("dropping poll vote without target", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	target, err := tx.GetInteractionByCID(i.GetTargetCID())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		target = nil
+	case err != nil:
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	case target.GetType() != mt.AppMessage_TypePoll || target.GetConversationPublicKey() != i.GetConversationPublicKey():
+		h.logger.Warn("dropping vote of an unknown poll", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	default:
+		var poll mt.AppMessage_Poll
+		if err := proto.Unmarshal(target.GetPayload(), &poll); err != nil {
+			return nil, false, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if err := poll.ValidateVote(payload); err != nil {
+			h.logger.Warn("dropping invalid poll vote", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+			return i, false, nil
+		}
+	}
+
+	memberPK := senderMemberPK(i)
+	if memberPK == "" && i.GetIsMine() {
+		memberPK = i.GetConversation().GetAccountMemberPublicKey()
+	}
+	if memberPK == "" {
+		return i, false, nil
+	}
+
+	vote, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, false, errcode.ErrSerialization.Wrap(err)
+	}
+
+	changed, err := tx.SetPollVote(mt.PollVote{
+		PollCID:         i.GetTargetCID(),
+		MemberPublicKey: memberPK,
+		IsMine:          i.GetIsMine(),
+		StateDate:       i.GetSentDate(),
+		Payload:         vote,
+	})
+	if err != nil || !changed || target == nil {
+		return i, false, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, target.GetCID(), false); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+func (h *EventHandler) handleAppMessageCalendarEvent(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	if err := amPayload.(*mt.AppMessage_CalendarEvent).Validate(); err != nil {
+		h.logger.Warn("dropping invalid calendar event", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if isNew && i.GetMemberPublicKey() != "" {
+		if err := tx.UpdateMemberLastMessageDate(i.GetMemberPublicKey(), i.GetConversationPublicKey(), i.GetSentDate()); err != nil {
+			return nil, isNew, err
+		}
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.GetCID(), isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+// handleAppMessageCalendarEventRSVP keeps the latest response of each member,
+// the responses received before their event are kept until it is received
+func (h *EventHandler) handleAppMessageCalendarEventRSVP(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_CalendarEventRSVP)
+
+	if i.GetTargetCID() == "" {
+		h.logger.Warn("dropping calendar event response without target", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	if err := payload.Validate(); err != nil {
+		h.logger.Warn("dropping invalid calendar event response", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	target, err := tx.GetInteractionByCID(i.GetTargetCID())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		target = nil
+	case err != nil:
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	case target.GetType() != mt.AppMessage_TypeCalendarEvent || target.GetConversationPublicKey() != i.GetConversationPublicKey():
+		h.logger.Warn("dropping response to an unknown calendar event", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	memberPK := senderMemberPK(i)
+	if memberPK == "" && i.GetIsMine() {
+		memberPK = i.GetConversation().GetAccountMemberPublicKey()
+	}
+	if memberPK == "" {
+		return i, false, nil
+	}
+
+	changed, err := tx.SetCalendarEventRSVP(mt.CalendarEventRSVP{
+		EventCID:        i.GetTargetCID(),
+		MemberPublicKey: memberPK,
+		IsMine:          i.GetIsMine(),
+		StateDate:       i.GetSentDate(),
+		Response:        payload.GetResponse(),
+	})
+	if err != nil || !changed || target == nil {
+		return i, false, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, target.GetCID(), false); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+// handleAppMessageLocation adds a position shared once, it replaces the
+// previous position of its sender in the conversation
+func (h *EventHandler) handleAppMessageLocation(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_Location)
+	if err := payload.Validate(); err != nil {
+		h.logger.Warn("dropping invalid location", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	i, isNew, err := h.addLocationInteraction(tx, i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if err := h.setMemberLocation(tx, i, mt.MemberLocation{
+		CID:       i.GetCID(),
+		Latitude:  payload.GetLatitude(),
+		Longitude: payload.GetLongitude(),
+		Accuracy:  payload.GetAccuracy(),
+	}); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+// handleAppMessageLiveLocation adds the interaction starting a live share, the
+// following updates target it and only replace the position of the sender
+func (h *EventHandler) handleAppMessageLiveLocation(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_LiveLocation)
+	if err := payload.Validate(); err != nil {
+		h.logger.Warn("dropping invalid live location", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	isNew := false
+	shareCID := i.GetTargetCID()
+	if shareCID == "" {
+		if payload.GetStopped() {
+			h.logger.Warn("dropping live location stopped before it started", logutil.PrivateString("cid", i.GetCID()))
+			return i, false, nil
+		}
+
+		var err error
+		if i, isNew, err = h.addLocationInteraction(tx, i); err != nil {
+			return nil, isNew, err
+		}
+		shareCID = i.GetCID()
+	} else {
+		// the updates received before the start of their share are kept
+		target, err := tx.GetInteractionByCID(shareCID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+		case err != nil:
+			return nil, false, errcode.ErrDBRead.Wrap(err)
+		case target.GetType() != mt.AppMessage_TypeLiveLocation || target.GetConversationPublicKey() != i.GetConversationPublicKey() || !isSameAuthor(i.GetIsMine(), senderMemberPK(i), i.GetDevicePublicKey(), target):
+			h.logger.Warn("dropping update of an unknown live location", logutil.PrivateString("cid", i.GetCID()))
+			return i, false, nil
+		}
+	}
+
+	if err := h.setMemberLocation(tx, i, mt.MemberLocation{
+		CID:         shareCID,
+		Latitude:    payload.GetLatitude(),
+		Longitude:   payload.GetLongitude(),
+		Accuracy:    payload.GetAccuracy(),
+		Live:        true,
+		ExpiresDate: payload.GetExpiresDate(),
+		Stopped:     payload.GetStopped(),
+	}); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+// handleAppMessageSetEphemeralPolicy adds the policy change to the
+// conversation and applies it to the messages sent after it
+func (h *EventHandler) handleAppMessageSetEphemeralPolicy(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_SetEphemeralPolicy)
+	if err := payload.Validate(); err != nil {
+		h.logger.Warn("dropping invalid ephemeral policy", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.GetCID(), isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	changed, err := tx.SetConversationEphemeralPolicy(i.GetConversationPublicKey(), payload.GetMessageTTL(), i.GetSentDate())
+	if err != nil || !changed {
+		return i, isNew, err
+	}
+
+	conv, err := tx.GetConversationByPK(i.GetConversationPublicKey())
+	if err != nil {
+		return nil, isNew, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+// handleAppMessageSetSlowMode adds the slow mode change to the conversation,
+// the changes not sent by a creator of the conversation are dropped
+func (h *EventHandler) handleAppMessageSetSlowMode(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_SetSlowMode)
+	if err := payload.Validate(); err != nil {
+		h.logger.Warn("dropping invalid slow mode", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	if admin, err := tx.IsConversationAdmin(i.GetConversationPublicKey(), senderMemberPK(i), i.GetIsMine()); err != nil {
+		return nil, false, err
+	} else if !admin {
+		h.logger.Warn("dropping slow mode not set by an admin", logutil.PrivateString("cid", i.GetCID()), logutil.PrivateString("member-pk", senderMemberPK(i)))
+		return i, false, nil
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.GetCID(), isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	changed, err := tx.SetConversationSlowMode(i.GetConversationPublicKey(), payload.GetInterval(), i.GetSentDate())
+	if err != nil || !changed {
+		return i, isNew, err
+	}
+
+	conv, err := tx.GetConversationByPK(i.GetConversationPublicKey())
+	if err != nil {
+		return nil, isNew, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+func (h *EventHandler) addLocationInteraction(tx *messengerdb.DBWrapper, i *mt.Interaction) (*mt.Interaction, bool, error) {
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if isNew && i.GetMemberPublicKey() != "" {
+		if err := tx.UpdateMemberLastMessageDate(i.GetMemberPublicKey(), i.GetConversationPublicKey(), i.GetSentDate()); err != nil {
+			return nil, isNew, err
+		}
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.GetCID(), isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+// setMemberLocation stores the position shared by the sender of i and streams
+// it when it changed
+func (h *EventHandler) setMemberLocation(tx *messengerdb.DBWrapper, i *mt.Interaction, location mt.MemberLocation) error {
+	memberPK := senderMemberPK(i)
+	if memberPK == "" && i.GetIsMine() {
+		memberPK = i.GetConversation().GetAccountMemberPublicKey()
+	}
+	if memberPK == "" {
+		return nil
+	}
+
+	location.ConversationPublicKey = i.GetConversationPublicKey()
+	location.MemberPublicKey = memberPK
+	location.IsMine = i.GetIsMine()
+	location.StateDate = i.GetSentDate()
+
+	stored, changed, err := tx.SetMemberLocation(location)
+	if err != nil || !changed {
+		return err
+	}
+
+	return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeLocationUpdated, &mt.StreamEvent_LocationUpdated{Location: stored}, false)
+}
+
+func (h *EventHandler) handleAppMessageGroupInvitation(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	if len(i.GetPayload()) == 0 {
+		return nil, false, ErrNilPayload
+	}
+
+	// an invitation without preview is still shown, the link is checked again
+	// when it is used
+	if preview, err := h.groupInvitationPreview(tx, i, amPayload.(*mt.AppMessage_GroupInvitation)); err != nil {
+		h.logger.Warn("unable to preview group invitation", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+	} else {
+		i.GroupInvitationPreview = preview
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.CID, isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	// fetch contact from db
+	var contact *mt.Contact
+	if i.Conversation.Type == mt.Conversation_ContactType {
+		if contact, err = tx.GetContactByPK(i.Conversation.ContactPublicKey); err != nil {
+			h.logger.Warn("1to1 message contact not found", logutil.PrivateString("public-key", i.Conversation.ContactPublicKey), zap.Error(err))
+		}
+		if !i.IsMine && isNew {
+			group := &mt.StreamEvent_Notified_Group{ConversationPublicKey: i.ConversationPublicKey, Category: mt.StreamEvent_Notified_Group_CategoryGroupInvitation}
+			err = h.outboxFor(tx).Notify(mt.StreamEvent_Notified_TypeGroupInvitation, "Group invitation", "From: "+contact.GetDisplayName(), &mt.StreamEvent_Notified_GroupInvitation{Contact: contact}, group)
+			if err != nil {
+				h.logger.Error("failed to notify", zap.Error(err))
+			}
+		}
+	}
+
+	// TODO: Notify for multimember conversation when it will be possible in UI
+
+	return i, isNew, err
+}
+
+// groupInvitationPreview resolves the group of an invitation from its link,
+// along with its inviter. The clients are told if the group was joined or if
+// an invitation to it was received already, joining it again would fail.
+func (h *EventHandler) groupInvitationPreview(tx *messengerdb.DBWrapper, i *mt.Interaction, invitation *mt.AppMessage_GroupInvitation) (*mt.GroupInvitationPreview, error) {
+	preview, err := messengerutil.GroupInvitationPreview(invitation.GetLink(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.SetGroupInvitationMembership(preview); err != nil {
+		return nil, err
+	}
+
+	if preview.GetGroupPublicKey() != "" {
+		if preview.DuplicateOfCID, err = tx.FirstGroupInvitationCID(preview.GetGroupPublicKey(), i.GetCID()); err != nil {
+			return nil, err
+		}
+	}
+
+	preview.InteractionCID = i.GetCID()
+	preview.InviterMemberPublicKey, preview.InviterDisplayName = InteractionAuthor(tx, i)
+
+	return preview, nil
+}
+
+// handleAppMessageContactShare adds the contact shared by a member, the
+// contact request is only sent once accepted with AcceptSharedContact
+func (h *EventHandler) handleAppMessageContactShare(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	if _, err := messengerutil.ContactShareLink(amPayload.(*mt.AppMessage_ContactShare)); err != nil {
+		h.logger.Warn("dropping invalid contact share", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.CID, isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	return i, isNew, nil
+}
+
+func (h *EventHandler) handleAppMessageUserMessage(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	// NOTE: it's ok to have an empty payload here since a user message can be only medias
+	if msg, ok := amPayload.(*mt.AppMessage_UserMessage); ok && msg.GetForwardedFrom() != nil {
+		// an invalid origin doesn't prevent the message from being shown
+		if err := msg.GetForwardedFrom().Validate(); err != nil {
+			h.logger.Warn("ignoring invalid forward origin", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		} else {
+			i.ForwardedFrom = msg.GetForwardedFrom().ForwardedFrom(i.GetCID())
+		}
+	}
+
+	if msg, ok := amPayload.(*mt.AppMessage_UserMessage); ok {
+		i.Mentions = msg.InteractionMentions(i.GetCID())
+	}
+
+	if i.TargetCID != "" {
+		rootCID, err := tx.GetThreadRootCID(i.TargetCID)
+		if err != nil {
+			return nil, false, err
+		}
+		i.ThreadRootCID = rootCID
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if isNew && i.MemberPublicKey != "" {
+		if err := tx.UpdateMemberLastMessageDate(i.MemberPublicKey, i.ConversationPublicKey, i.SentDate); err != nil {
+			return nil, isNew, err
+		}
+	}
+
+	if isNew && i.TargetCID != "" {
+		if err := h.snapshotQuote(tx, i); err != nil {
+			return nil, isNew, err
+		}
+	}
+
+	// the edits received before this message
+	if isNew {
+		if _, err := h.applyEdits(tx, i); err != nil {
+			return nil, isNew, err
+		}
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.CID, isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	// the replies received before this message can now show it
+	if isNew {
+		if err := h.refreshQuotes(tx, i); err != nil {
+			return nil, isNew, err
+		}
+
+		if err := h.joinThread(tx, i); err != nil {
+			return nil, isNew, err
+		}
+
+		h.updateLanguageHint(tx, i.ConversationPublicKey)
+	}
+
+	if i.IsMine || h.replay || !isNew {
+		return i, isNew, nil
+	}
+
+	if err := h.postHandlerActions.InteractionReceived(i); err != nil {
+		return nil, isNew, err
+	}
+
+	// notify
+
+	// Receiving a message for a conversation not known yet, returning early
+	if i.Conversation == nil {
+		return i, isNew, nil
+	}
+
+	// the notification state is kept in memory, nothing more is read from
+	// the db for each message
+	state, err := tx.GetNotificationState(i.Conversation, time.Now())
+	if err != nil {
+		h.logger.Warn("unable to get the notification state of the conversation", zap.Error(err))
+		state = &messengerdb.NotificationState{}
+	}
+
+	// Receiving a message for an opened conversation returning early
+	if state.Opened {
+		return i, isNew, nil
+	}
+
+	contact := state.Contact
+	if contact == nil && i.Conversation.Type == mt.Conversation_ContactType {
+		h.logger.Warn("1to1 message contact not found", logutil.PrivateString("public-key", i.Conversation.ContactPublicKey))
+	}
+
+	payload := amPayload.(*mt.AppMessage_UserMessage)
+	var title string
+	body := payload.GetBody()
+	if contact != nil && i.Conversation.Type == mt.Conversation_ContactType {
+		title = contact.GetDisplayName()
+	} else {
+		title = i.Conversation.GetDisplayName()
+		memberName := i.Member.GetDisplayName()
+		if memberName != "" {
+			body = memberName + ": " + payload.GetBody()
+		}
+	}
+
+	msgRecvd := mt.StreamEvent_Notified_MessageReceived{
+		Interaction:  i,
+		Conversation: i.Conversation,
+		Contact:      contact,
+	}
+
+	group := &mt.StreamEvent_Notified_Group{ConversationPublicKey: i.ConversationPublicKey, ThreadCID: i.ThreadRootCID, Category: mt.StreamEvent_Notified_Group_CategoryMessage}
+
+	// the mentions are notified even in the muted conversations
+	notifType := mt.StreamEvent_Notified_TypeMessageReceived
+	if i.IsMentioning(i.Conversation.GetAccountMemberPublicKey()) {
+		notifType, group.Category = mt.StreamEvent_Notified_TypeMentioned, mt.StreamEvent_Notified_Group_CategoryMention
+	}
+
+	err = h.outboxFor(tx).Notify(notifType, title, body, &msgRecvd, group)
+	if err != nil {
+		h.logger.Error("failed to notify", zap.Error(err))
+	}
+
+	return i, isNew, nil
+}
+
+// snapshotQuote stores the snapshot of the message i replies to, it is only
+// partial if the target hasn't been received yet, see refreshQuotes
+func (h *EventHandler) snapshotQuote(tx *messengerdb.DBWrapper, i *mt.Interaction) error {
+	target, err := tx.GetInteractionByCID(i.TargetCID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.SaveQuoteSnapshot(&mt.QuoteSnapshot{InteractionCID: i.CID, TargetCID: i.TargetCID, TargetMissing: true})
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	return tx.SaveQuoteSnapshot(quoteSnapshotOf(tx, i.CID, target))
+}
+
+// handleAppMessageUserMessageEdit stores the edit in the history of the
+// targeted message and applies it if it is the latest one
+func (h *EventHandler) handleAppMessageUserMessageEdit(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_UserMessageEdit)
+
+	if i.GetTargetCID() == "" {
+		h.logger.Warn("dropping edit without target", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
+
+	body, err := proto.Marshal(&mt.AppMessage_UserMessage{Body: payload.GetBody()})
+	if err != nil {
+		return nil, false, errcode.ErrSerialization.Wrap(err)
+	}
+
+	isNew, err := tx.AddInteractionEdit(mt.InteractionEdit{
+		CID:             i.GetCID(),
+		InteractionCID:  i.GetTargetCID(),
+		MemberPublicKey: senderMemberPK(i),
+		DevicePublicKey: i.GetDevicePublicKey(),
+		IsMine:          i.GetIsMine(),
+		Payload:         body,
+		EditedDate:      i.GetSentDate(),
+	})
+	if err != nil || !isNew {
+		return i, false, err
+	}
+
+	target, err := tx.GetInteractionByCID(i.GetTargetCID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		h.logger.Debug("added edit in backlog", logutil.PrivateString("target", i.GetTargetCID()), logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	} else if err != nil {
+		return nil, false, errcode.ErrDBRead.Wrap(err)
+	}
+
+	edited, err := h.applyEdits(tx, target)
+	if err != nil || !edited {
+		return i, false, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, target.GetCID(), false); err != nil {
+		return nil, false, err
+	}
+
+	if err := h.refreshQuotes(tx, target); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+// updateLanguageHint infers the language of a conversation again from its
+// recent messages, a failure doesn't prevent the message from being shown
+func (h *EventHandler) updateLanguageHint(tx *messengerdb.DBWrapper, convPK string) {
+	conv, changed, err := tx.InferConversationLanguageHint(convPK)
+	if err != nil {
+		h.logger.Warn("unable to infer the conversation language", logutil.PrivateString("conversation-pk", convPK), zap.Error(err))
+		return
+	}
+	if !changed {
+		return
+	}
+
+	if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+		h.logger.Warn("unable to stream conversation update", zap.Error(err))
+	}
+}
+
+// applyEdits replaces the payload of target with its latest edit, the edits
+// which weren't made by the author of target are dropped. It returns whether
+// target changed.
+func (h *EventHandler) applyEdits(tx *messengerdb.DBWrapper, target *mt.Interaction) (bool, error) {
+	edits, err := tx.GetInteractionEdits(target.GetCID())
+	if err != nil || len(edits) == 0 {
+		return false, err
+	}
+
+	latest := (*mt.InteractionEdit)(nil)
+	rejected := []string(nil)
+	for _, edit := range edits {
+		if target.GetType() != mt.AppMessage_TypeUserMessage || !isSameAuthor(edit.GetIsMine(), edit.GetMemberPublicKey(), edit.GetDevicePublicKey(), target) {
+			rejected = append(rejected, edit.GetCID())
+			continue
+		}
+
+		if latest == nil {
+			latest = edit
+		}
+	}
+
+	if len(rejected) > 0 {
+		h.logger.Warn("dropping edits not made by the author of the message", logutil.PrivateString("target", target.GetCID()), zap.Int("count", len(rejected)))
+		if err := tx.DeleteInteractionEdits(rejected); err != nil {
+			return false, err
+		}
+	}
+
+	if latest == nil || latest.GetEditedDate() <= target.GetEditedDate() {
+		return false, nil
+	}
+
+	if err := tx.EditInteraction(target.GetCID(), latest.GetPayload(), latest.GetEditedDate()); err != nil {
+		return false, err
+	}
+	target.Payload, target.EditedDate = latest.GetPayload(), latest.GetEditedDate()
+
+	// the search index follows the latest version
+	var msg mt.AppMessage_UserMessage
+	if err := proto.Unmarshal(latest.GetPayload(), &msg); err == nil && msg.GetBody() != "" {
+		if err := tx.InteractionIndexText(target.GetCID(), msg.GetBody()); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// isSameAuthor returns whether the sender of a message, described by isMine,
+// its member and its device, is the author of target
+func isSameAuthor(isMine bool, memberPK, devicePK string, target *mt.Interaction) bool {
+	if isMine || target.GetIsMine() {
+		return isMine && target.GetIsMine()
+	}
+
+	if devicePK != "" && devicePK == target.GetDevicePublicKey() {
+		return true
+	}
+
+	targetMemberPK := senderMemberPK(target)
+	return targetMemberPK != "" && memberPK == targetMemberPK
+}
+
+// handleAppMessageMessageRetract deletes the interaction targeted by the
+// retraction, the retractions received before their target wait in the
+// backlog, see interactionConsumeRetractions
+func (h *EventHandler) handleAppMessageMessageRetract(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
+	if i.GetTargetCID() == "" {
+		h.logger.Warn("dropping retraction without target", logutil.PrivateString("cid", i.GetCID()))
+		return i, false, nil
+	}
 
-		err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeDeviceUpdated, &mt.StreamEvent_DeviceUpdated{Device: device}, true)
+	target, err := tx.GetInteractionByCID(i.GetTargetCID())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		h.logger.Debug("added retraction in backlog", logutil.PrivateString("target", i.GetTargetCID()), logutil.PrivateString("cid", i.GetCID()))
+		i, _, err = tx.AddInteraction(*i)
 		if err != nil {
-			h.logger.Error("error dispatching device updated", zap.Error(err))
+			return nil, false, err
 		}
+
+		return i, false, nil
+
+	case err != nil:
+		return nil, false, errcode.ErrDBRead.Wrap(err)
 	}
 
-	// Check whether a contact request has been accepted (a device from the contact has been added to the group)
-	if contact, err := h.db.GetContactByPK(mpk); err == nil && contact.GetState() == mt.Contact_OutgoingRequestSent {
-		if err := h.contactRequestAccepted(contact, mpkb); err != nil {
-			return err
+	if _, err := h.retractInteraction(tx, target, i); err != nil {
+		return nil, false, err
+	}
+
+	return i, false, nil
+}
+
+// interactionConsumeRetractions applies the retractions of i waiting in the
+// backlog, it returns whether i was retracted
+func (h *EventHandler) interactionConsumeRetractions(tx *messengerdb.DBWrapper, i *mt.Interaction) (bool, error) {
+	retractions, err := tx.GetRetractionsForInteraction(i.GetCID())
+	if err != nil || len(retractions) == 0 {
+		return false, err
+	}
+
+	cids := make([]string, len(retractions))
+	for j, retraction := range retractions {
+		cids[j] = retraction.GetCID()
+	}
+
+	if err := tx.DeleteInteractions(cids); err != nil {
+		return false, err
+	}
+
+	for _, cid := range cids {
+		h.logger.Debug("found retraction in backlog", logutil.PrivateString("target", i.GetCID()), logutil.PrivateString("cid", cid))
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: cid, ConversationPublicKey: i.GetConversationPublicKey()}, false); err != nil {
+			return false, err
 		}
 	}
 
-	// check backlogs
-	userInfo := (*mt.AppMessage_SetUserInfo)(nil)
-	{
-		backlog, err := h.db.AttributeBacklogInteractions(dpk, gpk, mpk)
-		if err != nil {
-			return err
+	for _, retraction := range retractions {
+		if retracted, err := h.retractInteraction(tx, i, retraction); err != nil || retracted {
+			return retracted, err
 		}
+	}
 
-		for _, elem := range backlog {
-			h.logger.Info("found elem in backlog", zap.String("type", elem.GetType().String()), logutil.PrivateString("device-pk", elem.GetDevicePublicKey()), logutil.PrivateString("conv", elem.GetConversationPublicKey()))
+	return false, nil
+}
 
-			elem.MemberPublicKey = mpk
+// retractInteraction deletes target if the retraction was sent by its author,
+// it returns whether target was deleted
+func (h *EventHandler) retractInteraction(tx *messengerdb.DBWrapper, target *mt.Interaction, retraction *mt.Interaction) (bool, error) {
+	if !isSameAuthor(retraction.GetIsMine(), senderMemberPK(retraction), retraction.GetDevicePublicKey(), target) {
+		h.logger.Warn("dropping retraction not made by the author of the interaction", logutil.PrivateString("target", target.GetCID()), logutil.PrivateString("cid", retraction.GetCID()))
+		return false, nil
+	}
 
-			switch elem.GetType() {
-			case mt.AppMessage_TypeSetUserInfo:
-				var payload mt.AppMessage_SetUserInfo
+	replies, err := tx.RetractInteraction(target.GetCID())
+	if err != nil {
+		return false, err
+	}
 
-				if err := proto.Unmarshal(elem.GetPayload(), &payload); err != nil {
-					return err
-				}
+	outbox := h.outboxFor(tx)
+	if err := outbox.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: target.GetCID(), ConversationPublicKey: target.GetConversationPublicKey()}, false); err != nil {
+		return false, err
+	}
 
-				userInfo = &payload
+	for _, reply := range replies {
+		if err := messengerutil.StreamInteraction(outbox, tx, reply, false); err != nil {
+			return false, err
+		}
+	}
 
-				if err := h.db.DeleteInteractions([]string{elem.CID}); err != nil {
-					return err
-				}
+	// the retracted interaction may have been unread
+	convs, err := tx.RecomputeUnreadCounts(target.GetConversationPublicKey())
+	if err != nil {
+		return false, err
+	}
 
-				if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: elem.GetCID(), ConversationPublicKey: gpk}, false); err != nil {
-					return err
-				}
+	for _, conv := range convs {
+		if err := outbox.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+			return false, err
+		}
+	}
 
-			default:
-				if err := messengerutil.StreamInteraction(h.dispatcher, h.db, elem.CID, false); err != nil {
-					return err
-				}
-			}
+	return true, nil
+}
+
+// refreshQuotes updates the snapshots of the replies to target and streams the
+// replies, it must be called whenever target changes
+func (h *EventHandler) refreshQuotes(tx *messengerdb.DBWrapper, target *mt.Interaction) error {
+	snapshots, err := tx.GetQuoteSnapshotsByTarget(target.CID)
+	if err != nil {
+		return err
+	}
+
+	for _, snapshot := range snapshots {
+		if err := tx.SaveQuoteSnapshot(quoteSnapshotOf(tx, snapshot.InteractionCID, target)); err != nil {
+			return err
+		}
+
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, snapshot.InteractionCID, false); err != nil {
+			return err
 		}
 	}
 
-	member := &mt.Member{
-		PublicKey:             mpk,
+	return nil
+}
+
+// missingTargetGracePeriod is how long a referenced interaction can arrive
+// out of order before it is looked up in the group log
+const missingTargetGracePeriod = 30 * time.Second
+
+// trackMissingTarget records the interaction targeted by an app message when it
+// hasn't been received, so it can be looked up in the group log. The
+// retractions are left out, their target may have been deleted on purpose.
+func (h *EventHandler) trackMissingTarget(tx *messengerdb.DBWrapper, gpk string, am *mt.AppMessage, cid string) error {
+	if h.replay || am.GetTargetCID() == "" || am.GetType() == mt.AppMessage_TypeMessageRetract || am.GetType().IsCustom() {
+		return nil
+	}
+
+	if _, err := tx.GetInteractionByCID(am.GetTargetCID()); err == nil {
+		return nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	now := time.Now()
+	added, err := tx.AddMissingInteraction(&mt.MissingInteraction{
+		CID:                   am.GetTargetCID(),
 		ConversationPublicKey: gpk,
-		IsMe:                  isMe,
+		ReferencedByCID:       cid,
+		FirstSeenDate:         messengerutil.TimestampMs(now),
+		NextAttemptDate:       messengerutil.TimestampMs(now.Add(missingTargetGracePeriod)),
+	})
+	if added {
+		h.logger.Debug("referenced interaction is missing", logutil.PrivateString("target", am.GetTargetCID()), logutil.PrivateString("cid", cid))
 	}
-	if userInfo != nil {
-		member.DisplayName = userInfo.GetDisplayName()
+
+	return err
+}
+
+// joinThread moves the replies received before a reply to the thread it
+// belongs to
+func (h *EventHandler) joinThread(tx *messengerdb.DBWrapper, i *mt.Interaction) error {
+	if i.ThreadRootCID == "" {
+		return nil
 	}
 
-	member, isNew, err := h.db.UpsertMember(mpk, gpk, *member)
+	moved, err := tx.MoveThreadReplies(i.CID, i.ThreadRootCID)
 	if err != nil {
 		return err
 	}
 
-	err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, isNew)
-	if err != nil {
-		return err
+	for _, cid := range moved {
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, cid, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func quoteSnapshotOf(tx *messengerdb.DBWrapper, cid string, target *mt.Interaction) *mt.QuoteSnapshot {
+	snapshot := &mt.QuoteSnapshot{
+		InteractionCID: cid,
+		TargetCID:      target.GetCID(),
+		TargetSentDate: target.GetSentDate(),
+	}
+
+	if payload, err := target.UnmarshalPayload(); err == nil {
+		if msg, ok := payload.(*mt.AppMessage_UserMessage); ok {
+			snapshot.Excerpt = mt.QuoteExcerpt(msg.GetBody())
+		}
+	}
+
+	snapshot.AuthorMemberPublicKey, snapshot.AuthorDisplayName = InteractionAuthor(tx, target)
+
+	return snapshot
+}
+
+// InteractionAuthor returns the member who sent an interaction and the name
+// this device knows them by
+func InteractionAuthor(tx *messengerdb.DBWrapper, i *mt.Interaction) (string, string) {
+	memberPK, displayName := senderMemberPK(i), ""
+
+	conv := i.GetConversation()
+	switch {
+	case i.GetIsMine():
+		if acc, err := tx.GetAccount(); err == nil {
+			displayName = acc.GetDisplayName()
+		}
+	case memberPK != "":
+		if member, err := tx.GetMemberByPK(memberPK, i.GetConversationPublicKey()); err == nil {
+			displayName = member.GetDisplayName()
+		}
+	}
+
+	if displayName == "" && !i.GetIsMine() && conv.GetType() == mt.Conversation_ContactType {
+		if contact, err := tx.GetContactByPK(conv.GetContactPublicKey()); err == nil {
+			displayName = contact.GetDisplayName()
+		}
+	}
+
+	return memberPK, displayName
+}
+
+func (h *EventHandler) handleAppMessageSetUserInfo(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_SetUserInfo)
+
+	if i.GetConversation().GetType() == mt.Conversation_ContactType {
+		if i.GetIsMine() {
+			return i, false, nil
+		}
+
+		cpk := i.GetConversation().GetContactPublicKey()
+		c, err := tx.GetContactByPK(cpk)
+		if err != nil {
+			return nil, false, err
+		}
+
+		if c.GetInfoDate() > i.GetSentDate() {
+			return i, false, nil
+		}
+		h.logger.Debug("interesting contact SetUserInfo")
+
+		c.DisplayName = payload.GetDisplayName()
+		err = tx.UpdateContact(cpk, mt.Contact{DisplayName: c.GetDisplayName(), AvatarCID: payload.GetAvatarCID(), InfoDate: i.GetSentDate()})
+		if err != nil {
+			return nil, false, err
+		}
+
+		bio, links := messengerutil.SanitizeProfile(payload.GetBio(), payload.GetLinks())
+		if err := tx.UpdateContactProfile(cpk, c.GetConversationPublicKey(), bio, links); err != nil {
+			return nil, false, err
+		}
+
+		c, err = tx.GetContactByPK(i.GetConversation().GetContactPublicKey())
+		if err != nil {
+			return nil, false, err
+		}
+
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: c}, false); err != nil {
+			return nil, false, err
+		}
+		h.logger.Debug("dispatched contact update", logutil.PrivateString("name", c.GetDisplayName()), logutil.PrivateString("device-pk", i.GetDevicePublicKey()), logutil.PrivateString("conv", i.ConversationPublicKey))
+
+		return i, false, nil
+	}
+
+	if i.MemberPublicKey == "" {
+		// store in backlog
+		h.logger.Info("storing SetUserInfo in backlog", logutil.PrivateString("name", payload.GetDisplayName()), logutil.PrivateString("device-pk", i.GetDevicePublicKey()), logutil.PrivateString("conv", i.ConversationPublicKey))
+		ni, isNew, err := tx.AddInteraction(*i)
+		if err != nil {
+			return nil, false, err
+		}
+		return ni, isNew, nil
+	}
+
+	isNew := false
+	existingMember, err := tx.GetMemberByPK(i.MemberPublicKey, i.ConversationPublicKey)
+	if err == gorm.ErrRecordNotFound {
+		isNew = true
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	if !isNew && !isNewerMemberInfo(existingMember, i) {
+		return i, false, nil
+	}
+	h.logger.Debug("interesting member SetUserInfo")
+
+	bio, links := messengerutil.SanitizeProfile(payload.GetBio(), payload.GetLinks())
+
+	// the devices of a member send the same info to every conversation
+	unchanged := !isNew && existingMember.GetDisplayName() == payload.GetDisplayName() &&
+		existingMember.GetAvatarCID() == payload.GetAvatarCID() &&
+		existingMember.GetBio() == bio && sameProfileLinks(existingMember.GetLinks(), links)
+
+	member, isNew, err := tx.UpsertMember(
+		i.MemberPublicKey,
+		i.ConversationPublicKey,
+		mt.Member{DisplayName: payload.GetDisplayName(), AvatarCID: payload.GetAvatarCID(), InfoDate: i.GetSentDate(), InfoDevicePublicKey: i.GetDevicePublicKey()},
+	)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.UpdateMemberProfile(i.MemberPublicKey, i.ConversationPublicKey, bio, links); err != nil {
+		return nil, false, err
+	}
+
+	if member, err = tx.GetMemberByPK(i.MemberPublicKey, i.ConversationPublicKey); err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.SetDeviceSupportsCompactPayload(i.DevicePublicKey, hasCapability(payload, mt.AppMessage_CapabilityCompactPayload)); err != nil {
+		return nil, false, err
+	}
+
+	if unchanged {
+		h.logger.Debug("member info unchanged", logutil.PrivateString("device-pk", i.GetDevicePublicKey()), logutil.PrivateString("conv", i.ConversationPublicKey))
+		return i, false, nil
+	}
+
+	err = h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, isNew)
+	if err != nil {
+		return nil, false, err
+	}
+
+	h.logger.Info("dispatched member update", zap.Any("member", member), zap.Bool("isNew", isNew))
+
+	return i, false, nil
+}
+
+// isNewerMemberInfo returns whether the info sent with i replaces the one of
+// the member, the info sent at the same date by several devices is taken from
+// the greatest device key so every device settles on the same one
+func isNewerMemberInfo(member *mt.Member, i *mt.Interaction) bool {
+	switch {
+	case member.GetInfoDate() != i.GetSentDate():
+		return member.GetInfoDate() < i.GetSentDate()
+	case member.GetInfoDevicePublicKey() == "":
+		return true
+	default:
+		return member.GetInfoDevicePublicKey() < i.GetDevicePublicKey()
+	}
+}
+
+func sameProfileLinks(current []*mt.ProfileLink, urls []string) bool {
+	if len(current) != len(urls) {
+		return false
+	}
+
+	for j, link := range current {
+		if link.GetURL() != urls[j] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (h *EventHandler) handleAppMessageAccountDeleted(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
+	if i.GetIsMine() {
+		// the local data is about to be wiped
+		return i, false, nil
+	}
+
+	i, isNew, err := tx.AddInteraction(*i)
+	if err != nil {
+		return nil, isNew, err
+	}
+
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, i.CID, isNew); err != nil {
+		return nil, isNew, err
+	}
+
+	switch i.GetConversation().GetType() {
+	case mt.Conversation_ContactType:
+		cpk := i.GetConversation().GetContactPublicKey()
+		if err := tx.UpdateContact(cpk, mt.Contact{AccountDeletedDate: i.GetSentDate()}); err != nil {
+			return nil, isNew, err
+		}
+
+		c, err := tx.GetContactByPK(cpk)
+		if err != nil {
+			return nil, isNew, err
+		}
+
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: c}, false); err != nil {
+			return nil, isNew, err
+		}
+		h.logger.Info("contact deleted its account", logutil.PrivateString("contact-pk", cpk))
+
+	case mt.Conversation_MultiMemberType:
+		// the member is marked once its device is known, see groupMemberDeviceAdded
+		if i.GetMemberPublicKey() == "" {
+			break
+		}
+
+		member, isNewMember, err := tx.UpsertMember(i.GetMemberPublicKey(), i.GetConversationPublicKey(), mt.Member{AccountDeletedDate: i.GetSentDate()})
+		if err != nil {
+			return nil, isNew, err
+		}
+
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, isNewMember); err != nil {
+			return nil, isNew, err
+		}
+		h.logger.Info("member deleted its account", logutil.PrivateString("member-pk", member.GetPublicKey()), logutil.PrivateString("conv", i.GetConversationPublicKey()))
+	}
+
+	return i, isNew, nil
+}
+
+// handleAppMessagePresence updates the last seen date of the sender, presence
+// beacons aren't stored as interactions
+func (h *EventHandler) handleAppMessagePresence(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
+	if i.GetIsMine() {
+		return i, false, nil
+	}
+
+	acc, err := tx.GetAccount()
+	if err != nil {
+		return nil, false, err
+	}
+
+	convType := i.GetConversation().GetType()
+	if !acc.GetPresenceVisibility().SharesPresenceIn(convType) {
+		return i, false, nil
 	}
 
-	h.logger.Info("dispatched member update", tyber.FormatStepLogFields(h.ctx, []tyber.Detail{
-		{Name: "GroupPK", Description: gpk},
-		{Name: "MemberPK", Description: mpk},
-		{Name: "DevicePK", Description: dpk},
-		{Name: "IsMe", Description: strconv.FormatBool(isMe)},
-		{Name: "IsNew", Description: strconv.FormatBool(isNew)},
-	})...)
+	// don't trust clocks in the future
+	lastSeen := i.GetSentDate()
+	if now := messengerutil.TimestampMs(time.Now()); lastSeen > now {
+		lastSeen = now
+	}
 
-	return nil
-}
+	switch convType {
+	case mt.Conversation_ContactType:
+		cpk := i.GetConversation().GetContactPublicKey()
+		updated, err := tx.UpdateContactLastSeen(cpk, lastSeen)
+		if err != nil || !updated {
+			return i, false, err
+		}
 
-func (h *EventHandler) handleAppMessageAcknowledge(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
-	target, err := tx.MarkInteractionAsAcknowledged(i.TargetCID)
-	switch {
-	case err == gorm.ErrRecordNotFound:
-		h.logger.Debug("added ack in backlog", logutil.PrivateString("target", i.TargetCID), logutil.PrivateString("cid", i.GetCID()))
-		i, _, err = tx.AddInteraction(*i)
+		c, err := tx.GetContactByPK(cpk)
 		if err != nil {
 			return nil, false, err
 		}
 
-		return i, false, nil
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: c}, false); err != nil {
+			return nil, false, err
+		}
 
-	case err != nil:
-		return nil, false, err
+	case mt.Conversation_MultiMemberType:
+		// beacons of unknown members are dropped, the next one will do
+		if i.GetMemberPublicKey() == "" {
+			return i, false, nil
+		}
 
-	default:
-		h.logger.Debug(messengerutil.TyberEventAcknowledgeReceived, tyber.FormatEventLogFields(h.ctx, []tyber.Detail{{Name: "TargetCID", Description: i.TargetCID}})...)
+		updated, err := tx.UpdateMemberLastSeen(i.GetMemberPublicKey(), i.GetConversationPublicKey(), lastSeen)
+		if err != nil || !updated {
+			return i, false, err
+		}
 
-		if target != nil {
-			if err := messengerutil.StreamInteraction(h.dispatcher, tx, target.CID, false); err != nil {
-				h.logger.Error("error while sending stream event", logutil.PrivateString("public-key", i.ConversationPublicKey), logutil.PrivateString("cid", i.CID), zap.Error(err))
-			}
+		member, err := tx.GetMemberByPK(i.GetMemberPublicKey(), i.GetConversationPublicKey())
+		if err != nil {
+			return nil, false, err
 		}
 
-		return i, false, nil
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, false); err != nil {
+			return nil, false, err
+		}
 	}
+
+	return i, false, nil
 }
 
-func (h *EventHandler) handleAppMessageGroupInvitation(tx *messengerdb.DBWrapper, i *mt.Interaction, _ proto.Message) (*mt.Interaction, bool, error) {
-	if len(i.GetPayload()) == 0 {
-		return nil, false, ErrNilPayload
+// handleAppMessageActivity dispatches the activity of a member, activities
+// aren't stored and are cleared automatically once expired
+func (h *EventHandler) handleAppMessageActivity(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload := amPayload.(*mt.AppMessage_Activity)
+
+	if i.GetIsMine() || h.replay {
+		return i, false, nil
 	}
 
-	i, isNew, err := tx.AddInteraction(*i)
-	if err != nil {
-		return nil, isNew, err
+	memberPK := senderMemberPK(i)
+	if memberPK == "" {
+		return i, false, nil
 	}
 
-	if err := messengerutil.StreamInteraction(h.dispatcher, tx, i.CID, isNew); err != nil {
-		return nil, isNew, err
+	// the activities of the others are hidden when we don't send ours
+	if _, disabled, err := tx.GetReceiptPrivacy(i.GetConversationPublicKey()); err != nil {
+		return nil, false, err
+	} else if disabled {
+		return i, false, nil
 	}
 
-	// fetch contact from db
-	var contact *mt.Contact
-	if i.Conversation.Type == mt.Conversation_ContactType {
-		if contact, err = tx.GetContactByPK(i.Conversation.ContactPublicKey); err != nil {
-			h.logger.Warn("1to1 message contact not found", logutil.PrivateString("public-key", i.Conversation.ContactPublicKey), zap.Error(err))
-		}
-		if !i.IsMine && isNew {
-			err = h.dispatcher.Notify(mt.StreamEvent_Notified_TypeGroupInvitation, "Group invitation", "From: "+contact.GetDisplayName(), &mt.StreamEvent_Notified_GroupInvitation{Contact: contact})
-			if err != nil {
-				h.logger.Error("failed to notify", zap.Error(err))
-			}
+	// don't trust clocks in the future
+	now := time.Now()
+	sentAt := time.Unix(0, i.GetSentDate()*int64(time.Millisecond))
+	if sentAt.After(now) {
+		sentAt = now
+	}
+
+	expiresAt := sentAt.Add(mt.ActivityTimeout)
+	if !expiresAt.After(now) {
+		return i, false, nil
+	}
+
+	key := activityKey{conversationPK: i.GetConversationPublicKey(), memberPK: memberPK}
+	kinds := mt.SanitizeActivityKinds(payload.GetKinds())
+
+	if len(kinds) == 0 {
+		if h.activities.clear(key) {
+			h.dispatchActivity(key, nil, 0)
 		}
+		return i, false, nil
 	}
 
-	// TODO: Notify for multimember conversation when it will be possible in UI
+	h.activities.set(key, expiresAt, func() { h.dispatchActivity(key, nil, 0) })
+	h.dispatchActivity(key, kinds, messengerutil.TimestampMs(expiresAt))
 
-	return i, isNew, err
+	return i, false, nil
 }
 
-func (h *EventHandler) handleAppMessageUserMessage(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
-	// NOTE: it's ok to have an empty payload here since a user message can be only medias
-	i, isNew, err := tx.AddInteraction(*i)
-	if err != nil {
-		return nil, isNew, err
+// dispatchActivity bypasses the outbox, activities are never persisted
+func (h *EventHandler) dispatchActivity(key activityKey, kinds []mt.AppMessage_ActivityKind, expiresAt int64) {
+	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeActivityUpdated, &mt.StreamEvent_ActivityUpdated{
+		ConversationPublicKey: key.conversationPK,
+		MemberPublicKey:       key.memberPK,
+		Kinds:                 kinds,
+		ExpiresAt:             expiresAt,
+	}, false); err != nil {
+		h.logger.Warn("unable to dispatch activity", zap.Error(err))
 	}
+}
 
-	if err := messengerutil.StreamInteraction(h.dispatcher, tx, i.CID, isNew); err != nil {
-		return nil, isNew, err
+// senderMemberPK returns the member public key of the sender of an
+// interaction, falling back to the contact in contact conversations
+func senderMemberPK(i *mt.Interaction) string {
+	memberPK := i.GetMemberPublicKey()
+	if memberPK == "" && !i.GetIsMine() && i.GetConversation().GetType() == mt.Conversation_ContactType {
+		memberPK = i.GetConversation().GetContactPublicKey()
 	}
 
-	if i.IsMine || h.replay || !isNew {
-		return i, isNew, nil
+	return memberPK
+}
+
+// handleAppMessageCallSignaling keeps the log of the call up to date and relays
+// the signaling messages to the clients, the signaling messages themselves are
+// only meaningful for a short time and are never stored
+func (h *EventHandler) handleAppMessageCallSignaling(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
+	payload, ok := amPayload.(mt.CallSignalingPayload)
+	if !ok {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unexpected call signaling payload: %T", amPayload))
 	}
 
-	if err := h.postHandlerActions.InteractionReceived(i); err != nil {
-		return nil, isNew, err
+	if err := payload.Validate(); err != nil {
+		h.logger.Warn("dropping invalid call signaling message", logutil.PrivateString("cid", i.GetCID()), zap.Error(err))
+		return i, false, nil
 	}
 
-	// notify
+	memberPK := senderMemberPK(i)
+	if memberPK == "" {
+		return i, false, nil
+	}
 
-	// Receiving a message for an opened conversation returning early
-	// Receiving a message for a conversation not known yet, returning early
-	if i.Conversation == nil {
-		return i, isNew, nil
+	callLog, isNew, err := h.updateCallLog(tx, i, memberPK, payload)
+	if err != nil {
+		return nil, false, err
 	}
 
-	// fetch contact from db
-	var contact *mt.Contact
-	if i.Conversation.Type == mt.Conversation_ContactType {
-		if contact, err = tx.GetContactByPK(i.Conversation.ContactPublicKey); err != nil {
-			h.logger.Warn("1to1 message contact not found", logutil.PrivateString("public-key", i.Conversation.ContactPublicKey), zap.Error(err))
-		}
+	if i.GetIsMine() || h.replay {
+		return callLog, isNew, nil
 	}
 
-	payload := amPayload.(*mt.AppMessage_UserMessage)
-	var title string
-	body := payload.GetBody()
-	if contact != nil && i.Conversation.Type == mt.Conversation_ContactType {
-		title = contact.GetDisplayName()
-	} else {
-		title = i.Conversation.GetDisplayName()
-		memberName := i.Member.GetDisplayName()
-		if memberName != "" {
-			body = memberName + ": " + payload.GetBody()
-		}
+	if isStaleCallSignaling(i) {
+		h.logger.Debug("not relaying stale call signaling message", logutil.PrivateString("cid", i.GetCID()), zap.String("call-id", payload.GetCallID()))
+		return callLog, isNew, nil
 	}
 
-	msgRecvd := mt.StreamEvent_Notified_MessageReceived{
-		Interaction:  i,
-		Conversation: i.Conversation,
-		Contact:      contact,
+	event := &mt.StreamEvent_CallSignaling{
+		ConversationPublicKey: i.GetConversationPublicKey(),
+		MemberPublicKey:       memberPK,
+		CID:                   i.GetCID(),
+		Type:                  i.GetType(),
+		SentDate:              i.GetSentDate(),
+	}
+	switch payload := payload.(type) {
+	case *mt.AppMessage_CallOffer:
+		event.Offer = payload
+	case *mt.AppMessage_CallAnswer:
+		event.Answer = payload
+	case *mt.AppMessage_CallICECandidate:
+		event.ICECandidate = payload
+	case *mt.AppMessage_CallHangUp:
+		event.HangUp = payload
 	}
 
-	err = h.dispatcher.Notify(mt.StreamEvent_Notified_TypeMessageReceived, title, body, &msgRecvd)
-	if err != nil {
-		h.logger.Error("failed to notify", zap.Error(err))
+	// bypass the outbox, signaling messages are never persisted
+	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeCallSignaling, event, false); err != nil {
+		h.logger.Warn("unable to dispatch call signaling", zap.Error(err))
 	}
 
-	return i, isNew, nil
+	return callLog, isNew, nil
 }
 
-func (h *EventHandler) handleAppMessageSetUserInfo(tx *messengerdb.DBWrapper, i *mt.Interaction, amPayload proto.Message) (*mt.Interaction, bool, error) {
-	payload := amPayload.(*mt.AppMessage_SetUserInfo)
+// updateCallLog creates the call log interaction on offers and updates it on
+// answers and hang ups, it returns the call log interaction, or i for the
+// signaling of unknown calls, and whether it has just been created
+func (h *EventHandler) updateCallLog(tx *messengerdb.DBWrapper, i *mt.Interaction, memberPK string, payload mt.CallSignalingPayload) (*mt.Interaction, bool, error) {
+	convPK := i.GetConversationPublicKey()
 
-	if i.GetConversation().GetType() == mt.Conversation_ContactType {
-		if i.GetIsMine() {
+	existing, err := tx.GetCallLogInteraction(convPK, payload.GetCallID())
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		offer, ok := payload.(*mt.AppMessage_CallOffer)
+		if !ok {
+			// signaling of a call we haven't seen the offer of
 			return i, false, nil
 		}
 
-		cpk := i.GetConversation().GetContactPublicKey()
-		c, err := tx.GetContactByPK(cpk)
+		log := mt.NewCallLog(offer, memberPK, i.GetSentDate())
+		raw, err := proto.Marshal(log)
 		if err != nil {
-			return nil, false, err
-		}
-
-		if c.GetInfoDate() > i.GetSentDate() {
-			return i, false, nil
+			return nil, false, errcode.ErrSerialization.Wrap(err)
 		}
-		h.logger.Debug("interesting contact SetUserInfo")
 
-		c.DisplayName = payload.GetDisplayName()
-		err = tx.UpdateContact(cpk, mt.Contact{DisplayName: c.GetDisplayName(), InfoDate: i.GetSentDate()})
+		callLog, isNew, err := tx.AddCallLogInteraction(offer.GetCallID(), mt.Interaction{
+			CID:                   i.GetCID(),
+			Type:                  mt.AppMessage_TypeCallLog,
+			MemberPublicKey:       i.GetMemberPublicKey(),
+			DevicePublicKey:       i.GetDevicePublicKey(),
+			ConversationPublicKey: convPK,
+			Payload:               raw,
+			IsMine:                i.GetIsMine(),
+			SentDate:              i.GetSentDate(),
+		})
 		if err != nil {
 			return nil, false, err
 		}
 
-		c, err = tx.GetContactByPK(i.GetConversation().GetContactPublicKey())
-		if err != nil {
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, callLog.GetCID(), isNew); err != nil {
 			return nil, false, err
 		}
 
-		if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: c}, false); err != nil {
-			return nil, false, err
+		if isNew && !callLog.GetIsMine() && !h.replay && !isStaleCallSignaling(i) {
+			h.notifyCall(tx, callLog, log)
 		}
-		h.logger.Debug("dispatched contact update", logutil.PrivateString("name", c.GetDisplayName()), logutil.PrivateString("device-pk", i.GetDevicePublicKey()), logutil.PrivateString("conv", i.ConversationPublicKey))
 
-		return i, false, nil
+		return callLog, isNew, nil
+	case err != nil:
+		return nil, false, errcode.ErrDBRead.Wrap(err)
 	}
 
-	if i.MemberPublicKey == "" {
-		// store in backlog
-		h.logger.Info("storing SetUserInfo in backlog", logutil.PrivateString("name", payload.GetDisplayName()), logutil.PrivateString("device-pk", i.GetDevicePublicKey()), logutil.PrivateString("conv", i.ConversationPublicKey))
-		ni, isNew, err := tx.AddInteraction(*i)
-		if err != nil {
-			return nil, false, err
-		}
-		return ni, isNew, nil
+	var log mt.AppMessage_CallLog
+	if err := proto.Unmarshal(existing.GetPayload(), &log); err != nil {
+		return nil, false, errcode.ErrDeserialization.Wrap(err)
 	}
 
-	isNew := false
-	existingMember, err := tx.GetMemberByPK(i.MemberPublicKey, i.ConversationPublicKey)
-	if err == gorm.ErrRecordNotFound {
-		isNew = true
-	} else if err != nil {
-		return nil, false, err
+	changed := false
+	switch payload := payload.(type) {
+	case *mt.AppMessage_CallAnswer:
+		changed = log.ApplyAnswer(memberPK, i.GetSentDate())
+	case *mt.AppMessage_CallHangUp:
+		changed = log.ApplyHangUp(memberPK, payload.GetReason(), i.GetSentDate())
+	}
+	if !changed {
+		return existing, false, nil
 	}
 
-	if !isNew && existingMember.GetInfoDate() > i.GetSentDate() {
-		return i, false, nil
+	raw, err := proto.Marshal(&log)
+	if err != nil {
+		return nil, false, errcode.ErrSerialization.Wrap(err)
 	}
-	h.logger.Debug("interesting member SetUserInfo")
 
-	member, isNew, err := tx.UpsertMember(
-		i.MemberPublicKey,
-		i.ConversationPublicKey,
-		mt.Member{DisplayName: payload.GetDisplayName(), InfoDate: i.GetSentDate()},
-	)
+	callLog, err := tx.UpdateInteractionPayload(existing.GetCID(), raw)
 	if err != nil {
 		return nil, false, err
 	}
 
-	err = h.dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, isNew)
-	if err != nil {
+	if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, callLog.GetCID(), false); err != nil {
 		return nil, false, err
 	}
 
-	h.logger.Info("dispatched member update", zap.Any("member", member), zap.Bool("isNew", isNew))
+	if log.GetState() == mt.AppMessage_CallStateMissed && !callLog.GetIsMine() && !h.replay {
+		h.notifyCall(tx, callLog, &log)
+	}
 
-	return i, false, nil
+	return callLog, false, nil
+}
+
+func isStaleCallSignaling(i *mt.Interaction) bool {
+	return time.Since(time.Unix(0, i.GetSentDate()*int64(time.Millisecond))) > mt.CallSignalingTTL
+}
+
+// notifyCall notifies an incoming call while it rings and a missed call once
+// the caller gave up. Muted conversations and quiet hours hold the
+// notifications back, unless the conversation called repeatedly or is in
+// focus mode.
+func (h *EventHandler) notifyCall(tx *messengerdb.DBWrapper, callLog *mt.Interaction, log *mt.AppMessage_CallLog) {
+	conv := callLog.GetConversation()
+	if conv == nil {
+		return
+	}
+
+	accountMuted, conversationMuted, err := tx.GetMuteStatusForConversation(conv.GetPublicKey())
+	if err != nil {
+		h.logger.Error("unable to get mute status", zap.Error(err))
+		return
+	}
+
+	acc, err := tx.GetAccount()
+	if err != nil {
+		h.logger.Error("unable to get account", zap.Error(err))
+		return
+	}
+
+	if (accountMuted || conversationMuted || acc.InQuietHours(time.Now())) && !conv.IsFocused(time.Now()) {
+		since := messengerutil.TimestampMs(time.Now().Add(-mt.RepeatedCallWindow))
+		if count, err := tx.CountIncomingCallLogsSince(conv.GetPublicKey(), since); err != nil || count < 2 {
+			return
+		}
+	}
+
+	var contact *mt.Contact
+	if conv.GetType() == mt.Conversation_ContactType {
+		if contact, err = tx.GetContactByPK(conv.GetContactPublicKey()); err != nil {
+			h.logger.Warn("1to1 call contact not found", logutil.PrivateString("public-key", conv.GetContactPublicKey()), zap.Error(err))
+		}
+	}
+
+	title := conv.GetDisplayName()
+	if contact != nil {
+		title = contact.GetDisplayName()
+	}
+
+	kind := "call"
+	if log.GetVideo() {
+		kind = "video call"
+	}
+
+	var (
+		typ  mt.StreamEvent_Notified_Type
+		body string
+		msg  proto.Message
+	)
+	switch log.GetState() {
+	case mt.AppMessage_CallStateRinging:
+		typ, body = mt.StreamEvent_Notified_TypeIncomingCall, "Incoming "+kind
+		msg = &mt.StreamEvent_Notified_IncomingCall{Interaction: callLog, Conversation: conv, Contact: contact, CallLog: log}
+	case mt.AppMessage_CallStateMissed:
+		typ, body = mt.StreamEvent_Notified_TypeMissedCall, "Missed "+kind
+		msg = &mt.StreamEvent_Notified_MissedCall{Interaction: callLog, Conversation: conv, Contact: contact, CallLog: log}
+	default:
+		return
+	}
+
+	if memberName := callLog.GetMember().GetDisplayName(); contact == nil && memberName != "" {
+		body = memberName + ": " + body
+	}
+
+	group := &mt.StreamEvent_Notified_Group{ConversationPublicKey: conv.GetPublicKey(), Category: mt.StreamEvent_Notified_Group_CategoryCall}
+	if err := h.outboxFor(tx).Notify(typ, title, body, msg, group); err != nil {
+		h.logger.Error("failed to notify", zap.Error(err))
+	}
+}
+
+func hasCapability(info *mt.AppMessage_SetUserInfo, capability mt.AppMessage_Capability) bool {
+	for _, c := range info.GetCapabilities() {
+		if c == capability {
+			return true
+		}
+	}
+
+	return false
 }
 
 func interactionFromAppMessage(h *EventHandler, gpk string, gme *protocoltypes.GroupMessageEvent, am *mt.AppMessage) (*mt.Interaction, error) {
@@ -1061,6 +3081,10 @@ func interactionFromAppMessage(h *EventHandler, gpk string, gme *protocoltypes.G
 		TargetCID:             am.GetTargetCID(),
 	}
 
+	if !isMe && !h.replay {
+		i.ReceivedDate = messengerutil.TimestampMs(time.Now())
+	}
+
 	return &i, nil
 }
 
@@ -1077,7 +3101,7 @@ func interactionFetchRelations(tx *messengerdb.DBWrapper, i *mt.Interaction, log
 	if err == nil { // device already exists
 		i.MemberPublicKey = existingDevice.GetMemberPublicKey()
 	} else { // device not found
-		i.MemberPublicKey = "" // backlog magic
+		i.MemberPublicKey = "" // attributed from the backlog once the device is added
 	}
 
 	if i.Conversation != nil && i.Conversation.Type == mt.Conversation_MultiMemberType && i.MemberPublicKey != "" {
@@ -1111,22 +3135,20 @@ func (h *EventHandler) dispatchVisibleInteraction(i *mt.Interaction) error {
 			return err
 		}
 
-		return nil
-	}); err != nil {
-		return err
-	}
+		// expr-based (see above) gorm updates don't update the go object
+		// next query could be easily replace by a simple increment, but this way we're 100% sure to be up-to-date
+		conv, err := tx.GetConversationByPK(i.GetConversationPublicKey())
+		if err != nil {
+			return err
+		}
 
-	// expr-based (see above) gorm updates don't update the go object
-	// next query could be easily replace by a simple increment, but this way we're 100% sure to be up-to-date
-	conv, err := h.db.GetConversationByPK(i.GetConversationPublicKey())
-	if err != nil {
+		// dispatch update event
+		return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false)
+	}); err != nil {
 		return err
 	}
 
-	// dispatch update event
-	if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
-		return err
-	}
+	h.flushOutbox()
 
 	return nil
 }
@@ -1212,7 +3234,7 @@ func (h *EventHandler) handleAppMessageSetGroupInfo(tx *messengerdb.DBWrapper, i
 			return nil, false, err
 		}
 
-		if err := h.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: c}, false); err != nil {
+		if err := h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: c}, false); err != nil {
 			return nil, false, err
 		}
 		h.logger.Debug("dispatched conversation update", logutil.PrivateString("name", c.GetDisplayName()), logutil.PrivateString("conv", i.ConversationPublicKey))
@@ -1261,6 +3283,10 @@ func interactionFromOutOfStoreAppMessage(h *EventHandler, gPKBytes []byte, outOf
 		OutOfStoreMessage:     true,
 	}
 
+	if !isMe && !h.replay {
+		i.ReceivedDate = messengerutil.TimestampMs(time.Now())
+	}
+
 	return &i, nil
 }
 
@@ -1370,6 +3396,11 @@ func (h *EventHandler) GetAlreadyHandledMessage(cid ipfscid.Cid) (bool, *mt.Inte
 }
 
 func (h *EventHandler) HandleOutOfStoreAppMessage(groupPK []byte, message *protocoltypes.OutOfStoreMessage, payload []byte) (*mt.Interaction, bool, error) {
+	if err := h.gate.enter(); err != nil {
+		return nil, false, err
+	}
+	defer h.gate.leave()
+
 	if message == nil {
 		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no message specified"))
 	}
@@ -1391,17 +3422,27 @@ func (h *EventHandler) HandleOutOfStoreAppMessage(groupPK []byte, message *proto
 		return nil, false, errcode.ErrDeserialization.Wrap(err)
 	}
 
-	_, am, err := mt.UnmarshalAppMessage(env.Plaintext)
+	amPayload, am, err := mt.UnmarshalAppMessage(env.Plaintext)
 	if err != nil {
 		return nil, false, errcode.ErrDeserialization.Wrap(err)
 	}
 
+	// the custom messages are left to their handlers, which only run on the
+	// messages received from the group
+	if am.GetType().IsCustom() {
+		return nil, false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("no push for the custom AppMessage type %d", am.GetType()))
+	}
+
 	// build interaction
 	i, err := interactionFromOutOfStoreAppMessage(h, groupPK, message, &am)
 	if err != nil {
 		return nil, false, err
 	}
 
+	if msg, ok := amPayload.(*mt.AppMessage_UserMessage); ok {
+		i.Mentions = msg.InteractionMentions(i.CID)
+	}
+
 	i, isNew, err := h.db.AddInteraction(*i)
 	if err != nil {
 		return nil, false, errcode.ErrDBWrite.Wrap(err)
@@ -1415,3 +3456,59 @@ func (h *EventHandler) HandleOutOfStoreAppMessage(groupPK []byte, message *proto
 
 	return i, isNew, nil
 }
+
+// HandleSystemMessage adds an interaction generated by the messenger itself to
+// the system conversation, it returns whether the interaction is new
+func (h *EventHandler) HandleSystemMessage(cid string, sentDate int64, msg *mt.AppMessage_SystemMessage) (bool, error) {
+	if err := h.gate.enter(); err != nil {
+		return false, err
+	}
+	defer h.gate.leave()
+
+	if cid == "" {
+		return false, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a system message cid is required"))
+	}
+
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return false, errcode.ErrSerialization.Wrap(err)
+	}
+	am := &mt.AppMessage{Type: mt.AppMessage_TypeSystemMessage, Payload: payload}
+
+	var i *mt.Interaction
+	var isNew bool
+	if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+		i, isNew, err = tx.AddInteraction(mt.Interaction{
+			CID:                   cid,
+			Type:                  mt.AppMessage_TypeSystemMessage,
+			ConversationPublicKey: mt.SystemConversationPublicKey,
+			Payload:               payload,
+			SentDate:              sentDate,
+		})
+		if err != nil {
+			return err
+		}
+
+		if !isNew {
+			return nil
+		}
+
+		if err := messengerutil.StreamInteraction(h.outboxFor(tx), tx, cid, isNew); err != nil {
+			return err
+		}
+
+		return indexMessage(tx, cid, am)
+	}); err != nil {
+		return false, err
+	}
+
+	h.flushOutbox()
+
+	if isNew {
+		if err := h.dispatchVisibleInteraction(i); err != nil {
+			h.logger.Error("Unable to dispatch system message", logutil.PrivateString("cid", cid), zap.Error(err))
+		}
+	}
+
+	return isNew, nil
+}
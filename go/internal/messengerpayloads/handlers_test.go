@@ -1,5 +1,161 @@
 package messengerpayloads
 
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	ipfscid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+func TestEventHandler_Close(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	// simulate an event being handled
+	require.NoError(t, h.gate.enter())
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{}, false)
+	}))
+
+	closeCtx, closeCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer closeCancel()
+	require.ErrorIs(t, h.Close(closeCtx), context.DeadlineExceeded)
+	require.Empty(t, dispatcher.events)
+
+	// new events are refused once the handler is closing, including from copies
+	err := h.WithContext(ctx).HandleMetadataEvent(&protocoltypes.GroupMetadataEvent{})
+	require.True(t, errcode.Is(err, errcode.ErrMessengerHandlerClosed))
+
+	h.gate.leave()
+
+	require.NoError(t, h.Close(ctx))
+	require.Len(t, dispatcher.events, 1)
+}
+
+func TestEventHandler_handleAppMessageAccountDeleted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, err := tx.AddContactRequestOutgoingEnqueued("contact_pk", "contact", conv.PublicKey)
+		return err
+	}))
+
+	i := &mt.Interaction{
+		CID:                   "Qm0001",
+		Type:                  mt.AppMessage_TypeAccountDeleted,
+		ConversationPublicKey: conv.PublicKey,
+		Conversation:          conv,
+		SentDate:              42,
+	}
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, isNew, err := h.handleAppMessageAccountDeleted(tx, i, &mt.AppMessage_AccountDeleted{})
+		require.True(t, isNew)
+		return err
+	}))
+	require.NoError(t, h.FlushOutbox())
+
+	contact, err := db.GetContactByPK("contact_pk")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), contact.AccountDeletedDate)
+
+	// the interaction is kept so the deletion is visible in the conversation
+	_, err = db.GetInteractionByCID("Qm0001")
+	require.NoError(t, err)
+
+	types := []mt.StreamEvent_Type(nil)
+	for _, evt := range dispatcher.events {
+		types = append(types, evt.Type)
+	}
+	require.Equal(t, []mt.StreamEvent_Type{mt.StreamEvent_TypeInteractionUpdated, mt.StreamEvent_TypeContactUpdated}, types)
+
+	// own messages are ignored, the local data is being wiped
+	mine := &mt.Interaction{CID: "Qm0002", Type: mt.AppMessage_TypeAccountDeleted, ConversationPublicKey: conv.PublicKey, Conversation: conv, IsMine: true}
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, _, err := h.handleAppMessageAccountDeleted(tx, mine, &mt.AppMessage_AccountDeleted{})
+		return err
+	}))
+	_, err = db.GetInteractionByCID("Qm0002")
+	require.Error(t, err)
+}
+
+func TestEventHandler_handleAppMessagePresence(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	require.NoError(t, db.FirstOrCreateAccount("account_pk", "http://berty.tech/id#account_pk"))
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, err := tx.AddContactRequestOutgoingEnqueued("contact_pk", "contact", conv.PublicKey)
+		return err
+	}))
+
+	beacon := func(cid string, sentDate int64) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypePresence, ConversationPublicKey: conv.PublicKey, Conversation: conv, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			ret, isNew, err := h.handleAppMessagePresence(tx, i, &mt.AppMessage_Presence{})
+			require.NotNil(t, ret)
+			require.False(t, isNew)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	beacon("Qm0001", 42)
+	beacon("Qm0002", 12)
+
+	contact, err := db.GetContactByPK("contact_pk")
+	require.NoError(t, err)
+	require.Equal(t, int64(42), contact.LastSeen)
+
+	// beacons aren't stored, and older ones don't dispatch anything
+	_, err = db.GetInteractionByCID("Qm0001")
+	require.Error(t, err)
+	require.Len(t, dispatcher.events, 1)
+	require.Equal(t, mt.StreamEvent_TypeContactUpdated, dispatcher.events[0].Type)
+
+	// nothing is kept when the presence is hidden
+	_, _, err = db.SetPresenceVisibility(mt.Account_PresenceVisibilityNobody)
+	require.NoError(t, err)
+	beacon("Qm0003", 50)
+
+	contact, err = db.GetContactByPK("contact_pk")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), contact.LastSeen)
+	require.Len(t, dispatcher.events, 1)
+}
+
 //import (
 //	"context"
 //	"testing"
@@ -150,3 +306,1620 @@ package messengerpayloads
 //	// TODO
 //	t.Skip("TODO")
 //}
+
+func TestEventHandler_handleAppMessageCallSignaling(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	signal := func(cid string, typ mt.AppMessage_Type, sentAt time.Time, payload mt.CallSignalingPayload) {
+		i := &mt.Interaction{CID: cid, Type: typ, ConversationPublicKey: conv.PublicKey, Conversation: conv, SentDate: messengerutil.TimestampMs(sentAt)}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			ret, _, err := h.handleAppMessageCallSignaling(tx, i, payload)
+			require.NotNil(t, ret)
+			return err
+		}))
+	}
+	callLog := func(callID string) *mt.AppMessage_CallLog {
+		i, err := db.GetCallLogInteraction(conv.PublicKey, callID)
+		require.NoError(t, err)
+		require.Equal(t, mt.AppMessage_TypeCallLog, i.Type)
+
+		var log mt.AppMessage_CallLog
+		require.NoError(t, proto.Unmarshal(i.Payload, &log))
+		return &log
+	}
+
+	// invalid messages are dropped, stale ones are logged but not relayed
+	signal("cid_invalid", mt.AppMessage_TypeCallOffer, time.Now(), &mt.AppMessage_CallOffer{CallID: "invalid"})
+	signal("cid_stale", mt.AppMessage_TypeCallOffer, time.Now().Add(-mt.CallSignalingTTL-time.Second), &mt.AppMessage_CallOffer{CallID: "stale", SDP: "v=0"})
+	require.Empty(t, dispatcher.events)
+	_, err := db.GetCallLogInteraction(conv.PublicKey, "invalid")
+	require.Error(t, err)
+	require.Equal(t, mt.AppMessage_CallStateRinging, callLog("stale").State)
+
+	signal("cid_offer", mt.AppMessage_TypeCallOffer, time.Now(), &mt.AppMessage_CallOffer{CallID: "call", SDP: "v=0", Video: true})
+	signal("cid_hangup", mt.AppMessage_TypeCallHangUp, time.Now(), &mt.AppMessage_CallHangUp{CallID: "call", Reason: mt.AppMessage_CallHangUpNormal})
+	require.Len(t, dispatcher.events, 2)
+
+	payload, err := dispatcher.events[0].UnmarshalPayload()
+	require.NoError(t, err)
+	offer := payload.(*mt.StreamEvent_CallSignaling)
+	require.Equal(t, mt.StreamEvent_TypeCallSignaling, dispatcher.events[0].Type)
+	require.Equal(t, "contact_pk", offer.MemberPublicKey)
+	require.Equal(t, mt.AppMessage_TypeCallOffer, offer.Type)
+	require.Equal(t, "v=0", offer.GetOffer().GetSDP())
+	require.Nil(t, offer.HangUp)
+
+	payload, err = dispatcher.events[1].UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, mt.AppMessage_CallHangUpNormal, payload.(*mt.StreamEvent_CallSignaling).GetHangUp().GetReason())
+
+	// the caller hung up before anyone answered
+	log := callLog("call")
+	require.Equal(t, mt.AppMessage_CallStateMissed, log.State)
+	require.Equal(t, "contact_pk", log.CallerMemberPublicKey)
+	require.True(t, log.Video)
+
+	// only the call logs have been persisted
+	info, err := db.GetDBInfo()
+	require.NoError(t, err)
+	require.EqualValues(t, 2, info.GetInteractions())
+	require.EqualValues(t, 2, info.GetCalls())
+}
+
+func TestEventHandler_callNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	require.NoError(t, db.FirstOrCreateAccount("account_pk", "link"))
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		if _, err := tx.AddContactRequestOutgoingEnqueued("contact_pk", "contact", conv.PublicKey); err != nil {
+			return err
+		}
+		_, err := tx.AddConversationForContact(conv.PublicKey, "own_member_pk", "own_device_pk", "contact_pk")
+		return err
+	}))
+
+	signal := func(cid string, typ mt.AppMessage_Type, payload mt.CallSignalingPayload) {
+		i := &mt.Interaction{CID: cid, Type: typ, ConversationPublicKey: conv.PublicKey, Conversation: conv, SentDate: messengerutil.TimestampMs(time.Now())}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageCallSignaling(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+	notified := func() []*mt.StreamEvent_Notified {
+		ret := []*mt.StreamEvent_Notified(nil)
+		for _, evt := range dispatcher.events {
+			if evt.Type != mt.StreamEvent_TypeNotified {
+				continue
+			}
+			payload, err := evt.UnmarshalPayload()
+			require.NoError(t, err)
+			ret = append(ret, payload.(*mt.StreamEvent_Notified))
+		}
+		return ret
+	}
+
+	signal("cid_offer_1", mt.AppMessage_TypeCallOffer, &mt.AppMessage_CallOffer{CallID: "call_1", SDP: "v=0"})
+	signal("cid_hangup_1", mt.AppMessage_TypeCallHangUp, &mt.AppMessage_CallHangUp{CallID: "call_1", Reason: mt.AppMessage_CallHangUpNormal})
+
+	notifs := notified()
+	require.Len(t, notifs, 2)
+	require.Equal(t, mt.StreamEvent_Notified_TypeIncomingCall, notifs[0].Type)
+	require.True(t, notifs[0].Type.IsHighPriority())
+	require.Equal(t, "contact", notifs[0].Title)
+	require.Equal(t, "Incoming call", notifs[0].Body)
+	require.Equal(t, mt.StreamEvent_Notified_TypeMissedCall, notifs[1].Type)
+
+	payload, err := notifs[1].UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, mt.AppMessage_CallStateMissed, payload.(*mt.StreamEvent_Notified_MissedCall).CallLog.State)
+
+	// muted conversations are only notified of repeated calls
+	require.NoError(t, db.MuteConversation(conv.PublicKey, math.MaxInt64))
+	dispatcher.events = nil
+
+	signal("cid_offer_2", mt.AppMessage_TypeCallOffer, &mt.AppMessage_CallOffer{CallID: "call_2", SDP: "v=0", Video: true})
+	require.Len(t, notified(), 1)
+	require.Equal(t, "Incoming video call", notified()[0].Body)
+}
+
+func TestEventHandler_forwardedMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, &recordingDispatcher{}, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	send := func(cid string, origin *mt.AppMessage_ForwardOrigin) {
+		payload := &mt.AppMessage_UserMessage{Body: "forwarded", ForwardedFrom: origin}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "member_1", Payload: raw, SentDate: 1}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageUserMessage(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	origin := &mt.AppMessage_ForwardOrigin{
+		ConversationPublicKey: "origin_conv_pk",
+		CID:                   "bafyreiaxvmx2xxgp2l7jf2ltrytaktwuxhqhjwwdt4h5ix6vy2fz6rheka",
+		AuthorMemberPublicKey: "author_pk",
+		AuthorDisplayName:     "alice",
+		SentDate:              42,
+	}
+	send("cid_forward", origin)
+
+	inte, err := db.GetInteractionByCID("cid_forward")
+	require.NoError(t, err)
+	require.NotNil(t, inte.ForwardedFrom)
+	require.Equal(t, origin, inte.ForwardedFrom.ForwardOrigin())
+
+	// an invalid origin is ignored, the message is kept
+	send("cid_invalid", &mt.AppMessage_ForwardOrigin{ConversationPublicKey: "origin_conv_pk", CID: "invalid"})
+
+	inte, err = db.GetInteractionByCID("cid_invalid")
+	require.NoError(t, err)
+	require.Nil(t, inte.ForwardedFrom)
+
+	_, err = db.RetractInteraction("cid_forward")
+	require.NoError(t, err)
+
+	info, err := db.GetDBInfo()
+	require.NoError(t, err)
+	require.Zero(t, info.ForwardedMessages)
+}
+
+func TestEventHandler_threads(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, &recordingDispatcher{}, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	send := func(cid string, target string, sentDate int64) {
+		payload := &mt.AppMessage_UserMessage{Body: cid}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "member_1", Payload: raw, TargetCID: target, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageUserMessage(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the replies are received before the messages they reply to
+	send("cid_reply_2", "cid_reply_1", 3)
+	send("cid_reply_1", "cid_root", 2)
+
+	rootCID, root, replies, err := db.GetThread("cid_reply_2")
+	require.NoError(t, err)
+	require.Equal(t, "cid_root", rootCID)
+	require.Nil(t, root)
+	require.Len(t, replies, 2)
+
+	send("cid_root", "", 1)
+
+	// a direct reply stored before the threads were tracked
+	_, _, err = db.AddInteraction(mt.Interaction{CID: "cid_legacy", Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, TargetCID: "cid_root", SentDate: 4})
+	require.NoError(t, err)
+
+	rootCID, root, replies, err = db.GetThread("cid_root")
+	require.NoError(t, err)
+	require.Equal(t, "cid_root", rootCID)
+	require.Equal(t, "cid_root", root.GetCID())
+
+	cids := []string(nil)
+	for _, reply := range replies {
+		cids = append(cids, reply.GetCID())
+	}
+	require.Equal(t, []string{"cid_reply_1", "cid_reply_2", "cid_legacy"}, cids)
+
+	_, _, _, err = db.GetThread("cid_unknown")
+	require.True(t, errcode.Is(err, errcode.ErrNotFound))
+}
+
+func TestEventHandler_trackMissingTarget(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, &recordingDispatcher{}, false)
+
+	_, _, err := db.AddInteraction(mt.Interaction{CID: "cid_known", ConversationPublicKey: "conv_pk"})
+	require.NoError(t, err)
+
+	track := func(typ mt.AppMessage_Type, target string) {
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			return h.trackMissingTarget(tx, "conv_pk", &mt.AppMessage{Type: typ, TargetCID: target}, "cid_"+target)
+		}))
+	}
+
+	track(mt.AppMessage_TypeUserMessage, "cid_known")
+	track(mt.AppMessage_TypeMessageRetract, "cid_retracted")
+	track(mt.AppMessage_TypeAcknowledge, "cid_missing")
+
+	due, err := db.GetDueMissingInteractions(messengerutil.TimestampMs(time.Now().Add(missingTargetGracePeriod)), 10)
+	require.NoError(t, err)
+	require.Len(t, due, 1)
+	require.Equal(t, "cid_missing", due[0].CID)
+	require.Equal(t, "cid_cid_missing", due[0].ReferencedByCID)
+}
+
+func TestEventHandler_mentions(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType, AccountMemberPublicKey: "me"}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	receive := func(cid string, mentions ...string) mt.StreamEvent_Notified_Type {
+		payload := &mt.AppMessage_UserMessage{Body: "hello", Mentions: mentions}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "member_1", Payload: raw, SentDate: 1}
+		before := len(dispatcher.snapshot())
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageUserMessage(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+
+		for _, evt := range dispatcher.snapshot()[before:] {
+			if evt.GetType() == mt.StreamEvent_TypeNotified {
+				var notified mt.StreamEvent_Notified
+				require.NoError(t, proto.Unmarshal(evt.GetPayload(), &notified))
+				require.Equal(t, conv.PublicKey, notified.GetGroup().GetConversationPublicKey())
+				if notified.GetType() == mt.StreamEvent_Notified_TypeMentioned {
+					require.Equal(t, mt.StreamEvent_Notified_Group_CategoryMention, notified.GetGroup().GetCategory())
+				}
+				return notified.GetType()
+			}
+		}
+		require.FailNow(t, "no notification")
+		return mt.StreamEvent_Notified_Unknown
+	}
+
+	require.Equal(t, mt.StreamEvent_Notified_TypeMessageReceived, receive("cid_1", "member_2"))
+	require.Equal(t, mt.StreamEvent_Notified_TypeMentioned, receive("cid_2", "member_2", "me", "me"))
+
+	inte, err := db.GetInteractionByCID("cid_2")
+	require.NoError(t, err)
+	require.Len(t, inte.Mentions, 2)
+	require.True(t, inte.IsMentioning("me"))
+}
+
+func TestEventHandler_quoteSnapshots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	require.NoError(t, db.FirstOrCreateAccount("account_pk", "link"))
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		if _, err := tx.AddContactRequestOutgoingEnqueued("contact_pk", "contact", conv.PublicKey); err != nil {
+			return err
+		}
+		_, err := tx.AddConversationForContact(conv.PublicKey, "own_member_pk", "own_device_pk", "contact_pk")
+		return err
+	}))
+
+	send := func(cid, target, body string) {
+		payload := &mt.AppMessage_UserMessage{Body: body}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, Payload: raw, SentDate: messengerutil.TimestampMs(time.Now())}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageUserMessage(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	send("cid_1", "", "hello")
+	send("cid_2", "cid_1", "hi")
+
+	reply, err := db.GetInteractionByCID("cid_2")
+	require.NoError(t, err)
+	require.NotNil(t, reply.Quote)
+	require.Equal(t, "hello", reply.Quote.Excerpt)
+	require.Equal(t, "contact", reply.Quote.AuthorDisplayName)
+	require.False(t, reply.Quote.TargetMissing)
+
+	// a reply received before its target is completed once the target is
+	send("cid_4", "cid_3", "what?")
+	reply, err = db.GetInteractionByCID("cid_4")
+	require.NoError(t, err)
+	require.True(t, reply.Quote.TargetMissing)
+
+	dispatcher.events = nil
+	send("cid_3", "", "late message")
+
+	reply, err = db.GetInteractionByCID("cid_4")
+	require.NoError(t, err)
+	require.False(t, reply.Quote.TargetMissing)
+	require.Equal(t, "late message", reply.Quote.Excerpt)
+
+	updated := []string(nil)
+	for _, evt := range dispatcher.events {
+		if evt.Type != mt.StreamEvent_TypeInteractionUpdated {
+			continue
+		}
+		payload, err := evt.UnmarshalPayload()
+		require.NoError(t, err)
+		updated = append(updated, payload.(*mt.StreamEvent_InteractionUpdated).Interaction.CID)
+	}
+	require.Equal(t, []string{"cid_3", "cid_4"}, updated)
+}
+
+func TestEventHandler_handleAppMessageUserMessageEdit(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	send := func(cid, target, body string) {
+		payload := &mt.AppMessage_UserMessage{Body: body}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, Payload: raw, SentDate: 1}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageUserMessage(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+	edit := func(cid, target, body string, isMine bool, sentDate int64) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessageEdit, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, IsMine: isMine, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageUserMessageEdit(tx, i, &mt.AppMessage_UserMessageEdit{Body: body})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+	bodyOf := func(cid string) string {
+		inte, err := db.GetInteractionByCID(cid)
+		require.NoError(t, err)
+		payload, err := inte.UnmarshalPayload()
+		require.NoError(t, err)
+		return payload.(*mt.AppMessage_UserMessage).GetBody()
+	}
+
+	send("cid_msg", "", "helo")
+	send("cid_reply", "cid_msg", "hi")
+
+	dispatcher.events = nil
+	edit("cid_edit_1", "cid_msg", "hello", false, 3)
+	require.Equal(t, "hello", bodyOf("cid_msg"))
+	require.Len(t, dispatcher.events, 2)
+
+	reply, err := db.GetInteractionByCID("cid_reply")
+	require.NoError(t, err)
+	require.Equal(t, "hello", reply.Quote.Excerpt)
+
+	// older edits are kept in the history only
+	edit("cid_edit_2", "cid_msg", "helo!", false, 2)
+	require.Equal(t, "hello", bodyOf("cid_msg"))
+
+	inte, err := db.GetInteractionByCID("cid_msg")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), inte.EditedDate)
+	require.Len(t, inte.Edits, 2)
+
+	// only the author can edit a message
+	edit("cid_edit_3", "cid_msg", "hacked", true, 4)
+	require.Equal(t, "hello", bodyOf("cid_msg"))
+
+	inte, err = db.GetInteractionByCID("cid_msg")
+	require.NoError(t, err)
+	require.Len(t, inte.Edits, 2)
+
+	// an edit received before its message is applied once the message is
+	edit("cid_edit_4", "cid_late", "late message", false, 5)
+	send("cid_late", "", "late mesage")
+	require.Equal(t, "late message", bodyOf("cid_late"))
+}
+
+func TestEventHandler_handleAppMessageMessageRetract(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_ContactType, ContactPublicKey: "contact_pk"}
+	send := func(cid, target, body string) {
+		payload := &mt.AppMessage_UserMessage{Body: body}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, Payload: raw, SentDate: 1}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			i, _, err := h.handleAppMessageUserMessage(tx, i, payload)
+			if err != nil {
+				return err
+			}
+			_, err = h.interactionConsumeRetractions(tx, i)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+	retract := func(cid, target string, isMine bool) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeMessageRetract, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, IsMine: isMine, SentDate: 2}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageMessageRetract(tx, i, &mt.AppMessage_MessageRetract{})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+	deleted := func() []string {
+		cids := []string(nil)
+		for _, evt := range dispatcher.events {
+			if evt.Type != mt.StreamEvent_TypeInteractionDeleted {
+				continue
+			}
+			payload, err := evt.UnmarshalPayload()
+			require.NoError(t, err)
+			cids = append(cids, payload.(*mt.StreamEvent_InteractionDeleted).CID)
+		}
+		return cids
+	}
+
+	send("cid_msg", "", "oops")
+	send("cid_reply", "cid_msg", "what?")
+
+	// only the author can retract a message
+	retract("cid_retract_1", "cid_msg", true)
+	_, err := db.GetInteractionByCID("cid_msg")
+	require.NoError(t, err)
+	require.Empty(t, deleted())
+
+	retract("cid_retract_2", "cid_msg", false)
+	_, err = db.GetInteractionByCID("cid_msg")
+	require.Error(t, err)
+	require.Equal(t, []string{"cid_msg"}, deleted())
+
+	reply, err := db.GetInteractionByCID("cid_reply")
+	require.NoError(t, err)
+	require.True(t, reply.Quote.TargetRetracted)
+	require.Empty(t, reply.Quote.Excerpt)
+
+	// a retraction received before its message waits in the backlog
+	dispatcher.events = nil
+	retract("cid_retract_3", "cid_late", false)
+	send("cid_late", "", "late")
+	_, err = db.GetInteractionByCID("cid_late")
+	require.Error(t, err)
+	_, err = db.GetInteractionByCID("cid_retract_3")
+	require.Error(t, err)
+	require.Equal(t, []string{"cid_retract_3", "cid_late"}, deleted())
+}
+
+func TestEventHandler_handleAppMessageDeliveryReceipt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	receipt := func(cid, target, memberPK, devicePK string, isMine bool) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeDeliveryReceipt, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, MemberPublicKey: memberPK, DevicePublicKey: devicePK, IsMine: isMine, SentDate: messengerutil.TimestampMs(time.Now())}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageDeliveryReceipt(tx, i, &mt.AppMessage_DeliveryReceipt{})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// receipts can be received before the message they target
+	receipt("cid_receipt_1", "cid_msg", "member_1", "device_1", false)
+	require.Empty(t, dispatcher.events)
+
+	_, _, err := db.AddInteraction(mt.Interaction{CID: "cid_msg", Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, IsMine: true})
+	require.NoError(t, err)
+
+	receipt("cid_receipt_2", "cid_msg", "member_2", "device_2", false)
+	receipt("cid_receipt_3", "cid_msg", "member_2", "device_2", false)
+	receipt("cid_receipt_4", "cid_msg", "own_member", "own_device", true)
+	require.Len(t, dispatcher.events, 1)
+	require.Equal(t, mt.StreamEvent_TypeInteractionUpdated, dispatcher.events[0].Type)
+
+	inte, err := db.GetInteractionByCID("cid_msg")
+	require.NoError(t, err)
+	devices := []string(nil)
+	for _, r := range inte.DeliveryReceipts {
+		devices = append(devices, r.DevicePublicKey)
+	}
+	require.ElementsMatch(t, []string{"device_1", "device_2"}, devices)
+	require.False(t, inte.Acknowledged)
+}
+
+func TestEventHandler_batchedAcknowledge(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	for _, cid := range []string{"cid_msg_1", "cid_msg_2"} {
+		_, _, err := db.AddInteraction(mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, IsMine: true})
+		require.NoError(t, err)
+	}
+
+	ack := func(cid, target string, others ...string) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeAcknowledge, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, MemberPublicKey: "member_1", DevicePublicKey: "device_1", SentDate: 42}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageAcknowledge(tx, i, &mt.AppMessage_Acknowledge{TargetCIDs: others})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+	acknowledged := func(cid string) bool {
+		inte, err := db.GetInteractionByCID(cid)
+		require.NoError(t, err)
+		return inte.GetAcknowledged()
+	}
+
+	// a single app message acknowledges the whole batch
+	ack("cid_ack_1", "cid_msg_1", "cid_msg_2", "cid_msg_1", "cid_msg_3")
+	require.True(t, acknowledged("cid_msg_1"))
+	require.True(t, acknowledged("cid_msg_2"))
+	require.Len(t, dispatcher.snapshot(), 2)
+
+	inte, err := db.GetInteractionByCID("cid_msg_2")
+	require.NoError(t, err)
+	require.Len(t, inte.DeliveryReceipts, 1)
+	require.Equal(t, int64(42), inte.DeliveryReceipts[0].AcknowledgedDate)
+
+	// the targets not received yet are backlogged like a single acknowledge
+	backlogged, err := db.GetAcknowledgementsCIDsForInteraction("cid_msg_3")
+	require.NoError(t, err)
+	require.Equal(t, []string{batchedAckCID("cid_ack_1", "cid_msg_3")}, backlogged)
+	_, err = db.GetInteractionByCID("cid_ack_1")
+	require.Error(t, err)
+
+	msg := &mt.Interaction{CID: "cid_msg_3", Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, IsMine: true}
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		return interactionConsumeAck(tx, msg, h.outboxFor(tx), h.logger)
+	}))
+	require.True(t, msg.GetAcknowledged())
+	backlogged, err = db.GetAcknowledgementsCIDsForInteraction("cid_msg_3")
+	require.NoError(t, err)
+	require.Empty(t, backlogged)
+
+	// the acknowledges of the older devices only have a target
+	ack("cid_ack_2", "cid_msg_4")
+	backlogged, err = db.GetAcknowledgementsCIDsForInteraction("cid_msg_4")
+	require.NoError(t, err)
+	require.Equal(t, []string{"cid_ack_2"}, backlogged)
+}
+
+func TestEventHandler_handleAppMessageReadReceipt(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	receipt := func(cid, target, memberPK string, readUpTo int64) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeReadReceipt, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, MemberPublicKey: memberPK, SentDate: messengerutil.TimestampMs(time.Now())}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageReadReceipt(tx, i, &mt.AppMessage_ReadReceipt{ReadUpToDate: readUpTo})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	for _, msg := range []struct {
+		cid      string
+		sentDate int64
+	}{{"cid_msg_1", 10}, {"cid_msg_2", 20}} {
+		_, _, err := db.AddInteraction(mt.Interaction{CID: msg.cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, IsMine: true, SentDate: msg.sentDate})
+		require.NoError(t, err)
+	}
+
+	// the read date is taken from the target when it isn't set
+	receipt("cid_receipt_1", "cid_msg_1", "member_1", 0)
+	receipt("cid_receipt_2", "", "member_2", 20)
+
+	// the markers don't move backward and receipts without date are dropped
+	receipt("cid_receipt_3", "", "member_2", 15)
+	receipt("cid_receipt_4", "cid_unknown", "member_1", 0)
+
+	events := dispatcher.snapshot()
+	require.Len(t, events, 2)
+	require.Equal(t, mt.StreamEvent_TypeReadReceiptUpdated, events[0].Type)
+
+	markers, err := db.GetReadMarkers(conv.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, markers, 2)
+	require.Equal(t, int64(10), markers[0].ReadDate)
+	require.Equal(t, "cid_msg_1", markers[0].InteractionCID)
+	require.Equal(t, int64(20), markers[1].ReadDate)
+
+	inte, err := db.GetAugmentedInteraction("cid_msg_1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"member_1", "member_2"}, inte.ReadBy)
+
+	inte, err = db.GetAugmentedInteraction("cid_msg_2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"member_2"}, inte.ReadBy)
+
+	// the read receipts of the others are ignored when ours are disabled
+	require.NoError(t, db.SetReceiptPrivacy(conv.PublicKey, true, false))
+	receipt("cid_receipt_5", "", "member_1", 30)
+	require.Len(t, dispatcher.snapshot(), 2)
+}
+
+func TestEventHandler_handleAppMessageBookmark(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	require.NoError(t, db.FirstOrCreateAccount("account_pk", ""))
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	bookmark := func(cid, convPK string, isMine, removed bool, sentDate int64) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeBookmark, ConversationPublicKey: convPK, TargetCID: "cid_msg", IsMine: isMine, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageBookmark(tx, i, &mt.AppMessage_Bookmark{ConversationPublicKey: "conv_pk", Removed: removed})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// only the devices of the account can bookmark, on the account group
+	bookmark("cid_1", "account_pk", false, false, 1)
+	bookmark("cid_2", "conv_pk", true, false, 1)
+	require.Empty(t, dispatcher.events)
+
+	bookmark("cid_3", "account_pk", true, false, 2)
+	bookmark("cid_3", "account_pk", true, false, 2)
+	require.Len(t, dispatcher.events, 1)
+	require.Equal(t, mt.StreamEvent_TypeBookmarkUpdated, dispatcher.events[0].Type)
+
+	bookmark("cid_4", "account_pk", true, true, 3)
+	require.Len(t, dispatcher.events, 2)
+
+	bookmarks, _, err := db.GetBookmarks("")
+	require.NoError(t, err)
+	require.Empty(t, bookmarks)
+}
+
+func TestEventHandler_handleAppMessagePinMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType, AccountMemberPublicKey: "own_member"}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	for _, inte := range []mt.Interaction{
+		{CID: "cid_msg", Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, SentDate: 1},
+		{CID: "cid_other", Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: "other_pk", SentDate: 1},
+	} {
+		_, _, err := db.AddInteraction(inte)
+		require.NoError(t, err)
+	}
+
+	pin := func(cid, target, memberPK string, isMine, removed bool, sentDate int64) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypePinMessage, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: target, MemberPublicKey: memberPK, IsMine: isMine, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessagePinMessage(tx, i, &mt.AppMessage_PinMessage{Removed: removed})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the interactions of other conversations can't be pinned
+	pin("cid_1", "cid_other", "member_1", false, false, 2)
+	require.Empty(t, dispatcher.snapshot())
+
+	pin("cid_2", "cid_msg", "", true, false, 2)
+	pin("cid_2", "cid_msg", "", true, false, 2)
+	events := dispatcher.snapshot()
+	require.Len(t, events, 1)
+	require.Equal(t, mt.StreamEvent_TypePinnedMessageUpdated, events[0].Type)
+
+	pinned, interactions, err := db.GetPinnedMessages(conv.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, pinned, 1)
+	require.Equal(t, "own_member", pinned[0].MemberPublicKey)
+	require.Equal(t, "cid_msg", interactions[0].CID)
+
+	// an older unpin doesn't apply
+	pin("cid_3", "cid_msg", "member_1", false, true, 1)
+	require.Len(t, dispatcher.snapshot(), 1)
+
+	pin("cid_4", "cid_msg", "member_1", false, true, 3)
+	require.Len(t, dispatcher.snapshot(), 2)
+
+	pinned, _, err = db.GetPinnedMessages(conv.PublicKey)
+	require.NoError(t, err)
+	require.Empty(t, pinned)
+}
+
+func TestEventHandler_handleAppMessagePoll(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType, AccountMemberPublicKey: "own_member"}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	vote := func(cid, memberPK string, isMine bool, sentDate int64, options ...int32) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypePollVote, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: "cid_poll", MemberPublicKey: memberPK, IsMine: isMine, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessagePollVote(tx, i, &mt.AppMessage_PollVote{Options: options})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the votes received before the poll are kept
+	vote("cid_vote_1", "member_1", false, 1, 1)
+	require.Empty(t, dispatcher.snapshot())
+
+	poll := &mt.AppMessage_Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}}
+	payload, err := proto.Marshal(poll)
+	require.NoError(t, err)
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, _, err := h.handleAppMessagePoll(tx, &mt.Interaction{CID: "cid_poll", Type: mt.AppMessage_TypePoll, ConversationPublicKey: conv.PublicKey, Payload: payload, SentDate: 1}, poll)
+		return err
+	}))
+	require.NoError(t, h.FlushOutbox())
+	require.Len(t, dispatcher.snapshot(), 1)
+
+	// the latest vote wins, invalid votes are dropped
+	vote("cid_vote_2", "", true, 2, 0)
+	vote("cid_vote_3", "member_1", false, 3, 0)
+	vote("cid_vote_4", "member_1", false, 2, 1)
+	vote("cid_vote_5", "member_1", false, 4, 0, 1)
+	require.Len(t, dispatcher.snapshot(), 3)
+
+	inte, err := db.GetAugmentedInteraction("cid_poll")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), inte.PollResults.Voters)
+	require.Equal(t, []int32{0}, inte.PollResults.OwnOptions)
+	require.Equal(t, []string{"member_1", "own_member"}, inte.PollResults.Options[0].MemberPublicKeys)
+	require.Zero(t, inte.PollResults.Options[1].Count)
+
+	// a withdrawn vote isn't counted
+	vote("cid_vote_6", "member_1", false, 5)
+	inte, err = db.GetAugmentedInteraction("cid_poll")
+	require.NoError(t, err)
+	require.Equal(t, int32(1), inte.PollResults.Voters)
+}
+
+func TestEventHandler_handleAppMessageCalendarEvent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType, AccountMemberPublicKey: "own_member"}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	rsvp := func(cid, memberPK string, isMine bool, sentDate int64, response mt.AppMessage_CalendarEventRSVP_Response) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeCalendarEventRSVP, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: "cid_event", MemberPublicKey: memberPK, IsMine: isMine, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageCalendarEventRSVP(tx, i, &mt.AppMessage_CalendarEventRSVP{Response: response})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the responses received before the event are kept
+	rsvp("cid_rsvp_1", "member_1", false, 1, mt.AppMessage_CalendarEventRSVP_ResponseMaybe)
+	require.Empty(t, dispatcher.snapshot())
+
+	event := &mt.AppMessage_CalendarEvent{Title: "picnic", StartDate: 1000, Location: "park"}
+	payload, err := proto.Marshal(event)
+	require.NoError(t, err)
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, _, err := h.handleAppMessageCalendarEvent(tx, &mt.Interaction{CID: "cid_event", Type: mt.AppMessage_TypeCalendarEvent, ConversationPublicKey: conv.PublicKey, Payload: payload, SentDate: 1}, event)
+		return err
+	}))
+	require.NoError(t, h.FlushOutbox())
+	require.Len(t, dispatcher.snapshot(), 1)
+
+	inte, err := db.GetAugmentedInteraction("cid_event")
+	require.NoError(t, err)
+	require.Equal(t, []string{"member_1"}, inte.CalendarEventAttendance.Maybe)
+
+	// the latest response wins, the older and invalid ones are dropped
+	rsvp("cid_rsvp_2", "", true, 2, mt.AppMessage_CalendarEventRSVP_ResponseGoing)
+	rsvp("cid_rsvp_3", "member_1", false, 3, mt.AppMessage_CalendarEventRSVP_ResponseNotGoing)
+	rsvp("cid_rsvp_4", "member_1", false, 2, mt.AppMessage_CalendarEventRSVP_ResponseGoing)
+	rsvp("cid_rsvp_5", "member_1", false, 4, 42)
+	require.Len(t, dispatcher.snapshot(), 3)
+
+	inte, err = db.GetAugmentedInteraction("cid_event")
+	require.NoError(t, err)
+	require.Equal(t, []string{"own_member"}, inte.CalendarEventAttendance.Going)
+	require.Empty(t, inte.CalendarEventAttendance.Maybe)
+	require.Equal(t, []string{"member_1"}, inte.CalendarEventAttendance.NotGoing)
+	require.Equal(t, mt.AppMessage_CalendarEventRSVP_ResponseGoing, inte.CalendarEventAttendance.OwnResponse)
+
+	// a withdrawn response isn't counted
+	rsvp("cid_rsvp_6", "member_1", false, 5, mt.AppMessage_CalendarEventRSVP_ResponseNone)
+	inte, err = db.GetAugmentedInteraction("cid_event")
+	require.NoError(t, err)
+	require.Empty(t, inte.CalendarEventAttendance.NotGoing)
+}
+
+func TestEventHandler_handleAppMessageLiveLocation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType, AccountMemberPublicKey: "own_member"}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	locationEvents := func() []*mt.MemberLocation {
+		locations := []*mt.MemberLocation(nil)
+		for _, evt := range dispatcher.snapshot() {
+			if evt.GetType() != mt.StreamEvent_TypeLocationUpdated {
+				continue
+			}
+
+			var payload mt.StreamEvent_LocationUpdated
+			require.NoError(t, proto.Unmarshal(evt.GetPayload(), &payload))
+			locations = append(locations, payload.GetLocation())
+		}
+		return locations
+	}
+
+	live := func(cid, targetCID, memberPK string, sentDate int64, payload *mt.AppMessage_LiveLocation) {
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeLiveLocation, ConversationPublicKey: conv.PublicKey, Conversation: conv, TargetCID: targetCID, MemberPublicKey: memberPK, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageLiveLocation(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the start of the share is an interaction, its updates are not
+	live("cid_share", "", "member_1", 1, &mt.AppMessage_LiveLocation{Latitude: 48.85, Longitude: 2.35, ExpiresDate: 100})
+	live("cid_update_1", "cid_share", "member_1", 2, &mt.AppMessage_LiveLocation{Latitude: 48.86, Longitude: 2.36, ExpiresDate: 100})
+
+	_, err = db.GetInteractionByCID("cid_share")
+	require.NoError(t, err)
+	_, err = db.GetInteractionByCID("cid_update_1")
+	require.Error(t, err)
+
+	locations := locationEvents()
+	require.Len(t, locations, 2)
+	require.Equal(t, "cid_share", locations[1].GetCID())
+	require.Equal(t, 48.86, locations[1].GetLatitude())
+
+	// invalid coordinates and updates from another member are dropped
+	live("cid_update_2", "cid_share", "member_1", 3, &mt.AppMessage_LiveLocation{Latitude: 120})
+	live("cid_update_3", "cid_share", "member_2", 3, &mt.AppMessage_LiveLocation{Latitude: 1, Longitude: 1})
+	require.Len(t, locationEvents(), 2)
+
+	live("cid_stop", "cid_share", "member_1", 4, &mt.AppMessage_LiveLocation{Stopped: true})
+	locations = locationEvents()
+	require.Len(t, locations, 3)
+	require.True(t, locations[2].GetStopped())
+	require.Equal(t, 48.86, locations[2].GetLatitude())
+
+	// a one-shot location replaces the stopped share
+	location := &mt.AppMessage_Location{Latitude: 40.71, Longitude: -74}
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		_, _, err := h.handleAppMessageLocation(tx, &mt.Interaction{CID: "cid_location", Type: mt.AppMessage_TypeLocation, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "member_1", SentDate: 5}, location)
+		return err
+	}))
+	require.NoError(t, h.FlushOutbox())
+
+	stored, err := db.GetMemberLocations(conv.PublicKey)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.Equal(t, "cid_location", stored[0].GetCID())
+	require.False(t, stored[0].GetLive())
+}
+
+func TestEventHandler_handleAppMessageSetEphemeralPolicy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	setPolicy := func(cid string, sentDate int64, policy *mt.AppMessage_SetEphemeralPolicy) {
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageSetEphemeralPolicy(tx, &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeSetEphemeralPolicy, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "member_1", SentDate: sentDate}, policy)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// an invalid policy is dropped
+	setPolicy("cid_policy_1", 1000, &mt.AppMessage_SetEphemeralPolicy{MessageTTL: -1})
+	require.Empty(t, dispatcher.snapshot())
+
+	setPolicy("cid_policy_2", 1000, &mt.AppMessage_SetEphemeralPolicy{MessageTTL: 60})
+	events := dispatcher.snapshot()
+	require.Len(t, events, 2)
+	require.Equal(t, mt.StreamEvent_TypeInteractionUpdated, events[0].GetType())
+	require.Equal(t, mt.StreamEvent_TypeConversationUpdated, events[1].GetType())
+
+	var updated mt.StreamEvent_ConversationUpdated
+	require.NoError(t, proto.Unmarshal(events[1].GetPayload(), &updated))
+	require.Equal(t, int64(60), updated.GetConversation().GetMessageTTL())
+
+	// the notice of the policy never disappears
+	notice, err := db.GetInteractionByCID("cid_policy_2")
+	require.NoError(t, err)
+	require.Zero(t, notice.GetExpiresDate())
+
+	inte, _, err := db.AddInteraction(mt.Interaction{CID: "cid_message", Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: conv.PublicKey, SentDate: 2000})
+	require.NoError(t, err)
+	require.Equal(t, int64(62000), inte.GetExpiresDate())
+}
+
+func TestEventHandler_handleAppMessageSetSlowMode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+	_, err = db.AddMember("admin_1", conv.PublicKey, "", "", false, true)
+	require.NoError(t, err)
+
+	setSlowMode := func(cid string, memberPK string, slowMode *mt.AppMessage_SetSlowMode) {
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageSetSlowMode(tx, &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeSetSlowMode, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: memberPK, SentDate: 1000}, slowMode)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the invalid settings and the ones of the other members are dropped
+	setSlowMode("cid_slow_mode_1", "admin_1", &mt.AppMessage_SetSlowMode{Interval: -1})
+	setSlowMode("cid_slow_mode_2", "member_1", &mt.AppMessage_SetSlowMode{Interval: 30})
+	require.Empty(t, dispatcher.snapshot())
+
+	setSlowMode("cid_slow_mode_3", "admin_1", &mt.AppMessage_SetSlowMode{Interval: 30})
+	events := dispatcher.snapshot()
+	require.Len(t, events, 2)
+	require.Equal(t, mt.StreamEvent_TypeInteractionUpdated, events[0].GetType())
+	require.Equal(t, mt.StreamEvent_TypeConversationUpdated, events[1].GetType())
+
+	var updated mt.StreamEvent_ConversationUpdated
+	require.NoError(t, proto.Unmarshal(events[1].GetPayload(), &updated))
+	require.Equal(t, int64(30), updated.GetConversation().GetSlowModeInterval())
+}
+
+func TestEventHandler_handleAppMessageContactShare(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, &recordingDispatcher{}, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	id := &mt.BertyID{DisplayName: "alice", AccountPK: make([]byte, 32), PublicRendezvousSeed: make([]byte, 32)}
+	contactLink, _, err := bertylinks.MarshalLink(id.GetBertyLink())
+	require.NoError(t, err)
+
+	share := func(cid string, payload *mt.AppMessage_ContactShare) {
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeContactShare, ConversationPublicKey: conv.PublicKey, Conversation: conv, Payload: raw}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageContactShare(tx, i, payload)
+			return err
+		}))
+	}
+
+	share("cid_contact", &mt.AppMessage_ContactShare{Link: contactLink, DisplayName: "Alice"})
+	inte, err := db.GetInteractionByCID("cid_contact")
+	require.NoError(t, err)
+	payload, err := inte.UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, "Alice", payload.(*mt.AppMessage_ContactShare).GetDisplayName())
+
+	// only the contact links can be shared
+	group := &mt.BertyGroup{Group: &protocoltypes.Group{PublicKey: make([]byte, 32), Secret: make([]byte, 32), SecretSig: make([]byte, 64), GroupType: protocoltypes.GroupTypeMultiMember, SignPub: make([]byte, 32)}, DisplayName: "group"}
+	groupLink, _, err := bertylinks.MarshalLink(&mt.BertyLink{Kind: mt.BertyLink_GroupV1Kind, BertyGroup: group})
+	require.NoError(t, err)
+
+	for cid, payload := range map[string]*mt.AppMessage_ContactShare{
+		"cid_empty": {},
+		"cid_group": {Link: groupLink},
+		"cid_bad":   {Link: "https://example.com"},
+	} {
+		share(cid, payload)
+		_, err := db.GetInteractionByCID(cid)
+		require.Error(t, err)
+	}
+}
+
+func TestEventHandler_handleAppMessageGroupInvitation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, &recordingDispatcher{}, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+	_, err = db.AddMember("inviter_pk", conv.PublicKey, "bob", "", false, false)
+	require.NoError(t, err)
+
+	groupPK := []byte("group_public_key_of_32_bytes_abc")
+	groupLink := func() string {
+		group := &mt.BertyGroup{Group: &protocoltypes.Group{PublicKey: groupPK, Secret: make([]byte, 32), SecretSig: make([]byte, 64), GroupType: protocoltypes.GroupTypeMultiMember, SignPub: make([]byte, 32)}, DisplayName: "friends"}
+		link, _, err := bertylinks.MarshalLink(&mt.BertyLink{Kind: mt.BertyLink_GroupV1Kind, BertyGroup: group})
+		require.NoError(t, err)
+		return link
+	}()
+
+	invite := func(cid string, link string) *mt.Interaction {
+		payload := &mt.AppMessage_GroupInvitation{Link: link}
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		i := &mt.Interaction{CID: cid, Type: mt.AppMessage_TypeGroupInvitation, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "inviter_pk", Payload: raw}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageGroupInvitation(tx, i, payload)
+			return err
+		}))
+
+		inte, err := db.GetInteractionByCID(cid)
+		require.NoError(t, err)
+		return inte
+	}
+
+	preview := invite("cid_new", groupLink).GetGroupInvitationPreview()
+	require.NotNil(t, preview)
+	require.Equal(t, "cid_new", preview.GetInteractionCID())
+	require.Equal(t, messengerutil.B64EncodeBytes(groupPK), preview.GetGroupPublicKey())
+	require.Equal(t, "friends", preview.GetDisplayName())
+	require.Equal(t, "inviter_pk", preview.GetInviterMemberPublicKey())
+	require.Equal(t, "bob", preview.GetInviterDisplayName())
+	require.False(t, preview.GetJoined())
+	require.Zero(t, preview.GetMemberCount())
+	require.Empty(t, preview.GetDuplicateOfCID())
+
+	// the members are only known once the group is joined
+	joinedPK := messengerutil.B64EncodeBytes(groupPK)
+	_, err = db.UpdateConversation(mt.Conversation{PublicKey: joinedPK, Type: mt.Conversation_MultiMemberType})
+	require.NoError(t, err)
+	for _, memberPK := range []string{"member_1", "member_2"} {
+		_, err = db.AddMember(memberPK, joinedPK, memberPK, "", false, false)
+		require.NoError(t, err)
+	}
+
+	preview = invite("cid_joined", groupLink).GetGroupInvitationPreview()
+	require.NotNil(t, preview)
+	require.True(t, preview.GetJoined())
+	require.Equal(t, int32(2), preview.GetMemberCount())
+	require.Equal(t, "cid_new", preview.GetDuplicateOfCID())
+
+	// an invitation which can't be previewed is still stored
+	require.Nil(t, invite("cid_bad", "https://example.com").GetGroupInvitationPreview())
+}
+
+func TestEventHandler_contactLifecycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	contactPKBytes := []byte("contact_pk")
+	contactPK := messengerutil.B64EncodeBytes(contactPKBytes)
+	_, err := db.AddContactRequestIncomingReceived(contactPK, "contact", "conv_pk")
+	require.NoError(t, err)
+
+	state := func() mt.Contact_State {
+		c, err := db.GetContactByPK(contactPK)
+		require.NoError(t, err)
+		return c.State
+	}
+
+	event := func(evt proto.Message) *protocoltypes.GroupMetadataEvent {
+		raw, err := proto.Marshal(evt)
+		require.NoError(t, err)
+		return &protocoltypes.GroupMetadataEvent{Event: raw}
+	}
+
+	require.NoError(t, h.accountContactRequestIncomingDiscarded(event(&protocoltypes.AccountContactRequestDiscarded{ContactPK: contactPKBytes})))
+	require.Equal(t, mt.Contact_Removed, state())
+	require.Len(t, dispatcher.events, 1)
+
+	// a removed contact can send a new request
+	_, err = db.AddContactRequestIncomingReceived(contactPK, "contact", "conv_pk")
+	require.NoError(t, err)
+	require.Equal(t, mt.Contact_IncomingRequest, state())
+
+	require.NoError(t, h.accountContactBlocked(event(&protocoltypes.AccountContactBlocked{ContactPK: contactPKBytes})))
+	require.Equal(t, mt.Contact_Blocked, state())
+
+	// discarding doesn't apply to blocked contacts
+	require.NoError(t, h.accountContactRequestIncomingDiscarded(event(&protocoltypes.AccountContactRequestDiscarded{ContactPK: contactPKBytes})))
+	require.Equal(t, mt.Contact_Blocked, state())
+
+	require.NoError(t, h.accountContactUnblocked(event(&protocoltypes.AccountContactUnblocked{ContactPK: contactPKBytes})))
+	require.Equal(t, mt.Contact_Removed, state())
+	require.Len(t, dispatcher.events, 3)
+
+	// unknown contacts are blocked too
+	otherPK := []byte("other_pk")
+	require.NoError(t, h.accountContactBlocked(event(&protocoltypes.AccountContactBlocked{ContactPK: otherPK})))
+	other, err := db.GetContactByPK(messengerutil.B64EncodeBytes(otherPK))
+	require.NoError(t, err)
+	require.Equal(t, mt.Contact_Blocked, other.State)
+
+	// the updates are written to the outbox along with the state, they are
+	// kept until they are delivered
+	dispatcher.failOn = mt.StreamEvent_TypeContactUpdated
+	require.NoError(t, h.accountContactUnblocked(event(&protocoltypes.AccountContactUnblocked{ContactPK: otherPK})))
+
+	events, err := db.GetOutboxEvents(10)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	require.Equal(t, mt.StreamEvent_TypeContactUpdated, events[0].Type)
+}
+
+type staticMetaFetcher struct {
+	memberPK, devicePK []byte
+}
+
+func (f *staticMetaFetcher) GroupPKForContact(context.Context, []byte) ([]byte, error) {
+	return nil, errcode.ErrNotImplemented
+}
+
+func (f *staticMetaFetcher) OwnMemberAndDevicePKForConversation(context.Context, []byte) ([]byte, []byte, error) {
+	return f.memberPK, f.devicePK, nil
+}
+
+func TestEventHandler_groupMemberDeviceAddedBacklogOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, &staticMetaFetcher{memberPK: []byte("own_member"), devicePK: []byte("own_device")}, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	gpkb, mpkb, dpkb := []byte("conv_pk"), []byte("member_pk"), []byte("device_pk")
+	gpk, dpk := messengerutil.B64EncodeBytes(gpkb), messengerutil.B64EncodeBytes(dpkb)
+
+	userInfo, err := proto.Marshal(&mt.AppMessage_SetUserInfo{DisplayName: "member"})
+	require.NoError(t, err)
+	message, err := proto.Marshal(&mt.AppMessage_UserMessage{Body: "hello"})
+	require.NoError(t, err)
+
+	// the message is received before the user info
+	for _, i := range []mt.Interaction{
+		{CID: "message", Type: mt.AppMessage_TypeUserMessage, Payload: message, ConversationPublicKey: gpk, DevicePublicKey: dpk, SentDate: 1},
+		{CID: "user_info", Type: mt.AppMessage_TypeSetUserInfo, Payload: userInfo, ConversationPublicKey: gpk, DevicePublicKey: dpk, SentDate: 2},
+	} {
+		inte, _, err := db.AddInteraction(i)
+		require.NoError(t, err)
+		_, err = db.Backlog().Add(inte, time.Now())
+		require.NoError(t, err)
+	}
+
+	event, err := proto.Marshal(&protocoltypes.GroupAddMemberDevice{MemberPK: mpkb, DevicePK: dpkb})
+	require.NoError(t, err)
+	require.NoError(t, h.groupMemberDeviceAdded(&protocoltypes.GroupMetadataEvent{Event: event, EventContext: &protocoltypes.EventContext{GroupPK: gpkb}}))
+
+	memberUpdated, interactionUpdated := -1, -1
+	for idx, evt := range dispatcher.events {
+		switch evt.Type {
+		case mt.StreamEvent_TypeMemberUpdated:
+			payload, err := evt.UnmarshalPayload()
+			require.NoError(t, err)
+			require.Equal(t, "member", payload.(*mt.StreamEvent_MemberUpdated).Member.DisplayName)
+			memberUpdated = idx
+		case mt.StreamEvent_TypeInteractionUpdated:
+			payload, err := evt.UnmarshalPayload()
+			require.NoError(t, err)
+			require.Equal(t, "message", payload.(*mt.StreamEvent_InteractionUpdated).Interaction.CID)
+			interactionUpdated = idx
+		}
+	}
+	require.NotEqual(t, -1, memberUpdated)
+	require.Greater(t, interactionUpdated, memberUpdated)
+}
+
+func TestEventHandler_duplicateEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, &staticMetaFetcher{memberPK: []byte("own_member"), devicePK: []byte("own_device")}, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	gpkb := []byte("conv_pk")
+	gpk := messengerutil.B64EncodeBytes(gpkb)
+	_, err := db.UpdateConversation(mt.Conversation{PublicKey: gpk, Type: mt.Conversation_MultiMemberType})
+	require.NoError(t, err)
+
+	newEvent := func(data string) (*protocoltypes.GroupMessageEvent, string) {
+		hash, err := multihash.Sum([]byte(data), multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		cid := ipfscid.NewCidV0(hash)
+		return &protocoltypes.GroupMessageEvent{
+			EventContext: &protocoltypes.EventContext{ID: cid.Bytes(), GroupPK: gpkb},
+			Headers:      &protocoltypes.MessageHeaders{DevicePK: []byte("device_pk")},
+		}, cid.String()
+	}
+	handle := func(gme *protocoltypes.GroupMessageEvent, body string) {
+		payload, err := proto.Marshal(&mt.AppMessage_UserMessage{Body: body})
+		require.NoError(t, err)
+		require.NoError(t, h.HandleAppMessage(gpk, gme, &mt.AppMessage{Type: mt.AppMessage_TypeUserMessage, Payload: payload, SentDate: 1}))
+	}
+	interactionUpdates := func() int {
+		count := 0
+		for _, evt := range dispatcher.snapshot() {
+			if evt.Type == mt.StreamEvent_TypeInteractionUpdated {
+				count++
+			}
+		}
+		return count
+	}
+
+	// an event delivered again is suppressed
+	gme, cid := newEvent("message_1")
+	handle(gme, "hello")
+	require.Equal(t, 1, interactionUpdates())
+	handle(gme, "hello")
+	require.Equal(t, 1, interactionUpdates())
+	require.Equal(t, uint64(1), h.SuppressedDuplicates())
+
+	// the database is looked up once the event isn't remembered anymore, the
+	// copies of the handler share what it remembers
+	h.handled = newHandledEvents(handledEventsCacheSize)
+	copied := h.WithContext(ctx)
+	require.NoError(t, copied.HandleAppMessage(gpk, gme, &mt.AppMessage{Type: mt.AppMessage_TypeUserMessage, SentDate: 1}))
+	require.Equal(t, 1, interactionUpdates())
+	require.Equal(t, uint64(1), h.SuppressedDuplicates())
+	require.True(t, h.handled.contains(cid))
+
+	// an interaction only received through a push is handled once synced
+	gme, cid = newEvent("message_2")
+	_, _, err = db.AddInteraction(mt.Interaction{CID: cid, Type: mt.AppMessage_TypeUserMessage, ConversationPublicKey: gpk, OutOfStoreMessage: true})
+	require.NoError(t, err)
+	handle(gme, "from push")
+	synced, err := db.IsInteractionSynced(cid)
+	require.NoError(t, err)
+	require.True(t, synced)
+	require.Equal(t, uint64(1), h.SuppressedDuplicates())
+}
+
+func TestHandledEvents(t *testing.T) {
+	e := newHandledEvents(2)
+	e.add("cid1")
+	e.add("cid2")
+	e.add("cid1")
+	require.True(t, e.contains("cid1"))
+	require.True(t, e.contains("cid2"))
+
+	// the oldest cid is forgotten
+	e.add("cid3")
+	require.False(t, e.contains("cid1"))
+	require.True(t, e.contains("cid2"))
+	require.True(t, e.contains("cid3"))
+}
+
+func TestEventHandler_ownDevicesConflicts(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType, AccountMemberPublicKey: "me"}
+	_, err := db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	memberUpdates := func() int {
+		count := 0
+		for _, evt := range dispatcher.snapshot() {
+			if evt.GetType() == mt.StreamEvent_TypeMemberUpdated {
+				count++
+			}
+		}
+		return count
+	}
+
+	setUserInfo := func(devicePK, name string, sentDate int64) {
+		payload := &mt.AppMessage_SetUserInfo{DisplayName: name}
+		i := &mt.Interaction{Type: mt.AppMessage_TypeSetUserInfo, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "me", DevicePublicKey: devicePK, IsMine: true, SentDate: sentDate}
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleAppMessageSetUserInfo(tx, i, payload)
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	displayName := func() string {
+		member, err := db.GetMemberByPK("me", conv.PublicKey)
+		require.NoError(t, err)
+		return member.GetDisplayName()
+	}
+
+	// the info sent at the same date is taken from the greatest device key,
+	// whatever the order it is received in
+	setUserInfo("device_b", "from b", 10)
+	setUserInfo("device_a", "from a", 10)
+	require.Equal(t, "from b", displayName())
+	setUserInfo("device_c", "from c", 10)
+	require.Equal(t, "from c", displayName())
+	require.Equal(t, 2, memberUpdates())
+
+	// the same info sent by another device isn't streamed again
+	setUserInfo("device_a", "from c", 11)
+	require.Equal(t, 2, memberUpdates())
+	setUserInfo("device_a", "renamed", 12)
+	require.Equal(t, "renamed", displayName())
+	require.Equal(t, 3, memberUpdates())
+
+	// the messages sent at the same date are ordered by cid
+	for _, cid := range []string{"cid_b", "cid_a", "cid_c"} {
+		_, _, err := db.AddInteraction(mt.Interaction{CID: cid, ConversationPublicKey: conv.PublicKey, SentDate: 20})
+		require.NoError(t, err)
+	}
+	_, _, err = db.AddInteraction(mt.Interaction{CID: "cid_z", ConversationPublicKey: conv.PublicKey, SentDate: 19})
+	require.NoError(t, err)
+
+	for cid, previous := range map[string]string{"cid_a": "cid_z", "cid_b": "cid_a", "cid_c": "cid_b", "cid_z": ""} {
+		require.NoError(t, messengerutil.StreamInteraction(dispatcher, db, cid, false))
+		events := dispatcher.snapshot()
+		payload, err := events[len(events)-1].UnmarshalPayload()
+		require.NoError(t, err)
+		require.Equal(t, previous, payload.(*mt.StreamEvent_InteractionUpdated).PreviousCID)
+	}
+}
+
+func TestEventHandler_HandleSystemMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	_, err := db.UpdateConversation(mt.Conversation{PublicKey: mt.SystemConversationPublicKey, Type: mt.Conversation_SystemType})
+	require.NoError(t, err)
+
+	msg := &mt.AppMessage_SystemMessage{Kind: mt.AppMessage_SystemMessage_KindTip, Title: "Welcome", Body: "hello", Version: "v1"}
+
+	isNew, err := h.HandleSystemMessage("system-tip-0", 1, msg)
+	require.NoError(t, err)
+	require.True(t, isNew)
+
+	// the messages are only added once
+	isNew, err = h.HandleSystemMessage("system-tip-0", 2, msg)
+	require.NoError(t, err)
+	require.False(t, isNew)
+
+	inte, err := db.GetInteractionByCID("system-tip-0")
+	require.NoError(t, err)
+	require.Equal(t, mt.AppMessage_TypeSystemMessage, inte.GetType())
+	require.Equal(t, int64(1), inte.GetSentDate())
+
+	payload, err := inte.UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, "Welcome", payload.(*mt.AppMessage_SystemMessage).GetTitle())
+
+	conv, err := db.GetConversationByPK(mt.SystemConversationPublicKey)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), conv.GetUnreadCount())
+
+	interactionUpdated := 0
+	for _, evt := range dispatcher.snapshot() {
+		if evt.Type == mt.StreamEvent_TypeInteractionUpdated {
+			interactionUpdated++
+		}
+	}
+	require.Equal(t, 1, interactionUpdated)
+
+	// nothing can be generated once the handler is closed
+	require.NoError(t, h.Close(ctx))
+	_, err = h.HandleSystemMessage("system-tip-1", 3, msg)
+	require.Error(t, err)
+}
+
+type testCustomHandler struct {
+	payloads [][]byte
+	store    bool
+}
+
+func (c *testCustomHandler) HandleAppMessage(_ context.Context, _ *mt.Interaction, payload []byte) (bool, error) {
+	c.payloads = append(c.payloads, payload)
+	return c.store, nil
+}
+
+func TestEventHandler_customAppMessage(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	custom := &testCustomHandler{}
+	typ, err := mt.NewCustomAppMessageType(3, 1)
+	require.NoError(t, err)
+	require.Equal(t, int32(3), typ.CustomNamespace())
+	require.Error(t, h.RegisterAppMessageHandler(mt.AppMessage_TypeUserMessage, custom, false))
+	require.Error(t, h.RegisterAppMessageHandler(typ, nil, false))
+	require.NoError(t, h.RegisterAppMessageHandler(typ, custom, true))
+
+	// a type can't be taken over by another handler
+	require.True(t, errcode.Is(h.RegisterAppMessageHandler(typ, &testCustomHandler{}, false), errcode.ErrInvalidInput))
+
+	// the handlers are shared with the copies of the event handler
+	registered, ok := h.WithContext(ctx).customHandlers.get(typ)
+	require.True(t, ok)
+	require.Equal(t, custom, registered.handler)
+	require.True(t, registered.visible)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", Type: mt.Conversation_MultiMemberType}
+	_, err = db.UpdateConversation(*conv)
+	require.NoError(t, err)
+
+	handle := func(cid string) {
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			_, _, err := h.handleCustomAppMessage(custom)(tx, &mt.Interaction{CID: cid, Type: typ, ConversationPublicKey: conv.PublicKey, Conversation: conv, MemberPublicKey: "member_1"}, &mt.CustomPayload{Data: []byte(cid)})
+			return err
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the handler persisting the payload itself
+	handle("cid_custom_1")
+	require.Equal(t, [][]byte{[]byte("cid_custom_1")}, custom.payloads)
+	_, err = db.GetInteractionByCID("cid_custom_1")
+	require.Error(t, err)
+	require.Empty(t, dispatcher.snapshot())
+
+	// the handler storing the interaction
+	custom.store = true
+	handle("cid_custom_2")
+	stored, err := db.GetInteractionByCID("cid_custom_2")
+	require.NoError(t, err)
+	require.Equal(t, typ, stored.GetType())
+	require.Len(t, dispatcher.snapshot(), 1)
+}
@@ -0,0 +1,264 @@
+package messengerpayloads
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+// HandlerInfo describes the protocol event being handled
+type HandlerInfo struct {
+	GroupPK string
+	// EventID is the cid of the event, it is empty if it can't be cast
+	EventID string
+	// DevicePK is the device sending the app message, it is empty for the
+	// metadata events
+	DevicePK string
+	// IsAppMessage tells which of MetadataType and AppMessageType is set
+	IsAppMessage   bool
+	MetadataType   protocoltypes.EventType
+	AppMessageType mt.AppMessage_Type
+}
+
+// Kind returns "app_message" or "metadata"
+func (i HandlerInfo) Kind() string {
+	if i.IsAppMessage {
+		return "app_message"
+	}
+	return "metadata"
+}
+
+// Type returns the name of the type of the event
+func (i HandlerInfo) Type() string {
+	if i.IsAppMessage {
+		return i.AppMessageType.String()
+	}
+	return i.MetadataType.String()
+}
+
+// LogFields are the fields of the logger of the handler, they correlate the
+// logs of an event
+func (i HandlerInfo) LogFields() []zap.Field {
+	fields := []zap.Field{
+		zap.String("kind", i.Kind()),
+		zap.String("type", i.Type()),
+		logutil.PrivateString("conversation-pk", i.GroupPK),
+		logutil.PrivateString("cid", i.EventID),
+	}
+	if i.DevicePK != "" {
+		fields = append(fields, logutil.PrivateString("device-pk", i.DevicePK))
+	}
+
+	return fields
+}
+
+// HandlerFunc handles a protocol event, the handlers are run with ctx
+type HandlerFunc func(ctx context.Context, info HandlerInfo) error
+
+// HandlerMiddleware wraps the handling of every metadata event and app
+// message, it is given to NewEventHandler. The first middleware given is the
+// outermost one.
+type HandlerMiddleware func(next HandlerFunc) HandlerFunc
+
+// handleWithMiddlewares runs handle through the middlewares of h, handle is
+// given a copy of h bound to the context passed down by the middlewares and
+// logging, along with its database, with the fields of info
+func (h *EventHandler) handleWithMiddlewares(info HandlerInfo, handle func(h *EventHandler) error) error {
+	fields := info.LogFields()
+	logger := h.logger.With(fields...)
+	db := h.db
+	if db != nil {
+		db = db.WithLogFields(fields...)
+	}
+
+	next := func(ctx context.Context, _ HandlerInfo) error {
+		eh := h.WithContext(ctx)
+		eh.logger = logger
+		eh.db = db
+		return handle(eh)
+	}
+
+	for i := len(h.middlewares) - 1; i >= 0; i-- {
+		next = h.middlewares[i](next)
+	}
+
+	return next(h.ctx, info)
+}
+
+// RecoveryMiddleware turns the panics of the handlers into errors, the
+// transaction of the event is rolled back so it can be handled again. It is
+// meant to be the innermost middleware so the others see the panics as errors.
+func RecoveryMiddleware(logger *zap.Logger) HandlerMiddleware {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, info HandlerInfo) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("protocol event handler panicked", append(info.LogFields(), zap.Any("panic", r), zap.Stack("stack"))...)
+					err = errcode.ErrInternal.Wrap(fmt.Errorf("%s handler panicked: %v", info.Type(), r))
+				}
+			}()
+
+			return next(ctx, info)
+		}
+	}
+}
+
+// LoggingMiddleware logs the outcome and the duration of every handler, the
+// ones slower than slow are logged as warnings
+func LoggingMiddleware(logger *zap.Logger, slow time.Duration) HandlerMiddleware {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, info HandlerInfo) error {
+			start := time.Now()
+			err := next(ctx, info)
+			elapsed := time.Since(start)
+
+			fields := append(info.LogFields(), zap.Duration("duration", elapsed))
+			switch {
+			case err != nil:
+				logger.Debug("protocol event handler failed", append(fields, zap.Error(err))...)
+			case slow > 0 && elapsed > slow:
+				logger.Warn("slow protocol event handler", fields...)
+			default:
+				logger.Debug("protocol event handled", fields...)
+			}
+
+			return err
+		}
+	}
+}
+
+// MetricsMiddleware measures the duration of the handlers by kind, type and
+// outcome, the metric is registered on reg
+func MetricsMiddleware(reg prometheus.Registerer) (HandlerMiddleware, error) {
+	durations := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    prometheus.BuildFQName("berty", "messenger", "event_handler_duration_seconds"),
+		Help:    "time spent handling the protocol events",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	}, []string{"kind", "type", "outcome"})
+
+	if err := reg.Register(durations); err != nil {
+		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to register handler metrics: %w", err))
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, info HandlerInfo) error {
+			start := time.Now()
+			err := next(ctx, info)
+
+			outcome := "success"
+			if err != nil {
+				outcome = "error"
+			}
+			durations.WithLabelValues(info.Kind(), info.Type(), outcome).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}, nil
+}
+
+// HandlerTimeouts bounds the time given to the handlers, the durations by type
+// override Default and a zero duration disables the timeout
+type HandlerTimeouts struct {
+	Default    time.Duration
+	Metadata   map[protocoltypes.EventType]time.Duration
+	AppMessage map[mt.AppMessage_Type]time.Duration
+}
+
+// For returns the timeout of the handler of the event described by info
+func (t HandlerTimeouts) For(info HandlerInfo) time.Duration {
+	if info.IsAppMessage {
+		if timeout, ok := t.AppMessage[info.AppMessageType]; ok {
+			return timeout
+		}
+	} else if timeout, ok := t.Metadata[info.MetadataType]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
+// TimeoutMiddleware runs every handler with a context expiring after its
+// timeout, the database transaction and the protocol calls of a handler
+// running late are aborted and the event fails with
+// ErrMessengerHandlerTimeout, a messengerutil.GroupEventRetrier handles it
+// again. The timeouts are counted by kind and type on reg if it is not nil.
+func TimeoutMiddleware(logger *zap.Logger, timeouts HandlerTimeouts, reg prometheus.Registerer) (HandlerMiddleware, error) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	var expired *prometheus.CounterVec
+	if reg != nil {
+		expired = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName("berty", "messenger", "event_handler_timeouts_total"),
+			Help: "protocol event handlers aborted because they ran past their timeout",
+		}, []string{"kind", "type"})
+
+		if err := reg.Register(expired); err != nil {
+			return nil, errcode.TODO.Wrap(fmt.Errorf("unable to register handler timeout metrics: %w", err))
+		}
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, info HandlerInfo) error {
+			timeout := timeouts.For(info)
+			if timeout <= 0 {
+				return next(ctx, info)
+			}
+
+			tctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			err := next(tctx, info)
+			// the handler is only blamed if its own deadline expired, not
+			// if the handler as a whole is closing
+			if err == nil || tctx.Err() != context.DeadlineExceeded || ctx.Err() != nil {
+				return err
+			}
+
+			logger.Warn("protocol event handler timed out", append(info.LogFields(), zap.Duration("timeout", timeout), zap.Error(err))...)
+			if expired != nil {
+				expired.WithLabelValues(info.Kind(), info.Type()).Inc()
+			}
+
+			return errcode.ErrMessengerHandlerTimeout.Wrap(fmt.Errorf("%s handler timed out after %s: %w", info.Type(), timeout, err))
+		}
+	}, nil
+}
+
+// TracingMiddleware handles every event in a span started with a tracer of tp,
+// the database transactions, the protocol calls and the stream events of the
+// handler are traced as its children
+func TracingMiddleware(tp trace.TracerProvider) HandlerMiddleware {
+	tracer := tp.Tracer(messengerutil.TracerName)
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, info HandlerInfo) (err error) {
+			ctx, span := tracer.Start(ctx, "messenger.handle_event", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+				attribute.String("kind", info.Kind()),
+				attribute.String("type", info.Type()),
+			))
+			defer func() { messengerutil.EndSpan(span, err) }()
+
+			return next(ctx, info)
+		}
+	}
+}
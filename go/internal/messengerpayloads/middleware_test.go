@@ -0,0 +1,224 @@
+package messengerpayloads
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+type middlewareCtxKey struct{}
+
+func TestEventHandler_middlewares(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	calls := []string(nil)
+	record := func(name string) HandlerMiddleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(ctx context.Context, info HandlerInfo) error {
+				calls = append(calls, name+":"+info.Type())
+				return next(context.WithValue(ctx, middlewareCtxKey{}, name), info)
+			}
+		}
+	}
+
+	reg := prometheus.NewRegistry()
+	metrics, err := MetricsMiddleware(reg)
+	require.NoError(t, err)
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, nil, false, LoggingMiddleware(nil, time.Second), metrics, record("outer"), record("inner"), RecoveryMiddleware(nil))
+	info := HandlerInfo{IsAppMessage: true, AppMessageType: mt.AppMessage_TypeUserMessage}
+
+	// the first middleware is the outermost one, the handler gets the
+	// context passed down by the last one
+	require.NoError(t, h.handleWithMiddlewares(info, func(h *EventHandler) error {
+		require.Equal(t, "inner", h.Ctx().Value(middlewareCtxKey{}))
+		return nil
+	}))
+	require.Equal(t, []string{"outer:TypeUserMessage", "inner:TypeUserMessage"}, calls)
+
+	// the copies of the handler keep the middlewares
+	calls = nil
+	require.NoError(t, h.WithContext(ctx).handleWithMiddlewares(info, func(*EventHandler) error { return nil }))
+	require.Len(t, calls, 2)
+
+	// a panic fails the event
+	err = h.handleWithMiddlewares(info, func(*EventHandler) error { panic("boom") })
+	require.True(t, errcode.Is(err, errcode.ErrInternal))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	outcomes := map[string]uint64{}
+	for _, m := range families[0].GetMetric() {
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "outcome" {
+				outcomes[label.GetValue()] += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	require.Equal(t, map[string]uint64{"success": 2, "error": 1}, outcomes)
+
+	// the metric can't be registered twice
+	_, err = MetricsMiddleware(reg)
+	require.Error(t, err)
+}
+
+func TestEventHandler_eventLogger(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	core, logs := observer.New(zap.DebugLevel)
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), zap.New(core), nil, false)
+	info := HandlerInfo{GroupPK: "conv_pk", EventID: "event_cid", DevicePK: "device_pk", IsAppMessage: true, AppMessageType: mt.AppMessage_TypeUserMessage}
+
+	// the logs of the handlers carry the fields of their event, the logger of
+	// the handler is left untouched
+	require.NoError(t, h.handleWithMiddlewares(info, func(h *EventHandler) error {
+		h.Logger().Info("handling")
+		return nil
+	}))
+	h.Logger().Info("idle")
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	fields := entries[0].ContextMap()
+	require.Equal(t, "app_message", fields["kind"])
+	require.Equal(t, "TypeUserMessage", fields["type"])
+	for _, key := range []string{"conversation-pk", "cid", "device-pk"} {
+		require.Contains(t, fields, key)
+	}
+	require.Empty(t, entries[1].ContextMap())
+
+	// the metadata events have no device
+	require.Len(t, HandlerInfo{GroupPK: "conv_pk"}.LogFields(), 4)
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer func() { _ = tp.Shutdown(ctx) }()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false, TracingMiddleware(tp))
+	info := HandlerInfo{IsAppMessage: true, AppMessageType: mt.AppMessage_TypeUserMessage}
+
+	require.NoError(t, h.handleWithMiddlewares(info, func(h *EventHandler) error {
+		if err := h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+			return h.outboxFor(tx).StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{}, false)
+		}); err != nil {
+			return err
+		}
+
+		return h.FlushOutbox()
+	}))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Len(t, spans, 3)
+
+	handling := spans["messenger.handle_event"]
+	require.NotNil(t, handling)
+	for _, name := range []string{"messengerdb.transaction", "messenger.dispatch_event"} {
+		require.NotNil(t, spans[name], name)
+		require.Equal(t, handling.SpanContext().SpanID(), spans[name].Parent().SpanID(), name)
+	}
+
+	// the clients receive the trace context of the dispatch
+	events := dispatcher.snapshot()
+	require.Len(t, events, 1)
+	dispatch := spans["messenger.dispatch_event"].SpanContext()
+	require.Equal(t, fmt.Sprintf("00-%s-%s-01", dispatch.TraceID(), dispatch.SpanID()), events[0].GetTraceParent())
+
+	// the errors are recorded on the span of the handling
+	recorder = tracetest.NewSpanRecorder()
+	tp.RegisterSpanProcessor(recorder)
+	require.Error(t, h.handleWithMiddlewares(info, func(*EventHandler) error { return errcode.ErrInternal }))
+	require.Len(t, recorder.Ended(), 1)
+	require.Equal(t, codes.Error, recorder.Ended()[0].Status().Code)
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	reg := prometheus.NewRegistry()
+	timeouts, err := TimeoutMiddleware(nil, HandlerTimeouts{
+		Default:    time.Minute,
+		AppMessage: map[mt.AppMessage_Type]time.Duration{mt.AppMessage_TypeUserMessage: 50 * time.Millisecond},
+	}, reg)
+	require.NoError(t, err)
+
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, nil, false, timeouts, RecoveryMiddleware(nil))
+	info := HandlerInfo{IsAppMessage: true, AppMessageType: mt.AppMessage_TypeUserMessage}
+
+	// a handler hanging inside its transaction is aborted and its writes are
+	// rolled back
+	err = h.handleWithMiddlewares(info, func(h *EventHandler) error {
+		return h.db.TX(h.ctx, func(tx *messengerdb.DBWrapper) error {
+			if _, err := tx.AddConversation("conversation_1", "member_1", "device_1"); err != nil {
+				return err
+			}
+
+			<-h.ctx.Done()
+			return nil
+		})
+	})
+	require.True(t, errcode.Is(err, errcode.ErrMessengerHandlerTimeout), err)
+
+	_, err = db.GetConversationByPK("conversation_1")
+	require.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	// the other types use the default timeout
+	require.NoError(t, h.handleWithMiddlewares(HandlerInfo{IsAppMessage: true, AppMessageType: mt.AppMessage_TypeAcknowledge}, func(h *EventHandler) error {
+		deadline, ok := h.ctx.Deadline()
+		require.True(t, ok)
+		require.Greater(t, time.Until(deadline), time.Second)
+		return nil
+	}))
+
+	// the errors of the handlers on time are left untouched
+	err = h.handleWithMiddlewares(info, func(*EventHandler) error { return errcode.ErrInvalidInput })
+	require.False(t, errcode.Is(err, errcode.ErrMessengerHandlerTimeout))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	require.Len(t, families[0].GetMetric(), 1)
+	require.Equal(t, float64(1), families[0].GetMetric()[0].GetCounter().GetValue())
+
+	// the metric can't be registered twice
+	_, err = TimeoutMiddleware(nil, HandlerTimeouts{}, reg)
+	require.Error(t, err)
+}
@@ -0,0 +1,140 @@
+package messengerpayloads
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const outboxBatchSize = 100
+
+// outboxDispatcher records stream events in the outbox table of the current
+// transaction, they are delivered by FlushOutbox once the transaction is
+// committed, along with the trace context of the handling
+type outboxDispatcher struct {
+	tx          *messengerdb.DBWrapper
+	traceParent string
+}
+
+func (d *outboxDispatcher) StreamEvent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	if _, err := d.tx.AddOutboxEvent(typ, payload, isNew, d.traceParent); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (d *outboxDispatcher) Notify(typ mt.StreamEvent_Notified_Type, title, body string, msg proto.Message, group *mt.StreamEvent_Notified_Group) error {
+	event, err := messengerutil.NewNotifiedEvent(d.tx, typ, title, body, msg, group)
+	if err != nil || event == nil {
+		return err
+	}
+
+	return d.StreamEvent(mt.StreamEvent_TypeNotified, event, false)
+}
+
+func (d *outboxDispatcher) IsEnabled() bool {
+	return true
+}
+
+var _ messengerutil.Dispatcher = (*outboxDispatcher)(nil)
+
+// outboxPayload is a stream event payload already marshaled when it was
+// written to the outbox
+type outboxPayload []byte
+
+func (p *outboxPayload) Marshal() ([]byte, error) { return *p, nil }
+func (p *outboxPayload) Reset()                   { *p = nil }
+func (p *outboxPayload) String() string           { return fmt.Sprintf("%x", []byte(*p)) }
+func (*outboxPayload) ProtoMessage()              {}
+
+// outboxFor returns the dispatcher to use for events emitted inside the given
+// transaction
+func (h *EventHandler) outboxFor(tx *messengerdb.DBWrapper) messengerutil.Dispatcher {
+	if !h.dispatcher.IsEnabled() {
+		return h.dispatcher
+	}
+
+	return &outboxDispatcher{tx: tx, traceParent: messengerutil.TraceParent(h.ctx)}
+}
+
+// FlushOutbox delivers the pending outbox events to the dispatcher, events are
+// removed from the outbox once delivered, so they reach the dispatcher at least
+// once even if the process was stopped between a commit and its dispatch.
+// Delivery stops at the first event which can't be delivered, it is delivered
+// again along with the next ones by the next flush.
+func (h *EventHandler) FlushOutbox() error {
+	if !h.dispatcher.IsEnabled() {
+		return nil
+	}
+
+	h.outboxMutex.Lock()
+	defer h.outboxMutex.Unlock()
+
+	for {
+		events, err := h.db.GetOutboxEvents(outboxBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, 0, len(events))
+		var deliverErr error
+		for _, event := range events {
+			if deliverErr = h.deliverOutboxEvent(event); deliverErr != nil {
+				break
+			}
+			ids = append(ids, event.ID)
+		}
+
+		if len(ids) > 0 {
+			if err := h.db.DeleteOutboxEvents(ids); err != nil {
+				return err
+			}
+		}
+
+		if deliverErr != nil {
+			return errcode.ErrMessengerStreamEvent.Wrap(deliverErr)
+		}
+	}
+}
+
+// deliverOutboxEvent streams an outbox event in a span which is a child of the
+// handling which emitted it, the clients receive the trace context of the span
+func (h *EventHandler) deliverOutboxEvent(event *mt.OutboxEvent) error {
+	// the provider of the current handling is used, the remote parent of
+	// the event can't start spans
+	tracer := trace.SpanFromContext(h.ctx).TracerProvider().Tracer(messengerutil.TracerName)
+	ctx, span := tracer.Start(messengerutil.ContextWithTraceParent(h.ctx, event.TraceParent), "messenger.dispatch_event", trace.WithAttributes(attribute.String("type", event.Type.String())))
+
+	payload := outboxPayload(event.Payload)
+	err := messengerutil.StreamEventWithTraceParent(h.dispatcher, event.Type, &payload, event.IsNew, messengerutil.TraceParent(ctx))
+	if err != nil {
+		h.logger.Error("unable to deliver outbox event", zap.String("type", event.Type.String()), zap.Error(err))
+	}
+
+	messengerutil.EndSpan(span, err)
+	return err
+}
+
+func (h *EventHandler) flushOutbox() {
+	if err := h.FlushOutbox(); err != nil {
+		h.logger.Error("unable to flush outbox", zap.Error(err))
+	}
+}
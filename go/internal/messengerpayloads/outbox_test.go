@@ -0,0 +1,206 @@
+package messengerpayloads
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+type recordingDispatcher struct {
+	mutex  sync.Mutex
+	events []*mt.StreamEvent
+	// failOn is a type of event which can't be delivered
+	failOn mt.StreamEvent_Type
+}
+
+func (d *recordingDispatcher) StreamEvent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool) error {
+	return d.StreamEventWithTraceParent(typ, msg, isNew, "")
+}
+
+func (d *recordingDispatcher) StreamEventWithTraceParent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool, traceParent string) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.failOn != mt.StreamEvent_Undefined && typ == d.failOn {
+		return errcode.ErrMessengerStreamEvent
+	}
+
+	d.events = append(d.events, &mt.StreamEvent{Type: typ, Payload: payload, IsNew: isNew, TraceParent: traceParent})
+	return nil
+}
+
+// snapshot returns the events recorded so far, it is safe to use while events
+// are dispatched from other goroutines
+func (d *recordingDispatcher) snapshot() []*mt.StreamEvent {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return append([]*mt.StreamEvent(nil), d.events...)
+}
+
+func (d *recordingDispatcher) Notify(mt.StreamEvent_Notified_Type, string, string, proto.Message, *mt.StreamEvent_Notified_Group) error {
+	return errcode.ErrNotImplemented
+}
+
+func (d *recordingDispatcher) IsEnabled() bool {
+	return true
+}
+
+func TestEventHandler_FlushOutbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	conv := &mt.Conversation{PublicKey: "conv_pk", DisplayName: "conv"}
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		outbox := h.outboxFor(tx)
+
+		if err := outbox.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, true); err != nil {
+			return err
+		}
+
+		return outbox.Notify(mt.StreamEvent_Notified_TypeBasic, "title", "body", &mt.StreamEvent_Notified_Basic{}, nil)
+	}))
+
+	// nothing is sent until the outbox is flushed
+	require.Empty(t, dispatcher.events)
+
+	require.NoError(t, h.FlushOutbox())
+	require.Len(t, dispatcher.events, 2)
+
+	payload, err := dispatcher.events[0].UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, mt.StreamEvent_TypeConversationUpdated, dispatcher.events[0].Type)
+	require.True(t, dispatcher.events[0].IsNew)
+	require.Equal(t, "conv", payload.(*mt.StreamEvent_ConversationUpdated).Conversation.DisplayName)
+
+	payload, err = dispatcher.events[1].UnmarshalPayload()
+	require.NoError(t, err)
+	notified := payload.(*mt.StreamEvent_Notified)
+	require.Equal(t, mt.StreamEvent_Notified_TypeBasic, notified.Type)
+	require.Equal(t, "title", notified.Title)
+
+	// delivered events are removed from the outbox
+	require.NoError(t, h.FlushOutbox())
+	require.Len(t, dispatcher.events, 2)
+
+	events, err := db.GetOutboxEvents(10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestEventHandler_FlushOutboxFailedDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{failOn: mt.StreamEvent_TypeContactUpdated}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		outbox := h.outboxFor(tx)
+
+		if err := outbox.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: &mt.Conversation{PublicKey: "conv_pk"}}, true); err != nil {
+			return err
+		}
+
+		if err := outbox.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: &mt.Contact{PublicKey: "contact_pk"}}, true); err != nil {
+			return err
+		}
+
+		return outbox.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: &mt.Member{PublicKey: "member_pk"}}, true)
+	}))
+
+	// the delivery stops at the failed event, it is kept with the next ones
+	require.Error(t, h.FlushOutbox())
+	require.Len(t, dispatcher.snapshot(), 1)
+
+	events, err := db.GetOutboxEvents(10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, mt.StreamEvent_TypeContactUpdated, events[0].Type)
+
+	// they are delivered in order by the next flush
+	dispatcher.mutex.Lock()
+	dispatcher.failOn = mt.StreamEvent_Undefined
+	dispatcher.mutex.Unlock()
+
+	require.NoError(t, h.FlushOutbox())
+
+	delivered := dispatcher.snapshot()
+	require.Len(t, delivered, 3)
+	require.Equal(t, mt.StreamEvent_TypeContactUpdated, delivered[1].Type)
+	require.Equal(t, mt.StreamEvent_TypeMemberUpdated, delivered[2].Type)
+
+	events, err = db.GetOutboxEvents(10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+}
+
+func TestEventHandler_snoozedNotifications(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	db, _, dispose := messengerdb.GetInMemoryTestDB(t)
+	defer dispose()
+
+	dispatcher := &recordingDispatcher{}
+	h := NewEventHandler(ctx, db, nil, mt.NewPostActionsServiceNoop(), nil, dispatcher, false)
+
+	require.NoError(t, db.FirstOrCreateAccount("account_pk", "link"))
+	snoozedUntil := messengerutil.TimestampMs(time.Now().Add(time.Hour))
+	require.NoError(t, db.UpdateAccountFields(map[string]interface{}{"notifications_snoozed_until": snoozedUntil}))
+
+	send := func(msg proto.Message) {
+		require.NoError(t, db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+			outbox := h.outboxFor(tx)
+
+			if err := outbox.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{}, false); err != nil {
+				return err
+			}
+
+			return outbox.Notify(mt.StreamEvent_Notified_TypeBasic, "title", "body", msg, nil)
+		}))
+		require.NoError(t, h.FlushOutbox())
+	}
+
+	// the events are still streamed while snoozed
+	send(&mt.StreamEvent_Notified_Basic{})
+	require.Len(t, dispatcher.events, 1)
+	require.Equal(t, mt.StreamEvent_TypeConversationUpdated, dispatcher.events[0].Type)
+
+	// the conversations in focus mode are notified anyway
+	focused := &mt.Conversation{PublicKey: "conv_pk", FocusedUntil: snoozedUntil}
+	send(&mt.StreamEvent_Notified_MessageReceived{Conversation: focused})
+	require.Len(t, dispatcher.events, 3)
+	require.Equal(t, mt.StreamEvent_TypeNotified, dispatcher.events[2].Type)
+	notified := &mt.StreamEvent_Notified{}
+	require.NoError(t, proto.Unmarshal(dispatcher.events[2].Payload, notified))
+	require.True(t, notified.Focused)
+
+	require.NoError(t, db.UpdateAccountFields(map[string]interface{}{"notifications_snoozed_until": 0}))
+	send(&mt.StreamEvent_Notified_Basic{})
+	require.Len(t, dispatcher.events, 5)
+	require.Equal(t, mt.StreamEvent_TypeNotified, dispatcher.events[4].Type)
+}
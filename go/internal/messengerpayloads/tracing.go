@@ -0,0 +1,29 @@
+package messengerpayloads
+
+import (
+	"context"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+)
+
+// tracedMetaFetcher traces the protocol calls made by the handlers as
+// children of the span of their context
+type tracedMetaFetcher struct {
+	MetaFetcher
+}
+
+func (f *tracedMetaFetcher) GroupPKForContact(ctx context.Context, pk []byte) (_ []byte, err error) {
+	ctx, span := messengerutil.StartSpan(ctx, "protocol.GroupPKForContact")
+	defer func() { messengerutil.EndSpan(span, err) }()
+
+	return f.MetaFetcher.GroupPKForContact(ctx, pk)
+}
+
+func (f *tracedMetaFetcher) OwnMemberAndDevicePKForConversation(ctx context.Context, pk []byte) (_ []byte, _ []byte, err error) {
+	ctx, span := messengerutil.StartSpan(ctx, "protocol.OwnMemberAndDevicePKForConversation")
+	defer func() { messengerutil.EndSpan(span, err) }()
+
+	return f.MetaFetcher.OwnMemberAndDevicePKForConversation(ctx, pk)
+}
+
+var _ MetaFetcher = (*tracedMetaFetcher)(nil)
@@ -0,0 +1,125 @@
+package messengerutil
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// AckBatchWindow is how long the acknowledges of a conversation are
+	// gathered before being sent together
+	AckBatchWindow = 500 * time.Millisecond
+	// AckBatchMaxSize is the number of acknowledged messages after which a
+	// batch is sent without waiting for the end of the window
+	AckBatchMaxSize = 50
+)
+
+// AckBatcher coalesces the acknowledges of the messages received in a
+// conversation within a short window, so a single app message acknowledges
+// all of them
+type AckBatcher struct {
+	mutex   sync.Mutex
+	window  time.Duration
+	maxSize int
+	send    func(convPK string, cids []string)
+	pending map[string][]string
+	timers  map[string]*time.Timer
+	closed  bool
+	// sending tracks the batches sent in the background, Close waits for them
+	sending sync.WaitGroup
+}
+
+// NewAckBatcher returns a batcher calling send with the messages to
+// acknowledge in a conversation, in the order they were added
+func NewAckBatcher(window time.Duration, maxSize int, send func(convPK string, cids []string)) *AckBatcher {
+	return &AckBatcher{
+		window:  window,
+		maxSize: maxSize,
+		send:    send,
+		pending: make(map[string][]string),
+		timers:  make(map[string]*time.Timer),
+	}
+}
+
+// Add queues the acknowledge of cid, it never waits for the batch to be sent.
+// The acknowledges added once the batcher is closed are sent right away, Add
+// then returns once they are sent.
+func (b *AckBatcher) Add(convPK, cid string) {
+	b.mutex.Lock()
+
+	if b.closed {
+		b.mutex.Unlock()
+		b.send(convPK, []string{cid})
+		return
+	}
+
+	defer b.mutex.Unlock()
+
+	for _, pending := range b.pending[convPK] {
+		if pending == cid {
+			return
+		}
+	}
+
+	b.pending[convPK] = append(b.pending[convPK], cid)
+
+	if len(b.pending[convPK]) >= b.maxSize {
+		cids := b.take(convPK)
+		b.sending.Add(1)
+		go func() {
+			defer b.sending.Done()
+			b.send(convPK, cids)
+		}()
+		return
+	}
+
+	if _, ok := b.timers[convPK]; !ok {
+		b.timers[convPK] = time.AfterFunc(b.window, func() { b.flush(convPK) })
+	}
+}
+
+// Close sends the pending acknowledges of every conversation and waits for
+// them to be sent, along with the batches already being sent
+func (b *AckBatcher) Close() {
+	b.mutex.Lock()
+	b.closed = true
+	batches := make(map[string][]string, len(b.pending))
+	for convPK := range b.pending {
+		batches[convPK] = b.take(convPK)
+	}
+	b.mutex.Unlock()
+
+	for convPK, cids := range batches {
+		b.send(convPK, cids)
+	}
+
+	b.sending.Wait()
+}
+
+func (b *AckBatcher) flush(convPK string) {
+	b.mutex.Lock()
+	cids := b.take(convPK)
+	if len(cids) == 0 {
+		b.mutex.Unlock()
+		return
+	}
+	b.sending.Add(1)
+	b.mutex.Unlock()
+
+	defer b.sending.Done()
+	b.send(convPK, cids)
+}
+
+// take removes the pending acknowledges of a conversation, the mutex must be
+// held
+func (b *AckBatcher) take(convPK string) []string {
+	if timer, ok := b.timers[convPK]; ok {
+		timer.Stop()
+		delete(b.timers, convPK)
+	}
+
+	cids := b.pending[convPK]
+	delete(b.pending, convPK)
+
+	return cids
+}
@@ -0,0 +1,100 @@
+package messengerutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAckBatcher(t *testing.T) {
+	mutex := sync.Mutex{}
+	sent := map[string][][]string{}
+	batches := make(chan struct{}, 10)
+	b := NewAckBatcher(50*time.Millisecond, 3, func(convPK string, cids []string) {
+		mutex.Lock()
+		sent[convPK] = append(sent[convPK], cids)
+		mutex.Unlock()
+		batches <- struct{}{}
+	})
+	sentTo := func(convPK string) [][]string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return sent[convPK]
+	}
+	wait := func(count int) {
+		for i := 0; i < count; i++ {
+			select {
+			case <-batches:
+			case <-time.After(time.Second):
+				require.FailNow(t, "batch not sent")
+			}
+		}
+	}
+
+	// the acknowledges of a conversation are sent together at the end of the window
+	b.Add("conv1", "cid1")
+	b.Add("conv2", "cid2")
+	b.Add("conv1", "cid3")
+	b.Add("conv1", "cid1")
+	require.Empty(t, sentTo("conv1"))
+	wait(2)
+	require.Equal(t, [][]string{{"cid1", "cid3"}}, sentTo("conv1"))
+	require.Equal(t, [][]string{{"cid2"}}, sentTo("conv2"))
+
+	// a full batch is sent right away
+	for _, cid := range []string{"cid4", "cid5", "cid6", "cid7"} {
+		b.Add("conv1", cid)
+	}
+	wait(1)
+	require.Equal(t, [][]string{{"cid1", "cid3"}, {"cid4", "cid5", "cid6"}}, sentTo("conv1"))
+
+	// the pending acknowledges are sent by close
+	b.Close()
+	require.Equal(t, [][]string{{"cid1", "cid3"}, {"cid4", "cid5", "cid6"}, {"cid7"}}, sentTo("conv1"))
+	wait(1)
+
+	// then they are sent right away
+	b.Add("conv2", "cid8")
+	require.Equal(t, [][]string{{"cid2"}, {"cid8"}}, sentTo("conv2"))
+	wait(1)
+}
+
+func TestAckBatcherCloseWaitsForSends(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	sent := make(chan []string, 10)
+	b := NewAckBatcher(time.Hour, 2, func(convPK string, cids []string) {
+		if len(cids) == 2 {
+			close(started)
+			<-release
+		}
+		sent <- cids
+	})
+
+	// a full batch is sent in the background
+	b.Add("conv1", "cid1")
+	b.Add("conv1", "cid2")
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		require.FailNow(t, "close returned before the batch was sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		require.FailNow(t, "close didn't return")
+	}
+	require.Equal(t, []string{"cid1", "cid2"}, <-sent)
+}
@@ -0,0 +1,94 @@
+package messengerutil
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+var auditCSVHeader = []string{"kind", "interaction_cid", "member_public_key", "member_display_name", "device_public_key", "date"}
+
+type auditJSONRecord struct {
+	Kind              string `json:"kind"`
+	InteractionCID    string `json:"interaction_cid"`
+	MemberPublicKey   string `json:"member_public_key"`
+	MemberDisplayName string `json:"member_display_name,omitempty"`
+	DevicePublicKey   string `json:"device_public_key,omitempty"`
+	Date              int64  `json:"date"`
+}
+
+// AuditWriter encodes the records of a conversation audit export, Flush must
+// be called once every record is written
+type AuditWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func NewAuditWriter(w io.Writer, format mt.ConversationAuditExport_Format) (*AuditWriter, error) {
+	switch format {
+	case mt.ConversationAuditExport_FormatJSON:
+		return &AuditWriter{json: json.NewEncoder(w)}, nil
+	case mt.ConversationAuditExport_FormatCSV:
+		a := &AuditWriter{csv: csv.NewWriter(w)}
+		if err := a.csv.Write(auditCSVHeader); err != nil {
+			return nil, errcode.ErrSerialization.Wrap(err)
+		}
+		return a, nil
+	default:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unsupported audit export format: %q", format))
+	}
+}
+
+func auditKindName(kind mt.ConversationAuditExport_Record_Kind) string {
+	return strings.ToLower(strings.TrimPrefix(kind.String(), "Kind"))
+}
+
+// Write encodes a record, the writes may be buffered until Flush is called
+func (a *AuditWriter) Write(r *mt.ConversationAuditExport_Record) error {
+	if a.csv != nil {
+		if err := a.csv.Write([]string{
+			auditKindName(r.GetKind()),
+			r.GetInteractionCID(),
+			r.GetMemberPublicKey(),
+			r.GetMemberDisplayName(),
+			r.GetDevicePublicKey(),
+			strconv.FormatInt(r.GetDate(), 10),
+		}); err != nil {
+			return errcode.ErrSerialization.Wrap(err)
+		}
+		return nil
+	}
+
+	if err := a.json.Encode(&auditJSONRecord{
+		Kind:              auditKindName(r.GetKind()),
+		InteractionCID:    r.GetInteractionCID(),
+		MemberPublicKey:   r.GetMemberPublicKey(),
+		MemberDisplayName: r.GetMemberDisplayName(),
+		DevicePublicKey:   r.GetDevicePublicKey(),
+		Date:              r.GetDate(),
+	}); err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	return nil
+}
+
+// Flush writes the buffered records
+func (a *AuditWriter) Flush() error {
+	if a.csv == nil {
+		return nil
+	}
+
+	a.csv.Flush()
+	if err := a.csv.Error(); err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	return nil
+}
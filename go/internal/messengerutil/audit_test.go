@@ -0,0 +1,38 @@
+package messengerutil
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestAuditWriter(t *testing.T) {
+	records := []*mt.ConversationAuditExport_Record{
+		{Kind: mt.ConversationAuditExport_Record_KindDelivered, InteractionCID: "cid1", MemberPublicKey: "alice", MemberDisplayName: "Alice, \"A\"", DevicePublicKey: "alice1", Date: 10},
+		{Kind: mt.ConversationAuditExport_Record_KindRead, InteractionCID: "cid1", MemberPublicKey: "bob", Date: 20},
+	}
+
+	write := func(format mt.ConversationAuditExport_Format) string {
+		buf := &bytes.Buffer{}
+		w, err := NewAuditWriter(buf, format)
+		require.NoError(t, err)
+		for _, r := range records {
+			require.NoError(t, w.Write(r))
+		}
+		require.NoError(t, w.Flush())
+		return buf.String()
+	}
+
+	require.Equal(t, "kind,interaction_cid,member_public_key,member_display_name,device_public_key,date\n"+
+		"delivered,cid1,alice,\"Alice, \"\"A\"\"\",alice1,10\n"+
+		"read,cid1,bob,,,20\n", write(mt.ConversationAuditExport_FormatCSV))
+
+	require.Equal(t, "{\"kind\":\"delivered\",\"interaction_cid\":\"cid1\",\"member_public_key\":\"alice\",\"member_display_name\":\"Alice, \\\"A\\\"\",\"device_public_key\":\"alice1\",\"date\":10}\n"+
+		"{\"kind\":\"read\",\"interaction_cid\":\"cid1\",\"member_public_key\":\"bob\",\"date\":20}\n", write(mt.ConversationAuditExport_FormatJSON))
+
+	_, err := NewAuditWriter(&bytes.Buffer{}, mt.ConversationAuditExport_Format(42))
+	require.Error(t, err)
+}
@@ -0,0 +1,142 @@
+package messengerutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	// register the decoders of the accepted avatar formats
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// AvatarSize is the width and height of the avatars, in pixels
+	AvatarSize = 256
+	// AvatarMaxInputSize is the maximum size of an image given to ResizeAvatar
+	AvatarMaxInputSize = 10 * 1024 * 1024
+	// AvatarMaxSize is the maximum size of an avatar fetched from a peer
+	AvatarMaxSize = 512 * 1024
+	// AvatarMimeType is the type of the images returned by ResizeAvatar
+	AvatarMimeType = "image/jpeg"
+
+	// ThumbnailMaxSide is the maximum width and height of the thumbnails, in
+	// pixels
+	ThumbnailMaxSide = 256
+	// ThumbnailMimeType is the type of the images returned by Thumbnail
+	ThumbnailMimeType = "image/jpeg"
+
+	avatarJPEGQuality = 85
+
+	// imageMaxPixels bounds the images decoded to make an avatar or a
+	// thumbnail, a small file can describe a huge image
+	imageMaxPixels       = 64 * 1024 * 1024
+	thumbnailJPEGQuality = 75
+)
+
+// ResizeAvatar crops the center square of a JPEG, PNG or GIF image and scales
+// it to AvatarSize, the result is JPEG encoded.
+func ResizeAvatar(raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, errcode.ErrMissingInput
+	}
+
+	if len(raw) > AvatarMaxInputSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("image is too large: %d bytes, max is %d", len(raw), AvatarMaxInputSize))
+	}
+
+	src, err := decodeImage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// crop the biggest centered square
+	bounds := src.Bounds()
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+	if side == 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("empty image"))
+	}
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
+
+	dst := image.NewRGBA(image.Rect(0, 0, AvatarSize, AvatarSize))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+
+	out := new(bytes.Buffer)
+	if err := jpeg.Encode(out, dst, &jpeg.Options{Quality: avatarJPEGQuality}); err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// Thumbnail scales a JPEG, PNG or GIF image down to fit in ThumbnailMaxSide,
+// keeping its aspect ratio, the result is JPEG encoded.
+func Thumbnail(raw []byte) ([]byte, error) {
+	if len(raw) == 0 {
+		return nil, errcode.ErrMissingInput
+	}
+
+	src, err := decodeImage(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	// the small images are only re-encoded
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > ThumbnailMaxSide || height > ThumbnailMaxSide {
+		if width > height {
+			width, height = ThumbnailMaxSide, height*ThumbnailMaxSide/width
+		} else {
+			width, height = width*ThumbnailMaxSide/height, ThumbnailMaxSide
+		}
+	}
+	if width == 0 {
+		width = 1
+	}
+	if height == 0 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+
+	out := new(bytes.Buffer)
+	if err := jpeg.Encode(out, dst, &jpeg.Options{Quality: thumbnailJPEGQuality}); err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return out.Bytes(), nil
+}
+
+// decodeImage decodes a JPEG, PNG or GIF image once its header shows it has
+// no more than imageMaxPixels
+func decodeImage(raw []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to decode image: %w", err))
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("empty image"))
+	}
+	if config.Width*config.Height > imageMaxPixels {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("image is too large: %dx%d", config.Width, config.Height))
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to decode image: %w", err))
+	}
+
+	return src, nil
+}
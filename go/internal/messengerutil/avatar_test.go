@@ -0,0 +1,98 @@
+package messengerutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestResizeAvatar(t *testing.T) {
+	_, err := ResizeAvatar(nil)
+	require.Equal(t, errcode.ErrMissingInput, errcode.Code(err))
+
+	_, err = ResizeAvatar([]byte("not an image"))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+
+	for _, size := range []image.Rectangle{
+		image.Rect(0, 0, 1024, 512), // landscape, downscaled
+		image.Rect(0, 0, 30, 90),    // portrait, upscaled
+	} {
+		src := image.NewRGBA(size)
+		for x := 0; x < size.Dx(); x++ {
+			for y := 0; y < size.Dy(); y++ {
+				src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 42, A: 255})
+			}
+		}
+
+		raw := new(bytes.Buffer)
+		require.NoError(t, png.Encode(raw, src))
+
+		avatar, err := ResizeAvatar(raw.Bytes())
+		require.NoError(t, err)
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(avatar))
+		require.NoError(t, err)
+		require.Equal(t, AvatarSize, cfg.Width)
+		require.Equal(t, AvatarSize, cfg.Height)
+	}
+
+	_, err = ResizeAvatar(hugePNG(t))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+}
+
+func TestThumbnail(t *testing.T) {
+	_, err := Thumbnail(nil)
+	require.Equal(t, errcode.ErrMissingInput, errcode.Code(err))
+
+	_, err = Thumbnail([]byte("not an image"))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+
+	for _, tc := range []struct {
+		size          image.Rectangle
+		width, height int
+	}{
+		{image.Rect(0, 0, 1024, 512), ThumbnailMaxSide, ThumbnailMaxSide / 2}, // landscape, downscaled
+		{image.Rect(0, 0, 300, 1200), ThumbnailMaxSide / 4, ThumbnailMaxSide}, // portrait, downscaled
+		{image.Rect(0, 0, 30, 90), 30, 90},                                    // small, kept
+	} {
+		raw := new(bytes.Buffer)
+		require.NoError(t, png.Encode(raw, image.NewRGBA(tc.size)))
+
+		thumbnail, err := Thumbnail(raw.Bytes())
+		require.NoError(t, err)
+
+		cfg, err := jpeg.DecodeConfig(bytes.NewReader(thumbnail))
+		require.NoError(t, err)
+		require.Equal(t, tc.width, cfg.Width)
+		require.Equal(t, tc.height, cfg.Height)
+	}
+
+	_, err = Thumbnail(hugePNG(t))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+}
+
+// hugePNG returns a small PNG whose header declares a 65536x65536 image
+func hugePNG(t *testing.T) []byte {
+	t.Helper()
+
+	raw := new(bytes.Buffer)
+	require.NoError(t, png.Encode(raw, image.NewRGBA(image.Rect(0, 0, 1, 1))))
+
+	// the IHDR chunk follows the 8 bytes signature, its data starts with the
+	// width and the height and is followed by its checksum
+	b := raw.Bytes()
+	binary.BigEndian.PutUint32(b[16:20], 1<<16)
+	binary.BigEndian.PutUint32(b[20:24], 1<<16)
+	binary.BigEndian.PutUint32(b[29:33], crc32.ChecksumIEEE(b[12:29]))
+
+	return b
+}
@@ -0,0 +1,59 @@
+package messengerutil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	// ContactRequestBulkMaxLinks is the maximum number of links of a ContactRequestBulk
+	ContactRequestBulkMaxLinks = 256
+
+	// ContactRequestIntroductionMaxLength is the maximum number of characters
+	// of the message attached to a contact request
+	ContactRequestIntroductionMaxLength = 512
+)
+
+// ContactRequestLink returns the contact link a contact request can be sent
+// to, the passphrase is only needed for the encrypted links
+func ContactRequestLink(raw string, passphrase []byte, now time.Time) (*mt.BertyLink, error) {
+	link, err := bertylinks.UnmarshalLink(raw, passphrase)
+	if err != nil {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+	}
+
+	if link.GetKind() == mt.BertyLink_EncryptedV1Kind {
+		return nil, errcode.ErrMessengerDeepLinkRequiresPassphrase
+	}
+
+	if !link.IsContact() {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(fmt.Errorf("not a contact link: %s", link.GetKind()))
+	}
+
+	if link.IsExpired(now) {
+		return nil, errcode.ErrMessengerDeepLinkExpired
+	}
+
+	return link, nil
+}
+
+// ContactRequestIntroduction returns the trimmed message to attach to a contact
+// request, it is empty if there is none
+func ContactRequestIntroduction(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if !utf8.ValidString(text) {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("introduction is not valid utf-8"))
+	}
+
+	if length := utf8.RuneCountInString(text); length > ContactRequestIntroductionMaxLength {
+		return "", errcode.ErrInvalidInput.Wrap(fmt.Errorf("introduction is too long: %d characters, max is %d", length, ContactRequestIntroductionMaxLength))
+	}
+
+	return text, nil
+}
@@ -0,0 +1,62 @@
+package messengerutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestContactRequestLink(t *testing.T) {
+	now := time.Now()
+	id := &mt.BertyID{DisplayName: "alice", AccountPK: make([]byte, 32), PublicRendezvousSeed: make([]byte, 32)}
+
+	raw, _, err := bertylinks.MarshalLink(id.GetBertyLink())
+	require.NoError(t, err)
+	link, err := ContactRequestLink(raw, nil, now)
+	require.NoError(t, err)
+	require.Equal(t, "alice", link.GetBertyID().GetDisplayName())
+
+	expiring := id.GetBertyLink()
+	expiring.ExpiresAt = now.Add(-time.Minute).UnixNano() / int64(time.Millisecond)
+	raw, _, err = bertylinks.MarshalLink(expiring)
+	require.NoError(t, err)
+	_, err = ContactRequestLink(raw, nil, now)
+	require.Equal(t, errcode.ErrMessengerDeepLinkExpired, errcode.Code(err))
+
+	encrypted, err := bertylinks.EncryptLink(id.GetBertyLink(), []byte("secret"))
+	require.NoError(t, err)
+	raw, _, err = bertylinks.MarshalLink(encrypted)
+	require.NoError(t, err)
+	_, err = ContactRequestLink(raw, nil, now)
+	require.Equal(t, errcode.ErrMessengerDeepLinkRequiresPassphrase, errcode.Code(err))
+	_, err = ContactRequestLink(raw, []byte("secret"), now)
+	require.NoError(t, err)
+
+	_, err = ContactRequestLink("https://example.com", nil, now)
+	require.Equal(t, errcode.ErrMessengerInvalidDeepLink, errcode.Code(err))
+}
+
+func TestContactRequestIntroduction(t *testing.T) {
+	text, err := ContactRequestIntroduction("  hi, we met at the meetup  ")
+	require.NoError(t, err)
+	require.Equal(t, "hi, we met at the meetup", text)
+
+	text, err = ContactRequestIntroduction(" \n ")
+	require.NoError(t, err)
+	require.Empty(t, text)
+
+	_, err = ContactRequestIntroduction(strings.Repeat("é", ContactRequestIntroductionMaxLength))
+	require.NoError(t, err)
+
+	_, err = ContactRequestIntroduction(strings.Repeat("é", ContactRequestIntroductionMaxLength+1))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+
+	_, err = ContactRequestIntroduction("\xff")
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+}
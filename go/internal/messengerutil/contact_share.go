@@ -0,0 +1,28 @@
+package messengerutil
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// ContactShareLink returns the contact link shared by a ContactShare, it must
+// be an unencrypted contact link
+func ContactShareLink(share *mt.AppMessage_ContactShare) (*mt.BertyLink, error) {
+	if share.GetLink() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a contact link is required"))
+	}
+
+	link, err := bertylinks.UnmarshalLink(share.GetLink(), nil)
+	if err != nil {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+	}
+
+	if !link.IsContact() {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(fmt.Errorf("not a contact link: %s", link.GetKind()))
+	}
+
+	return link, nil
+}
@@ -0,0 +1,162 @@
+package messengerutil
+
+import (
+	"fmt"
+	"strings"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// ConversationDiagnosis is the local state of a conversation needed to send
+// and receive its messages
+type ConversationDiagnosis struct {
+	// Conversation is nil if the conversation is unknown, the contact of a
+	// contact conversation must be set
+	Conversation *mt.Conversation
+	// Activated is true if the group is opened by the messenger
+	Activated bool
+	// Streaming is false while the subscriptions are paused, in background
+	Streaming bool
+	// Subscribed is true while the streams of the group are open
+	Subscribed bool
+	Members    []*mt.DiagnoseConversation_MemberState
+	Queued     int64
+	// ConnectedPeers is negative if the peers couldn't be listed
+	ConnectedPeers int
+}
+
+// Checks returns the result of each check in the order they depend on each
+// other, the checks following a failure they depend on are skipped
+func (d *ConversationDiagnosis) Checks() []*mt.DiagnoseConversation_Check {
+	checks := []*mt.DiagnoseConversation_Check(nil)
+	failed := false
+	add := func(kind mt.DiagnoseConversation_Kind, status mt.DiagnoseConversation_Status, action string, format string, args ...interface{}) {
+		if failed {
+			status, action = mt.DiagnoseConversation_StatusSkipped, ""
+		}
+		checks = append(checks, &mt.DiagnoseConversation_Check{Kind: kind, Status: status, Detail: fmt.Sprintf(format, args...), Action: action})
+	}
+
+	conv := d.Conversation
+	switch {
+	case conv == nil:
+		add(mt.DiagnoseConversation_KindConversation, mt.DiagnoseConversation_StatusError, "check the public key of the conversation", "unknown conversation")
+		failed = true
+	case conv.GetType() == mt.Conversation_SystemType:
+		add(mt.DiagnoseConversation_KindConversation, mt.DiagnoseConversation_StatusError, "", "nothing is sent in the system conversation")
+		failed = true
+	default:
+		add(mt.DiagnoseConversation_KindConversation, mt.DiagnoseConversation_StatusOK, "", "%s conversation", strings.TrimSuffix(conv.GetType().String(), "Type"))
+	}
+
+	if conv.GetType() == mt.Conversation_ContactType {
+		ok, warn, fail := mt.DiagnoseConversation_StatusOK, mt.DiagnoseConversation_StatusWarning, mt.DiagnoseConversation_StatusError
+		switch conv.GetContact().GetState() {
+		case mt.Contact_Accepted:
+			add(mt.DiagnoseConversation_KindContactAccepted, ok, "", "the contact request is accepted")
+		case mt.Contact_OutgoingRequestEnqueued:
+			add(mt.DiagnoseConversation_KindContactAccepted, warn, "connect to a network to send the contact request", "the contact request is not sent yet")
+		case mt.Contact_OutgoingRequestSent:
+			add(mt.DiagnoseConversation_KindContactAccepted, warn, "ask the contact to accept the request", "the contact request is not accepted yet, the messages are delivered once it is")
+		case mt.Contact_IncomingRequest:
+			add(mt.DiagnoseConversation_KindContactAccepted, fail, "accept the contact request", "the contact request is not accepted")
+			failed = true
+		case mt.Contact_Blocked:
+			add(mt.DiagnoseConversation_KindContactAccepted, fail, "unblock the contact", "the contact is blocked")
+			failed = true
+		case mt.Contact_Removed:
+			add(mt.DiagnoseConversation_KindContactAccepted, fail, "send a new contact request", "the contact was removed")
+			failed = true
+		default:
+			add(mt.DiagnoseConversation_KindContactAccepted, fail, "send a new contact request", "unknown contact")
+			failed = true
+		}
+	}
+
+	if !d.Activated {
+		add(mt.DiagnoseConversation_KindGroupActivated, mt.DiagnoseConversation_StatusError, "open the conversation again or restart the app", "the group is not activated on this device")
+		failed = true
+	} else {
+		add(mt.DiagnoseConversation_KindGroupActivated, mt.DiagnoseConversation_StatusOK, "", "the group is activated")
+	}
+
+	switch {
+	case !d.Streaming:
+		add(mt.DiagnoseConversation_KindGroupSubscribed, mt.DiagnoseConversation_StatusWarning, "bring the app to the foreground", "the subscriptions are paused, the app is in background")
+	case !d.Subscribed:
+		add(mt.DiagnoseConversation_KindGroupSubscribed, mt.DiagnoseConversation_StatusError, "restart the app", "the streams of the group are closed, nothing is received")
+	default:
+		add(mt.DiagnoseConversation_KindGroupSubscribed, mt.DiagnoseConversation_StatusOK, "", "the streams of the group are open")
+	}
+
+	withDevices, withoutDevices, unexchanged := 0, []string(nil), []string(nil)
+	for _, m := range d.Members {
+		switch {
+		case m.GetDevices() == 0:
+			withoutDevices = append(withoutDevices, memberStateName(m))
+		case !m.GetReceivedFrom() && !m.GetDeliveredTo():
+			withDevices++
+			unexchanged = append(unexchanged, memberStateName(m))
+		default:
+			withDevices++
+		}
+	}
+
+	switch {
+	case len(d.Members) == 0:
+		add(mt.DiagnoseConversation_KindMemberDevices, mt.DiagnoseConversation_StatusWarning, "invite members to the conversation", "no other member is known yet")
+	case withDevices == 0:
+		add(mt.DiagnoseConversation_KindMemberDevices, mt.DiagnoseConversation_StatusError, "wait for the members to open the conversation while connected", "no device of the other members is known, nobody can read the messages")
+	case len(withoutDevices) > 0:
+		add(mt.DiagnoseConversation_KindMemberDevices, mt.DiagnoseConversation_StatusWarning, "wait for them to open the conversation while connected", "no device known for %s", strings.Join(withoutDevices, ", "))
+	default:
+		add(mt.DiagnoseConversation_KindMemberDevices, mt.DiagnoseConversation_StatusOK, "", "a device is known for every member")
+	}
+
+	// the secrets aren't exposed by the protocol, an interaction exchanged
+	// with a member shows they were
+	switch {
+	case withDevices == 0:
+		add(mt.DiagnoseConversation_KindSecretsExchanged, mt.DiagnoseConversation_StatusSkipped, "", "no device known")
+	case len(unexchanged) > 0:
+		add(mt.DiagnoseConversation_KindSecretsExchanged, mt.DiagnoseConversation_StatusWarning, "ask them to open the conversation while connected at the same time as this device", "nothing exchanged with %s yet, the secrets may be missing", strings.Join(unexchanged, ", "))
+	default:
+		add(mt.DiagnoseConversation_KindSecretsExchanged, mt.DiagnoseConversation_StatusOK, "", "interactions exchanged with every member")
+	}
+
+	if d.Queued > 0 {
+		add(mt.DiagnoseConversation_KindQueuedMessages, mt.DiagnoseConversation_StatusWarning, "connect to a network to send them", "%d messages waiting to be sent", d.Queued)
+	} else {
+		add(mt.DiagnoseConversation_KindQueuedMessages, mt.DiagnoseConversation_StatusOK, "", "no message waiting to be sent")
+	}
+
+	switch {
+	case d.ConnectedPeers < 0:
+		add(mt.DiagnoseConversation_KindConnectedPeers, mt.DiagnoseConversation_StatusSkipped, "", "unable to list the peers of the group")
+	case d.ConnectedPeers == 0:
+		add(mt.DiagnoseConversation_KindConnectedPeers, mt.DiagnoseConversation_StatusWarning, "check the network connection or add a replication service", "no peer of the group is connected, the messages are sent once one is")
+	default:
+		add(mt.DiagnoseConversation_KindConnectedPeers, mt.DiagnoseConversation_StatusOK, "", "%d peers of the group connected", d.ConnectedPeers)
+	}
+
+	return checks
+}
+
+// ChecksOK returns true if none of the checks failed
+func ChecksOK(checks []*mt.DiagnoseConversation_Check) bool {
+	for _, check := range checks {
+		if check.GetStatus() == mt.DiagnoseConversation_StatusError {
+			return false
+		}
+	}
+
+	return true
+}
+
+func memberStateName(m *mt.DiagnoseConversation_MemberState) string {
+	if m.GetDisplayName() != "" {
+		return m.GetDisplayName()
+	}
+
+	return m.GetMemberPublicKey()
+}
@@ -0,0 +1,90 @@
+package messengerutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestConversationDiagnosis_Checks(t *testing.T) {
+	statuses := func(d *ConversationDiagnosis) map[mt.DiagnoseConversation_Kind]mt.DiagnoseConversation_Status {
+		found := map[mt.DiagnoseConversation_Kind]mt.DiagnoseConversation_Status{}
+		for _, check := range d.Checks() {
+			found[check.GetKind()] = check.GetStatus()
+		}
+		return found
+	}
+
+	group := &mt.Conversation{PublicKey: "group_pk", Type: mt.Conversation_MultiMemberType}
+	healthy := &ConversationDiagnosis{
+		Conversation:   group,
+		Activated:      true,
+		Streaming:      true,
+		Subscribed:     true,
+		Members:        []*mt.DiagnoseConversation_MemberState{{MemberPublicKey: "alice", Devices: 1, ReceivedFrom: true}},
+		ConnectedPeers: 2,
+	}
+	checks := healthy.Checks()
+	require.True(t, ChecksOK(checks))
+	for _, check := range checks {
+		require.Equal(t, mt.DiagnoseConversation_StatusOK, check.GetStatus(), check.GetKind().String())
+	}
+
+	// the contact check only applies to contact conversations
+	require.NotContains(t, statuses(healthy), mt.DiagnoseConversation_KindContactAccepted)
+
+	// nothing exchanged with a member and the messages are waiting
+	stalled := *healthy
+	stalled.Members = []*mt.DiagnoseConversation_MemberState{{MemberPublicKey: "alice", Devices: 1}, {MemberPublicKey: "bob", DisplayName: "Bob"}}
+	stalled.Queued, stalled.ConnectedPeers = 3, 0
+	found := statuses(&stalled)
+	require.Equal(t, mt.DiagnoseConversation_StatusWarning, found[mt.DiagnoseConversation_KindMemberDevices])
+	require.Equal(t, mt.DiagnoseConversation_StatusWarning, found[mt.DiagnoseConversation_KindSecretsExchanged])
+	require.Equal(t, mt.DiagnoseConversation_StatusWarning, found[mt.DiagnoseConversation_KindQueuedMessages])
+	require.Equal(t, mt.DiagnoseConversation_StatusWarning, found[mt.DiagnoseConversation_KindConnectedPeers])
+	require.True(t, ChecksOK(stalled.Checks()))
+
+	// no device known at all
+	deviceless := *healthy
+	deviceless.Members = []*mt.DiagnoseConversation_MemberState{{MemberPublicKey: "alice"}}
+	found = statuses(&deviceless)
+	require.Equal(t, mt.DiagnoseConversation_StatusError, found[mt.DiagnoseConversation_KindMemberDevices])
+	require.Equal(t, mt.DiagnoseConversation_StatusSkipped, found[mt.DiagnoseConversation_KindSecretsExchanged])
+
+	// the checks following an inactive group are skipped
+	inactive := *healthy
+	inactive.Activated, inactive.Subscribed = false, false
+	found = statuses(&inactive)
+	require.False(t, ChecksOK(inactive.Checks()))
+	require.Equal(t, mt.DiagnoseConversation_StatusError, found[mt.DiagnoseConversation_KindGroupActivated])
+	require.Equal(t, mt.DiagnoseConversation_StatusSkipped, found[mt.DiagnoseConversation_KindGroupSubscribed])
+	require.Equal(t, mt.DiagnoseConversation_StatusSkipped, found[mt.DiagnoseConversation_KindConnectedPeers])
+
+	// the subscriptions are paused in background
+	background := *healthy
+	background.Streaming, background.Subscribed = false, false
+	require.Equal(t, mt.DiagnoseConversation_StatusWarning, statuses(&background)[mt.DiagnoseConversation_KindGroupSubscribed])
+
+	blocked := &ConversationDiagnosis{
+		Conversation: &mt.Conversation{PublicKey: "contact_pk", Type: mt.Conversation_ContactType, Contact: &mt.Contact{State: mt.Contact_Blocked}},
+		Activated:    true,
+	}
+	found = statuses(blocked)
+	require.Equal(t, mt.DiagnoseConversation_StatusError, found[mt.DiagnoseConversation_KindContactAccepted])
+	require.Equal(t, mt.DiagnoseConversation_StatusSkipped, found[mt.DiagnoseConversation_KindGroupActivated])
+
+	pending := *blocked
+	pending.Conversation = &mt.Conversation{PublicKey: "contact_pk", Type: mt.Conversation_ContactType, Contact: &mt.Contact{State: mt.Contact_OutgoingRequestSent}}
+	require.Equal(t, mt.DiagnoseConversation_StatusWarning, statuses(&pending)[mt.DiagnoseConversation_KindContactAccepted])
+
+	unknown := &ConversationDiagnosis{}
+	checks = unknown.Checks()
+	require.Equal(t, mt.DiagnoseConversation_KindConversation, checks[0].GetKind())
+	require.Equal(t, mt.DiagnoseConversation_StatusError, checks[0].GetStatus())
+	for _, check := range checks[1:] {
+		require.Equal(t, mt.DiagnoseConversation_StatusSkipped, check.GetStatus())
+		require.Empty(t, check.GetAction())
+	}
+}
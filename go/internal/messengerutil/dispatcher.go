@@ -1,6 +1,8 @@
 package messengerutil
 
 import (
+	"time"
+
 	"github.com/gogo/protobuf/proto"
 
 	"berty.tech/berty/v2/go/pkg/errcode"
@@ -9,12 +11,50 @@ import (
 
 type Dispatcher interface {
 	StreamEvent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool) error
-	Notify(typ mt.StreamEvent_Notified_Type, title, body string, msg proto.Message) error
+	Notify(typ mt.StreamEvent_Notified_Type, title, body string, msg proto.Message, group *mt.StreamEvent_Notified_Group) error
 	IsEnabled() bool
 }
 
+// NotificationSnoozer tells whether the notifications are snoozed
+type NotificationSnoozer interface {
+	NotificationsSnoozed(now time.Time) (bool, error)
+}
+
+// NewNotifiedEvent builds the stream event of a notification, it is nil if
+// the notification is dropped because the notifications are snoozed. The
+// notifications of a conversation in focus mode are kept, and so are all of
+// them if snoozer is nil or fails.
+func NewNotifiedEvent(snoozer NotificationSnoozer, typ mt.StreamEvent_Notified_Type, title, body string, msg proto.Message, group *mt.StreamEvent_Notified_Group) (*mt.StreamEvent_Notified, error) {
+	// the notifications are dropped while snoozed, not delayed
+	now := time.Now()
+	focused := mt.IsFocusedNotification(msg, now)
+	if snoozer != nil && !focused {
+		if snoozed, err := snoozer.NotificationsSnoozed(now); err == nil && snoozed {
+			return nil, nil
+		}
+	}
+
+	var payload []byte
+	if msg != nil {
+		var err error
+		if payload, err = proto.Marshal(msg); err != nil {
+			return nil, errcode.ErrSerialization.Wrap(err)
+		}
+	}
+
+	return &mt.StreamEvent_Notified{
+		Title:   title,
+		Body:    body,
+		Type:    typ,
+		Payload: payload,
+		Group:   group,
+		Focused: focused,
+	}, nil
+}
+
 type AugmentedInteractionFetcher interface {
 	GetAugmentedInteraction(cid string) (*mt.Interaction, error)
+	GetPreviousInteractionCID(i *mt.Interaction) (string, error)
 }
 
 func StreamInteraction(dispatcher Dispatcher, db AugmentedInteractionFetcher, cid string, isNew bool) error {
@@ -23,9 +63,14 @@ func StreamInteraction(dispatcher Dispatcher, db AugmentedInteractionFetcher, ci
 		return errcode.ErrDBRead.Wrap(err)
 	}
 
+	previousCID, err := db.GetPreviousInteractionCID(interaction)
+	if err != nil {
+		return err
+	}
+
 	if err := dispatcher.StreamEvent(
 		mt.StreamEvent_TypeInteractionUpdated,
-		&mt.StreamEvent_InteractionUpdated{Interaction: interaction},
+		&mt.StreamEvent_InteractionUpdated{Interaction: interaction, PreviousCID: previousCID},
 		isNew,
 	); err != nil {
 		return errcode.ErrMessengerStreamEvent.Wrap(err)
@@ -40,7 +85,7 @@ func (*NoopDispatcher) StreamEvent(typ mt.StreamEvent_Type, msg proto.Message, i
 	return nil
 }
 
-func (*NoopDispatcher) Notify(typ mt.StreamEvent_Notified_Type, title, body string, msg proto.Message) error {
+func (*NoopDispatcher) Notify(typ mt.StreamEvent_Notified_Type, title, body string, msg proto.Message, group *mt.StreamEvent_Notified_Group) error {
 	return nil
 }
 
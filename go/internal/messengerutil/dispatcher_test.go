@@ -0,0 +1,52 @@
+package messengerutil
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+type testSnoozer struct {
+	snoozed bool
+	err     error
+}
+
+func (s testSnoozer) NotificationsSnoozed(time.Time) (bool, error) {
+	return s.snoozed, s.err
+}
+
+func TestNewNotifiedEvent(t *testing.T) {
+	msg := &mt.StreamEvent_Notified_MessageReceived{Conversation: &mt.Conversation{PublicKey: "conv"}}
+	group := &mt.StreamEvent_Notified_Group{ConversationPublicKey: "conv", Category: mt.StreamEvent_Notified_Group_CategoryMessage}
+
+	event, err := NewNotifiedEvent(nil, mt.StreamEvent_Notified_TypeMessageReceived, "title", "body", msg, group)
+	require.NoError(t, err)
+	require.Equal(t, "title", event.GetTitle())
+	require.Equal(t, "body", event.GetBody())
+	require.Equal(t, group, event.GetGroup())
+	require.False(t, event.GetFocused())
+
+	payload, err := event.UnmarshalPayload()
+	require.NoError(t, err)
+	require.Equal(t, "conv", payload.(*mt.StreamEvent_Notified_MessageReceived).GetConversation().GetPublicKey())
+
+	// dropped while snoozed
+	event, err = NewNotifiedEvent(testSnoozer{snoozed: true}, mt.StreamEvent_Notified_TypeMessageReceived, "title", "body", msg, group)
+	require.NoError(t, err)
+	require.Nil(t, event)
+
+	// kept if the snooze state is unknown
+	event, err = NewNotifiedEvent(testSnoozer{err: fmt.Errorf("db closed")}, mt.StreamEvent_Notified_TypeMessageReceived, "title", "body", msg, group)
+	require.NoError(t, err)
+	require.NotNil(t, event)
+
+	// kept while snoozed if the conversation is in focus mode
+	focused := &mt.StreamEvent_Notified_MessageReceived{Conversation: &mt.Conversation{PublicKey: "conv", FocusedUntil: TimestampMs(time.Now().Add(time.Hour))}}
+	event, err = NewNotifiedEvent(testSnoozer{snoozed: true}, mt.StreamEvent_Notified_TypeMessageReceived, "title", "body", focused, group)
+	require.NoError(t, err)
+	require.True(t, event.GetFocused())
+}
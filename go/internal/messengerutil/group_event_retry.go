@@ -0,0 +1,139 @@
+package messengerutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// DefaultGroupEventAttempts is the number of times an event failing with
+	// a retryable error, such as a handler timing out, is handled
+	DefaultGroupEventAttempts = 3
+
+	defaultGroupEventRetryBackoff = time.Second
+)
+
+// ReplayCheckpointStore records the last events handled on the streams of
+// the groups
+type ReplayCheckpointStore interface {
+	SetReplayMetadataCheckpoint(groupPK string, eventID []byte, date int64) error
+	SetReplayMessageCheckpoint(groupPK string, eventID []byte, date int64) error
+}
+
+// GroupEventRetrier handles the group events again, with a backoff, while they
+// fail with a retryable error and advances the replay checkpoints of their
+// streams. The checkpoint of a stream stops advancing once one of its events
+// is given up on a retryable error, so the next replay handles it again
+// instead of skipping it.
+type GroupEventRetrier struct {
+	store    ReplayCheckpointStore
+	logger   *zap.Logger
+	attempts int
+	backoff  time.Duration
+
+	mutex sync.Mutex
+	held  map[string]bool
+}
+
+func NewGroupEventRetrier(store ReplayCheckpointStore, logger *zap.Logger, attempts int, backoff time.Duration) *GroupEventRetrier {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if attempts <= 0 {
+		attempts = DefaultGroupEventAttempts
+	}
+
+	if backoff <= 0 {
+		backoff = defaultGroupEventRetryBackoff
+	}
+
+	return &GroupEventRetrier{
+		store:    store,
+		logger:   logger,
+		attempts: attempts,
+		backoff:  backoff,
+		held:     make(map[string]bool),
+	}
+}
+
+// Handle runs handle for evt until it succeeds, fails with a permanent error,
+// runs out of attempts or ctx is done, the last error is returned. The events
+// failing because the handler is closed are neither retried nor checkpointed,
+// they are delivered again on the next start.
+func (r *GroupEventRetrier) Handle(ctx context.Context, evt *GroupEvent, handle func() error) error {
+	backoff := r.backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = handle(); err == nil || !IsRetryableError(err) {
+			break
+		}
+
+		if errcode.Is(err, errcode.ErrMessengerHandlerClosed) {
+			return err
+		}
+
+		if attempt >= r.attempts || ctx.Err() != nil {
+			r.hold(evt, err)
+			return err
+		}
+
+		r.logger.Debug("handling group event again", logutil.PrivateString("group-pk", B64EncodeBytes(evt.GroupPK)), zap.Int("attempt", attempt), zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			r.hold(evt, err)
+			return err
+		}
+
+		backoff *= 2
+	}
+
+	r.checkpoint(evt)
+	return err
+}
+
+// hold stops the checkpoint of the stream of evt from advancing
+func (r *GroupEventRetrier) hold(evt *GroupEvent, err error) {
+	r.mutex.Lock()
+	r.held[evt.streamKey()] = true
+	r.mutex.Unlock()
+
+	r.logger.Warn("giving up group event, holding its replay checkpoint", logutil.PrivateString("group-pk", B64EncodeBytes(evt.GroupPK)), zap.String("stream", evt.streamName()), zap.Error(err))
+}
+
+// checkpoint records evt as the last event handled on its stream unless the
+// stream is held
+func (r *GroupEventRetrier) checkpoint(evt *GroupEvent) {
+	r.mutex.Lock()
+	held := r.held[evt.streamKey()]
+	r.mutex.Unlock()
+
+	eventID := evt.ID()
+	if held || len(eventID) == 0 {
+		return
+	}
+
+	groupPK, now := B64EncodeBytes(evt.GroupPK), TimestampMs(time.Now())
+
+	var err error
+	if evt.Message != nil {
+		err = r.store.SetReplayMessageCheckpoint(groupPK, eventID, now)
+	} else {
+		err = r.store.SetReplayMetadataCheckpoint(groupPK, eventID, now)
+	}
+
+	if err != nil {
+		r.logger.Warn("unable to record replay checkpoint", logutil.PrivateString("group-pk", groupPK), zap.Error(err))
+	}
+}
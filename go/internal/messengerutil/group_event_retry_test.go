@@ -0,0 +1,132 @@
+package messengerutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+type testCheckpointStore struct {
+	mutex    sync.Mutex
+	metadata map[string][]byte
+	message  map[string][]byte
+}
+
+func newTestCheckpointStore() *testCheckpointStore {
+	return &testCheckpointStore{metadata: map[string][]byte{}, message: map[string][]byte{}}
+}
+
+func (s *testCheckpointStore) SetReplayMetadataCheckpoint(groupPK string, eventID []byte, _ int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.metadata[groupPK] = eventID
+	return nil
+}
+
+func (s *testCheckpointStore) SetReplayMessageCheckpoint(groupPK string, eventID []byte, _ int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.message[groupPK] = eventID
+	return nil
+}
+
+func testMessageEvent(groupPK []byte, id string) *GroupEvent {
+	return &GroupEvent{GroupPK: groupPK, Message: &protocoltypes.GroupMessageEvent{EventContext: &protocoltypes.EventContext{ID: []byte(id)}}}
+}
+
+func TestGroupEventRetrier_HandledAgain(t *testing.T) {
+	store := newTestCheckpointStore()
+	retrier := NewGroupEventRetrier(store, nil, 3, time.Millisecond)
+	groupPK := []byte("group")
+	key := B64EncodeBytes(groupPK)
+
+	// the event timing out is handled again until it succeeds
+	calls := 0
+	err := retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_1"), func() error {
+		calls++
+		if calls == 1 {
+			return errcode.ErrMessengerHandlerTimeout.Wrap(fmt.Errorf("timed out"))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, calls)
+	require.Equal(t, []byte("evt_1"), store.message[key])
+
+	// a permanent error isn't retried, the event won't be handled better later
+	calls = 0
+	err = retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_2"), func() error {
+		calls++
+		return errcode.ErrDeserialization
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, []byte("evt_2"), store.message[key])
+
+	// the handler closing is neither retried nor checkpointed
+	calls = 0
+	err = retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_3"), func() error {
+		calls++
+		return errcode.ErrMessengerHandlerClosed
+	})
+	require.True(t, errcode.Is(err, errcode.ErrMessengerHandlerClosed))
+	require.Equal(t, 1, calls)
+	require.Equal(t, []byte("evt_2"), store.message[key])
+}
+
+func TestGroupEventRetrier_HoldCheckpoint(t *testing.T) {
+	store := newTestCheckpointStore()
+	retrier := NewGroupEventRetrier(store, nil, 2, time.Millisecond)
+	groupPK := []byte("group")
+	key := B64EncodeBytes(groupPK)
+
+	require.NoError(t, retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_1"), func() error { return nil }))
+	require.Equal(t, []byte("evt_1"), store.message[key])
+
+	calls := 0
+	err := retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_2"), func() error {
+		calls++
+		return errcode.ErrMessengerHandlerTimeout
+	})
+	require.True(t, errcode.Is(err, errcode.ErrMessengerHandlerTimeout))
+	require.Equal(t, 2, calls)
+
+	// the following events of the stream don't move the checkpoint past the
+	// event given up, it is replayed after a restart
+	require.NoError(t, retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_3"), func() error { return nil }))
+	require.Equal(t, []byte("evt_1"), store.message[key])
+
+	// the other streams are not held
+	metadata := &GroupEvent{GroupPK: groupPK, Metadata: &protocoltypes.GroupMetadataEvent{EventContext: &protocoltypes.EventContext{ID: []byte("meta_1")}}}
+	require.NoError(t, retrier.Handle(context.Background(), metadata, func() error { return nil }))
+	require.Equal(t, []byte("meta_1"), store.metadata[key])
+
+	other := []byte("other")
+	require.NoError(t, retrier.Handle(context.Background(), testMessageEvent(other, "evt_4"), func() error { return nil }))
+	require.Equal(t, []byte("evt_4"), store.message[B64EncodeBytes(other)])
+}
+
+func TestGroupEventRetrier_ContextDone(t *testing.T) {
+	store := newTestCheckpointStore()
+	retrier := NewGroupEventRetrier(store, nil, 10, time.Hour)
+	groupPK := []byte("group")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := retrier.Handle(ctx, testMessageEvent(groupPK, "evt_1"), func() error { return errcode.ErrDBWrite })
+	require.True(t, errcode.Is(err, errcode.ErrDBWrite))
+
+	require.NoError(t, retrier.Handle(context.Background(), testMessageEvent(groupPK, "evt_2"), func() error { return nil }))
+	require.Empty(t, store.message)
+}
@@ -0,0 +1,43 @@
+package messengerutil
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// GroupInvitationPreview returns what a group invitation link tells about its
+// group, an encrypted link is previewed from its clear fields when passphrase
+// is nil
+func GroupInvitationPreview(link string, passphrase []byte) (*mt.GroupInvitationPreview, error) {
+	if link == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a group link is required"))
+	}
+
+	parsed, err := bertylinks.UnmarshalLink(link, passphrase)
+	if err != nil {
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+	}
+
+	preview := &mt.GroupInvitationPreview{ExpiresAt: parsed.GetExpiresAt()}
+	switch {
+	case parsed.IsGroup():
+		group := parsed.GetBertyGroup()
+		preview.GroupPublicKey = B64EncodeBytes(group.GetGroup().GetPublicKey())
+		preview.DisplayName = group.GetDisplayName()
+		preview.Description = group.GetDescription()
+		preview.AvatarCID = group.GetAvatarCID()
+	case parsed.GetKind() == mt.BertyLink_EncryptedV1Kind && parsed.GetEncrypted().GetKind() == mt.BertyLink_GroupV1Kind:
+		encrypted := parsed.GetEncrypted()
+		preview.Encrypted = true
+		preview.DisplayName = encrypted.GetDisplayName()
+		preview.Description = encrypted.GetGroupDescription()
+		preview.AvatarCID = encrypted.GetGroupAvatarCID()
+	default:
+		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(fmt.Errorf("not a group link: %s", parsed.GetKind()))
+	}
+
+	return preview, nil
+}
@@ -0,0 +1,60 @@
+package messengerutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/bertylinks"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+func TestGroupInvitationPreview(t *testing.T) {
+	pk := []byte("group_public_key_of_32_bytes_abc")
+	group := &mt.BertyGroup{
+		Group:       &protocoltypes.Group{PublicKey: pk, Secret: make([]byte, 32), SecretSig: make([]byte, 64), GroupType: protocoltypes.GroupTypeMultiMember, SignPub: make([]byte, 32)},
+		DisplayName: "friends",
+		Description: "the usual",
+		AvatarCID:   "avatar",
+	}
+	link := &mt.BertyLink{Kind: mt.BertyLink_GroupV1Kind, BertyGroup: group, ExpiresAt: 42}
+
+	raw, _, err := bertylinks.MarshalLink(link)
+	require.NoError(t, err)
+	preview, err := GroupInvitationPreview(raw, nil)
+	require.NoError(t, err)
+	require.Equal(t, B64EncodeBytes(pk), preview.GetGroupPublicKey())
+	require.Equal(t, "friends", preview.GetDisplayName())
+	require.Equal(t, "the usual", preview.GetDescription())
+	require.Equal(t, "avatar", preview.GetAvatarCID())
+	require.Equal(t, int64(42), preview.GetExpiresAt())
+	require.False(t, preview.GetEncrypted())
+
+	// only the clear fields are known without the passphrase
+	encrypted, err := bertylinks.EncryptLink(link, []byte("secret"))
+	require.NoError(t, err)
+	raw, _, err = bertylinks.MarshalLink(encrypted)
+	require.NoError(t, err)
+	preview, err = GroupInvitationPreview(raw, nil)
+	require.NoError(t, err)
+	require.True(t, preview.GetEncrypted())
+	require.Empty(t, preview.GetGroupPublicKey())
+	require.Equal(t, "friends", preview.GetDisplayName())
+	require.Equal(t, "the usual", preview.GetDescription())
+
+	preview, err = GroupInvitationPreview(raw, []byte("secret"))
+	require.NoError(t, err)
+	require.False(t, preview.GetEncrypted())
+	require.Equal(t, B64EncodeBytes(pk), preview.GetGroupPublicKey())
+
+	id := &mt.BertyID{DisplayName: "alice", AccountPK: make([]byte, 32), PublicRendezvousSeed: make([]byte, 32)}
+	raw, _, err = bertylinks.MarshalLink(id.GetBertyLink())
+	require.NoError(t, err)
+	_, err = GroupInvitationPreview(raw, nil)
+	require.Equal(t, errcode.ErrMessengerInvalidDeepLink, errcode.Code(err))
+
+	_, err = GroupInvitationPreview("", nil)
+	require.Equal(t, errcode.ErrMissingInput, errcode.Code(err))
+}
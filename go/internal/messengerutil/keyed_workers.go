@@ -0,0 +1,106 @@
+package messengerutil
+
+import (
+	"sync"
+)
+
+// DefaultGroupEventWorkers is the number of groups whose events can be
+// handled at the same time
+const DefaultGroupEventWorkers = 4
+
+// KeyedWorkers runs tasks on a bounded pool of goroutines. The tasks sharing a
+// key run one at a time in the order they were submitted, the tasks of
+// different keys run in parallel. The keys waiting for a worker take turns, so
+// a key having many tasks queued can't delay the others by more than one task.
+type KeyedWorkers struct {
+	mutex   sync.Mutex
+	queues  map[string][]func()
+	ready   []string
+	closed  bool
+	wake    *sync.Cond
+	running sync.WaitGroup
+}
+
+// NewKeyedWorkers starts size workers, they run until Close is called
+func NewKeyedWorkers(size int) *KeyedWorkers {
+	if size <= 0 {
+		size = DefaultGroupEventWorkers
+	}
+
+	w := &KeyedWorkers{queues: make(map[string][]func())}
+	w.wake = sync.NewCond(&w.mutex)
+
+	w.running.Add(size)
+	for i := 0; i < size; i++ {
+		go w.work()
+	}
+
+	return w
+}
+
+// Submit queues task after the other tasks of key, it never waits for the
+// task to run. It returns false if the workers are closed.
+func (w *KeyedWorkers) Submit(key string, task func()) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return false
+	}
+
+	queue, known := w.queues[key]
+	w.queues[key] = append(queue, task)
+
+	// a key is either ready or being run while it is known, it will be made
+	// ready again once its running task is done
+	if !known {
+		w.ready = append(w.ready, key)
+		w.wake.Signal()
+	}
+
+	return true
+}
+
+// Close stops accepting tasks, runs the tasks already queued then waits for
+// the workers to exit
+func (w *KeyedWorkers) Close() {
+	w.mutex.Lock()
+	w.closed = true
+	w.wake.Broadcast()
+	w.mutex.Unlock()
+
+	w.running.Wait()
+}
+
+func (w *KeyedWorkers) work() {
+	defer w.running.Done()
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for {
+		for len(w.ready) == 0 {
+			if w.closed {
+				return
+			}
+			w.wake.Wait()
+		}
+
+		key := w.ready[0]
+		w.ready = w.ready[1:]
+		task := w.queues[key][0]
+
+		w.mutex.Unlock()
+		task()
+		w.mutex.Lock()
+
+		// the key goes back at the end of the line if it has more tasks
+		if queue := w.queues[key][1:]; len(queue) > 0 {
+			w.queues[key] = queue
+			w.ready = append(w.ready, key)
+			w.wake.Signal()
+		} else {
+			delete(w.queues, key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package messengerutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedWorkers(t *testing.T) {
+	w := NewKeyedWorkers(2)
+
+	mutex := sync.Mutex{}
+	order := map[string][]int{}
+	record := func(key string, i int) func() {
+		return func() {
+			mutex.Lock()
+			order[key] = append(order[key], i)
+			mutex.Unlock()
+		}
+	}
+
+	// a busy key doesn't hold the other keys back
+	blocked := make(chan struct{})
+	require.True(t, w.Submit("busy", func() { <-blocked }))
+	for i := 0; i < 10; i++ {
+		require.True(t, w.Submit("busy", record("busy", i)))
+	}
+
+	done := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		require.True(t, w.Submit("other", record("other", i)))
+	}
+	require.True(t, w.Submit("other", func() { close(done) }))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.FailNow(t, "the other key was held back")
+	}
+
+	mutex.Lock()
+	require.Empty(t, order["busy"])
+	mutex.Unlock()
+
+	// the tasks of a key run in order, the queued ones run on close
+	close(blocked)
+	w.Close()
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order["busy"])
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, order["other"])
+
+	require.False(t, w.Submit("busy", func() {}))
+}
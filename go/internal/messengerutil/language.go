@@ -0,0 +1,135 @@
+package messengerutil
+
+import (
+	"strings"
+	"unicode"
+)
+
+// languageScripts are the scripts written in a single common language
+var languageScripts = []struct {
+	language string
+	script   *unicode.RangeTable
+}{
+	{"ko", unicode.Hangul},
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"zh", unicode.Han},
+	{"ru", unicode.Cyrillic},
+	{"ar", unicode.Arabic},
+	{"he", unicode.Hebrew},
+	{"el", unicode.Greek},
+	{"th", unicode.Thai},
+	{"hi", unicode.Devanagari},
+}
+
+// latinStopWords are the most common words of the languages written with the
+// latin script, the words shared by several of them are left out
+var latinStopWords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "to", "of", "it", "that", "this", "with", "have", "what", "was", "my", "your", "i'm", "be"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "je", "tu", "vous", "pas", "pour", "avec", "dans", "ce", "qui", "sur", "c'est", "merci", "oui"},
+	"es": {"el", "los", "las", "y", "es", "está", "por", "con", "pero", "muy", "hola", "gracias", "yo", "tengo", "qué", "sí", "del"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "du", "mit", "ein", "eine", "auf", "für", "wir", "sie", "auch", "danke", "ja"},
+	"it": {"il", "gli", "è", "che", "non", "sono", "ciao", "grazie", "della", "questo", "anche", "come", "ho", "sei"},
+	"pt": {"os", "não", "você", "obrigado", "obrigada", "muito", "isso", "eu", "tudo", "bem", "estou", "com", "uma", "é"},
+	"nl": {"het", "een", "en", "niet", "ik", "jij", "van", "dat", "met", "voor", "zijn", "wat", "ook", "bedankt", "hoi"},
+}
+
+var latinStopWordLanguages = func() map[string][]string {
+	languages := map[string][]string{}
+	for language, words := range latinStopWords {
+		for _, word := range words {
+			languages[word] = append(languages[word], language)
+		}
+	}
+	return languages
+}()
+
+// InferLanguage returns the ISO 639-1 code of the language texts are mostly
+// written in, it is empty if it can't be told. The texts never leave the
+// device: the languages having a script of their own are recognized by it,
+// the latin ones by their most common words.
+func InferLanguage(texts ...string) string {
+	scripts := map[string]int{}
+	latinLetters, letters := 0, 0
+	words := map[string]int{}
+
+	for _, text := range texts {
+		for _, r := range text {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			letters++
+
+			if unicode.Is(unicode.Latin, r) {
+				latinLetters++
+				continue
+			}
+			for _, ls := range languageScripts {
+				if unicode.Is(ls.script, r) {
+					scripts[ls.language]++
+					break
+				}
+			}
+		}
+
+		for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && r != '\'' }) {
+			for _, language := range latinStopWordLanguages[word] {
+				words[language]++
+			}
+		}
+	}
+
+	if letters == 0 {
+		return ""
+	}
+
+	// the kanji are written along with the kanas
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+
+	if language, count := bestScore(scripts); count*2 > letters {
+		return language
+	}
+
+	if latinLetters*2 <= letters {
+		return ""
+	}
+
+	language, count := bestScore(words)
+	if count < 2 {
+		return ""
+	}
+	for other, otherCount := range words {
+		if other != language && otherCount*2 > count {
+			return ""
+		}
+	}
+
+	return language
+}
+
+// SameLanguage returns true if the two language codes share their primary
+// subtag, so "en-US" is the same language as "en"
+func SameLanguage(a, b string) bool {
+	primary := func(tag string) string {
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			tag = tag[:i]
+		}
+		return strings.ToLower(tag)
+	}
+
+	return a != "" && primary(a) == primary(b)
+}
+
+func bestScore(scores map[string]int) (string, int) {
+	best, bestCount := "", 0
+	for key, count := range scores {
+		if count > bestCount || count == bestCount && key < best {
+			best, bestCount = key, count
+		}
+	}
+
+	return best, bestCount
+}
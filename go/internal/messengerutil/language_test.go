@@ -0,0 +1,50 @@
+package messengerutil
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInferLanguage(t *testing.T) {
+	cases := []struct {
+		texts    []string
+		expected string
+	}{
+		{[]string{"Hello, how are you? I hope that the trip was good"}, "en"},
+		{[]string{"Salut, je suis en route", "merci pour le message"}, "fr"},
+		{[]string{"Hola, ¿qué tal? Muy bien, gracias"}, "es"},
+		{[]string{"Ich bin nicht da, danke"}, "de"},
+		{[]string{"Ciao, come sei? Sono a casa"}, "it"},
+		{[]string{"Tudo bem? Muito obrigado"}, "pt"},
+		{[]string{"Hoi, ik ben er niet, bedankt"}, "nl"},
+		{[]string{"안녕하세요"}, "ko"},
+		{[]string{"こんにちは、元気ですか"}, "ja"},
+		{[]string{"你好，你今天好吗"}, "zh"},
+		{[]string{"Привет, как дела?"}, "ru"},
+		{[]string{"مرحبا كيف حالك"}, "ar"},
+		{[]string{"שלום מה שלומך"}, "he"},
+		{[]string{"Γεια σου τι κάνεις"}, "el"},
+		{[]string{"สวัสดีครับ"}, "th"},
+		{[]string{"नमस्ते आप कैसे हैं"}, "hi"},
+
+		// not enough to tell
+		{nil, ""},
+		{[]string{"👍 123 !!"}, ""},
+		{[]string{"ok"}, ""},
+		{[]string{"the merci"}, ""},
+	}
+
+	for _, c := range cases {
+		require.Equal(t, c.expected, InferLanguage(c.texts...), c.texts)
+	}
+}
+
+func TestSameLanguage(t *testing.T) {
+	require.True(t, SameLanguage("en", "en"))
+	require.True(t, SameLanguage("en-US", "EN"))
+	require.True(t, SameLanguage("pt_BR", "pt-PT"))
+	require.False(t, SameLanguage("en", "fr"))
+	require.False(t, SameLanguage("", ""))
+	require.False(t, SameLanguage("en", ""))
+}
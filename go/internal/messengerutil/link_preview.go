@@ -0,0 +1,110 @@
+package messengerutil
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	linkPreviewMaxTitleLength       = 256
+	linkPreviewMaxDescriptionLength = 1024
+)
+
+// ParseLinkPreview reads the metadata of the page at pageURL from the head of
+// its html, the Open Graph properties are preferred to the html title and
+// description. The preview is marked failed if the page has no title.
+func ParseLinkPreview(r io.Reader, pageURL string) *mt.LinkPreview {
+	preview := &mt.LinkPreview{URL: pageURL}
+	title, description := "", ""
+
+	z := html.NewTokenizer(r)
+	for inTitle := false; ; {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+
+		if tt == html.TextToken && inTitle && title == "" {
+			title = string(z.Text())
+			continue
+		}
+
+		tok := z.Token()
+		if tok.DataAtom == atom.Title {
+			inTitle = tt == html.StartTagToken
+			continue
+		}
+
+		// the metadata is in the head
+		if tok.DataAtom == atom.Body || (tok.DataAtom == atom.Head && tt == html.EndTagToken) {
+			break
+		}
+
+		if tok.DataAtom != atom.Meta {
+			continue
+		}
+
+		key, content := "", ""
+		for _, attr := range tok.Attr {
+			switch strings.ToLower(attr.Key) {
+			case "property", "name":
+				key = strings.ToLower(attr.Val)
+			case "content":
+				content = attr.Val
+			}
+		}
+
+		switch key {
+		case "og:title":
+			preview.Title = content
+		case "og:description":
+			preview.Description = content
+		case "description":
+			description = content
+		case "og:image":
+			preview.ImageURL = resolveLinkPreviewURL(pageURL, content)
+		}
+	}
+
+	if preview.Title == "" {
+		preview.Title = title
+	}
+	if preview.Description == "" {
+		preview.Description = description
+	}
+
+	preview.Title = truncateLinkPreviewText(preview.Title, linkPreviewMaxTitleLength)
+	preview.Description = truncateLinkPreviewText(preview.Description, linkPreviewMaxDescriptionLength)
+	preview.Failed = preview.Title == ""
+
+	return preview
+}
+
+func resolveLinkPreviewURL(pageURL, ref string) string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return ""
+	}
+
+	u, err := base.Parse(strings.TrimSpace(ref))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+
+	return u.String()
+}
+
+func truncateLinkPreviewText(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max])
+	}
+
+	return text
+}
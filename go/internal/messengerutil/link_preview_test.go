@@ -0,0 +1,39 @@
+package messengerutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLinkPreview(t *testing.T) {
+	page := `<!DOCTYPE html><html><head>
+		<title>  Page
+		title </title>
+		<meta name="description" content="page description">
+		<meta property="og:image" content="/img/cover.png">
+		</head><body><meta property="og:title" content="ignored"></body></html>`
+
+	preview := ParseLinkPreview(strings.NewReader(page), "https://example.com/a/b")
+	require.False(t, preview.Failed)
+	require.Equal(t, "https://example.com/a/b", preview.URL)
+	require.Equal(t, "Page title", preview.Title)
+	require.Equal(t, "page description", preview.Description)
+	require.Equal(t, "https://example.com/img/cover.png", preview.ImageURL)
+
+	// the open graph properties are preferred
+	page = `<html><head><title>title</title>
+		<meta property="og:title" content="og title">
+		<meta property="og:description" content="og description">
+		<meta name="description" content="description">
+		<meta property="og:image" content="javascript:alert(1)">`
+
+	preview = ParseLinkPreview(strings.NewReader(page), "https://example.com")
+	require.Equal(t, "og title", preview.Title)
+	require.Equal(t, "og description", preview.Description)
+	require.Empty(t, preview.ImageURL)
+
+	preview = ParseLinkPreview(strings.NewReader("not html"), "https://example.com")
+	require.True(t, preview.Failed)
+}
@@ -0,0 +1,79 @@
+package messengerutil
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	ipfscid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	// WallpaperMaxSize is the maximum size of a conversation wallpaper
+	WallpaperMaxSize = 4 * 1024 * 1024
+	// NotificationSoundMaxSize is the maximum size of a conversation
+	// notification sound
+	NotificationSoundMaxSize = 1024 * 1024
+	// StagedMediaMaxSize is the maximum size of an attachment staged before
+	// being sent
+	StagedMediaMaxSize = 16 * 1024 * 1024
+)
+
+// NewWallpaperMedia checks that raw is an image and wraps it in a media
+func NewWallpaperMedia(raw []byte) (*mt.Media, error) {
+	return newLocalMedia(raw, WallpaperMaxSize, "wallpaper", func(mimeType string) bool {
+		return strings.HasPrefix(mimeType, "image/")
+	})
+}
+
+// NewNotificationSoundMedia checks that raw is an audio file and wraps it in a
+// media
+func NewNotificationSoundMedia(raw []byte) (*mt.Media, error) {
+	return newLocalMedia(raw, NotificationSoundMaxSize, "notification sound", func(mimeType string) bool {
+		return strings.HasPrefix(mimeType, "audio/") || mimeType == "application/ogg"
+	})
+}
+
+// NewStagedMedia wraps an attachment of any type in a media
+func NewStagedMedia(raw []byte) (*mt.Media, error) {
+	return newLocalMedia(raw, StagedMediaMaxSize, "attachment", func(string) bool { return true })
+}
+
+// LocalMediaCID returns the cid of a media which is never shared, it only
+// depends on its content
+func LocalMediaCID(raw []byte) (string, error) {
+	cid, err := ipfscid.Prefix{Version: 1, Codec: ipfscid.Raw, MhType: multihash.SHA2_256, MhLength: -1}.Sum(raw)
+	if err != nil {
+		return "", errcode.ErrInternal.Wrap(err)
+	}
+
+	return cid.String(), nil
+}
+
+// newLocalMedia builds a media which is never shared, its CID is computed
+// locally instead of adding it to IPFS
+func newLocalMedia(raw []byte, maxSize int, name string, accept func(mimeType string) bool) (*mt.Media, error) {
+	if len(raw) == 0 {
+		return nil, errcode.ErrMissingInput
+	}
+
+	if len(raw) > maxSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s is too large: %d bytes, max is %d", name, len(raw), maxSize))
+	}
+
+	mimeType := http.DetectContentType(raw)
+	if !accept(mimeType) {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unsupported %s type: %s", name, mimeType))
+	}
+
+	cid, err := LocalMediaCID(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.Media{CID: cid, MimeType: mimeType, Data: raw}, nil
+}
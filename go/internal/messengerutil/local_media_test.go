@@ -0,0 +1,49 @@
+package messengerutil
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestNewLocalMedia(t *testing.T) {
+	_, err := NewWallpaperMedia(nil)
+	require.Equal(t, errcode.ErrMissingInput, errcode.Code(err))
+
+	_, err = NewWallpaperMedia(make([]byte, WallpaperMaxSize+1))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+
+	raw := new(bytes.Buffer)
+	require.NoError(t, png.Encode(raw, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+
+	wallpaper, err := NewWallpaperMedia(raw.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, "image/png", wallpaper.MimeType)
+	require.NotEmpty(t, wallpaper.CID)
+
+	// the cid only depends on the content
+	again, err := NewWallpaperMedia(raw.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, wallpaper.CID, again.CID)
+
+	// an image isn't a sound
+	_, err = NewNotificationSoundMedia(raw.Bytes())
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+
+	sound, err := NewNotificationSoundMedia(append([]byte("ID3"), make([]byte, 32)...))
+	require.NoError(t, err)
+	require.Equal(t, "audio/mpeg", sound.MimeType)
+
+	// any attachment can be staged
+	staged, err := NewStagedMedia([]byte("%PDF-1.4"))
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", staged.MimeType)
+
+	_, err = NewStagedMedia(make([]byte, StagedMediaMaxSize+1))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(err))
+}
@@ -0,0 +1,147 @@
+package messengerutil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// InteractionPayloadMaxSize is the maximum size of the payload of an interaction sent
+const InteractionPayloadMaxSize = mt.InteractionPayloadMaxSize
+
+// IsLocalOnlyType returns true for the types of interaction which are only
+// generated locally and can't be sent
+func IsLocalOnlyType(typ mt.AppMessage_Type) bool {
+	return typ == mt.AppMessage_TypeCallLog || typ == mt.AppMessage_TypeSystemMessage
+}
+
+// RequiresTarget returns true for the types of interaction which apply to the
+// interaction they target
+func RequiresTarget(typ mt.AppMessage_Type) bool {
+	switch typ {
+	case mt.AppMessage_TypeUserMessageEdit,
+		mt.AppMessage_TypeMessageRetract,
+		mt.AppMessage_TypePinMessage,
+		mt.AppMessage_TypePollVote,
+		mt.AppMessage_TypeCalendarEventRSVP:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValidateInteractionPayload checks the payload of an interaction before it is
+// sent, the types without constraints are always valid
+func ValidateInteractionPayload(payload proto.Message) error {
+	switch p := payload.(type) {
+	case mt.CallSignalingPayload:
+		return p.Validate()
+	case *mt.AppMessage_UserMessage:
+		return p.ValidateMentions()
+	case *mt.AppMessage_ContactShare:
+		_, err := ContactShareLink(p)
+		return err
+	case *mt.AppMessage_Poll:
+		return p.Validate()
+	case *mt.AppMessage_CalendarEvent:
+		return p.Validate()
+	case *mt.AppMessage_CalendarEventRSVP:
+		return p.Validate()
+	case *mt.AppMessage_Location:
+		return p.Validate()
+	case *mt.AppMessage_LiveLocation:
+		return p.Validate()
+	case *mt.AppMessage_SetEphemeralPolicy:
+		return p.Validate()
+	case *mt.AppMessage_SetSlowMode:
+		return p.Validate()
+	default:
+		return nil
+	}
+}
+
+// IsSlowModeLimited returns true for the types of interaction the slow mode of
+// a conversation applies to, the ones posting something new
+func IsSlowModeLimited(typ mt.AppMessage_Type) bool {
+	switch typ {
+	case mt.AppMessage_TypeUserMessage,
+		mt.AppMessage_TypeGroupInvitation,
+		mt.AppMessage_TypePoll,
+		mt.AppMessage_TypeLocation,
+		mt.AppMessage_TypeContactShare,
+		mt.AppMessage_TypeCalendarEvent:
+		return true
+	default:
+		return false
+	}
+}
+
+func isEmptyPayload(payload proto.Message) bool {
+	switch p := payload.(type) {
+	case *mt.AppMessage_UserMessage:
+		return strings.TrimSpace(p.GetBody()) == "" && p.GetForwardedFrom() == nil
+	case *mt.AppMessage_UserMessageEdit:
+		return strings.TrimSpace(p.GetBody()) == ""
+	default:
+		return false
+	}
+}
+
+// PendingMessageIssues lists the reasons preventing a draft from being sent
+// in conv, conv is nil if the conversation is unknown. The contact of a
+// contact conversation must be set.
+func PendingMessageIssues(conv *mt.Conversation, req *mt.ValidatePendingMessage_Request) []*mt.ValidatePendingMessage_Issue {
+	issues := []*mt.ValidatePendingMessage_Issue(nil)
+	addIssue := func(reason mt.ValidatePendingMessage_Reason, format string, args ...interface{}) {
+		issues = append(issues, &mt.ValidatePendingMessage_Issue{Reason: reason, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	typeName := strings.TrimPrefix(req.GetType().String(), "Type")
+
+	switch {
+	case req.GetConversationPublicKey() == mt.SystemConversationPublicKey || conv.GetType() == mt.Conversation_SystemType:
+		addIssue(mt.ValidatePendingMessage_ReasonSystemConversation, "nothing can be sent in the system conversation")
+	case conv == nil:
+		addIssue(mt.ValidatePendingMessage_ReasonUnknownConversation, "unknown conversation")
+	case conv.GetLeftDate() > 0:
+		addIssue(mt.ValidatePendingMessage_ReasonConversationLeft, "the conversation was left, it is a read-only archive")
+	case conv.GetType() == mt.Conversation_ContactType:
+		switch conv.GetContact().GetState() {
+		case mt.Contact_Blocked:
+			addIssue(mt.ValidatePendingMessage_ReasonContactBlocked, "the contact is blocked")
+		case mt.Contact_Removed:
+			addIssue(mt.ValidatePendingMessage_ReasonContactRemoved, "a new contact request is needed to talk to the contact")
+		}
+	}
+
+	if IsLocalOnlyType(req.GetType()) {
+		addIssue(mt.ValidatePendingMessage_ReasonLocalOnlyType, "%s interactions are generated locally", typeName)
+	}
+
+	if RequiresTarget(req.GetType()) && req.GetTargetCID() == "" {
+		addIssue(mt.ValidatePendingMessage_ReasonMissingTarget, "a %s requires the cid of the targeted message", typeName)
+	}
+
+	if len(req.GetPayload()) > InteractionPayloadMaxSize {
+		addIssue(mt.ValidatePendingMessage_ReasonPayloadTooLarge, "payload is too large: %d bytes, max is %d", len(req.GetPayload()), InteractionPayloadMaxSize)
+		return issues
+	}
+
+	payload, err := (&mt.AppMessage{Type: req.GetType(), Payload: req.GetPayload()}).UnmarshalPayload()
+	switch {
+	case err != nil:
+		addIssue(mt.ValidatePendingMessage_ReasonInvalidPayload, "%s", errcode.ErrInvalidInput.Wrap(err))
+	case isEmptyPayload(payload):
+		addIssue(mt.ValidatePendingMessage_ReasonEmptyMessage, "the message is empty")
+	default:
+		if err := ValidateInteractionPayload(payload); err != nil {
+			addIssue(mt.ValidatePendingMessage_ReasonInvalidPayload, "%s", err)
+		}
+	}
+
+	return issues
+}
@@ -0,0 +1,43 @@
+package messengerutil
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestPendingMessageIssues(t *testing.T) {
+	reasons := func(conv *mt.Conversation, typ mt.AppMessage_Type, payload proto.Message, targetCID string) []mt.ValidatePendingMessage_Reason {
+		raw, err := proto.Marshal(payload)
+		require.NoError(t, err)
+
+		found := []mt.ValidatePendingMessage_Reason(nil)
+		for _, issue := range PendingMessageIssues(conv, &mt.ValidatePendingMessage_Request{ConversationPublicKey: conv.GetPublicKey(), Type: typ, Payload: raw, TargetCID: targetCID}) {
+			found = append(found, issue.GetReason())
+		}
+		return found
+	}
+
+	group := &mt.Conversation{PublicKey: "group_pk", Type: mt.Conversation_MultiMemberType}
+	require.Empty(t, reasons(group, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: "hello"}, ""))
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonEmptyMessage}, reasons(group, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: " "}, ""))
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonMissingTarget}, reasons(group, mt.AppMessage_TypePollVote, &mt.AppMessage_PollVote{}, ""))
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonLocalOnlyType}, reasons(group, mt.AppMessage_TypeCallLog, &mt.AppMessage_CallLog{}, ""))
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonInvalidPayload}, reasons(group, mt.AppMessage_TypePoll, &mt.AppMessage_Poll{Question: "lunch?"}, ""))
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonPayloadTooLarge}, reasons(group, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: string(make([]byte, InteractionPayloadMaxSize))}, ""))
+
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonUnknownConversation}, reasons(nil, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: "hello"}, ""))
+	system := &mt.Conversation{PublicKey: mt.SystemConversationPublicKey, Type: mt.Conversation_SystemType}
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonSystemConversation}, reasons(system, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: "hello"}, ""))
+	left := &mt.Conversation{PublicKey: "group_pk", Type: mt.Conversation_MultiMemberType, LeftDate: 1}
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonConversationLeft}, reasons(left, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: "hello"}, ""))
+
+	// every issue is reported
+	blocked := &mt.Conversation{PublicKey: "contact_pk", Type: mt.Conversation_ContactType, Contact: &mt.Contact{State: mt.Contact_Blocked}}
+	require.Equal(t, []mt.ValidatePendingMessage_Reason{mt.ValidatePendingMessage_ReasonContactBlocked, mt.ValidatePendingMessage_ReasonEmptyMessage}, reasons(blocked, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{}, ""))
+	accepted := &mt.Conversation{PublicKey: "contact_pk", Type: mt.Conversation_ContactType, Contact: &mt.Contact{State: mt.Contact_Accepted}}
+	require.Empty(t, reasons(accepted, mt.AppMessage_TypeUserMessage, &mt.AppMessage_UserMessage{Body: "hello"}, ""))
+}
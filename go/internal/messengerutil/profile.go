@@ -0,0 +1,70 @@
+package messengerutil
+
+import (
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	ProfileBioMaxLength  = 280
+	ProfileLinksMaxCount = 5
+	ProfileLinkMaxLength = 256
+)
+
+// CheckProfile returns an error if the bio or the links of a profile don't
+// respect the limits, it is used on the profile of the account
+func CheckProfile(bio string, links []string) error {
+	if utf8.RuneCountInString(bio) > ProfileBioMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("bio is longer than %d characters", ProfileBioMaxLength))
+	}
+
+	if len(links) > ProfileLinksMaxCount {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a profile can't have more than %d links", ProfileLinksMaxCount))
+	}
+
+	for _, link := range links {
+		if !isValidProfileLink(link) {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid profile link %q", link))
+		}
+	}
+
+	return nil
+}
+
+// SanitizeProfile truncates the bio and drops the invalid or extra links of a
+// profile received from a peer
+func SanitizeProfile(bio string, links []string) (string, []string) {
+	if utf8.RuneCountInString(bio) > ProfileBioMaxLength {
+		bio = string([]rune(bio)[:ProfileBioMaxLength])
+	}
+
+	valid := []string(nil)
+	for _, link := range links {
+		if len(valid) == ProfileLinksMaxCount {
+			break
+		}
+
+		if isValidProfileLink(link) {
+			valid = append(valid, link)
+		}
+	}
+
+	return bio, valid
+}
+
+// isValidProfileLink only accepts reasonably short http(s) URLs
+func isValidProfileLink(link string) bool {
+	if link == "" || len(link) > ProfileLinkMaxLength {
+		return false
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	return u.Scheme == "http" || u.Scheme == "https"
+}
@@ -0,0 +1,37 @@
+package messengerutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestCheckProfile(t *testing.T) {
+	require.NoError(t, CheckProfile("", nil))
+	require.NoError(t, CheckProfile("hello", []string{"https://berty.tech", "http://example.com/foo?bar"}))
+
+	// the limit is in characters, not bytes
+	require.NoError(t, CheckProfile(strings.Repeat("é", ProfileBioMaxLength), nil))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(CheckProfile(strings.Repeat("a", ProfileBioMaxLength+1), nil)))
+
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(CheckProfile("", []string{"javascript:alert(1)"})))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(CheckProfile("", []string{"berty.tech"})))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(CheckProfile("", []string{"https://" + strings.Repeat("a", ProfileLinkMaxLength)})))
+	require.Equal(t, errcode.ErrInvalidInput, errcode.Code(CheckProfile("", make([]string, ProfileLinksMaxCount+1))))
+}
+
+func TestSanitizeProfile(t *testing.T) {
+	bio, links := SanitizeProfile(strings.Repeat("é", ProfileBioMaxLength+10), []string{
+		"https://1.example", "ftp://invalid.example", "https://2.example", "https://3.example",
+		"https://4.example", "https://5.example", "https://6.example",
+	})
+	require.Equal(t, strings.Repeat("é", ProfileBioMaxLength), bio)
+	require.Equal(t, []string{"https://1.example", "https://2.example", "https://3.example", "https://4.example", "https://5.example"}, links)
+
+	bio, links = SanitizeProfile("hello", nil)
+	require.Equal(t, "hello", bio)
+	require.Empty(t, links)
+}
@@ -0,0 +1,140 @@
+package messengerutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// OutboundBudget is the token bucket budget of a type of automatic message
+type OutboundBudget struct {
+	// Rate is the number of messages per second the budget refills with
+	Rate float64
+	// Burst is the number of messages which can be sent at once
+	Burst float64
+	// Drop is set for the messages which are useless once late, they are
+	// dropped instead of delayed when the budget is exhausted
+	Drop bool
+}
+
+// DefaultOutboundBudgets are the budgets of the automatic messages, the
+// messages sent on behalf of the user aren't limited
+var DefaultOutboundBudgets = map[mt.AppMessage_Type]OutboundBudget{
+	mt.AppMessage_TypeAcknowledge:     {Rate: 5, Burst: 20},
+	mt.AppMessage_TypeDeliveryReceipt: {Rate: 5, Burst: 20},
+	mt.AppMessage_TypeReadReceipt:     {Rate: 1, Burst: 10},
+	mt.AppMessage_TypeActivity:        {Rate: 1, Burst: 5, Drop: true},
+	mt.AppMessage_TypePresence:        {Rate: 0.2, Burst: 10, Drop: true},
+}
+
+// ErrOutboundRateLimited is returned for the messages dropped by an
+// OutboundLimiter
+var ErrOutboundRateLimited = errcode.ErrProtocolSend.Wrap(fmt.Errorf("outbound rate limit exceeded"))
+
+type outboundBucket struct {
+	budget OutboundBudget
+	tokens float64
+	last   time.Time
+	stats  mt.SystemInfo_RateLimit
+}
+
+// OutboundLimiter rate limits the automatic outgoing messages with a token
+// bucket per message type
+type OutboundLimiter struct {
+	mutex   sync.Mutex
+	buckets map[mt.AppMessage_Type]*outboundBucket
+	now     func() time.Time
+}
+
+func NewOutboundLimiter(budgets map[mt.AppMessage_Type]OutboundBudget) *OutboundLimiter {
+	l := &OutboundLimiter{
+		buckets: make(map[mt.AppMessage_Type]*outboundBucket, len(budgets)),
+		now:     time.Now,
+	}
+
+	for typ, budget := range budgets {
+		l.buckets[typ] = &outboundBucket{budget: budget, tokens: budget.Burst, stats: mt.SystemInfo_RateLimit{Type: typ}}
+	}
+
+	return l
+}
+
+// reserve takes a token for a message of type typ, it returns how long to wait
+// before sending it and false if it must be dropped
+func (l *OutboundLimiter) reserve(typ mt.AppMessage_Type) (time.Duration, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	bucket, ok := l.buckets[typ]
+	if !ok {
+		return 0, true
+	}
+
+	now := l.now()
+	if !bucket.last.IsZero() {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * bucket.budget.Rate
+		if bucket.tokens > bucket.budget.Burst {
+			bucket.tokens = bucket.budget.Burst
+		}
+	}
+	bucket.last = now
+
+	if bucket.tokens < 1 && bucket.budget.Drop {
+		bucket.stats.Dropped++
+		return 0, false
+	}
+
+	// a delayed message borrows a token from the future
+	bucket.tokens--
+	bucket.stats.Sent++
+	if bucket.tokens >= 0 {
+		return 0, true
+	}
+
+	bucket.stats.Delayed++
+	return time.Duration(-bucket.tokens / bucket.budget.Rate * float64(time.Second)), true
+}
+
+// Wait blocks until a message of type typ can be sent, it returns
+// ErrOutboundRateLimited if the message must be dropped instead
+func (l *OutboundLimiter) Wait(ctx context.Context, typ mt.AppMessage_Type) error {
+	delay, ok := l.reserve(typ)
+	if !ok {
+		return ErrOutboundRateLimited
+	}
+
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats returns the counters of each limited message type
+func (l *OutboundLimiter) Stats() []*mt.SystemInfo_RateLimit {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	stats := make([]*mt.SystemInfo_RateLimit, 0, len(l.buckets))
+	for _, bucket := range l.buckets {
+		s := bucket.stats
+		stats = append(stats, &s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Type < stats[j].Type })
+
+	return stats
+}
@@ -0,0 +1,50 @@
+package messengerutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestOutboundLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := NewOutboundLimiter(map[mt.AppMessage_Type]OutboundBudget{
+		mt.AppMessage_TypeAcknowledge: {Rate: 1, Burst: 2},
+		mt.AppMessage_TypePresence:    {Rate: 1, Burst: 1, Drop: true},
+	})
+	l.now = func() time.Time { return now }
+
+	// the burst is sent right away, then messages are delayed
+	for i := 0; i < 2; i++ {
+		delay, ok := l.reserve(mt.AppMessage_TypeAcknowledge)
+		require.True(t, ok)
+		require.Zero(t, delay)
+	}
+	delay, ok := l.reserve(mt.AppMessage_TypeAcknowledge)
+	require.True(t, ok)
+	require.Equal(t, time.Second, delay)
+
+	// droppable messages aren't delayed
+	require.NoError(t, l.Wait(context.Background(), mt.AppMessage_TypePresence))
+	require.ErrorIs(t, l.Wait(context.Background(), mt.AppMessage_TypePresence), ErrOutboundRateLimited)
+
+	// the budget refills over time
+	now = now.Add(time.Second)
+	require.NoError(t, l.Wait(context.Background(), mt.AppMessage_TypePresence))
+
+	// user messages aren't limited
+	for i := 0; i < 10; i++ {
+		delay, ok := l.reserve(mt.AppMessage_TypeUserMessage)
+		require.True(t, ok)
+		require.Zero(t, delay)
+	}
+
+	require.Equal(t, []*mt.SystemInfo_RateLimit{
+		{Type: mt.AppMessage_TypeAcknowledge, Sent: 3, Delayed: 1},
+		{Type: mt.AppMessage_TypePresence, Sent: 2, Dropped: 1},
+	}, l.Stats())
+}
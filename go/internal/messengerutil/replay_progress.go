@@ -0,0 +1,78 @@
+package messengerutil
+
+import (
+	"sync"
+
+	"github.com/gogo/protobuf/proto"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// ReplayProgress streams the progress of the replays of the protocol logs to
+// the clients, as StreamEvent_TypeReplayProgress events. The last progress is
+// kept for the clients subscribing once the replay started, or after it.
+type ReplayProgress struct {
+	dispatcher Dispatcher
+
+	mutex sync.Mutex
+	last  *mt.StreamEvent_ReplayProgress
+}
+
+func NewReplayProgress(dispatcher Dispatcher) *ReplayProgress {
+	if dispatcher == nil {
+		dispatcher = &NoopDispatcher{}
+	}
+
+	return &ReplayProgress{dispatcher: dispatcher}
+}
+
+// Start begins a replay of total groups
+func (p *ReplayProgress) Start(total int) error {
+	return p.update(func(progress *mt.StreamEvent_ReplayProgress) {
+		*progress = mt.StreamEvent_ReplayProgress{GroupsTotal: int64(total)}
+	})
+}
+
+// GroupReplayed records a replayed group along with the number of its events
+// which were handled
+func (p *ReplayProgress) GroupReplayed(groupPK string, events int64) error {
+	return p.update(func(progress *mt.StreamEvent_ReplayProgress) {
+		progress.GroupsDone++
+		progress.ConversationPublicKey = groupPK
+		progress.Events += events
+	})
+}
+
+// Finish ends the replay, err is the error it failed with if any
+func (p *ReplayProgress) Finish(err error) error {
+	return p.update(func(progress *mt.StreamEvent_ReplayProgress) {
+		progress.Finished = true
+		if err != nil {
+			progress.Error = err.Error()
+		}
+	})
+}
+
+// Last returns the last progress streamed, it is nil if no replay started
+func (p *ReplayProgress) Last() *mt.StreamEvent_ReplayProgress {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.last == nil {
+		return nil
+	}
+
+	return proto.Clone(p.last).(*mt.StreamEvent_ReplayProgress)
+}
+
+func (p *ReplayProgress) update(fn func(progress *mt.StreamEvent_ReplayProgress)) error {
+	p.mutex.Lock()
+	if p.last == nil {
+		p.last = &mt.StreamEvent_ReplayProgress{}
+	}
+	fn(p.last)
+	event := proto.Clone(p.last)
+	p.mutex.Unlock()
+
+	return p.dispatcher.StreamEvent(mt.StreamEvent_TypeReplayProgress, event, false)
+}
@@ -0,0 +1,93 @@
+package messengerutil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+type progressDispatcher struct {
+	NoopDispatcher
+	events []*mt.StreamEvent_ReplayProgress
+}
+
+func (d *progressDispatcher) StreamEvent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool) error {
+	if typ != mt.StreamEvent_TypeReplayProgress {
+		return fmt.Errorf("unexpected stream event type: %s", typ)
+	}
+
+	d.events = append(d.events, msg.(*mt.StreamEvent_ReplayProgress))
+	return nil
+}
+
+func (d *progressDispatcher) IsEnabled() bool { return true }
+
+func TestReplayProgress(t *testing.T) {
+	dispatcher := &progressDispatcher{}
+	progress := NewReplayProgress(dispatcher)
+	require.Nil(t, progress.Last())
+
+	require.NoError(t, progress.Start(2))
+	require.NoError(t, progress.GroupReplayed("group_1", 3))
+	require.NoError(t, progress.GroupReplayed("group_2", 4))
+	require.NoError(t, progress.Finish(nil))
+
+	require.Equal(t, []*mt.StreamEvent_ReplayProgress{
+		{GroupsTotal: 2},
+		{GroupsTotal: 2, GroupsDone: 1, ConversationPublicKey: "group_1", Events: 3},
+		{GroupsTotal: 2, GroupsDone: 2, ConversationPublicKey: "group_2", Events: 7},
+		{GroupsTotal: 2, GroupsDone: 2, ConversationPublicKey: "group_2", Events: 7, Finished: true},
+	}, dispatcher.events)
+	require.Equal(t, dispatcher.events[3], progress.Last())
+
+	// a new replay starts over
+	require.NoError(t, progress.Start(1))
+	require.NoError(t, progress.Finish(fmt.Errorf("stream closed")))
+	require.Equal(t, &mt.StreamEvent_ReplayProgress{GroupsTotal: 1, Finished: true, Error: "stream closed"}, progress.Last())
+}
+
+// streamDispatcher marshals the events in StreamEvents, as they are sent to the
+// clients
+type streamDispatcher struct {
+	NoopDispatcher
+	events []*mt.StreamEvent
+}
+
+func (d *streamDispatcher) StreamEvent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool) error {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	d.events = append(d.events, &mt.StreamEvent{Type: typ, Payload: payload, IsNew: isNew})
+	return nil
+}
+
+func (d *streamDispatcher) IsEnabled() bool { return true }
+
+func TestReplayProgressStreamed(t *testing.T) {
+	dispatcher := &streamDispatcher{}
+	progress := NewReplayProgress(dispatcher)
+
+	require.NoError(t, progress.Start(1))
+	require.NoError(t, progress.GroupReplayed("group_1", 42))
+	require.NoError(t, progress.Finish(nil))
+
+	events := []*mt.StreamEvent_ReplayProgress(nil)
+	for _, e := range dispatcher.events {
+		require.Equal(t, mt.StreamEvent_TypeReplayProgress, e.GetType())
+		payload, err := e.UnmarshalPayload()
+		require.NoError(t, err)
+		events = append(events, payload.(*mt.StreamEvent_ReplayProgress))
+	}
+
+	require.Len(t, events, 3)
+	require.Equal(t, int64(1), events[0].GetGroupsTotal())
+	require.Equal(t, "group_1", events[1].GetConversationPublicKey())
+	require.Equal(t, int64(42), events[2].GetEvents())
+	require.True(t, events[2].GetFinished())
+}
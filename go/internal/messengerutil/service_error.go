@@ -0,0 +1,54 @@
+package messengerutil
+
+import (
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// permanentErrors are the codes of the errors which handling the same event
+// again will raise again
+var permanentErrors = []errcode.ErrCode{
+	errcode.ErrInvalidInput,
+	errcode.ErrMissingInput,
+	errcode.ErrDeserialization,
+	errcode.ErrNotImplemented,
+	errcode.ErrProtocolEventUnmarshal,
+	errcode.ErrMessengerContactMetadataUnmarshal,
+}
+
+// IsRetryableError returns true if an operation which failed with err may
+// succeed when done again, the errors without code are considered transient
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	for _, code := range errcode.Codes(err) {
+		for _, permanent := range permanentErrors {
+			if code == permanent {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// NewServiceError describes an error met while handling a protocol event of a
+// group, for the clients
+func NewServiceError(err error, groupPK string, eventCID string) *mt.StreamEvent_ServiceError {
+	serviceErr := &mt.StreamEvent_ServiceError{
+		Code:                  errcode.ErrInternal,
+		Codes:                 errcode.Codes(err),
+		Message:               err.Error(),
+		ConversationPublicKey: groupPK,
+		EventCID:              eventCID,
+		Retryable:             IsRetryableError(err),
+	}
+
+	if len(serviceErr.Codes) > 0 {
+		serviceErr.Code = serviceErr.Codes[0]
+	}
+
+	return serviceErr
+}
@@ -0,0 +1,34 @@
+package messengerutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestNewServiceError(t *testing.T) {
+	require.False(t, IsRetryableError(nil))
+	require.True(t, IsRetryableError(errors.New("database is locked")))
+
+	err := NewServiceError(errcode.ErrDBWrite.Wrap(fmt.Errorf("database is locked")), "group1", "cid1")
+	require.Equal(t, errcode.ErrDBWrite, err.Code)
+	require.Equal(t, []errcode.ErrCode{errcode.ErrDBWrite}, err.Codes)
+	require.Equal(t, "group1", err.ConversationPublicKey)
+	require.Equal(t, "cid1", err.EventCID)
+	require.True(t, err.Retryable)
+
+	// an invalid event fails the same way each time
+	err = NewServiceError(errcode.ErrDBWrite.Wrap(errcode.ErrInvalidInput.Wrap(fmt.Errorf("no cid"))), "group1", "cid1")
+	require.Equal(t, errcode.ErrDBWrite, err.Code)
+	require.Equal(t, []errcode.ErrCode{errcode.ErrDBWrite, errcode.ErrInvalidInput}, err.Codes)
+	require.False(t, err.Retryable)
+
+	err = NewServiceError(errors.New("unknown"), "group1", "")
+	require.Equal(t, errcode.ErrInternal, err.Code)
+	require.Empty(t, err.Codes)
+	require.True(t, err.Retryable)
+}
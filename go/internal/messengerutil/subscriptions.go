@@ -0,0 +1,355 @@
+package messengerutil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+const (
+	// DefaultGroupEventsDemand is the number of events of a group which can be
+	// waiting to be handled before its streams stop being read
+	DefaultGroupEventsDemand = 16
+
+	defaultGroupEventsBuffer     = 64
+	defaultResubscribeMinBackoff = time.Second
+	defaultResubscribeMaxBackoff = time.Minute
+)
+
+// GroupStreamClient is the part of the protocol client used to subscribe to
+// the groups
+type GroupStreamClient interface {
+	GroupMetadataList(ctx context.Context, in *protocoltypes.GroupMetadataList_Request, opts ...grpc.CallOption) (protocoltypes.ProtocolService_GroupMetadataListClient, error)
+	GroupMessageList(ctx context.Context, in *protocoltypes.GroupMessageList_Request, opts ...grpc.CallOption) (protocoltypes.ProtocolService_GroupMessageListClient, error)
+}
+
+// GroupEvent is an event received on the metadata or the message stream of a
+// group, Done must be called once it has been handled
+type GroupEvent struct {
+	GroupPK  []byte
+	Metadata *protocoltypes.GroupMetadataEvent
+	Message  *protocoltypes.GroupMessageEvent
+
+	done func()
+}
+
+// Done gives back the demand taken by the event to its group
+func (e *GroupEvent) Done() {
+	if e.done != nil {
+		e.done()
+		e.done = nil
+	}
+}
+
+// ID returns the id of the event
+func (e *GroupEvent) ID() []byte {
+	if e.Message != nil {
+		return e.Message.GetEventContext().GetID()
+	}
+	return e.Metadata.GetEventContext().GetID()
+}
+
+func (e *GroupEvent) streamName() string {
+	if e.Message != nil {
+		return "message"
+	}
+	return "metadata"
+}
+
+func (e *GroupEvent) streamKey() string {
+	return B64EncodeBytes(e.GroupPK) + "/" + e.streamName()
+}
+
+type groupSubscription struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	demand chan struct{}
+}
+
+// groupCursors are the ids of the last events received on the streams of a
+// group, the streams are resumed from them
+type groupCursors struct {
+	metadata []byte
+	message  []byte
+}
+
+// GroupSubscriber multiplexes the metadata and message streams of the groups
+// into a single channel. Each group has a limited demand: its streams aren't
+// read while too many of its events are waiting to be handled, so a busy group
+// can't starve the others nor grow the memory. The streams failing are
+// resubscribed with a backoff from the last event they received.
+type GroupSubscriber struct {
+	client     GroupStreamClient
+	logger     *zap.Logger
+	events     chan *GroupEvent
+	demand     int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mutex   sync.Mutex
+	groups  map[string]*groupSubscription
+	cursors map[string]*groupCursors
+}
+
+func NewGroupSubscriber(client GroupStreamClient, logger *zap.Logger, demand int) *GroupSubscriber {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	if demand <= 0 {
+		demand = DefaultGroupEventsDemand
+	}
+
+	return &GroupSubscriber{
+		client:     client,
+		logger:     logger,
+		events:     make(chan *GroupEvent, defaultGroupEventsBuffer),
+		demand:     demand,
+		minBackoff: defaultResubscribeMinBackoff,
+		maxBackoff: defaultResubscribeMaxBackoff,
+		groups:     make(map[string]*groupSubscription),
+		cursors:    make(map[string]*groupCursors),
+	}
+}
+
+// Events returns the events received on every subscribed group
+func (s *GroupSubscriber) Events() <-chan *GroupEvent {
+	return s.events
+}
+
+// Subscribe opens the streams of a group until ctx is done or the group is
+// unsubscribed, subscribing to an already subscribed group is a no-op. The
+// streams resume from the last events received by a previous subscription,
+// the metadata stream starts from the beginning and the message stream from
+// now otherwise.
+func (s *GroupSubscriber) Subscribe(ctx context.Context, groupPK []byte) error {
+	key := B64EncodeBytes(groupPK)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sub, ok := s.groups[key]; ok && sub.ctx.Err() == nil {
+		return nil
+	}
+
+	cursors, ok := s.cursors[key]
+	if !ok {
+		cursors = &groupCursors{}
+		s.cursors[key] = cursors
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &groupSubscription{ctx: ctx, cancel: cancel, demand: make(chan struct{}, s.demand)}
+
+	metadata, err := s.client.GroupMetadataList(ctx, &protocoltypes.GroupMetadataList_Request{GroupPK: groupPK, SinceID: cursors.metadata})
+	if err != nil {
+		cancel()
+		return errcode.ErrEventListMetadata.Wrap(err)
+	}
+
+	messages, err := s.client.GroupMessageList(ctx, s.messageListRequest(groupPK, cursors.message))
+	if err != nil {
+		cancel()
+		return errcode.ErrEventListMessage.Wrap(err)
+	}
+
+	s.groups[key] = sub
+
+	go s.consume(sub, groupPK, "group metadata", func(ctx context.Context) (func() (*GroupEvent, error), error) {
+		if metadata == nil {
+			s.mutex.Lock()
+			since := cursors.metadata
+			s.mutex.Unlock()
+
+			stream, err := s.client.GroupMetadataList(ctx, &protocoltypes.GroupMetadataList_Request{GroupPK: groupPK, SinceID: since})
+			if err != nil {
+				return nil, errcode.ErrEventListMetadata.Wrap(err)
+			}
+			metadata = stream
+		}
+
+		stream := metadata
+		metadata = nil
+
+		return func() (*GroupEvent, error) {
+			evt, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+
+			s.mutex.Lock()
+			cursors.metadata = evt.GetEventContext().GetID()
+			s.mutex.Unlock()
+
+			return &GroupEvent{GroupPK: groupPK, Metadata: evt}, nil
+		}, nil
+	})
+
+	go s.consume(sub, groupPK, "group message", func(ctx context.Context) (func() (*GroupEvent, error), error) {
+		if messages == nil {
+			s.mutex.Lock()
+			since := cursors.message
+			s.mutex.Unlock()
+
+			stream, err := s.client.GroupMessageList(ctx, s.messageListRequest(groupPK, since))
+			if err != nil {
+				return nil, errcode.ErrEventListMessage.Wrap(err)
+			}
+			messages = stream
+		}
+
+		stream := messages
+		messages = nil
+
+		return func() (*GroupEvent, error) {
+			evt, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+
+			s.mutex.Lock()
+			cursors.message = evt.GetEventContext().GetID()
+			s.mutex.Unlock()
+
+			return &GroupEvent{GroupPK: groupPK, Message: evt}, nil
+		}, nil
+	})
+
+	return nil
+}
+
+// ResumeFrom sets the events the streams of a group resume from when none of
+// their events was received yet, such as the last events handled before a
+// restart. A nil id keeps the default start of its stream.
+func (s *GroupSubscriber) ResumeFrom(groupPK []byte, metadataID, messageID []byte) {
+	key := B64EncodeBytes(groupPK)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	cursors, ok := s.cursors[key]
+	if !ok {
+		cursors = &groupCursors{}
+		s.cursors[key] = cursors
+	}
+
+	if cursors.metadata == nil {
+		cursors.metadata = metadataID
+	}
+
+	if cursors.message == nil {
+		cursors.message = messageID
+	}
+}
+
+func (s *GroupSubscriber) messageListRequest(groupPK []byte, since []byte) *protocoltypes.GroupMessageList_Request {
+	// without a cursor the messages already in the store were handled when
+	// they were received, or will be through the push notifications
+	if since == nil {
+		return &protocoltypes.GroupMessageList_Request{GroupPK: groupPK, SinceNow: true}
+	}
+
+	return &protocoltypes.GroupMessageList_Request{GroupPK: groupPK, SinceID: since}
+}
+
+// consume forwards the events of a stream to the events channel, open is
+// called again with a backoff to resubscribe when the stream fails
+func (s *GroupSubscriber) consume(sub *groupSubscription, groupPK []byte, name string, open func(ctx context.Context) (func() (*GroupEvent, error), error)) {
+	backoff := s.minBackoff
+
+	for {
+		recv, err := open(sub.ctx)
+		for err == nil {
+			var evt *GroupEvent
+			if evt, err = recv(); err != nil {
+				break
+			}
+
+			// a stream which delivers is healthy again
+			backoff = s.minBackoff
+
+			if !s.push(sub, evt) {
+				return
+			}
+		}
+
+		if sub.ctx.Err() != nil {
+			return
+		}
+
+		s.logger.Warn("group stream failed, resubscribing", zap.String("name", name), zap.String("gpk", B64EncodeBytes(groupPK)), zap.Duration("backoff", backoff), zap.Error(err))
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-sub.ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// push waits for the group to have demand left then queues the event, it
+// returns false if the subscription is done meanwhile
+func (s *GroupSubscriber) push(sub *groupSubscription, evt *GroupEvent) bool {
+	select {
+	case sub.demand <- struct{}{}:
+	case <-sub.ctx.Done():
+		return false
+	}
+
+	evt.done = func() { <-sub.demand }
+
+	select {
+	case s.events <- evt:
+		return true
+	case <-sub.ctx.Done():
+		evt.Done()
+		return false
+	}
+}
+
+// IsSubscribed returns true while the streams of a group are open
+func (s *GroupSubscriber) IsSubscribed(groupPK []byte) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub, ok := s.groups[B64EncodeBytes(groupPK)]
+	return ok && sub.ctx.Err() == nil
+}
+
+// Unsubscribe closes the streams of a group, its cursors are kept to resume
+// them on the next subscription
+func (s *GroupSubscriber) Unsubscribe(groupPK []byte) {
+	key := B64EncodeBytes(groupPK)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if sub, ok := s.groups[key]; ok {
+		sub.cancel()
+		delete(s.groups, key)
+	}
+}
+
+// UnsubscribeAll closes the streams of every group
+func (s *GroupSubscriber) UnsubscribeAll() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, sub := range s.groups {
+		sub.cancel()
+		delete(s.groups, key)
+	}
+}
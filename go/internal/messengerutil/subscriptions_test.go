@@ -0,0 +1,218 @@
+package messengerutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+type testStreamEvent struct {
+	id  string
+	err error
+}
+
+type testMetadataStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events chan testStreamEvent
+}
+
+func (s *testMetadataStream) Recv() (*protocoltypes.GroupMetadataEvent, error) {
+	select {
+	case evt := <-s.events:
+		if evt.err != nil {
+			return nil, evt.err
+		}
+		return &protocoltypes.GroupMetadataEvent{EventContext: &protocoltypes.EventContext{ID: []byte(evt.id)}}, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+type testMessageStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	events chan testStreamEvent
+}
+
+func (s *testMessageStream) Recv() (*protocoltypes.GroupMessageEvent, error) {
+	select {
+	case evt := <-s.events:
+		if evt.err != nil {
+			return nil, evt.err
+		}
+		return &protocoltypes.GroupMessageEvent{EventContext: &protocoltypes.EventContext{ID: []byte(evt.id)}}, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+type testGroupStreamClient struct {
+	mutex            sync.Mutex
+	metadata         chan testStreamEvent
+	messages         chan testStreamEvent
+	metadataRequests []*protocoltypes.GroupMetadataList_Request
+	messageRequests  []*protocoltypes.GroupMessageList_Request
+}
+
+func (c *testGroupStreamClient) GroupMetadataList(ctx context.Context, in *protocoltypes.GroupMetadataList_Request, _ ...grpc.CallOption) (protocoltypes.ProtocolService_GroupMetadataListClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.metadataRequests = append(c.metadataRequests, in)
+	return &testMetadataStream{ctx: ctx, events: c.metadata}, nil
+}
+
+func (c *testGroupStreamClient) GroupMessageList(ctx context.Context, in *protocoltypes.GroupMessageList_Request, _ ...grpc.CallOption) (protocoltypes.ProtocolService_GroupMessageListClient, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.messageRequests = append(c.messageRequests, in)
+	return &testMessageStream{ctx: ctx, events: c.messages}, nil
+}
+
+func (c *testGroupStreamClient) lastMessageRequest() *protocoltypes.GroupMessageList_Request {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.messageRequests[len(c.messageRequests)-1]
+}
+
+func nextGroupEvent(t *testing.T, s *GroupSubscriber) *GroupEvent {
+	t.Helper()
+
+	select {
+	case evt := <-s.Events():
+		return evt
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no group event received")
+		return nil
+	}
+}
+
+func TestGroupSubscriber_Resubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &testGroupStreamClient{metadata: make(chan testStreamEvent), messages: make(chan testStreamEvent)}
+	s := NewGroupSubscriber(client, nil, 0)
+	s.minBackoff = time.Millisecond
+
+	gpk := []byte("group")
+	require.False(t, s.IsSubscribed(gpk))
+	require.NoError(t, s.Subscribe(ctx, gpk))
+	require.True(t, s.IsSubscribed(gpk))
+	// subscribing twice is a no-op
+	require.NoError(t, s.Subscribe(ctx, gpk))
+	require.Len(t, client.messageRequests, 1)
+	require.True(t, client.messageRequests[0].GetSinceNow())
+	require.Nil(t, client.metadataRequests[0].GetSinceID())
+
+	client.messages <- testStreamEvent{id: "msg1"}
+	evt := nextGroupEvent(t, s)
+	require.Equal(t, gpk, evt.GroupPK)
+	require.Equal(t, []byte("msg1"), evt.Message.GetEventContext().GetID())
+	evt.Done()
+
+	// the failed stream is resumed from its last event
+	client.messages <- testStreamEvent{err: fmt.Errorf("stream reset")}
+	client.messages <- testStreamEvent{id: "msg2"}
+	evt = nextGroupEvent(t, s)
+	require.Equal(t, []byte("msg2"), evt.Message.GetEventContext().GetID())
+	evt.Done()
+
+	req := client.lastMessageRequest()
+	require.False(t, req.GetSinceNow())
+	require.Equal(t, []byte("msg1"), req.GetSinceID())
+
+	// the cursors are kept across subscriptions
+	s.Unsubscribe(gpk)
+	require.False(t, s.IsSubscribed(gpk))
+	require.NoError(t, s.Subscribe(ctx, gpk))
+	require.Equal(t, []byte("msg2"), client.lastMessageRequest().GetSinceID())
+
+	client.metadata <- testStreamEvent{id: "meta1"}
+	evt = nextGroupEvent(t, s)
+	require.Equal(t, []byte("meta1"), evt.Metadata.GetEventContext().GetID())
+	evt.Done()
+
+	s.UnsubscribeAll()
+}
+
+func TestGroupSubscriber_Demand(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &testGroupStreamClient{metadata: make(chan testStreamEvent), messages: make(chan testStreamEvent)}
+	s := NewGroupSubscriber(client, nil, 2)
+
+	require.NoError(t, s.Subscribe(ctx, []byte("group")))
+
+	client.messages <- testStreamEvent{id: "msg1"}
+	client.messages <- testStreamEvent{id: "msg2"}
+
+	// the demand of the group is exhausted, its stream isn't read anymore
+	select {
+	case client.messages <- testStreamEvent{id: "msg3"}:
+		// msg3 was received but is held until an event is done
+	case <-time.After(time.Second):
+		require.FailNow(t, "stream not read")
+	}
+
+	select {
+	case client.messages <- testStreamEvent{id: "msg4"}:
+		require.FailNow(t, "stream read beyond the group demand")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	first := nextGroupEvent(t, s)
+	second := nextGroupEvent(t, s)
+	require.Equal(t, []byte("msg1"), first.Message.GetEventContext().GetID())
+	require.Equal(t, []byte("msg2"), second.Message.GetEventContext().GetID())
+
+	select {
+	case <-s.Events():
+		require.FailNow(t, "event queued beyond the group demand")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	first.Done()
+	third := nextGroupEvent(t, s)
+	require.Equal(t, []byte("msg3"), third.Message.GetEventContext().GetID())
+
+	second.Done()
+	third.Done()
+	s.UnsubscribeAll()
+}
+
+func TestGroupSubscriber_ResumeFrom(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &testGroupStreamClient{metadata: make(chan testStreamEvent), messages: make(chan testStreamEvent)}
+	s := NewGroupSubscriber(client, nil, 0)
+
+	gpk := []byte("group")
+	s.ResumeFrom(gpk, []byte("meta1"), []byte("msg1"))
+	require.NoError(t, s.Subscribe(ctx, gpk))
+	require.Equal(t, []byte("meta1"), client.metadataRequests[0].GetSinceID())
+	require.Equal(t, []byte("msg1"), client.lastMessageRequest().GetSinceID())
+	require.False(t, client.lastMessageRequest().GetSinceNow())
+
+	client.messages <- testStreamEvent{id: "msg2"}
+	nextGroupEvent(t, s).Done()
+
+	// the events received take precedence
+	s.Unsubscribe(gpk)
+	s.ResumeFrom(gpk, nil, []byte("msg1"))
+	require.NoError(t, s.Subscribe(ctx, gpk))
+	require.Equal(t, []byte("meta1"), client.metadataRequests[1].GetSinceID())
+	require.Equal(t, []byte("msg2"), client.lastMessageRequest().GetSinceID())
+}
@@ -0,0 +1,71 @@
+package messengerutil
+
+import (
+	"context"
+
+	"github.com/gogo/protobuf/proto"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// TracerName is the instrumentation name of the messenger spans
+const TracerName = "berty.tech/berty/v2/go/messenger"
+
+const traceParentHeader = "traceparent"
+
+// TracedDispatcher is implemented by the dispatchers which can attach the
+// trace context of an event to the StreamEvent sent to the clients
+type TracedDispatcher interface {
+	Dispatcher
+	StreamEventWithTraceParent(typ mt.StreamEvent_Type, msg proto.Message, isNew bool, traceParent string) error
+}
+
+// StreamEventWithTraceParent streams an event along with traceParent if the
+// dispatcher supports it, the trace context is dropped otherwise
+func StreamEventWithTraceParent(dispatcher Dispatcher, typ mt.StreamEvent_Type, msg proto.Message, isNew bool, traceParent string) error {
+	if traced, ok := dispatcher.(TracedDispatcher); ok && traceParent != "" {
+		return traced.StreamEventWithTraceParent(typ, msg, isNew, traceParent)
+	}
+
+	return dispatcher.StreamEvent(typ, msg, isNew)
+}
+
+// TraceParent returns the W3C traceparent of the span of ctx, it is empty if
+// ctx isn't traced
+func TraceParent(ctx context.Context) string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ""
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParentHeader)
+}
+
+// ContextWithTraceParent returns a copy of ctx whose remote parent span is
+// described by traceParent, ctx is returned as is if traceParent is invalid
+func ContextWithTraceParent(ctx context.Context, traceParent string) context.Context {
+	if traceParent == "" {
+		return ctx
+	}
+
+	return propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentHeader: traceParent})
+}
+
+// StartSpan starts a child span of the span of ctx using the same tracer
+// provider, it is a noop if ctx isn't traced
+func StartSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(TracerName).Start(ctx, name, opts...)
+}
+
+// EndSpan records err on span before ending it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -5,6 +5,12 @@ import "time"
 type Notification struct {
 	Title string
 	Body  string
+
+	// GroupKey stacks the notifications of a conversation, ThreadKey the
+	// ones of a reply thread inside it, they are empty if not grouped.
+	GroupKey  string
+	ThreadKey string
+	Category  string
 }
 
 type Manager interface {
@@ -0,0 +1,75 @@
+// Package protoutil lets the gogo-generated messages, which only implement the
+// legacy github.com/golang/protobuf API, be used with google.golang.org/protobuf.
+package protoutil
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/runtime/protoimpl"
+)
+
+// MessageV2Of returns the google.golang.org/protobuf view of m, its fields are
+// shared with m.
+func MessageV2Of(m protoiface.MessageV1) proto.Message {
+	return protoimpl.X.ProtoMessageV2Of(m)
+}
+
+// Marshal returns the wire encoding of m.
+func Marshal(m protoiface.MessageV1) ([]byte, error) {
+	return proto.Marshal(MessageV2Of(m))
+}
+
+// Unmarshal resets m and parses the wire encoding in b into it.
+func Unmarshal(b []byte, m protoiface.MessageV1) error {
+	return proto.Unmarshal(b, MessageV2Of(m))
+}
+
+// LegacyEnum is implemented by the gogo-generated enums.
+type LegacyEnum interface {
+	String() string
+	EnumDescriptor() ([]byte, []int)
+}
+
+// RegisterType registers the type of m with the given full name in the global
+// registry of google.golang.org/protobuf, it lets m be resolved from an Any,
+// such as the details of a gRPC status. Registering a type twice does nothing,
+// an error is returned if another type is registered with this name.
+func RegisterType(m protoiface.MessageV1, name string) error {
+	typ := protoimpl.X.LegacyMessageTypeOf(m, protoreflect.FullName(name))
+	if typ.Descriptor().FullName() != protoreflect.FullName(name) {
+		return fmt.Errorf("%T is described as %s", m, typ.Descriptor().FullName())
+	}
+
+	// the registry panics on conflicts
+	if prev, err := protoregistry.GlobalTypes.FindMessageByName(typ.Descriptor().FullName()); err == nil {
+		if prev != typ {
+			return fmt.Errorf("another message is registered as %s", name)
+		}
+		return nil
+	}
+
+	return protoregistry.GlobalTypes.RegisterMessage(typ)
+}
+
+// RegisterEnum registers the type of e in the global registry of
+// google.golang.org/protobuf, using the full name given by its descriptor.
+// Registering a type twice does nothing, an error is returned if another type
+// is registered with this name.
+func RegisterEnum(e LegacyEnum) error {
+	typ := protoimpl.X.EnumTypeOf(e)
+
+	// the registry panics on conflicts
+	name := typ.Descriptor().FullName()
+	if prev, err := protoregistry.GlobalTypes.FindEnumByName(name); err == nil {
+		if prev != typ {
+			return fmt.Errorf("another enum is registered as %s", name)
+		}
+		return nil
+	}
+
+	return protoregistry.GlobalTypes.RegisterEnum(typ)
+}
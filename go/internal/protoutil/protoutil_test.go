@@ -0,0 +1,67 @@
+package protoutil_test
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"berty.tech/berty/v2/go/internal/protoutil"
+	"berty.tech/berty/v2/go/pkg/accounttypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestMarshal(t *testing.T) {
+	// messengertypes is generated without the gogo marshalers
+	msg := &messengertypes.AppMessage_UserMessage{Body: "hello"}
+
+	data, err := protoutil.Marshal(msg)
+	require.NoError(t, err)
+
+	expected, err := proto.Marshal(msg)
+	require.NoError(t, err)
+	require.Equal(t, expected, data)
+
+	decoded := &messengertypes.AppMessage_UserMessage{Body: "reset"}
+	require.NoError(t, protoutil.Unmarshal(data, decoded))
+	require.Equal(t, "hello", decoded.Body)
+
+	// accounttypes is generated with them
+	meta := &accounttypes.AccountMetadata{AccountID: "0", Name: "name"}
+
+	data, err = protoutil.Marshal(meta)
+	require.NoError(t, err)
+
+	expected, err = meta.Marshal()
+	require.NoError(t, err)
+	require.Equal(t, expected, data)
+
+	// the gogo unmarshaler rejects a field with the wrong wire type
+	require.Error(t, protoutil.Unmarshal([]byte{0x18, 0x01}, meta))
+}
+
+func TestRegisterType(t *testing.T) {
+	// registered by errcode, for the details of the gRPC status
+	typ, err := protoregistry.GlobalTypes.FindMessageByName("berty.errcode.ErrDetails")
+	require.NoError(t, err)
+
+	details := &errcode.ErrDetails{Codes: []errcode.ErrCode{errcode.ErrInvalidInput}}
+	require.Equal(t, typ, protoutil.MessageV2Of(details).ProtoReflect().Type())
+}
+
+func TestRegisterEnum(t *testing.T) {
+	// registered by errcode
+	typ, err := protoregistry.GlobalTypes.FindEnumByName("berty.errcode.ErrCode")
+	require.NoError(t, err)
+	require.Equal(t, "ErrInvalidInput", string(typ.Descriptor().Values().ByNumber(protoreflect.EnumNumber(errcode.ErrInvalidInput)).Name()))
+
+	// registering again is a no-op
+	require.NoError(t, protoutil.RegisterEnum(errcode.ErrCode(0)))
+	require.NoError(t, protoutil.RegisterType((*errcode.ErrDetails)(nil), "berty.errcode.ErrDetails"))
+
+	// another type can't take the name
+	require.Error(t, protoutil.RegisterType((*accounttypes.AccountMetadata)(nil), "berty.errcode.ErrDetails"))
+}
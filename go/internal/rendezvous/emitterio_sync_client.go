@@ -11,10 +11,11 @@ import (
 	emitter "github.com/berty/emitter-go/v2"
 	rendezvous "github.com/berty/go-libp2p-rendezvous"
 	pb "github.com/berty/go-libp2p-rendezvous/pb"
-	"github.com/golang/protobuf/proto" // nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/protoutil"
 )
 
 type SyncClient interface {
@@ -69,7 +70,7 @@ func (e *emitterClient) subscribeToServerUpdates(inChan chan *registrationMessag
 
 		e.logger.Debug("receiving a message", zap.Any("topic", message.Topic()))
 
-		err := proto.Unmarshal(message.Payload(), reg)
+		err := protoutil.Unmarshal(message.Payload(), reg)
 		if err != nil {
 			e.logger.Error("unable to unmarshall ", zap.Error(err))
 			return
@@ -9,9 +9,10 @@ import (
 	emitter "github.com/berty/emitter-go/v2"
 	rendezvous "github.com/berty/go-libp2p-rendezvous"
 	pb "github.com/berty/go-libp2p-rendezvous/pb"
-	"github.com/golang/protobuf/proto" // nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 	"github.com/libp2p/go-libp2p/core/peer"
 	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/protoutil"
 )
 
 const EmitterServiceType = "emitter-io"
@@ -87,7 +88,7 @@ func (p *EmitterPubSub) Register(pid peer.ID, ns string, addrs [][]byte, ttlAsSe
 		Ttl:   time.Now().Add(time.Duration(ttlAsSeconds) * time.Second).UnixMilli(),
 	}
 
-	marshaled, err := proto.Marshal(dataToSend)
+	marshaled, err := protoutil.Marshal(dataToSend)
 	if err != nil {
 		p.logger.Error("unable to marshal proto", zap.Error(err))
 		return
@@ -11,6 +11,7 @@ const (
 
 	ServiceReplicationID = "rpl"
 	ServicePushID        = "psh"
+	ServiceDirectoryID   = "dir"
 
 	ContextTokenHashField ContextAuthValue = iota
 	ContextTokenIssuerField
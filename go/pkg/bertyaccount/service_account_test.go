@@ -4,11 +4,10 @@ import (
 	"encoding/hex"
 	"testing"
 
-	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
-	"github.com/golang/protobuf/proto"
 	"github.com/stretchr/testify/require"
 
 	"berty.tech/berty/v2/go/internal/initutil"
+	"berty.tech/berty/v2/go/internal/protoutil"
 	"berty.tech/berty/v2/go/pkg/accounttypes"
 )
 
@@ -40,7 +39,7 @@ func TestFailingProto(t *testing.T) {
 		}
 	*/
 
-	err = proto.Unmarshal(metaBytes, meta)
+	err = protoutil.Unmarshal(metaBytes, meta)
 	require.Error(t, err)
 }
 
@@ -122,9 +122,9 @@ func (s *DirectoryService) Register(ctx context.Context, request *directorytypes
 	}
 
 	err = s.db.Transaction(func(tx *gorm.DB) error {
-		directoryIdentifier, err := s.checkVerifiedCredential(request.VerifiedCredential, requestAccountPublicKey)
+		directoryIdentifier, err := s.directoryIdentifierForRequest(request, requestAccountPublicKey)
 		if err != nil {
-			return errcode.ErrServicesDirectoryInvalidVerifiedCredentialSubject.Wrap(err)
+			return err
 		}
 
 		existingRecord, err := getExistingRecord(tx, directoryIdentifier)
@@ -331,6 +331,21 @@ func (s *DirectoryService) insertRecord(tx *gorm.DB, request *directorytypes.Reg
 	return record, nil
 }
 
+// directoryIdentifierForRequest returns the subject of the verified credential,
+// or the handle claimed by the request if there is no credential
+func (s *DirectoryService) directoryIdentifierForRequest(request *directorytypes.Register_Request, accountPK []byte) (string, error) {
+	if len(request.VerifiedCredential) == 0 && request.Handle != "" {
+		return directorytypes.HandleIdentifier(request.Handle)
+	}
+
+	directoryIdentifier, err := s.checkVerifiedCredential(request.VerifiedCredential, accountPK)
+	if err != nil {
+		return "", errcode.ErrServicesDirectoryInvalidVerifiedCredentialSubject.Wrap(err)
+	}
+
+	return directoryIdentifier, nil
+}
+
 func (s *DirectoryService) checkVerifiedCredential(verifiedCredential []byte, accountPK []byte) (string, error) {
 	credentialsOpts := []verifiable.CredentialOpt{verifiable.WithJSONLDDocumentLoader(ld.NewDefaultDocumentLoader(http.DefaultClient))}
 	if len(s.allowedIssuers) == 0 {
@@ -452,3 +452,71 @@ func TestDirectoryService_Query(t *testing.T) {
 
 	queryEntriesAndCompare(t, c, []string{phoneUnknown, phone1}, map[string]*expectedResult{phone1: {uri: web1, vc: signedProof}})
 }
+
+func TestDirectoryService_Handle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, c, conn := NewDirectoryServiceGRPC(ctx, t)
+	defer conn.Close()
+
+	accountPub1, _ := getBertyAccountKeyPair(t)
+	accountPub2, _ := getBertyAccountKeyPair(t)
+
+	web1 := getBertyIDWebLink(t, accountPub1, []byte("testrdvseed"))
+	web2 := getBertyIDWebLink(t, accountPub2, []byte("testrdvseed2"))
+
+	unlockPK1, unlockSK1, err := ed25519.GenerateKey(crand.Reader)
+	require.NoError(t, err)
+
+	// Invalid handle
+	_, err = c.Register(ctx, &directorytypes.Register_Request{
+		Handle:     "a b",
+		ProfileURI: web1,
+	})
+	require.Error(t, err)
+
+	registered1, err := c.Register(ctx, &directorytypes.Register_Request{
+		Handle:     "@Alice_1",
+		ProfileURI: web1,
+		UnlockKey:  unlockPK1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "@alice_1", registered1.DirectoryIdentifier)
+
+	// Claimed by another account
+	_, err = c.Register(ctx, &directorytypes.Register_Request{
+		Handle:     "alice_1",
+		ProfileURI: web2,
+	})
+	require.Error(t, err)
+
+	_, err = c.Register(ctx, &directorytypes.Register_Request{
+		Handle:                  "alice_1",
+		ProfileURI:              web2,
+		OverwriteExistingRecord: true,
+	})
+	require.Error(t, err)
+
+	queryEntriesAndCompare(t, c, []string{"@alice_1"}, map[string]*expectedResult{"@alice_1": {uri: web1}})
+
+	sig, err := unlockSK1.Sign(crand.Reader, []byte(registered1.DirectoryRecordToken), crypto.Hash(0))
+	require.NoError(t, err)
+
+	_, err = c.Unregister(ctx, &directorytypes.Unregister_Request{
+		DirectoryIdentifier:  registered1.DirectoryIdentifier,
+		DirectoryRecordToken: registered1.DirectoryRecordToken,
+		UnlockSig:            sig,
+	})
+	require.NoError(t, err)
+
+	queryEntriesAndCompare(t, c, []string{"@alice_1"}, map[string]*expectedResult{})
+
+	// Released handles can be claimed again
+	registered2, err := c.Register(ctx, &directorytypes.Register_Request{
+		Handle:     "alice_1",
+		ProfileURI: web2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "@alice_1", registered2.DirectoryIdentifier)
+}
@@ -48,6 +48,9 @@ func MarshalLink(link *messengertypes.BertyLink) (internal string, web string, e
 		qrOptimized = &messengertypes.BertyLink{}
 	)
 
+	// the expiry is kept in clear for every kind of link
+	machine.ExpiresAt = link.ExpiresAt
+
 	switch link.Kind {
 	case messengertypes.BertyLink_ContactInviteV1Kind:
 		kind = "contact"
@@ -72,10 +75,14 @@ func MarshalLink(link *messengertypes.BertyLink) (internal string, web string, e
 				SignPub:    link.BertyGroup.Group.SignPub,
 				LinkKeySig: link.BertyGroup.Group.LinkKeySig,
 			},
+			AvatarCID: link.BertyGroup.AvatarCID,
 		}
 		if link.BertyGroup.DisplayName != "" {
 			human.Add("name", link.BertyGroup.DisplayName)
 		}
+		if link.BertyGroup.Description != "" {
+			human.Add("description", link.BertyGroup.Description)
+		}
 		*qrOptimized = *link
 	case messengertypes.BertyLink_EncryptedV1Kind:
 		kind = "enc"
@@ -98,6 +105,10 @@ func MarshalLink(link *messengertypes.BertyLink) (internal string, web string, e
 			machine.Encrypted.GroupSignPub = link.Encrypted.GroupSignPub
 			machine.Encrypted.GroupType = link.Encrypted.GroupType
 			machine.Encrypted.GroupLinkKeySig = link.Encrypted.GroupLinkKeySig
+			machine.Encrypted.GroupAvatarCID = link.Encrypted.GroupAvatarCID
+			if link.Encrypted.GroupDescription != "" {
+				human.Add("description", link.Encrypted.GroupDescription)
+			}
 		}
 		*qrOptimized = *link
 	case messengertypes.BertyLink_MessageV1Kind:
@@ -239,6 +250,9 @@ func UnmarshalLink(uri string, key []byte) (*messengertypes.BertyLink, error) {
 			if name := human.Get("name"); name != "" && link.BertyGroup.DisplayName == "" {
 				link.BertyGroup.DisplayName = name
 			}
+			if description := human.Get("description"); description != "" && link.BertyGroup.Description == "" {
+				link.BertyGroup.Description = description
+			}
 		case "enc":
 			link.Kind = messengertypes.BertyLink_EncryptedV1Kind
 			if link.Encrypted == nil {
@@ -247,6 +261,9 @@ func UnmarshalLink(uri string, key []byte) (*messengertypes.BertyLink, error) {
 			if name := human.Get("name"); name != "" && link.Encrypted.DisplayName == "" {
 				link.Encrypted.DisplayName = name
 			}
+			if description := human.Get("description"); description != "" && link.Encrypted.GroupDescription == "" {
+				link.Encrypted.GroupDescription = description
+			}
 		case "message":
 			link.Kind = messengertypes.BertyLink_MessageV1Kind
 			if link.Encrypted == nil {
@@ -278,7 +295,8 @@ func decryptLink(link *messengertypes.BertyLink, passphrase []byte) (*messengert
 	}
 
 	decrypted := messengertypes.BertyLink{
-		Kind: link.Encrypted.Kind,
+		Kind:      link.Encrypted.Kind,
+		ExpiresAt: link.ExpiresAt,
 	}
 
 	// derive key for AES
@@ -320,6 +338,8 @@ func decryptLink(link *messengertypes.BertyLink, passphrase []byte) (*messengert
 		stream.XORKeyStream(decrypted.BertyGroup.Group.SignPub, link.Encrypted.GroupSignPub)
 		stream.XORKeyStream(decrypted.BertyGroup.Group.LinkKeySig, link.Encrypted.GroupLinkKeySig)
 		decrypted.BertyGroup.DisplayName = link.Encrypted.DisplayName
+		decrypted.BertyGroup.Description = link.Encrypted.GroupDescription
+		decrypted.BertyGroup.AvatarCID = link.Encrypted.GroupAvatarCID
 	}
 
 	if link.Encrypted.Checksum != nil && len(link.Encrypted.Checksum) > 0 {
@@ -348,6 +368,7 @@ func EncryptLink(link *messengertypes.BertyLink, passphrase []byte) (*messengert
 		Encrypted: &messengertypes.BertyLink_Encrypted{
 			Kind: link.Kind, // inherit kind from the clear link.
 		},
+		ExpiresAt: link.ExpiresAt,
 	}
 	if link.Encrypted != nil {
 		// if display name is set in the encrypted part of the input link,
@@ -411,6 +432,8 @@ func EncryptLink(link *messengertypes.BertyLink, passphrase []byte) (*messengert
 		stream.XORKeyStream(encrypted.Encrypted.GroupSignPub, link.BertyGroup.Group.SignPub)
 		stream.XORKeyStream(encrypted.Encrypted.GroupLinkKeySig, link.BertyGroup.Group.LinkKeySig)
 		encrypted.Encrypted.DisplayName = link.BertyGroup.DisplayName
+		encrypted.Encrypted.GroupDescription = link.BertyGroup.Description
+		encrypted.Encrypted.GroupAvatarCID = link.BertyGroup.AvatarCID
 
 	default:
 		return nil, errcode.ErrInvalidInput
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/mdp/qrterminal"
 	"github.com/stretchr/testify/assert"
@@ -132,6 +133,50 @@ func TestMarshalLink(t *testing.T) {
 	}
 }
 
+func TestMarshalLinkMetadata(t *testing.T) {
+	cases := []*messengertypes.BertyLink{
+		{
+			Kind:      messengertypes.BertyLink_ContactInviteV1Kind,
+			ExpiresAt: 1600000000000,
+			BertyID: &messengertypes.BertyID{
+				DisplayName:          "Hello World!",
+				PublicRendezvousSeed: []byte{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1},
+				AccountPK:            []byte{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+			},
+		}, {
+			Kind:      messengertypes.BertyLink_GroupV1Kind,
+			ExpiresAt: 1600000000000,
+			BertyGroup: &messengertypes.BertyGroup{
+				DisplayName: "The Group Name!",
+				Description: "A group about things & stuff",
+				AvatarCID:   "QmAvatar",
+				Group: &protocoltypes.Group{
+					PublicKey: []byte{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+					Secret:    []byte{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4},
+					SecretSig: []byte{5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5},
+					GroupType: protocoltypes.GroupTypeMultiMember,
+					SignPub:   []byte{6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6},
+				},
+			},
+		},
+	}
+
+	for _, input := range cases {
+		t.Run(input.Kind.String(), func(t *testing.T) {
+			internal, web, err := bertylinks.MarshalLink(input)
+			require.NoError(t, err)
+
+			for _, u := range []string{internal, web} {
+				link, err := bertylinks.UnmarshalLink(u, nil)
+				require.NoError(t, err)
+				assert.Equal(t, input, link)
+				assert.True(t, link.IsExpired(time.Unix(1700000000, 0)))
+				assert.False(t, link.IsExpired(time.Unix(1500000000, 0)))
+			}
+		})
+	}
+}
+
 func TestUnmarshalLink(t *testing.T) {
 	cases := []struct {
 		name               string
@@ -310,6 +355,28 @@ func TestEncryptLink(t *testing.T) {
 			[]byte("s3cur3"),
 			nil,
 			"The Group Name!",
+		}, {
+			"group-with-metadata",
+			&messengertypes.BertyLink{
+				Kind:      messengertypes.BertyLink_GroupV1Kind,
+				ExpiresAt: 1600000000000,
+				BertyGroup: &messengertypes.BertyGroup{
+					DisplayName: "The Group Name!",
+					Description: "A group about things",
+					AvatarCID:   "QmAvatar",
+					Group: &protocoltypes.Group{
+						PublicKey:  []byte{3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3},
+						Secret:     []byte{4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4},
+						SecretSig:  []byte{5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5},
+						GroupType:  protocoltypes.GroupTypeMultiMember,
+						SignPub:    []byte{6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6},
+						LinkKeySig: []byte{7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7, 7},
+					},
+				},
+			},
+			[]byte("s3cur3"),
+			nil,
+			"The Group Name!",
 		},
 	}
 	for _, tc := range cases {
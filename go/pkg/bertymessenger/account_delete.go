@@ -0,0 +1,134 @@
+package bertymessenger
+
+import (
+	"context"
+	"time"
+
+	ipfscid "github.com/ipfs/go-cid"
+	ipfs_path "github.com/ipfs/interface-go-ipfs-core/path"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// accountDeleteDrainTimeout is the time given to the events being handled to
+// be committed before the database is wiped
+const accountDeleteDrainTimeout = 10 * time.Second
+
+func (svc *service) AccountDelete(ctx context.Context, _ *mt.AccountDelete_Request) (_ *mt.AccountDelete_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Deleting account")
+	defer func() { endSection(err, "") }()
+
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	// tell the contacts and the groups, this is best effort as the account is
+	// deleted anyway
+	svc.sendAccountDeleted(ctx)
+
+	svc.deactivateAllGroups(ctx)
+
+	drainCtx, cancel := context.WithTimeout(ctx, accountDeleteDrainTimeout)
+	defer cancel()
+	if err := svc.eventHandler.Close(drainCtx); err != nil {
+		svc.logger.Warn("unable to drain the event handler", zap.Error(err))
+	}
+
+	svc.unpinAvatar(ctx, acc.GetAvatarCID())
+
+	svc.handlerMutex.Lock()
+	err = svc.db.Wipe()
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Wiped local data")
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountDeleted, &mt.StreamEvent_AccountDeleted{PublicKey: acc.GetPublicKey()}, false); err != nil {
+		svc.logger.Error("unable to dispatch account deletion", zap.Error(err))
+	}
+
+	return &mt.AccountDelete_Reply{}, nil
+}
+
+func (svc *service) sendAccountDeleted(ctx context.Context) {
+	convs, err := svc.db.GetAllConversations()
+	if err != nil {
+		svc.logger.Error("unable to get conversations", zap.Error(err))
+		return
+	}
+
+	for _, conv := range convs {
+		if conv.GetType() != mt.Conversation_ContactType && conv.GetType() != mt.Conversation_MultiMemberType {
+			continue
+		}
+
+		gpkb, err := messengerutil.B64DecodeBytes(conv.GetPublicKey())
+		if err != nil {
+			svc.logger.Error("unable to decode conversation pk", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), zap.Error(err))
+			continue
+		}
+
+		am, err := mt.AppMessage_TypeAccountDeleted.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &mt.AppMessage_AccountDeleted{})
+		if err != nil {
+			svc.logger.Error("unable to marshal account deletion", zap.Error(err))
+			return
+		}
+
+		if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+			svc.logger.Warn("unable to send account deletion", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), zap.Error(err))
+			continue
+		}
+	}
+}
+
+// deactivateAllGroups stops the subscriptions to every group, they won't be
+// resubscribed when the app becomes active again
+func (svc *service) deactivateAllGroups(ctx context.Context) {
+	svc.subsMutex.Lock()
+	defer svc.subsMutex.Unlock()
+
+	for groupPK := range svc.groupsToSubTo {
+		gpkb, err := messengerutil.B64DecodeBytes(groupPK)
+		if err != nil {
+			svc.logger.Error("unable to deactivate group, decode error", zap.String("gpk", groupPK), zap.Error(err))
+			continue
+		}
+
+		if _, err := svc.protocolClient.DeactivateGroup(ctx, &protocoltypes.DeactivateGroup_Request{GroupPK: gpkb}); err != nil {
+			svc.logger.Warn("unable to deactivate group", zap.String("gpk", groupPK), zap.Error(err))
+		}
+	}
+
+	svc.groupSubscriber.UnsubscribeAll()
+	if svc.cancelSubsCtx != nil {
+		svc.cancelSubsCtx()
+	}
+
+	svc.subsCtx = nil
+	svc.cancelSubsCtx = nil
+	svc.groupsToSubTo = make(map[string]struct{})
+}
+
+func (svc *service) unpinAvatar(ctx context.Context, avatarCID string) {
+	if svc.ipfsCoreAPI == nil || avatarCID == "" {
+		return
+	}
+
+	cid, err := ipfscid.Decode(avatarCID)
+	if err != nil {
+		svc.logger.Warn("unable to decode avatar cid", zap.Error(err))
+		return
+	}
+
+	if err := svc.ipfsCoreAPI.Pin().Rm(ctx, ipfs_path.IpfsPath(cid)); err != nil {
+		svc.logger.Warn("unable to unpin avatar", zap.Error(err))
+	}
+}
@@ -0,0 +1,55 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+// ActivitySend sends the current activity of the account to a conversation,
+// clients are expected to call it again before mt.ActivityTimeout elapses to
+// keep the activity alive
+func (svc *service) ActivitySend(ctx context.Context, req *mt.ActivitySend_Request) (*mt.ActivitySend_Reply, error) {
+	for _, kind := range req.GetKinds() {
+		if _, ok := mt.AppMessage_ActivityKind_name[int32(kind)]; !ok || kind == mt.AppMessage_ActivityUndefined {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown activity kind: %d", kind))
+		}
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	if _, err := svc.db.GetConversationByPK(req.GetConversationPublicKey()); err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	if _, disabled, err := svc.db.GetReceiptPrivacy(req.GetConversationPublicKey()); err != nil {
+		return nil, err
+	} else if disabled {
+		return &mt.ActivitySend_Reply{}, nil
+	}
+
+	am, err := mt.AppMessage_TypeActivity.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &mt.AppMessage_Activity{
+		Kinds: mt.SanitizeActivityKinds(req.GetKinds()),
+	})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	if err := svc.outboundLimiter.Wait(ctx, mt.AppMessage_TypeActivity); err != nil {
+		return nil, err
+	}
+
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return &mt.ActivitySend_Reply{}, nil
+}
@@ -142,6 +142,7 @@ func (svc *service) internalInstanceShareableBertyID(ctx context.Context, req *m
 		AccountPK:            config.AccountPK,
 	}
 	link := id.GetBertyLink()
+	link.ExpiresAt = req.ExpiresAt
 
 	if req.Passphrase != nil && string(req.Passphrase) != "" {
 		link, err = bertylinks.EncryptLink(link, req.Passphrase)
@@ -175,10 +176,38 @@ func (svc *service) ParseDeepLink(_ context.Context, req *messengertypes.ParseDe
 		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
 	}
 	ret.Link = link
+	ret.Expired = link.IsExpired(time.Now())
 
 	return &ret, nil
 }
 
+func (svc *service) PreviewGroupInvitation(_ context.Context, req *messengertypes.PreviewGroupInvitation_Request) (*messengertypes.PreviewGroupInvitation_Reply, error) {
+	if req == nil {
+		return nil, errcode.ErrMissingInput
+	}
+
+	preview, err := messengerutil.GroupInvitationPreview(req.GetLink(), req.GetPassphrase())
+	if err != nil {
+		svc.logger.Error("unable to preview group invitation", logutil.PrivateString("link", req.GetLink()), zap.Error(err))
+		return nil, err
+	}
+
+	if err := svc.db.SetGroupInvitationMembership(preview); err != nil {
+		return nil, err
+	}
+
+	if preview.GetGroupPublicKey() != "" {
+		if preview.DuplicateOfCID, err = svc.db.FirstGroupInvitationCID(preview.GetGroupPublicKey(), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return &messengertypes.PreviewGroupInvitation_Reply{
+		Preview: preview,
+		Expired: preview.GetExpiresAt() != 0 && preview.GetExpiresAt() <= messengerutil.TimestampMs(time.Now()),
+	}, nil
+}
+
 func (svc *service) ShareableBertyGroup(ctx context.Context, req *messengertypes.ShareableBertyGroup_Request) (*messengertypes.ShareableBertyGroup_Reply, error) {
 	if req == nil {
 		return nil, errcode.ErrInvalidInput
@@ -194,8 +223,11 @@ func (svc *service) ShareableBertyGroup(ctx context.Context, req *messengertypes
 	group := &messengertypes.BertyGroup{
 		Group:       grpInfo.Group,
 		DisplayName: req.GroupName,
+		Description: req.Description,
+		AvatarCID:   req.AvatarCID,
 	}
 	link := group.GetBertyLink()
+	link.ExpiresAt = req.ExpiresAt
 	internal, web, err := bertylinks.MarshalLink(link)
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
@@ -291,7 +323,7 @@ func (svc *service) SystemInfo(ctx context.Context, req *messengertypes.SystemIn
 		var err error
 		process, err = sysutil.SystemInfoProcess()
 		errs = multierr.Append(errs, err)
-		reply.Messenger = &messengertypes.SystemInfo_Messenger{Process: process}
+		reply.Messenger = &messengertypes.SystemInfo_Messenger{Process: process, OutboundRateLimits: svc.outboundLimiter.Stats()}
 		reply.Messenger.Process.StartedAt = svc.startedAt.Unix()
 		reply.Messenger.Process.UptimeMS = time.Since(svc.startedAt).Milliseconds()
 	}
@@ -505,6 +537,17 @@ func (svc *service) EventStream(req *messengertypes.EventStream_Request, sub mes
 		}
 	}
 
+	// the clients learn about the replay running or done before they subscribed
+	if progress := svc.replayProgress.Last(); progress != nil {
+		p, err := proto.Marshal(progress)
+		if err != nil {
+			return err
+		}
+		if err := sub.Send(&messengertypes.EventStream_Reply{Event: &messengertypes.StreamEvent{Type: messengertypes.StreamEvent_TypeReplayProgress, Payload: p, IsNew: false}}); err != nil {
+			return err
+		}
+	}
+
 	// signal that we're done sending existing models
 	{
 		p, err := proto.Marshal(&messengertypes.StreamEvent_ListEnded{})
@@ -695,6 +738,9 @@ func (svc *service) ConversationJoin(ctx context.Context, req *messengertypes.Co
 	if !link.IsGroup() {
 		return nil, errcode.ErrInvalidInput
 	}
+	if link.IsExpired(time.Now()) {
+		return nil, errcode.ErrMessengerDeepLinkExpired
+	}
 
 	svc.handlerMutex.Lock()
 	defer svc.handlerMutex.Unlock()
@@ -736,6 +782,11 @@ func (svc *service) ConversationJoin(ctx context.Context, req *messengertypes.Co
 		return nil, err
 	}
 
+	// the archive of a group left before is written to again
+	if _, err := svc.db.MarkConversationRejoined(conv.PublicKey); err != nil {
+		return nil, err
+	}
+
 	// dispatch event
 	{
 		err := svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypeConversationUpdated, &messengertypes.StreamEvent_ConversationUpdated{Conversation: &conv}, isNew)
@@ -758,6 +809,12 @@ func (svc *service) AccountUpdate(ctx context.Context, req *messengertypes.Accou
 	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Updating account")
 	defer func() { endSection(err, "") }()
 
+	if req.GetUpdateProfile() {
+		if err := messengerutil.CheckProfile(req.GetBio(), req.GetLinks()); err != nil {
+			return nil, err
+		}
+	}
+
 	svc.handlerMutex.Lock()
 	defer svc.handlerMutex.Unlock()
 
@@ -768,28 +825,36 @@ func (svc *service) AccountUpdate(ctx context.Context, req *messengertypes.Accou
 			return errcode.TODO.Wrap(err)
 		}
 
-		updated := false
 		dn := req.GetDisplayName()
-		if dn != "" && dn != acc.GetDisplayName() {
-			updated = true
-		}
+		updateName := dn != "" && dn != acc.GetDisplayName()
 
-		if !updated {
+		if !updateName && !req.GetUpdateProfile() {
 			svc.logger.Debug("AccountUpdate: nothing to do")
 			return nil
 		}
-		svc.logger.Debug("AccountUpdate: updating account", logutil.PrivateString("display_name", dn))
 
-		ret, err := svc.internalInstanceShareableBertyID(ctx, &messengertypes.InstanceShareableBertyID_Request{DisplayName: dn})
-		if err != nil {
-			svc.logger.Error("AccountUpdate: account link", zap.Error(err))
-			return err
+		if updateName {
+			svc.logger.Debug("AccountUpdate: updating account", logutil.PrivateString("display_name", dn))
+
+			ret, err := svc.internalInstanceShareableBertyID(ctx, &messengertypes.InstanceShareableBertyID_Request{DisplayName: dn})
+			if err != nil {
+				svc.logger.Error("AccountUpdate: account link", zap.Error(err))
+				return err
+			}
+
+			acc, err = tx.UpdateAccount(acc.PublicKey, ret.GetWebURL(), dn)
+			if err != nil {
+				svc.logger.Error("AccountUpdate: updating account in db", zap.Error(err))
+				return err
+			}
 		}
 
-		acc, err = tx.UpdateAccount(acc.PublicKey, ret.GetWebURL(), dn)
-		if err != nil {
-			svc.logger.Error("AccountUpdate: updating account in db", zap.Error(err))
-			return err
+		if req.GetUpdateProfile() {
+			acc, err = tx.UpdateAccountProfile(req.GetBio(), req.GetLinks())
+			if err != nil {
+				svc.logger.Error("AccountUpdate: updating account profile in db", zap.Error(err))
+				return err
+			}
 		}
 
 		// dispatch event
@@ -804,16 +869,7 @@ func (svc *service) AccountUpdate(ctx context.Context, req *messengertypes.Accou
 		return nil, err
 	}
 
-	convos, err := svc.db.GetAllConversations()
-	if err != nil {
-		svc.logger.Error("AccountUpdate: get conversations", zap.Error(err))
-	} else {
-		for _, conv := range convos {
-			if err := svc.sendAccountUserInfo(ctx, conv.GetPublicKey()); err != nil {
-				svc.logger.Error("AccountUpdate: send user info", zap.Error(err))
-			}
-		}
-	}
+	svc.broadcastAccountUserInfo(ctx)
 
 	svc.logger.Debug("AccountUpdate finished", zap.Error(err))
 	return &messengertypes.AccountUpdate_Reply{}, err
@@ -823,16 +879,15 @@ func (svc *service) ContactRequest(ctx context.Context, req *messengertypes.Cont
 	ctx, _, endSection := tyber.Section(ctx, svc.logger, fmt.Sprintf("Sending contact request to %s", req.Link))
 	defer func() { endSection(err, "") }()
 
-	link, err := bertylinks.UnmarshalLink(req.GetLink(), req.Passphrase)
+	link, err := messengerutil.ContactRequestLink(req.GetLink(), req.Passphrase, time.Now())
 	if err != nil {
-		svc.logger.Error("unable to parse deeplink", logutil.PrivateString("link", req.Link), zap.Error(err))
-		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
-	}
-	if link.Kind == messengertypes.BertyLink_EncryptedV1Kind {
-		return nil, errcode.ErrMessengerDeepLinkRequiresPassphrase
+		svc.logger.Error("unable to use deeplink", logutil.PrivateString("link", req.Link), zap.Error(err))
+		return nil, err
 	}
-	if !link.IsContact() {
-		return nil, errcode.ErrMessengerInvalidDeepLink.Wrap(err)
+
+	introduction, err := messengerutil.ContactRequestIntroduction(req.GetIntroduction())
+	if err != nil {
+		return nil, err
 	}
 
 	contactDisplayName := link.GetBertyID().GetDisplayName()
@@ -848,7 +903,7 @@ func (svc *service) ContactRequest(ctx context.Context, req *messengertypes.Cont
 	if err != nil {
 		return nil, errcode.TODO.Wrap(err)
 	}
-	om, err := proto.Marshal(&messengertypes.ContactMetadata{DisplayName: acc.GetDisplayName()})
+	om, err := proto.Marshal(&messengertypes.ContactMetadata{DisplayName: acc.GetDisplayName(), Introduction: introduction})
 	if err != nil {
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
@@ -926,6 +981,32 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 		return nil, errcode.ErrMissingInput
 	}
 
+	if messengerutil.IsLocalOnlyType(payloadType) {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s interactions are generated locally", strings.TrimPrefix(payloadType.String(), "Type")))
+	}
+
+	if gpk == messengertypes.SystemConversationPublicKey {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("nothing can be sent in the system conversation"))
+	}
+
+	if conv, err := svc.db.GetConversationByPK(gpk); err == nil && conv.GetLeftDate() > 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the conversation was left, it is a read-only archive"))
+	}
+
+	if messengerutil.RequiresTarget(payloadType) && req.GetTargetCID() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a %s requires the cid of the targeted message", strings.TrimPrefix(payloadType.String(), "Type")))
+	}
+
+	if issue, err := svc.slowModeIssue(gpk, payloadType, messengerutil.TimestampMs(time.Now())); err != nil {
+		return nil, err
+	} else if issue != nil {
+		return nil, slowModeIssueError(issue)
+	}
+
+	if len(req.GetPayload()) > messengerutil.InteractionPayloadMaxSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("payload is too large: %d bytes, max is %d", len(req.GetPayload()), messengerutil.InteractionPayloadMaxSize))
+	}
+
 	gpkb, err := messengerutil.B64DecodeBytes(gpk)
 	if err != nil {
 		return nil, errcode.ErrInvalidInput.Wrap(err)
@@ -940,7 +1021,26 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 	}
 	tyber.LogStep(ctx, svc.logger, "Unmarshaled payload", tyber.WithJSONDetail("AppMessagePayload", payload))
 
-	fp, err := req.GetType().MarshalPayload(messengerutil.TimestampMs(time.Now()), req.GetTargetCID(), payload)
+	if err := messengerutil.ValidateInteractionPayload(payload); err != nil {
+		return nil, err
+	}
+
+	if msg, ok := payload.(*messengertypes.AppMessage_UserMessage); ok {
+		if err := svc.completeForwardOrigin(msg); err != nil {
+			return nil, err
+		}
+	}
+
+	// only use the compact encoding when every device of the conversation can read it
+	marshalPayload := req.GetType().MarshalPayload
+	if compact, err := svc.db.ConversationSupportsCompactPayload(gpk); err != nil {
+		svc.logger.Warn("unable to check compact payload support", logutil.PrivateString("conversation-pk", gpk), zap.Error(err))
+	} else if compact {
+		marshalPayload = req.GetType().MarshalCompactPayload
+	}
+
+	sentDate := messengerutil.TimestampMs(time.Now())
+	fp, err := marshalPayload(sentDate, req.GetTargetCID(), payload)
 	if err != nil {
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
@@ -955,7 +1055,19 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 		cidBytes = reply.GetCID()
 	} else {
 		reply, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: fp})
-		if err != nil {
+		if err != nil && isQueueable(payloadType) {
+			// the message is sent once the node can send it again
+			svc.logger.Warn("unable to send message, queuing it", logutil.PrivateString("conversation-pk", gpk), zap.Error(err))
+			queuedCID, err := svc.enqueueInteraction(gpk, payloadType, req.GetPayload(), req.GetTargetCID(), sentDate, fp)
+			if err != nil {
+				return nil, err
+			}
+
+			if newTrace {
+				tyber.LogTraceEnd(ctx, svc.logger, "Queued interaction", tyber.WithDetail("CID", queuedCID))
+			}
+			return &messengertypes.Interact_Reply{CID: queuedCID}, nil
+		} else if err != nil {
 			return nil, errcode.ErrProtocolSend.Wrap(err)
 		}
 		cidBytes = reply.GetCID()
@@ -983,6 +1095,10 @@ func (svc *service) Interact(ctx context.Context, req *messengertypes.Interact_R
 		go svc.interactionDelayedActions(cid, gpkb)
 	}
 
+	if msg, ok := payload.(*messengertypes.AppMessage_UserMessage); ok {
+		svc.queueLinkPreviews(cid.String(), msg)
+	}
+
 	return &messengertypes.Interact_Reply{CID: cid.String()}, nil
 }
 
@@ -994,6 +1110,14 @@ func (svc *service) AccountGet(ctx context.Context, req *messengertypes.AccountG
 	return &messengertypes.AccountGet_Reply{Account: acc}, nil
 }
 
+func (svc *service) GetBootSnapshot(ctx context.Context, req *messengertypes.GetBootSnapshot_Request) (*messengertypes.GetBootSnapshot_Reply, error) {
+	if req.GetConversationAmount() < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid conversation amount: %d", req.GetConversationAmount()))
+	}
+
+	return svc.db.GetBootSnapshot(req.GetConversationAmount())
+}
+
 func (svc *service) EchoTest(req *messengertypes.EchoTest_Request, srv messengertypes.MessengerService_EchoTestServer) error {
 	if req.TriggerError {
 		return errcode.ErrTestEcho
@@ -1035,14 +1159,20 @@ func (svc *service) ConversationOpen(ctx context.Context, req *messengertypes.Co
 		return nil, errcode.ErrMissingInput
 	}
 
+	now := time.Now()
 	ret := messengertypes.ConversationOpen_Reply{}
+	if req.GetSessionID() != "" {
+		ret.ExpiresDate = messengerutil.TimestampMs(now.Add(messengertypes.ConversationSessionTTL))
+	}
 
 	if err := svc.monitorGroupPeersStatus(req.GroupPK); err != nil {
 		// only log an error here
 		svc.logger.Error("unable to monitor group peer status", zap.Error(err))
 	}
 
-	conv, updated, err := svc.db.SetConversationIsOpenStatus(req.GetGroupPK(), true)
+	svc.handlerMutex.Lock()
+	conv, updated, err := svc.db.OpenConversationSession(req.GetGroupPK(), req.GetSessionID(), now)
+	svc.handlerMutex.Unlock()
 
 	if err != nil {
 		return nil, err
@@ -1050,6 +1180,8 @@ func (svc *service) ConversationOpen(ctx context.Context, req *messengertypes.Co
 		return &ret, nil
 	}
 
+	svc.sendReadReceiptAsync(conv)
+
 	if err := svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypeConversationUpdated, &messengertypes.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
 		return nil, errcode.TODO.Wrap(err)
 	}
@@ -1062,8 +1194,9 @@ func (svc *service) monitorGroupPeersStatus(groupPK string) error {
 	defer svc.muCancelGroupStatus.Unlock()
 
 	if _, found := svc.cancelGroupStatus[groupPK]; found {
-		// skip if already have a monitor group in progress
-		return fmt.Errorf("monitor peer status for group already running")
+		// skip if already have a monitor group in progress, the heartbeats
+		// of the sessions get there too
+		return nil
 	}
 
 	rawGroupPK, err := messengerutil.B64DecodeBytes(groupPK)
@@ -1178,7 +1311,9 @@ func (svc *service) ConversationClose(ctx context.Context, req *messengertypes.C
 
 	ret := messengertypes.ConversationClose_Reply{}
 
-	conv, updated, err := svc.db.SetConversationIsOpenStatus(req.GetGroupPK(), false)
+	svc.handlerMutex.Lock()
+	conv, updated, err := svc.db.CloseConversationSession(req.GetGroupPK(), req.GetSessionID(), time.Now())
+	svc.handlerMutex.Unlock()
 
 	if err != nil {
 		return nil, err
@@ -1186,20 +1321,32 @@ func (svc *service) ConversationClose(ctx context.Context, req *messengertypes.C
 		return &ret, nil
 	}
 
+	if err := svc.conversationClosed(conv); err != nil {
+		return nil, err
+	}
+
+	// FIXME: trigger update
+	return &ret, nil
+}
+
+// conversationClosed stops monitoring the peers of a conversation closed
+// along with its last session and notifies the clients
+func (svc *service) conversationClosed(conv *messengertypes.Conversation) error {
+	svc.sendReadReceiptAsync(conv)
+
 	// stop monitoring peer status
 	svc.muCancelGroupStatus.Lock()
-	if cancel, found := svc.cancelGroupStatus[req.GroupPK]; found {
+	if cancel, found := svc.cancelGroupStatus[conv.GetPublicKey()]; found {
 		cancel()
-		delete(svc.cancelGroupStatus, req.GroupPK)
+		delete(svc.cancelGroupStatus, conv.GetPublicKey())
 	}
 	svc.muCancelGroupStatus.Unlock()
 
 	if err := svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypeConversationUpdated, &messengertypes.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
-		return nil, errcode.TODO.Wrap(err)
+		return errcode.TODO.Wrap(err)
 	}
 
-	// FIXME: trigger update
-	return &ret, nil
+	return nil
 }
 
 func (svc *service) ServicesTokenList(req *protocoltypes.ServicesTokenList_Request, server messengertypes.MessengerService_ServicesTokenListServer) error {
@@ -1413,6 +1560,36 @@ func (svc *service) ConversationMute(ctx context.Context, request *messengertype
 	return &messengertypes.ConversationMute_Reply{}, nil
 }
 
+func (svc *service) ConversationFocus(ctx context.Context, request *messengertypes.ConversationFocus_Request) (*messengertypes.ConversationFocus_Reply, error) {
+	if request.GetConversationPublicKey() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	duration := time.Duration(request.GetDuration()) * time.Second
+	if request.GetDuration() < 0 || duration > messengertypes.ConversationFocusMaxDuration {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid focus duration: %d, max is %d", request.GetDuration(), int64(messengertypes.ConversationFocusMaxDuration/time.Second)))
+	}
+
+	focusedUntil := int64(0)
+	if duration > 0 {
+		focusedUntil = messengerutil.TimestampMs(time.Now().Add(duration))
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	conversation, err := svc.db.SetConversationFocus(request.GetConversationPublicKey(), focusedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypeConversationUpdated, &messengertypes.StreamEvent_ConversationUpdated{Conversation: conversation}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	return &messengertypes.ConversationFocus_Reply{FocusedUntil: focusedUntil}, nil
+}
+
 func (svc *service) AccountPushConfigure(ctx context.Context, request *messengertypes.AccountPushConfigure_Request) (*messengertypes.AccountPushConfigure_Reply, error) {
 	updatedFields := map[string]interface{}{}
 
@@ -1447,6 +1624,20 @@ func (svc *service) AccountPushConfigure(ctx context.Context, request *messenger
 		updatedFields["hide_in_app_notifications"] = false
 	}
 
+	switch {
+	case request.EnableQuietHours && request.DisableQuietHours:
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("can't enable and disable quiet hours simultaneously"))
+	case request.EnableQuietHours:
+		if err := messengertypes.ValidateQuietHours(request.QuietHoursStart, request.QuietHoursEnd); err != nil {
+			return nil, err
+		}
+		updatedFields["quiet_hours_enabled"] = true
+		updatedFields["quiet_hours_start"] = request.QuietHoursStart
+		updatedFields["quiet_hours_end"] = request.QuietHoursEnd
+	case request.DisableQuietHours:
+		updatedFields["quiet_hours_enabled"] = false
+	}
+
 	if err := svc.db.UpdateAccountFields(updatedFields); err != nil {
 		return nil, errcode.ErrInternal.Wrap(err)
 	}
@@ -1463,7 +1654,40 @@ func (svc *service) AccountPushConfigure(ctx context.Context, request *messenger
 	return &messengertypes.AccountPushConfigure_Reply{}, nil
 }
 
+func (svc *service) AccountSnoozeNotifications(ctx context.Context, request *messengertypes.AccountSnoozeNotifications_Request) (*messengertypes.AccountSnoozeNotifications_Reply, error) {
+	if request.GetDuration() < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid snooze duration: %d", request.GetDuration()))
+	}
+
+	snoozedUntil := int64(0)
+	if request.GetDuration() > 0 {
+		snoozedUntil = messengerutil.TimestampMs(time.Now().Add(time.Duration(request.GetDuration()) * time.Second))
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	if err := svc.db.UpdateAccountFields(map[string]interface{}{"notifications_snoozed_until": snoozedUntil}); err != nil {
+		return nil, errcode.ErrDBWrite.Wrap(err)
+	}
+
+	account, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := svc.dispatcher.StreamEvent(messengertypes.StreamEvent_TypeAccountUpdated, &messengertypes.StreamEvent_AccountUpdated{Account: account}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	return &messengertypes.AccountSnoozeNotifications_Reply{SnoozedUntil: snoozedUntil}, nil
+}
+
 func (svc *service) MessageSearch(ctx context.Context, request *messengertypes.MessageSearch_Request) (*messengertypes.MessageSearch_Reply, error) {
+	if !svc.featureFlags.Enabled(messengertypes.FeatureFlag_FeatureMessageSearch) {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("message search is disabled"))
+	}
+
 	results, err := svc.db.InteractionsSearch(request.Query, &messengerdb.SearchOptions{
 		BeforeDate:     int(request.BeforeDate),
 		AfterDate:      int(request.AfterDate),
@@ -1704,6 +1928,17 @@ func (svc *service) ListMemberDevices(request *messengertypes.ListMemberDevices_
 	return nil
 }
 
+// ContactKeyHistory reports the devices ever seen for the contacts and the
+// changes since their first devices were pinned
+func (svc *service) ContactKeyHistory(ctx context.Context, req *messengertypes.ContactKeyHistory_Request) (*messengertypes.ContactKeyHistory_Reply, error) {
+	contacts, err := svc.db.GetContactKeyHistory(req.GetContactPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &messengertypes.ContactKeyHistory_Reply{Contacts: contacts}, nil
+}
+
 func (svc *service) PushShareTokenForConversation(ctx context.Context, request *messengertypes.PushShareTokenForConversation_Request) (*messengertypes.PushShareTokenForConversation_Reply, error) {
 	conv, err := svc.db.GetConversationByPK(request.ConversationPK)
 	if err != nil {
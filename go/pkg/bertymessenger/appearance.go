@@ -0,0 +1,78 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+func (svc *service) ConversationSetAppearance(ctx context.Context, req *mt.ConversationSetAppearance_Request) (_ *mt.ConversationSetAppearance_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Setting conversation appearance")
+	defer func() { endSection(err, "") }()
+
+	convPK := req.GetConversationPublicKey()
+	if convPK == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	if len(req.GetWallpaper()) > 0 && req.GetResetWallpaper() {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("can't set and reset the wallpaper simultaneously"))
+	}
+
+	if len(req.GetNotificationSound()) > 0 && req.GetResetNotificationSound() {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("can't set and reset the notification sound simultaneously"))
+	}
+
+	var wallpaper, notificationSound *mt.Media
+	if len(req.GetWallpaper()) > 0 {
+		if wallpaper, err = messengerutil.NewWallpaperMedia(req.GetWallpaper()); err != nil {
+			return nil, err
+		}
+	}
+	if len(req.GetNotificationSound()) > 0 {
+		if notificationSound, err = messengerutil.NewNotificationSoundMedia(req.GetNotificationSound()); err != nil {
+			return nil, err
+		}
+	}
+
+	var conversation *mt.Conversation
+	svc.handlerMutex.Lock()
+	err = svc.db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		if wallpaper != nil || req.GetResetWallpaper() {
+			if err := tx.SetConversationWallpaper(convPK, wallpaper); err != nil {
+				return err
+			}
+		}
+
+		if notificationSound != nil || req.GetResetNotificationSound() {
+			if err := tx.SetConversationNotificationSound(convPK, notificationSound); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if conversation, err = tx.GetConversationByPK(convPK); err != nil {
+			return errcode.ErrNotFound.Wrap(err)
+		}
+
+		return nil
+	})
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	// drop the replaced medias
+	svc.pruneMedias()
+
+	return &mt.ConversationSetAppearance_Reply{Conversation: conversation}, nil
+}
@@ -0,0 +1,63 @@
+package bertymessenger
+
+import (
+	"bufio"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	auditExportChunkSize = 32 * 1024
+	auditExportBatchSize = 500
+)
+
+// auditExportSender sends each write as a chunk of the export
+type auditExportSender struct {
+	server mt.MessengerService_ConversationAuditExportServer
+}
+
+func (s auditExportSender) Write(p []byte) (int, error) {
+	if err := s.server.Send(&mt.ConversationAuditExport_Reply{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (svc *service) ConversationAuditExport(req *mt.ConversationAuditExport_Request, server mt.MessengerService_ConversationAuditExportServer) error {
+	if req.GetConversationPublicKey() == "" {
+		return errcode.ErrMissingInput
+	}
+
+	if _, err := svc.db.GetConversationByPK(req.GetConversationPublicKey()); err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriterSize(auditExportSender{server: server}, auditExportChunkSize)
+	w, err := messengerutil.NewAuditWriter(buf, req.GetFormat())
+	if err != nil {
+		return err
+	}
+
+	if err := svc.db.IterateConversationAuditRecords(req.GetConversationPublicKey(), auditExportBatchSize, func(records []*mt.ConversationAuditExport_Record) error {
+		for _, r := range records {
+			if err := w.Write(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := buf.Flush(); err != nil {
+		return errcode.ErrStreamWrite.Wrap(err)
+	}
+
+	return nil
+}
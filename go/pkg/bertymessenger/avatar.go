@@ -0,0 +1,226 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	ipfscid "github.com/ipfs/go-cid"
+	ipfs_files "github.com/ipfs/go-ipfs-files"
+	ipfs_options "github.com/ipfs/interface-go-ipfs-core/options"
+	ipfs_path "github.com/ipfs/interface-go-ipfs-core/path"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+const avatarFetchTimeout = 30 * time.Second
+
+func (svc *service) SetAvatar(ctx context.Context, req *mt.SetAvatar_Request) (_ *mt.SetAvatar_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Setting account avatar")
+	defer func() { endSection(err, "") }()
+
+	if svc.ipfsCoreAPI == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("avatars require an IPFS node"))
+	}
+
+	avatar, err := messengerutil.ResizeAvatar(req.GetImage())
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := svc.ipfsCoreAPI.Unixfs().Add(ctx, ipfs_files.NewBytesFile(avatar), ipfs_options.Unixfs.Pin(true), ipfs_options.Unixfs.CidVersion(1))
+	if err != nil {
+		return nil, errcode.ErrIPFSAdd.Wrap(err)
+	}
+	cid := resolved.Cid().String()
+	tyber.LogStep(ctx, svc.logger, "Added avatar to IPFS", tyber.WithCIDDetail("CID", resolved.Cid().Bytes()))
+
+	svc.handlerMutex.Lock()
+	err = svc.db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		if err := tx.AddMedia(&mt.Media{CID: cid, MimeType: messengerutil.AvatarMimeType, Data: avatar}); err != nil {
+			return err
+		}
+
+		if err := tx.UpdateAccountFields(map[string]interface{}{"avatar_cid": cid}); err != nil {
+			return errcode.ErrDBWrite.Wrap(err)
+		}
+
+		acc, err := tx.GetAccount()
+		if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false)
+	})
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	svc.broadcastAccountUserInfo(ctx)
+	svc.pruneMedias()
+
+	return &mt.SetAvatar_Reply{AvatarCID: cid}, nil
+}
+
+func (svc *service) AvatarGet(ctx context.Context, req *mt.AvatarGet_Request) (*mt.AvatarGet_Reply, error) {
+	if req.GetAvatarCID() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	media, err := svc.db.GetMediaByCID(req.GetAvatarCID())
+	if err == nil {
+		return &mt.AvatarGet_Reply{Media: media}, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if svc.ipfsCoreAPI == nil {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("avatar is not cached and there is no IPFS node to fetch it"))
+	}
+
+	// don't wait for the fetch timeout when no peer can provide the avatar
+	if svc.isOffline() {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("avatar is not cached and the node is offline"))
+	}
+
+	fetch := svc.resolveAvatar(req.GetAvatarCID())
+	if req.GetNoWait() {
+		return &mt.AvatarGet_Reply{}, nil
+	}
+
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if fetch.err != nil {
+		return nil, fetch.err
+	}
+
+	return &mt.AvatarGet_Reply{Media: fetch.media}, nil
+}
+
+// avatarFetch is the pending fetch of an avatar, media and err are set once
+// done is closed
+type avatarFetch struct {
+	done  chan struct{}
+	media *mt.Media
+	err   error
+}
+
+// resolveAvatar fetches and caches an avatar in the background, concurrent
+// calls for the same CID share the same fetch. The contacts and members using
+// the avatar are streamed once it is cached so clients can display it.
+func (svc *service) resolveAvatar(cid string) *avatarFetch {
+	svc.muAvatarFetches.Lock()
+	defer svc.muAvatarFetches.Unlock()
+
+	if fetch, ok := svc.avatarFetches[cid]; ok {
+		return fetch
+	}
+
+	fetch := &avatarFetch{done: make(chan struct{})}
+	svc.avatarFetches[cid] = fetch
+
+	go func() {
+		fetch.media, fetch.err = svc.fetchAndCacheAvatar(svc.ctx, cid)
+		if fetch.err != nil {
+			svc.logger.Warn("unable to fetch avatar", zap.String("cid", cid), zap.Error(fetch.err))
+		}
+
+		svc.muAvatarFetches.Lock()
+		delete(svc.avatarFetches, cid)
+		svc.muAvatarFetches.Unlock()
+
+		close(fetch.done)
+	}()
+
+	return fetch
+}
+
+func (svc *service) fetchAndCacheAvatar(ctx context.Context, cid string) (*mt.Media, error) {
+	data, err := svc.fetchAvatar(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("avatar is not an image: %s", mimeType))
+	}
+
+	media := &mt.Media{CID: cid, MimeType: mimeType, Data: data}
+	if err := svc.db.AddMedia(media); err != nil {
+		return nil, err
+	}
+
+	svc.pruneMedias()
+
+	contacts, members, err := svc.db.GetAvatarUsers(cid)
+	if err != nil {
+		svc.logger.Warn("unable to list avatar users", zap.String("cid", cid), zap.Error(err))
+		return media, nil
+	}
+
+	for _, contact := range contacts {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+			svc.logger.Warn("unable to stream contact update", zap.Error(err))
+		}
+	}
+	for _, member := range members {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: member}, false); err != nil {
+			svc.logger.Warn("unable to stream member update", zap.Error(err))
+		}
+	}
+
+	return media, nil
+}
+
+func (svc *service) fetchAvatar(ctx context.Context, cidStr string) ([]byte, error) {
+	cid, err := ipfscid.Decode(cidStr)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, avatarFetchTimeout)
+	defer cancel()
+
+	node, err := svc.ipfsCoreAPI.Unixfs().Get(ctx, ipfs_path.IpfsPath(cid))
+	if err != nil {
+		return nil, errcode.ErrIPFSGet.Wrap(err)
+	}
+	defer node.Close()
+
+	file := ipfs_files.ToFile(node)
+	if file == nil {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("avatar is not a file"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, messengerutil.AvatarMaxSize+1))
+	if err != nil {
+		return nil, errcode.ErrIPFSGet.Wrap(err)
+	}
+
+	if len(data) > messengerutil.AvatarMaxSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("avatar is larger than %d bytes", messengerutil.AvatarMaxSize))
+	}
+
+	return data, nil
+}
+
+func (svc *service) pruneMedias() {
+	if _, err := svc.db.PruneMedias(svc.mediaCacheMaxSize); err != nil {
+		svc.logger.Warn("unable to prune medias", zap.Error(err))
+	}
+}
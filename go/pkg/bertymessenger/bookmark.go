@@ -0,0 +1,109 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+func (svc *service) BookmarkInteraction(ctx context.Context, req *mt.BookmarkInteraction_Request) (*mt.BookmarkInteraction_Reply, error) {
+	if req.GetCID() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	inte, err := svc.db.GetInteractionByCID(req.GetCID())
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	bookmark, err := svc.setBookmark(ctx, &mt.Bookmark{InteractionCID: inte.GetCID(), ConversationPublicKey: inte.GetConversationPublicKey()}, req.GetLocalOnly())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.BookmarkInteraction_Reply{Bookmark: bookmark}, nil
+}
+
+func (svc *service) UnbookmarkInteraction(ctx context.Context, req *mt.UnbookmarkInteraction_Request) (*mt.UnbookmarkInteraction_Reply, error) {
+	if req.GetCID() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	// the interaction can be unknown to this device, the bookmark keeps its conversation
+	bookmark := &mt.Bookmark{InteractionCID: req.GetCID(), Removed: true}
+	if inte, err := svc.db.GetInteractionByCID(req.GetCID()); err == nil {
+		bookmark.ConversationPublicKey = inte.GetConversationPublicKey()
+	}
+
+	if _, err := svc.setBookmark(ctx, bookmark, req.GetLocalOnly()); err != nil {
+		return nil, err
+	}
+
+	return &mt.UnbookmarkInteraction_Reply{}, nil
+}
+
+func (svc *service) ListBookmarks(ctx context.Context, req *mt.ListBookmarks_Request) (*mt.ListBookmarks_Reply, error) {
+	bookmarks, interactions, err := svc.db.GetBookmarks(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ListBookmarks_Reply{Bookmarks: bookmarks, Interactions: interactions}, nil
+}
+
+// setBookmark stores a bookmark update and sends it to the other devices of
+// the account on the account group unless localOnly is set
+func (svc *service) setBookmark(ctx context.Context, bookmark *mt.Bookmark, localOnly bool) (*mt.Bookmark, error) {
+	bookmark.UpdatedDate = messengerutil.TimestampMs(time.Now())
+
+	svc.handlerMutex.Lock()
+	changed, err := svc.db.SetBookmark(*bookmark)
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeBookmarkUpdated, &mt.StreamEvent_BookmarkUpdated{Bookmark: bookmark}, false); err != nil {
+			svc.logger.Warn("unable to stream bookmark update", zap.Error(err))
+		}
+	}
+
+	if localOnly {
+		return bookmark, nil
+	}
+
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(acc.GetPublicKey())
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	// the app message is handled by this device too, its date makes it a no-op
+	am, err := mt.AppMessage_TypeBookmark.MarshalPayload(bookmark.GetUpdatedDate(), bookmark.GetInteractionCID(), &mt.AppMessage_Bookmark{
+		ConversationPublicKey: bookmark.GetConversationPublicKey(),
+		Removed:               bookmark.GetRemoved(),
+	})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	// the bookmark is kept locally when the other devices can't be reached
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+		svc.logger.Warn("unable to sync bookmark", logutil.PrivateString("cid", bookmark.GetInteractionCID()), zap.Error(err))
+	}
+
+	return bookmark, nil
+}
@@ -0,0 +1,160 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofrs/uuid"
+	"github.com/gogo/protobuf/proto"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+func (svc *service) BroadcastListSet(ctx context.Context, req *mt.BroadcastListSet_Request) (_ *mt.BroadcastListSet_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Setting broadcast list")
+	defer func() { endSection(err, "") }()
+
+	if req.GetName() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a broadcast list name is required"))
+	}
+
+	list := &mt.BroadcastList{ID: req.GetID(), Name: req.GetName(), CreatedDate: messengerutil.TimestampMs(time.Now())}
+	if list.ID == "" {
+		id, err := uuid.NewV4()
+		if err != nil {
+			return nil, errcode.ErrInternal.Wrap(err)
+		}
+		list.ID = id.String()
+	} else {
+		existing, err := svc.db.GetBroadcastList(list.ID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown broadcast list: %s", list.ID))
+		} else if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+		list.CreatedDate = existing.GetCreatedDate()
+	}
+
+	seen := make(map[string]bool, len(req.GetContactPublicKeys()))
+	for _, pk := range req.GetContactPublicKeys() {
+		if seen[pk] {
+			continue
+		}
+		seen[pk] = true
+
+		contact, err := svc.db.GetContactByPK(pk)
+		if err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown contact %s: %w", pk, err))
+		}
+		if contact.GetState() != mt.Contact_Accepted {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("contact %s is not accepted", pk))
+		}
+
+		list.Recipients = append(list.Recipients, &mt.BroadcastListRecipient{ListID: list.ID, ContactPublicKey: pk})
+	}
+
+	if list, err = svc.db.SaveBroadcastList(list); err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Saved broadcast list", tyber.WithDetail("ID", list.GetID()))
+
+	return &mt.BroadcastListSet_Reply{List: list}, nil
+}
+
+func (svc *service) BroadcastListDelete(ctx context.Context, req *mt.BroadcastListDelete_Request) (*mt.BroadcastListDelete_Reply, error) {
+	if err := svc.db.DeleteBroadcastList(req.GetID()); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown broadcast list: %s", req.GetID()))
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &mt.BroadcastListDelete_Reply{}, nil
+}
+
+func (svc *service) BroadcastListList(ctx context.Context, req *mt.BroadcastListList_Request) (*mt.BroadcastListList_Reply, error) {
+	lists, err := svc.db.GetAllBroadcastLists()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.BroadcastListList_Reply{Lists: lists}, nil
+}
+
+// SendBroadcast sends the message to each recipient separately, a recipient
+// that can't be reached doesn't prevent the others from receiving it, its
+// delivery is reported as failed instead
+func (svc *service) SendBroadcast(ctx context.Context, req *mt.SendBroadcast_Request) (_ *mt.SendBroadcast_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Sending broadcast")
+	defer func() { endSection(err, "") }()
+
+	if req.GetBody() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a broadcast body is required"))
+	}
+
+	list, err := svc.db.GetBroadcastList(req.GetListID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown broadcast list: %s", req.GetListID()))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	payload, err := proto.Marshal(&mt.AppMessage_UserMessage{Body: req.GetBody()})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+
+	broadcast := &mt.Broadcast{ID: id.String(), ListID: list.GetID(), Body: req.GetBody(), SentDate: messengerutil.TimestampMs(time.Now())}
+	for _, recipient := range list.GetRecipients() {
+		delivery := &mt.BroadcastDelivery{BroadcastID: broadcast.ID, ContactPublicKey: recipient.GetContactPublicKey(), State: mt.BroadcastDelivery_Failed}
+		broadcast.Deliveries = append(broadcast.Deliveries, delivery)
+
+		contact, err := svc.db.GetContactByPK(recipient.GetContactPublicKey())
+		if err != nil {
+			delivery.Error = err.Error()
+			continue
+		}
+		delivery.ConversationPublicKey = contact.GetConversationPublicKey()
+
+		reply, err := svc.Interact(ctx, &mt.Interact_Request{
+			Type:                  mt.AppMessage_TypeUserMessage,
+			Payload:               payload,
+			ConversationPublicKey: contact.GetConversationPublicKey(),
+		})
+		if err != nil {
+			delivery.Error = err.Error()
+			continue
+		}
+
+		delivery.InteractionCID = reply.GetCID()
+		delivery.State = mt.BroadcastDelivery_Sent
+	}
+
+	if err := svc.db.AddBroadcast(broadcast); err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Sent broadcast", tyber.WithDetail("ID", broadcast.GetID()), tyber.WithDetail("Recipients", fmt.Sprintf("%d", len(broadcast.GetDeliveries()))))
+
+	return &mt.SendBroadcast_Reply{Broadcast: broadcast}, nil
+}
+
+func (svc *service) BroadcastReport(ctx context.Context, req *mt.BroadcastReport_Request) (*mt.BroadcastReport_Reply, error) {
+	broadcast, err := svc.db.GetBroadcastReport(req.GetBroadcastID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown broadcast: %s", req.GetBroadcastID()))
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &mt.BroadcastReport_Reply{Broadcast: broadcast}, nil
+}
@@ -0,0 +1,97 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+// ContactRequestBulk sends the contact requests one link at a time, a link
+// failing doesn't stop the others. The requests are enqueued by the protocol
+// until the contacts are reachable.
+func (svc *service) ContactRequestBulk(req *mt.ContactRequestBulk_Request, sub mt.MessengerService_ContactRequestBulkServer) error {
+	links := req.GetLinks()
+	if len(links) == 0 {
+		return errcode.ErrMissingInput
+	}
+
+	if len(links) > messengerutil.ContactRequestBulkMaxLinks {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("too many links: %d, max is %d", len(links), messengerutil.ContactRequestBulkMaxLinks))
+	}
+
+	ctx := sub.Context()
+
+	config, err := svc.protocolClient.InstanceGetConfiguration(ctx, &protocoltypes.InstanceGetConfiguration_Request{})
+	if err != nil {
+		return errcode.TODO.Wrap(err)
+	}
+	ownPK := messengerutil.B64EncodeBytes(config.GetAccountPK())
+
+	requested := map[string]bool{}
+	sent := 0
+	for index, raw := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		reply := &mt.ContactRequestBulk_Reply{Index: int32(index), Handled: int32(index + 1), Total: int32(len(links))}
+
+		link, err := messengerutil.ContactRequestLink(raw, nil, time.Now())
+		if err == nil {
+			reply.ContactPublicKey = messengerutil.B64EncodeBytes(link.GetBertyID().GetAccountPK())
+		}
+
+		switch {
+		case err != nil:
+			reply.Status, reply.Error = mt.ContactRequestBulk_StatusInvalid, err.Error()
+		case reply.ContactPublicKey == ownPK:
+			reply.Status, reply.Error = mt.ContactRequestBulk_StatusInvalid, "link of the own account"
+		case requested[reply.ContactPublicKey]:
+			reply.Status = mt.ContactRequestBulk_StatusDuplicate
+		default:
+			requested[reply.ContactPublicKey] = true
+			reply.Status, err = svc.contactRequestBulkSend(ctx, reply.ContactPublicKey, raw)
+			if err != nil {
+				reply.Error = err.Error()
+			} else if reply.Status == mt.ContactRequestBulk_StatusSent {
+				sent++
+			}
+		}
+
+		if err := sub.Send(reply); err != nil {
+			return err
+		}
+	}
+
+	svc.logger.Info("sent bulk contact requests", zap.Int("links", len(links)), zap.Int("sent", sent))
+
+	return nil
+}
+
+func (svc *service) contactRequestBulkSend(ctx context.Context, contactPK string, link string) (mt.ContactRequestBulk_Status, error) {
+	contact, err := svc.db.GetContactByPK(contactPK)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+	case err != nil:
+		return mt.ContactRequestBulk_StatusFailed, errcode.ErrDBRead.Wrap(err)
+	case contact.GetState() == mt.Contact_Blocked:
+		return mt.ContactRequestBulk_StatusBlocked, nil
+	case contact.GetState() != mt.Contact_Removed && contact.GetState() != mt.Contact_Undefined:
+		return mt.ContactRequestBulk_StatusAlreadyKnown, nil
+	}
+
+	if _, err := svc.ContactRequest(ctx, &mt.ContactRequest_Request{Link: link}); err != nil {
+		return mt.ContactRequestBulk_StatusFailed, err
+	}
+
+	return mt.ContactRequestBulk_StatusSent, nil
+}
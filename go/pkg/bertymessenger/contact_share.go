@@ -0,0 +1,63 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+func (svc *service) AcceptSharedContact(ctx context.Context, req *mt.AcceptSharedContact_Request) (_ *mt.AcceptSharedContact_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Accepting shared contact")
+	defer func() { endSection(err, "") }()
+
+	if req.GetCID() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	i, err := svc.db.GetInteractionByCID(req.GetCID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown interaction: %s", req.GetCID()))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if i.GetType() != mt.AppMessage_TypeContactShare {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("not a shared contact: %s", i.GetType()))
+	}
+
+	payload, err := i.UnmarshalPayload()
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	share := payload.(*mt.AppMessage_ContactShare)
+	link, err := messengerutil.ContactShareLink(share)
+	if err != nil {
+		return nil, err
+	}
+
+	if link.IsExpired(time.Now()) {
+		return nil, errcode.ErrMessengerDeepLinkExpired
+	}
+
+	contactPK := messengerutil.B64EncodeBytes(link.GetBertyID().GetAccountPK())
+	if contact, err := svc.db.GetContactByPK(contactPK); err == nil && contact.GetState() != mt.Contact_Removed {
+		return nil, errcode.ErrDBEntryAlreadyExists.Wrap(fmt.Errorf("already a contact: %s", contactPK))
+	} else if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if _, err := svc.ContactRequest(ctx, &mt.ContactRequest_Request{Link: share.GetLink()}); err != nil {
+		return nil, err
+	}
+
+	return &mt.AcceptSharedContact_Reply{ContactPublicKey: contactPK}, nil
+}
@@ -0,0 +1,33 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) MessageDeliveryInfo(ctx context.Context, req *mt.MessageDeliveryInfo_Request) (*mt.MessageDeliveryInfo_Reply, error) {
+	i, err := svc.db.GetInteractionByCID(req.GetCID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown interaction: %s", req.GetCID()))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	// deliveries are only tracked for own messages
+	if !i.GetIsMine() {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("interaction %s was not sent by this account", req.GetCID()))
+	}
+
+	members, err := svc.db.GetMemberDeliveries(i.GetCID(), i.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.MessageDeliveryInfo_Reply{Members: members}, nil
+}
@@ -0,0 +1,82 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+// DiagnoseConversation checks the local state of a conversation, the checks
+// failing are returned in the reply with the action fixing them instead of an
+// error
+func (svc *service) DiagnoseConversation(ctx context.Context, req *mt.DiagnoseConversation_Request) (*mt.DiagnoseConversation_Reply, error) {
+	convPK := req.GetConversationPublicKey()
+	if convPK == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	diag := &messengerutil.ConversationDiagnosis{ConnectedPeers: -1}
+
+	conv, err := svc.db.GetConversationByPK(convPK)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		checks := diag.Checks()
+		return &mt.DiagnoseConversation_Reply{Ok: messengerutil.ChecksOK(checks), Checks: checks}, nil
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+	diag.Conversation = conv
+
+	if conv.GetType() == mt.Conversation_ContactType && conv.GetContactPublicKey() != "" {
+		contact, err := svc.db.GetContactByPK(conv.GetContactPublicKey())
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+		conv.Contact = contact
+	}
+
+	if conv.GetType() != mt.Conversation_SystemType {
+		if diag.Members, err = svc.db.GetConversationMemberStates(convPK); err != nil {
+			return nil, err
+		}
+
+		if diag.Queued, err = svc.db.CountQueuedMessages(convPK); err != nil {
+			return nil, err
+		}
+
+		gpk, err := messengerutil.B64DecodeBytes(convPK)
+		if err != nil {
+			return nil, errcode.ErrInvalidInput.Wrap(err)
+		}
+
+		svc.subsMutex.Lock()
+		_, diag.Activated = svc.groupsToSubTo[convPK]
+		diag.Streaming = svc.subsCtx != nil
+		svc.subsMutex.Unlock()
+		diag.Subscribed = svc.groupSubscriber.IsSubscribed(gpk)
+
+		if diag.Activated {
+			if group, err := svc.protocolClient.DebugGroup(ctx, &protocoltypes.DebugGroup_Request{GroupPK: gpk}); err != nil {
+				svc.logger.Warn("unable to list the peers of the group", logutil.PrivateString("conversation-pk", convPK), zap.Error(err))
+			} else {
+				diag.ConnectedPeers = len(group.GetPeerIDs())
+			}
+		}
+	}
+
+	checks := diag.Checks()
+	reply := &mt.DiagnoseConversation_Reply{Ok: messengerutil.ChecksOK(checks), Checks: checks, Members: diag.Members}
+
+	if !reply.Ok {
+		svc.logger.Info("conversation diagnosed with errors", logutil.PrivateString("conversation-pk", convPK), logutil.PrivateAny("checks", checks))
+	}
+
+	return reply, nil
+}
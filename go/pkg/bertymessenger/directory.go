@@ -0,0 +1,251 @@
+package bertymessenger
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+
+	p2pcrypto "github.com/libp2p/go-libp2p/core/crypto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/grpcutil"
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/pkg/authtypes"
+	"berty.tech/berty/v2/go/pkg/directorytypes"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// directoryServiceClient connects to the directory service of a service token,
+// the first token supporting it is used if tokenID is empty
+func (svc *service) directoryServiceClient(ctx context.Context, tokenID string) (directorytypes.DirectoryServiceClient, string, func(), error) {
+	list, err := svc.protocolClient.ServicesTokenList(ctx, &protocoltypes.ServicesTokenList_Request{})
+	if err != nil {
+		return nil, "", nil, errcode.ErrServicesAuth.Wrap(err)
+	}
+
+	token, endpoint := "", ""
+	for endpoint == "" {
+		item, err := list.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, "", nil, errcode.ErrStreamRead.Wrap(err)
+		}
+
+		if tokenID != "" && item.GetTokenID() != tokenID {
+			continue
+		}
+
+		for _, s := range item.GetService().GetSupportedServices() {
+			if s.GetServiceType() == authtypes.ServiceDirectoryID {
+				token, endpoint, tokenID = item.GetService().GetToken(), s.GetServiceEndpoint(), item.GetTokenID()
+				break
+			}
+		}
+	}
+
+	if endpoint == "" {
+		return nil, "", nil, errcode.ErrServicesDirectoryMissingEndpoint
+	}
+
+	gopts := []grpc.DialOption{
+		grpc.WithPerRPCCredentials(grpcutil.NewUnsecureSimpleAuthAccess("bearer", token)),
+	}
+
+	if svc.grpcInsecure {
+		gopts = append(gopts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	} else {
+		gopts = append(gopts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
+			MinVersion: tls.VersionTLS12,
+		})))
+	}
+
+	cc, err := grpc.DialContext(ctx, endpoint, gopts...)
+	if err != nil {
+		return nil, "", nil, errcode.ErrServicesDirectoryServer.Wrap(err)
+	}
+
+	return directorytypes.NewDirectoryServiceClient(cc), tokenID, func() { _ = cc.Close() }, nil
+}
+
+func (svc *service) DirectoryServiceRegister(ctx context.Context, req *mt.DirectoryServiceRegister_Request) (_ *mt.DirectoryServiceRegister_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Registering handle on directory service")
+	defer func() { endSection(err, "") }()
+
+	identifier, err := directorytypes.HandleIdentifier(req.GetHandle())
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if acc.GetLink() == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the account has no link yet"))
+	}
+
+	// keep the unlock key of a renewed record, the directory keeps the first one
+	unlockKey := []byte(nil)
+	if existing, err := svc.db.GetDirectoryServiceRecord(identifier); err == nil {
+		unlockKey = existing.GetUnlockKey()
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if unlockKey == nil {
+		sk, _, err := p2pcrypto.GenerateEd25519Key(rand.Reader)
+		if err != nil {
+			return nil, errcode.ErrCryptoKeyGeneration.Wrap(err)
+		}
+
+		if unlockKey, err = sk.Raw(); err != nil {
+			return nil, errcode.ErrSerialization.Wrap(err)
+		}
+	}
+
+	sk, err := p2pcrypto.UnmarshalEd25519PrivateKey(unlockKey)
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	pk, err := sk.GetPublic().Raw()
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	client, tokenID, closeClient, err := svc.directoryServiceClient(ctx, req.GetTokenID())
+	if err != nil {
+		return nil, err
+	}
+	defer closeClient()
+
+	reply, err := client.Register(ctx, &directorytypes.Register_Request{
+		Handle:                  identifier,
+		ProfileURI:              acc.GetLink(),
+		UnlockKey:               pk,
+		OverwriteExistingRecord: req.GetOverwriteExistingRecord(),
+	})
+	if err != nil {
+		return nil, errcode.ErrServicesDirectoryServer.Wrap(err)
+	}
+
+	if err := svc.db.SaveDirectoryServiceRecord(&mt.DirectoryServiceRecord{
+		Identifier:           reply.GetDirectoryIdentifier(),
+		TokenID:              tokenID,
+		DirectoryRecordToken: reply.GetDirectoryRecordToken(),
+		ExpirationDate:       reply.GetExpirationDate(),
+		UnlockKey:            unlockKey,
+	}); err != nil {
+		return nil, err
+	}
+
+	return &mt.DirectoryServiceRegister_Reply{
+		Handle:         directorytypes.HandleFromIdentifier(reply.GetDirectoryIdentifier()),
+		ExpirationDate: reply.GetExpirationDate(),
+	}, nil
+}
+
+func (svc *service) DirectoryServiceUnregister(ctx context.Context, req *mt.DirectoryServiceUnregister_Request) (_ *mt.DirectoryServiceUnregister_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Unregistering handle from directory service")
+	defer func() { endSection(err, "") }()
+
+	identifier, err := directorytypes.HandleIdentifier(req.GetHandle())
+	if err != nil {
+		return nil, err
+	}
+
+	record, err := svc.db.GetDirectoryServiceRecord(identifier)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrServicesDirectoryExistingRecordNotFound.Wrap(err)
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	sk, err := p2pcrypto.UnmarshalEd25519PrivateKey(record.GetUnlockKey())
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	sig, err := sk.Sign([]byte(record.GetDirectoryRecordToken()))
+	if err != nil {
+		return nil, errcode.ErrCryptoSignature.Wrap(err)
+	}
+
+	client, _, closeClient, err := svc.directoryServiceClient(ctx, record.GetTokenID())
+	if err != nil {
+		return nil, err
+	}
+	defer closeClient()
+
+	if _, err := client.Unregister(ctx, &directorytypes.Unregister_Request{
+		DirectoryIdentifier:  record.GetIdentifier(),
+		DirectoryRecordToken: record.GetDirectoryRecordToken(),
+		UnlockSig:            sig,
+	}); err != nil {
+		return nil, errcode.ErrServicesDirectoryServer.Wrap(err)
+	}
+
+	if err := svc.db.DeleteDirectoryServiceRecord(identifier); err != nil {
+		return nil, err
+	}
+
+	return &mt.DirectoryServiceUnregister_Reply{}, nil
+}
+
+func (svc *service) DirectoryServiceQuery(req *mt.DirectoryServiceQuery_Request, server mt.MessengerService_DirectoryServiceQueryServer) error {
+	identifiers := make([]string, 0, len(req.GetHandles()))
+	for _, handle := range req.GetHandles() {
+		identifier, err := directorytypes.HandleIdentifier(handle)
+		if err != nil {
+			return err
+		}
+
+		identifiers = append(identifiers, identifier)
+	}
+
+	if len(identifiers) == 0 {
+		return errcode.ErrMissingInput
+	}
+
+	client, _, closeClient, err := svc.directoryServiceClient(server.Context(), req.GetTokenID())
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	results, err := client.Query(server.Context(), &directorytypes.Query_Request{DirectoryIdentifiers: identifiers})
+	if err != nil {
+		return errcode.ErrServicesDirectoryServer.Wrap(err)
+	}
+
+	for {
+		result, err := results.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errcode.ErrServicesDirectoryServer.Wrap(err)
+		}
+
+		svc.logger.Debug("resolved handle", logutil.PrivateString("identifier", result.GetDirectoryIdentifier()), zap.Int64("expires-at", result.GetExpiresAt()))
+
+		if err := server.Send(&mt.DirectoryServiceQuery_Reply{
+			Handle:    directorytypes.HandleFromIdentifier(result.GetDirectoryIdentifier()),
+			Link:      result.GetProfileURI(),
+			ExpiresAt: result.GetExpiresAt(),
+		}); err != nil {
+			return errcode.ErrStreamWrite.Wrap(err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	// draftMaxMediaRefs and draftMediaRefMaxLength bound the medias attached to a draft
+	draftMaxMediaRefs      = 32
+	draftMediaRefMaxLength = 1024
+)
+
+func (svc *service) SaveConversationDraft(ctx context.Context, req *mt.SaveConversationDraft_Request) (*mt.SaveConversationDraft_Reply, error) {
+	convPK := req.GetConversationPublicKey()
+	if convPK == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	if len(req.GetBody()) > messengerutil.InteractionPayloadMaxSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("draft is too large: %d bytes, max is %d", len(req.GetBody()), messengerutil.InteractionPayloadMaxSize))
+	}
+
+	if len(req.GetMediaRefs()) > draftMaxMediaRefs {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("a draft can't have more than %d medias", draftMaxMediaRefs))
+	}
+
+	refs := make([]*mt.ConversationDraftMediaRef, len(req.GetMediaRefs()))
+	for i, ref := range req.GetMediaRefs() {
+		if ref == "" || len(ref) > draftMediaRefMaxLength {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("draft media references can't be empty or too long"))
+		}
+		refs[i] = &mt.ConversationDraftMediaRef{Ref: ref}
+	}
+
+	var (
+		draft        *mt.ConversationDraft
+		conversation *mt.Conversation
+	)
+	svc.handlerMutex.Lock()
+	err := svc.db.TX(ctx, func(tx *messengerdb.DBWrapper) error {
+		var err error
+		if draft, err = tx.SaveConversationDraft(&mt.ConversationDraft{
+			ConversationPublicKey: convPK,
+			Body:                  req.GetBody(),
+			TargetCID:             req.GetTargetCID(),
+			MediaRefs:             refs,
+			UpdatedDate:           messengerutil.TimestampMs(time.Now()),
+		}); err != nil {
+			return err
+		}
+
+		if conversation, err = tx.GetConversationByPK(convPK); err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		return nil
+	})
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// the other clients of this device show the draft too
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	return &mt.SaveConversationDraft_Reply{Draft: draft}, nil
+}
+
+func (svc *service) GetConversationDraft(ctx context.Context, req *mt.GetConversationDraft_Request) (*mt.GetConversationDraft_Reply, error) {
+	if req.GetConversationPublicKey() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	draft, err := svc.db.GetConversationDraft(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.GetConversationDraft_Reply{Draft: draft}, nil
+}
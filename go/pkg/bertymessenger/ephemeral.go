@@ -0,0 +1,41 @@
+package bertymessenger
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const ephemeralPurgeInterval = 10 * time.Second
+
+// purgeExpiredInteractions removes the disappearing messages once their
+// conversation policy expires them
+func (svc *service) purgeExpiredInteractions(ctx context.Context) {
+	ticker := time.NewTicker(ephemeralPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		svc.handlerMutex.Lock()
+		expired, err := svc.db.PurgeExpiredInteractions(messengerutil.TimestampMs(time.Now()))
+		svc.handlerMutex.Unlock()
+		if err != nil {
+			svc.logger.Warn("unable to purge expired interactions", zap.Error(err))
+		}
+
+		for _, i := range expired {
+			if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: i.GetCID(), ConversationPublicKey: i.GetConversationPublicKey()}, false); err != nil {
+				svc.logger.Warn("unable to stream interaction deletion", zap.Error(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerdb"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// featureFlags caches the feature flags of the account, they are checked on
+// the hot paths of the event handling
+type featureFlags struct {
+	mutex   sync.RWMutex
+	enabled map[mt.FeatureFlag_Name]bool
+}
+
+func loadFeatureFlags(db *messengerdb.DBWrapper) (*featureFlags, error) {
+	flags, err := db.GetFeatureFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &featureFlags{enabled: make(map[mt.FeatureFlag_Name]bool, len(flags))}
+	for _, flag := range flags {
+		f.enabled[flag.GetName()] = flag.GetEnabled()
+	}
+
+	return f, nil
+}
+
+// Enabled returns true if the feature is enabled for the account
+func (f *featureFlags) Enabled(name mt.FeatureFlag_Name) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	return f.enabled[name]
+}
+
+func (f *featureFlags) set(flag *mt.FeatureFlag) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.enabled[flag.GetName()] = flag.GetEnabled()
+}
+
+func (svc *service) FeatureFlagList(ctx context.Context, req *mt.FeatureFlagList_Request) (*mt.FeatureFlagList_Reply, error) {
+	flags, err := svc.db.GetFeatureFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.FeatureFlagList_Reply{Flags: flags}, nil
+}
+
+func (svc *service) FeatureFlagSet(ctx context.Context, req *mt.FeatureFlagSet_Request) (*mt.FeatureFlagSet_Reply, error) {
+	if req.GetName() == mt.FeatureFlag_FeatureUndefined {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a feature flag name is required"))
+	}
+
+	var (
+		flag *mt.FeatureFlag
+		err  error
+	)
+	if req.GetReset_() {
+		flag, err = svc.db.ResetFeatureFlag(req.GetName())
+	} else {
+		flag, err = svc.db.SetFeatureFlag(req.GetName(), req.GetEnabled(), messengerutil.TimestampMs(time.Now()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	svc.featureFlags.set(flag)
+	svc.logger.Info("feature flag updated", zap.Stringer("name", flag.GetName()), zap.Bool("enabled", flag.GetEnabled()))
+
+	return &mt.FeatureFlagSet_Reply{Flag: flag}, nil
+}
@@ -0,0 +1,47 @@
+package bertymessenger
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/internal/messengerpayloads"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// completeForwardOrigin fills the origin of a forwarded message from the
+// message known by this device, only its cid has to be set by the client. A
+// message forwarded again keeps its first origin.
+func (svc *service) completeForwardOrigin(msg *mt.AppMessage_UserMessage) error {
+	origin := msg.GetForwardedFrom()
+	if origin == nil {
+		return nil
+	}
+
+	if origin.GetCID() == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("the cid of the forwarded message is required"))
+	}
+
+	forwarded, err := svc.db.GetInteractionByCID(origin.GetCID())
+	if err != nil {
+		return errcode.ErrNotFound.Wrap(err)
+	}
+
+	if forwarded.GetType() != mt.AppMessage_TypeUserMessage {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("only user messages can be forwarded"))
+	}
+
+	if from := forwarded.GetForwardedFrom(); from != nil {
+		msg.ForwardedFrom = from.ForwardOrigin()
+	} else {
+		memberPK, displayName := messengerpayloads.InteractionAuthor(svc.db, forwarded)
+		msg.ForwardedFrom = &mt.AppMessage_ForwardOrigin{
+			ConversationPublicKey: forwarded.GetConversationPublicKey(),
+			CID:                   forwarded.GetCID(),
+			AuthorMemberPublicKey: memberPK,
+			AuthorDisplayName:     displayName,
+			SentDate:              forwarded.GetSentDate(),
+		}
+	}
+
+	return msg.ForwardedFrom.Validate()
+}
@@ -0,0 +1,169 @@
+//go:build ignore
+// +build ignore
+
+// This program generates multi_account_forwarders.go, the methods of
+// MultiAccountService routing the calls to the Service of the selected
+// account. It is run by go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	source = "../messengertypes/messengertypes.pb.go"
+	output = "multi_account_forwarders.go"
+)
+
+// overridden are the methods implemented by hand in multi_account.go
+var overridden = map[string]bool{
+	"EventStream": true,
+}
+
+func main() {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, source, nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	iface := findInterface(file, "MessengerServiceServer")
+	if iface == nil {
+		log.Fatalf("MessengerServiceServer not found in %s", source)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, method := range iface.Methods.List {
+		name := method.Names[0].Name
+		if overridden[name] {
+			continue
+		}
+
+		params := method.Type.(*ast.FuncType).Params.List
+		switch {
+		case len(params) == 2 && typeString(params[0].Type) == "context.Context":
+			// unary call
+			fmt.Fprintf(buf, `
+func (m *MultiAccountService) %[1]s(ctx context.Context, req %[2]s) (%[3]s, error) {
+	_, svc, err := m.serviceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return svc.%[1]s(ctx, req)
+}
+`, name, typeString(params[1].Type), typeString(method.Type.(*ast.FuncType).Results.List[0].Type))
+
+		case len(params) == 2:
+			// server stream
+			fmt.Fprintf(buf, `
+func (m *MultiAccountService) %[1]s(req %[2]s, sub %[3]s) error {
+	_, svc, err := m.serviceFromContext(sub.Context())
+	if err != nil {
+		return err
+	}
+	return svc.%[1]s(req, sub)
+}
+`, name, typeString(params[0].Type), typeString(params[1].Type))
+
+		case len(params) == 1:
+			// client or bidirectional stream
+			fmt.Fprintf(buf, `
+func (m *MultiAccountService) %[1]s(sub %[2]s) error {
+	_, svc, err := m.serviceFromContext(sub.Context())
+	if err != nil {
+		return err
+	}
+	return svc.%[1]s(sub)
+}
+`, name, typeString(params[0].Type))
+
+		default:
+			log.Fatalf("unexpected signature for %s", name)
+		}
+	}
+
+	header := &bytes.Buffer{}
+	fmt.Fprint(header, `// Code generated by gen_multi_account.go; DO NOT EDIT.
+
+package bertymessenger
+
+import (
+	"context"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+`)
+	for _, spec := range file.Imports {
+		if spec.Name == nil || !used[spec.Name.Name] {
+			continue
+		}
+
+		if path.Base(strings.Trim(spec.Path.Value, `"`)) == spec.Name.Name {
+			fmt.Fprintf(header, "\t%s\n", spec.Path.Value)
+		} else {
+			fmt.Fprintf(header, "\t%s %s\n", spec.Name.Name, spec.Path.Value)
+		}
+	}
+	fmt.Fprint(header, ")\n")
+
+	out, err := format.Source(append(header.Bytes(), buf.Bytes()...))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := os.WriteFile(output, out, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func findInterface(file *ast.File, name string) *ast.InterfaceType {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+				iface, _ := ts.Type.(*ast.InterfaceType)
+				return iface
+			}
+		}
+	}
+
+	return nil
+}
+
+// used are the packages imported by messengertypes which are referenced by
+// the generated methods
+var used = map[string]bool{}
+
+// typeString formats expr, qualifying the types declared by messengertypes
+func typeString(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return "*" + typeString(t.X)
+	case *ast.SelectorExpr:
+		pkg := t.X.(*ast.Ident).Name
+		if pkg != "context" {
+			used[pkg] = true
+		}
+		return pkg + "." + t.Sel.Name
+	case *ast.Ident:
+		if ast.IsExported(t.Name) {
+			return "mt." + t.Name
+		}
+		return t.Name
+	default:
+		log.Fatalf("unexpected type expression %T", expr)
+		return ""
+	}
+}
@@ -0,0 +1,38 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+var deliveryLatencyOpts = prometheus.HistogramOpts{
+	Name:    prometheus.BuildFQName("berty", "messenger", "delivery_latency_seconds"),
+	Help:    "delay between the sending and the receipt of the user messages",
+	Buckets: []float64{0.1, 0.5, 1, 5, 15, 60, 300, 3600, 86400},
+}
+
+func (svc *service) DeliveryLatencyStats(ctx context.Context, req *mt.DeliveryLatencyStats_Request) (*mt.DeliveryLatencyStats_Reply, error) {
+	conversations, contacts, err := svc.db.GetDeliveryLatencyStats(req.GetSince())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.DeliveryLatencyStats_Reply{Conversations: conversations, Contacts: contacts}, nil
+}
+
+// observeDeliveryLatency adds a received user message to the delivery latency
+// metric, the messages received with a skewed clock are ignored
+func (svc *service) observeDeliveryLatency(i *mt.Interaction) {
+	if svc.deliveryLatency == nil || i.GetType() != mt.AppMessage_TypeUserMessage {
+		return
+	}
+
+	if i.GetSentDate() <= 0 || i.GetReceivedDate() < i.GetSentDate() {
+		return
+	}
+
+	svc.deliveryLatency.Observe(float64(i.GetReceivedDate()-i.GetSentDate()) / 1000)
+}
@@ -0,0 +1,105 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+func (svc *service) ConversationLeave(ctx context.Context, req *mt.ConversationLeave_Request) (*mt.ConversationLeave_Reply, error) {
+	convPK := req.GetConversationPublicKey()
+	if convPK == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	retention := req.GetRetention()
+	if _, ok := mt.ConversationLeave_Retention_name[int32(retention)]; !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown retention: %d", retention))
+	}
+
+	// prevent the event handler from writing to the conversation meanwhile
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	conv, err := svc.db.GetConversationByPK(convPK)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %s", convPK))
+	}
+
+	if conv.GetType() != mt.Conversation_MultiMemberType {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only the multi-member conversations can be left"))
+	}
+
+	// an archive was already left, it can only be purged
+	leftDate := conv.GetLeftDate()
+	if leftDate == 0 {
+		gpkb, err := messengerutil.B64DecodeBytes(convPK)
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+
+		svc.unsubscribeFromGroup(gpkb)
+
+		if _, err := svc.protocolClient.MultiMemberGroupLeave(ctx, &protocoltypes.MultiMemberGroupLeave_Request{GroupPK: gpkb}); err != nil {
+			if err := svc.ActivateGroup(gpkb); err != nil {
+				svc.logger.Warn("unable to subscribe to the group again", logutil.PrivateString("conversation-pk", convPK), zap.Error(err))
+			}
+			return nil, errcode.ErrProtocolSend.Wrap(err)
+		}
+
+		leftDate = messengerutil.TimestampMs(time.Now())
+	} else if retention == mt.ConversationLeave_RetentionArchive {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the conversation was already left"))
+	}
+
+	event := &mt.StreamEvent_ConversationUpdated{}
+	switch retention {
+	case mt.ConversationLeave_RetentionPurge:
+		if err := svc.db.PurgeLeftConversation(convPK); err != nil {
+			return nil, err
+		}
+		event.Conversation = &mt.Conversation{PublicKey: convPK, Type: conv.GetType(), LeftDate: leftDate}
+		event.Purged = true
+	default:
+		if event.Conversation, err = svc.db.ArchiveLeftConversation(convPK, leftDate); err != nil {
+			return nil, err
+		}
+	}
+
+	svc.logger.Info("left conversation", logutil.PrivateString("conversation-pk", convPK), zap.Stringer("retention", retention))
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, event, false); err != nil {
+		svc.logger.Warn("unable to stream conversation update", zap.Error(err))
+	}
+
+	// the group can be joined again from its invitations
+	if cids, err := svc.db.SetGroupInvitationsJoined(convPK, false); err != nil {
+		svc.logger.Warn("unable to update group invitations", zap.Error(err))
+	} else {
+		for _, cid := range cids {
+			if err := messengerutil.StreamInteraction(svc.dispatcher, svc.db, cid, false); err != nil {
+				svc.logger.Warn("unable to stream interaction update", zap.Error(err))
+			}
+		}
+	}
+
+	return &mt.ConversationLeave_Reply{Conversation: event.Conversation}, nil
+}
+
+// unsubscribeFromGroup stops following a group, it isn't subscribed to again
+// when the app is brought back to the foreground
+func (svc *service) unsubscribeFromGroup(groupPK []byte) {
+	svc.subsMutex.Lock()
+	defer svc.subsMutex.Unlock()
+
+	delete(svc.groupsToSubTo, messengerutil.B64EncodeBytes(groupPK))
+	svc.groupSubscriber.Unsubscribe(groupPK)
+}
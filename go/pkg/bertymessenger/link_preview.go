@@ -0,0 +1,151 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	linkPreviewQueueSize    = 64
+	linkPreviewFetchTimeout = 20 * time.Second
+	linkPreviewMaxPageSize  = 512 * 1024
+)
+
+type linkPreviewJob struct {
+	cid   string
+	links []string
+}
+
+// queueLinkPreviews schedules the fetch of the previews of the links of a
+// message, the message is skipped if the worker is too far behind
+func (svc *service) queueLinkPreviews(cid string, msg *mt.AppMessage_UserMessage) {
+	if svc.linkPreviewQueue == nil {
+		return
+	}
+
+	links := msg.Links()
+	if len(links) == 0 {
+		return
+	}
+
+	select {
+	case svc.linkPreviewQueue <- linkPreviewJob{cid: cid, links: links}:
+	default:
+		svc.logger.Debug("link preview queue full, skipping message", logutil.PrivateString("cid", cid))
+	}
+}
+
+// generateLinkPreviews fetches the previews of the queued messages one at a
+// time, the previews are cached by url so a page is only fetched once
+func (svc *service) generateLinkPreviews(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-svc.linkPreviewQueue:
+			if err := svc.generateMessageLinkPreviews(ctx, job); err != nil {
+				svc.logger.Warn("unable to generate link previews", logutil.PrivateString("cid", job.cid), zap.Error(err))
+			}
+		}
+	}
+}
+
+func (svc *service) generateMessageLinkPreviews(ctx context.Context, job linkPreviewJob) error {
+	cached, err := svc.db.GetLinkPreviews(job.links)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(cached))
+	for _, preview := range cached {
+		known[preview.GetURL()] = true
+	}
+
+	attached := false
+	for _, link := range job.links {
+		if known[link] {
+			continue
+		}
+
+		preview, err := svc.fetchLinkPreview(ctx, link)
+		if err != nil {
+			// the page is fetched again for the next message linking it
+			svc.logger.Debug("unable to fetch link preview", logutil.PrivateString("url", link), zap.Error(err))
+			continue
+		}
+
+		svc.handlerMutex.Lock()
+		err = svc.db.SaveLinkPreview(preview)
+		svc.handlerMutex.Unlock()
+		if err != nil {
+			return err
+		}
+
+		attached = attached || !preview.GetFailed()
+	}
+
+	if !attached {
+		return nil
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	// an own message can still be on its way to the database, the preview
+	// is attached when it is stored
+	if _, err := svc.db.GetInteractionByCID(job.cid); errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	return messengerutil.StreamInteraction(svc.dispatcher, svc.db, job.cid, false)
+}
+
+// fetchLinkPreview fetches the page at link, it only returns an error when
+// the page couldn't be reached, the pages without metadata give a failed
+// preview
+func (svc *service) fetchLinkPreview(ctx context.Context, link string) (*mt.LinkPreview, error) {
+	ctx, cancel := context.WithTimeout(ctx, linkPreviewFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+	req.Header.Set("Accept", "text/html")
+
+	res, err := svc.linkPreviewClient.Do(req)
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(err)
+	}
+	defer res.Body.Close()
+
+	fetchedDate := messengerutil.TimestampMs(time.Now())
+	failed := &mt.LinkPreview{URL: link, FetchedDate: fetchedDate, Failed: true}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return failed, nil
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err != nil || mediaType != "text/html" {
+		return failed, nil
+	}
+
+	preview := messengerutil.ParseLinkPreview(io.LimitReader(res.Body, linkPreviewMaxPageSize), link)
+	preview.FetchedDate = fetchedDate
+
+	return preview, nil
+}
@@ -0,0 +1,16 @@
+package bertymessenger
+
+import (
+	"context"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ConversationLocations(ctx context.Context, req *mt.ConversationLocations_Request) (*mt.ConversationLocations_Reply, error) {
+	locations, err := svc.db.GetMemberLocations(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ConversationLocations_Reply{Locations: locations}, nil
+}
@@ -0,0 +1,56 @@
+package bertymessenger
+
+import (
+	"context"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const defaultMentionCandidatesLimit = 10
+
+func (svc *service) MentionCandidates(ctx context.Context, req *mt.MentionCandidates_Request) (*mt.MentionCandidates_Reply, error) {
+	conv, err := svc.db.GetConversationByPK(req.GetConversationPK())
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	members, err := svc.db.GetMentionCandidates(conv.GetPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	// members of a contact conversation may not have shared their info yet,
+	// fallback on the name of the contact
+	contactName := ""
+	if conv.GetType() == mt.Conversation_ContactType {
+		if contact, err := svc.db.GetContactByPK(conv.GetContactPublicKey()); err == nil {
+			contactName = contact.GetDisplayName()
+		}
+	}
+
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultMentionCandidatesLimit
+	}
+
+	query := strings.ToLower(req.GetQuery())
+	candidates := []*mt.Member(nil)
+	for _, member := range members {
+		if member.DisplayName == "" {
+			member.DisplayName = contactName
+		}
+
+		if member.DisplayName == "" || !strings.HasPrefix(strings.ToLower(member.DisplayName), query) {
+			continue
+		}
+
+		candidates = append(candidates, member)
+		if len(candidates) == limit {
+			break
+		}
+	}
+
+	return &mt.MentionCandidates_Reply{Members: candidates}, nil
+}
@@ -0,0 +1,48 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ConversationDuplicatesList(ctx context.Context, req *mt.ConversationDuplicatesList_Request) (*mt.ConversationDuplicatesList_Reply, error) {
+	duplicates, err := svc.db.GetDuplicateConversations()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ConversationDuplicatesList_Reply{Duplicates: duplicates}, nil
+}
+
+func (svc *service) MergeConversations(ctx context.Context, req *mt.MergeConversations_Request) (*mt.MergeConversations_Reply, error) {
+	// prevent the event handler from writing to the duplicate meanwhile
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	conv, err := svc.db.MergeConversations(req.GetConversationPublicKey(), req.GetDuplicatePublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Info("merged conversations", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), logutil.PrivateString("duplicate-pk", req.GetDuplicatePublicKey()))
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationDeleted, &mt.StreamEvent_ConversationDeleted{PublicKey: req.GetDuplicatePublicKey()}, false); err != nil {
+		svc.logger.Warn("unable to stream conversation deletion", zap.Error(err))
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+		svc.logger.Warn("unable to stream conversation update", zap.Error(err))
+	}
+
+	if contact, err := svc.db.GetContactByPK(conv.GetContactPublicKey()); err == nil {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: contact}, false); err != nil {
+			svc.logger.Warn("unable to stream contact update", zap.Error(err))
+		}
+	}
+
+	return &mt.MergeConversations_Reply{Conversation: conv}, nil
+}
@@ -0,0 +1,88 @@
+package bertymessenger
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const metricsPath = "/metrics"
+
+// registerPipelineMetrics registers the metrics following the messages from
+// their receipt to the clients, the handlers are measured by their middleware
+func (svc *service) registerPipelineMetrics(reg prometheus.Registerer) error {
+	if err := svc.db.RegisterMetrics(reg); err != nil {
+		return err
+	}
+
+	svc.acksSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: prometheus.BuildFQName("berty", "messenger", "acks_sent_total"),
+		Help: "interactions acknowledged to their senders",
+	})
+
+	collectors := []prometheus.Collector{
+		svc.acksSent,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName("berty", "messenger", "queued_messages"),
+			Help: "messages waiting to be sent",
+		}, svc.countMetric("queued messages", svc.db.CountAllQueuedMessages)),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName("berty", "messenger", "outbox_events"),
+			Help: "stream events committed and waiting to be delivered to the dispatcher",
+		}, svc.countMetric("outbox events", svc.db.CountOutboxEvents)),
+	}
+
+	for _, c := range collectors {
+		if err := reg.Register(c); err != nil {
+			return errcode.TODO.Wrap(fmt.Errorf("unable to register messenger metrics: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// countMetric reads a gauge from the db, the failures are only logged
+func (svc *service) countMetric(name string, count func() (int64, error)) func() float64 {
+	return func() float64 {
+		n, err := count()
+		if err != nil {
+			svc.logger.Debug("unable to count "+name, zap.Error(err))
+			return 0
+		}
+		return float64(n)
+	}
+}
+
+// serveMetrics serves the metrics of gatherer on listener until Close is
+// called
+func (svc *service) serveMetrics(listener string, gatherer prometheus.Gatherer) error {
+	l, err := net.Listen("tcp", listener)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unable to listen for metrics: %w", err))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	svc.metricsServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	svc.logger.Info("serving messenger metrics", zap.String("handler", metricsPath), logutil.PrivateString("listener", l.Addr().String()))
+	go func() {
+		if err := svc.metricsServer.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			svc.logger.Error("metrics server stopped", zap.Error(err))
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,255 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// AccountIDMetadataKey is the gRPC metadata key used to select the account a
+// call is made for on a MultiAccountService.
+const AccountIDMetadataKey = "berty-account-id"
+
+// ContextWithAccountID returns an outgoing context selecting accountID on a
+// MultiAccountService.
+func ContextWithAccountID(ctx context.Context, accountID string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, AccountIDMetadataKey, accountID)
+}
+
+// AccountIDFromContext returns the account selected by the caller in the
+// incoming metadata, or an empty string if none was given.
+func AccountIDFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if vals := md.Get(AccountIDMetadataKey); len(vals) > 0 {
+		return vals[0]
+	}
+
+	return ""
+}
+
+// MultiAccountService serves several accounts, each one backed by its own
+// Service (and so its own database and protocol client), behind a single
+// MessengerServiceServer.
+//
+// Calls are routed using the account selected in the metadata (see
+// ContextWithAccountID), calls without selector go to the default account.
+// An EventStream without selector multiplexes the events of every account
+// registered when the stream is opened, each reply is tagged with its
+// account ID.
+//
+// The other methods only route the call, they are generated in
+// multi_account_forwarders.go. AccountDelete deletes the selected account, the
+// caller is expected to call RemoveAccount once the terminal event has been
+// received.
+//
+//go:generate go run gen_multi_account.go
+type MultiAccountService struct {
+	logger *zap.Logger
+
+	muServices     sync.RWMutex
+	services       map[string]Service
+	defaultAccount string
+}
+
+var _ Service = (*MultiAccountService)(nil)
+
+func NewMultiAccountService(logger *zap.Logger) *MultiAccountService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	return &MultiAccountService{
+		logger:   logger.Named("multi"),
+		services: make(map[string]Service),
+	}
+}
+
+// AddAccount registers svc for accountID, the first account added becomes the
+// default one.
+func (m *MultiAccountService) AddAccount(accountID string, svc Service) error {
+	if accountID == "" || svc == nil {
+		return errcode.ErrInvalidInput
+	}
+
+	m.muServices.Lock()
+	defer m.muServices.Unlock()
+
+	if _, ok := m.services[accountID]; ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("account %s is already served", accountID))
+	}
+
+	m.services[accountID] = svc
+	if m.defaultAccount == "" {
+		m.defaultAccount = accountID
+	}
+
+	m.logger.Info("account added", zap.String("account-id", accountID))
+	return nil
+}
+
+// RemoveAccount unregisters and closes the service of accountID.
+func (m *MultiAccountService) RemoveAccount(accountID string) error {
+	m.muServices.Lock()
+	svc, ok := m.services[accountID]
+	if !ok {
+		m.muServices.Unlock()
+		return errcode.ErrMessengerUnknownAccount.Wrap(fmt.Errorf("account %s", accountID))
+	}
+
+	delete(m.services, accountID)
+	if m.defaultAccount == accountID {
+		m.defaultAccount = ""
+		for _, id := range m.accountIDs() {
+			m.defaultAccount = id
+			break
+		}
+	}
+	m.muServices.Unlock()
+
+	svc.Close()
+	m.logger.Info("account removed", zap.String("account-id", accountID))
+	return nil
+}
+
+// SetDefaultAccount selects the account used by calls without selector.
+func (m *MultiAccountService) SetDefaultAccount(accountID string) error {
+	m.muServices.Lock()
+	defer m.muServices.Unlock()
+
+	if _, ok := m.services[accountID]; !ok {
+		return errcode.ErrMessengerUnknownAccount.Wrap(fmt.Errorf("account %s", accountID))
+	}
+
+	m.defaultAccount = accountID
+	return nil
+}
+
+// AccountIDs returns the served accounts, sorted.
+func (m *MultiAccountService) AccountIDs() []string {
+	m.muServices.RLock()
+	defer m.muServices.RUnlock()
+
+	return m.accountIDs()
+}
+
+func (m *MultiAccountService) accountIDs() []string {
+	ids := make([]string, 0, len(m.services))
+	for id := range m.services {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+// Close closes the services of every account.
+func (m *MultiAccountService) Close() {
+	m.muServices.Lock()
+	services := m.services
+	m.services = make(map[string]Service)
+	m.defaultAccount = ""
+	m.muServices.Unlock()
+
+	for _, svc := range services {
+		svc.Close()
+	}
+}
+
+func (m *MultiAccountService) serviceFromContext(ctx context.Context) (string, Service, error) {
+	m.muServices.RLock()
+	defer m.muServices.RUnlock()
+
+	accountID := AccountIDFromContext(ctx)
+	if accountID == "" {
+		accountID = m.defaultAccount
+	}
+
+	svc, ok := m.services[accountID]
+	if !ok {
+		return "", nil, errcode.ErrMessengerUnknownAccount.Wrap(fmt.Errorf("account %q", accountID))
+	}
+
+	return accountID, svc, nil
+}
+
+// accountEventStream tags the replies of an account and serializes them on the
+// shared stream
+type accountEventStream struct {
+	mt.MessengerService_EventStreamServer
+
+	ctx       context.Context
+	accountID string
+	muSend    *sync.Mutex
+}
+
+func (s *accountEventStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *accountEventStream) Send(reply *mt.EventStream_Reply) error {
+	s.muSend.Lock()
+	defer s.muSend.Unlock()
+
+	return s.MessengerService_EventStreamServer.Send(&mt.EventStream_Reply{Event: reply.GetEvent(), AccountID: s.accountID})
+}
+
+func (m *MultiAccountService) EventStream(req *mt.EventStream_Request, sub mt.MessengerService_EventStreamServer) error {
+	muSend := &sync.Mutex{}
+
+	if AccountIDFromContext(sub.Context()) != "" {
+		accountID, svc, err := m.serviceFromContext(sub.Context())
+		if err != nil {
+			return err
+		}
+
+		return svc.EventStream(req, &accountEventStream{MessengerService_EventStreamServer: sub, ctx: sub.Context(), accountID: accountID, muSend: muSend})
+	}
+
+	m.muServices.RLock()
+	services := make(map[string]Service, len(m.services))
+	for id, svc := range m.services {
+		services[id] = svc
+	}
+	m.muServices.RUnlock()
+
+	if len(services) == 0 {
+		return errcode.ErrMessengerUnknownAccount.Wrap(fmt.Errorf("no account served"))
+	}
+
+	// the first stream to stop stops the others
+	ctx, cancel := context.WithCancel(sub.Context())
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for accountID, svc := range services {
+		wg.Add(1)
+		go func(accountID string, svc Service) {
+			defer wg.Done()
+			defer cancel()
+
+			stream := &accountEventStream{MessengerService_EventStreamServer: sub, ctx: ctx, accountID: accountID, muSend: muSend}
+			if err := svc.EventStream(req, stream); err != nil {
+				m.logger.Warn("account event stream ended", zap.String("account-id", accountID), zap.Error(err))
+				errOnce.Do(func() { firstErr = err })
+			}
+		}(accountID, svc)
+	}
+	wg.Wait()
+
+	return firstErr
+}
@@ -0,0 +1,80 @@
+package bertymessenger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	grpc "google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+
+	"berty.tech/berty/v2/go/internal/testutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	"berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func TestMultiAccountService(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	logger, cleanup := testutil.Logger(t)
+	defer cleanup()
+
+	multi := NewMultiAccountService(logger)
+	for i, accountID := range []string{"alice", "bob"} {
+		svc, cleanup := TestingService(ctx, t, &TestingServiceOpts{Logger: logger, Index: 100 + i})
+		defer cleanup() // closes the service, so multi is not closed
+		require.NoError(t, multi.AddAccount(accountID, svc.(Service)))
+	}
+	require.Error(t, multi.AddAccount("alice", nil))
+	require.Equal(t, []string{"alice", "bob"}, multi.AccountIDs())
+
+	lis := bufconn.Listen(4 * 1024 * 1024)
+	s := grpc.NewServer()
+	messengertypes.RegisterMessengerServiceServer(s, multi)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.DialContext(ctx, "bufnet", grpc.WithContextDialer(mkBufDialer(lis)), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := messengertypes.NewMessengerServiceClient(conn)
+
+	// each account is isolated
+	alice, err := client.AccountGet(ContextWithAccountID(ctx, "alice"), &messengertypes.AccountGet_Request{})
+	require.NoError(t, err)
+	bob, err := client.AccountGet(ContextWithAccountID(ctx, "bob"), &messengertypes.AccountGet_Request{})
+	require.NoError(t, err)
+	require.NotEqual(t, alice.Account.PublicKey, bob.Account.PublicKey)
+
+	// calls without selector go to the default account
+	def, err := client.AccountGet(ctx, &messengertypes.AccountGet_Request{})
+	require.NoError(t, err)
+	require.Equal(t, alice.Account.PublicKey, def.Account.PublicKey)
+
+	require.NoError(t, multi.SetDefaultAccount("bob"))
+	def, err = client.AccountGet(ctx, &messengertypes.AccountGet_Request{})
+	require.NoError(t, err)
+	require.Equal(t, bob.Account.PublicKey, def.Account.PublicKey)
+
+	eveCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(AccountIDMetadataKey, "eve"))
+	_, err = multi.AccountGet(eveCtx, &messengertypes.AccountGet_Request{})
+	require.Equal(t, errcode.ErrMessengerUnknownAccount, errcode.Code(err))
+
+	// a stream without selector multiplexes the events of every account
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+	stream, err := client.EventStream(streamCtx, &messengertypes.EventStream_Request{})
+	require.NoError(t, err)
+
+	listEnded := map[string]bool{}
+	for len(listEnded) < 2 {
+		reply, err := stream.Recv()
+		require.NoError(t, err)
+		require.Contains(t, []string{"alice", "bob"}, reply.AccountID)
+		if reply.Event.Type == messengertypes.StreamEvent_TypeListEnded {
+			listEnded[reply.AccountID] = true
+		}
+	}
+}
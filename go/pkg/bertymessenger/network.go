@@ -0,0 +1,99 @@
+package bertymessenger
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+const networkStatusPollInterval = 10 * time.Second
+
+func (svc *service) NetworkStatus(ctx context.Context, req *mt.NetworkStatus_Request) (*mt.NetworkStatus_Reply, error) {
+	return &mt.NetworkStatus_Reply{Status: svc.getNetworkStatus()}, nil
+}
+
+// getNetworkStatus returns a copy of the current network status
+func (svc *service) getNetworkStatus() *mt.NetworkStatus_Status {
+	svc.muNetworkStatus.Lock()
+	defer svc.muNetworkStatus.Unlock()
+
+	status := *svc.networkStatus
+	return &status
+}
+
+// isOffline returns whether the node is known to have no peer, an unknown
+// status isn't considered offline
+func (svc *service) isOffline() bool {
+	return svc.getNetworkStatus().GetState() == mt.NetworkStatus_Offline
+}
+
+// networkStatusChanged returns a channel closed on the next network state
+// change
+func (svc *service) networkStatusChanged() <-chan struct{} {
+	svc.muNetworkStatus.Lock()
+	defer svc.muNetworkStatus.Unlock()
+
+	return svc.networkStatusChange
+}
+
+// monitorNetworkStatus periodically derives the network status from the
+// peers of the node and streams its changes
+func (svc *service) monitorNetworkStatus(ctx context.Context) {
+	ticker := time.NewTicker(networkStatusPollInterval)
+	defer ticker.Stop()
+
+	for {
+		svc.updateNetworkStatus(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (svc *service) updateNetworkStatus(ctx context.Context) {
+	state, connected := mt.NetworkStatus_Unknown, int32(0)
+	if reply, err := svc.protocolClient.PeerList(ctx, &protocoltypes.PeerList_Request{}); err != nil {
+		svc.logger.Debug("unable to list peers", zap.Error(err))
+	} else {
+		for _, peer := range reply.GetPeers() {
+			if peer.GetIsActive() {
+				connected++
+			}
+		}
+
+		state = mt.NetworkStatus_Offline
+		if connected > 0 {
+			state = mt.NetworkStatus_Online
+		}
+	}
+
+	svc.muNetworkStatus.Lock()
+	changed := svc.networkStatus.GetState() != state
+	svc.networkStatus.ConnectedPeers = connected
+	if changed {
+		svc.networkStatus.State = state
+		svc.networkStatus.ChangedDate = messengerutil.TimestampMs(time.Now())
+
+		close(svc.networkStatusChange)
+		svc.networkStatusChange = make(chan struct{})
+	}
+	status := *svc.networkStatus
+	svc.muNetworkStatus.Unlock()
+
+	if !changed {
+		return
+	}
+
+	svc.logger.Info("network status changed", zap.String("state", state.String()), zap.Int32("connected-peers", connected))
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeNetworkStatusChanged, &mt.StreamEvent_NetworkStatusChanged{Status: &status}, false); err != nil {
+		svc.logger.Warn("unable to stream network status", zap.Error(err))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/gogo/protobuf/proto"
 	"go.uber.org/multierr"
 
+	"berty.tech/berty/v2/go/internal/messengerutil"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 )
 
@@ -17,6 +18,7 @@ type Notifiee interface {
 type Dispatcher struct {
 	mutex     sync.RWMutex
 	notifiees map[Notifiee]struct{}
+	snoozer   messengerutil.NotificationSnoozer
 }
 
 func (d *Dispatcher) Register(n Notifiee) func() {
@@ -42,15 +44,22 @@ func (d *Dispatcher) UnregisterAll() {
 }
 
 func (d *Dispatcher) StreamEvent(typ messengertypes.StreamEvent_Type, msg proto.Message, isNew bool) error {
+	return d.StreamEventWithTraceParent(typ, msg, isNew, "")
+}
+
+// StreamEventWithTraceParent streams an event along with the trace context of
+// the span which emitted it
+func (d *Dispatcher) StreamEventWithTraceParent(typ messengertypes.StreamEvent_Type, msg proto.Message, isNew bool, traceParent string) error {
 	payload, err := proto.Marshal(msg)
 	if err != nil {
 		return err
 	}
 
 	event := &messengertypes.StreamEvent{
-		Type:    typ,
-		Payload: payload,
-		IsNew:   isNew,
+		Type:        typ,
+		Payload:     payload,
+		IsNew:       isNew,
+		TraceParent: traceParent,
 	}
 
 	// can be parallelized if needed
@@ -65,20 +74,10 @@ func (d *Dispatcher) StreamEvent(typ messengertypes.StreamEvent_Type, msg proto.
 	return errs
 }
 
-func (d *Dispatcher) Notify(typ messengertypes.StreamEvent_Notified_Type, title, body string, msg proto.Message) error {
-	var payload []byte
-	if msg != nil {
-		var err error
-		if payload, err = proto.Marshal(msg); err != nil {
-			return err
-		}
-	}
-
-	event := &messengertypes.StreamEvent_Notified{
-		Title:   title,
-		Body:    body,
-		Type:    typ,
-		Payload: payload,
+func (d *Dispatcher) Notify(typ messengertypes.StreamEvent_Notified_Type, title, body string, msg proto.Message, group *messengertypes.StreamEvent_Notified_Group) error {
+	event, err := messengerutil.NewNotifiedEvent(d.snoozer, typ, title, body, msg, group)
+	if err != nil || event == nil {
+		return err
 	}
 
 	return d.StreamEvent(messengertypes.StreamEvent_TypeNotified, event, false)
@@ -88,8 +87,10 @@ func (d *Dispatcher) IsEnabled() bool {
 	return true
 }
 
-func NewDispatcher() *Dispatcher {
-	return &Dispatcher{notifiees: make(map[Notifiee]struct{})}
+// NewDispatcher returns a dispatcher dropping the notifications while snoozer
+// tells they are snoozed, snoozer can be nil
+func NewDispatcher(snoozer messengerutil.NotificationSnoozer) *Dispatcher {
+	return &Dispatcher{notifiees: make(map[Notifiee]struct{}), snoozer: snoozer}
 }
 
 type NotifieeBundle struct {
@@ -103,4 +104,7 @@ func (nb *NotifieeBundle) StreamEvent(c *messengertypes.StreamEvent) error {
 	return nil
 }
 
-var _ Notifiee = (*NotifieeBundle)(nil)
+var (
+	_ Notifiee                       = (*NotifieeBundle)(nil)
+	_ messengerutil.TracedDispatcher = (*Dispatcher)(nil)
+)
@@ -11,7 +11,7 @@ import (
 )
 
 func TestDispatcher(t *testing.T) {
-	d := NewDispatcher()
+	d := NewDispatcher(nil)
 
 	called := false
 	var n NotifieeBundle
@@ -40,7 +40,7 @@ func TestNotify(t *testing.T) {
 	const title string = "title"
 	const body string = "body"
 
-	d := NewDispatcher()
+	d := NewDispatcher(nil)
 
 	// register handler
 	var se *messengertypes.StreamEvent
@@ -56,7 +56,7 @@ func TestNotify(t *testing.T) {
 
 	// trigger notif
 	{
-		err := d.Notify(notifType, title, body, nil)
+		err := d.Notify(notifType, title, body, nil, nil)
 		errs := multierr.Errors(err)
 		require.Equal(t, len(errs), 1)
 		require.Equal(t, errs[0].Error(), errStr)
@@ -88,7 +88,7 @@ func TestNotifyWithPayload(t *testing.T) {
 	const notifType messengertypes.StreamEvent_Notified_Type = messengertypes.StreamEvent_Notified_TypeMessageReceived
 	conv := messengertypes.Conversation{DisplayName: "conv"}
 
-	d := NewDispatcher()
+	d := NewDispatcher(nil)
 
 	// register handler
 	var se *messengertypes.StreamEvent
@@ -104,7 +104,7 @@ func TestNotifyWithPayload(t *testing.T) {
 
 	// trigger notif with payload
 	{
-		err := d.Notify(notifType, title, body, &messengertypes.StreamEvent_Notified_MessageReceived{Conversation: &conv})
+		err := d.Notify(notifType, title, body, &messengertypes.StreamEvent_Notified_MessageReceived{Conversation: &conv}, &messengertypes.StreamEvent_Notified_Group{ConversationPublicKey: "conv_pk", Category: messengertypes.StreamEvent_Notified_Group_CategoryMessage})
 		errs := multierr.Errors(err)
 		require.Equal(t, len(errs), 1)
 		require.Equal(t, errs[0].Error(), errStr)
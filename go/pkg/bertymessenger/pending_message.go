@@ -0,0 +1,47 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// ValidatePendingMessage checks a draft without sending it, the issues found
+// are returned in the reply instead of an error
+func (svc *service) ValidatePendingMessage(ctx context.Context, req *mt.ValidatePendingMessage_Request) (*mt.ValidatePendingMessage_Reply, error) {
+	if req.GetConversationPublicKey() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	conv, err := svc.db.GetConversationByPK(req.GetConversationPublicKey())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		conv = nil
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if conv.GetType() == mt.Conversation_ContactType && conv.GetContactPublicKey() != "" {
+		contact, err := svc.db.GetContactByPK(conv.GetContactPublicKey())
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+		conv.Contact = contact
+	}
+
+	issues := messengerutil.PendingMessageIssues(conv, req)
+	if conv != nil {
+		issue, err := svc.slowModeIssue(conv.GetPublicKey(), req.GetType(), messengerutil.TimestampMs(time.Now()))
+		if err != nil {
+			return nil, err
+		} else if issue != nil {
+			issues = append(issues, issue)
+		}
+	}
+	return &mt.ValidatePendingMessage_Reply{Sendable: len(issues) == 0, Issues: issues}, nil
+}
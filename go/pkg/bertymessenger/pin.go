@@ -0,0 +1,102 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+func (svc *service) PinInteraction(ctx context.Context, req *mt.PinInteraction_Request) (*mt.PinInteraction_Reply, error) {
+	pinned, err := svc.setPinnedMessage(ctx, req.GetCID(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.PinInteraction_Reply{PinnedMessage: pinned}, nil
+}
+
+func (svc *service) UnpinInteraction(ctx context.Context, req *mt.UnpinInteraction_Request) (*mt.UnpinInteraction_Reply, error) {
+	if _, err := svc.setPinnedMessage(ctx, req.GetCID(), true); err != nil {
+		return nil, err
+	}
+
+	return &mt.UnpinInteraction_Reply{}, nil
+}
+
+func (svc *service) ConversationPinnedMessages(ctx context.Context, req *mt.ConversationPinnedMessages_Request) (*mt.ConversationPinnedMessages_Reply, error) {
+	pinned, interactions, err := svc.db.GetPinnedMessages(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ConversationPinnedMessages_Reply{PinnedMessages: pinned, Interactions: interactions}, nil
+}
+
+// setPinnedMessage stores a pin update and sends it to the members of the
+// conversation of the interaction
+func (svc *service) setPinnedMessage(ctx context.Context, cid string, removed bool) (*mt.PinnedMessage, error) {
+	if cid == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("an interaction cid is required"))
+	}
+
+	inte, err := svc.db.GetInteractionByCID(cid)
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	conv, err := svc.db.GetConversationByPK(inte.GetConversationPublicKey())
+	if err != nil {
+		return nil, errcode.ErrNotFound.Wrap(err)
+	}
+
+	if conv.IsLocal() {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the interactions of a local conversation can't be pinned"))
+	}
+
+	gpkb, err := messengerutil.B64DecodeBytes(conv.GetPublicKey())
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	pinned := &mt.PinnedMessage{
+		InteractionCID:        cid,
+		ConversationPublicKey: conv.GetPublicKey(),
+		MemberPublicKey:       conv.GetAccountMemberPublicKey(),
+		UpdatedDate:           messengerutil.TimestampMs(time.Now()),
+		Removed:               removed,
+	}
+
+	// the app message is handled by this device too, its date makes it a no-op
+	am, err := mt.AppMessage_TypePinMessage.MarshalPayload(pinned.GetUpdatedDate(), cid, &mt.AppMessage_PinMessage{Removed: removed})
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	// unlike bookmarks, pins are shared with the other members and are only
+	// applied once sent
+	if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+		return nil, errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	svc.handlerMutex.Lock()
+	changed, err := svc.db.SetPinnedMessage(*pinned)
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypePinnedMessageUpdated, &mt.StreamEvent_PinnedMessageUpdated{PinnedMessage: pinned}, false); err != nil {
+			svc.logger.Warn("unable to stream pinned message update", zap.Error(err))
+		}
+	}
+
+	return pinned, nil
+}
@@ -0,0 +1,122 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+func (svc *service) PreferencesExport(ctx context.Context, req *mt.PreferencesExport_Request) (*mt.PreferencesExport_Reply, error) {
+	prefs, err := svc.db.GetPreferences()
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := proto.Marshal(prefs)
+	if err != nil {
+		return nil, errcode.ErrSerialization.Wrap(err)
+	}
+
+	return &mt.PreferencesExport_Reply{Document: document}, nil
+}
+
+func (svc *service) PreferencesImport(ctx context.Context, req *mt.PreferencesImport_Request) (_ *mt.PreferencesImport_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Importing preferences")
+	defer func() { endSection(err, "") }()
+
+	if len(req.GetDocument()) == 0 {
+		return nil, errcode.ErrMissingInput
+	}
+
+	prefs := &mt.Preferences{}
+	if err := proto.Unmarshal(req.GetDocument(), prefs); err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if prefs.GetQuietHoursEnabled() {
+		if err := mt.ValidateQuietHours(prefs.GetQuietHoursStart(), prefs.GetQuietHoursEnd()); err != nil {
+			return nil, err
+		}
+	}
+
+	if prefs.GetLocalRetentionDays() < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the retention can't be negative: %d", prefs.GetLocalRetentionDays()))
+	}
+
+	if _, ok := mt.Account_PresenceVisibility_name[int32(prefs.GetPresenceVisibility())]; !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown presence visibility: %d", prefs.GetPresenceVisibility()))
+	}
+
+	// the messages can't be translated without a provider
+	if svc.translator == nil {
+		for _, conv := range prefs.GetConversations() {
+			conv.AutoTranslateLanguage = ""
+		}
+	}
+
+	svc.handlerMutex.Lock()
+	skipped, err := svc.db.SetPreferences(prefs)
+	if err != nil {
+		svc.handlerMutex.Unlock()
+		return nil, err
+	}
+	contacts, members, err := svc.db.SetPresenceVisibility(prefs.GetPresenceVisibility())
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Imported preferences", tyber.WithDetail("SkippedConversations", fmt.Sprintf("%d", len(skipped))))
+
+	for _, c := range contacts {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: c}, false); err != nil {
+			return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+		}
+	}
+
+	for _, m := range members {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: m}, false); err != nil {
+			return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+		}
+	}
+
+	isSkipped := make(map[string]bool, len(skipped))
+	for _, pk := range skipped {
+		isSkipped[pk] = true
+	}
+
+	for _, c := range prefs.GetConversations() {
+		if c.GetPublicKey() == "" || isSkipped[c.GetPublicKey()] {
+			continue
+		}
+
+		conv, err := svc.db.GetConversationByPK(c.GetPublicKey())
+		if err != nil {
+			svc.logger.Warn("unable to get conversation", logutil.PrivateString("conversation-pk", c.GetPublicKey()), zap.Error(err))
+			continue
+		}
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+			return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+		}
+	}
+
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	svc.enforceLocalRetention()
+
+	return &mt.PreferencesImport_Reply{SkippedConversations: skipped}, nil
+}
@@ -0,0 +1,125 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/lifecycle"
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// sendPresenceBeacons periodically sends a presence beacon while the app is
+// active, and once more every time it becomes active
+func (svc *service) sendPresenceBeacons(ctx context.Context) {
+	for {
+		state := svc.lcmanager.GetCurrentState()
+		// beacons sent while offline would be stale once delivered
+		if state == lifecycle.StateActive && !svc.isOffline() {
+			svc.broadcastPresence(ctx)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, mt.PresenceBeaconInterval)
+		svc.lcmanager.WaitForStateChange(waitCtx, state)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// broadcastPresence sends a presence beacon to the conversations allowed by
+// the presence visibility of the account
+func (svc *service) broadcastPresence(ctx context.Context) {
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		svc.logger.Error("unable to get account", zap.Error(err))
+		return
+	}
+
+	visibility := acc.GetPresenceVisibility()
+	if visibility == mt.Account_PresenceVisibilityNobody {
+		return
+	}
+
+	convs, err := svc.db.GetAllConversations()
+	if err != nil {
+		svc.logger.Error("unable to get conversations", zap.Error(err))
+		return
+	}
+
+	am, err := mt.AppMessage_TypePresence.MarshalPayload(messengerutil.TimestampMs(time.Now()), "", &mt.AppMessage_Presence{})
+	if err != nil {
+		svc.logger.Error("unable to marshal presence", zap.Error(err))
+		return
+	}
+
+	for _, conv := range convs {
+		if !visibility.SharesPresenceIn(conv.GetType()) {
+			continue
+		}
+
+		gpkb, err := messengerutil.B64DecodeBytes(conv.GetPublicKey())
+		if err != nil {
+			svc.logger.Error("unable to decode conversation pk", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), zap.Error(err))
+			continue
+		}
+
+		if err := svc.outboundLimiter.Wait(ctx, mt.AppMessage_TypePresence); err != nil {
+			svc.logger.Debug("presence not sent", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), zap.Error(err))
+			continue
+		}
+
+		if _, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: am}); err != nil {
+			svc.logger.Debug("unable to send presence", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), zap.Error(err))
+		}
+	}
+}
+
+func (svc *service) PresenceSetVisibility(ctx context.Context, req *mt.PresenceSetVisibility_Request) (_ *mt.PresenceSetVisibility_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Setting presence visibility")
+	defer func() { endSection(err, "") }()
+
+	if _, ok := mt.Account_PresenceVisibility_name[int32(req.GetVisibility())]; !ok {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown presence visibility: %d", req.GetVisibility()))
+	}
+
+	svc.handlerMutex.Lock()
+	contacts, members, err := svc.db.SetPresenceVisibility(req.GetVisibility())
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Updated presence visibility", tyber.WithDetail("Visibility", req.GetVisibility().String()))
+
+	for _, c := range contacts {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeContactUpdated, &mt.StreamEvent_ContactUpdated{Contact: c}, false); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	for _, m := range members {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeMemberUpdated, &mt.StreamEvent_MemberUpdated{Member: m}, false); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false); err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	return &mt.PresenceSetVisibility_Reply{}, nil
+}
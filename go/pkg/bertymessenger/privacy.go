@@ -0,0 +1,45 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+func (svc *service) ReceiptPrivacySet(ctx context.Context, req *mt.ReceiptPrivacySet_Request) (_ *mt.ReceiptPrivacySet_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Setting receipt privacy")
+	defer func() { endSection(err, "") }()
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	convPK := req.GetConversationPublicKey()
+	if err := svc.db.SetReceiptPrivacy(convPK, req.GetDisableReadReceipts(), req.GetDisableTypingIndicators()); err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Updated receipt privacy", tyber.WithDetail("ConversationPublicKey", convPK))
+
+	if convPK == "" {
+		acc, err := svc.db.GetAccount()
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	} else {
+		conv, err := svc.db.GetConversationByPK(convPK)
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+	}
+
+	return &mt.ReceiptPrivacySet_Reply{}, nil
+}
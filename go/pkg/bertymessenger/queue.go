@@ -0,0 +1,136 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"github.com/gofrs/uuid"
+	ipfscid "github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+// queuedCIDPrefix prefixes the local CIDs of the queued interactions so they
+// can't collide with the CIDs of the sent ones
+const queuedCIDPrefix = "queued-"
+
+// isQueueable returns whether the messages of type typ are queued instead of
+// failing when they can't be sent
+func isQueueable(typ mt.AppMessage_Type) bool {
+	return typ == mt.AppMessage_TypeUserMessage || typ == mt.AppMessage_TypeGroupInvitation || typ == mt.AppMessage_TypeContactShare
+}
+
+// enqueueInteraction stores an app message which couldn't be sent and streams
+// its queued interaction, it returns the local CID of the interaction
+func (svc *service) enqueueInteraction(gpk string, typ mt.AppMessage_Type, payload []byte, targetCID string, sentDate int64, am []byte) (string, error) {
+	conv, err := svc.db.GetConversationByPK(gpk)
+	if err != nil {
+		return "", errcode.ErrDBRead.Wrap(err)
+	}
+
+	memberPK := conv.GetLocalMemberPublicKey()
+	if memberPK == "" {
+		memberPK = conv.GetAccountMemberPublicKey()
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", errcode.ErrInternal.Wrap(err)
+	}
+	cid := queuedCIDPrefix + id.String()
+
+	svc.handlerMutex.Lock()
+	_, err = svc.db.EnqueueInteraction(mt.Interaction{
+		CID:                   cid,
+		Type:                  typ,
+		ConversationPublicKey: gpk,
+		MemberPublicKey:       memberPK,
+		DevicePublicKey:       conv.GetLocalDevicePublicKey(),
+		Payload:               payload,
+		IsMine:                true,
+		SentDate:              sentDate,
+		TargetCID:             targetCID,
+	}, am)
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	if err := messengerutil.StreamInteraction(svc.dispatcher, svc.db, cid, true); err != nil {
+		svc.logger.Warn("unable to stream queued interaction", zap.Error(err))
+	}
+
+	return cid, nil
+}
+
+// deliverQueuedMessages sends the queued messages periodically and whenever
+// the state of the application or of the network changes, nothing is sent
+// while the node is offline
+func (svc *service) deliverQueuedMessages(ctx context.Context) {
+	for {
+		state := svc.lcmanager.GetCurrentState()
+		if !svc.isOffline() {
+			svc.flushQueuedMessages(ctx)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, queuedMessagesRetryInterval)
+		go func() {
+			select {
+			case <-svc.networkStatusChanged():
+				cancel()
+			case <-waitCtx.Done():
+			}
+		}()
+		svc.lcmanager.WaitForStateChange(waitCtx, state)
+		cancel()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// flushQueuedMessages sends the queued messages in order, it stops at the
+// first one which still can't be sent. The queued interactions are deleted
+// once sent, the sent ones are received from the group.
+func (svc *service) flushQueuedMessages(ctx context.Context) {
+	queued, err := svc.db.GetQueuedMessages()
+	if err != nil {
+		svc.logger.Error("unable to get queued messages", zap.Error(err))
+		return
+	}
+
+	for _, qm := range queued {
+		gpkb, err := messengerutil.B64DecodeBytes(qm.GetConversationPublicKey())
+		if err != nil {
+			svc.logger.Error("unable to decode conversation pk", logutil.PrivateString("conversation-pk", qm.GetConversationPublicKey()), zap.Error(err))
+			continue
+		}
+
+		reply, err := svc.protocolClient.AppMessageSend(ctx, &protocoltypes.AppMessageSend_Request{GroupPK: gpkb, Payload: qm.GetPayload()})
+		if err != nil {
+			svc.logger.Debug("unable to send queued message", logutil.PrivateString("cid", qm.GetCID()), zap.Error(err))
+			return
+		}
+
+		svc.handlerMutex.Lock()
+		err = svc.db.DequeueInteraction(qm.GetCID())
+		svc.handlerMutex.Unlock()
+		if err != nil {
+			svc.logger.Error("unable to dequeue interaction", logutil.PrivateString("cid", qm.GetCID()), zap.Error(err))
+			continue
+		}
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: qm.GetCID(), ConversationPublicKey: qm.GetConversationPublicKey()}, false); err != nil {
+			svc.logger.Warn("unable to stream interaction deletion", zap.Error(err))
+		}
+
+		if cid, err := ipfscid.Cast(reply.GetCID()); err == nil {
+			go svc.interactionDelayedActions(cid, gpkb)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ConversationSetReadPosition(ctx context.Context, req *mt.ConversationSetReadPosition_Request) (*mt.ConversationSetReadPosition_Reply, error) {
+	if req.GetConversationPublicKey() == "" || req.GetCID() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key and a cid are required"))
+	}
+
+	svc.handlerMutex.Lock()
+	conversation, moved, err := svc.db.SetConversationReadPosition(req.GetConversationPublicKey(), req.GetCID())
+	svc.handlerMutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	} else if !moved {
+		return &mt.ConversationSetReadPosition_Reply{Conversation: conversation}, nil
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	// the read receipt moves the position of the other devices of the account
+	if !conversation.IsLocal() {
+		target, err := svc.db.GetInteractionByCID(req.GetCID())
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		go func() {
+			if err := svc.sendReadReceiptUpTo(conversation.GetPublicKey(), target); err != nil {
+				svc.logger.Warn("unable to send read receipt", logutil.PrivateString("conversation-pk", conversation.GetPublicKey()), zap.Error(err))
+			}
+		}()
+	}
+
+	return &mt.ConversationSetReadPosition_Reply{Conversation: conversation}, nil
+}
@@ -0,0 +1,147 @@
+package bertymessenger
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	ipfscid "github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/protocoltypes"
+)
+
+const (
+	missingInteractionsInterval    = time.Minute
+	missingInteractionsBatchSize   = 50
+	missingInteractionsMaxAttempts = 5
+	missingInteractionsMinBackoff  = time.Minute
+)
+
+// recoverMissingInteractions looks up the interactions referenced but not
+// received in the log of their group. The log is replicated from the other
+// members and the replication services, a missing interaction is found once
+// it reached this device, or given up after missingInteractionsMaxAttempts.
+func (svc *service) recoverMissingInteractions(ctx context.Context) {
+	ticker := time.NewTicker(missingInteractionsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := svc.recoverMissingInteractionsOnce(ctx); err != nil {
+			svc.logger.Warn("unable to recover missing interactions", zap.Error(err))
+		}
+	}
+}
+
+func (svc *service) recoverMissingInteractionsOnce(ctx context.Context) error {
+	now := time.Now()
+
+	due, err := svc.db.GetDueMissingInteractions(messengerutil.TimestampMs(now), missingInteractionsBatchSize)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	retainedSince := svc.retainedSince(now)
+
+	byConversation := map[string]map[string]bool{}
+	for _, m := range due {
+		if byConversation[m.ConversationPublicKey] == nil {
+			byConversation[m.ConversationPublicKey] = map[string]bool{}
+		}
+		byConversation[m.ConversationPublicKey][m.CID] = true
+	}
+
+	for convPK, wanted := range byConversation {
+		if err := svc.lookupGroupMessages(ctx, convPK, wanted, retainedSince); err != nil {
+			svc.logger.Warn("unable to look up missing interactions", logutil.PrivateString("conversation-pk", convPK), zap.Error(err))
+		}
+	}
+
+	// the interactions found were removed from the missing ones when stored,
+	// updating the others is a no-op
+	for _, m := range due {
+		attempts := m.Attempts + 1
+		next := int64(0)
+		if attempts < missingInteractionsMaxAttempts {
+			next = messengerutil.TimestampMs(now.Add(missingInteractionsMinBackoff << attempts))
+		}
+
+		svc.handlerMutex.Lock()
+		err := svc.db.SetMissingInteractionAttempt(m.CID, attempts, next)
+		svc.handlerMutex.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retainedSince returns the date in ms before which the messages aren't kept
+// by the local retention, they must not come back
+func (svc *service) retainedSince(now time.Time) int64 {
+	if acc, err := svc.db.GetAccount(); err == nil && acc.GetLocalRetentionDays() > 0 {
+		return messengerutil.TimestampMs(now.AddDate(0, 0, -int(acc.GetLocalRetentionDays())))
+	}
+
+	return 0
+}
+
+// lookupGroupMessages reads the log of a group from the most recent message
+// and handles the wanted ones, until every one is found
+func (svc *service) lookupGroupMessages(ctx context.Context, convPK string, wanted map[string]bool, retainedSince int64) error {
+	gpk, err := messengerutil.B64DecodeBytes(convPK)
+	if err != nil {
+		return errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := svc.protocolClient.GroupMessageList(ctx, &protocoltypes.GroupMessageList_Request{GroupPK: gpk, UntilNow: true, ReverseOrder: true})
+	if err != nil {
+		return errcode.ErrEventListMessage.Wrap(err)
+	}
+
+	for len(wanted) > 0 {
+		evt, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errcode.ErrEventListMessage.Wrap(err)
+		}
+
+		id, err := ipfscid.Cast(evt.GetEventContext().GetID())
+		if err != nil || !wanted[id.String()] {
+			continue
+		}
+		delete(wanted, id.String())
+
+		var am mt.AppMessage
+		if err := proto.Unmarshal(evt.GetMessage(), &am); err != nil {
+			continue
+		}
+
+		if am.GetSentDate() < retainedSince {
+			continue
+		}
+
+		svc.logger.Debug("found missing interaction", logutil.PrivateString("cid", id.String()))
+		if err := svc.handleGroupEvent(&messengerutil.GroupEvent{GroupPK: gpk, Message: evt}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
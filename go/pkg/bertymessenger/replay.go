@@ -3,28 +3,32 @@ package bertymessenger
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"time"
 
-	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
-	"github.com/golang/protobuf/proto"
 	"go.uber.org/zap"
 
 	"berty.tech/berty/v2/go/internal/messengerdb"
 	"berty.tech/berty/v2/go/internal/messengerpayloads"
 	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/protoutil"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/berty/v2/go/pkg/protocoltypes"
 	"berty.tech/berty/v2/go/pkg/tyber"
 )
 
-func getEventsReplayerForDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, log *zap.Logger) func(db *messengerdb.DBWrapper) error {
+func getEventsReplayerForDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, log *zap.Logger, progress *messengerutil.ReplayProgress) func(db *messengerdb.DBWrapper) error {
 	return func(db *messengerdb.DBWrapper) error {
-		return replayLogsToDB(ctx, client, db, log)
+		return replayLogsToDB(ctx, client, db, log, progress)
 	}
 }
 
-func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, wrappedDB *messengerdb.DBWrapper, log *zap.Logger) (err error) {
+// replayLogsToDB handles the events of the account group and of every
+// conversation newer than their checkpoint, everything is replayed on a new or
+// rebuilt database. The progress is streamed once the conversations are known.
+func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceClient, wrappedDB *messengerdb.DBWrapper, log *zap.Logger, progress *messengerutil.ReplayProgress) (err error) {
 	ctx, _, endSection := tyber.Section(ctx, log, "Replaying logs to database")
 	defer func() { endSection(err, "") }()
 
@@ -44,7 +48,7 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 	// Replay all account group metadata events
 	// TODO: We should have a toggle to "lock" orbitDB while we replaying events
 	// So we don't miss events that occurred during the replay
-	if err := processMetadataList(cfg.GetAccountGroupPK(), handler, client); err != nil {
+	if _, err := processMetadataList(cfg.GetAccountGroupPK(), handler, client, wrappedDB); err != nil {
 		return errcode.ErrReplayProcessGroupMetadata.Wrap(err)
 	}
 
@@ -54,7 +58,10 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 		return errcode.ErrDBRead.Wrap(err)
 	}
 
-	for _, conv := range convs {
+	streamReplayProgress(log, progress.Start(len(convs)))
+	defer func() { streamReplayProgress(log, progress.Finish(err)) }()
+
+	for i, conv := range convs {
 		// Replay all other group metadata events
 		groupPK, err := messengerutil.B64DecodeBytes(conv.GetPublicKey())
 		if err != nil {
@@ -65,6 +72,7 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 		// is always activated
 		// TODO: check with @glouvigny if we could launch the protocol
 		// without activating the account group
+		metadataEvents := int64(0)
 		if !bytes.Equal(groupPK, cfg.GetAccountGroupPK()) {
 			if _, err := client.ActivateGroup(ctx, &protocoltypes.ActivateGroup_Request{
 				GroupPK:   groupPK,
@@ -73,13 +81,14 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 				return errcode.ErrGroupActivate.Wrap(err)
 			}
 
-			if err := processMetadataList(groupPK, handler, client); err != nil {
+			if metadataEvents, err = processMetadataList(groupPK, handler, client, wrappedDB); err != nil {
 				return errcode.ErrReplayProcessGroupMetadata.Wrap(err)
 			}
 		}
 
 		// Replay all group message events
-		if err := processMessageList(groupPK, handler, client); err != nil {
+		messageEvents, err := processMessageList(groupPK, handler, client, wrappedDB)
+		if err != nil {
 			return errcode.ErrReplayProcessGroupMessage.Wrap(err)
 		}
 
@@ -91,74 +100,203 @@ func replayLogsToDB(ctx context.Context, client protocoltypes.ProtocolServiceCli
 				return errcode.ErrGroupDeactivate.Wrap(err)
 			}
 		}
+
+		tyber.LogStep(ctx, log, fmt.Sprintf("Replayed group %d/%d", i+1, len(convs)), tyber.WithDetail("GroupPK", conv.GetPublicKey()))
+		streamReplayProgress(log, progress.GroupReplayed(conv.GetPublicKey(), metadataEvents+messageEvents))
 	}
 
 	return nil
 }
 
-func processMetadataList(groupPK []byte, handler *messengerpayloads.EventHandler, client protocoltypes.ProtocolServiceClient) error {
+// streamReplayProgress logs the failures to stream the progress of a replay,
+// they don't stop it
+func streamReplayProgress(log *zap.Logger, err error) {
+	if err != nil {
+		log.Warn("unable to stream replay progress", zap.Error(err))
+	}
+}
+
+func (svc *service) RebuildFromCheckpoint(ctx context.Context, req *messengertypes.RebuildFromCheckpoint_Request) (_ *messengertypes.RebuildFromCheckpoint_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Rebuilding database from replay checkpoints")
+	defer func() { endSection(err, "") }()
+
+	groups := [][]byte(nil)
+	if convPK := req.GetConversationPublicKey(); convPK != "" {
+		if _, err := svc.db.GetConversationByPK(convPK); err != nil {
+			return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown conversation: %w", err))
+		}
+
+		gpkb, err := messengerutil.B64DecodeBytes(convPK)
+		if err != nil {
+			return nil, errcode.ErrDeserialization.Wrap(err)
+		}
+		groups = append(groups, gpkb)
+	} else {
+		cfg, err := svc.protocolClient.InstanceGetConfiguration(ctx, &protocoltypes.InstanceGetConfiguration_Request{})
+		if err != nil {
+			return nil, errcode.TODO.Wrap(err)
+		}
+		groups = append(groups, cfg.GetAccountGroupPK())
+
+		convs, err := svc.db.GetAllConversations()
+		if err != nil {
+			return nil, errcode.ErrDBRead.Wrap(err)
+		}
+
+		for _, conv := range convs {
+			// the left conversations no longer receive events
+			if conv.GetLeftDate() > 0 {
+				continue
+			}
+
+			gpkb, err := messengerutil.B64DecodeBytes(conv.GetPublicKey())
+			if err != nil {
+				return nil, errcode.ErrDeserialization.Wrap(err)
+			}
+
+			if !bytes.Equal(gpkb, cfg.GetAccountGroupPK()) {
+				groups = append(groups, gpkb)
+			}
+		}
+	}
+
+	// the live events wait for the rebuild, the checkpoints would be moved
+	// concurrently otherwise
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	if req.GetResetCheckpoints() {
+		if err := svc.db.DeleteReplayCheckpoints(req.GetConversationPublicKey()); err != nil {
+			return nil, err
+		}
+	}
+
+	handler := svc.eventHandler.WithContext(ctx).WithReplay()
+	reply := &messengertypes.RebuildFromCheckpoint_Reply{}
+
+	streamReplayProgress(svc.logger, svc.replayProgress.Start(len(groups)))
+	defer func() { streamReplayProgress(svc.logger, svc.replayProgress.Finish(err)) }()
+
+	for _, gpkb := range groups {
+		// the groups which aren't subscribed are only opened for the rebuild
+		if !svc.groupSubscriber.IsSubscribed(gpkb) {
+			if _, err := svc.protocolClient.ActivateGroup(ctx, &protocoltypes.ActivateGroup_Request{GroupPK: gpkb, LocalOnly: true}); err != nil {
+				return nil, errcode.ErrGroupActivate.Wrap(err)
+			}
+		}
+
+		metadataEvents, err := processMetadataList(gpkb, handler, svc.protocolClient, svc.db)
+		reply.MetadataEvents += metadataEvents
+		if err != nil {
+			return nil, errcode.ErrReplayProcessGroupMetadata.Wrap(err)
+		}
+
+		messageEvents, err := processMessageList(gpkb, handler, svc.protocolClient, svc.db)
+		reply.MessageEvents += messageEvents
+		if err != nil {
+			return nil, errcode.ErrReplayProcessGroupMessage.Wrap(err)
+		}
+
+		tyber.LogStep(ctx, svc.logger, "Rebuilt group from replay checkpoint", tyber.WithDetail("GroupPK", messengerutil.B64EncodeBytes(gpkb)), tyber.WithDetail("MetadataEvents", fmt.Sprintf("%d", metadataEvents)), tyber.WithDetail("MessageEvents", fmt.Sprintf("%d", messageEvents)))
+		streamReplayProgress(svc.logger, svc.replayProgress.GroupReplayed(messengerutil.B64EncodeBytes(gpkb), metadataEvents+messageEvents))
+	}
+
+	return reply, nil
+}
+
+// processMetadataList handles the metadata events of a group newer than its
+// checkpoint, it returns the number of events handled
+func processMetadataList(groupPK []byte, handler *messengerpayloads.EventHandler, client protocoltypes.ProtocolServiceClient, db *messengerdb.DBWrapper) (int64, error) {
+	groupPKStr := messengerutil.B64EncodeBytes(groupPK)
+
+	checkpoint, err := db.GetReplayCheckpoint(groupPKStr)
+	if err != nil {
+		return 0, err
+	}
+
 	metaList, err := client.GroupMetadataList(
 		handler.Ctx(),
 		&protocoltypes.GroupMetadataList_Request{
 			GroupPK:  groupPK,
+			SinceID:  checkpoint.GetMetadataEventID(),
 			UntilNow: true,
 		},
 	)
 	if err != nil {
-		return errcode.ErrEventListMetadata.Wrap(err)
+		return 0, errcode.ErrEventListMetadata.Wrap(err)
 	}
 
+	handled := int64(0)
 	for {
 		if handler.Ctx().Err() != nil {
-			return errcode.ErrEventListMetadata.Wrap(err)
+			return handled, errcode.ErrEventListMetadata.Wrap(err)
 		}
 
 		metadata, err := metaList.Recv()
 		if err == io.EOF {
-			return nil
+			return handled, nil
 		} else if err != nil {
-			return errcode.ErrEventListMetadata.Wrap(err)
+			return handled, errcode.ErrEventListMetadata.Wrap(err)
 		}
 
 		if err := handler.HandleMetadataEvent(metadata); err != nil {
-			return err
+			return handled, err
+		}
+		handled++
+
+		if err := db.SetReplayMetadataCheckpoint(groupPKStr, metadata.GetEventContext().GetID(), messengerutil.TimestampMs(time.Now())); err != nil {
+			return handled, err
 		}
 	}
 }
 
-func processMessageList(groupPK []byte, handler *messengerpayloads.EventHandler, client protocoltypes.ProtocolServiceClient) error {
+// processMessageList handles the message events of a group newer than its
+// checkpoint, it returns the number of events handled
+func processMessageList(groupPK []byte, handler *messengerpayloads.EventHandler, client protocoltypes.ProtocolServiceClient, db *messengerdb.DBWrapper) (int64, error) {
 	groupPKStr := messengerutil.B64EncodeBytes(groupPK)
 
+	checkpoint, err := db.GetReplayCheckpoint(groupPKStr)
+	if err != nil {
+		return 0, err
+	}
+
 	msgList, err := client.GroupMessageList(
 		handler.Ctx(),
 		&protocoltypes.GroupMessageList_Request{
 			GroupPK:  groupPK,
+			SinceID:  checkpoint.GetMessageEventID(),
 			UntilNow: true,
 		},
 	)
 	if err != nil {
-		return errcode.ErrEventListMessage.Wrap(err)
+		return 0, errcode.ErrEventListMessage.Wrap(err)
 	}
 
+	handled := int64(0)
 	for {
 		if handler.Ctx().Err() != nil {
-			return errcode.ErrEventListMessage.Wrap(err)
+			return handled, errcode.ErrEventListMessage.Wrap(err)
 		}
 
 		message, err := msgList.Recv()
 		if err == io.EOF {
-			return nil
+			return handled, nil
 		} else if err != nil {
-			return errcode.ErrEventListMessage.Wrap(err)
+			return handled, errcode.ErrEventListMessage.Wrap(err)
 		}
 
 		var appMsg messengertypes.AppMessage
-		if err := proto.Unmarshal(message.GetMessage(), &appMsg); err != nil {
-			return errcode.ErrDeserialization.Wrap(err)
+		if err := protoutil.Unmarshal(message.GetMessage(), &appMsg); err != nil {
+			return handled, errcode.ErrDeserialization.Wrap(err)
 		}
 
 		if err := handler.HandleAppMessage(groupPKStr, message, &appMsg); err != nil {
-			return errcode.TODO.Wrap(err)
+			return handled, errcode.TODO.Wrap(err)
+		}
+		handled++
+
+		if err := db.SetReplayMessageCheckpoint(groupPKStr, message.GetEventContext().GetID(), messengerutil.TimestampMs(time.Now())); err != nil {
+			return handled, err
 		}
 	}
 }
@@ -0,0 +1,99 @@
+package bertymessenger
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const defaultResyncAmount = 50
+
+func (svc *service) Resync(req *mt.Resync_Request, sub mt.MessengerService_ResyncServer) error {
+	amount := req.GetAmount()
+	if amount <= 0 {
+		amount = defaultResyncAmount
+	}
+
+	// taken before reading the db, the updates racing with the resync are sent again on the next one
+	cursor := messengerutil.TimestampMs(time.Now())
+
+	send := func(typ mt.StreamEvent_Type, payload proto.Message) error {
+		p, err := proto.Marshal(payload)
+		if err != nil {
+			return errcode.ErrSerialization.Wrap(err)
+		}
+
+		return sub.Send(&mt.Resync_Reply{Event: &mt.StreamEvent{Type: typ, Payload: p}})
+	}
+
+	known := make(map[string]string, len(req.GetConversations()))
+	for _, c := range req.GetConversations() {
+		known[c.GetConversationPublicKey()] = c.GetLatestCID()
+	}
+
+	convs, err := svc.db.GetAllConversations()
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	truncated := []string(nil)
+	sent := 0
+	for _, conv := range convs {
+		latestCID, isKnown := known[conv.GetPublicKey()]
+		delete(known, conv.GetPublicKey())
+
+		interactions, isTruncated, err := svc.db.GetInteractionsSince(conv.GetPublicKey(), latestCID, amount)
+		if err != nil {
+			return err
+		}
+
+		if !isKnown || conv.GetLastUpdate() > req.GetCursor() || len(interactions) > 0 {
+			if err := send(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}); err != nil {
+				return err
+			}
+		}
+
+		for _, inte := range interactions {
+			if err := send(mt.StreamEvent_TypeInteractionUpdated, &mt.StreamEvent_InteractionUpdated{Interaction: inte}); err != nil {
+				return err
+			}
+		}
+		sent += len(interactions)
+
+		if isTruncated {
+			truncated = append(truncated, conv.GetPublicKey())
+		}
+	}
+
+	// the remaining conversations were deleted meanwhile
+	deleted := make([]string, 0, len(known))
+	for pk := range known {
+		deleted = append(deleted, pk)
+	}
+	sort.Strings(deleted)
+
+	for _, pk := range deleted {
+		if err := send(mt.StreamEvent_TypeConversationDeleted, &mt.StreamEvent_ConversationDeleted{PublicKey: pk}); err != nil {
+			return err
+		}
+	}
+
+	svc.logger.Info("resynced client", zap.Int("interactions", sent), zap.Int("truncated", len(truncated)), zap.Int("deleted", len(deleted)))
+
+	p, err := proto.Marshal(&mt.StreamEvent_ListEnded{})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	return sub.Send(&mt.Resync_Reply{
+		Event:               &mt.StreamEvent{Type: mt.StreamEvent_TypeListEnded, Payload: p},
+		Cursor:              cursor,
+		TruncatedPublicKeys: truncated,
+	})
+}
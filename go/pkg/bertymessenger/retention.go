@@ -0,0 +1,115 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+const maintenanceInterval = time.Hour
+
+func (svc *service) LocalRetentionSet(ctx context.Context, req *mt.LocalRetentionSet_Request) (_ *mt.LocalRetentionSet_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Setting local retention")
+	defer func() { endSection(err, "") }()
+
+	if req.GetDays() < 0 {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the retention can't be negative: %d", req.GetDays()))
+	}
+
+	if err := svc.db.SetLocalRetentionDays(req.GetDays()); err != nil {
+		return nil, err
+	}
+	tyber.LogStep(ctx, svc.logger, "Updated local retention", tyber.WithDetail("Days", fmt.Sprintf("%d", req.GetDays())))
+
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeAccountUpdated, &mt.StreamEvent_AccountUpdated{Account: acc}, false); err != nil {
+		return nil, errcode.TODO.Wrap(err)
+	}
+
+	svc.enforceLocalRetention()
+
+	return &mt.LocalRetentionSet_Reply{}, nil
+}
+
+// runMaintenance periodically runs the housekeeping tasks of the local
+// database
+func (svc *service) runMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(maintenanceInterval)
+	defer ticker.Stop()
+
+	for {
+		svc.enforceLocalRetention()
+		svc.pruneBacklog()
+		svc.pruneStagedMedias()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// enforceLocalRetention removes the interactions and the medias older than
+// the local retention of the account, they are only removed from this device
+func (svc *service) enforceLocalRetention() {
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		svc.logger.Warn("unable to get account", zap.Error(err))
+		return
+	}
+
+	days := acc.GetLocalRetentionDays()
+	if days <= 0 {
+		return
+	}
+
+	before := messengerutil.TimestampMs(time.Now().AddDate(0, 0, -int(days)))
+
+	svc.handlerMutex.Lock()
+	pruned, err := svc.db.PruneInteractionsBefore(before)
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		svc.logger.Warn("unable to prune interactions", zap.Error(err))
+		return
+	}
+
+	for _, i := range pruned {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: i.GetCID(), ConversationPublicKey: i.GetConversationPublicKey()}, false); err != nil {
+			svc.logger.Warn("unable to stream interaction deletion", zap.Error(err))
+		}
+	}
+
+	if _, err := svc.db.PruneMediasUnusedSince(before); err != nil {
+		svc.logger.Warn("unable to prune medias", zap.Error(err))
+	}
+}
+
+// pruneBacklog removes the interactions whose device was never added to their
+// group before the expiry of the backlog
+func (svc *service) pruneBacklog() {
+	svc.handlerMutex.Lock()
+	pruned, err := svc.db.Backlog().Prune(time.Now())
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		svc.logger.Warn("unable to prune backlog", zap.Error(err))
+		return
+	}
+
+	for _, i := range pruned {
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeInteractionDeleted, &mt.StreamEvent_InteractionDeleted{CID: i.GetCID(), ConversationPublicKey: i.GetConversationPublicKey()}, false); err != nil {
+			svc.logger.Warn("unable to stream interaction deletion", zap.Error(err))
+		}
+	}
+}
@@ -8,13 +8,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"sync"
 	"time"
 
 	sqlite "github.com/flyingtime/gorm-sqlcipher"
-	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
-	"github.com/golang/protobuf/proto"
 	ipfs_interface "github.com/ipfs/interface-go-ipfs-core"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"moul.io/u"
@@ -27,6 +28,7 @@ import (
 	"berty.tech/berty/v2/go/internal/messengerpayloads"
 	"berty.tech/berty/v2/go/internal/messengerutil"
 	"berty.tech/berty/v2/go/internal/notification"
+	"berty.tech/berty/v2/go/internal/protoutil"
 	"berty.tech/berty/v2/go/pkg/bertyprotocol"
 	"berty.tech/berty/v2/go/pkg/bertypush"
 	"berty.tech/berty/v2/go/pkg/bertyversion"
@@ -41,8 +43,40 @@ type Service interface {
 	Close()
 }
 
+// AppMessageHandlerRegistry is implemented by the services returned by New,
+// it lets the embedders handle AppMessage types of their own without
+// changing the messenger
+type AppMessageHandlerRegistry interface {
+	// RegisterAppMessageHandler sets the handler of a custom AppMessage type,
+	// it fails if the type already has one. The messages received before the
+	// handler is registered are ignored, see Opts.AppMessageHandlers.
+	RegisterAppMessageHandler(typ mt.AppMessage_Type, handler mt.CustomAppMessageHandler, visible bool) error
+}
+
 // service is a Service
-var _ Service = (*service)(nil)
+var (
+	_ Service                   = (*service)(nil)
+	_ AppMessageHandlerRegistry = (*service)(nil)
+)
+
+const (
+	outboxFlushInterval = 10 * time.Second
+	handlerDrainTimeout = 3 * time.Second
+
+	// slowHandlerThreshold is the duration above which the handling of a
+	// protocol event is logged as a warning
+	slowHandlerThreshold = time.Second
+
+	// defaultHandlerTimeout is the time given to the handling of a protocol
+	// event when Opts.HandlerTimeouts doesn't set one
+	defaultHandlerTimeout = time.Minute
+
+	// queuedMessagesRetryInterval is the delay between attempts to send the
+	// messages queued while the node couldn't send them
+	queuedMessagesRetryInterval = 30 * time.Second
+
+	defaultMediaCacheMaxSize = 50 * 1024 * 1024
+)
 
 type service struct {
 	logger                *zap.Logger
@@ -54,7 +88,7 @@ type service struct {
 	cancelFn              func()
 	optsCleanup           func()
 	ctx                   context.Context
-	handlerMutex          sync.Mutex
+	handlerMutex          sync.RWMutex
 	notifmanager          notification.Manager
 	lcmanager             *lifecycle.Manager
 	eventHandler          *messengerpayloads.EventHandler
@@ -70,6 +104,26 @@ type service struct {
 	subsCtx               context.Context
 	subsMutex             *sync.Mutex
 	groupsToSubTo         map[string]struct{}
+	groupSubscriber       *messengerutil.GroupSubscriber
+	groupEventRetrier     *messengerutil.GroupEventRetrier
+	replayProgress        *messengerutil.ReplayProgress
+	ipfsCoreAPI           ipfs_interface.CoreAPI
+	mediaCacheMaxSize     int64
+	avatarFetches         map[string] /* cid */ *avatarFetch
+	muAvatarFetches       sync.Mutex
+	networkStatus         *mt.NetworkStatus_Status
+	outboundLimiter       *messengerutil.OutboundLimiter
+	ackBatcher            *messengerutil.AckBatcher
+	featureFlags          *featureFlags
+	networkStatusChange   chan struct{}
+	muNetworkStatus       sync.Mutex
+	grpcInsecure          bool
+	translator            Translator
+	linkPreviewClient     *http.Client
+	linkPreviewQueue      chan linkPreviewJob
+	deliveryLatency       prometheus.Histogram
+	acksSent              prometheus.Counter
+	metricsServer         *http.Server
 }
 
 type Opts struct {
@@ -82,6 +136,59 @@ type Opts struct {
 	PlatformPushToken   *protocoltypes.PushServiceReceiver
 	Ring                *zapring.Core
 
+	// IPFSCoreAPI is used to publish and fetch avatars, they are disabled if
+	// it is not set.
+	IPFSCoreAPI ipfs_interface.CoreAPI
+
+	// MediaCacheMaxSize is the size, in bytes, above which the least recently
+	// used cached avatars are removed.
+	MediaCacheMaxSize int64
+
+	// Translator is used to translate messages, on demand or automatically for
+	// the conversations configured to, translations are disabled if it is not
+	// set.
+	Translator Translator
+
+	// LinkPreviewClient is used to fetch the previews of the links sent in
+	// the messages, it must use the proxy or Tor transport of the node so
+	// the linked sites don't learn the address of the device. Link previews
+	// are disabled if it is not set.
+	LinkPreviewClient *http.Client
+
+	// GRPCInsecureMode disables TLS when connecting to the directory services.
+	GRPCInsecureMode bool
+
+	// DisableSystemConversation stops generating the local conversation
+	// holding the onboarding tips and the changelogs.
+	DisableSystemConversation bool
+
+	// MetricsRegistry is used to register the messenger metrics, they are
+	// disabled if it is not set.
+	MetricsRegistry prometheus.Registerer
+
+	// MetricsListener is the address of an optional HTTP listener serving
+	// the metrics on /metrics, a registry is created if MetricsRegistry is
+	// not set. Otherwise MetricsRegistry must also be a prometheus.Gatherer.
+	MetricsListener string
+
+	// TracerProvider is used to trace the handling of the protocol events, up
+	// to the stream events sent to the clients. It is disabled if not set.
+	TracerProvider trace.TracerProvider
+
+	// HandlerTimeouts bounds the time given to the handling of the protocol
+	// events, a handler running late has its transaction rolled back and its
+	// event fails. Default is one minute if not set, a negative duration
+	// disables the timeout.
+	HandlerTimeouts messengerpayloads.HandlerTimeouts
+
+	// AppMessageHandlers are the handlers of the AppMessage types defined by
+	// the embedder, see mt.NewCustomAppMessageType. They are registered before
+	// any message is handled, more can be added later with
+	// RegisterAppMessageHandler. The messages of the custom types can be sent
+	// with Interact, they are ignored by the members without a handler for
+	// them.
+	AppMessageHandlers []mt.AppMessageHandlerRegistration
+
 	// LogFilePath defines the location of the current session's log file.
 	//
 	// This variable is used by svc.TyberHostAttach.
@@ -121,6 +228,18 @@ func (opts *Opts) applyDefaults() (func(), error) {
 		opts.LifeCycleManager = lifecycle.NewManager(lifecycle.StateActive)
 	}
 
+	if opts.MediaCacheMaxSize == 0 {
+		opts.MediaCacheMaxSize = defaultMediaCacheMaxSize
+	}
+
+	if opts.HandlerTimeouts.Default == 0 {
+		opts.HandlerTimeouts.Default = defaultHandlerTimeout
+	}
+
+	if opts.MetricsListener != "" && opts.MetricsRegistry == nil {
+		opts.MetricsRegistry = prometheus.NewRegistry()
+	}
+
 	opts.Logger = opts.Logger.Named("msg")
 	return cleanup, nil
 }
@@ -142,7 +261,7 @@ func databaseStateRestoreAccountHandler(statePointer *mt.LocalDatabaseState) ber
 				return true, errcode.ErrInternal.Wrap(fmt.Errorf("unexpected file size"))
 			}
 
-			if err := proto.Unmarshal(backupContents.Bytes(), statePointer); err != nil {
+			if err := protoutil.Unmarshal(backupContents.Bytes(), statePointer); err != nil {
 				return true, errcode.ErrDeserialization.Wrap(err)
 			}
 
@@ -170,16 +289,21 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 	ctx, cancel := context.WithCancel(context.Background())
 	db := messengerdb.NewDBWrapper(opts.DB, opts.Logger)
 
+	// the progress of a rebuild is kept for the clients subscribing once
+	// the service is started
+	dispatcher := NewDispatcher(db)
+	replayProgress := messengerutil.NewReplayProgress(dispatcher)
+
 	if opts.StateBackup != nil {
 		tyber.LogStep(tyberCtx, opts.Logger, "Restoring db state")
 
 		if err := db.RestoreFromBackup(opts.StateBackup, func() error {
-			return replayLogsToDB(ctx, client, db, opts.Logger)
+			return replayLogsToDB(ctx, client, db, opts.Logger, replayProgress)
 		}); err != nil {
 			cancel()
 			return nil, errcode.ErrDBWrite.Wrap(fmt.Errorf("unable to restore exported state: %w", err))
 		}
-	} else if err := db.InitDB(getEventsReplayerForDB(ctx, client, opts.Logger)); err != nil {
+	} else if err := db.InitDB(getEventsReplayerForDB(ctx, client, opts.Logger, replayProgress)); err != nil {
 		cancel()
 		return nil, errcode.TODO.Wrap(fmt.Errorf("error during db init: %w", err))
 	}
@@ -216,20 +340,101 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		db:                    db,
 		notifmanager:          opts.NotificationManager,
 		lcmanager:             opts.LifeCycleManager,
-		dispatcher:            NewDispatcher(),
+		dispatcher:            dispatcher,
 		cancelFn:              cancel,
 		optsCleanup:           optsCleanup,
 		ctx:                   ctx,
-		handlerMutex:          sync.Mutex{},
+		handlerMutex:          sync.RWMutex{},
 		ring:                  opts.Ring,
 		logFilePath:           opts.LogFilePath,
 		cancelGroupStatus:     make(map[string] /* groupPK */ context.CancelFunc),
 		knownPeers:            make(map[string] /* peer.ID */ protocoltypes.GroupDeviceStatus_Type),
 		subsMutex:             &sync.Mutex{},
 		groupsToSubTo:         make(map[string]struct{}),
+		groupSubscriber:       messengerutil.NewGroupSubscriber(client, opts.Logger.Named("sub"), messengerutil.DefaultGroupEventsDemand),
+		groupEventRetrier:     messengerutil.NewGroupEventRetrier(db, opts.Logger.Named("sub"), messengerutil.DefaultGroupEventAttempts, 0),
+		replayProgress:        replayProgress,
+		ipfsCoreAPI:           opts.IPFSCoreAPI,
+		mediaCacheMaxSize:     opts.MediaCacheMaxSize,
+		avatarFetches:         make(map[string] /* cid */ *avatarFetch),
+		networkStatus:         &mt.NetworkStatus_Status{},
+		outboundLimiter:       messengerutil.NewOutboundLimiter(messengerutil.DefaultOutboundBudgets),
+		networkStatusChange:   make(chan struct{}),
+		grpcInsecure:          opts.GRPCInsecureMode,
+		translator:            opts.Translator,
+		linkPreviewClient:     opts.LinkPreviewClient,
+	}
+
+	if svc.featureFlags, err = loadFeatureFlags(db); err != nil {
+		return nil, errcode.TODO.Wrap(fmt.Errorf("unable to load feature flags: %w", err))
 	}
 
-	svc.eventHandler = messengerpayloads.NewEventHandler(ctx, db, &MetaFetcherFromProtocolClient{client: client}, newPostActionsService(&svc), opts.Logger, svc.dispatcher, false)
+	svc.ackBatcher = messengerutil.NewAckBatcher(messengerutil.AckBatchWindow, messengerutil.AckBatchMaxSize, svc.sendBatchedAcks)
+
+	if svc.linkPreviewClient != nil {
+		svc.linkPreviewQueue = make(chan linkPreviewJob, linkPreviewQueueSize)
+	}
+
+	middlewares := []messengerpayloads.HandlerMiddleware(nil)
+	if opts.TracerProvider != nil {
+		middlewares = append(middlewares, messengerpayloads.TracingMiddleware(opts.TracerProvider))
+	}
+	middlewares = append(middlewares, messengerpayloads.LoggingMiddleware(opts.Logger, slowHandlerThreshold))
+
+	if opts.MetricsRegistry != nil {
+		svc.deliveryLatency = prometheus.NewHistogram(deliveryLatencyOpts)
+		if err := opts.MetricsRegistry.Register(svc.deliveryLatency); err != nil {
+			return nil, errcode.TODO.Wrap(fmt.Errorf("unable to register messenger metrics: %w", err))
+		}
+
+		metrics, err := messengerpayloads.MetricsMiddleware(opts.MetricsRegistry)
+		if err != nil {
+			return nil, err
+		}
+		middlewares = append(middlewares, metrics)
+	}
+
+	// a handler stuck on a protocol call fails its event instead of blocking
+	// the ones after it
+	timeouts, err := messengerpayloads.TimeoutMiddleware(opts.Logger, opts.HandlerTimeouts, opts.MetricsRegistry)
+	if err != nil {
+		return nil, err
+	}
+	middlewares = append(middlewares, timeouts)
+
+	// a handler panicking fails its event instead of the whole node
+	middlewares = append(middlewares, messengerpayloads.RecoveryMiddleware(opts.Logger))
+
+	svc.eventHandler = messengerpayloads.NewEventHandler(ctx, db, &MetaFetcherFromProtocolClient{client: client}, newPostActionsService(&svc), opts.Logger, svc.dispatcher, false, middlewares...)
+	if opts.MetricsRegistry != nil {
+		duplicates := prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName("berty", "messenger", "suppressed_duplicate_events_total"),
+			Help: "protocol events delivered again and ignored because they were already handled",
+		}, func() float64 { return float64(svc.eventHandler.SuppressedDuplicates()) })
+		if err := opts.MetricsRegistry.Register(duplicates); err != nil {
+			return nil, errcode.TODO.Wrap(fmt.Errorf("unable to register messenger metrics: %w", err))
+		}
+
+		if err := svc.registerPipelineMetrics(opts.MetricsRegistry); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.MetricsListener != "" {
+		gatherer, ok := opts.MetricsRegistry.(prometheus.Gatherer)
+		if !ok {
+			return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("the metrics registry can't be served, it is not a gatherer"))
+		}
+
+		if err := svc.serveMetrics(opts.MetricsListener, gatherer); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range opts.AppMessageHandlers {
+		if err := svc.eventHandler.RegisterAppMessageHandler(r.Type, r.Handler, r.Visible); err != nil {
+			return nil, err
+		}
+	}
 	svc.pushReceiver = bertypush.NewPushReceiver(bertypush.NewPushHandlerViaProtocol(ctx, client), svc.eventHandler, svc.db, opts.Logger)
 
 	// get or create account in DB
@@ -257,6 +462,16 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		}
 	}
 
+	// onboarding tips and changelogs are best effort
+	if !opts.DisableSystemConversation {
+		if err := svc.updateSystemConversation(); err != nil {
+			opts.Logger.Warn("unable to update system conversation", zap.Error(err))
+		}
+	}
+
+	// drop the avatars which aren't used anymore
+	svc.pruneMedias()
+
 	// monitor messenger lifecycle
 	go svc.monitorState(ctx)
 
@@ -278,8 +493,11 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 
 		if svc.lcmanager.GetCurrentState() == lifecycle.StateInactive {
 			if err := svc.notifmanager.Notify(&notification.Notification{
-				Title: notif.GetTitle(),
-				Body:  notif.GetBody(),
+				Title:     notif.GetTitle(),
+				Body:      notif.GetBody(),
+				GroupKey:  notif.GetGroup().GetConversationPublicKey(),
+				ThreadKey: notif.GetGroup().ThreadKey(),
+				Category:  notif.GetGroup().CategoryName(),
 			}); err != nil {
 				opts.Logger.Error("unable to trigger notify", zap.Error(err))
 			}
@@ -288,6 +506,38 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		return nil
 	}})
 
+	// deliver stream events left in the outbox
+	go svc.deliverOutbox(ctx)
+
+	// watch whether the node is connected to other peers
+	go svc.monitorNetworkStatus(ctx)
+
+	// send the messages queued while the node couldn't send them
+	go svc.deliverQueuedMessages(ctx)
+
+	// tell the contacts we're online
+	go svc.sendPresenceBeacons(ctx)
+
+	// handle the events of every subscribed group
+	go svc.handleGroupEvents(ctx)
+
+	// prune what the local retention doesn't keep anymore
+	go svc.runMaintenance(ctx)
+
+	// close the conversations left open by the clients which went away
+	go svc.expireConversationSessions(ctx)
+
+	// remove the disappearing messages once they expire
+	go svc.purgeExpiredInteractions(ctx)
+
+	// look up the interactions referenced but not received
+	go svc.recoverMissingInteractions(ctx)
+
+	if svc.linkPreviewClient != nil {
+		// fetch the previews of the links sent in the messages
+		go svc.generateLinkPreviews(ctx)
+	}
+
 	if opts.PlatformPushToken != nil {
 		icr, err = client.InstanceGetConfiguration(ctx, &protocoltypes.InstanceGetConfiguration_Request{})
 		if err != nil {
@@ -314,6 +564,10 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 		}
 
 		for _, cv := range convs {
+			if cv.IsLocal() || cv.GetLeftDate() > 0 {
+				continue
+			}
+
 			gpkb, err := messengerutil.B64DecodeBytes(cv.GetPublicKey())
 			if err != nil {
 				return nil, errcode.ErrDeserialization.Wrap(err)
@@ -354,6 +608,44 @@ func New(client protocoltypes.ProtocolServiceClient, opts *Opts) (_ Service, err
 	return &svc, nil
 }
 
+// deliverOutbox flushes the stream events left in the outbox by a previous
+// session, then periodically retries the ones a failed flush left behind
+func (svc *service) deliverOutbox(ctx context.Context) {
+	ticker := time.NewTicker(outboxFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := svc.eventHandler.FlushOutbox(); err != nil {
+			svc.logger.Error("unable to flush outbox", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// broadcastAccountUserInfo sends the account info to every conversation
+func (svc *service) broadcastAccountUserInfo(ctx context.Context) {
+	convos, err := svc.db.GetAllConversations()
+	if err != nil {
+		svc.logger.Error("unable to get conversations", zap.Error(err))
+		return
+	}
+
+	for _, conv := range convos {
+		if conv.IsLocal() {
+			continue
+		}
+
+		if err := svc.sendAccountUserInfo(ctx, conv.GetPublicKey()); err != nil {
+			svc.logger.Error("unable to send user info", zap.Error(err))
+		}
+	}
+}
+
 func (svc *service) sendAccountUserInfo(ctx context.Context, groupPK string) (err error) {
 	ctx, _, endSection := tyber.Section(ctx, svc.logger, fmt.Sprintf("Sending account info to group %s", groupPK))
 	defer func() {
@@ -372,10 +664,21 @@ func (svc *service) sendAccountUserInfo(ctx context.Context, groupPK string) (er
 		return errcode.ErrDBRead.Wrap(err)
 	}
 
+	links := make([]string, len(acc.GetLinks()))
+	for i, link := range acc.GetLinks() {
+		links[i] = link.GetURL()
+	}
+
 	am, err := mt.AppMessage_TypeSetUserInfo.MarshalPayload(
 		messengerutil.TimestampMs(time.Now()),
 		"",
-		&mt.AppMessage_SetUserInfo{DisplayName: acc.GetDisplayName()},
+		&mt.AppMessage_SetUserInfo{
+			DisplayName:  acc.GetDisplayName(),
+			AvatarCID:    acc.GetAvatarCID(),
+			Bio:          acc.GetBio(),
+			Links:        links,
+			Capabilities: []mt.AppMessage_Capability{mt.AppMessage_CapabilityCompactPayload},
+		},
 	)
 	if err != nil {
 		return errcode.ErrSerialization.Wrap(err)
@@ -390,9 +693,29 @@ func (svc *service) sendAccountUserInfo(ctx context.Context, groupPK string) (er
 	return nil
 }
 
+func (svc *service) RegisterAppMessageHandler(typ mt.AppMessage_Type, handler mt.CustomAppMessageHandler, visible bool) error {
+	return svc.eventHandler.RegisterAppMessageHandler(typ, handler, visible)
+}
+
 func (svc *service) Close() {
 	ctx, _ := tyber.ContextWithTraceID(svc.ctx)
 	svc.logger.Debug("Closing MessengerService", tyber.FormatTraceLogFields(ctx)...)
+
+	// let the in-flight events be committed and dispatched before tearing down
+	drainCtx, cancelDrain := context.WithTimeout(ctx, handlerDrainTimeout)
+	if err := svc.eventHandler.Close(drainCtx); err != nil {
+		svc.logger.Warn("unable to drain event handler", zap.Error(err))
+	}
+	cancelDrain()
+
+	svc.ackBatcher.Close()
+
+	if svc.metricsServer != nil {
+		if err := svc.metricsServer.Close(); err != nil {
+			svc.logger.Warn("unable to stop metrics server", zap.Error(err))
+		}
+	}
+
 	svc.dispatcher.UnregisterAll()
 	svc.cancelFn()
 	svc.optsCleanup()
@@ -429,13 +752,25 @@ func (svc *service) ActivateContactGroup(contactPK []byte) error {
 	return svc.ActivateGroup(groupPK)
 }
 
-func (svc *service) SendAck(cid, conversationPK string) error {
-	tyber.LogStep(svc.ctx, svc.logger, fmt.Sprintf("Sending acknowledge with target %s on group %s", cid, conversationPK))
+// SendAcks acknowledges the messages of a conversation in a single app
+// message, the first one is its target and the others are listed in its
+// payload
+func (svc *service) SendAcks(cids []string, conversationPK string) error {
+	if len(cids) == 0 {
+		return nil
+	}
+
+	tyber.LogStep(svc.ctx, svc.logger, fmt.Sprintf("Sending acknowledge of %d messages on group %s", len(cids), conversationPK), tyber.WithJSONDetail("CIDs", cids))
 	logError := func(text string, err error) error { return tyber.LogError(svc.ctx, svc.logger, text, err) }
 
-	// TODO: Don't send ack if message is already acked to prevent spam in multimember groups
-	// Maybe wait a few seconds before checking since we're likely to receive the message before any ack
-	amp, err := mt.AppMessage_TypeAcknowledge.MarshalPayload(0, cid, &mt.AppMessage_Acknowledge{})
+	if disabled, _, err := svc.db.GetReceiptPrivacy(conversationPK); err != nil {
+		return logError("Failed to get receipt privacy", err)
+	} else if disabled {
+		tyber.LogStep(svc.ctx, svc.logger, "Read receipts are disabled, acknowledge not sent")
+		return nil
+	}
+
+	amp, err := mt.AppMessage_TypeAcknowledge.MarshalPayload(messengerutil.TimestampMs(time.Now()), cids[0], &mt.AppMessage_Acknowledge{TargetCIDs: cids[1:]})
 	if err != nil {
 		return logError("Failed to marshal acknowledge", err)
 	}
@@ -445,6 +780,10 @@ func (svc *service) SendAck(cid, conversationPK string) error {
 		return logError("Failed to decode conversation public key", err)
 	}
 
+	if err := svc.outboundLimiter.Wait(svc.ctx, mt.AppMessage_TypeAcknowledge); err != nil {
+		return logError("Rate limited", err)
+	}
+
 	reply, err := svc.protocolClient.AppMessageSend(svc.ctx, &protocoltypes.AppMessageSend_Request{
 		GroupPK: cpk,
 		Payload: amp,
@@ -454,9 +793,105 @@ func (svc *service) SendAck(cid, conversationPK string) error {
 	}
 	tyber.LogStep(svc.ctx, svc.logger, "Acknowledge sent", tyber.WithCIDDetail("CID", reply.GetCID()))
 
+	if svc.acksSent != nil {
+		svc.acksSent.Add(float64(len(cids)))
+	}
+
 	return nil
 }
 
+func (svc *service) sendBatchedAcks(conversationPK string, cids []string) {
+	if err := svc.SendAcks(cids, conversationPK); err != nil {
+		svc.logger.Error("error while sending ack", logutil.PrivateString("public-key", conversationPK), zap.Strings("cids", cids), zap.Error(err))
+	}
+}
+
+// SendDeliveryReceipt tells the sender of an interaction that it has been
+// stored on this device
+func (svc *service) SendDeliveryReceipt(cid, conversationPK string) error {
+	amp, err := mt.AppMessage_TypeDeliveryReceipt.MarshalPayload(messengerutil.TimestampMs(time.Now()), cid, &mt.AppMessage_DeliveryReceipt{})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	cpk, err := messengerutil.B64DecodeBytes(conversationPK)
+	if err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if err := svc.outboundLimiter.Wait(svc.ctx, mt.AppMessage_TypeDeliveryReceipt); err != nil {
+		return err
+	}
+
+	if _, err := svc.protocolClient.AppMessageSend(svc.ctx, &protocoltypes.AppMessageSend_Request{
+		GroupPK: cpk,
+		Payload: amp,
+	}); err != nil {
+		return errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return nil
+}
+
+// sendReadReceipt tells the members of a conversation that every message
+// received so far has been read
+func (svc *service) sendReadReceipt(conversationPK string) error {
+	latest, err := svc.db.GetLatestReceivedInteraction(conversationPK)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	return svc.sendReadReceiptUpTo(conversationPK, latest)
+}
+
+// sendReadReceiptUpTo tells the members of a conversation and the other
+// devices of the account that every message up to target has been read
+func (svc *service) sendReadReceiptUpTo(conversationPK string, target *mt.Interaction) error {
+	if disabled, _, err := svc.db.GetReceiptPrivacy(conversationPK); err != nil || disabled {
+		return err
+	}
+
+	amp, err := mt.AppMessage_TypeReadReceipt.MarshalPayload(messengerutil.TimestampMs(time.Now()), target.GetCID(), &mt.AppMessage_ReadReceipt{ReadUpToDate: target.GetSentDate()})
+	if err != nil {
+		return errcode.ErrSerialization.Wrap(err)
+	}
+
+	cpk, err := messengerutil.B64DecodeBytes(conversationPK)
+	if err != nil {
+		return errcode.ErrDeserialization.Wrap(err)
+	}
+
+	if err := svc.outboundLimiter.Wait(svc.ctx, mt.AppMessage_TypeReadReceipt); err != nil {
+		return err
+	}
+
+	if _, err := svc.protocolClient.AppMessageSend(svc.ctx, &protocoltypes.AppMessageSend_Request{
+		GroupPK: cpk,
+		Payload: amp,
+	}); err != nil {
+		return errcode.ErrProtocolSend.Wrap(err)
+	}
+
+	return nil
+}
+
+// sendReadReceiptAsync sends a read receipt without blocking, the outbound
+// rate limiter may delay it
+func (svc *service) sendReadReceiptAsync(conv *mt.Conversation) {
+	if conv.IsLocal() {
+		return
+	}
+
+	pk := conv.GetPublicKey()
+	go func() {
+		if err := svc.sendReadReceipt(pk); err != nil {
+			svc.logger.Warn("unable to send read receipt", logutil.PrivateString("conversation-pk", pk), zap.Error(err))
+		}
+	}()
+}
+
 func (svc *service) sharePushTokenForConversation(conversation *mt.Conversation) error {
 	if conversation == nil {
 		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("no conversation supplied"))
@@ -570,6 +1005,10 @@ func (svc *service) pushDeviceTokenBroadcast(account *mt.Account) error {
 	}
 
 	for _, c := range conversations {
+		if c.IsLocal() {
+			continue
+		}
+
 		if err := svc.sharePushTokenForConversationInternal(c, server, token); err != nil {
 			svc.logger.Error("unable to share push token on conversation", logutil.PrivateString("conversation-pk", c.PublicKey), zap.Error(err))
 		}
@@ -0,0 +1,55 @@
+package bertymessenger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ipfscid "github.com/ipfs/go-cid"
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// streamServiceError tells the clients a protocol event couldn't be handled,
+// only the message events can be retried as the metadata events can't be
+// looked up by cid
+func (svc *service) streamServiceError(evt *messengerutil.GroupEvent, eventID []byte, err error) {
+	eventCID := ""
+	if cid, err := ipfscid.Cast(eventID); err == nil {
+		eventCID = cid.String()
+	}
+
+	serviceErr := messengerutil.NewServiceError(err, messengerutil.B64EncodeBytes(evt.GroupPK), eventCID)
+	serviceErr.Retryable = serviceErr.Retryable && evt.Message != nil && eventCID != ""
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeServiceError, serviceErr, false); err != nil {
+		svc.logger.Warn("unable to stream service error", zap.Error(err))
+	}
+}
+
+func (svc *service) ServiceEventRetry(ctx context.Context, req *mt.ServiceEventRetry_Request) (*mt.ServiceEventRetry_Reply, error) {
+	if req.GetConversationPublicKey() == "" || req.GetEventCID() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key and an event cid are required"))
+	}
+
+	if _, err := ipfscid.Decode(req.GetEventCID()); err != nil {
+		return nil, errcode.ErrInvalidInput.Wrap(err)
+	}
+
+	wanted := map[string]bool{req.GetEventCID(): true}
+	if err := svc.lookupGroupMessages(ctx, req.GetConversationPublicKey(), wanted, svc.retainedSince(time.Now())); err != nil {
+		return nil, err
+	}
+
+	if wanted[req.GetEventCID()] {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("event not found in the group log: %s", req.GetEventCID()))
+	}
+
+	svc.logger.Info("retried event", logutil.PrivateString("conversation-pk", req.GetConversationPublicKey()), logutil.PrivateString("cid", req.GetEventCID()))
+
+	return &mt.ServiceEventRetry_Reply{}, nil
+}
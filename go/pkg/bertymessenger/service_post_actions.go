@@ -82,8 +82,30 @@ func (p serviceEventHandlerPostActions) ContactConversationJoined(contact *messe
 }
 
 func (p *serviceEventHandlerPostActions) InteractionReceived(i *messengertypes.Interaction) error {
-	if err := p.svc.SendAck(i.CID, i.ConversationPublicKey); err != nil {
-		p.svc.logger.Error("error while sending ack", logutil.PrivateString("public-key", i.ConversationPublicKey), logutil.PrivateString("cid", i.CID), zap.Error(err))
+	p.svc.observeDeliveryLatency(i)
+
+	// the acknowledges of a conversation are sent together, the outbound rate
+	// limiter may delay the receipt, the event handler must not wait for them
+	cid, gpk := i.CID, i.ConversationPublicKey
+	if p.svc.featureFlags.Enabled(messengertypes.FeatureFlag_FeatureAckBatching) {
+		p.svc.ackBatcher.Add(gpk, cid)
+	} else {
+		go p.svc.sendBatchedAcks(gpk, []string{cid})
+	}
+	go func() {
+		if err := p.svc.SendDeliveryReceipt(cid, gpk); err != nil {
+			p.svc.logger.Error("error while sending delivery receipt", logutil.PrivateString("public-key", gpk), logutil.PrivateString("cid", cid), zap.Error(err))
+		}
+	}()
+
+	if language := i.GetConversation().GetAutoTranslateLanguage(); language != "" && p.svc.translator != nil {
+		go p.svc.autoTranslateInteraction(i, language)
+	}
+
+	if i.GetType() == messengertypes.AppMessage_TypeUserMessage {
+		if payload, err := i.UnmarshalPayload(); err == nil {
+			p.svc.queueLinkPreviews(i.GetCID(), payload.(*messengertypes.AppMessage_UserMessage))
+		}
 	}
 
 	return nil
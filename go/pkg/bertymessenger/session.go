@@ -0,0 +1,39 @@
+package bertymessenger
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// expireConversationSessions closes the conversations whose clients stopped
+// sending heartbeats
+func (svc *service) expireConversationSessions(ctx context.Context) {
+	ticker := time.NewTicker(mt.ConversationSessionTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		svc.handlerMutex.Lock()
+		closed, err := svc.db.ExpireConversationSessions(time.Now())
+		svc.handlerMutex.Unlock()
+		if err != nil {
+			svc.logger.Warn("unable to expire conversation sessions", zap.Error(err))
+			continue
+		}
+
+		for _, conv := range closed {
+			if err := svc.conversationClosed(conv); err != nil {
+				svc.logger.Warn("unable to close conversation", zap.Error(err))
+			}
+		}
+	}
+}
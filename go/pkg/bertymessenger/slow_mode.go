@@ -0,0 +1,43 @@
+package bertymessenger
+
+import (
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+// slowModeIssue returns the reason preventing the account from sending an
+// interaction of type typ in a conversation at date because of its slow mode,
+// only the creators of the conversation can change the slow mode
+func (svc *service) slowModeIssue(convPK string, typ mt.AppMessage_Type, date int64) (*mt.ValidatePendingMessage_Issue, error) {
+	if typ == mt.AppMessage_TypeSetSlowMode {
+		admin, err := svc.db.IsConversationAdmin(convPK, "", true)
+		if err != nil || admin {
+			return nil, err
+		}
+
+		return &mt.ValidatePendingMessage_Issue{Reason: mt.ValidatePendingMessage_ReasonNotConversationAdmin, Detail: "only the creators of the conversation can change its slow mode"}, nil
+	}
+
+	if !messengerutil.IsSlowModeLimited(typ) {
+		return nil, nil
+	}
+
+	wait, err := svc.db.SlowModeWait(convPK, "", true, date)
+	if err != nil || wait == 0 {
+		return nil, err
+	}
+
+	return &mt.ValidatePendingMessage_Issue{Reason: mt.ValidatePendingMessage_ReasonSlowMode, Detail: fmt.Sprintf("the conversation is in slow mode, the next message can be sent in %s", (time.Duration(wait) * time.Millisecond).Round(time.Second))}, nil
+}
+
+func slowModeIssueError(issue *mt.ValidatePendingMessage_Issue) error {
+	if issue.GetReason() == mt.ValidatePendingMessage_ReasonSlowMode {
+		return errcode.ErrMessengerSlowMode.Wrap(fmt.Errorf("%s", issue.GetDetail()))
+	}
+
+	return errcode.ErrInvalidInput.Wrap(fmt.Errorf("%s", issue.GetDetail()))
+}
@@ -0,0 +1,133 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+const (
+	// stagedMediaTTL is how long a staged media which isn't referenced by a
+	// draft is kept
+	stagedMediaTTL = 7 * 24 * time.Hour
+
+	stagedMediaFilenameMaxLength = 255
+)
+
+func (svc *service) MediaStage(ctx context.Context, req *mt.MediaStage_Request) (_ *mt.MediaStage_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Staging media")
+	defer func() { endSection(err, "") }()
+
+	data := req.GetData()
+	if len(data) == 0 {
+		return nil, errcode.ErrMissingInput
+	}
+
+	if len(data) > messengerutil.StagedMediaMaxSize {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("attachment is too large: %d bytes, max is %d", len(data), messengerutil.StagedMediaMaxSize))
+	}
+
+	if len(req.GetFilename()) > stagedMediaFilenameMaxLength {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("filename is too long"))
+	}
+
+	cid, err := messengerutil.LocalMediaCID(data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := messengerutil.TimestampMs(time.Now())
+
+	// the content was already processed and stored
+	svc.handlerMutex.Lock()
+	staged, err := svc.db.ReuseStagedMedia(cid, now)
+	svc.handlerMutex.Unlock()
+	if err == nil {
+		return &mt.MediaStage_Reply{Media: staged, Reused: true}, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	content, err := messengerutil.NewStagedMedia(data)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbnail := svc.stagedMediaThumbnail(content)
+
+	staged = &mt.StagedMedia{
+		CID:        content.GetCID(),
+		MimeType:   content.GetMimeType(),
+		Filename:   req.GetFilename(),
+		DataSize:   int64(len(data)),
+		StagedDate: now,
+	}
+
+	svc.handlerMutex.Lock()
+	err = svc.db.AddStagedMedia(staged, content, thumbnail)
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.MediaStage_Reply{Media: staged}, nil
+}
+
+func (svc *service) MediaStagedDiscard(ctx context.Context, req *mt.MediaStagedDiscard_Request) (*mt.MediaStagedDiscard_Reply, error) {
+	if req.GetCID() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	svc.handlerMutex.Lock()
+	err := svc.db.DiscardStagedMedia(req.GetCID())
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.MediaStagedDiscard_Reply{}, nil
+}
+
+// stagedMediaThumbnail returns the thumbnail of the images, it is nil for
+// the other medias or if the image can't be decoded
+func (svc *service) stagedMediaThumbnail(content *mt.Media) *mt.Media {
+	if !strings.HasPrefix(content.GetMimeType(), "image/") {
+		return nil
+	}
+
+	data, err := messengerutil.Thumbnail(content.GetData())
+	if err != nil {
+		svc.logger.Debug("unable to make thumbnail", logutil.PrivateString("cid", content.GetCID()), zap.Error(err))
+		return nil
+	}
+
+	cid, err := messengerutil.LocalMediaCID(data)
+	if err != nil {
+		return nil
+	}
+
+	return &mt.Media{CID: cid, MimeType: messengerutil.ThumbnailMimeType, Data: data}
+}
+
+// pruneStagedMedias removes the medias staged but never sent
+func (svc *service) pruneStagedMedias() {
+	before := messengerutil.TimestampMs(time.Now().Add(-stagedMediaTTL))
+
+	svc.handlerMutex.Lock()
+	_, err := svc.db.PruneStagedMedias(before)
+	svc.handlerMutex.Unlock()
+	if err != nil {
+		svc.logger.Warn("unable to prune staged medias", zap.Error(err))
+	}
+}
@@ -2,9 +2,8 @@ package bertymessenger
 
 import (
 	"context"
+	"sync"
 
-	// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
-	"github.com/golang/protobuf/proto"
 	ipfscid "github.com/ipfs/go-cid"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
@@ -12,6 +11,7 @@ import (
 	"berty.tech/berty/v2/go/internal/lifecycle"
 	"berty.tech/berty/v2/go/internal/logutil"
 	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/internal/protoutil"
 	"berty.tech/berty/v2/go/pkg/errcode"
 	mt "berty.tech/berty/v2/go/pkg/messengertypes"
 	"berty.tech/berty/v2/go/pkg/protocoltypes"
@@ -87,6 +87,7 @@ func (svc *service) manageSubscriptions() {
 			}
 		}
 
+		svc.groupSubscriber.UnsubscribeAll()
 		if svc.cancelSubsCtx != nil {
 			svc.cancelSubsCtx()
 		}
@@ -120,107 +121,111 @@ func (svc *service) manageSubscriptions() {
 	}
 }
 
-func (svc *service) subscribeToMetadata(ctx, tyberCtx context.Context, gpkb []byte) error {
-	tyberCtx, newTrace := tyber.ContextWithTraceID(tyberCtx)
-	traceName := "Subscribing to metadata on group " + messengerutil.B64EncodeBytes(gpkb)
-	if newTrace {
-		svc.logger.Debug(traceName, tyber.FormatTraceLogFields(tyberCtx)...)
-		defer tyber.LogTraceEnd(tyberCtx, svc.logger, "Successfully subscribed to metadata")
-	} else {
-		tyber.LogStep(tyberCtx, svc.logger, traceName)
-	}
+// handleGroupEvents handles the events of the subscribed groups, the events of
+// a group are handled one at a time in the order they were received while the
+// groups are handled in parallel, so a busy group doesn't delay the others
+func (svc *service) handleGroupEvents(ctx context.Context) {
+	workers := messengerutil.NewKeyedWorkers(messengerutil.DefaultGroupEventWorkers)
+	defer workers.Close()
 
-	// subscribe
-	s, err := svc.protocolClient.GroupMetadataList(
-		ctx,
-		&protocoltypes.GroupMetadataList_Request{GroupPK: gpkb},
-	)
-	if err != nil {
-		return errcode.ErrEventListMetadata.Wrap(err)
-	}
-	go func() {
-		for {
-			gme, err := s.Recv()
-			if err != nil {
-				svc.logStreamingError("group metadata", err)
-				return
-			}
+	// closed once the handler is, the next events would fail the same way
+	var closeOnce sync.Once
+	handlerClosed := make(chan struct{})
 
-			cid, err := ipfscid.Cast(gme.EventContext.ID)
-			eventHandler := svc.eventHandler
-			if err != nil {
-				svc.logger.Error("failed to cast cid for logging", logutil.PrivateBinary("cid-bytes", gme.EventContext.ID))
-				ctx, _ := tyber.ContextWithTraceID(svc.eventHandler.Ctx())
-				eventHandler = eventHandler.WithContext(ctx)
-			} else {
-				eventHandler = eventHandler.WithContext(tyber.ContextWithConstantTraceID(svc.eventHandler.Ctx(), "msgrcvd-"+cid.String()))
+	for {
+		select {
+		case evt := <-svc.groupSubscriber.Events():
+			// without the workers every event shares the same key, so they
+			// are handled one at a time in the order they were received
+			key := ""
+			if svc.featureFlags.Enabled(mt.FeatureFlag_FeatureGroupEventWorkers) {
+				key = messengerutil.B64EncodeBytes(evt.GroupPK)
 			}
 
-			svc.handlerMutex.Lock()
-			if err := eventHandler.HandleMetadataEvent(gme); err != nil {
-				_ = tyber.LogFatalError(eventHandler.Ctx(), eventHandler.Logger(), "Failed to handle protocol event", err)
-			} else {
-				eventHandler.Logger().Debug("Messenger event handler succeeded", tyber.FormatStepLogFields(eventHandler.Ctx(), []tyber.Detail{}, tyber.EndTrace)...)
+			// the events received once the handler is closed are dropped,
+			// they are delivered again on the next start
+			if !workers.Submit(key, func() {
+				err := svc.handleGroupEvent(evt)
+				evt.Done()
+
+				switch {
+				case errcode.Is(err, errcode.ErrMessengerHandlerClosed):
+					closeOnce.Do(func() { close(handlerClosed) })
+				case err != nil:
+					svc.logger.Error("unable to handle group event", logutil.PrivateBinary("event-id", evt.ID()), zap.Error(err))
+				}
+			}) {
+				evt.Done()
 			}
-			svc.handlerMutex.Unlock()
+		case <-handlerClosed:
+			svc.logger.Info("event handler closed, stop handling group events")
+			return
+		case <-ctx.Done():
+			return
 		}
-	}()
+	}
+}
+
+// handleGroupEvent handles a group event, again while it fails with a
+// retryable error, the clients are told about the events which still can't be
+// handled
+func (svc *service) handleGroupEvent(evt *messengerutil.GroupEvent) error {
+	err := svc.groupEventRetrier.Handle(svc.eventHandler.Ctx(), evt, func() error {
+		return svc.handleGroupEventOnce(evt)
+	})
+
+	switch {
+	case err == nil:
+		return nil
+	case errcode.Is(err, errcode.ErrMessengerHandlerClosed):
+		return err
+	}
+
+	svc.streamServiceError(evt, evt.ID(), err)
 	return nil
 }
 
-func (svc *service) subscribeToMessages(ctx, tyberCtx context.Context, gpkb []byte) error {
-	tyberCtx, newTrace := tyber.ContextWithTraceID(tyberCtx)
-	traceName := "Subscribing to messages on group " + messengerutil.B64EncodeBytes(gpkb)
-	if newTrace {
-		svc.logger.Debug(traceName, tyber.FormatTraceLogFields(tyberCtx)...)
-		defer tyber.LogTraceEnd(tyberCtx, svc.logger, "Successfully subscribed to messages")
-	} else {
-		tyber.LogStep(tyberCtx, svc.logger, traceName)
+func (svc *service) handleGroupEventOnce(evt *messengerutil.GroupEvent) error {
+	var am mt.AppMessage
+
+	eventID := evt.ID()
+	if evt.Message != nil {
+		if err := protoutil.Unmarshal(evt.Message.GetMessage(), &am); err != nil {
+			svc.logger.Warn("failed to unmarshal AppMessage", zap.Error(err))
+			return errcode.ErrDeserialization.Wrap(err)
+		}
 	}
 
-	ms, err := svc.protocolClient.GroupMessageList(
-		ctx,
-		&protocoltypes.GroupMessageList_Request{
-			GroupPK:  gpkb,
-			SinceNow: true,
-		},
-	)
+	cid, err := ipfscid.Cast(eventID)
+	eventHandler := svc.eventHandler
 	if err != nil {
-		return errcode.ErrEventListMessage.Wrap(err)
+		svc.logger.Error("failed to cast cid for logging", logutil.PrivateBinary("cid-bytes", eventID))
+		ctx, _ := tyber.ContextWithTraceID(svc.eventHandler.Ctx())
+		eventHandler = eventHandler.WithContext(ctx)
+	} else {
+		eventHandler = eventHandler.WithContext(tyber.ContextWithConstantTraceID(svc.eventHandler.Ctx(), "msgrcvd-"+cid.String()))
 	}
-	go func() {
-		for {
-			gme, err := ms.Recv()
-			if err != nil {
-				svc.logStreamingError("group message", err)
-				return
-			}
 
-			var am mt.AppMessage
-			if err := proto.Unmarshal(gme.GetMessage(), &am); err != nil {
-				svc.logger.Warn("failed to unmarshal AppMessage", zap.Error(err))
-				return
-			}
+	// the handlers of different groups can run together, the API calls
+	// writing to the database still exclude them all
+	svc.handlerMutex.RLock()
+	defer svc.handlerMutex.RUnlock()
 
-			cid, err := ipfscid.Cast(gme.EventContext.ID)
-			eventHandler := svc.eventHandler
-			if err != nil {
-				svc.logger.Error("failed to cast cid for logging", zap.String("type", am.GetType().String()), logutil.PrivateBinary("cid-bytes", gme.EventContext.ID))
-				ctx, _ := tyber.ContextWithTraceID(svc.eventHandler.Ctx())
-				eventHandler = eventHandler.WithContext(ctx)
-			} else {
-				eventHandler = eventHandler.WithContext(tyber.ContextWithConstantTraceID(svc.eventHandler.Ctx(), "msgrcvd-"+cid.String()))
-			}
+	if evt.Message != nil {
+		err = eventHandler.HandleAppMessage(messengerutil.B64EncodeBytes(evt.GroupPK), evt.Message, &am)
+	} else {
+		err = eventHandler.HandleMetadataEvent(evt.Metadata)
+	}
 
-			svc.handlerMutex.Lock()
-			if err := eventHandler.HandleAppMessage(messengerutil.B64EncodeBytes(gpkb), gme, &am); err != nil {
-				_ = tyber.LogFatalError(eventHandler.Ctx(), eventHandler.Logger(), "Failed to handle AppMessage", err)
-			} else {
-				eventHandler.Logger().Debug("AppMessage handler succeeded", tyber.FormatStepLogFields(eventHandler.Ctx(), []tyber.Detail{}, tyber.EndTrace)...)
-			}
-			svc.handlerMutex.Unlock()
-		}
-	}()
+	switch {
+	case errcode.Is(err, errcode.ErrMessengerHandlerClosed):
+		return err
+	case err != nil:
+		_ = tyber.LogFatalError(eventHandler.Ctx(), eventHandler.Logger(), "Failed to handle protocol event", err)
+		return err
+	}
+
+	eventHandler.Logger().Debug("Messenger event handler succeeded", tyber.FormatStepLogFields(eventHandler.Ctx(), []tyber.Detail{}, tyber.EndTrace)...)
 	return nil
 }
 
@@ -237,9 +242,14 @@ func (svc *service) subscribeToGroup(ctx, tyberCtx context.Context, gpkb []byte)
 		return errcode.ErrGroupActivate.Wrap(err)
 	}
 
-	if err := svc.subscribeToMetadata(ctx, tyberCtx, gpkb); err != nil {
-		return err
+	// the events handled before a restart aren't handled again
+	if checkpoint, err := svc.db.GetReplayCheckpoint(messengerutil.B64EncodeBytes(gpkb)); err != nil {
+		svc.logger.Warn("unable to get replay checkpoint", logutil.PrivateString("group-pk", messengerutil.B64EncodeBytes(gpkb)), zap.Error(err))
+	} else {
+		svc.groupSubscriber.ResumeFrom(gpkb, checkpoint.GetMetadataEventID(), checkpoint.GetMessageEventID())
 	}
 
-	return svc.subscribeToMessages(ctx, tyberCtx, gpkb)
+	tyber.LogStep(tyberCtx, svc.logger, "Subscribing to metadata and messages on group "+messengerutil.B64EncodeBytes(gpkb))
+
+	return svc.groupSubscriber.Subscribe(ctx, gpkb)
 }
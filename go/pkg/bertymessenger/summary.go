@@ -0,0 +1,76 @@
+package bertymessenger
+
+import (
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const (
+	summaryDefaultTopCount = 3
+	summaryMaxTopCount     = 10
+	summaryDefaultInterval = time.Minute
+	summaryMinInterval     = 15 * time.Second
+)
+
+// AccountSummaryStream polls the database instead of following the events of
+// the dispatcher, so a busy account doesn't wake the widgets more often than
+// they asked for
+func (svc *service) AccountSummaryStream(req *mt.AccountSummaryStream_Request, sub mt.MessengerService_AccountSummaryStreamServer) error {
+	top := int(req.GetTopCount())
+	switch {
+	case top <= 0:
+		top = summaryDefaultTopCount
+	case top > summaryMaxTopCount:
+		top = summaryMaxTopCount
+	}
+
+	interval := summaryDefaultInterval
+	if req.GetIntervalSeconds() > 0 {
+		interval = time.Duration(req.GetIntervalSeconds()) * time.Second
+		if interval < summaryMinInterval {
+			interval = summaryMinInterval
+		}
+	}
+
+	// last is the latest summary sent, without its generation date
+	var last proto.Message
+	send := func() error {
+		summary, err := svc.db.GetAccountSummary(top)
+		if err != nil {
+			return err
+		}
+
+		generated := summary.GeneratedDate
+		summary.GeneratedDate = 0
+		if last != nil && proto.Equal(last, summary) {
+			return nil
+		}
+		last = proto.Clone(summary)
+		summary.GeneratedDate = generated
+
+		return sub.Send(&mt.AccountSummaryStream_Reply{Summary: summary})
+	}
+
+	if err := send(); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sub.Context().Done():
+			return nil
+		case <-svc.ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := send(); err != nil {
+				return err
+			}
+		}
+	}
+}
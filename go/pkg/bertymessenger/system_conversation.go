@@ -0,0 +1,109 @@
+package bertymessenger
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/bertyversion"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+const systemConversationDisplayName = "Berty"
+
+// onboardingTips are added to the system conversation the first time it is
+// created
+var onboardingTips = []*mt.AppMessage_SystemMessage{
+	{
+		Kind:  mt.AppMessage_SystemMessage_KindTip,
+		Title: "Welcome to Berty",
+		Body:  "Your messages are end-to-end encrypted and stay on your devices, no account or phone number is needed.",
+	},
+	{
+		Kind:  mt.AppMessage_SystemMessage_KindTip,
+		Title: "Add a contact",
+		Body:  "Share your link or QR code, your contacts can reach you once they have scanned it.",
+	},
+	{
+		Kind:  mt.AppMessage_SystemMessage_KindTip,
+		Title: "Edit and retract",
+		Body:  "Your messages can be edited or retracted after they are sent, and bookmarked to find them later.",
+	},
+	{
+		Kind:  mt.AppMessage_SystemMessage_KindTip,
+		Title: "Privacy",
+		Body:  "Read receipts and typing indicators can be disabled for the account or for a single conversation.",
+	},
+}
+
+// updateSystemConversation creates the system conversation with the onboarding
+// tips, and adds a changelog to it when the app version changes
+func (svc *service) updateSystemConversation() error {
+	acc, err := svc.db.GetAccount()
+	if err != nil {
+		return errcode.ErrDBRead.Wrap(err)
+	}
+
+	previous, version := acc.GetSystemConversationVersion(), bertyversion.Version
+	if previous == version {
+		return nil
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	isNew, err := svc.db.UpdateConversation(mt.Conversation{
+		PublicKey:   mt.SystemConversationPublicKey,
+		Type:        mt.Conversation_SystemType,
+		DisplayName: systemConversationDisplayName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if isNew {
+		conv, err := svc.db.GetConversationByPK(mt.SystemConversationPublicKey)
+		if err != nil {
+			return errcode.ErrDBRead.Wrap(err)
+		}
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, true); err != nil {
+			svc.logger.Warn("unable to stream system conversation", zap.Error(err))
+		}
+	}
+
+	// the cids are stable so the messages are only added once
+	type systemMessage struct {
+		cid string
+		msg mt.AppMessage_SystemMessage
+	}
+	messages := []systemMessage(nil)
+	if previous == "" {
+		for i, tip := range onboardingTips {
+			messages = append(messages, systemMessage{cid: fmt.Sprintf("system-tip-%d", i), msg: *tip})
+		}
+	} else {
+		messages = append(messages, systemMessage{cid: "system-changelog-" + version, msg: mt.AppMessage_SystemMessage{
+			Kind:  mt.AppMessage_SystemMessage_KindChangelog,
+			Title: "Berty has been updated",
+			Body:  fmt.Sprintf("You are now using version %s, the previous one was %s.", version, previous),
+		}})
+	}
+
+	sentDate := messengerutil.TimestampMs(time.Now())
+	for i, m := range messages {
+		m.msg.Version = version
+		if _, err := svc.eventHandler.HandleSystemMessage(m.cid, sentDate+int64(i), &m.msg); err != nil {
+			return err
+		}
+	}
+
+	if err := svc.db.UpdateAccountFields(map[string]interface{}{"system_conversation_version": version}); err != nil {
+		return errcode.ErrDBWrite.Wrap(err)
+	}
+
+	return nil
+}
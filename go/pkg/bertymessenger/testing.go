@@ -11,7 +11,6 @@ import (
 	"time"
 
 	sqlite "github.com/flyingtime/gorm-sqlcipher"
-	"github.com/golang/protobuf/proto"
 	libp2p_mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -25,6 +24,7 @@ import (
 	"moul.io/zapgorm2"
 	"moul.io/zapring"
 
+	"berty.tech/berty/v2/go/internal/protoutil"
 	"berty.tech/berty/v2/go/internal/testutil"
 	"berty.tech/berty/v2/go/pkg/bertyprotocol"
 	"berty.tech/berty/v2/go/pkg/messengertypes"
@@ -79,6 +79,9 @@ func TestingService(ctx context.Context, t testing.TB, opts *TestingServiceOpts)
 		DB:          db,
 		Ring:        opts.Ring,
 		LogFilePath: opts.LogFilePath,
+
+		// the tests count the conversations
+		DisableSystemConversation: true,
 	})
 	if err != nil {
 		cleanup()
@@ -181,7 +184,7 @@ func Testing1To1ProcessWholeStream(t testing.TB) (context.Context, []*TestingAcc
 
 		if evt.GetEvent().GetType() == messengertypes.StreamEvent_TypeNotified {
 			var notif messengertypes.StreamEvent_Notified
-			err := proto.Unmarshal(evt.GetEvent().Payload, &notif)
+			err := protoutil.Unmarshal(evt.GetEvent().Payload, &notif)
 			require.NoError(t, err)
 
 			if notif.GetType() == messengertypes.StreamEvent_Notified_TypeContactRequestReceived {
@@ -0,0 +1,21 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) ConversationThreadList(ctx context.Context, req *mt.ConversationThreadList_Request) (*mt.ConversationThreadList_Reply, error) {
+	if req.GetCID() == "" {
+		return nil, errcode.ErrMissingInput
+	}
+
+	rootCID, root, replies, err := svc.db.GetThread(req.GetCID())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.ConversationThreadList_Reply{RootCID: rootCID, Root: root, Replies: replies}, nil
+}
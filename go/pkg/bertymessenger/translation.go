@@ -0,0 +1,186 @@
+package bertymessenger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	"berty.tech/berty/v2/go/internal/messengerutil"
+	"berty.tech/berty/v2/go/pkg/errcode"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+	"berty.tech/berty/v2/go/pkg/tyber"
+)
+
+// Translator is a translation provider, it is only called when a translation
+// is requested or for the incoming messages of conversations having automatic
+// translation enabled, so no message leaves the device unless one is set.
+type Translator interface {
+	// Name identifies the provider, it is stored with its translations.
+	Name() string
+
+	// Translate returns text translated to language.
+	Translate(ctx context.Context, text string, language string) (string, error)
+}
+
+const autoTranslationTimeout = 30 * time.Second
+
+func (svc *service) ConversationSetAutoTranslate(ctx context.Context, req *mt.ConversationSetAutoTranslate_Request) (*mt.ConversationSetAutoTranslate_Reply, error) {
+	if svc.translator == nil && req.GetLanguage() != "" {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no translation provider configured"))
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	if err := svc.db.SetConversationAutoTranslateLanguage(req.GetConversationPublicKey(), req.GetLanguage()); err != nil {
+		return nil, err
+	}
+
+	conversation, err := svc.db.GetConversationByPK(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	return &mt.ConversationSetAutoTranslate_Reply{}, nil
+}
+
+func (svc *service) TranslateInteraction(ctx context.Context, req *mt.TranslateInteraction_Request) (_ *mt.TranslateInteraction_Reply, err error) {
+	ctx, _, endSection := tyber.Section(ctx, svc.logger, "Translating interaction")
+	defer func() { endSection(err, "") }()
+
+	if svc.translator == nil {
+		return nil, errcode.ErrNotImplemented.Wrap(fmt.Errorf("no translation provider configured"))
+	}
+
+	if req.GetLanguage() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a language is required"))
+	}
+
+	if translation, err := svc.db.GetInteractionTranslation(req.GetCID(), req.GetLanguage()); err == nil {
+		return &mt.TranslateInteraction_Reply{Translation: translation}, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	i, err := svc.db.GetInteractionByCID(req.GetCID())
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errcode.ErrNotFound.Wrap(fmt.Errorf("unknown interaction: %s", req.GetCID()))
+	} else if err != nil {
+		return nil, errcode.ErrDBRead.Wrap(err)
+	}
+
+	translation, err := svc.translateInteraction(ctx, i, req.GetLanguage())
+	if err != nil {
+		return nil, err
+	}
+
+	return &mt.TranslateInteraction_Reply{Translation: translation}, nil
+}
+
+// autoTranslateInteraction translates an incoming message for a conversation
+// having automatic translation enabled, it is called while the message is
+// being handled so the translation is only stored once the handler is done
+func (svc *service) autoTranslateInteraction(i *mt.Interaction, language string) {
+	if isWrittenIn(i, language) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(svc.ctx, autoTranslationTimeout)
+	defer cancel()
+
+	if _, err := svc.translateInteraction(ctx, i, language); err != nil {
+		svc.logger.Warn("unable to translate interaction", logutil.PrivateString("cid", i.GetCID()), zap.String("language", language), zap.Error(err))
+	}
+}
+
+// isWrittenIn returns true if a user message is already written in language,
+// the language hint of its conversation is used when the message is too short
+// to tell
+func isWrittenIn(i *mt.Interaction, language string) bool {
+	if i.GetType() != mt.AppMessage_TypeUserMessage {
+		return false
+	}
+
+	payload, err := i.UnmarshalPayload()
+	if err != nil {
+		return false
+	}
+
+	written := messengerutil.InferLanguage(payload.(*mt.AppMessage_UserMessage).GetBody())
+	if written == "" {
+		written = i.GetConversation().GetLanguageHint()
+	}
+
+	return messengerutil.SameLanguage(written, language)
+}
+
+func (svc *service) ConversationSetLanguageHint(ctx context.Context, req *mt.ConversationSetLanguageHint_Request) (*mt.ConversationSetLanguageHint_Reply, error) {
+	if req.GetConversationPublicKey() == "" {
+		return nil, errcode.ErrMissingInput.Wrap(fmt.Errorf("a conversation public key is required"))
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	conversation, err := svc.db.SetConversationLanguageHint(req.GetConversationPublicKey(), req.GetLanguage())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conversation}, false); err != nil {
+		return nil, errcode.ErrMessengerStreamEvent.Wrap(err)
+	}
+
+	return &mt.ConversationSetLanguageHint_Reply{Conversation: conversation}, nil
+}
+
+func (svc *service) translateInteraction(ctx context.Context, i *mt.Interaction, language string) (*mt.InteractionTranslation, error) {
+	if i.GetType() != mt.AppMessage_TypeUserMessage {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("only user messages can be translated"))
+	}
+
+	payload, err := i.UnmarshalPayload()
+	if err != nil {
+		return nil, errcode.ErrDeserialization.Wrap(err)
+	}
+
+	text := payload.(*mt.AppMessage_UserMessage).GetBody()
+	if text == "" {
+		return nil, errcode.ErrInvalidInput.Wrap(fmt.Errorf("nothing to translate"))
+	}
+
+	body, err := svc.translator.Translate(ctx, text, language)
+	if err != nil {
+		return nil, errcode.ErrInternal.Wrap(fmt.Errorf("translation failed: %w", err))
+	}
+
+	translation := &mt.InteractionTranslation{
+		InteractionCID: i.GetCID(),
+		Language:       language,
+		Body:           body,
+		Provider:       svc.translator.Name(),
+		TranslatedDate: messengerutil.TimestampMs(time.Now()),
+	}
+
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	if err := svc.db.SaveInteractionTranslation(translation); err != nil {
+		return nil, err
+	}
+
+	if err := messengerutil.StreamInteraction(svc.dispatcher, svc.db, i.GetCID(), false); err != nil {
+		return nil, err
+	}
+
+	return translation, nil
+}
@@ -0,0 +1,31 @@
+package bertymessenger
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"berty.tech/berty/v2/go/internal/logutil"
+	mt "berty.tech/berty/v2/go/pkg/messengertypes"
+)
+
+func (svc *service) RecomputeUnreadCounts(ctx context.Context, req *mt.RecomputeUnreadCounts_Request) (*mt.RecomputeUnreadCounts_Reply, error) {
+	// prevent counters from being incremented by the event handler meanwhile
+	svc.handlerMutex.Lock()
+	defer svc.handlerMutex.Unlock()
+
+	conversations, err := svc.db.RecomputeUnreadCounts(req.GetConversationPublicKey())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, conv := range conversations {
+		svc.logger.Info("repaired unread count", logutil.PrivateString("conversation-pk", conv.GetPublicKey()), zap.Int32("unread", conv.GetUnreadCount()))
+
+		if err := svc.dispatcher.StreamEvent(mt.StreamEvent_TypeConversationUpdated, &mt.StreamEvent_ConversationUpdated{Conversation: conv}, false); err != nil {
+			svc.logger.Warn("unable to stream conversation update", zap.Error(err))
+		}
+	}
+
+	return &mt.RecomputeUnreadCounts_Reply{Conversations: conversations}, nil
+}
@@ -2,6 +2,7 @@ package bertypush
 
 import (
 	"context"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -63,12 +64,21 @@ func (m *messengerPushReceiver) PushReceive(ctx context.Context, input []byte) (
 		conversationMuted = true
 	}
 
+	// the mentions of the account are shown even in the muted conversations
+	if i.IsMentioning(i.GetConversation().GetAccountMemberPublicKey()) {
+		conversationMuted = false
+	}
+
 	hidePreview := true
 	account, err := m.db.GetAccount()
 	if err == nil && !account.HidePushPreviews {
 		hidePreview = false
 	}
 
+	if err == nil && account.NotificationsSnoozed(time.Now()) {
+		accountMuted = true
+	}
+
 	return &messengertypes.PushReceive_Reply{
 		Data: &messengertypes.PushReceivedData{
 			ProtocolData:      clear,
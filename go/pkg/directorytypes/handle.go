@@ -0,0 +1,47 @@
+package directorytypes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// HandleIdentifierPrefix is prepended to the handles to build their directory
+// identifier, it can't collide with the subjects of verified credentials
+const HandleIdentifierPrefix = "@"
+
+var handleRegexp = regexp.MustCompile(`^[a-z0-9_]{3,32}$`)
+
+// NormalizeHandle returns the canonical form of a handle, it is case
+// insensitive and can be prefixed by an "@"
+func NormalizeHandle(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(handle), HandleIdentifierPrefix))
+
+	if !handleRegexp.MatchString(handle) {
+		return "", errcode.ErrServicesDirectoryInvalidHandle.Wrap(fmt.Errorf("a handle must be 3 to 32 letters, digits or underscores"))
+	}
+
+	return handle, nil
+}
+
+// HandleIdentifier returns the directory identifier of a handle
+func HandleIdentifier(handle string) (string, error) {
+	handle, err := NormalizeHandle(handle)
+	if err != nil {
+		return "", err
+	}
+
+	return HandleIdentifierPrefix + handle, nil
+}
+
+// HandleFromIdentifier returns the handle of a directory identifier, or an
+// empty string if the identifier isn't a handle
+func HandleFromIdentifier(identifier string) string {
+	if !strings.HasPrefix(identifier, HandleIdentifierPrefix) {
+		return ""
+	}
+
+	return strings.TrimPrefix(identifier, HandleIdentifierPrefix)
+}
@@ -1,11 +1,13 @@
 package errcode
 
-import proto "github.com/golang/protobuf/proto" // nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+import (
+	"berty.tech/berty/v2/go/internal/protoutil"
+)
 
 // nolint:gochecknoinits // cannot avoid using this init func
-// nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
 func init() {
-	// the goal of this file is to register types on non-gogo proto (required by status.Details)
-	proto.RegisterEnum("berty.errcode.ErrCode", ErrCode_name, ErrCode_value) // nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
-	proto.RegisterType((*ErrDetails)(nil), "berty.errcode.ErrDetails")       // nolint:staticcheck // cannot use the new protobuf API while keeping gogoproto
+	// the goal of this file is to register types on non-gogo proto (required by status.Details),
+	// a conflicting registration is left as is, the details are then decoded as unknown
+	_ = protoutil.RegisterEnum(ErrCode(0))
+	_ = protoutil.RegisterType((*ErrDetails)(nil), "berty.errcode.ErrDetails")
 }
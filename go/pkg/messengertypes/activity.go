@@ -0,0 +1,27 @@
+package messengertypes
+
+import (
+	"time"
+)
+
+// ActivityTimeout is the delay after which an activity that hasn't been
+// renewed is considered stopped, clients should renew their activities more
+// often than that
+const ActivityTimeout = 10 * time.Second
+
+// SanitizeActivityKinds drops the unknown and duplicated kinds of an activity
+func SanitizeActivityKinds(kinds []AppMessage_ActivityKind) []AppMessage_ActivityKind {
+	sanitized := []AppMessage_ActivityKind(nil)
+	seen := make(map[AppMessage_ActivityKind]bool, len(kinds))
+
+	for _, kind := range kinds {
+		if _, ok := AppMessage_ActivityKind_name[int32(kind)]; !ok || kind == AppMessage_ActivityUndefined || seen[kind] {
+			continue
+		}
+
+		seen[kind] = true
+		sanitized = append(sanitized, kind)
+	}
+
+	return sanitized
+}
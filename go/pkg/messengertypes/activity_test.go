@@ -0,0 +1,16 @@
+package messengertypes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizeActivityKinds(t *testing.T) {
+	require.Empty(t, SanitizeActivityKinds(nil))
+	require.Empty(t, SanitizeActivityKinds([]AppMessage_ActivityKind{AppMessage_ActivityUndefined, AppMessage_ActivityKind(42)}))
+	require.Equal(t,
+		[]AppMessage_ActivityKind{AppMessage_ActivityRecordingAudio, AppMessage_ActivityTyping},
+		SanitizeActivityKinds([]AppMessage_ActivityKind{AppMessage_ActivityRecordingAudio, AppMessage_ActivityTyping, AppMessage_ActivityRecordingAudio}),
+	)
+}
@@ -0,0 +1,80 @@
+package messengertypes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// calendarEventTextMaxLength bounds the length of the title and of the location
+	calendarEventTextMaxLength = 256
+
+	calendarEventDescriptionMaxLength = 1024
+)
+
+func (m *AppMessage_CalendarEvent) Validate() error {
+	if strings.TrimSpace(m.GetTitle()) == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing calendar event title"))
+	}
+
+	if len(m.GetTitle()) > calendarEventTextMaxLength || len(m.GetLocation()) > calendarEventTextMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("calendar event title or location is too long"))
+	}
+
+	if len(m.GetDescription()) > calendarEventDescriptionMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("calendar event description is too long"))
+	}
+
+	if m.GetStartDate() <= 0 {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing calendar event start date"))
+	}
+
+	if m.GetEndDate() != 0 && m.GetEndDate() < m.GetStartDate() {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("calendar event ends before it starts"))
+	}
+
+	return nil
+}
+
+func (m *AppMessage_CalendarEventRSVP) Validate() error {
+	if _, ok := AppMessage_CalendarEventRSVP_Response_name[int32(m.GetResponse())]; !ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown calendar event response: %d", m.GetResponse()))
+	}
+
+	return nil
+}
+
+// Attendance aggregates the responses to the event, the withdrawn and the
+// unknown responses are ignored
+func (m *AppMessage_CalendarEvent) Attendance(rsvps []*CalendarEventRSVP) *CalendarEventAttendance {
+	attendance := &CalendarEventAttendance{}
+
+	sorted := append([]*CalendarEventRSVP(nil), rsvps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetMemberPublicKey() < sorted[j].GetMemberPublicKey() })
+
+	for _, r := range sorted {
+		switch r.GetResponse() {
+		case AppMessage_CalendarEventRSVP_ResponseGoing:
+			attendance.Going = append(attendance.Going, r.GetMemberPublicKey())
+		case AppMessage_CalendarEventRSVP_ResponseMaybe:
+			attendance.Maybe = append(attendance.Maybe, r.GetMemberPublicKey())
+		case AppMessage_CalendarEventRSVP_ResponseNotGoing:
+			attendance.NotGoing = append(attendance.NotGoing, r.GetMemberPublicKey())
+		default:
+			continue
+		}
+
+		if r.GetIsMine() {
+			attendance.OwnResponse = r.GetResponse()
+		}
+	}
+
+	return attendance
+}
+
+func (m *AppMessage_CalendarEvent) TextRepresentation() (string, error) {
+	return strings.TrimSpace(m.GetTitle() + " " + m.GetLocation()), nil
+}
@@ -0,0 +1,40 @@
+package messengertypes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCalendarEventValidate(t *testing.T) {
+	require.NoError(t, (&AppMessage_CalendarEvent{Title: "picnic", StartDate: 1000}).Validate())
+	require.NoError(t, (&AppMessage_CalendarEvent{Title: "picnic", StartDate: 1000, EndDate: 2000, Location: "park"}).Validate())
+	require.Error(t, (&AppMessage_CalendarEvent{Title: " ", StartDate: 1000}).Validate())
+	require.Error(t, (&AppMessage_CalendarEvent{Title: "picnic"}).Validate())
+	require.Error(t, (&AppMessage_CalendarEvent{Title: "picnic", StartDate: 2000, EndDate: 1000}).Validate())
+
+	require.NoError(t, (&AppMessage_CalendarEventRSVP{Response: AppMessage_CalendarEventRSVP_ResponseMaybe}).Validate())
+	require.Error(t, (&AppMessage_CalendarEventRSVP{Response: 42}).Validate())
+}
+
+func TestCalendarEventAttendance(t *testing.T) {
+	rsvp := func(memberPK string, isMine bool, response AppMessage_CalendarEventRSVP_Response) *CalendarEventRSVP {
+		return &CalendarEventRSVP{EventCID: "event", MemberPublicKey: memberPK, IsMine: isMine, Response: response}
+	}
+
+	event := &AppMessage_CalendarEvent{Title: "picnic", StartDate: 1000}
+	attendance := event.Attendance([]*CalendarEventRSVP{
+		rsvp("member_b", false, AppMessage_CalendarEventRSVP_ResponseGoing),
+		rsvp("member_a", true, AppMessage_CalendarEventRSVP_ResponseGoing),
+		rsvp("member_c", false, AppMessage_CalendarEventRSVP_ResponseNotGoing),
+		rsvp("member_d", false, AppMessage_CalendarEventRSVP_ResponseMaybe),
+		// withdrawn and unknown responses
+		rsvp("member_e", false, AppMessage_CalendarEventRSVP_ResponseNone),
+		rsvp("member_f", false, 42),
+	})
+
+	require.Equal(t, []string{"member_a", "member_b"}, attendance.Going)
+	require.Equal(t, []string{"member_d"}, attendance.Maybe)
+	require.Equal(t, []string{"member_c"}, attendance.NotGoing)
+	require.Equal(t, AppMessage_CalendarEventRSVP_ResponseGoing, attendance.OwnResponse)
+}
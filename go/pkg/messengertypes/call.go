@@ -0,0 +1,188 @@
+package messengertypes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// CallSignalingTTL is the delay after which a call signaling message is
+	// considered stale and dropped
+	CallSignalingTTL = 30 * time.Second
+
+	// callIDMaxLength and callSDPMaxLength bound the size of the signaling
+	// payloads, an SDP is usually a few kilobytes
+	callIDMaxLength  = 64
+	callSDPMaxLength = 64 * 1024
+)
+
+// CallSignalingPayload is implemented by the payloads of the call signaling
+// app messages
+type CallSignalingPayload interface {
+	proto.Message
+	GetCallID() string
+	Validate() error
+}
+
+// IsCallSignaling returns whether the app message type is used for call signaling
+func (x AppMessage_Type) IsCallSignaling() bool {
+	switch x {
+	case AppMessage_TypeCallOffer, AppMessage_TypeCallAnswer, AppMessage_TypeCallICECandidate, AppMessage_TypeCallHangUp:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateCallID(callID string) error {
+	if callID == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing call id"))
+	}
+
+	if len(callID) > callIDMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("call id is too long"))
+	}
+
+	return nil
+}
+
+func validateCallSDP(sdp string) error {
+	if sdp == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing session description"))
+	}
+
+	if len(sdp) > callSDPMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("session description is too long"))
+	}
+
+	return nil
+}
+
+func (m *AppMessage_CallOffer) Validate() error {
+	if err := validateCallID(m.GetCallID()); err != nil {
+		return err
+	}
+
+	return validateCallSDP(m.GetSDP())
+}
+
+func (m *AppMessage_CallAnswer) Validate() error {
+	if err := validateCallID(m.GetCallID()); err != nil {
+		return err
+	}
+
+	return validateCallSDP(m.GetSDP())
+}
+
+func (m *AppMessage_CallICECandidate) Validate() error {
+	if err := validateCallID(m.GetCallID()); err != nil {
+		return err
+	}
+
+	// an empty candidate signals the end of the candidates
+	if len(m.GetCandidate()) > callSDPMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("candidate is too long"))
+	}
+
+	return nil
+}
+
+func (m *AppMessage_CallHangUp) Validate() error {
+	if err := validateCallID(m.GetCallID()); err != nil {
+		return err
+	}
+
+	if _, ok := AppMessage_CallHangUpReason_name[int32(m.GetReason())]; !ok {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown hang up reason: %d", m.GetReason()))
+	}
+
+	return nil
+}
+
+// NewCallLog starts the log of a call from its offer
+func NewCallLog(offer *AppMessage_CallOffer, callerPK string, date int64) *AppMessage_CallLog {
+	return &AppMessage_CallLog{
+		CallID:                      offer.GetCallID(),
+		State:                       AppMessage_CallStateRinging,
+		Video:                       offer.GetVideo(),
+		CallerMemberPublicKey:       callerPK,
+		ParticipantMemberPublicKeys: []string{callerPK},
+		StartedDate:                 date,
+	}
+}
+
+// IsOver returns whether the call is not ringing nor ongoing anymore
+func (l *AppMessage_CallLog) IsOver() bool {
+	return l.GetState() != AppMessage_CallStateRinging && l.GetState() != AppMessage_CallStateOngoing
+}
+
+// Duration returns how long the call lasted once answered, it is zero for
+// calls that haven't ended or were never answered
+func (l *AppMessage_CallLog) Duration() time.Duration {
+	if l.GetAnsweredDate() == 0 || l.GetEndedDate() < l.GetAnsweredDate() {
+		return 0
+	}
+
+	return time.Duration(l.GetEndedDate()-l.GetAnsweredDate()) * time.Millisecond
+}
+
+// ApplyAnswer records a member answering the call, it returns whether the log
+// changed
+func (l *AppMessage_CallLog) ApplyAnswer(memberPK string, date int64) bool {
+	if l.IsOver() {
+		return false
+	}
+
+	changed := false
+	if l.GetState() == AppMessage_CallStateRinging {
+		l.State = AppMessage_CallStateOngoing
+		l.AnsweredDate = date
+		changed = true
+	}
+
+	for _, pk := range l.GetParticipantMemberPublicKeys() {
+		if pk == memberPK {
+			return changed
+		}
+	}
+
+	l.ParticipantMemberPublicKeys = append(l.ParticipantMemberPublicKeys, memberPK)
+	return true
+}
+
+// ApplyHangUp records the end of the call, it returns whether the log changed
+func (l *AppMessage_CallLog) ApplyHangUp(memberPK string, reason AppMessage_CallHangUpReason, date int64) bool {
+	if l.IsOver() {
+		return false
+	}
+
+	switch {
+	case l.GetState() == AppMessage_CallStateOngoing:
+		l.State = AppMessage_CallStateEnded
+	case reason == AppMessage_CallHangUpFailed:
+		l.State = AppMessage_CallStateFailed
+	case reason == AppMessage_CallHangUpDeclined, reason == AppMessage_CallHangUpBusy, memberPK != l.GetCallerMemberPublicKey():
+		l.State = AppMessage_CallStateDeclined
+	default:
+		// the caller gave up before anyone answered
+		l.State = AppMessage_CallStateMissed
+	}
+
+	l.EndedDate = date
+	return true
+}
+
+// RepeatedCallWindow is the delay during which a second call from the same
+// conversation is notified even if the conversation is muted or during quiet
+// hours
+const RepeatedCallWindow = 3 * time.Minute
+
+// IsHighPriority returns whether the notification should be shown
+// immediately, even when the app is in background
+func (x StreamEvent_Notified_Type) IsHighPriority() bool {
+	return x == StreamEvent_Notified_TypeIncomingCall
+}
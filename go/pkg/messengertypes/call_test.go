@@ -0,0 +1,49 @@
+package messengertypes
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallSignalingPayload_Validate(t *testing.T) {
+	require.NoError(t, (&AppMessage_CallOffer{CallID: "call", SDP: "v=0"}).Validate())
+	require.Error(t, (&AppMessage_CallOffer{SDP: "v=0"}).Validate())
+	require.Error(t, (&AppMessage_CallAnswer{CallID: "call"}).Validate())
+	require.Error(t, (&AppMessage_CallAnswer{CallID: strings.Repeat("a", callIDMaxLength+1), SDP: "v=0"}).Validate())
+	require.NoError(t, (&AppMessage_CallICECandidate{CallID: "call"}).Validate())
+	require.NoError(t, (&AppMessage_CallHangUp{CallID: "call", Reason: AppMessage_CallHangUpDeclined}).Validate())
+	require.Error(t, (&AppMessage_CallHangUp{CallID: "call", Reason: AppMessage_CallHangUpReason(42)}).Validate())
+
+	require.True(t, AppMessage_TypeCallICECandidate.IsCallSignaling())
+	require.False(t, AppMessage_TypeUserMessage.IsCallSignaling())
+}
+
+func TestAppMessage_CallLog(t *testing.T) {
+	offer := &AppMessage_CallOffer{CallID: "call", SDP: "v=0", Video: true}
+
+	// answered then ended
+	l := NewCallLog(offer, "caller", 1000)
+	require.Equal(t, AppMessage_CallStateRinging, l.State)
+	require.True(t, l.ApplyAnswer("callee", 2000))
+	require.False(t, l.ApplyAnswer("callee", 2500))
+	require.Equal(t, []string{"caller", "callee"}, l.ParticipantMemberPublicKeys)
+	require.True(t, l.ApplyHangUp("callee", AppMessage_CallHangUpNormal, 62000))
+	require.Equal(t, AppMessage_CallStateEnded, l.State)
+	require.Equal(t, time.Minute, l.Duration())
+	require.False(t, l.ApplyHangUp("caller", AppMessage_CallHangUpNormal, 63000))
+
+	// the caller gave up
+	l = NewCallLog(offer, "caller", 1000)
+	require.True(t, l.ApplyHangUp("caller", AppMessage_CallHangUpNormal, 5000))
+	require.Equal(t, AppMessage_CallStateMissed, l.State)
+	require.Zero(t, l.Duration())
+	require.False(t, l.ApplyAnswer("callee", 6000))
+
+	// the callee declined
+	l = NewCallLog(offer, "caller", 1000)
+	require.True(t, l.ApplyHangUp("callee", AppMessage_CallHangUpBusy, 5000))
+	require.Equal(t, AppMessage_CallStateDeclined, l.State)
+}
@@ -0,0 +1,96 @@
+package messengertypes
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// AppMessageCustomTypeMin is the first of the AppMessage types left to the
+// embedders, the upstream types never use this range
+const AppMessageCustomTypeMin AppMessage_Type = 10000
+
+// AppMessageCustomNamespaceSize is the number of types of each namespace of
+// the custom range. Third parties pick a namespace of their own so their types
+// don't collide with the ones of the other embedders.
+const AppMessageCustomNamespaceSize = 1000
+
+// IsCustom returns true for the types registered by the embedders
+func (x AppMessage_Type) IsCustom() bool {
+	return x >= AppMessageCustomTypeMin
+}
+
+// CustomNamespace returns the namespace of a custom type, it is -1 for the
+// upstream types
+func (x AppMessage_Type) CustomNamespace() int32 {
+	if !x.IsCustom() {
+		return -1
+	}
+
+	return int32(x-AppMessageCustomTypeMin) / AppMessageCustomNamespaceSize
+}
+
+// NewCustomAppMessageType returns the index-th custom type of namespace
+func NewCustomAppMessageType(namespace int32, index int32) (AppMessage_Type, error) {
+	const maxNamespace = (math.MaxInt32 - int32(AppMessageCustomTypeMin)) / AppMessageCustomNamespaceSize
+
+	if namespace < 0 || namespace >= maxNamespace {
+		return 0, errcode.ErrInvalidInput.Wrap(fmt.Errorf("custom AppMessage namespaces range from 0 to %d, got %d", maxNamespace-1, namespace))
+	}
+
+	if index < 0 || index >= AppMessageCustomNamespaceSize {
+		return 0, errcode.ErrInvalidInput.Wrap(fmt.Errorf("custom AppMessage namespaces hold %d types, got index %d", AppMessageCustomNamespaceSize, index))
+	}
+
+	return AppMessageCustomTypeMin + AppMessage_Type(namespace*AppMessageCustomNamespaceSize+index), nil
+}
+
+// CustomPayload is the payload of the custom AppMessage types, it is kept as
+// is since only the embedder registering the type knows its encoding
+type CustomPayload struct {
+	Data []byte `json:"data,omitempty"`
+}
+
+func (m *CustomPayload) Reset()         { *m = CustomPayload{} }
+func (m *CustomPayload) String() string { return fmt.Sprintf("CustomPayload(%d bytes)", len(m.Data)) }
+func (*CustomPayload) ProtoMessage()    {}
+
+func (m *CustomPayload) Marshal() ([]byte, error) {
+	return m.Data, nil
+}
+
+func (m *CustomPayload) Unmarshal(data []byte) error {
+	m.Data = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *CustomPayload) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+// CustomAppMessageHandler handles the app messages of a custom type
+type CustomAppMessageHandler interface {
+	// HandleAppMessage is called with every app message of the type, the
+	// ones sent by the account included, within the transaction storing them.
+	// The payload can be persisted by the handler itself, the interaction is
+	// stored in the conversation if it returns true. The same message may be
+	// handled again when the database is replayed, the handler must be
+	// idempotent.
+	HandleAppMessage(ctx context.Context, i *Interaction, payload []byte) (bool, error)
+}
+
+// AppMessageHandlerRegistration is a handler registered for a custom
+// AppMessage type
+type AppMessageHandlerRegistration struct {
+	Type    AppMessage_Type
+	Handler CustomAppMessageHandler
+
+	// Visible makes the stored interactions notify and count as unread like
+	// the user messages
+	Visible bool
+}
@@ -0,0 +1,19 @@
+package messengertypes
+
+import (
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// EphemeralMessageMaxTTL is the longest disappearing messages policy
+const EphemeralMessageMaxTTL = 365 * 24 * time.Hour
+
+func (m *AppMessage_SetEphemeralPolicy) Validate() error {
+	if m.GetMessageTTL() < 0 || m.GetMessageTTL() > int64(EphemeralMessageMaxTTL/time.Second) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the message ttl must be between 0 and %d seconds", int64(EphemeralMessageMaxTTL/time.Second)))
+	}
+
+	return nil
+}
@@ -0,0 +1,15 @@
+package messengertypes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetEphemeralPolicyValidate(t *testing.T) {
+	require.NoError(t, (&AppMessage_SetEphemeralPolicy{}).Validate())
+	require.NoError(t, (&AppMessage_SetEphemeralPolicy{MessageTTL: 3600}).Validate())
+	require.Error(t, (&AppMessage_SetEphemeralPolicy{MessageTTL: -1}).Validate())
+	require.Error(t, (&AppMessage_SetEphemeralPolicy{MessageTTL: int64(EphemeralMessageMaxTTL/time.Second) + 1}).Validate())
+}
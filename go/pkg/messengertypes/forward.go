@@ -0,0 +1,58 @@
+package messengertypes
+
+import (
+	"fmt"
+
+	ipfscid "github.com/ipfs/go-cid"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// forwardDisplayNameMaxLength bounds the author name carried by a forward
+const forwardDisplayNameMaxLength = 256
+
+// Validate checks that the origin references a message of a conversation,
+// the origin itself can't be checked as it is usually unknown to the receiver
+func (m *AppMessage_ForwardOrigin) Validate() error {
+	if m.GetConversationPublicKey() == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing origin conversation"))
+	}
+
+	if _, err := ipfscid.Decode(m.GetCID()); err != nil {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid origin cid: %w", err))
+	}
+
+	if len(m.GetAuthorDisplayName()) > forwardDisplayNameMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("origin author name is too long"))
+	}
+
+	if m.GetSentDate() < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid origin sent date"))
+	}
+
+	return nil
+}
+
+// ForwardedFrom returns the origin as stored for the forwarded interaction cid
+func (m *AppMessage_ForwardOrigin) ForwardedFrom(cid string) *ForwardedFrom {
+	return &ForwardedFrom{
+		InteractionCID:              cid,
+		OriginConversationPublicKey: m.GetConversationPublicKey(),
+		OriginCID:                   m.GetCID(),
+		AuthorMemberPublicKey:       m.GetAuthorMemberPublicKey(),
+		AuthorDisplayName:           m.GetAuthorDisplayName(),
+		OriginSentDate:              m.GetSentDate(),
+	}
+}
+
+// ForwardOrigin returns the origin to announce when forwarding again the
+// interaction it is stored for
+func (m *ForwardedFrom) ForwardOrigin() *AppMessage_ForwardOrigin {
+	return &AppMessage_ForwardOrigin{
+		ConversationPublicKey: m.GetOriginConversationPublicKey(),
+		CID:                   m.GetOriginCID(),
+		AuthorMemberPublicKey: m.GetAuthorMemberPublicKey(),
+		AuthorDisplayName:     m.GetAuthorDisplayName(),
+		SentDate:              m.GetOriginSentDate(),
+	}
+}
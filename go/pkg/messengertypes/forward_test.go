@@ -0,0 +1,21 @@
+package messengertypes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardOriginValidate(t *testing.T) {
+	const cid = "bafyreiaxvmx2xxgp2l7jf2ltrytaktwuxhqhjwwdt4h5ix6vy2fz6rheka"
+
+	origin := &AppMessage_ForwardOrigin{ConversationPublicKey: "conv", CID: cid, AuthorDisplayName: "alice", SentDate: 1}
+	require.NoError(t, origin.Validate())
+	require.Equal(t, origin, origin.ForwardedFrom("forward").ForwardOrigin())
+
+	require.Error(t, (&AppMessage_ForwardOrigin{CID: cid}).Validate())
+	require.Error(t, (&AppMessage_ForwardOrigin{ConversationPublicKey: "conv", CID: "not a cid"}).Validate())
+	require.Error(t, (&AppMessage_ForwardOrigin{ConversationPublicKey: "conv", CID: cid, AuthorDisplayName: strings.Repeat("a", 257)}).Validate())
+	require.Error(t, (&AppMessage_ForwardOrigin{ConversationPublicKey: "conv", CID: cid, SentDate: -1}).Validate())
+}
@@ -0,0 +1,38 @@
+package messengertypes
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MaxLinkPreviews is the number of links of a message previewed, the links
+// beyond it are ignored
+const MaxLinkPreviews = 4
+
+var linkRegexp = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// Links returns the web links of a message body, without duplicates, up to
+// MaxLinkPreviews
+func (m *AppMessage_UserMessage) Links() []string {
+	links := []string(nil)
+	seen := map[string]bool{}
+
+	for _, match := range linkRegexp.FindAllString(m.GetBody(), -1) {
+		if len(links) == MaxLinkPreviews {
+			break
+		}
+
+		// the punctuation ending a sentence isn't part of the link
+		link := strings.TrimRight(match, ".,;:!?)]}'")
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" || seen[link] {
+			continue
+		}
+		seen[link] = true
+
+		links = append(links, link)
+	}
+
+	return links
+}
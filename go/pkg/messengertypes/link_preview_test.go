@@ -0,0 +1,21 @@
+package messengertypes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppMessage_UserMessage_Links(t *testing.T) {
+	msg := &AppMessage_UserMessage{Body: "see https://berty.tech/docs, and (http://example.com/a?b=c). again: https://berty.tech/docs ftp://example.com https://"}
+	require.Equal(t, []string{"https://berty.tech/docs", "http://example.com/a?b=c"}, msg.Links())
+
+	require.Empty(t, (&AppMessage_UserMessage{Body: "no link here"}).Links())
+
+	msg = &AppMessage_UserMessage{}
+	for j := 0; j <= MaxLinkPreviews; j++ {
+		msg.Body += fmt.Sprintf(" https://example.com/%d", j)
+	}
+	require.Len(t, msg.Links(), MaxLinkPreviews)
+}
@@ -2,6 +2,7 @@ package messengertypes
 
 import (
 	fmt "fmt"
+	"time"
 
 	"berty.tech/berty/v2/go/pkg/errcode"
 	protocoltypes "berty.tech/berty/v2/go/pkg/protocoltypes"
@@ -67,6 +68,15 @@ func (link *BertyLink) IsGroup() bool {
 		link.IsValid() == nil
 }
 
+// IsExpired returns true if the link has an expiry and it is before now.
+func (link *BertyLink) IsExpired(now time.Time) bool {
+	if link.GetExpiresAt() == 0 {
+		return false
+	}
+
+	return link.GetExpiresAt() <= now.UnixNano()/int64(time.Millisecond)
+}
+
 func (id *BertyID) GetBertyLink() *BertyLink {
 	return &BertyLink{
 		Kind:    BertyLink_ContactInviteV1Kind,
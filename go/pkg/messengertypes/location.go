@@ -0,0 +1,37 @@
+package messengertypes
+
+import (
+	"fmt"
+	"math"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func validateCoordinates(latitude, longitude, accuracy float64) error {
+	if math.IsNaN(latitude) || latitude < -90 || latitude > 90 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid latitude: %v", latitude))
+	}
+
+	if math.IsNaN(longitude) || longitude < -180 || longitude > 180 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid longitude: %v", longitude))
+	}
+
+	if math.IsNaN(accuracy) || math.IsInf(accuracy, 0) || accuracy < 0 {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("invalid accuracy: %v", accuracy))
+	}
+
+	return nil
+}
+
+func (m *AppMessage_Location) Validate() error {
+	return validateCoordinates(m.GetLatitude(), m.GetLongitude(), m.GetAccuracy())
+}
+
+// Validate checks the coordinates of the update, a stop doesn't carry any
+func (m *AppMessage_LiveLocation) Validate() error {
+	if m.GetStopped() {
+		return nil
+	}
+
+	return validateCoordinates(m.GetLatitude(), m.GetLongitude(), m.GetAccuracy())
+}
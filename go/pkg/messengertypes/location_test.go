@@ -0,0 +1,22 @@
+package messengertypes
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocationValidate(t *testing.T) {
+	require.NoError(t, (&AppMessage_Location{Latitude: 48.85, Longitude: 2.35, Accuracy: 10}).Validate())
+	require.NoError(t, (&AppMessage_Location{Latitude: -90, Longitude: 180}).Validate())
+	require.Error(t, (&AppMessage_Location{Latitude: 90.1}).Validate())
+	require.Error(t, (&AppMessage_Location{Longitude: -180.1}).Validate())
+	require.Error(t, (&AppMessage_Location{Latitude: math.NaN()}).Validate())
+	require.Error(t, (&AppMessage_Location{Accuracy: -1}).Validate())
+
+	require.NoError(t, (&AppMessage_LiveLocation{Latitude: 48.85, Longitude: 2.35, ExpiresDate: 1}).Validate())
+	require.Error(t, (&AppMessage_LiveLocation{Latitude: 100}).Validate())
+	// a stop doesn't carry coordinates
+	require.NoError(t, (&AppMessage_LiveLocation{Latitude: 100, Stopped: true}).Validate())
+}
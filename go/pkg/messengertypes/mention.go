@@ -0,0 +1,63 @@
+package messengertypes
+
+import (
+	"fmt"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// MaxMentions is the number of members a message can mention, the mentions
+// beyond it are ignored by the receivers
+const MaxMentions = 64
+
+// ValidateMentions checks that the mentions of a message can be delivered
+func (m *AppMessage_UserMessage) ValidateMentions() error {
+	if len(m.GetMentions()) > MaxMentions {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a message can't mention more than %d members", MaxMentions))
+	}
+
+	for _, pk := range m.GetMentions() {
+		if pk == "" {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("empty mention"))
+		}
+	}
+
+	return nil
+}
+
+// InteractionMentions returns the mentions of the message as stored for the
+// interaction cid, without duplicates
+func (m *AppMessage_UserMessage) InteractionMentions(cid string) []*InteractionMention {
+	mentions := []*InteractionMention(nil)
+	seen := map[string]bool{}
+
+	for _, pk := range m.GetMentions() {
+		if len(mentions) == MaxMentions {
+			break
+		}
+
+		if pk == "" || seen[pk] {
+			continue
+		}
+		seen[pk] = true
+
+		mentions = append(mentions, &InteractionMention{InteractionCID: cid, MemberPublicKey: pk})
+	}
+
+	return mentions
+}
+
+// IsMentioning returns whether the interaction mentions the member
+func (i *Interaction) IsMentioning(memberPK string) bool {
+	if memberPK == "" {
+		return false
+	}
+
+	for _, mention := range i.GetMentions() {
+		if mention.GetMemberPublicKey() == memberPK {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,30 @@
+package messengertypes
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppMessage_UserMessage_Mentions(t *testing.T) {
+	msg := &AppMessage_UserMessage{Mentions: []string{"alice", "bob", "alice", ""}}
+	require.Error(t, msg.ValidateMentions())
+
+	i := &Interaction{Mentions: msg.InteractionMentions("cid")}
+	require.Len(t, i.Mentions, 2)
+	require.Equal(t, "cid", i.Mentions[0].InteractionCID)
+	require.True(t, i.IsMentioning("bob"))
+	require.False(t, i.IsMentioning("carol"))
+	require.False(t, i.IsMentioning(""))
+
+	msg = &AppMessage_UserMessage{}
+	for j := 0; j <= MaxMentions; j++ {
+		msg.Mentions = append(msg.Mentions, fmt.Sprintf("member_%d", j))
+	}
+	require.Error(t, msg.ValidateMentions())
+	require.Len(t, msg.InteractionMentions("cid"), MaxMentions)
+
+	msg.Mentions = msg.Mentions[:2]
+	require.NoError(t, msg.ValidateMentions())
+}
@@ -0,0 +1,23 @@
+package messengertypes
+
+import "strings"
+
+// ThreadKey identifies the stack a notification belongs to, the notifications
+// of a reply thread are stacked apart from the rest of their conversation
+func (g *StreamEvent_Notified_Group) ThreadKey() string {
+	if g.GetThreadCID() == "" {
+		return g.GetConversationPublicKey()
+	}
+
+	return g.GetConversationPublicKey() + "/" + g.GetThreadCID()
+}
+
+// CategoryName is the category of the notification as named by the platforms,
+// e.g. "message", it is empty for an unknown category
+func (g *StreamEvent_Notified_Group) CategoryName() string {
+	if g.GetCategory() == StreamEvent_Notified_Group_CategoryUnknown {
+		return ""
+	}
+
+	return strings.ToLower(strings.TrimPrefix(g.GetCategory().String(), "Category"))
+}
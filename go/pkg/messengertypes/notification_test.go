@@ -0,0 +1,20 @@
+package messengertypes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEvent_Notified_Group(t *testing.T) {
+	group := &StreamEvent_Notified_Group{ConversationPublicKey: "conv_pk", Category: StreamEvent_Notified_Group_CategoryGroupInvitation}
+	require.Equal(t, "conv_pk", group.ThreadKey())
+	require.Equal(t, "groupinvitation", group.CategoryName())
+
+	group.ThreadCID = "root_cid"
+	require.Equal(t, "conv_pk/root_cid", group.ThreadKey())
+
+	var none *StreamEvent_Notified_Group
+	require.Empty(t, none.ThreadKey())
+	require.Empty(t, none.CategoryName())
+}
@@ -0,0 +1,98 @@
+package messengertypes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gogo/protobuf/proto"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const (
+	// PollMaxOptions is the maximum number of options of a poll
+	PollMaxOptions = 12
+
+	// pollTextMaxLength bounds the length of the question and of the options
+	pollTextMaxLength = 256
+)
+
+func (m *AppMessage_Poll) Validate() error {
+	if strings.TrimSpace(m.GetQuestion()) == "" {
+		return errcode.ErrMissingInput.Wrap(fmt.Errorf("missing poll question"))
+	}
+
+	if len(m.GetQuestion()) > pollTextMaxLength {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("poll question is too long"))
+	}
+
+	if len(m.GetOptions()) < 2 || len(m.GetOptions()) > PollMaxOptions {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("a poll requires between 2 and %d options", PollMaxOptions))
+	}
+
+	for _, option := range m.GetOptions() {
+		if strings.TrimSpace(option) == "" || len(option) > pollTextMaxLength {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("poll options can't be empty or too long"))
+		}
+	}
+
+	return nil
+}
+
+// ValidateVote checks that a vote only chooses existing options, once each,
+// and a single one unless the poll is multiple choice
+func (m *AppMessage_Poll) ValidateVote(vote *AppMessage_PollVote) error {
+	if len(vote.GetOptions()) > 1 && !m.GetMultipleChoice() {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the poll only allows a single choice"))
+	}
+
+	seen := make(map[int32]bool, len(vote.GetOptions()))
+	for _, option := range vote.GetOptions() {
+		if option < 0 || int(option) >= len(m.GetOptions()) {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("unknown poll option: %d", option))
+		}
+
+		if seen[option] {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("duplicate poll option: %d", option))
+		}
+		seen[option] = true
+	}
+
+	return nil
+}
+
+// Results aggregates the votes of the poll, the invalid and the withdrawn
+// votes are ignored
+func (m *AppMessage_Poll) Results(votes []*PollVote) *PollResults {
+	results := &PollResults{Options: make([]*PollResults_Option, len(m.GetOptions()))}
+	for i := range results.Options {
+		results.Options[i] = &PollResults_Option{}
+	}
+
+	sorted := append([]*PollVote(nil), votes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].GetMemberPublicKey() < sorted[j].GetMemberPublicKey() })
+
+	for _, v := range sorted {
+		var vote AppMessage_PollVote
+		if err := proto.Unmarshal(v.GetPayload(), &vote); err != nil || len(vote.GetOptions()) == 0 || m.ValidateVote(&vote) != nil {
+			continue
+		}
+
+		results.Voters++
+		for _, option := range vote.GetOptions() {
+			results.Options[option].Count++
+			results.Options[option].MemberPublicKeys = append(results.Options[option].MemberPublicKeys, v.GetMemberPublicKey())
+		}
+
+		if v.GetIsMine() {
+			results.OwnOptions = vote.GetOptions()
+		}
+	}
+
+	return results
+}
+
+func (m *AppMessage_Poll) TextRepresentation() (string, error) {
+	return m.GetQuestion(), nil
+}
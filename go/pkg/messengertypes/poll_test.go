@@ -0,0 +1,51 @@
+package messengertypes
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPollValidate(t *testing.T) {
+	require.NoError(t, (&AppMessage_Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}}).Validate())
+	require.Error(t, (&AppMessage_Poll{Question: " ", Options: []string{"pizza", "sushi"}}).Validate())
+	require.Error(t, (&AppMessage_Poll{Question: "lunch?", Options: []string{"pizza"}}).Validate())
+	require.Error(t, (&AppMessage_Poll{Question: "lunch?", Options: []string{"pizza", ""}}).Validate())
+	require.Error(t, (&AppMessage_Poll{Question: "lunch?", Options: make([]string, PollMaxOptions+1)}).Validate())
+
+	single := &AppMessage_Poll{Question: "lunch?", Options: []string{"pizza", "sushi", "salad"}}
+	require.NoError(t, single.ValidateVote(&AppMessage_PollVote{Options: []int32{2}}))
+	require.NoError(t, single.ValidateVote(&AppMessage_PollVote{}))
+	require.Error(t, single.ValidateVote(&AppMessage_PollVote{Options: []int32{0, 1}}))
+	require.Error(t, single.ValidateVote(&AppMessage_PollVote{Options: []int32{3}}))
+	require.Error(t, single.ValidateVote(&AppMessage_PollVote{Options: []int32{-1}}))
+
+	multiple := &AppMessage_Poll{Question: "lunch?", Options: []string{"pizza", "sushi", "salad"}, MultipleChoice: true}
+	require.NoError(t, multiple.ValidateVote(&AppMessage_PollVote{Options: []int32{0, 1}}))
+	require.Error(t, multiple.ValidateVote(&AppMessage_PollVote{Options: []int32{1, 1}}))
+}
+
+func TestPollResults(t *testing.T) {
+	vote := func(memberPK string, isMine bool, options ...int32) *PollVote {
+		payload, err := proto.Marshal(&AppMessage_PollVote{Options: options})
+		require.NoError(t, err)
+		return &PollVote{PollCID: "poll", MemberPublicKey: memberPK, IsMine: isMine, Payload: payload}
+	}
+
+	poll := &AppMessage_Poll{Question: "lunch?", Options: []string{"pizza", "sushi"}}
+	results := poll.Results([]*PollVote{
+		vote("member_b", false, 0),
+		vote("member_a", true, 0),
+		vote("member_c", false, 1),
+		// withdrawn and invalid votes
+		vote("member_d", false),
+		vote("member_e", false, 0, 1),
+	})
+
+	require.Equal(t, int32(3), results.Voters)
+	require.Equal(t, []int32{0}, results.OwnOptions)
+	require.Equal(t, int32(2), results.Options[0].Count)
+	require.Equal(t, []string{"member_a", "member_b"}, results.Options[0].MemberPublicKeys)
+	require.Equal(t, []string{"member_c"}, results.Options[1].MemberPublicKeys)
+}
@@ -0,0 +1,46 @@
+package messengertypes
+
+import (
+	"time"
+)
+
+const (
+	// PresenceBeaconInterval is the delay between two presence beacons of an
+	// online account
+	PresenceBeaconInterval = 5 * time.Minute
+
+	// PresenceOnlineThreshold is the delay after which an account that sent no
+	// presence beacon is considered offline
+	PresenceOnlineThreshold = 2 * PresenceBeaconInterval
+)
+
+// SharesPresenceIn returns whether the presence is shared with, and kept for,
+// the members of a conversation of the given type
+func (x Account_PresenceVisibility) SharesPresenceIn(convType Conversation_Type) bool {
+	switch x {
+	case Account_PresenceVisibilityEveryone:
+		return convType == Conversation_ContactType || convType == Conversation_MultiMemberType
+	case Account_PresenceVisibilityContacts:
+		return convType == Conversation_ContactType
+	default:
+		return false
+	}
+}
+
+func isOnline(lastSeen int64, now time.Time) bool {
+	if lastSeen == 0 {
+		return false
+	}
+
+	return now.Sub(time.Unix(0, lastSeen*int64(time.Millisecond))) < PresenceOnlineThreshold
+}
+
+// IsOnline returns whether the contact sent a presence beacon recently
+func (c *Contact) IsOnline(now time.Time) bool {
+	return isOnline(c.GetLastSeen(), now)
+}
+
+// IsOnline returns whether the member sent a presence beacon recently
+func (m *Member) IsOnline(now time.Time) bool {
+	return isOnline(m.GetLastSeen(), now)
+}
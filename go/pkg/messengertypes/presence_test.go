@@ -0,0 +1,26 @@
+package messengertypes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccount_PresenceVisibility(t *testing.T) {
+	require.True(t, Account_PresenceVisibilityContacts.SharesPresenceIn(Conversation_ContactType))
+	require.False(t, Account_PresenceVisibilityContacts.SharesPresenceIn(Conversation_MultiMemberType))
+	require.True(t, Account_PresenceVisibilityEveryone.SharesPresenceIn(Conversation_MultiMemberType))
+	require.False(t, Account_PresenceVisibilityEveryone.SharesPresenceIn(Conversation_AccountType))
+	require.False(t, Account_PresenceVisibilityNobody.SharesPresenceIn(Conversation_ContactType))
+}
+
+func TestContact_IsOnline(t *testing.T) {
+	now := time.Now()
+	ms := func(t time.Time) int64 { return t.UnixNano() / int64(time.Millisecond) }
+
+	require.False(t, (&Contact{}).IsOnline(now))
+	require.True(t, (&Contact{LastSeen: ms(now.Add(-PresenceBeaconInterval))}).IsOnline(now))
+	require.False(t, (&Contact{LastSeen: ms(now.Add(-PresenceOnlineThreshold))}).IsOnline(now))
+	require.True(t, (&Member{LastSeen: ms(now)}).IsOnline(now))
+}
@@ -0,0 +1,62 @@
+package messengertypes
+
+import (
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+const minutesPerDay = 24 * 60
+
+// ValidateQuietHours checks that the bounds of quiet hours are minutes of a day
+func ValidateQuietHours(start, end int32) error {
+	if start < 0 || start >= minutesPerDay || end < 0 || end >= minutesPerDay {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("quiet hours must be between 0 and %d minutes", minutesPerDay-1))
+	}
+
+	return nil
+}
+
+// InQuietHours returns whether now, in its own location, is within the quiet
+// hours of the account, quiet hours ending before they start span midnight
+func (a *Account) InQuietHours(now time.Time) bool {
+	if !a.GetQuietHoursEnabled() {
+		return false
+	}
+
+	start, end := a.GetQuietHoursStart(), a.GetQuietHoursEnd()
+	minute := int32(now.Hour()*60 + now.Minute())
+
+	switch {
+	case start == end:
+		return false
+	case start < end:
+		return minute >= start && minute < end
+	default:
+		return minute >= start || minute < end
+	}
+}
+
+// NotificationsSnoozed returns whether the notifications are held back at now
+// by AccountSnoozeNotifications
+func (a *Account) NotificationsSnoozed(now time.Time) bool {
+	return a.GetNotificationsSnoozedUntil() > now.UnixNano()/int64(time.Millisecond)
+}
+
+// ConversationFocusMaxDuration is the longest a conversation can be put in
+// focus mode at once
+const ConversationFocusMaxDuration = 24 * time.Hour
+
+// IsFocused returns whether the conversation is in focus mode at now, see
+// ConversationFocus
+func (c *Conversation) IsFocused(now time.Time) bool {
+	return c.GetFocusedUntil() > now.UnixNano()/int64(time.Millisecond)
+}
+
+// IsFocusedNotification returns whether the payload of a notification belongs
+// to a conversation in focus mode at now
+func IsFocusedNotification(payload interface{}, now time.Time) bool {
+	withConv, ok := payload.(interface{ GetConversation() *Conversation })
+	return ok && withConv.GetConversation().IsFocused(now)
+}
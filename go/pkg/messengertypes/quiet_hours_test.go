@@ -0,0 +1,52 @@
+package messengertypes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccount_InQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2022, 1, 1, hour, minute, 0, 0, time.Local) }
+
+	require.False(t, (&Account{QuietHoursStart: 0, QuietHoursEnd: 60}).InQuietHours(at(0, 30)))
+
+	day := &Account{QuietHoursEnabled: true, QuietHoursStart: 13 * 60, QuietHoursEnd: 14 * 60}
+	require.True(t, day.InQuietHours(at(13, 0)))
+	require.False(t, day.InQuietHours(at(14, 0)))
+
+	night := &Account{QuietHoursEnabled: true, QuietHoursStart: 22 * 60, QuietHoursEnd: 7 * 60}
+	require.True(t, night.InQuietHours(at(23, 30)))
+	require.True(t, night.InQuietHours(at(6, 59)))
+	require.False(t, night.InQuietHours(at(12, 0)))
+
+	require.NoError(t, ValidateQuietHours(0, 24*60-1))
+	require.Error(t, ValidateQuietHours(-1, 60))
+	require.Error(t, ValidateQuietHours(0, 24*60))
+}
+
+func TestAccount_NotificationsSnoozed(t *testing.T) {
+	now := time.Now()
+	ms := now.UnixNano() / int64(time.Millisecond)
+
+	require.False(t, (&Account{}).NotificationsSnoozed(now))
+	require.True(t, (&Account{NotificationsSnoozedUntil: ms + 1}).NotificationsSnoozed(now))
+	require.False(t, (&Account{NotificationsSnoozedUntil: ms}).NotificationsSnoozed(now))
+}
+
+func TestConversation_IsFocused(t *testing.T) {
+	now := time.Now()
+	ms := now.UnixNano() / int64(time.Millisecond)
+
+	require.False(t, (&Conversation{}).IsFocused(now))
+	require.True(t, (&Conversation{FocusedUntil: ms + 1}).IsFocused(now))
+	require.False(t, (&Conversation{FocusedUntil: ms}).IsFocused(now))
+
+	focused := &Conversation{FocusedUntil: ms + 1}
+	require.True(t, IsFocusedNotification(&StreamEvent_Notified_MessageReceived{Conversation: focused}, now))
+	require.True(t, IsFocusedNotification(&StreamEvent_Notified_IncomingCall{Conversation: focused}, now))
+	require.False(t, IsFocusedNotification(&StreamEvent_Notified_MessageReceived{Conversation: &Conversation{}}, now))
+	require.False(t, IsFocusedNotification(&StreamEvent_Notified_ContactRequestReceived{}, now))
+	require.False(t, IsFocusedNotification(nil, now))
+}
@@ -0,0 +1,22 @@
+package messengertypes
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// QuoteExcerptMaxLength is the maximum amount of characters of a message kept
+// in the snapshot of a reply
+const QuoteExcerptMaxLength = 140
+
+// QuoteExcerpt returns the part of body kept in the snapshot of a reply, it is
+// cut on a character boundary and ends with an ellipsis when truncated
+func QuoteExcerpt(body string) string {
+	body = strings.TrimSpace(body)
+	if utf8.RuneCountInString(body) <= QuoteExcerptMaxLength {
+		return body
+	}
+
+	runes := []rune(body)
+	return strings.TrimSpace(string(runes[:QuoteExcerptMaxLength-1])) + "…"
+}
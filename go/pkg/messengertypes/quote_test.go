@@ -0,0 +1,22 @@
+package messengertypes
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuoteExcerpt(t *testing.T) {
+	require.Equal(t, "", QuoteExcerpt(""))
+	require.Equal(t, "hello", QuoteExcerpt("  hello\n"))
+
+	exact := strings.Repeat("a", QuoteExcerptMaxLength)
+	require.Equal(t, exact, QuoteExcerpt(exact))
+
+	excerpt := QuoteExcerpt(strings.Repeat("é", QuoteExcerptMaxLength+1))
+	require.True(t, utf8.ValidString(excerpt))
+	require.Equal(t, QuoteExcerptMaxLength, utf8.RuneCountInString(excerpt))
+	require.True(t, strings.HasSuffix(excerpt, "…"))
+}
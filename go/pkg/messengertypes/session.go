@@ -0,0 +1,10 @@
+package messengertypes
+
+import (
+	"time"
+)
+
+// ConversationSessionTTL is the delay after which a conversation session
+// without heartbeat is closed, the clients should send a heartbeat at least
+// twice as often
+const ConversationSessionTTL = 90 * time.Second
@@ -0,0 +1,20 @@
+package messengertypes
+
+import (
+	"fmt"
+	"time"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+// SlowModeMaxInterval is the longest delay the slow mode can impose between
+// two messages of a member
+const SlowModeMaxInterval = 6 * time.Hour
+
+func (m *AppMessage_SetSlowMode) Validate() error {
+	if m.GetInterval() < 0 || m.GetInterval() > int64(SlowModeMaxInterval/time.Second) {
+		return errcode.ErrInvalidInput.Wrap(fmt.Errorf("the slow mode interval must be between 0 and %d seconds", int64(SlowModeMaxInterval/time.Second)))
+	}
+
+	return nil
+}
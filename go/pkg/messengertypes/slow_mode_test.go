@@ -0,0 +1,15 @@
+package messengertypes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetSlowModeValidate(t *testing.T) {
+	require.NoError(t, (&AppMessage_SetSlowMode{}).Validate())
+	require.NoError(t, (&AppMessage_SetSlowMode{Interval: 30}).Validate())
+	require.Error(t, (&AppMessage_SetSlowMode{Interval: -1}).Validate())
+	require.Error(t, (&AppMessage_SetSlowMode{Interval: int64(SlowModeMaxInterval/time.Second) + 1}).Validate())
+}
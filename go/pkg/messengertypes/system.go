@@ -0,0 +1,11 @@
+package messengertypes
+
+// SystemConversationPublicKey is the public key of the conversation generated
+// locally by the messenger, it isn't the key of any group
+const SystemConversationPublicKey = "system"
+
+// IsLocal returns whether the conversation only exists on this device, there
+// is no group to send anything to
+func (c *Conversation) IsLocal() bool {
+	return c.GetType() == Conversation_SystemType
+}
@@ -1,8 +1,12 @@
 package messengertypes
 
 import (
+	"bytes"
+	"compress/flate"
 	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
 
 	"github.com/gogo/protobuf/proto"
 
@@ -17,7 +21,13 @@ func (x *AppMessage_Type) UnmarshalJSON(bytes []byte) error {
 	named := ""
 
 	if err := json.Unmarshal(bytes, &named); err != nil {
-		return err
+		// the custom types have no name
+		custom := int32(0)
+		if json.Unmarshal(bytes, &custom) != nil || !AppMessage_Type(custom).IsCustom() {
+			return err
+		}
+		*x = AppMessage_Type(custom)
+		return nil
 	}
 
 	if v, ok := AppMessage_Type_value[named]; ok {
@@ -37,6 +47,10 @@ func (x *AppMessage_Type) MarshalJSON() ([]byte, error) {
 		return json.Marshal(v)
 	}
 
+	if x.IsCustom() {
+		return json.Marshal(int32(*x))
+	}
+
 	return json.Marshal(AppMessage_Undefined.String())
 }
 
@@ -49,6 +63,73 @@ func (x AppMessage_Type) MarshalPayload(sentDate int64, target string, payload p
 	return proto.Marshal(&AppMessage{Type: x, TargetCID: target, Payload: p, SentDate: sentDate})
 }
 
+// InteractionPayloadMaxSize is the maximum size of the payload of an
+// interaction, a deflated payload inflating past it is rejected
+const InteractionPayloadMaxSize = 256 * 1024
+
+// compactPayloadThreshold is the payload size below which compressing is not
+// worth it
+const compactPayloadThreshold = 128
+
+// MarshalCompactPayload is like MarshalPayload but deflates the payload when it
+// makes it smaller, it must only be used when every recipient announced
+// AppMessage_CapabilityCompactPayload.
+func (x AppMessage_Type) MarshalCompactPayload(sentDate int64, target string, payload proto.Message) ([]byte, error) {
+	p, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	am := AppMessage{Type: x, TargetCID: target, Payload: p, SentDate: sentDate}
+	if len(p) >= compactPayloadThreshold {
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(p); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		if buf.Len() < len(p) {
+			am.Payload = buf.Bytes()
+			am.PayloadEncoding = AppMessage_PayloadEncodingDeflate
+		}
+	}
+
+	return proto.Marshal(&am)
+}
+
+// DecodePayload replaces an encoded payload by its raw protobuf form, it is a
+// no-op for payloads that are already raw.
+func (am *AppMessage) DecodePayload() error {
+	switch am.GetPayloadEncoding() {
+	case AppMessage_PayloadEncodingRaw:
+		return nil
+	case AppMessage_PayloadEncodingDeflate:
+		r := flate.NewReader(bytes.NewReader(am.GetPayload()))
+		defer r.Close()
+
+		p, err := io.ReadAll(io.LimitReader(r, InteractionPayloadMaxSize+1))
+		if err != nil {
+			return errcode.ErrDeserialization.Wrap(err)
+		}
+
+		if len(p) > InteractionPayloadMaxSize {
+			return errcode.ErrInvalidInput.Wrap(fmt.Errorf("inflated payload is larger than %d bytes", InteractionPayloadMaxSize))
+		}
+
+		am.Payload = p
+		am.PayloadEncoding = AppMessage_PayloadEncodingRaw
+		return nil
+	default:
+		return errcode.ErrDeserialization.Wrap(fmt.Errorf("unsupported AppMessage payload encoding: %q", am.GetPayloadEncoding()))
+	}
+}
+
 // UnmarshalPayload tries to parse an AppMessage payload in the corresponding type.
 // Since this function returns a proto.Message interface, you still need to cast the returned value, but this function allows you to make it safely.
 func (am AppMessage) UnmarshalPayload() (proto.Message, error) {
@@ -65,7 +146,59 @@ func (am AppMessage) UnmarshalPayload() (proto.Message, error) {
 		message = &AppMessage_SetGroupInfo{}
 	case AppMessage_TypeSetUserInfo:
 		message = &AppMessage_SetUserInfo{}
+	case AppMessage_TypeAccountDeleted:
+		message = &AppMessage_AccountDeleted{}
+	case AppMessage_TypePresence:
+		message = &AppMessage_Presence{}
+	case AppMessage_TypeActivity:
+		message = &AppMessage_Activity{}
+	case AppMessage_TypeCallOffer:
+		message = &AppMessage_CallOffer{}
+	case AppMessage_TypeCallAnswer:
+		message = &AppMessage_CallAnswer{}
+	case AppMessage_TypeCallICECandidate:
+		message = &AppMessage_CallICECandidate{}
+	case AppMessage_TypeCallHangUp:
+		message = &AppMessage_CallHangUp{}
+	case AppMessage_TypeCallLog:
+		message = &AppMessage_CallLog{}
+	case AppMessage_TypeDeliveryReceipt:
+		message = &AppMessage_DeliveryReceipt{}
+	case AppMessage_TypeBookmark:
+		message = &AppMessage_Bookmark{}
+	case AppMessage_TypeUserMessageEdit:
+		message = &AppMessage_UserMessageEdit{}
+	case AppMessage_TypeMessageRetract:
+		message = &AppMessage_MessageRetract{}
+	case AppMessage_TypeSystemMessage:
+		message = &AppMessage_SystemMessage{}
+	case AppMessage_TypeReadReceipt:
+		message = &AppMessage_ReadReceipt{}
+	case AppMessage_TypePinMessage:
+		message = &AppMessage_PinMessage{}
+	case AppMessage_TypePoll:
+		message = &AppMessage_Poll{}
+	case AppMessage_TypePollVote:
+		message = &AppMessage_PollVote{}
+	case AppMessage_TypeCalendarEvent:
+		message = &AppMessage_CalendarEvent{}
+	case AppMessage_TypeCalendarEventRSVP:
+		message = &AppMessage_CalendarEventRSVP{}
+	case AppMessage_TypeLocation:
+		message = &AppMessage_Location{}
+	case AppMessage_TypeLiveLocation:
+		message = &AppMessage_LiveLocation{}
+	case AppMessage_TypeSetEphemeralPolicy:
+		message = &AppMessage_SetEphemeralPolicy{}
+	case AppMessage_TypeContactShare:
+		message = &AppMessage_ContactShare{}
+	case AppMessage_TypeSetSlowMode:
+		message = &AppMessage_SetSlowMode{}
 	default:
+		if am.GetType().IsCustom() {
+			message = &CustomPayload{}
+			break
+		}
 		return nil, errcode.TODO.Wrap(fmt.Errorf("unsupported AppMessage type: %q", am.GetType()))
 	}
 
@@ -80,6 +213,10 @@ func UnmarshalAppMessage(payload []byte) (proto.Message, AppMessage, error) {
 		return nil, AppMessage{}, errcode.ErrDeserialization.Wrap(err)
 	}
 
+	if err := am.DecodePayload(); err != nil {
+		return nil, AppMessage{}, err
+	}
+
 	msg, err := am.UnmarshalPayload()
 	if err != nil {
 		return nil, AppMessage{}, errcode.ErrDeserialization.Wrap(err)
@@ -108,6 +245,26 @@ func (event *StreamEvent) UnmarshalPayload() (proto.Message, error) {
 		message = &StreamEvent_MemberUpdated{}
 	case StreamEvent_TypeDeviceUpdated:
 		message = &StreamEvent_DeviceUpdated{}
+	case StreamEvent_TypeAccountDeleted:
+		message = &StreamEvent_AccountDeleted{}
+	case StreamEvent_TypeActivityUpdated:
+		message = &StreamEvent_ActivityUpdated{}
+	case StreamEvent_TypeCallSignaling:
+		message = &StreamEvent_CallSignaling{}
+	case StreamEvent_TypeNetworkStatusChanged:
+		message = &StreamEvent_NetworkStatusChanged{}
+	case StreamEvent_TypeBookmarkUpdated:
+		message = &StreamEvent_BookmarkUpdated{}
+	case StreamEvent_TypeReadReceiptUpdated:
+		message = &StreamEvent_ReadReceiptUpdated{}
+	case StreamEvent_TypePinnedMessageUpdated:
+		message = &StreamEvent_PinnedMessageUpdated{}
+	case StreamEvent_TypeLocationUpdated:
+		message = &StreamEvent_LocationUpdated{}
+	case StreamEvent_TypeServiceError:
+		message = &StreamEvent_ServiceError{}
+	case StreamEvent_TypeReplayProgress:
+		message = &StreamEvent_ReplayProgress{}
 	case StreamEvent_TypeNotified:
 		message = &StreamEvent_Notified{}
 	case StreamEvent_TypeListEnded:
@@ -131,8 +288,12 @@ func (event *StreamEvent_Notified) UnmarshalPayload() (proto.Message, error) {
 	switch event.GetType() {
 	case StreamEvent_Notified_TypeBasic:
 		message = &StreamEvent_Notified_Basic{}
-	case StreamEvent_Notified_TypeMessageReceived:
+	case StreamEvent_Notified_TypeMessageReceived, StreamEvent_Notified_TypeMentioned:
 		message = &StreamEvent_Notified_MessageReceived{}
+	case StreamEvent_Notified_TypeIncomingCall:
+		message = &StreamEvent_Notified_IncomingCall{}
+	case StreamEvent_Notified_TypeMissedCall:
+		message = &StreamEvent_Notified_MissedCall{}
 	default:
 		return nil, errcode.TODO.Wrap(fmt.Errorf("unsupported Notified type: %q", event.GetType()))
 	}
@@ -216,3 +377,7 @@ func (am *AppMessage) TextRepresentation() (string, error) {
 func (m *AppMessage_UserMessage) TextRepresentation() (string, error) {
 	return m.GetBody(), nil
 }
+
+func (m *AppMessage_SystemMessage) TextRepresentation() (string, error) {
+	return strings.TrimSpace(m.GetTitle() + "\n" + m.GetBody()), nil
+}
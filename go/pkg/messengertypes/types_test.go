@@ -0,0 +1,106 @@
+package messengertypes
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/stretchr/testify/require"
+
+	"berty.tech/berty/v2/go/pkg/errcode"
+)
+
+func TestAppMessage_CompactPayload(t *testing.T) {
+	for _, body := range []string{"hey", strings.Repeat("hello world ", 100)} {
+		raw, err := AppMessage_TypeUserMessage.MarshalPayload(42, "target", &AppMessage_UserMessage{Body: body})
+		require.NoError(t, err)
+
+		compact, err := AppMessage_TypeUserMessage.MarshalCompactPayload(42, "target", &AppMessage_UserMessage{Body: body})
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(compact), len(raw))
+
+		var am AppMessage
+		require.NoError(t, proto.Unmarshal(compact, &am))
+		if len(body) > compactPayloadThreshold {
+			require.Equal(t, AppMessage_PayloadEncodingDeflate, am.PayloadEncoding)
+		} else {
+			require.Equal(t, AppMessage_PayloadEncodingRaw, am.PayloadEncoding)
+		}
+
+		payload, decoded, err := UnmarshalAppMessage(compact)
+		require.NoError(t, err)
+		require.Equal(t, AppMessage_PayloadEncodingRaw, decoded.PayloadEncoding)
+		require.Equal(t, int64(42), decoded.SentDate)
+		require.Equal(t, "target", decoded.TargetCID)
+		require.Equal(t, body, payload.(*AppMessage_UserMessage).Body)
+	}
+}
+
+func TestAppMessage_DecodePayload_Unsupported(t *testing.T) {
+	am := AppMessage{Type: AppMessage_TypeUserMessage, Payload: []byte("garbage"), PayloadEncoding: AppMessage_PayloadEncoding(42)}
+	require.Error(t, am.DecodePayload())
+
+	am = AppMessage{Type: AppMessage_TypeUserMessage, Payload: []byte("garbage"), PayloadEncoding: AppMessage_PayloadEncodingDeflate}
+	require.Error(t, am.DecodePayload())
+}
+
+func TestAppMessage_DecodePayload_TooLarge(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = w.Write(make([]byte, InteractionPayloadMaxSize+1))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	am := AppMessage{Type: AppMessage_TypeUserMessage, Payload: buf.Bytes(), PayloadEncoding: AppMessage_PayloadEncodingDeflate}
+	require.True(t, errcode.Is(am.DecodePayload(), errcode.ErrInvalidInput))
+}
+
+func TestAppMessage_CustomPayload(t *testing.T) {
+	typ := AppMessageCustomTypeMin + 42
+
+	raw, err := typ.MarshalPayload(42, "", &CustomPayload{Data: []byte("custom")})
+	require.NoError(t, err)
+
+	payload, am, err := UnmarshalAppMessage(raw)
+	require.NoError(t, err)
+	require.Equal(t, typ, am.Type)
+	require.Equal(t, []byte("custom"), payload.(*CustomPayload).GetData())
+
+	_, err = (&AppMessage{Type: AppMessage_Type(9999)}).UnmarshalPayload()
+	require.Error(t, err)
+
+	js, err := json.Marshal(&am.Type)
+	require.NoError(t, err)
+	require.Equal(t, "10042", string(js))
+
+	var decoded AppMessage_Type
+	require.NoError(t, json.Unmarshal(js, &decoded))
+	require.Equal(t, typ, decoded)
+	require.Error(t, json.Unmarshal([]byte("42"), &decoded))
+}
+
+func TestNewCustomAppMessageType(t *testing.T) {
+	typ, err := NewCustomAppMessageType(0, 42)
+	require.NoError(t, err)
+	require.Equal(t, AppMessageCustomTypeMin+42, typ)
+	require.Equal(t, int32(0), typ.CustomNamespace())
+
+	typ, err = NewCustomAppMessageType(7, 0)
+	require.NoError(t, err)
+	require.Equal(t, AppMessage_Type(17000), typ)
+	require.Equal(t, int32(7), typ.CustomNamespace())
+
+	require.Equal(t, int32(-1), AppMessage_TypeUserMessage.CustomNamespace())
+
+	_, err = NewCustomAppMessageType(-1, 0)
+	require.Error(t, err)
+	_, err = NewCustomAppMessageType(0, AppMessageCustomNamespaceSize)
+	require.Error(t, err)
+	_, err = NewCustomAppMessageType(math.MaxInt32, 0)
+	require.Error(t, err)
+}
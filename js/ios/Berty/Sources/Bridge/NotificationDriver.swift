@@ -24,6 +24,8 @@ public class NotificationDriver: NSObject, BertybridgeNotificationDriverProtocol
         let content = UNMutableNotificationContent()
         content.title = notif.title
         content.body = notif.body
+        content.threadIdentifier = notif.threadKey
+        content.categoryIdentifier = notif.category
 
         var trigger: UNNotificationTrigger? = nil
         if notif.interval > 0.0 {